@@ -0,0 +1,257 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"ai-index/internal/indexer"
+)
+
+// runCollections implements "collections <command> [flags]" and returns the
+// exit code.
+func runCollections(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: collections migrate [flags] <old-slug> <new-slug>")
+		fmt.Fprintln(os.Stderr, "       collections export [flags] <slug>")
+		fmt.Fprintln(os.Stderr, "       collections import [flags] <slug>")
+		fmt.Fprintln(os.Stderr, "       collections describe [flags] <slug>")
+		return 1
+	}
+
+	switch args[0] {
+	case "migrate":
+		return runMigrateCollection(args[1:])
+	case "export":
+		return runExportCollection(args[1:])
+	case "import":
+		return runImportCollection(args[1:])
+	case "describe":
+		return runDescribeCollection(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown collections command %q (want migrate, export, import, or describe)\n", args[0])
+		return 1
+	}
+}
+
+func runMigrateCollection(args []string) int {
+	fs := flag.NewFlagSet("collections migrate", flag.ContinueOnError)
+	var (
+		tokenEnv  string
+		noCache   bool
+		noSlugMap bool
+		opts      indexer.MigrateOptions
+	)
+	chromaFlags(fs, &opts.Chroma, &tokenEnv)
+	fs.StringVar(&opts.CachePath, "commit-cache", defaultCommitCacheFile,
+		"Commit cache whose entries move with the collection.")
+	fs.BoolVar(&noCache, "no-commit-cache", false, "Leave the commit cache untouched.")
+	fs.StringVar(&opts.SlugMapPath, "slug-map", defaultSlugMapFile,
+		"Slug map whose remotes are repointed at the new slug.")
+	fs.BoolVar(&noSlugMap, "no-slug-map", false, "Leave the slug map untouched.")
+	fs.StringVar(&opts.RootDir, "root", "", "Root directory of the runs using these collections; locked while migrating.")
+	fs.BoolVar(&opts.Copy, "copy", false, "Copy records into a new collection and keep the old one.")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "Check both collections and print the plan without changing anything.")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s collections migrate [flags] <old-slug> <new-slug>\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 1
+	}
+
+	opts.OldSlug = fs.Arg(0)
+	opts.NewSlug = fs.Arg(1)
+	opts.Chroma.Token = os.Getenv(tokenEnv)
+	if noCache {
+		opts.CachePath = ""
+	}
+	if noSlugMap {
+		opts.SlugMapPath = ""
+	}
+	if opts.RootDir != "" {
+		rootDir, err := filepath.Abs(opts.RootDir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error resolving root directory:", err)
+			return 1
+		}
+		opts.RootDir = rootDir
+	}
+
+	if err := indexer.MigrateCollection(context.Background(), os.Stdout, opts); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func runExportCollection(args []string) int {
+	fs := flag.NewFlagSet("collections export", flag.ContinueOnError)
+	var (
+		tokenEnv  string
+		store     string
+		storePath string
+		storeDSN  string
+		opts      indexer.ExportOptions
+	)
+	chromaFlags(fs, &opts.Chroma, &tokenEnv)
+	storeFlags(fs, &store, &storePath, &storeDSN)
+	fs.StringVar(&opts.Out, "out", "", "JSONL file to write the collection to (required; - writes to stdout).")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s collections export [flags] <slug>\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if fs.NArg() != 1 || opts.Out == "" {
+		fs.Usage()
+		return 1
+	}
+
+	opts.Slug = fs.Arg(0)
+	opts.Chroma.Token = os.Getenv(tokenEnv)
+	closeStore, err := openStore(store, storePath, storeDSN, &opts.Chroma)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer closeStore()
+	if err := indexer.ExportCollection(context.Background(), os.Stderr, opts); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func runImportCollection(args []string) int {
+	fs := flag.NewFlagSet("collections import", flag.ContinueOnError)
+	var (
+		tokenEnv  string
+		store     string
+		storePath string
+		storeDSN  string
+		opts      indexer.ImportOptions
+	)
+	chromaFlags(fs, &opts.Chroma, &tokenEnv)
+	storeFlags(fs, &store, &storePath, &storeDSN)
+	fs.StringVar(&opts.In, "in", "", "JSONL file written by collections export (required; - reads stdin).")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s collections import [flags] <slug>\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if fs.NArg() != 1 || opts.In == "" {
+		fs.Usage()
+		return 1
+	}
+
+	opts.Slug = fs.Arg(0)
+	opts.Chroma.Token = os.Getenv(tokenEnv)
+	closeStore, err := openStore(store, storePath, storeDSN, &opts.Chroma)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer closeStore()
+	if err := indexer.ImportCollection(context.Background(), os.Stdout, opts); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func runDescribeCollection(args []string) int {
+	fs := flag.NewFlagSet("collections describe", flag.ContinueOnError)
+	var (
+		tokenEnv  string
+		store     string
+		storePath string
+		storeDSN  string
+		opts      indexer.DescribeOptions
+	)
+	chromaFlags(fs, &opts.Chroma, &tokenEnv)
+	storeFlags(fs, &store, &storePath, &storeDSN)
+	fs.BoolVar(&opts.JSON, "json", false, "Print the description as JSON.")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s collections describe [flags] <slug>\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 1
+	}
+
+	opts.Slug = fs.Arg(0)
+	opts.Chroma.Token = os.Getenv(tokenEnv)
+	closeStore, err := openStore(store, storePath, storeDSN, &opts.Chroma)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer closeStore()
+	if err := indexer.DescribeCollection(context.Background(), os.Stdout, opts); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// chromaFlags registers the Chroma connection flags shared by the indexer
+// and the collections commands.
+func chromaFlags(fs *flag.FlagSet, opts *indexer.ChromaOptions, tokenEnv *string) {
+	fs.StringVar(&opts.URL, "chroma-url", indexer.DefaultChromaURL, "Chroma server base URL.")
+	fs.StringVar(&opts.Tenant, "chroma-tenant", indexer.DefaultChromaTenant, "Chroma tenant.")
+	fs.StringVar(&opts.Database, "chroma-database", indexer.DefaultChromaDatabase, "Chroma database.")
+	fs.StringVar(tokenEnv, "chroma-token-env", "CHROMA_TOKEN",
+		"Environment variable holding the Chroma auth token (unset sends no token).")
+}
+
+// storeFlags registers the flags selecting the store behind the Chroma
+// API: a server, or the embedded or pgvector store the indexer's --store
+// writes.
+func storeFlags(fs *flag.FlagSet, store, path, dsn *string) {
+	fs.StringVar(store, "store", indexer.StoreChroma, "Collection store: chroma, embedded, or pgvector.")
+	fs.StringVar(path, "store-path", indexer.DefaultEmbeddedStorePath, "Directory of the --store embedded database.")
+	fs.StringVar(dsn, "store-dsn", "",
+		"Postgres connection string of the --store pgvector database (default $"+indexer.StoreDSNEnv+").")
+}
+
+// openStore points opts at the embedded or pgvector store when store
+// selects it, returning a func that closes it.
+func openStore(store, path, dsn string, opts *indexer.ChromaOptions) (func(), error) {
+	var (
+		closeStore func() error
+		err        error
+	)
+	switch store {
+	case indexer.StoreChroma:
+		return func() {}, nil
+	case indexer.StoreEmbedded:
+		closeStore, err = indexer.OpenEmbeddedStore(path, opts)
+	case indexer.StorePgvector:
+		closeStore, err = indexer.OpenPgvectorStore(cmp.Or(dsn, os.Getenv(indexer.StoreDSNEnv)), opts)
+	default:
+		return nil, fmt.Errorf("unknown store %q (want chroma, embedded, or pgvector)", store)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		if err := closeStore(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error closing %s store: %v\n", store, err)
+		}
+	}, nil
+}
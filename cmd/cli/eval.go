@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"ai-index/internal/indexer"
+)
+
+// runEval implements "eval [flags] <collection>" and returns the exit code.
+func runEval(args []string) int {
+	fs := flag.NewFlagSet("eval", flag.ContinueOnError)
+	var (
+		tokenEnv string
+		opts     indexer.EvalOptions
+	)
+	chromaFlags(fs, &opts.Chroma, &tokenEnv)
+	fs.StringVar(&opts.QuestionsPath, "questions", "", "YAML or JSON file of questions to evaluate (required).")
+	fs.IntVar(&opts.K, "k", indexer.DefaultEvalK, "Documents retrieved and scored per question.")
+	fs.StringVar(&opts.RerankURL, "rerank-url", "",
+		"Cross-encoder reranking endpoint, e.g. http://localhost:8080/rerank (text-embeddings-inference).")
+	fs.BoolVar(&opts.Grade, "grade", false,
+		"Have Codex answer each question from the retrieved documents and grade the answer from 0 to 1.")
+	fs.StringVar(&opts.CodexPath, "codex-path", "codex", "Codex executable used by --grade.")
+	fs.StringVar(&opts.JSONPath, "json", "", "Also write the report to this JSON file, for comparing runs.")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s eval --questions <file> [flags] <collection>\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if fs.NArg() != 1 || opts.QuestionsPath == "" {
+		fs.Usage()
+		return 1
+	}
+
+	opts.Collection = fs.Arg(0)
+	opts.Chroma.Token = os.Getenv(tokenEnv)
+
+	if _, err := indexer.Evaluate(context.Background(), os.Stdout, opts); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"ai-index/internal/indexer"
+)
+
+// defaultConfigFile is where "init" writes the config.
+const defaultConfigFile = "ai-indexer.json"
+
+// runInit implements "init [flags]" and returns the exit code.
+func runInit(args []string) int {
+	fs := flag.NewFlagSet("init", flag.ContinueOnError)
+	var opts indexer.InitOptions
+	fs.StringVar(&opts.Path, "config", defaultConfigFile, "Config file to create or update.")
+	fs.BoolVar(&opts.SkipChecks, "skip-checks", false, "Do not ping Chroma or look up the Codex executable.")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s init [flags]\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return 1
+	}
+
+	if err := indexer.InitConfig(context.Background(), os.Stdin, os.Stdout, opts); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
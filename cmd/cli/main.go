@@ -1,10 +1,16 @@
 package main
 
 import (
+	"cmp"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"syscall"
 	"time"
 
 	"ai-index/internal/indexer"
@@ -24,42 +30,433 @@ func (s *stringSliceFlag) Set(value string) error {
 	return nil
 }
 
-const defaultCommitCacheFile = "codex_commit_cache.json"
+// splitList parses a comma-separated flag value, dropping empty entries.
+func splitList(value string) []string {
+	var out []string
+	for item := range strings.SplitSeq(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// tagSchedulesFlag collects repeated --tag-schedule tag=cron values.
+type tagSchedulesFlag map[string]string
+
+func (s tagSchedulesFlag) String() string {
+	return fmt.Sprint(map[string]string(s))
+}
+
+func (s tagSchedulesFlag) Set(value string) error {
+	tag, expr, ok := strings.Cut(value, "=")
+	if !ok || strings.TrimSpace(tag) == "" || strings.TrimSpace(expr) == "" {
+		return fmt.Errorf("want tag=cron, got %q", value)
+	}
+	s[strings.TrimSpace(tag)] = strings.TrimSpace(expr)
+	return nil
+}
+
+// setDefault applies a config file value to a flag the command line did not
+// set.
+func setDefault(set map[string]bool, name string, dst *string, value string) {
+	if !set[name] && value != "" {
+		*dst = value
+	}
+}
+
+const (
+	defaultCommitCacheFile = "codex_commit_cache.json"
+	defaultHistoryFile     = "codex_index_history.db"
+	defaultSlugMapFile     = "codex_slug_map.json"
+	defaultDaemonStateFile = "codex_daemon_state.json"
+)
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "report" {
+		os.Exit(runReport(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "collections" {
+		os.Exit(runCollections(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "query" {
+		os.Exit(runQuery(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "eval" {
+		os.Exit(runEval(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "init" {
+		os.Exit(runInit(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "version" {
+		os.Exit(runVersion(os.Args[2:]))
+	}
+
 	var (
 		dryRun       bool
 		summaryJSON  string
+		store        string
+		mockStore    string
+		storePath    string
+		storeDSN     string
+		summaryApp   string
 		cachePath    string
 		noCache      bool
 		skipRepos    stringSliceFlag
+		tags         stringSliceFlag
 		codexTimeout time.Duration
+		keepAlive    time.Duration
+		stdinMode    string
 		parallel     int
+		maxRepos     int
+		summaryKeep  int
+		artifactsDir string
+		artifactKeep int
+		promptBudget int
+		gitParallel  int
+		codexLimit   int
+		maxProcs     int
+		stagger      time.Duration
+		startJitter  time.Duration
+		limits       indexer.ResourceLimits
+		readOnly     bool
+		maxDisk      string
+		outputTail   string
+		tmpDir       string
+		codexPath    string
+		agent        string
+		ingest       string
+		embeddings   indexer.EmbeddingOptions
+		embedKeyEnv  string
+		localFiles   bool
+		ingestBatch  int
+		ingestPar    int
+		ingestTries  int
+		ingestWait   time.Duration
+		slugPolicy   string
+		slugMapPath  string
+		noSlugMap    bool
+		configPath   string
+		proxy        indexer.ProxyConfig
+		indexLinked  bool
+		skipExact    bool
+		duplicates   string
+		detachedHead string
+		emptyRepo    string
+		prepFailure  string
+		fallbacks    string
+		remotes      string
+		fetchAll     bool
+		gitRetries   int
+		gitRetryWait time.Duration
+		healthCheck  string
+		profile      string
+		expertise    bool
+		expertSince  string
+		changelog    bool
+		changeMonths int
+		maxDocChars  int
+		docsPerMod   int
+		onboardDir   string
+		onboardOnly  bool
+		mirrorDir    string
+		codegenLimit time.Duration
+		historyPath  string
+		noHistory    bool
+		summaryCols  string
+		summaryOnly  string
+		summarySort  string
+		eventsPath   string
+		statusPath   string
+		sync         bool
+		backfill     bool
+		storeCheck   bool
+		mcpCheck     bool
+		onNewTag     bool
+		verifyOnly   bool
+		since        string
+		sinceCommit  string
+		chroma       indexer.ChromaOptions
+		tokenEnv     string
+		github       indexer.GitHubOptions
+		githubIssues bool
+		githubEnv    string
+		ciPipelines  bool
+		dataModel    bool
+		dependencies bool
+		validateMeta bool
+		docChanges   bool
+		cpuProfile   string
+		memProfile   string
+		pprofAddr    string
+		daemon       bool
+		daemonOpts   indexer.DaemonOptions
 	)
 
 	flag.BoolVar(&dryRun, "dry-run", false, "Do everything except actually run codex exec.")
 	flag.BoolVar(&dryRun, "n", false, "Alias for --dry-run.")
 	flag.StringVar(&summaryJSON, "summary-json", "codex_index_summary.json", "Path to JSON summary output.")
+	flag.StringVar(&store, "store", indexer.StoreChroma,
+		"Collection store: chroma; mock to dry-run against an empty in-memory store and record its writes; "+
+			"embedded to keep collections in a local database served at --chroma-url; "+
+			"or pgvector to keep them in Postgres (--store-dsn), also served at --chroma-url.")
+	flag.StringVar(&mockStore, "mock-store-file", indexer.DefaultMockStoreFile,
+		"JSON file --store mock records the would-be store operations to.")
+	flag.StringVar(&storePath, "store-path", indexer.DefaultEmbeddedStorePath,
+		"Directory of the --store embedded database.")
+	flag.StringVar(&storeDSN, "store-dsn", "",
+		"Postgres connection string of the --store pgvector database (default $"+indexer.StoreDSNEnv+").")
+	flag.IntVar(&summaryKeep, "summary-keep", 0,
+		"Keep this many previous JSON summaries, renamed with their write time (0 keeps none).")
+	flag.StringVar(&artifactsDir, "artifacts-dir", "",
+		"Write each run's plan, repo logs, Codex reports, summary, and status file to a run directory here.")
+	flag.IntVar(&artifactKeep, "artifacts-keep", 0,
+		"Keep this many run directories under --artifacts-dir, counting the current run (0 keeps all).")
+	flag.StringVar(&summaryApp, "summary-append", "",
+		"Also append each run's JSON summary as one line to this NDJSON file.")
+	flag.StringVar(&summaryCols, "summary-columns", "",
+		"Comma-separated summary table columns "+
+			"(repo, collection, branch, git, codex, status, duration, diff, documents or docs, commit, remote).")
+	flag.StringVar(&slugPolicy, "slug-policy", indexer.SlugPolicyFix,
+		"Slugs that are not valid Chroma collection names: fix (rewrite) or fail (error the repo).")
+	flag.StringVar(&summaryOnly, "summary-only", "",
+		"Only show summary rows with this status: errors or warnings (warn and error).")
+	flag.StringVar(&summarySort, "summary-sort", "",
+		"Sort summary rows by duration (slowest first), status (errors first), or name.")
+	flag.StringVar(&eventsPath, "events", "",
+		"Write one JSON event per repo state transition to this NDJSON file (- for stdout; logs move to stderr).")
+	flag.StringVar(&statusPath, "status-file", "",
+		"Atomically rewrite this JSON file with per-repo states, queue depth, and ETA as the run progresses.")
 	flag.StringVar(&cachePath, "commit-cache", defaultCommitCacheFile,
 		fmt.Sprintf("Path to commit cache file (default %s). Use --no-commit-cache to disable.",
 			defaultCommitCacheFile))
 	flag.BoolVar(&noCache, "no-commit-cache", false, "Disable commit cache.")
+	flag.StringVar(&slugMapPath, "slug-map", defaultSlugMapFile,
+		"Path to the remote URL -> slug map used to detect moved repos.")
+	flag.BoolVar(&noSlugMap, "no-slug-map", false, "Disable the slug map and repo move detection.")
+	flag.StringVar(&historyPath, "history", defaultHistoryFile, "Path to the SQLite run history database.")
+	flag.BoolVar(&noHistory, "no-history", false, "Disable run history recording.")
 	flag.Var(&skipRepos, "skip-repo", "Path, slug, or name of a repository to skip (repeatable).")
+	flag.Var(&tags, "tag", "Index only repos with this config tag (repeatable; any tag matches).")
+	flag.BoolVar(&skipExact, "skip-repo-case-sensitive", false,
+		"Match --skip-repo values case-sensitively instead of case folding.")
 	flag.DurationVar(&codexTimeout, "codex-timeout", 45*time.Minute,
-		"Maximum duration to allow Codex indexing per repository (0 disables the timeout).")
+		"Maximum duration of each Codex run, or of each pass in a pipeline (0 disables the timeout).")
+	flag.StringVar(&stdinMode, "stdin", indexer.StdinKeepAlive,
+		"How Codex stdin is fed: keepalive (periodic newlines), none (open, never written), or closed.")
+	flag.DurationVar(&keepAlive, "stdin-keepalive", 30*time.Second,
+		"Interval between keep-alive newlines written to Codex stdin with --stdin keepalive.")
 	flag.IntVar(&parallel, "parallel", 1, "Number of repositories to index concurrently.")
+	flag.IntVar(&maxRepos, "max-repos", 0,
+		"Index at most N stale repositories per run, most stale first; the rest are deferred (0 = no limit).")
+	flag.IntVar(&gitParallel, "git-parallel", 0,
+		"Maximum repos in the git fetch/worktree phase at once (0 = no limit beyond --parallel).")
+	flag.IntVar(&codexLimit, "codex-parallel", 0,
+		"Maximum concurrent Codex processes (0 = no limit beyond --parallel).")
+	flag.DurationVar(&stagger, "stagger", 0,
+		"Minimum gap between Codex launches across workers, e.g. 30s (0 launches at once).")
+	flag.DurationVar(&startJitter, "startup-jitter", 0,
+		"Delay each worker's first repo by a random duration up to this (0 disables).")
+	flag.IntVar(&maxProcs, "max-procs", 0,
+		"Maximum concurrent git, codegen, and Codex child processes across workers (0 = no limit).")
+	flag.StringVar(&limits.MemoryMax, "codex-max-memory", "",
+		"Memory cap per Codex process via a systemd-run cgroup scope (e.g. 4G).")
+	flag.IntVar(&limits.Nice, "codex-nice", 0, "CPU niceness for Codex processes (-20 to 19).")
+	flag.BoolVar(&readOnly, "read-only-worktree", false,
+		"Mount checkouts and worktrees read-only for Codex via bwrap, with a private writable scratch dir.")
+	flag.StringVar(&limits.IONice, "codex-ionice", "", "I/O priority for Codex processes: idle or best-effort level 0-7.")
+	flag.DurationVar(&codegenLimit, "codegen-timeout", 10*time.Minute,
+		"Maximum duration for a repo's configured codegen command.")
+	flag.StringVar(&configPath, "config", "",
+		"Path to JSON config file with run defaults and per-repo settings (see init).")
+	flag.StringVar(&agent, "agent", indexer.AgentCodex,
+		"Coding agent that indexes each repository: codex, claude (Claude Code), or gemini (Gemini CLI).")
+	flag.StringVar(&ingest, "ingest", indexer.IngestMCP,
+		"How documents reach the store: mcp (the agent's Chroma MCP server), direct (the agent writes a file the "+
+			"indexer upserts over HTTP), or local (no agent; the indexer generates summaries from the files).")
+	flag.StringVar(&embeddings.Provider, "embedder", indexer.EmbedderHash,
+		"Embeddings for documents the indexer stores under --ingest direct or local: hash (local feature hashing), "+
+			"openai (the OpenAI embeddings API or a compatible server), or ollama (a local Ollama daemon).")
+	flag.StringVar(&embeddings.Model, "embed-model", "",
+		"Embedding model (default "+indexer.DefaultOpenAIEmbedModel+" for openai, "+
+			indexer.DefaultOllamaEmbedModel+" for ollama).")
+	flag.StringVar(&embeddings.URL, "embed-url", "",
+		"Base URL of the embeddings API (default "+indexer.DefaultOpenAIURL+" for openai, "+
+			indexer.DefaultOllamaURL+" for ollama).")
+	flag.StringVar(&embedKeyEnv, "embed-key-env", "OPENAI_API_KEY",
+		"Environment variable holding the embeddings API key.")
+	flag.IntVar(&embeddings.ChunkChars, "embed-chunk-chars", indexer.DefaultEmbedChunkChars,
+		"Split documents the indexer stores into chunks of at most this many characters before embedding them.")
+	flag.BoolVar(&localFiles, "local-files", false,
+		"With --ingest local, also store every tracked text file, chunked, as a source_file document.")
+	flag.IntVar(&ingestBatch, "ingest-batch-size", indexer.DefaultIngestBatchSize,
+		"Documents per upsert or delete request under --ingest direct or local.")
+	flag.IntVar(&ingestPar, "ingest-parallel", 4,
+		"Cap on document batches embedded and written at once across all repos (0 = no cap).")
+	flag.IntVar(&ingestTries, "ingest-retries", 3, "Retries for store writes that fail with a 5xx or 429 response.")
+	flag.DurationVar(&ingestWait, "ingest-retry-delay", time.Second,
+		"Upper bound of the random delay before the first store write retry (doubles each attempt).")
+	flag.StringVar(&codexPath, "codex-path", "",
+		"Agent executable used to index each repository (default: codex, claude, or gemini from PATH, per --agent).")
+	flag.StringVar(&proxy.HTTPProxy, "git-http-proxy", "", "HTTP_PROXY override for git fetch operations.")
+	flag.StringVar(&proxy.HTTPSProxy, "git-https-proxy", "", "HTTPS_PROXY override for git fetch operations.")
+	flag.StringVar(&proxy.NoProxy, "git-no-proxy", "", "NO_PROXY list for git fetch operations.")
+	flag.StringVar(&duplicates, "duplicate-policy", indexer.DuplicatePolicyNewest,
+		"Which checkout to index when several share an origin remote: newest, first, or off.")
+	flag.StringVar(&remotes, "remote", "origin",
+		"Comma-separated remote preference order; the first remote present in a repo is used.")
+	flag.BoolVar(&fetchAll, "fetch-all", false, "Run git fetch --all instead of fetching only the index branch.")
+	flag.IntVar(&gitRetries, "git-retries", 2, "Retries for fetch/worktree operations that fail with transient errors.")
+	flag.IntVar(&promptBudget, "prompt-token-budget", indexer.DefaultPromptTokenBudget,
+		"Estimated tokens the prompt plus manifest may use before the diff list is truncated (0 disables).")
+	flag.DurationVar(&gitRetryWait, "git-retry-delay", 2*time.Second,
+		"Initial delay between git retries (doubles on each attempt).")
+	flag.StringVar(&tmpDir, "tmp-dir", "",
+		"Scratch directory for worktrees and TMPDIR of codegen/Codex (default: system temp dir).")
+	flag.StringVar(&outputTail, "output-tail", "8K",
+		"Trailing Codex output kept per repo and reported in the JSON summary when it fails (0 disables).")
+	flag.StringVar(&maxDisk, "max-worktree-disk", "",
+		"Cap on the combined estimated size of live index worktrees (e.g. 20G); larger repos wait their turn.")
+	flag.StringVar(&mirrorDir, "mirror-dir", "",
+		"Directory of bare --mirror clones to create worktrees from (empty fetches into each checkout).")
+	flag.StringVar(&onboardDir, "onboarding-dir", "",
+		"Also have Codex write <dir>/<slug>/ONBOARDING.generated.md for each repo.")
+	flag.BoolVar(&onboardOnly, "onboarding-only", false,
+		"Only write the onboarding documents; skip the collection store and commit cache (needs --onboarding-dir).")
+	flag.StringVar(&profile, "profile", indexer.ProfileDefault,
+		"Add a built-in pass to every repo: security (auth, secrets, input validation, dangerous sinks) "+
+			"or infra (Terraform, Kubernetes, Helm).")
+	flag.BoolVar(&expertise, "expertise", false,
+		"Add a pass writing who-has-touched-what documents per top-level directory from git history.")
+	flag.StringVar(&expertSince, "expertise-since", indexer.DefaultExpertiseSince,
+		"History window for --expertise, as a git --since value.")
+	flag.BoolVar(&changelog, "changelog", false,
+		"Add a pass summarizing recent merge commits and release tags into changelog_summary documents.")
+	flag.IntVar(&changeMonths, "changelog-months", indexer.DefaultChangelogMonths,
+		"Months of history --changelog summarizes.")
+	flag.BoolVar(&githubIssues, "github-issues", false,
+		"Add a pass storing open GitHub issues and recently merged pull requests as issue_context documents.")
+	flag.StringVar(&github.URL, "github-url", indexer.DefaultGitHubURL,
+		"GitHub REST API base URL for --github-issues (GitHub Enterprise: https://<host>/api/v3).")
+	flag.StringVar(&githubEnv, "github-token-env", "GITHUB_TOKEN",
+		"Environment variable holding the GitHub token for --github-issues.")
+	flag.BoolVar(&ciPipelines, "ci-pipelines", false,
+		"Add a pass summarizing GitHub Actions, GitLab CI, and Jenkins pipelines into ci_pipeline documents.")
+	flag.BoolVar(&dataModel, "data-model", false,
+		"Add a pass describing tables and relationships from SQL migrations, Prisma, Ent, and sqlc schemas.")
+	flag.BoolVar(&dependencies, "dependencies", false,
+		"Generate a dependency and license inventory per repo from go.mod, package.json, and requirements files.")
+	flag.BoolVar(&validateMeta, "validate-metadata", false,
+		"After each repo, check the metadata of the documents it wrote against the document schema.")
+	flag.BoolVar(&docChanges, "document-changes", false,
+		"Report per repo how many documents the run added, updated, and deleted, by comparing the collection before and after.")
+	flag.IntVar(&maxDocChars, "max-doc-chars", 0,
+		"Maximum characters per document written to the store; longer content is chunked (0 leaves it to Codex).")
+	flag.IntVar(&docsPerMod, "docs-per-module", 0,
+		"Maximum documents, counting chunks, written per module path (0 leaves it to Codex).")
+	flag.StringVar(&healthCheck, "health-check", indexer.HealthCheckOff,
+		"Run git fsck before indexing: off, quick (connectivity only), or full.")
+	flag.StringVar(&fallbacks, "branch-fallbacks", "main,master",
+		"Comma-separated local branches to try, in order, when origin/HEAD is unset.")
+	flag.StringVar(&detachedHead, "detached-head", indexer.HeadPolicyIndex,
+		"Policy for checkouts with a detached HEAD: index or skip.")
+	flag.StringVar(&emptyRepo, "empty-repo", indexer.HeadPolicySkip,
+		"Policy for checkouts whose HEAD has no commits: skip or index (working tree as-is).")
+	flag.StringVar(&prepFailure, "on-prep-failure", indexer.PrepFailureFallback,
+		"Policy when the index worktree cannot be prepared: fallback (index the working tree), skip, or fail.")
+	flag.BoolVar(&indexLinked, "index-linked-worktrees", false,
+		"Index linked worktrees even when their primary checkout is under the root.")
+	flag.BoolVar(&sync, "sync", false,
+		"Reconcile repos, commit cache, and Chroma collections: reindex missing collections and prune orphans.")
+	flag.BoolVar(&backfill, "backfill", false,
+		"Reindex, from scratch, cached repos whose Chroma collection has no documents.")
+	flag.BoolVar(&storeCheck, "store-check", false,
+		"Probe the Chroma store before indexing and stop when it is down, rejects the token, or lacks the database.")
+	flag.BoolVar(&mcpCheck, "mcp-check", false,
+		"Check the agent has a Chroma MCP server before indexing and stop when it does not (mcp ingestion only).")
+	flag.BoolVar(&verifyOnly, "verify-only", false,
+		"Report which repos are stale against the commit cache without fetching or indexing (exit 2 when any are).")
+	flag.BoolVar(&onNewTag, "on-new-tag", false,
+		"Only index repos whose index branch has a new tag since the last run, indexing the tagged release.")
+	flag.StringVar(&since, "since", "",
+		"Reindex everything changed since this date (YYYY-MM-DD or RFC 3339), ignoring the cached diff base.")
+	flag.StringVar(&sinceCommit, "since-commit", "",
+		"Reindex everything changed since this commit, ignoring the cached diff base.")
+	flag.StringVar(&cpuProfile, "cpuprofile", "", "Write a CPU profile of the run to this file.")
+	flag.StringVar(&memProfile, "memprofile", "", "Write a heap profile to this file when the run ends.")
+	flag.StringVar(&pprofAddr, "pprof-addr", "",
+		"Serve net/http/pprof on this address (e.g. localhost:6060) during the run.")
+	flag.BoolVar(&daemon, "daemon", false,
+		"Keep running and sweep the root directory every time --schedule or a --tag-schedule fires.")
+	flag.StringVar(&daemonOpts.Schedule, "schedule", "",
+		"Cron expression (minute hour day-of-month month day-of-week, local time) of --daemon sweeps, "+
+			"e.g. \"0 3 * * *\" or @daily.")
+	daemonOpts.TagSchedules = make(map[string]string)
+	flag.Var(tagSchedulesFlag(daemonOpts.TagSchedules), "tag-schedule",
+		"Also sweep the repos with a config tag on their own schedule, as tag=cron (repeatable), "+
+			"e.g. critical=\"0 6 * * *\".")
+	flag.StringVar(&daemonOpts.StatePath, "daemon-state", defaultDaemonStateFile,
+		"File the daemon keeps its schedule and last sweep in across restarts.")
+	flag.StringVar(&daemonOpts.Addr, "daemon-addr", "localhost:8765",
+		"Address the daemon serves GET /status and /healthz and POST /pause and /resume on (empty disables).")
+	chromaFlags(flag.CommandLine, &chroma, &tokenEnv)
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [flags] <root-directory>\n\nFlags:\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage: %[1]s [flags] <root-directory>\n"+
+			"       %[1]s --daemon --schedule <cron> [--tag-schedule <tag>=<cron>...] [flags] <root-directory>\n"+
+			"       %[1]s init [flags]\n"+
+			"       %[1]s version [--json]\n"+
+			"       %[1]s report trends [flags]\n"+
+			"       %[1]s collections migrate [flags] <old-slug> <new-slug>\n"+
+			"       %[1]s collections export --out <file> [flags] <slug>\n"+
+			"       %[1]s collections import --in <file> [flags] <slug>\n"+
+			"       %[1]s collections describe [flags] <slug>\n"+
+			"       %[1]s query [flags] <collection> [text...]\n"+
+			"       %[1]s eval --questions <file> [flags] <collection>\n\nFlags:\n", os.Args[0])
 		flag.PrintDefaults()
 	}
 	flag.Parse()
 
-	if flag.NArg() != 1 {
+	var rootArg string
+	if configPath != "" {
+		cfg, err := indexer.LoadConfig(configPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		set := make(map[string]bool)
+		flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+		if cc := cfg.Chroma; cc != nil {
+			setDefault(set, "chroma-url", &chroma.URL, cc.URL)
+			setDefault(set, "chroma-tenant", &chroma.Tenant, cc.Tenant)
+			setDefault(set, "chroma-database", &chroma.Database, cc.Database)
+			setDefault(set, "chroma-token-env", &tokenEnv, cc.TokenEnv)
+		}
+		setDefault(set, "codex-path", &codexPath, cfg.CodexPath)
+		if !set["parallel"] && cfg.Parallel > 0 {
+			parallel = cfg.Parallel
+		}
+		skipRepos = append(stringSliceFlag(cfg.SkipRepos), skipRepos...)
+		for tag, expr := range cfg.TagSchedules {
+			if _, ok := daemonOpts.TagSchedules[tag]; !ok {
+				daemonOpts.TagSchedules[tag] = expr
+			}
+		}
+		rootArg = cfg.Root
+	}
+
+	if flag.NArg() == 1 {
+		rootArg = flag.Arg(0)
+	}
+	if flag.NArg() > 1 || rootArg == "" {
 		flag.Usage()
 		os.Exit(1)
 	}
 
-	rootArg := flag.Arg(0)
+	if daemon != (daemonOpts.Schedule != "" || len(daemonOpts.TagSchedules) > 0) {
+		fmt.Fprintln(os.Stderr, "--daemon needs --schedule or --tag-schedule, and they need --daemon")
+		os.Exit(1)
+	}
+
 	rootDir, err := filepath.Abs(rootArg)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Error resolving root directory:", err)
@@ -71,9 +468,173 @@ func main() {
 	} else if cachePath == "" {
 		cachePath = defaultCommitCacheFile
 	}
+	if noHistory {
+		historyPath = ""
+	}
+	if noSlugMap {
+		slugMapPath = ""
+	}
+
+	if tmpDir != "" {
+		tmpDir, err = filepath.Abs(tmpDir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error resolving --tmp-dir:", err)
+			os.Exit(1)
+		}
+	}
+
+	chroma.Token = os.Getenv(tokenEnv)
+	github.Token = os.Getenv(githubEnv)
+	embeddings.APIKey = os.Getenv(embedKeyEnv)
+
+	var sinceTime time.Time
+	if since != "" {
+		sinceTime, err = indexer.ParseSince(since)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error parsing --since:", err)
+			os.Exit(1)
+		}
+	}
+
+	var maxDiskBytes int64
+	if maxDisk != "" {
+		maxDiskBytes, err = indexer.ParseByteSize(maxDisk)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error parsing --max-worktree-disk:", err)
+			os.Exit(1)
+		}
+	}
+
+	tailBytes, err := indexer.ParseByteSize(outputTail)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error parsing --output-tail:", err)
+		os.Exit(1)
+	}
+	if tailBytes == 0 {
+		tailBytes = -1
+	}
+	if artifactsDir != "" {
+		summarySet := false
+		flag.Visit(func(f *flag.Flag) { summarySet = summarySet || f.Name == "summary-json" })
+		if !summarySet {
+			// The summary goes to the run's artifacts unless placed explicitly.
+			summaryJSON = ""
+		}
+	}
 
-	if err := indexer.Run(rootDir, dryRun, summaryJSON, cachePath, []string(skipRepos), codexTimeout, parallel); err != nil {
+	opts := indexer.Options{
+		RootDir:               rootDir,
+		SummaryJSON:           summaryJSON,
+		Store:                 store,
+		MockStorePath:         mockStore,
+		StorePath:             storePath,
+		StoreDSN:              cmp.Or(storeDSN, os.Getenv(indexer.StoreDSNEnv)),
+		SummaryAppend:         summaryApp,
+		CachePath:             cachePath,
+		SlugMapPath:           slugMapPath,
+		ConfigPath:            configPath,
+		HistoryPath:           historyPath,
+		EventsPath:            eventsPath,
+		StatusPath:            statusPath,
+		DetachedHeadPolicy:    detachedHead,
+		EmptyRepoPolicy:       emptyRepo,
+		PrepFailurePolicy:     prepFailure,
+		Agent:                 agent,
+		Ingest:                ingest,
+		Embeddings:            embeddings,
+		LocalFiles:            localFiles,
+		IngestBatchSize:       ingestBatch,
+		IngestParallel:        ingestPar,
+		IngestRetries:         ingestTries,
+		IngestRetryDelay:      ingestWait,
+		CodexPath:             codexPath,
+		TempDir:               tmpDir,
+		MirrorDir:             mirrorDir,
+		Profile:               profile,
+		ExpertiseSince:        expertSince,
+		OnboardingDir:         onboardDir,
+		OnboardingOnly:        onboardOnly,
+		HealthCheck:           healthCheck,
+		DuplicatePolicy:       duplicates,
+		SlugPolicy:            slugPolicy,
+		SinceCommit:           sinceCommit,
+		SummaryOnly:           summaryOnly,
+		SummarySort:           summarySort,
+		SkipRepos:             []string(skipRepos),
+		Tags:                  []string(tags),
+		SummaryColumns:        splitList(summaryCols),
+		BranchFallbacks:       splitList(fallbacks),
+		Remotes:               splitList(remotes),
+		Proxy:                 proxy,
+		Chroma:                chroma,
+		GitHub:                github,
+		Since:                 sinceTime,
+		CodexLimits:           limits,
+		Stagger:               stagger,
+		StartupJitter:         startJitter,
+		ReadOnlyWorktree:      readOnly,
+		CodexTimeout:          codexTimeout,
+		CodexStdin:            stdinMode,
+		CodexKeepAlive:        keepAlive,
+		CodegenTimeout:        codegenLimit,
+		GitRetryDelay:         gitRetryWait,
+		GitRetries:            gitRetries,
+		SummaryKeep:           summaryKeep,
+		ArtifactsDir:          artifactsDir,
+		ArtifactsKeep:         artifactKeep,
+		ChangelogMonths:       changeMonths,
+		PromptTokenBudget:     promptBudget,
+		MaxDocChars:           maxDocChars,
+		DocsPerModule:         docsPerMod,
+		OutputTail:            int(tailBytes),
+		MaxWorktreeDisk:       maxDiskBytes,
+		Parallel:              parallel,
+		MaxRepos:              maxRepos,
+		GitParallel:           gitParallel,
+		CodexParallel:         codexLimit,
+		MaxProcs:              maxProcs,
+		DryRun:                dryRun,
+		FetchAll:              fetchAll,
+		IndexLinkedWorktrees:  indexLinked,
+		SkipRepoCaseSensitive: skipExact,
+		VerifyOnly:            verifyOnly,
+		OnNewTag:              onNewTag,
+		Expertise:             expertise,
+		Changelog:             changelog,
+		GitHubIssues:          githubIssues,
+		CIPipelines:           ciPipelines,
+		DataModel:             dataModel,
+		Dependencies:          dependencies,
+		ValidateMetadata:      validateMeta,
+		DocumentChanges:       docChanges,
+		Sync:                  sync,
+		Backfill:              backfill,
+		StoreCheck:            storeCheck,
+		MCPCheck:              mcpCheck,
+	}
+	prof, err := startProfiling(cpuProfile, memProfile, pprofAddr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if daemon {
+		// The first SIGINT or SIGTERM stops the daemon once the running
+		// sweep finishes; a second one exits at once.
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-ctx.Done()
+			stop()
+		}()
+		err = indexer.RunDaemon(ctx, os.Stderr, opts, daemonOpts)
+	} else {
+		err = indexer.Run(opts)
+	}
+	prof.stop()
+	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
+		if errors.Is(err, indexer.ErrStaleRepos) {
+			os.Exit(2)
+		}
 		os.Exit(1)
 	}
 }
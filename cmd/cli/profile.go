@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	_ "net/http/pprof" // registers /debug/pprof handlers on http.DefaultServeMux
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// profiler holds the profiling outputs requested on the command line.
+type profiler struct {
+	cpu     *os.File
+	server  *http.Server
+	memPath string
+}
+
+// startProfiling begins CPU profiling to cpuPath and serves net/http/pprof
+// on addr; empty values disable each. The heap profile is written to
+// memPath by stop.
+func startProfiling(cpuPath, memPath, addr string) (*profiler, error) {
+	p := &profiler{}
+	if cpuPath != "" {
+		f, err := os.Create(cpuPath)
+		if err != nil {
+			return nil, fmt.Errorf("create cpu profile: %w", err)
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("start cpu profile: %w", err)
+		}
+		p.cpu = f
+	}
+
+	if addr != "" {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			p.stop()
+			return nil, fmt.Errorf("listen for pprof: %w", err)
+		}
+		p.server = &http.Server{Handler: http.DefaultServeMux}
+		fmt.Fprintf(os.Stderr, "pprof listening on http://%s/debug/pprof/\n", ln.Addr())
+		go func() {
+			if err := p.server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				fmt.Fprintln(os.Stderr, "pprof server:", err)
+			}
+		}()
+	}
+	p.memPath = memPath
+	return p, nil
+}
+
+// stop flushes the CPU profile, writes the heap profile, and shuts down the
+// pprof server. Failures are reported but never change the exit code.
+func (p *profiler) stop() {
+	if p.cpu != nil {
+		pprof.StopCPUProfile()
+		if err := p.cpu.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, "close cpu profile:", err)
+		}
+	}
+	if p.memPath != "" {
+		if err := writeHeapProfile(p.memPath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+	if p.server != nil {
+		_ = p.server.Close()
+	}
+}
+
+func writeHeapProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create memory profile: %w", err)
+	}
+	defer f.Close()
+
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		return fmt.Errorf("write memory profile: %w", err)
+	}
+	return nil
+}
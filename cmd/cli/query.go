@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"ai-index/internal/indexer"
+)
+
+// runQuery implements "query [flags] <collection> [text...]" and returns the
+// exit code.
+func runQuery(args []string) int {
+	fs := flag.NewFlagSet("query", flag.ContinueOnError)
+	var (
+		tokenEnv  string
+		store     string
+		storePath string
+		storeDSN  string
+		opts      indexer.QueryOptions
+	)
+	chromaFlags(fs, &opts.Chroma, &tokenEnv)
+	storeFlags(fs, &store, &storePath, &storeDSN)
+	fs.StringVar(&opts.Format, "format", indexer.QueryFormatJSON, "Output format: json, markdown, or paths.")
+	fs.StringVar(&opts.Kind, "kind", "", "Only match documents of this kind (e.g. module_summary).")
+	fs.StringVar(&opts.Path, "path", "", "Only match documents with this path metadata (e.g. internal/auth).")
+	fs.IntVar(&opts.Limit, "limit", indexer.DefaultQueryLimit, "Maximum documents to print.")
+	fs.StringVar(&opts.RerankURL, "rerank-url", "",
+		"Cross-encoder reranking endpoint, e.g. http://localhost:8080/rerank (text-embeddings-inference).")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s query [flags] <collection> [text...]\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return 1
+	}
+
+	opts.Collection = fs.Arg(0)
+	opts.Text = strings.Join(fs.Args()[1:], " ")
+	opts.Chroma.Token = os.Getenv(tokenEnv)
+	closeStore, err := openStore(store, storePath, storeDSN, &opts.Chroma)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer closeStore()
+
+	if err := indexer.Query(context.Background(), os.Stdout, opts); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"ai-index/internal/indexer"
+)
+
+// runReport implements "report <kind> [flags]" and returns the exit code.
+func runReport(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: report trends [flags]")
+		fmt.Fprintln(os.Stderr, "       report staleness [flags] <root>")
+		return 1
+	}
+
+	switch args[0] {
+	case "trends":
+		return runTrendsReport(args[1:])
+	case "staleness":
+		return runStalenessReport(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown report %q (want trends or staleness)\n", args[0])
+		return 1
+	}
+}
+
+func runTrendsReport(args []string) int {
+	fs := flag.NewFlagSet("report trends", flag.ContinueOnError)
+	var (
+		historyPath string
+		opts        indexer.TrendOptions
+	)
+	fs.StringVar(&historyPath, "history", defaultHistoryFile, "Path to the run history database.")
+	fs.StringVar(&opts.Repo, "repo", "", "Only report on this collection slug.")
+	fs.IntVar(&opts.Window, "window", indexer.DefaultTrendWindow, "Number of recent Codex runs per repo to aggregate.")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s report trends [flags]\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	if err := indexer.ReportTrends(context.Background(), os.Stdout, historyPath, opts); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func runStalenessReport(args []string) int {
+	fs := flag.NewFlagSet("report staleness", flag.ContinueOnError)
+	var (
+		opts               indexer.StalenessOptions
+		remotes, fallbacks string
+	)
+	fs.StringVar(&opts.CachePath, "commit-cache", defaultCommitCacheFile, "Commit cache holding the indexed commits.")
+	fs.StringVar(&opts.ConfigPath, "config", "", "Config file of the runs, for per-repo remotes and collections.")
+	fs.StringVar(&opts.SlugMapPath, "slug-map", defaultSlugMapFile, "Slug map of the runs, for moved repos' collections.")
+	fs.StringVar(&remotes, "remote", "origin", "Comma-separated remote preference order, as for a run.")
+	fs.StringVar(&fallbacks, "branch-fallbacks", "main,master",
+		"Comma-separated local branches to try, in order, when <remote>/HEAD is unset.")
+	fs.BoolVar(&opts.JSON, "json", false, "Print the report as JSON.")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s report staleness [flags] <root>\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 1
+	}
+
+	rootDir, err := filepath.Abs(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error resolving root directory:", err)
+		return 1
+	}
+	opts.RootDir = rootDir
+	opts.Remotes, opts.BranchFallbacks = splitList(remotes), splitList(fallbacks)
+	if err := indexer.ReportStaleness(context.Background(), os.Stdout, opts); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
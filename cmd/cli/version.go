@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"ai-index/internal/indexer"
+)
+
+// runVersion implements "version [flags]" and returns the exit code.
+func runVersion(args []string) int {
+	fs := flag.NewFlagSet("version", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "Print the build information as JSON.")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	info := indexer.ReadBuildInfo()
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(info); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	commit := info.Commit
+	if commit == "" {
+		commit = "unknown"
+	} else if info.Modified {
+		commit += " (modified)"
+	}
+	date := info.Date
+	if date == "" {
+		date = "unknown"
+	}
+	fmt.Printf("ai-indexer %s\n", info.Version)
+	fmt.Printf("commit:  %s\n", commit)
+	fmt.Printf("date:    %s\n", date)
+	fmt.Printf("go:      %s\n", info.GoVersion)
+	fmt.Printf("runners: %s\n", strings.Join(info.Runners, ", "))
+	fmt.Printf("stores:  %s\n", strings.Join(info.Stores, ", "))
+	return 0
+}
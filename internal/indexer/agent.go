@@ -0,0 +1,113 @@
+package indexer
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Agents selectable with Options.Agent.
+const (
+	AgentCodex  = "codex"
+	AgentClaude = "claude"
+	AgentGemini = "gemini"
+)
+
+// AgentBackend is the coding agent that reads a repo's manifest and writes
+// its documents to the store through the agent's Chroma MCP server. Each
+// backend runs its CLI non-interactively with every permission granted;
+// the repo is also the process's working directory.
+type AgentBackend interface {
+	// Name is the agent's name in logs.
+	Name() string
+	// Executable is the command run when Options.CodexPath is empty.
+	Executable() string
+	// Args returns the arguments that run prompt in repoDir. When report is
+	// set and the agent can save its final message to a file, the
+	// arguments do so and writesReport is true; otherwise the indexer
+	// saves the agent's stdout there.
+	Args(repoDir, prompt, report string) (args []string, writesReport bool)
+}
+
+// agentBackends are the built-in backends by Options.Agent name.
+var agentBackends = map[string]AgentBackend{
+	AgentCodex:  codexBackend{},
+	AgentClaude: claudeBackend{},
+	AgentGemini: geminiBackend{},
+}
+
+// agentBackend returns the built-in backend called name; empty selects
+// Codex.
+func agentBackend(name string) (AgentBackend, error) {
+	if name == "" {
+		name = AgentCodex
+	}
+	b, ok := agentBackends[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown agent %q (want codex, claude, or gemini)", name)
+	}
+	return b, nil
+}
+
+// codexBackend runs "codex exec".
+type codexBackend struct{}
+
+func (codexBackend) Name() string       { return "Codex" }
+func (codexBackend) Executable() string { return defaultCodexPath }
+
+func (codexBackend) Args(repoDir, prompt, report string) ([]string, bool) {
+	args := []string{"exec",
+		"--cd", repoDir,
+		"--sandbox", "danger-full-access",
+		"--dangerously-bypass-approvals-and-sandbox"}
+	if report != "" {
+		args = append(args, "--output-last-message", report)
+	}
+	return append(args, prompt), report != ""
+}
+
+// claudeBackend runs Claude Code in print mode, which writes only the
+// final message to stdout.
+type claudeBackend struct{}
+
+func (claudeBackend) Name() string       { return "Claude Code" }
+func (claudeBackend) Executable() string { return "claude" }
+
+func (claudeBackend) Args(_, prompt, _ string) ([]string, bool) {
+	return []string{"--print", "--output-format", "text", "--dangerously-skip-permissions", prompt}, false
+}
+
+// geminiBackend runs Gemini CLI non-interactively with every tool call
+// approved.
+type geminiBackend struct{}
+
+func (geminiBackend) Name() string       { return "Gemini CLI" }
+func (geminiBackend) Executable() string { return "gemini" }
+
+func (geminiBackend) Args(_, prompt, _ string) ([]string, bool) {
+	return []string{"--yolo", "--prompt", prompt}, false
+}
+
+// agentCommand returns the argv running the agent on prompt in repoDir and
+// whether the agent writes report itself.
+func (ix *indexer) agentCommand(repoDir, prompt, report string) ([]string, bool) {
+	args, writesReport := ix.opts.AgentBackend.Args(repoDir, prompt, report)
+	return slices.Concat([]string{ix.codexPath()}, args), writesReport
+}
+
+// describeArgv quotes argv for the dry-run log, showing the prompt as
+// '<PROMPT>'.
+func describeArgv(argv []string, prompt string) string {
+	parts := make([]string, len(argv))
+	for i, arg := range argv {
+		switch {
+		case arg == prompt:
+			parts[i] = "'<PROMPT>'"
+		case i > 0 && strings.ContainsAny(arg, " \t/"):
+			parts[i] = fmt.Sprintf("%q", arg)
+		default:
+			parts[i] = arg
+		}
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,214 @@
+package indexer
+
+import (
+	"bytes"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Problems the agent's output can reveal although it exited 0, recorded
+// as OutputWarning.Kind.
+const (
+	// OutputMCPToolMissing: the agent could not find or start its Chroma
+	// MCP tools, so it wrote nothing.
+	OutputMCPToolMissing = "mcp_tool_missing"
+	// OutputCollectionCreateFailed: creating the collection failed.
+	OutputCollectionCreateFailed = "collection_create_failed"
+	// OutputPartialWrite: some documents were not written.
+	OutputPartialWrite = "partial_write"
+)
+
+// outputLineMax caps the matching line kept in an OutputWarning.
+const outputLineMax = 300
+
+// outputPattern is a line in agent output revealing a problem the exit
+// code hides. Error findings fail the repo; warn findings downgrade it.
+type outputPattern struct {
+	re       *regexp.Regexp
+	kind     string
+	severity string
+}
+
+// outputPatterns are matched against the runner's own lines (see
+// OutputFilter), in the order its findings are reported. They are
+// written against tool errors, not the agent's prose, and must not match
+// the prompt, which Codex echoes.
+var outputPatterns = []outputPattern{
+	{
+		kind:     OutputMCPToolMissing,
+		severity: statusError,
+		re: regexp.MustCompile(`(?i)\b(unknown|unsupported) (mcp )?tool\b|\bmcp tool\b.{0,80}\bnot (found|available)\b|` +
+			`\bmcp (server|client)\b.{0,80}\b(failed to start|not found|not running|unavailable)\b`),
+	},
+	{
+		kind:     OutputCollectionCreateFailed,
+		severity: statusError,
+		re: regexp.MustCompile(`(?i)\b(failed|unable|could not|couldn't) (to )?create (the )?collection\b|` +
+			`\bcreate_collection\b.{0,80}\b(error|failed)\b`),
+	},
+	{
+		kind:     OutputPartialWrite,
+		severity: statusWarn,
+		re: regexp.MustCompile(`(?i)\bpartial(ly)? (write|writes|written|upsert|success)\b|` +
+			`\b(failed|unable) to (add|upsert|write) (some |\d+ )?(documents?|records?)\b|` +
+			`\b\d+ of \d+ documents? (failed|were not (written|stored|added))\b`),
+	},
+}
+
+// OutputWarning is a problem found in the agent's output.
+type OutputWarning struct {
+	// Kind is one of the Output constants.
+	Kind string `json:"kind"`
+	// Severity is "warn" or "error".
+	Severity string `json:"severity"`
+	// Line is the first matching line, with secrets masked.
+	Line string `json:"line"`
+	// Count is how many lines matched.
+	Count int `json:"count"`
+}
+
+// outputScanner matches the agent's output against outputPatterns.
+type outputScanner struct {
+	mask     func(string) string
+	findings []OutputWarning
+	mu       sync.Mutex
+}
+
+func newOutputScanner(mask func(string) string) *outputScanner {
+	return &outputScanner{mask: mask}
+}
+
+// writer returns a writer that feeds the lines of one output stream that
+// runner passes to the scanner. Its last line is only scanned on flush.
+func (s *outputScanner) writer(runner func(string) bool) *outputLineWriter {
+	return &outputLineWriter{scanner: s, runner: runner}
+}
+
+func (s *outputScanner) scan(line string) {
+	for _, p := range outputPatterns {
+		if !p.re.MatchString(line) {
+			continue
+		}
+		s.mu.Lock()
+		if i := slices.IndexFunc(s.findings, func(f OutputWarning) bool { return f.Kind == p.kind }); i >= 0 {
+			s.findings[i].Count++
+		} else {
+			line := truncateRunes(strings.TrimSpace(s.mask(line)), outputLineMax)
+			s.findings = append(s.findings, OutputWarning{Kind: p.kind, Severity: p.severity, Line: line, Count: 1})
+		}
+		s.mu.Unlock()
+	}
+}
+
+// result returns the findings in outputPatterns order and the first error
+// among them, if any.
+func (s *outputScanner) result() ([]OutputWarning, *AgentOutputError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	findings := slices.Clone(s.findings)
+	slices.SortStableFunc(findings, func(a, b OutputWarning) int {
+		return outputPatternIndex(a.Kind) - outputPatternIndex(b.Kind)
+	})
+	for _, f := range findings {
+		if f.Severity == statusError {
+			return findings, &AgentOutputError{Kind: f.Kind, Line: f.Line}
+		}
+	}
+	return findings, nil
+}
+
+func outputPatternIndex(kind string) int {
+	return slices.IndexFunc(outputPatterns, func(p outputPattern) bool { return p.kind == kind })
+}
+
+// OutputFilter is implemented by agent backends whose output mixes the
+// runner's own lines with the files the agent reads and the output of the
+// commands it runs, which may contain any text. Only the runner's lines are
+// matched against outputPatterns; the output of a backend without an
+// OutputFilter is matched whole.
+type OutputFilter interface {
+	// RunnerLines returns a classifier for one output stream, reporting
+	// whether each line, passed in order, is the runner's own.
+	RunnerLines() func(line string) bool
+}
+
+// runnerLines returns the backend's classifier for one output stream.
+func runnerLines(b AgentBackend) func(string) bool {
+	if f, ok := b.(OutputFilter); ok {
+		return f.RunnerLines()
+	}
+	return func(string) bool { return true }
+}
+
+// Lines of Codex itself.
+var (
+	// runnerLogLine is a log line of the runner, such as Codex's
+	// "2025-06-01T12:00:00.123456Z ERROR codex_core::mcp_connection_manager: ...".
+	runnerLogLine = regexp.MustCompile(`^(\d{4}-\d\d-\d\dT\S+\s+)?(ERROR|WARN)\s+[\w:]+:`)
+	// runnerEventLine is the header of an event in Codex's exec output,
+	// "[2025-06-01T12:00:00] ...", capturing the event.
+	runnerEventLine = regexp.MustCompile(`^\[\d{4}-\d\d-\d\dT[^\]]*\]\s+(.*)$`)
+	// runnerErrorEvent is an error event, "ERROR: ...".
+	runnerErrorEvent = regexp.MustCompile(`^(ERROR|WARN(ING)?)\b`)
+	// runnerToolEvent is an MCP tool call, "tool chroma.chroma_add_documents(...)",
+	// or its result, "chroma.chroma_add_documents(...) failed in 3ms:". The
+	// result's lines follow up to the next event.
+	runnerToolEvent = regexp.MustCompile(`^(tool\s+)?[\w-]+\.[\w-]+\(`)
+)
+
+// RunnerLines passes Codex's log lines, error events, and MCP tool calls
+// with their results.
+func (codexBackend) RunnerLines() func(string) bool {
+	// inTool is set while the lines of a tool call or result are written.
+	inTool := false
+	return func(line string) bool {
+		if m := runnerEventLine.FindStringSubmatch(line); m != nil {
+			inTool = runnerToolEvent.MatchString(m[1])
+			return inTool || runnerErrorEvent.MatchString(m[1])
+		}
+		return inTool || runnerLogLine.MatchString(line)
+	}
+}
+
+// outputLineWriter splits one stream into lines for an outputScanner and
+// passes on the runner's own lines. exec writes each stream from a single
+// goroutine, so it needs no lock.
+type outputLineWriter struct {
+	scanner *outputScanner
+	runner  func(string) bool
+	partial []byte
+}
+
+// line scans line when it is the runner's own.
+func (w *outputLineWriter) line(line string) {
+	if w.runner(line) {
+		w.scanner.scan(line)
+	}
+}
+
+func (w *outputLineWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.line(string(w.partial[:i]))
+		w.partial = w.partial[i+1:]
+	}
+	// Bound a line that never ends, such as a progress bar.
+	if len(w.partial) > 64<<10 {
+		w.flush()
+	}
+	return len(p), nil
+}
+
+// flush scans the last, unterminated line.
+func (w *outputLineWriter) flush() {
+	if len(w.partial) > 0 {
+		w.line(string(w.partial))
+		w.partial = nil
+	}
+}
@@ -0,0 +1,206 @@
+package indexer
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOutputScanner(t *testing.T) {
+	const (
+		call   = "[2026-05-01T10:00:00] tool chroma.chroma_add_documents({\"collection_name\":\"services_api\"})\n"
+		failed = "[2026-05-01T10:00:01] chroma.chroma_add_documents({}) failed in 12ms:\n"
+		ok     = "[2026-05-01T10:00:01] chroma.chroma_add_documents({}) success in 12ms:\n"
+	)
+	tests := map[string]struct {
+		// backend defaults to Codex.
+		backend AgentBackend
+		output  string
+		want    []OutputWarning
+		wantErr string
+	}{
+		"clean": {output: call + ok + "{\"added\": 12}\n[2026-05-01T10:00:02] codex\nindexed 12 documents\n"},
+		"missing tool": {
+			output: "[2026-05-01T10:00:00] ERROR: unknown tool chroma_add_documents\n",
+			want: []OutputWarning{
+				{OutputMCPToolMissing, statusError, "[2026-05-01T10:00:00] ERROR: unknown tool chroma_add_documents", 1},
+			},
+			wantErr: OutputMCPToolMissing,
+		},
+		"mcp server down": {
+			output: "2026-05-01T10:00:00.123Z ERROR codex_core::mcp_connection_manager: " +
+				"MCP client for `chroma` failed to start: exit status 1",
+			want: []OutputWarning{{
+				OutputMCPToolMissing, statusError,
+				"2026-05-01T10:00:00.123Z ERROR codex_core::mcp_connection_manager: " +
+					"MCP client for `chroma` failed to start: exit status 1",
+				1,
+			}},
+			wantErr: OutputMCPToolMissing,
+		},
+		"collection create failed": {
+			output: call + failed + "Failed to create collection services_api: 500\n",
+			want: []OutputWarning{
+				{OutputCollectionCreateFailed, statusError, "Failed to create collection services_api: 500", 1},
+			},
+			wantErr: OutputCollectionCreateFailed,
+		},
+		"partial writes counted": {
+			output: call + ok + "3 of 40 documents failed\n" + call + ok + "failed to add 2 documents\n",
+			want:   []OutputWarning{{OutputPartialWrite, statusWarn, "3 of 40 documents failed", 2}},
+		},
+		"ordered by pattern": {
+			output: call + ok + "partial write to services_api\n" +
+				"[2026-05-01T10:00:03] ERROR: unknown tool chroma_query_documents",
+			want: []OutputWarning{
+				{OutputMCPToolMissing, statusError, "[2026-05-01T10:00:03] ERROR: unknown tool chroma_query_documents", 1},
+				{OutputPartialWrite, statusWarn, "partial write to services_api", 1},
+			},
+			wantErr: OutputMCPToolMissing,
+		},
+		"echoed file content": {
+			output: "[2026-05-01T10:00:00] exec bash -lc 'cat agent_output_test.go' in /repo\n" +
+				"[2026-05-01T10:00:00] bash -lc 'cat agent_output_test.go' succeeded in 5ms:\n" +
+				"\toutput: \"Error: unknown tool chroma_add_documents\",\n" +
+				"\t// Failed to create collection when the store is down.\n" +
+				"mcp server chroma failed to start: exit status 1\n" +
+				"[2026-05-01T10:00:01] codex\nThe tests cover unknown tool errors and partial writes.\n",
+		},
+		"unstructured output": {output: "Error: unknown tool chroma_add_documents\n3 of 40 documents failed\n"},
+		"claude": {
+			backend: claudeBackend{},
+			output:  "Indexed services_api, but 3 of 40 documents failed to embed.\n",
+			want: []OutputWarning{
+				{OutputPartialWrite, statusWarn, "Indexed services_api, but 3 of 40 documents failed to embed.", 1},
+			},
+		},
+		"claude missing tool": {
+			backend: claudeBackend{},
+			output:  "Error: unknown tool chroma_add_documents\n",
+			want: []OutputWarning{
+				{OutputMCPToolMissing, statusError, "Error: unknown tool chroma_add_documents", 1},
+			},
+			wantErr: OutputMCPToolMissing,
+		},
+		"gemini": {
+			backend: geminiBackend{},
+			output: "Error executing tool chroma_create_collection: Failed to create collection services_api: 500\n" +
+				"I could not index the repository.\n",
+			want: []OutputWarning{{
+				OutputCollectionCreateFailed, statusError,
+				"Error executing tool chroma_create_collection: Failed to create collection services_api: 500", 1,
+			}},
+			wantErr: OutputCollectionCreateFailed,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := newOutputScanner(func(s string) string { return s })
+			w := s.writer(runnerLines(cmp.Or[AgentBackend](tc.backend, codexBackend{})))
+			// Split writes mid-line, as pipes do.
+			for chunk := range strings.SplitSeq(tc.output, "o") {
+				_, _ = io.WriteString(w, chunk+"o")
+			}
+			w.partial = w.partial[:len(w.partial)-1]
+			w.flush()
+
+			got, err := s.result()
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("expected %+v, got %+v", tc.want, got)
+			}
+			if tc.wantErr == "" && err != nil || tc.wantErr != "" && (err == nil || err.Kind != tc.wantErr) {
+				t.Fatalf("expected error %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+// TestOutputPatternsSkipPrompts guards against patterns matching the
+// prompts, which Codex echoes before its own output.
+func TestOutputPatternsSkipPrompts(t *testing.T) {
+	prompts := []string{codexPrompt, directOutputPrompt, securityPassPrompt, infraPassPrompt, expertisePassPrompt,
+		changelogPassPrompt, issuesPassPrompt, ciPassPrompt, dataModelPassPrompt}
+	for _, prompt := range prompts {
+		for line := range strings.Lines(prompt) {
+			for _, p := range outputPatterns {
+				if p.re.MatchString(line) {
+					t.Fatalf("pattern %s matches prompt line %q", p.kind, line)
+				}
+			}
+		}
+	}
+}
+
+func TestRunResultsAgentOutput(t *testing.T) {
+	tests := map[string]struct {
+		output     string
+		wantStatus string
+		wantKind   string
+	}{
+		"silent failure": {
+			output:     "'[2026-05-01T10:00:00] ERROR: unknown tool chroma_add_documents'",
+			wantStatus: statusError,
+			wantKind:   ErrorKindAgentOutput,
+		},
+		"partial write": {
+			output: "'[2026-05-01T10:00:00] chroma.chroma_add_documents({}) success in 9ms:' " +
+				"'2 of 9 documents were not written'",
+			wantStatus: statusWarn,
+		},
+		"echoed file": {
+			output: "'[2026-05-01T10:00:00] bash -lc \"cat main_test.go\" succeeded in 5ms:' " +
+				"'t.Fatal(\"Failed to create collection\")'",
+			wantStatus: statusOK,
+		},
+		"clean": {output: "'indexed 9 documents'", wantStatus: statusOK},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rootDir := t.TempDir()
+			initGitRepo(t, filepath.Join(rootDir, "api"))
+			codexPath := filepath.Join(t.TempDir(), "codex")
+			codex := fmt.Sprintf("#!/bin/sh\nprintf '%%s\\n' %s >&2\nexit 0\n", tc.output)
+			if err := os.WriteFile(codexPath, []byte(codex), 0o755); err != nil {
+				t.Fatalf("write codex stub: %v", err)
+			}
+			cachePath := filepath.Join(t.TempDir(), "cache.json")
+
+			results, err := RunResults(Options{
+				RootDir:     rootDir,
+				CodexPath:   codexPath,
+				CodexStdin:  StdinClosed,
+				CachePath:   cachePath,
+				SummaryJSON: filepath.Join(t.TempDir(), "summary.json"),
+			})
+			if len(results) != 1 {
+				t.Fatalf("expected 1 result, got %d (%v)", len(results), err)
+			}
+			r := results[0]
+			if got := repoStatus(&r); got != tc.wantStatus || r.ErrorKind != tc.wantKind {
+				t.Fatalf("expected status %s (%q), got %s (%q): %+v", tc.wantStatus, tc.wantKind, got, r.ErrorKind, r)
+			}
+			var outErr *AgentOutputError
+			if failed := errors.As(r.Err, &outErr); failed != (tc.wantStatus == statusError) {
+				t.Fatalf("unexpected error %v", r.Err)
+			}
+			if tc.wantStatus != statusOK && len(r.OutputWarnings) != 1 {
+				t.Fatalf("expected one output warning, got %+v", r.OutputWarnings)
+			}
+			cache, err := loadCommitCache(cachePath)
+			if err != nil {
+				t.Fatalf("load cache: %v", err)
+			}
+			if _, cached := cache.LastCommit(r.CollectionSlug, "trunk"); cached == (tc.wantStatus == statusError) {
+				t.Fatalf("expected the commit cached only when the repo did not fail, cached=%v", cached)
+			}
+		})
+	}
+}
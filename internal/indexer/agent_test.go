@@ -0,0 +1,98 @@
+package indexer
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestAgentBackendArgs(t *testing.T) {
+	tests := map[string]struct {
+		agent        string
+		report       string
+		want         []string
+		writesReport bool
+	}{
+		"codex": {
+			agent: AgentCodex,
+			want: []string{"exec", "--cd", "/repo", "--sandbox", "danger-full-access",
+				"--dangerously-bypass-approvals-and-sandbox", "PROMPT"},
+		},
+		"codex with report": {
+			agent:  AgentCodex,
+			report: "/run/index.md",
+			want: []string{"exec", "--cd", "/repo", "--sandbox", "danger-full-access",
+				"--dangerously-bypass-approvals-and-sandbox", "--output-last-message", "/run/index.md", "PROMPT"},
+			writesReport: true,
+		},
+		"claude": {
+			agent:  AgentClaude,
+			report: "/run/index.md",
+			want:   []string{"--print", "--output-format", "text", "--dangerously-skip-permissions", "PROMPT"},
+		},
+		"gemini": {
+			agent: AgentGemini,
+			want:  []string{"--yolo", "--prompt", "PROMPT"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			backend, err := agentBackend(tc.agent)
+			if err != nil {
+				t.Fatalf("agent backend: %v", err)
+			}
+			got, writesReport := backend.Args("/repo", "PROMPT", tc.report)
+			if !slices.Equal(got, tc.want) || writesReport != tc.writesReport {
+				t.Fatalf("expected %q (writes report %t), got %q (%t)", tc.want, tc.writesReport, got, writesReport)
+			}
+		})
+	}
+
+	if _, err := agentBackend("aider"); err == nil {
+		t.Fatal("expected an unknown agent to be rejected")
+	}
+}
+
+func TestRunResultsAgentReport(t *testing.T) {
+	rootDir := t.TempDir()
+	initGitRepo(t, filepath.Join(rootDir, "api"))
+	claudePath := filepath.Join(t.TempDir(), "claude")
+	claude := "#!/bin/sh\necho \"indexed with $1\"\n"
+	if err := os.WriteFile(claudePath, []byte(claude), 0o755); err != nil {
+		t.Fatalf("write claude stub: %v", err)
+	}
+	artifactsDir := t.TempDir()
+
+	_, err := RunResults(Options{
+		RootDir:      rootDir,
+		Agent:        AgentClaude,
+		CodexPath:    claudePath,
+		CodexStdin:   StdinClosed,
+		ArtifactsDir: artifactsDir,
+	})
+	if err != nil {
+		t.Fatalf("run indexer: %v", err)
+	}
+	runs, err := os.ReadDir(artifactsDir)
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("expected one run directory, got %v (%v)", runs, err)
+	}
+	runDir := filepath.Join(artifactsDir, runs[0].Name())
+
+	log, err := os.ReadFile(filepath.Join(runDir, artifactLogs, "api.log"))
+	if err != nil || !strings.Contains(string(log), "- running Claude Code indexing") {
+		t.Fatalf("expected the log to name the agent, got:\n%s (%v)", log, err)
+	}
+	report, err := os.ReadFile(filepath.Join(runDir, artifactReports, "api", "index.md"))
+	if err != nil || strings.TrimSpace(string(report)) != "indexed with --print" {
+		t.Fatalf("expected the agent's stdout as its report, got %q (%v)", report, err)
+	}
+
+	if _, err := RunResults(Options{RootDir: rootDir, Agent: "aider", DryRun: true}); err == nil ||
+		!strings.Contains(err.Error(), "unknown agent") {
+		t.Fatalf("expected an unknown agent error, got %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package indexer
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Files and directories in a run's artifacts directory.
+const (
+	artifactPlan    = "plan.json"
+	artifactSummary = "summary.json"
+	artifactStatus  = "status.json"
+	artifactLogs    = "logs"
+	artifactReports = "reports"
+)
+
+// runIDLayout is the time prefix of newRunID.
+const runIDLayout = "20060102T150405"
+
+// runArtifacts is this run's directory under --artifacts-dir, named by its
+// run ID. It holds the plan, the per-repo logs, Codex's final reports, the
+// summary, and the status file.
+type runArtifacts struct {
+	dir string
+}
+
+// newRunArtifacts creates the run's directory under root and, when keep is
+// positive, removes all but the keep newest run directories.
+func newRunArtifacts(root, runID string, keep int) (*runArtifacts, error) {
+	a := &runArtifacts{dir: filepath.Join(root, runID)}
+	for _, dir := range []string{a.dir, a.path(artifactLogs), a.path(artifactReports)} {
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			return nil, fmt.Errorf("create artifacts dir: %w", err)
+		}
+	}
+	if keep > 0 {
+		if err := pruneRunArtifacts(root, keep); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// pruneRunArtifacts removes run directories under root beyond the keep
+// newest. Only directories named like a run ID are considered.
+func pruneRunArtifacts(root string, keep int) error {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return fmt.Errorf("list artifacts dir: %w", err)
+	}
+	var runs []string
+	for _, entry := range entries {
+		stamp, _, ok := strings.Cut(entry.Name(), "-")
+		if !ok || !entry.IsDir() {
+			continue
+		}
+		if _, err := time.Parse(runIDLayout, stamp); err == nil {
+			runs = append(runs, entry.Name())
+		}
+	}
+	slices.Sort(runs)
+	for _, name := range runs[:max(len(runs)-keep, 0)] {
+		if err := os.RemoveAll(filepath.Join(root, name)); err != nil {
+			return fmt.Errorf("prune run artifacts: %w", err)
+		}
+	}
+	return nil
+}
+
+// path returns name inside the run directory.
+func (a *runArtifacts) path(name ...string) string {
+	return filepath.Join(append([]string{a.dir}, name...)...)
+}
+
+// repoArtifactName is the file name of a repo's log and reports directory.
+func repoArtifactName(rootDir, repoDir string) string {
+	return sanitizePathComponent(computeCollectionSlug(rootDir, repoDir))
+}
+
+// openLog creates the log of the repo named name.
+func (a *runArtifacts) openLog(name string) (*os.File, error) {
+	f, err := os.OpenFile(a.path(artifactLogs, name+".log"), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open repo log: %w", err)
+	}
+	return f, nil
+}
+
+// openRepoLog points log at the repo's log file under --artifacts-dir,
+// returning its path and a func closing it. Without an artifacts directory,
+// or when the log cannot be created, the repo logs to the console only.
+func (ix *indexer) openRepoLog(log *repoLogger, rootDir, repoDir string) (string, func()) {
+	if ix.artifacts == nil {
+		return "", func() {}
+	}
+	log.artifact = repoArtifactName(rootDir, repoDir)
+	f, err := ix.artifacts.openLog(log.artifact)
+	if err != nil {
+		ix.errln("Error opening repo log:", err)
+		return "", func() {}
+	}
+	log.file = f
+	return f.Name(), func() {
+		if err := f.Close(); err != nil {
+			ix.errln("Error closing repo log:", err)
+		}
+	}
+}
+
+// reportPath is where Codex writes its final message for a pass, creating
+// the repo's reports directory. A run without a pipeline has one pass,
+// reported as "index".
+func (a *runArtifacts) reportPath(name, pass string) (string, error) {
+	dir := a.path(artifactReports, name)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return "", fmt.Errorf("create reports dir: %w", err)
+	}
+	return filepath.Join(dir, sanitizePathComponent(cmp.Or(pass, "index"))+".md"), nil
+}
+
+// runPlan is the plan.json of a run: what was discovered and how it will be
+// indexed.
+type runPlan struct {
+	GeneratedAt string     `json:"generated_at"`
+	RunID       string     `json:"run_id"`
+	RootDir     string     `json:"root_dir"`
+	Repos       []planRepo `json:"repos"`
+	Tags        []string   `json:"tags,omitempty"`
+	Parallel    int        `json:"parallel"`
+	DryRun      bool       `json:"dry_run"`
+}
+
+// planRepo is one discovered checkout in the plan.
+type planRepo struct {
+	Path        string `json:"path"`
+	Log         string `json:"log"`
+	Remote      string `json:"remote,omitempty"`
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+	WorktreeOf  string `json:"worktree_of,omitempty"`
+}
+
+// writePlan records the discovered repos in plan.json.
+func (ix *indexer) writePlan(rootDir string, dryRun bool, repos []discoveredRepo, workers int) error {
+	plan := runPlan{
+		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
+		RunID:       ix.runID,
+		RootDir:     rootDir,
+		Tags:        ix.opts.Tags,
+		Parallel:    workers,
+		DryRun:      dryRun,
+	}
+	for _, repo := range repos {
+		plan.Repos = append(plan.Repos, planRepo{
+			Path:        repo.path,
+			Log:         ix.artifacts.path(artifactLogs, repoArtifactName(rootDir, repo.path)+".log"),
+			Remote:      redactURL(repo.remote),
+			DuplicateOf: repo.duplicateOf,
+			WorktreeOf:  repo.worktreeOf,
+		})
+	}
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal plan: %w", err)
+	}
+	if err := writeFileSynced(ix.artifacts.path(artifactPlan), data, 0o600); err != nil {
+		return fmt.Errorf("write plan: %w", err)
+	}
+	return nil
+}
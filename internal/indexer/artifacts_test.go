@@ -0,0 +1,97 @@
+package indexer
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPruneRunArtifacts(t *testing.T) {
+	root := t.TempDir()
+	runs := []string{"20240601T100000-1", "20240602T100000-2", "20240603T100000-3"}
+	for _, name := range append(slices.Clone(runs), "notes", "2024-backup") {
+		if err := os.Mkdir(filepath.Join(root, name), 0o750); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+	}
+
+	if err := pruneRunArtifacts(root, 2); err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatalf("read dir: %v", err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+	want := []string{"20240602T100000-2", "20240603T100000-3", "2024-backup", "notes"}
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestRunResultsArtifacts(t *testing.T) {
+	rootDir := t.TempDir()
+	initGitRepo(t, filepath.Join(rootDir, "api"))
+	codexPath := filepath.Join(t.TempDir(), "codex")
+	codex := "#!/bin/sh\n" +
+		"while [ $# -gt 0 ]; do\n" +
+		"  if [ \"$1\" = --output-last-message ]; then echo 'indexed 3 modules' > \"$2\"; fi\n" +
+		"  shift\n" +
+		"done\n" +
+		"echo 'codex output line'\n"
+	if err := os.WriteFile(codexPath, []byte(codex), 0o755); err != nil {
+		t.Fatalf("write codex stub: %v", err)
+	}
+	artifactsDir := t.TempDir()
+
+	results, err := RunResults(Options{
+		RootDir:      rootDir,
+		CodexPath:    codexPath,
+		CodexStdin:   StdinClosed,
+		ArtifactsDir: artifactsDir,
+	})
+	if err != nil {
+		t.Fatalf("run indexer: %v", err)
+	}
+	runs, err := os.ReadDir(artifactsDir)
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("expected one run directory, got %v (%v)", runs, err)
+	}
+	runDir := filepath.Join(artifactsDir, runs[0].Name())
+
+	for _, name := range []string{artifactSummary, artifactStatus} {
+		if _, err := os.Stat(filepath.Join(runDir, name)); err != nil {
+			t.Fatalf("expected %s in the run directory: %v", name, err)
+		}
+	}
+	var plan runPlan
+	data, err := os.ReadFile(filepath.Join(runDir, artifactPlan))
+	if err != nil || json.Unmarshal(data, &plan) != nil {
+		t.Fatalf("read plan: %v", err)
+	}
+	logPath := filepath.Join(runDir, artifactLogs, "api.log")
+	if len(plan.Repos) != 1 || plan.Repos[0].Log != logPath || results[0].LogPath != logPath {
+		t.Fatalf("expected the plan and result to name %s, got %+v and %q", logPath, plan.Repos, results[0].LogPath)
+	}
+
+	log, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("read repo log: %v", err)
+	}
+	for _, want := range []string{"==> " + filepath.Join(rootDir, "api"), "- running Codex indexing", "codex output line"} {
+		if !strings.Contains(string(log), want) {
+			t.Fatalf("expected the log to contain %q, got:\n%s", want, log)
+		}
+	}
+	report, err := os.ReadFile(filepath.Join(runDir, artifactReports, "api", "index.md"))
+	if err != nil || strings.TrimSpace(string(report)) != "indexed 3 modules" {
+		t.Fatalf("expected Codex's report, got %q (%v)", report, err)
+	}
+}
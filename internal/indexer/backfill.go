@@ -0,0 +1,67 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// backfillState answers, for a --backfill run, whether a repo's collection
+// holds any documents, remembering the repos it sent back to Codex.
+type backfillState struct {
+	client     *chromaClient
+	backfilled map[string]bool
+	mu         sync.Mutex
+}
+
+func newBackfillState(opts ChromaOptions) *backfillState {
+	return &backfillState{
+		client:     newChromaClient(opts),
+		backfilled: make(map[string]bool),
+	}
+}
+
+// empty reports whether slug's collection is missing or has no documents,
+// recording it as backfilled when it is.
+func (b *backfillState) empty(ctx context.Context, slug string) (bool, error) {
+	if b == nil {
+		return false, nil
+	}
+	n, err := b.documents(ctx, slug)
+	if err != nil || n > 0 {
+		return false, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.backfilled[slug] = true
+	return true, nil
+}
+
+// documents counts the documents in slug's collection; a missing
+// collection has none.
+func (b *backfillState) documents(ctx context.Context, slug string) (int, error) {
+	col, ok, err := b.client.getCollection(ctx, slug)
+	if err != nil {
+		return 0, fmt.Errorf("get collection %s: %w", slug, err)
+	}
+	if !ok {
+		return 0, nil
+	}
+	n, err := b.client.countRecords(ctx, col.ID)
+	if err != nil {
+		return 0, fmt.Errorf("count documents in %s: %w", slug, err)
+	}
+	return n, nil
+}
+
+// has reports whether slug was found empty and reindexed.
+func (b *backfillState) has(slug string) bool {
+	if b == nil {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.backfilled[slug]
+}
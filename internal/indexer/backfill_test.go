@@ -0,0 +1,71 @@
+package indexer
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestEvaluateSkipBackfillsEmptyCollection(t *testing.T) {
+	tests := map[string]struct {
+		docs           int
+		noCollection   bool
+		storeDown      bool
+		wantBackfilled bool
+	}{
+		"empty collection":   {wantBackfilled: true},
+		"missing collection": {noCollection: true, wantBackfilled: true},
+		"has documents":      {docs: 2},
+		"store unreachable":  {storeDown: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			cache, err := loadCommitCache("")
+			if err != nil {
+				t.Fatalf("load cache: %v", err)
+			}
+			cache.Update("api", "main", "aaa")
+
+			chroma := ChromaOptions{URL: mockStoreURL, mock: newMockStore(filepath.Join(t.TempDir(), "mock.json"))}
+			if tc.storeDown {
+				srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+					http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				}))
+				t.Cleanup(srv.Close)
+				chroma = ChromaOptions{URL: srv.URL}
+			}
+			if !tc.noCollection && !tc.storeDown {
+				client := newChromaClient(chroma)
+				col, err := client.createCollection(t.Context(), "api", nil)
+				if err != nil {
+					t.Fatalf("create collection: %v", err)
+				}
+				for i := range tc.docs {
+					doc := "summary"
+					recs := chromaRecords{IDs: []string{string(rune('a' + i))}, Documents: []*string{&doc}}
+					if err := client.upsertRecords(t.Context(), col.ID, recs); err != nil {
+						t.Fatalf("upsert: %v", err)
+					}
+				}
+			}
+
+			ix := newIndexer(io.Discard, io.Discard, cache, nil, Options{Backfill: true, Chroma: chroma})
+			ix.backfill = newBackfillState(chroma)
+			skip, cached := ix.evaluateSkip(t.Context(), "api", "main", "aaa", "")
+
+			if tc.wantBackfilled {
+				if skip != nil || cached != "" {
+					t.Fatalf("expected full reindex, got skip=%+v cached=%q", skip, cached)
+				}
+			} else if skip == nil || skip.Reason != SkipReasonCacheHit {
+				t.Fatalf("expected a cache hit, got skip=%+v cached=%q", skip, cached)
+			}
+			if got := ix.backfill.has("api"); got != tc.wantBackfilled {
+				t.Fatalf("expected backfilled=%t, got %t", tc.wantBackfilled, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"slices"
+	"strings"
+)
+
+// DefaultPromptTokenBudget is the estimated token size the prompt plus
+// manifest may reach before the manifest's diff list is truncated. It
+// leaves most of a model's context for Codex to explore the repo.
+const DefaultPromptTokenBudget = 50_000
+
+// promptBudgetWarnPercent is how full the budget gets before a warning.
+const promptBudgetWarnPercent = 80
+
+// bytesPerToken approximates tokens for English text and JSON; it errs on
+// the side of overestimating, which only truncates sooner.
+const bytesPerToken = 4
+
+// manifestMaxDiffDirs caps the directories listed in a truncated diff's
+// summary; the rest are folded into one "..." entry.
+const manifestMaxDiffDirs = 50
+
+// diffTruncation describes a diff list cut down to fit the prompt budget.
+type diffTruncation struct {
+	// File holds the complete diff as a JSON array of diff entries.
+	File string `json:"file"`
+	// Directories counts changed files per top-level directory across the
+	// complete diff, most changed first.
+	Directories []diffDirCount `json:"directories"`
+	// Total is the number of changed files; Listed how many are in "diff".
+	Total  int `json:"total"`
+	Listed int `json:"listed"`
+}
+
+type diffDirCount struct {
+	Dir   string `json:"dir"`
+	Files int    `json:"files"`
+}
+
+// estimateTokens approximates how many tokens s occupies in a model's
+// context.
+func estimateTokens(s string) int {
+	return (len(s) + bytesPerToken - 1) / bytesPerToken
+}
+
+// manifestTokens estimates the tokens Codex spends reading m.
+func manifestTokens(m *indexManifest) int {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return 0
+	}
+	return estimateTokens(string(data))
+}
+
+// applyPromptBudget estimates the size of prompt and m, recording it on
+// result. It warns when the estimate nears --prompt-token-budget and, when
+// it exceeds it, truncates the manifest's diff list so Codex reads the
+// complete list from a side file instead of overrunning its context.
+func (ix *indexer) applyPromptBudget(ctx context.Context, result *RepoResult, m *indexManifest, prompt string) {
+	budget := ix.opts.PromptTokenBudget
+	tokens := estimateTokens(prompt) + manifestTokens(m)
+	result.PromptTokens = tokens
+	if budget <= 0 {
+		return
+	}
+
+	if tokens > budget && len(m.Diff) > 0 {
+		total := len(m.Diff)
+		m.truncateDiff(budget - estimateTokens(prompt))
+		tokens = estimateTokens(prompt) + manifestTokens(m)
+		result.PromptTokens = tokens
+		result.DiffTruncated = true
+		ix.log(ctx).warnf("diff of %d files exceeds the prompt budget of %d tokens — "+
+			"listing %d in the manifest and the rest in a side file", total, budget, len(m.Diff))
+	}
+	switch {
+	case tokens > budget:
+		ix.log(ctx).warnf("prompt is about %d tokens, over the budget of %d", tokens, budget)
+	case tokens*100 >= budget*promptBudgetWarnPercent:
+		ix.log(ctx).warnf("prompt is about %d tokens, %d%% of the budget of %d",
+			tokens, tokens*100/budget, budget)
+	}
+}
+
+// truncateDiff keeps the leading diff entries that fit in tokens alongside
+// the rest of the manifest, summarizing the complete list by directory.
+// write stores the complete list beside the manifest.
+func (m *indexManifest) truncateDiff(tokens int) {
+	full := m.Diff
+	m.fullDiff = full
+	m.Diff = nil
+	m.DiffTruncated = &diffTruncation{
+		Directories: diffDirectories(full),
+		Total:       len(full),
+	}
+
+	remaining := tokens - manifestTokens(m)
+	listed := 0
+	for _, entry := range full {
+		data, err := json.MarshalIndent(entry, "    ", "  ")
+		if err != nil {
+			break
+		}
+		// Indentation and the separating comma cost a few bytes more.
+		cost := estimateTokens(string(data) + ",\n    ")
+		if cost > remaining {
+			break
+		}
+		remaining -= cost
+		listed++
+	}
+	m.Diff = full[:listed]
+	m.DiffTruncated.Listed = listed
+}
+
+// diffDirectories counts entries per top-level directory, most changed
+// first. Files at the repo root are counted under ".".
+func diffDirectories(entries []diffEntry) []diffDirCount {
+	counts := make(map[string]int)
+	for _, e := range entries {
+		dir, _, ok := strings.Cut(path.Clean(e.Path), "/")
+		if !ok {
+			dir = "."
+		}
+		counts[dir]++
+	}
+
+	dirs := make([]diffDirCount, 0, len(counts))
+	for dir, files := range counts {
+		dirs = append(dirs, diffDirCount{Dir: dir, Files: files})
+	}
+	slices.SortFunc(dirs, func(a, b diffDirCount) int {
+		if a.Files != b.Files {
+			return b.Files - a.Files
+		}
+		return strings.Compare(a.Dir, b.Dir)
+	})
+	if len(dirs) > manifestMaxDiffDirs {
+		rest := 0
+		for _, d := range dirs[manifestMaxDiffDirs:] {
+			rest += d.Files
+		}
+		dirs = append(dirs[:manifestMaxDiffDirs], diffDirCount{Dir: "...", Files: rest})
+	}
+	return dirs
+}
@@ -0,0 +1,128 @@
+package indexer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestApplyPromptBudget(t *testing.T) {
+	diff := make([]diffEntry, 400)
+	for i := range diff {
+		diff[i] = diffEntry{Path: fmt.Sprintf("pkg/module%03d/file.go", i), Status: "M"}
+	}
+	diff[0].Path = "README.md"
+	small := &indexManifest{Collection: "api", Mode: manifestModeIncremental, Diff: diff[:2]}
+	base := estimateTokens(codexPrompt) + manifestTokens(small)
+
+	tests := map[string]struct {
+		budget    int
+		diff      []diffEntry
+		truncated bool
+		warning   string
+	}{
+		"disabled":          {budget: 0, diff: diff},
+		"within budget":     {budget: base * 2, diff: diff[:2]},
+		"near budget":       {budget: base + 10, diff: diff[:2], warning: "of the budget"},
+		"over budget":       {budget: base + 500, diff: diff, truncated: true, warning: "exceeds the prompt budget"},
+		"over without diff": {budget: 10, warning: "over the budget"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			ix := newIndexer(&out, &out, nil, nil, Options{PromptTokenBudget: tc.budget})
+			m := &indexManifest{Collection: "api", Mode: manifestModeIncremental, Diff: tc.diff}
+			result := &RepoResult{}
+			ix.applyPromptBudget(t.Context(), result, m, codexPrompt)
+
+			if result.PromptTokens == 0 {
+				t.Fatalf("expected a token estimate")
+			}
+			if result.DiffTruncated != tc.truncated || (m.DiffTruncated != nil) != tc.truncated {
+				t.Fatalf("expected truncated=%t, got result %t manifest %+v",
+					tc.truncated, result.DiffTruncated, m.DiffTruncated)
+			}
+			if tc.warning == "" && out.Len() > 0 {
+				t.Fatalf("expected no warning, got %q", out.String())
+			}
+			if !strings.Contains(out.String(), tc.warning) {
+				t.Fatalf("expected warning %q, got %q", tc.warning, out.String())
+			}
+			if !tc.truncated {
+				return
+			}
+
+			if result.PromptTokens > tc.budget {
+				t.Fatalf("expected truncated prompt within %d tokens, got %d", tc.budget, result.PromptTokens)
+			}
+			tr := m.DiffTruncated
+			if tr.Total != len(diff) || tr.Listed != len(m.Diff) || tr.Listed == 0 || tr.Listed >= len(diff) {
+				t.Fatalf("unexpected truncation counts: %+v with %d listed", tr, len(m.Diff))
+			}
+			if !slices.Equal(m.Diff, diff[:tr.Listed]) {
+				t.Fatalf("expected the leading diff entries to be listed")
+			}
+			if len(tr.Directories) != 2 || tr.Directories[0] != (diffDirCount{Dir: "pkg", Files: 399}) ||
+				tr.Directories[1] != (diffDirCount{Dir: ".", Files: 1}) {
+				t.Fatalf("unexpected directory summary: %+v", tr.Directories)
+			}
+		})
+	}
+}
+
+func TestManifestWriteTruncatedDiff(t *testing.T) {
+	diff := []diffEntry{
+		{Path: "a.go", Status: "A"},
+		{Path: "b.go", Status: "M"},
+		{Path: "c.go", OldPath: "old.go", Status: "R"},
+	}
+	m := &indexManifest{Collection: "api", Mode: manifestModeIncremental, Diff: diff}
+	m.truncateDiff(manifestTokens(m) - estimateTokens(`{"path": "c.go"}`))
+
+	path, err := m.write(t.TempDir())
+	if err != nil {
+		t.Fatalf("write manifest: %v", err)
+	}
+	data, err := os.ReadFile(m.DiffTruncated.File)
+	if err != nil {
+		t.Fatalf("read full diff: %v", err)
+	}
+	var full []diffEntry
+	if err := json.Unmarshal(data, &full); err != nil {
+		t.Fatalf("decode full diff: %v", err)
+	}
+	if !slices.Equal(full, diff) {
+		t.Fatalf("expected the complete diff in %s, got %+v", m.DiffTruncated.File, full)
+	}
+	if len(m.Diff) >= len(diff) {
+		t.Fatalf("expected the manifest diff to be truncated, got %d entries", len(m.Diff))
+	}
+
+	if err := m.remove(path); err != nil {
+		t.Fatalf("remove manifest: %v", err)
+	}
+	for _, p := range []string{path, m.DiffTruncated.File} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Fatalf("expected %s removed, got %v", p, err)
+		}
+	}
+}
+
+func TestDiffDirectoriesCap(t *testing.T) {
+	var diff []diffEntry
+	for i := range manifestMaxDiffDirs + 5 {
+		diff = append(diff, diffEntry{Path: fmt.Sprintf("dir%03d/file.go", i)})
+	}
+	dirs := diffDirectories(diff)
+	if len(dirs) != manifestMaxDiffDirs+1 {
+		t.Fatalf("expected %d entries, got %d", manifestMaxDiffDirs+1, len(dirs))
+	}
+	if last := dirs[len(dirs)-1]; last != (diffDirCount{Dir: "...", Files: 5}) {
+		t.Fatalf("expected overflow entry for 5 files, got %+v", last)
+	}
+}
@@ -0,0 +1,109 @@
+package indexer
+
+import (
+	"context"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultChangelogMonths is how many months of history --changelog
+// summarizes.
+const DefaultChangelogMonths = 6
+
+const (
+	// changelogMaxCommits caps the commits listed in the manifest.
+	changelogMaxCommits = 200
+	// changelogMaxTags caps the release tags listed in the manifest.
+	changelogMaxTags = 50
+)
+
+// manifestChangelog lists recent history for the changelog pass.
+type manifestChangelog struct {
+	// Since is the start of the window, as passed to git log --since.
+	Since string `json:"since"`
+	// Commits are the window's merge commits, newest first, or its
+	// first-parent commits when the repo squash-merges and has none.
+	Commits []manifestCommit `json:"commits,omitempty"`
+	Tags    []changelogTag   `json:"tags,omitempty"`
+	// Merges is false when Commits fell back to first-parent history.
+	Merges bool `json:"merges"`
+}
+
+type changelogTag struct {
+	Name   string `json:"name"`
+	Date   string `json:"date"`
+	Commit string `json:"commit"`
+}
+
+// collectChangelog lists the merge commits and release tags of the last
+// months on HEAD's history. Lookups that fail are left out; it returns nil
+// when the window has neither commits nor tags.
+func collectChangelog(ctx context.Context, repoDir string, months int) *manifestChangelog {
+	since := strconv.Itoa(months) + " months ago"
+	c := &manifestChangelog{Since: since, Merges: true}
+	c.Commits = changelogCommits(ctx, repoDir, since, "--merges")
+	if len(c.Commits) == 0 {
+		c.Merges = false
+		c.Commits = changelogCommits(ctx, repoDir, since, "--first-parent")
+	}
+	c.Tags = changelogTags(ctx, repoDir, time.Now().AddDate(0, -months, 0))
+	if len(c.Commits) == 0 && len(c.Tags) == 0 {
+		return nil
+	}
+	return c
+}
+
+// changelogCommits returns up to changelogMaxCommits commits since the
+// window, filtered by selector ("--merges" or "--first-parent").
+func changelogCommits(ctx context.Context, repoDir, since, selector string) []manifestCommit {
+	cmd := exec.CommandContext(ctx, "git", "-C", repoDir, "log", "--since="+since, selector,
+		"--max-count="+strconv.Itoa(changelogMaxCommits), "--format=%H%x00%an%x00%aI%x00%s")
+	out, err := procOutput(ctx, cmd)
+	if err != nil {
+		return nil
+	}
+	var commits []manifestCommit
+	for line := range strings.Lines(string(out)) {
+		parts := strings.SplitN(strings.TrimRight(line, "\n"), "\x00", 4)
+		if len(parts) != 4 {
+			continue
+		}
+		commits = append(commits, manifestCommit{SHA: parts[0], Author: parts[1], Date: parts[2], Subject: parts[3]})
+	}
+	return commits
+}
+
+// changelogTags returns up to changelogMaxTags tags created after cutoff
+// that point into HEAD's history, newest first.
+func changelogTags(ctx context.Context, repoDir string, cutoff time.Time) []changelogTag {
+	// Annotated tags report the commit they point at, not the tag object.
+	format := "%(refname:short)%00%(creatordate:iso-strict)%00" +
+		"%(if)%(*objectname)%(then)%(*objectname)%(else)%(objectname)%(end)"
+	cmd := exec.CommandContext(ctx, "git", "-C", repoDir, "for-each-ref", "--merged=HEAD",
+		"--sort=-creatordate", "--format="+format, "refs/tags")
+	out, err := procOutput(ctx, cmd)
+	if err != nil {
+		return nil
+	}
+	var tags []changelogTag
+	for line := range strings.Lines(string(out)) {
+		parts := strings.SplitN(strings.TrimRight(line, "\n"), "\x00", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		created, err := time.Parse(time.RFC3339, parts[1])
+		if err != nil {
+			continue
+		}
+		if created.Before(cutoff) {
+			break
+		}
+		tags = append(tags, changelogTag{Name: parts[0], Date: parts[1], Commit: parts[2]})
+		if len(tags) == changelogMaxTags {
+			break
+		}
+	}
+	return tags
+}
@@ -0,0 +1,83 @@
+package indexer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCollectChangelog(t *testing.T) {
+	tests := map[string]struct {
+		merge       bool
+		wantMerges  bool
+		wantSubject string
+	}{
+		"merge commits":      {merge: true, wantMerges: true, wantSubject: "Merge branch 'feature'"},
+		"squash-merged repo": {wantSubject: "add feature"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			repoDir := t.TempDir()
+			initGitRepo(t, repoDir)
+			if err := runGit(repoDir, "tag", "-a", "v1.0.0", "-m", "release"); err != nil {
+				t.Fatalf("git tag: %v", err)
+			}
+			head, err := headCommit(t.Context(), repoDir)
+			if err != nil {
+				t.Fatalf("head commit: %v", err)
+			}
+
+			if tc.merge {
+				if err := runGit(repoDir, "checkout", "-q", "-b", "feature"); err != nil {
+					t.Fatalf("git checkout: %v", err)
+				}
+			}
+			if err := os.WriteFile(filepath.Join(repoDir, "feature.go"), []byte("package x\n"), 0o644); err != nil {
+				t.Fatalf("write file: %v", err)
+			}
+			if err := runGit(repoDir, "add", "-A"); err != nil {
+				t.Fatalf("git add: %v", err)
+			}
+			if err := runGit(repoDir, "commit", "-m", "add feature"); err != nil {
+				t.Fatalf("git commit: %v", err)
+			}
+			if tc.merge {
+				if err := runGit(repoDir, "checkout", "-q", "trunk"); err != nil {
+					t.Fatalf("git checkout: %v", err)
+				}
+				if err := runGit(repoDir, "merge", "--no-ff", "-m", "Merge branch 'feature'", "feature"); err != nil {
+					t.Fatalf("git merge: %v", err)
+				}
+			}
+
+			got := collectChangelog(t.Context(), repoDir, DefaultChangelogMonths)
+			if got == nil {
+				t.Fatalf("expected a changelog")
+			}
+			if got.Since != "6 months ago" || got.Merges != tc.wantMerges {
+				t.Fatalf("expected since %q and merges=%t, got %+v", "6 months ago", tc.wantMerges, got)
+			}
+			if len(got.Commits) == 0 || got.Commits[0].Subject != tc.wantSubject || got.Commits[0].Date == "" {
+				t.Fatalf("expected newest commit %q, got %+v", tc.wantSubject, got.Commits)
+			}
+			if len(got.Tags) != 1 || got.Tags[0].Name != "v1.0.0" || got.Tags[0].Commit != head {
+				t.Fatalf("expected tag v1.0.0 at %s, got %+v", head, got.Tags)
+			}
+		})
+	}
+}
+
+func TestCollectChangelogEmpty(t *testing.T) {
+	if got := collectChangelog(t.Context(), t.TempDir(), DefaultChangelogMonths); got != nil {
+		t.Fatalf("expected no changelog outside a repo, got %+v", got)
+	}
+}
+
+func TestRunResultsChangelogMonthsNegative(t *testing.T) {
+	_, err := RunResults(Options{RootDir: t.TempDir(), ChangelogMonths: -1})
+	if err == nil || !strings.Contains(err.Error(), "changelog months") {
+		t.Fatalf("expected changelog months error, got %v", err)
+	}
+}
@@ -0,0 +1,314 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Chroma connection defaults, matching a local `chroma run`.
+const (
+	DefaultChromaURL      = "http://localhost:8000"
+	DefaultChromaTenant   = "default_tenant"
+	DefaultChromaDatabase = "default_database"
+)
+
+// chromaPageSize is the number of records copied per request.
+const chromaPageSize = 500
+
+// ChromaOptions locates a Chroma server and database.
+type ChromaOptions struct {
+	// URL is the server base URL.
+	URL string
+	// Tenant and Database scope collection names.
+	Tenant   string
+	Database string
+	// Token, when set, is sent as the x-chroma-token header.
+	Token string
+	// mock, when set, serves every request in process (--store mock).
+	mock *mockStore
+	// transport, when set, carries every request instead of the network.
+	transport http.RoundTripper
+}
+
+// chromaClient talks to the Chroma v2 HTTP API.
+type chromaClient struct {
+	http *http.Client
+	opts ChromaOptions
+}
+
+// chromaCollection is the subset of collection fields the indexer uses.
+type chromaCollection struct {
+	Metadata map[string]any `json:"metadata"`
+	ID       string         `json:"id"`
+	Name     string         `json:"name"`
+}
+
+// chromaRecords is a page of records as returned by get and accepted by add.
+type chromaRecords struct {
+	IDs        []string         `json:"ids"`
+	Documents  []*string        `json:"documents,omitempty"`
+	Metadatas  []map[string]any `json:"metadatas,omitempty"`
+	Embeddings [][]float64      `json:"embeddings,omitempty"`
+}
+
+// chromaError is a non-2xx response from the server.
+type chromaError struct {
+	Method string
+	Path   string
+	Body   string
+	Status int
+}
+
+func (e *chromaError) Error() string {
+	return fmt.Sprintf("chroma %s %s: %d %s", e.Method, e.Path, e.Status, e.Body)
+}
+
+func newChromaClient(opts ChromaOptions) *chromaClient {
+	if opts.URL == "" {
+		opts.URL = DefaultChromaURL
+	}
+	if opts.Tenant == "" {
+		opts.Tenant = DefaultChromaTenant
+	}
+	if opts.Database == "" {
+		opts.Database = DefaultChromaDatabase
+	}
+	client := &chromaClient{
+		http: &http.Client{Timeout: time.Minute},
+		opts: opts,
+	}
+	switch {
+	case opts.mock != nil:
+		client.http.Transport = opts.mock
+	case opts.transport != nil:
+		client.http.Transport = opts.transport
+	}
+	return client
+}
+
+func (c *chromaClient) collectionsPath() string {
+	return "/api/v2/tenants/" + url.PathEscape(c.opts.Tenant) +
+		"/databases/" + url.PathEscape(c.opts.Database) + "/collections"
+}
+
+func (c *chromaClient) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("encode chroma request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(c.opts.URL, "/")+path, body)
+	if err != nil {
+		return fmt.Errorf("build chroma request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.opts.Token != "" {
+		req.Header.Set("X-Chroma-Token", c.opts.Token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return &StoreUnavailable{URL: c.opts.URL, Err: fmt.Errorf("chroma request: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read chroma response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &chromaError{
+			Method: method,
+			Path:   path,
+			Body:   strings.TrimSpace(string(data)),
+			Status: resp.StatusCode,
+		}
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return &StoreUnavailable{URL: c.opts.URL, Err: apiErr}
+		}
+		return apiErr
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("decode chroma response: %w", err)
+	}
+	return nil
+}
+
+// getCollection returns the named collection, or ok=false when it does not
+// exist.
+func (c *chromaClient) getCollection(ctx context.Context, name string) (chromaCollection, bool, error) {
+	var col chromaCollection
+	err := c.do(ctx, http.MethodGet, c.collectionsPath()+"/"+url.PathEscape(name), nil, &col)
+	var apiErr *chromaError
+	if errors.As(err, &apiErr) && (apiErr.Status == http.StatusNotFound ||
+		strings.Contains(apiErr.Body, "does not exist")) {
+		return col, false, nil
+	}
+	if err != nil {
+		return col, false, err
+	}
+	return col, true, nil
+}
+
+// ping checks that the server is reachable, accepts the token, and serves
+// the configured tenant and database.
+func (c *chromaClient) ping(ctx context.Context) error {
+	var page []chromaCollection
+	return c.do(ctx, http.MethodGet, c.collectionsPath()+"?limit=1", nil, &page)
+}
+
+// listCollections returns every collection name in the database.
+func (c *chromaClient) listCollections(ctx context.Context) ([]string, error) {
+	var names []string
+	for offset := 0; ; offset += chromaPageSize {
+		var page []chromaCollection
+		path := fmt.Sprintf("%s?limit=%d&offset=%d", c.collectionsPath(), chromaPageSize, offset)
+		if err := c.do(ctx, http.MethodGet, path, nil, &page); err != nil {
+			return nil, err
+		}
+		for _, col := range page {
+			names = append(names, col.Name)
+		}
+		if len(page) < chromaPageSize {
+			return names, nil
+		}
+	}
+}
+
+func (c *chromaClient) createCollection(
+	ctx context.Context, name string, metadata map[string]any,
+) (chromaCollection, error) {
+	var col chromaCollection
+	req := map[string]any{
+		"name":     name,
+		"metadata": metadata,
+	}
+	if err := c.do(ctx, http.MethodPost, c.collectionsPath(), req, &col); err != nil {
+		return col, err
+	}
+	return col, nil
+}
+
+func (c *chromaClient) renameCollection(ctx context.Context, id, newName string) error {
+	return c.do(ctx, http.MethodPut, c.collectionsPath()+"/"+url.PathEscape(id),
+		map[string]any{"new_name": newName}, nil)
+}
+
+// updateCollectionMetadata replaces the collection's metadata with
+// metadata; callers merge in the keys they keep.
+func (c *chromaClient) updateCollectionMetadata(ctx context.Context, id string, metadata map[string]any) error {
+	return c.do(ctx, http.MethodPut, c.collectionsPath()+"/"+url.PathEscape(id),
+		map[string]any{"new_metadata": metadata}, nil)
+}
+
+func (c *chromaClient) deleteCollection(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, c.collectionsPath()+"/"+url.PathEscape(name), nil, nil)
+}
+
+func (c *chromaClient) getRecords(ctx context.Context, id string, offset, limit int) (chromaRecords, error) {
+	var recs chromaRecords
+	req := map[string]any{
+		"include": []string{"documents", "metadatas", "embeddings"},
+		"offset":  offset,
+		"limit":   limit,
+	}
+	err := c.do(ctx, http.MethodPost, c.collectionsPath()+"/"+url.PathEscape(id)+"/get", req, &recs)
+	return recs, err
+}
+
+// getDocuments returns a page of records with their documents and
+// metadata.
+func (c *chromaClient) getDocuments(ctx context.Context, id string, offset, limit int) (chromaRecords, error) {
+	var recs chromaRecords
+	req := map[string]any{
+		"include": []string{"documents", "metadatas"},
+		"offset":  offset,
+		"limit":   limit,
+	}
+	err := c.do(ctx, http.MethodPost, c.collectionsPath()+"/"+url.PathEscape(id)+"/get", req, &recs)
+	return recs, err
+}
+
+// getMetadatas returns the ids and metadata of the listed records that
+// exist in the collection.
+func (c *chromaClient) getMetadatas(ctx context.Context, id string, ids []string) (chromaRecords, error) {
+	var recs chromaRecords
+	req := map[string]any{
+		"ids":     ids,
+		"include": []string{"metadatas"},
+	}
+	err := c.do(ctx, http.MethodPost, c.collectionsPath()+"/"+url.PathEscape(id)+"/get", req, &recs)
+	return recs, err
+}
+
+// search returns up to limit records with their documents and metadata
+// that match the where and whereDocument filters; nil filters are omitted.
+func (c *chromaClient) search(
+	ctx context.Context, id string, where, whereDocument map[string]any, limit int,
+) (chromaRecords, error) {
+	var recs chromaRecords
+	req := map[string]any{
+		"include": []string{"documents", "metadatas"},
+		"limit":   limit,
+	}
+	if where != nil {
+		req["where"] = where
+	}
+	if whereDocument != nil {
+		req["where_document"] = whereDocument
+	}
+	err := c.do(ctx, http.MethodPost, c.collectionsPath()+"/"+url.PathEscape(id)+"/get", req, &recs)
+	return recs, err
+}
+
+// getWhereMetadatas returns a page of the ids and metadata of records that
+// match the where filter.
+func (c *chromaClient) getWhereMetadatas(
+	ctx context.Context, id string, where map[string]any, offset, limit int,
+) (chromaRecords, error) {
+	var recs chromaRecords
+	req := map[string]any{
+		"where":   where,
+		"include": []string{"metadatas"},
+		"offset":  offset,
+		"limit":   limit,
+	}
+	err := c.do(ctx, http.MethodPost, c.collectionsPath()+"/"+url.PathEscape(id)+"/get", req, &recs)
+	return recs, err
+}
+
+// countRecords returns the number of records in the collection.
+func (c *chromaClient) countRecords(ctx context.Context, id string) (int, error) {
+	var n int
+	err := c.do(ctx, http.MethodGet, c.collectionsPath()+"/"+url.PathEscape(id)+"/count", nil, &n)
+	return n, err
+}
+
+func (c *chromaClient) addRecords(ctx context.Context, id string, recs chromaRecords) error {
+	return c.do(ctx, http.MethodPost, c.collectionsPath()+"/"+url.PathEscape(id)+"/add", recs, nil)
+}
+
+func (c *chromaClient) upsertRecords(ctx context.Context, id string, recs chromaRecords) error {
+	return c.do(ctx, http.MethodPost, c.collectionsPath()+"/"+url.PathEscape(id)+"/upsert", recs, nil)
+}
+
+// deleteRecords deletes the listed records from the collection.
+func (c *chromaClient) deleteRecords(ctx context.Context, id string, ids []string) error {
+	return c.do(ctx, http.MethodPost, c.collectionsPath()+"/"+url.PathEscape(id)+"/delete",
+		map[string]any{"ids": ids}, nil)
+}
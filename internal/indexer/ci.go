@@ -0,0 +1,58 @@
+package indexer
+
+import (
+	"context"
+	"path"
+	"strings"
+)
+
+// CI systems detected by --ci-pipelines.
+const (
+	ciGitHubActions = "github_actions"
+	ciGitLab        = "gitlab_ci"
+	ciJenkins       = "jenkins"
+)
+
+// ciMaxFiles caps the CI configuration files listed in the manifest.
+const ciMaxFiles = 50
+
+// ciConfig is a CI configuration file found in the repo.
+type ciConfig struct {
+	// System is github_actions, gitlab_ci, or jenkins.
+	System string `json:"system"`
+	Path   string `json:"path"`
+}
+
+// ciSystem returns the CI system a tracked file configures, or "".
+func ciSystem(name string) string {
+	base := path.Base(name)
+	switch {
+	case path.Dir(name) == ".github/workflows" && (path.Ext(name) == ".yml" || path.Ext(name) == ".yaml"):
+		return ciGitHubActions
+	case name == ".gitlab-ci.yml" || strings.HasSuffix(name, ".gitlab-ci.yml"):
+		return ciGitLab
+	case base == "Jenkinsfile" || strings.HasPrefix(base, "Jenkinsfile.") || strings.HasSuffix(base, ".Jenkinsfile"):
+		return ciJenkins
+	}
+	return ""
+}
+
+// detectCI lists the repo's tracked CI configuration files, in git's path
+// order. It returns nil when there are none or git fails.
+func detectCI(ctx context.Context, repoDir string) []ciConfig {
+	names, err := trackedFiles(ctx, repoDir)
+	if err != nil {
+		return nil
+	}
+
+	var configs []ciConfig
+	for _, name := range names {
+		if system := ciSystem(name); system != "" {
+			configs = append(configs, ciConfig{System: system, Path: name})
+			if len(configs) == ciMaxFiles {
+				break
+			}
+		}
+	}
+	return configs
+}
@@ -0,0 +1,59 @@
+package indexer
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestCISystem(t *testing.T) {
+	tests := map[string]string{
+		".github/workflows/ci.yml":         ciGitHubActions,
+		".github/workflows/deploy.yaml":    ciGitHubActions,
+		".github/workflows/README.md":      "",
+		".github/dependabot.yml":           "",
+		".gitlab-ci.yml":                   ciGitLab,
+		"ci/templates/build.gitlab-ci.yml": ciGitLab,
+		"Jenkinsfile":                      ciJenkins,
+		"deploy/Jenkinsfile.release":       ciJenkins,
+		"nightly.Jenkinsfile":              ciJenkins,
+		"docs/jenkins.md":                  "",
+	}
+	for name, want := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := ciSystem(name); got != want {
+				t.Fatalf("expected %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestDetectCI(t *testing.T) {
+	repoDir := t.TempDir()
+	initGitRepo(t, repoDir)
+	if got := detectCI(t.Context(), repoDir); got != nil {
+		t.Fatalf("expected no CI configuration, got %+v", got)
+	}
+
+	for _, name := range []string{".github/workflows/ci.yml", "Jenkinsfile", "untracked/.gitlab-ci.yml"} {
+		path := filepath.Join(repoDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("x\n"), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	if err := runGit(repoDir, "add", ".github", "Jenkinsfile"); err != nil {
+		t.Fatalf("git add: %v", err)
+	}
+
+	want := []ciConfig{
+		{System: ciGitHubActions, Path: ".github/workflows/ci.yml"},
+		{System: ciJenkins, Path: "Jenkinsfile"},
+	}
+	if got := detectCI(t.Context(), repoDir); !slices.Equal(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+}
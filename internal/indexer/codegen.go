@@ -0,0 +1,69 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"time"
+)
+
+const defaultCodegenTimeout = 10 * time.Minute
+
+// runCodegen executes the repo's configured codegen command in indexDir so
+// generated sources exist before Codex explores the tree. Output is streamed
+// to the indexer's output; failures are reported as warnings and recorded on
+// the result rather than aborting the repo.
+func (ix *indexer) runCodegen(
+	ctx context.Context,
+	result *RepoResult,
+	indexDir string,
+	settings repoSettings,
+	dryRun bool,
+) {
+	if settings.codegen == "" {
+		return
+	}
+	if dryRun {
+		ix.log(ctx).infof("[dry-run] codegen in %q: %s", indexDir, settings.codegen)
+		return
+	}
+
+	timeout := ix.opts.CodegenTimeout
+	if timeout <= 0 {
+		timeout = defaultCodegenTimeout
+	}
+	cmdCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := shellCommand(cmdCtx, settings.codegen)
+	cmd.Dir = indexDir
+	cmd.Env = slices.Concat(os.Environ(), ix.scratchEnv(), envList(settings.env))
+	cmd.Stdout = ix.stdout
+	cmd.Stderr = ix.stderr
+
+	ix.log(ctx).infof("running codegen: %s", settings.codegen)
+	err := procRun(cmdCtx, cmd)
+	if err == nil {
+		result.CodegenOK = boolPtr(true)
+		return
+	}
+
+	result.CodegenOK = boolPtr(false)
+	if errors.Is(cmdCtx.Err(), context.DeadlineExceeded) {
+		ix.log(ctx).warnf("codegen timed out after %s — continuing without generated sources", timeout)
+		return
+	}
+	ix.log(ctx).warnf("codegen failed: %v — continuing without generated sources", fmt.Errorf("%s: %w", settings.codegen, err))
+}
+
+// shellCommand runs command through the platform shell.
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
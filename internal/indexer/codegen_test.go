@@ -0,0 +1,57 @@
+package indexer
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestRunCodegen(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("codegen test uses POSIX shell commands")
+	}
+
+	tests := map[string]struct {
+		command  string
+		wantOK   *bool
+		wantFile bool
+	}{
+		"no command": {
+			command: "",
+			wantOK:  nil,
+		},
+		"success": {
+			command:  "echo generated > api.gen.go",
+			wantOK:   boolPtr(true),
+			wantFile: true,
+		},
+		"failure": {
+			command: "exit 3",
+			wantOK:  boolPtr(false),
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			ix := newIndexer(io.Discard, io.Discard, nil, nil, Options{})
+			result := RepoResult{}
+
+			ix.runCodegen(t.Context(), &result, dir, repoSettings{codegen: tc.command}, false)
+
+			switch {
+			case tc.wantOK == nil && result.CodegenOK != nil:
+				t.Fatalf("expected codegen_ok unset, got %t", *result.CodegenOK)
+			case tc.wantOK != nil && (result.CodegenOK == nil || *result.CodegenOK != *tc.wantOK):
+				t.Fatalf("expected codegen_ok %t, got %v", *tc.wantOK, result.CodegenOK)
+			}
+
+			_, err := os.Stat(filepath.Join(dir, "api.gen.go"))
+			if tc.wantFile && err != nil {
+				t.Fatalf("expected generated file: %v", err)
+			}
+		})
+	}
+}
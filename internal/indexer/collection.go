@@ -0,0 +1,107 @@
+package indexer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// Chroma collection name limits.
+const (
+	collectionNameMinLen = 3
+	collectionNameMaxLen = 63
+)
+
+// Policies for slugs that are not valid collection names.
+const (
+	SlugPolicyFix  = "fix"
+	SlugPolicyFail = "fail"
+)
+
+// validateCollectionName checks name against Chroma's collection naming
+// rules: 3-63 characters from [a-zA-Z0-9._-], starting and ending with an
+// alphanumeric character, no "..", and not an IPv4 address.
+func validateCollectionName(name string) error {
+	if len(name) < collectionNameMinLen || len(name) > collectionNameMaxLen {
+		return fmt.Errorf("collection name %q must be %d-%d characters", name,
+			collectionNameMinLen, collectionNameMaxLen)
+	}
+	for _, r := range name {
+		if !isCollectionNameChar(r) {
+			return fmt.Errorf("collection name %q contains invalid character %q", name, r)
+		}
+	}
+	if !isAlphanumeric(rune(name[0])) || !isAlphanumeric(rune(name[len(name)-1])) {
+		return fmt.Errorf("collection name %q must start and end with a letter or digit", name)
+	}
+	if strings.Contains(name, "..") {
+		return fmt.Errorf("collection name %q must not contain \"..\"", name)
+	}
+	if addr, err := netip.ParseAddr(name); err == nil && addr.Is4() {
+		return fmt.Errorf("collection name %q must not be an IPv4 address", name)
+	}
+	return nil
+}
+
+// fixCollectionName rewrites name into a valid collection name: invalid
+// characters become "_", ".." collapses, edges are trimmed to alphanumerics,
+// short names are padded, and long names are truncated with a hash suffix
+// so distinct slugs stay distinct.
+func fixCollectionName(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if isCollectionNameChar(r) {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	fixed := b.String()
+	for strings.Contains(fixed, "..") {
+		fixed = strings.ReplaceAll(fixed, "..", ".")
+	}
+	fixed = strings.TrimFunc(fixed, func(r rune) bool { return !isAlphanumeric(r) })
+	if addr, err := netip.ParseAddr(fixed); err == nil && addr.Is4() {
+		fixed = strings.ReplaceAll(fixed, ".", "_")
+	}
+
+	if len(fixed) < collectionNameMinLen {
+		fixed = strings.TrimLeft(fixed+"_repo", "_")
+	}
+	if len(fixed) > collectionNameMaxLen {
+		sum := sha256.Sum256([]byte(name))
+		suffix := hex.EncodeToString(sum[:4])
+		head := strings.TrimRightFunc(fixed[:collectionNameMaxLen-len(suffix)-1],
+			func(r rune) bool { return !isAlphanumeric(r) })
+		fixed = head + "_" + suffix
+	}
+	return fixed
+}
+
+// collectionName validates slug as a collection name, fixing it or failing
+// according to --slug-policy. The returned bool reports whether it changed.
+func (ix *indexer) collectionName(slug string) (string, bool, error) {
+	err := validateCollectionName(slug)
+	if err == nil {
+		return slug, false, nil
+	}
+	if ix.opts.SlugPolicy == SlugPolicyFail {
+		return "", false, err
+	}
+	fixed := fixCollectionName(slug)
+	if validErr := validateCollectionName(fixed); validErr != nil {
+		return "", false, errors.Join(err, validErr)
+	}
+	return fixed, true, nil
+}
+
+func isCollectionNameChar(r rune) bool {
+	return isAlphanumeric(r) || r == '.' || r == '_' || r == '-'
+}
+
+func isAlphanumeric(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+}
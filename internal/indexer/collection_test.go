@@ -0,0 +1,84 @@
+package indexer
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestValidateCollectionName(t *testing.T) {
+	tests := map[string]struct {
+		name    string
+		wantErr bool
+	}{
+		"nested slug":        {name: "services_api-gateway"},
+		"dots allowed":       {name: "docs.site"},
+		"too short":          {name: "ab", wantErr: true},
+		"too long":           {name: strings.Repeat("a", 64), wantErr: true},
+		"space":              {name: "my repo", wantErr: true},
+		"leading separator":  {name: "_api", wantErr: true},
+		"trailing separator": {name: "api-", wantErr: true},
+		"double dot":         {name: "a..b", wantErr: true},
+		"ipv4":               {name: "10.0.0.1", wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := validateCollectionName(tc.name)
+			if tc.wantErr && err == nil {
+				t.Fatalf("expected %q to be invalid", tc.name)
+			}
+			if !tc.wantErr && err != nil {
+				t.Fatalf("expected %q to be valid: %v", tc.name, err)
+			}
+		})
+	}
+}
+
+func TestFixCollectionName(t *testing.T) {
+	tests := map[string]struct {
+		name string
+		want string
+	}{
+		"invalid characters": {name: "my repo@v2", want: "my_repo_v2"},
+		"edges trimmed":      {name: "_.api-", want: "api"},
+		"short padded":       {name: "ui", want: "ui_repo"},
+		"only separators":    {name: "__", want: "repo"},
+		"double dot":         {name: "a..b", want: "a.b"},
+		"ipv4":               {name: "10.0.0.1", want: "10_0_0_1"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := fixCollectionName(tc.name)
+			if got != tc.want {
+				t.Fatalf("expected %q, got %q", tc.want, got)
+			}
+			if err := validateCollectionName(got); err != nil {
+				t.Fatalf("fixed name still invalid: %v", err)
+			}
+		})
+	}
+
+	long := strings.Repeat("team_", 20) + "api"
+	fixedLong := fixCollectionName(long)
+	if err := validateCollectionName(fixedLong); err != nil {
+		t.Fatalf("fixed long name invalid: %v", err)
+	}
+	if fixedLong == fixCollectionName(long+"2") {
+		t.Fatalf("expected distinct long slugs to stay distinct")
+	}
+}
+
+func TestCollectionNamePolicy(t *testing.T) {
+	fix := newIndexer(io.Discard, io.Discard, nil, nil, Options{})
+	got, changed, err := fix.collectionName("ui")
+	if err != nil || !changed || got != "ui_repo" {
+		t.Fatalf("expected fixed name, got %q changed=%t err=%v", got, changed, err)
+	}
+
+	fail := newIndexer(io.Discard, io.Discard, nil, nil, Options{SlugPolicy: SlugPolicyFail})
+	if _, _, err := fail.collectionName("ui"); err == nil {
+		t.Fatalf("expected fail policy to reject invalid name")
+	}
+}
@@ -0,0 +1,277 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"reflect"
+	"slices"
+)
+
+// Collection metadata keys the indexer sets on the collections it writes,
+// so a collection records where its knowledge came from. The embedding
+// model is stored under embeddingModelKey.
+const (
+	collectionRepoKey    = "repo"
+	collectionRemoteKey  = "repo_remote"
+	collectionRootKey    = "root_path"
+	collectionIndexerKey = "indexer_version"
+)
+
+// MigrateOptions configures MigrateCollection.
+type MigrateOptions struct {
+	// Chroma locates the collection store.
+	Chroma ChromaOptions
+	// OldSlug and NewSlug are the source and destination collection names.
+	OldSlug string
+	NewSlug string
+	// CachePath is the commit cache whose entries move with the collection;
+	// empty skips the cache.
+	CachePath string
+	// SlugMapPath is the slug map whose remotes are repointed at NewSlug so
+	// future runs index into it; empty skips the map.
+	SlugMapPath string
+	// RootDir, when set, is the root of the runs indexing into these
+	// collections; it is locked like a run's so none starts mid-migration.
+	RootDir string
+	// Copy copies records into a new collection and keeps the old one
+	// instead of renaming it in place.
+	Copy bool
+	// DryRun reports the plan without changing the store or local state.
+	DryRun bool
+}
+
+// MigrateCollection renames (or copies) a collection in Chroma and moves the
+// matching commit cache and slug map entries, so a renamed repo or a slug
+// scheme change keeps its accumulated knowledge and incremental state. It
+// fails when a run holds the root, cache, or either collection's lock.
+func MigrateCollection(ctx context.Context, w io.Writer, opts MigrateOptions) (err error) {
+	if opts.OldSlug == opts.NewSlug {
+		return errors.New("old and new slugs are the same")
+	}
+	if err := validateCollectionName(opts.NewSlug); err != nil {
+		return err
+	}
+	release, err := lockMigration(opts)
+	if err != nil {
+		return err
+	}
+	defer func() { err = errors.Join(err, release()) }()
+
+	cache, err := loadCommitCache(opts.CachePath)
+	if err != nil {
+		return err
+	}
+	cache.warnRecovered(w)
+	slugs, err := loadSlugMap(opts.SlugMapPath)
+	if err != nil {
+		return err
+	}
+	slugs.warnRecovered(w)
+
+	client := newChromaClient(opts.Chroma)
+	src, ok, err := client.getCollection(ctx, opts.OldSlug)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("collection %q does not exist", opts.OldSlug)
+	}
+	if _, exists, err := client.getCollection(ctx, opts.NewSlug); err != nil {
+		return err
+	} else if exists {
+		return fmt.Errorf("collection %q already exists", opts.NewSlug)
+	}
+
+	verb := "rename"
+	if opts.Copy {
+		verb = "copy"
+	}
+	if opts.DryRun {
+		logf(w, "[dry-run] would %s collection %s -> %s\n", verb, opts.OldSlug, opts.NewSlug)
+		return nil
+	}
+
+	if opts.Copy {
+		copied, err := copyCollection(ctx, client, src, client, opts.NewSlug)
+		if err != nil {
+			return err
+		}
+		logf(w, "Copied %d records from %s to %s\n", copied, opts.OldSlug, opts.NewSlug)
+	} else {
+		if err := client.renameCollection(ctx, src.ID, opts.NewSlug); err != nil {
+			return err
+		}
+		logf(w, "Renamed collection %s to %s\n", opts.OldSlug, opts.NewSlug)
+	}
+
+	if cache.MoveSlug(opts.OldSlug, opts.NewSlug, opts.Copy) {
+		if err := cache.Save(); err != nil {
+			return err
+		}
+		logf(w, "Moved commit cache entries to %s\n", opts.NewSlug)
+	}
+
+	if opts.SlugMapPath != "" {
+		if n := slugs.renameSlug(opts.OldSlug, opts.NewSlug); n > 0 {
+			if err := slugs.Save(); err != nil {
+				return err
+			}
+			logf(w, "Repointed %d slug map entries to %s\n", n, opts.NewSlug)
+		} else {
+			logf(w, "No slug map entry uses %s; runs will keep deriving slugs from repo paths\n",
+				opts.OldSlug)
+		}
+	}
+	return nil
+}
+
+// lockMigration takes the locks a run over opts.RootDir and opts.CachePath
+// takes, and the repo locks of both collections, failing rather than
+// waiting when any is held. The returned func releases every lock taken.
+func lockMigration(opts MigrateOptions) (func() error, error) {
+	releaseRun, err := acquireRunLocks(opts.RootDir, opts.CachePath)
+	if err != nil {
+		return nil, err
+	}
+	var locks []*runLock
+	release := func() error {
+		errs := []error{releaseRun()}
+		for _, l := range locks {
+			errs = append(errs, l.Release())
+		}
+		return errors.Join(errs...)
+	}
+	for _, slug := range []string{opts.OldSlug, opts.NewSlug} {
+		l, err := acquireRunLock(repoLockKind, slug)
+		if err != nil {
+			return nil, errors.Join(err, release())
+		}
+		locks = append(locks, l)
+	}
+	return release, nil
+}
+
+// DescribeOptions configures DescribeCollection.
+type DescribeOptions struct {
+	// Chroma locates the collection store.
+	Chroma ChromaOptions
+	// Slug is the collection to describe.
+	Slug string
+	// JSON prints the description as a JSON object.
+	JSON bool
+}
+
+// collectionDescription is what DescribeCollection prints.
+type collectionDescription struct {
+	Metadata map[string]any `json:"metadata"`
+	Name     string         `json:"name"`
+	ID       string         `json:"id"`
+	Records  int            `json:"records"`
+}
+
+// DescribeCollection prints a collection's id, record count, and metadata,
+// including the repo, root path, indexer version, and embedding model runs
+// set on it.
+func DescribeCollection(ctx context.Context, w io.Writer, opts DescribeOptions) error {
+	client := newChromaClient(opts.Chroma)
+	col, ok, err := client.getCollection(ctx, opts.Slug)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("collection %q does not exist", opts.Slug)
+	}
+	n, err := client.countRecords(ctx, col.ID)
+	if err != nil {
+		return err
+	}
+
+	desc := collectionDescription{Metadata: col.Metadata, Name: col.Name, ID: col.ID, Records: n}
+	if opts.JSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(desc)
+	}
+	logf(w, "Collection: %s\nID:         %s\nRecords:    %d\n", desc.Name, desc.ID, desc.Records)
+	if len(desc.Metadata) == 0 {
+		logf(w, "Metadata:   none\n")
+		return nil
+	}
+	logf(w, "Metadata:\n")
+	for _, key := range slices.Sorted(maps.Keys(desc.Metadata)) {
+		logf(w, "  %s: %v\n", key, desc.Metadata[key])
+	}
+	return nil
+}
+
+// collectionMetadata is the metadata a run sets on the collection it
+// writes m's repo to. The embedding model is only known when the indexer
+// embeds documents itself.
+func (ix *indexer) collectionMetadata(m *indexManifest) map[string]any {
+	md := map[string]any{
+		collectionRepoKey:    m.Repo.Name,
+		collectionRootKey:    m.Repo.Path,
+		collectionIndexerKey: m.IndexerVersion,
+	}
+	if m.Repo.RemoteURL != "" {
+		md[collectionRemoteKey] = m.Repo.RemoteURL
+	}
+	if ix.opts.Ingest == IngestDirect || ix.opts.Ingest == IngestLocal {
+		md[embeddingModelKey] = ix.embedder().name()
+	}
+	return md
+}
+
+// stampCollection merges md into col's metadata, keeping the keys it does
+// not set, and writes it back when anything changed.
+func stampCollection(ctx context.Context, client *chromaClient, col chromaCollection, md map[string]any) error {
+	merged := maps.Clone(col.Metadata)
+	if merged == nil {
+		merged = make(map[string]any, len(md))
+	}
+	maps.Copy(merged, md)
+	if reflect.DeepEqual(merged, col.Metadata) {
+		return nil
+	}
+	return client.updateCollectionMetadata(ctx, col.ID, merged)
+}
+
+// copyCollection creates dst, in the store behind to, with src's metadata
+// and copies every record from the store behind from in pages, returning
+// the number copied.
+func copyCollection(
+	ctx context.Context, from *chromaClient, src chromaCollection, to *chromaClient, dst string,
+) (int, error) {
+	created, err := to.createCollection(ctx, dst, src.Metadata)
+	if err != nil {
+		return 0, err
+	}
+
+	copied := 0
+	for {
+		page, err := from.getRecords(ctx, src.ID, copied, chromaPageSize)
+		if err != nil {
+			return copied, fmt.Errorf("read %s: %w", src.Name, err)
+		}
+		if len(page.IDs) == 0 {
+			return copied, nil
+		}
+		if err := to.addRecords(ctx, created.ID, page); err != nil {
+			return copied, fmt.Errorf("write %s: %w", dst, err)
+		}
+		copied += len(page.IDs)
+		if len(page.IDs) < chromaPageSize {
+			return copied, nil
+		}
+	}
+}
+
+// logf writes a progress line; output errors are not worth failing a
+// migration over once the store has changed.
+func logf(w io.Writer, format string, args ...any) {
+	_, _ = fmt.Fprintf(w, format, args...)
+}
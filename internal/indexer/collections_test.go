@@ -0,0 +1,325 @@
+package indexer
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeChroma is an in-memory stand-in for the Chroma v2 collections API.
+type fakeChroma struct {
+	collections map[string]*fakeCollection
+	mu          sync.Mutex
+}
+
+type fakeCollection struct {
+	metadata map[string]any
+	records  chromaRecords
+	id       string
+	name     string
+}
+
+// window returns s[start:end], or nil when s is shorter, as for records
+// added without metadatas or embeddings.
+func window[T any](s []T, start, end int) []T {
+	if len(s) < end {
+		return nil
+	}
+	return s[start:end]
+}
+
+func (f *fakeChroma) byID(id string) *fakeCollection {
+	for _, c := range f.collections {
+		if c.id == id {
+			return c
+		}
+	}
+	return nil
+}
+
+func (f *fakeChroma) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	const prefix = "/api/v2/tenants/default_tenant/databases/default_database/collections"
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/")
+	parts := strings.Split(rest, "/")
+
+	switch {
+	case r.Method == http.MethodGet && rest == "":
+		var list []chromaCollection
+		for _, c := range f.collections {
+			list = append(list, chromaCollection{ID: c.id, Name: c.name})
+		}
+		_ = json.NewEncoder(w).Encode(list)
+	case r.Method == http.MethodDelete && len(parts) == 1:
+		delete(f.collections, parts[0])
+	case r.Method == http.MethodGet && len(parts) == 1:
+		c, ok := f.collections[parts[0]]
+		if !ok {
+			http.Error(w, `{"error":"NotFoundError"}`, http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(chromaCollection{ID: c.id, Name: c.name, Metadata: c.metadata})
+	case r.Method == http.MethodPost && rest == "":
+		var req struct {
+			Metadata map[string]any `json:"metadata"`
+			Name     string         `json:"name"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		c := &fakeCollection{id: "id-" + req.Name, name: req.Name, metadata: req.Metadata}
+		f.collections[req.Name] = c
+		_ = json.NewEncoder(w).Encode(chromaCollection{ID: c.id, Name: c.name})
+	case r.Method == http.MethodPut && len(parts) == 1:
+		var req struct {
+			NewName string `json:"new_name"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		c := f.byID(parts[0])
+		delete(f.collections, c.name)
+		c.name = req.NewName
+		f.collections[c.name] = c
+	case r.Method == http.MethodPost && len(parts) == 2 && parts[1] == "get":
+		var req struct {
+			Offset int `json:"offset"`
+			Limit  int `json:"limit"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		c := f.byID(parts[0])
+		end := min(req.Offset+req.Limit, len(c.records.IDs))
+		start := min(req.Offset, end)
+		_ = json.NewEncoder(w).Encode(chromaRecords{
+			IDs:        c.records.IDs[start:end],
+			Documents:  c.records.Documents[start:end],
+			Metadatas:  window(c.records.Metadatas, start, end),
+			Embeddings: window(c.records.Embeddings, start, end),
+		})
+	case r.Method == http.MethodPost && len(parts) == 2 && parts[1] == "add":
+		var recs chromaRecords
+		_ = json.NewDecoder(r.Body).Decode(&recs)
+		c := f.byID(parts[0])
+		c.records.IDs = append(c.records.IDs, recs.IDs...)
+		c.records.Documents = append(c.records.Documents, recs.Documents...)
+		c.records.Metadatas = append(c.records.Metadatas, recs.Metadatas...)
+		c.records.Embeddings = append(c.records.Embeddings, recs.Embeddings...)
+	default:
+		http.Error(w, "unexpected "+r.Method+" "+r.URL.Path, http.StatusBadRequest)
+	}
+}
+
+func newFakeChroma(t *testing.T, records int) (*fakeChroma, *httptest.Server) {
+	t.Helper()
+	src := &fakeCollection{id: "id-old", name: "old_api"}
+	for i := range records {
+		doc := "doc"
+		src.records.IDs = append(src.records.IDs, "r"+strings.Repeat("x", i))
+		src.records.Documents = append(src.records.Documents, &doc)
+	}
+	fake := &fakeChroma{collections: map[string]*fakeCollection{"old_api": src}}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	return fake, srv
+}
+
+func TestMigrateCollection(t *testing.T) {
+	tests := map[string]struct {
+		copy      bool
+		wantNames []string
+		wantOld   bool
+	}{
+		"rename": {
+			wantNames: []string{"new_api"},
+		},
+		"copy": {
+			copy:      true,
+			wantNames: []string{"new_api", "old_api"},
+			wantOld:   true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			fake, srv := newFakeChroma(t, chromaPageSize+3)
+
+			dir := t.TempDir()
+			cachePath := filepath.Join(dir, "cache.json")
+			cache, err := loadCommitCache(cachePath)
+			if err != nil {
+				t.Fatalf("load cache: %v", err)
+			}
+			cache.Update("old_api", "main", "abc123")
+			if err := cache.Save(); err != nil {
+				t.Fatalf("save cache: %v", err)
+			}
+
+			slugMapPath := filepath.Join(dir, "slugs.json")
+			slugs, err := loadSlugMap(slugMapPath)
+			if err != nil {
+				t.Fatalf("load slug map: %v", err)
+			}
+			slugs.resolve("https://github.com/org/api.git", "/src/old/api", "old_api", false)
+			if err := slugs.Save(); err != nil {
+				t.Fatalf("save slug map: %v", err)
+			}
+
+			err = MigrateCollection(t.Context(), io.Discard, MigrateOptions{
+				Chroma:      ChromaOptions{URL: srv.URL},
+				OldSlug:     "old_api",
+				NewSlug:     "new_api",
+				CachePath:   cachePath,
+				SlugMapPath: slugMapPath,
+				Copy:        tc.copy,
+			})
+			if err != nil {
+				t.Fatalf("migrate: %v", err)
+			}
+
+			if len(fake.collections) != len(tc.wantNames) {
+				t.Fatalf("expected collections %v, got %d", tc.wantNames, len(fake.collections))
+			}
+			for _, n := range tc.wantNames {
+				if _, ok := fake.collections[n]; !ok {
+					t.Fatalf("expected collection %q to exist", n)
+				}
+			}
+			if got := len(fake.collections["new_api"].records.IDs); got != chromaPageSize+3 {
+				t.Fatalf("expected %d records in new collection, got %d", chromaPageSize+3, got)
+			}
+
+			reloaded, err := loadCommitCache(cachePath)
+			if err != nil {
+				t.Fatalf("reload cache: %v", err)
+			}
+			if commit, ok := reloaded.LastCommit("new_api", "main"); !ok || commit != "abc123" {
+				t.Fatalf("expected cache entry under new slug, got %q", commit)
+			}
+			if _, ok := reloaded.LastCommit("old_api", "main"); ok != tc.wantOld {
+				t.Fatalf("expected old cache entry present=%t", tc.wantOld)
+			}
+
+			remapped, err := loadSlugMap(slugMapPath)
+			if err != nil {
+				t.Fatalf("reload slug map: %v", err)
+			}
+			slug, _ := remapped.resolve("https://github.com/org/api.git", "/src/old/api", "old_api", true)
+			if slug != "new_api" {
+				t.Fatalf("expected slug map to point at new_api, got %q", slug)
+			}
+		})
+	}
+}
+
+func TestMigrateCollectionRejectsExistingTarget(t *testing.T) {
+	fake, srv := newFakeChroma(t, 1)
+	fake.collections["new_api"] = &fakeCollection{id: "id-new", name: "new_api"}
+
+	err := MigrateCollection(t.Context(), io.Discard, MigrateOptions{
+		Chroma:  ChromaOptions{URL: srv.URL},
+		OldSlug: "old_api",
+		NewSlug: "new_api",
+	})
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("expected existing target error, got %v", err)
+	}
+}
+
+func TestMigrateCollectionLocked(t *testing.T) {
+	tests := map[string]struct {
+		// kind and key name the lock another run holds; a "" key is the
+		// test's root or cache path.
+		kind string
+		key  string
+	}{
+		"root":           {kind: "root directory"},
+		"commit cache":   {kind: "commit cache"},
+		"old collection": {kind: repoLockKind, key: "old_api"},
+		"new collection": {kind: repoLockKind, key: "new_api"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			fake, srv := newFakeChroma(t, 1)
+			rootDir := t.TempDir()
+			cachePath := filepath.Join(rootDir, "cache.json")
+			key := tc.key
+			switch {
+			case key != "":
+			case tc.kind == "commit cache":
+				key = cachePath
+			default:
+				key = rootDir
+			}
+			held, err := acquireRunLock(tc.kind, key)
+			if err != nil {
+				t.Fatalf("acquire lock: %v", err)
+			}
+			t.Cleanup(func() { _ = held.Release() })
+
+			err = MigrateCollection(t.Context(), io.Discard, MigrateOptions{
+				Chroma:    ChromaOptions{URL: srv.URL},
+				OldSlug:   "old_api",
+				NewSlug:   "new_api",
+				RootDir:   rootDir,
+				CachePath: cachePath,
+			})
+			var lockErr *runLockHeld
+			if !errors.As(err, &lockErr) || lockErr.kind != tc.kind {
+				t.Fatalf("expected the %s lock to stop the migration, got %v", tc.kind, err)
+			}
+			if _, ok := fake.collections["old_api"]; !ok {
+				t.Fatal("expected old_api left in place")
+			}
+		})
+	}
+}
+
+func TestDescribeCollection(t *testing.T) {
+	chroma := ChromaOptions{URL: "http://chroma.invalid"}
+	closeStore, err := OpenEmbeddedStore(t.TempDir(), &chroma)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = closeStore() })
+	client := newChromaClient(chroma)
+	col, err := client.createCollection(t.Context(), "api", map[string]any{"hnsw:space": "cosine"})
+	if err != nil {
+		t.Fatalf("create collection: %v", err)
+	}
+	err = stampCollection(t.Context(), client, col, map[string]any{collectionRepoKey: "api", embeddingModelKey: "hash"})
+	if err != nil {
+		t.Fatalf("stamp collection: %v", err)
+	}
+
+	tests := map[string]struct {
+		json bool
+		want []string
+	}{
+		"text": {want: []string{"Collection: api\n", "Records:    0\n", "  embedding_model: hash\n", "  hnsw:space: cosine\n"}},
+		"json": {json: true, want: []string{`"name": "api"`, `"records": 0`, `"repo": "api"`, `"hnsw:space": "cosine"`}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var out strings.Builder
+			err := DescribeCollection(t.Context(), &out, DescribeOptions{Chroma: chroma, Slug: "api", JSON: tc.json})
+			if err != nil {
+				t.Fatalf("describe: %v", err)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(out.String(), want) {
+					t.Fatalf("expected %q in %q", want, out.String())
+				}
+			}
+		})
+	}
+
+	if err := DescribeCollection(t.Context(), io.Discard, DescribeOptions{Chroma: chroma, Slug: "web"}); err == nil {
+		t.Fatal("expected an error for a missing collection")
+	}
+}
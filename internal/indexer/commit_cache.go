@@ -4,16 +4,30 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"os"
+	"slices"
 	"sync"
 )
 
 type commitCache struct {
 	data map[string]map[string]string
-	path string
-	mu   sync.RWMutex
+	// flush wakes the flusher started by startFlusher; nil when saves are
+	// synchronous.
+	flush chan struct{}
+	// recovered is why the cache file could not be loaded when the backup
+	// was used instead.
+	recovered error
+	path      string
+	mu        sync.RWMutex
+	// saveMu serializes writes of the cache file.
+	saveMu sync.Mutex
 }
 
+// loadCommitCache reads the cache at path. A truncated or corrupt file is
+// replaced by its backup from the previous save when that is intact; the
+// failure is kept in recovered so callers can warn about it.
 func loadCommitCache(path string) (*commitCache, error) {
 	cache := &commitCache{
 		path: path,
@@ -23,45 +37,124 @@ func loadCommitCache(path string) (*commitCache, error) {
 		return cache, nil
 	}
 
-	bytes, err := os.ReadFile(path)
-	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
+	data, err := readCommitCacheFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cache, nil
+	}
+	if err != nil || data == nil {
+		backup, backupErr := readCommitCacheFile(path + backupSuffix)
+		if backupErr == nil && backup != nil {
+			if err == nil {
+				err = errors.New("commit cache is empty")
+			}
+			cache.data = backup
+			cache.recovered = err
 			return cache, nil
 		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if data != nil {
+		cache.data = data
+	}
+	return cache, nil
+}
+
+// warnRecovered reports on w when the cache was restored from its backup.
+func (c *commitCache) warnRecovered(w io.Writer) {
+	if c == nil || c.recovered == nil {
+		return
+	}
+	logf(w, "%v; restored %s from %s\n", c.recovered, c.path, c.path+backupSuffix)
+}
+
+// readCommitCacheFile decodes the cache file at path; an empty file yields
+// a nil map.
+func readCommitCacheFile(path string) (map[string]map[string]string, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
 		return nil, fmt.Errorf("read commit cache: %w", err)
 	}
 	if len(bytes) == 0 {
-		return cache, nil
+		return nil, nil
 	}
 
-	if err := json.Unmarshal(bytes, &cache.data); err != nil {
+	var data map[string]map[string]string
+	if err := json.Unmarshal(bytes, &data); err != nil {
 		return nil, fmt.Errorf("decode commit cache: %w", err)
 	}
-	return cache, nil
+	return data, nil
 }
 
+// Save writes the cache durably, first copying the previous file to the
+// backup when it is intact.
 func (c *commitCache) Save() error {
 	if c == nil || c.path == "" {
 		return nil
 	}
 
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	c.saveMu.Lock()
+	defer c.saveMu.Unlock()
 
+	c.mu.RLock()
 	data, err := json.MarshalIndent(c.data, "", "  ")
+	c.mu.RUnlock()
 	if err != nil {
 		return fmt.Errorf("encode commit cache: %w", err)
 	}
 
-	tmpPath := c.path + ".tmp"
-	if err := os.WriteFile(tmpPath, data, 0o600); err != nil {
-		return fmt.Errorf("write commit cache: %w", err)
+	if err := rotateBackup(c.path, json.Valid); err != nil {
+		return fmt.Errorf("back up commit cache: %w", err)
 	}
-
-	if err := os.Rename(tmpPath, c.path); err != nil {
+	if err := writeFileSynced(c.path, data, 0o600); err != nil {
 		return fmt.Errorf("persist commit cache: %w", err)
 	}
+	return nil
+}
+
+// startFlusher saves the cache from a single goroutine whenever
+// requestSave is called, so parallel workers finishing repos share one
+// write instead of each rewriting the file. Requests made while a save is
+// running are coalesced into the next one. stop waits for the flusher to
+// drain; failed saves are passed to onErr.
+func (c *commitCache) startFlusher(onErr func(error)) (stop func()) {
+	if c == nil || c.path == "" {
+		return func() {}
+	}
+
+	c.flush = make(chan struct{}, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range c.flush {
+			if err := c.Save(); err != nil {
+				onErr(err)
+			}
+		}
+	}()
+	return func() {
+		close(c.flush)
+		<-done
+		c.flush = nil
+	}
+}
+
+// requestSave persists the cache: in the background when a flusher is
+// running, otherwise immediately.
+func (c *commitCache) requestSave() error {
+	if c == nil || c.path == "" {
+		return nil
+	}
+	if c.flush == nil {
+		return c.Save()
+	}
 
+	select {
+	case c.flush <- struct{}{}:
+	default:
+		// A save is already pending and will include this update.
+	}
 	return nil
 }
 
@@ -98,3 +191,46 @@ func (c *commitCache) Update(repoSlug, branch, commit string) {
 
 	branches[branch] = commit
 }
+
+// MoveSlug re-keys oldSlug's branches under newSlug, keeping the old entry
+// when keepOld is set. It reports whether oldSlug had any entries.
+func (c *commitCache) MoveSlug(oldSlug, newSlug string, keepOld bool) bool {
+	if c == nil {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	branches, ok := c.data[oldSlug]
+	if !ok {
+		return false
+	}
+	c.data[newSlug] = maps.Clone(branches)
+	if !keepOld {
+		delete(c.data, oldSlug)
+	}
+	return true
+}
+
+// Slugs returns every slug with cached commits.
+func (c *commitCache) Slugs() []string {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return slices.Sorted(maps.Keys(c.data))
+}
+
+// Delete drops every cached commit for repoSlug.
+func (c *commitCache) Delete(repoSlug string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.data, repoSlug)
+}
@@ -1,8 +1,12 @@
 package indexer
 
 import (
+	"bytes"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -125,3 +129,167 @@ func TestLoadCommitCacheMissingFile(t *testing.T) {
 		t.Fatalf("expected empty cache, got %v", cache.data)
 	}
 }
+
+func TestCommitCacheFlusherConcurrentUpdates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+	cache, err := loadCommitCache(path)
+	if err != nil {
+		t.Fatalf("load cache: %v", err)
+	}
+
+	var saveErrs []error
+	stop := cache.startFlusher(func(err error) { saveErrs = append(saveErrs, err) })
+
+	const workers = 32
+	var wg sync.WaitGroup
+	for i := range workers {
+		wg.Go(func() {
+			cache.Update(fmt.Sprintf("repo-%d", i), "main", fmt.Sprintf("commit-%d", i))
+			if err := cache.requestSave(); err != nil {
+				t.Errorf("request save: %v", err)
+			}
+		})
+	}
+	wg.Wait()
+	stop()
+
+	if len(saveErrs) != 0 {
+		t.Fatalf("expected no save errors, got %v", saveErrs)
+	}
+	loaded, err := loadCommitCache(path)
+	if err != nil {
+		t.Fatalf("reload cache: %v", err)
+	}
+	for i := range workers {
+		want := fmt.Sprintf("commit-%d", i)
+		if got, ok := loaded.LastCommit(fmt.Sprintf("repo-%d", i), "main"); !ok || got != want {
+			t.Fatalf("expected repo-%d at %s after flush, got %q (ok=%t)", i, want, got, ok)
+		}
+	}
+}
+
+func TestCommitCacheRequestSaveWithoutFlusher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+	cache, err := loadCommitCache(path)
+	if err != nil {
+		t.Fatalf("load cache: %v", err)
+	}
+
+	cache.Update("repo", "main", "abc123")
+	if err := cache.requestSave(); err != nil {
+		t.Fatalf("request save: %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("expected cache written synchronously: %v", err)
+	}
+}
+
+func TestCommitCacheSaveKeepsBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+	cache, err := loadCommitCache(path)
+	if err != nil {
+		t.Fatalf("load cache: %v", err)
+	}
+
+	cache.Update("repo", "main", "first")
+	if err := cache.Save(); err != nil {
+		t.Fatalf("first save: %v", err)
+	}
+	if _, err := os.Stat(path + backupSuffix); !os.IsNotExist(err) {
+		t.Fatalf("expected no backup before a previous save exists, got %v", err)
+	}
+	cache.Update("repo", "main", "second")
+	if err := cache.Save(); err != nil {
+		t.Fatalf("second save: %v", err)
+	}
+
+	backup, err := readCommitCacheFile(path + backupSuffix)
+	if err != nil {
+		t.Fatalf("read backup: %v", err)
+	}
+	if got := backup["repo"]["main"]; got != "first" {
+		t.Fatalf("expected backup to hold the previous save, got %q", got)
+	}
+
+	// A damaged cache file must not replace the good backup.
+	if err := os.WriteFile(path, []byte(`{"repo": {"ma`), 0o600); err != nil {
+		t.Fatalf("corrupt cache: %v", err)
+	}
+	if err := cache.Save(); err != nil {
+		t.Fatalf("save over corrupt file: %v", err)
+	}
+	backup, err = readCommitCacheFile(path + backupSuffix)
+	if err != nil {
+		t.Fatalf("read backup after corrupt save: %v", err)
+	}
+	if got := backup["repo"]["main"]; got != "first" {
+		t.Fatalf("expected corrupt file not to be backed up, got %q", got)
+	}
+}
+
+func TestLoadCommitCacheRecovery(t *testing.T) {
+	good := `{"repo": {"main": "abc123"}}`
+	tests := map[string]struct {
+		cache     string
+		backup    string
+		wantErr   bool
+		recovered bool
+	}{
+		"corrupt with backup":   {cache: `{"repo": {"ma`, backup: good, recovered: true},
+		"truncated with backup": {cache: "", backup: good, recovered: true},
+		"corrupt without backup": {
+			cache:   `{"repo": {"ma`,
+			wantErr: true,
+		},
+		"corrupt backup": {
+			cache:   `{"repo": {"ma`,
+			backup:  `not json`,
+			wantErr: true,
+		},
+		"intact ignores backup": {
+			cache:  `{"repo": {"main": "def456"}}`,
+			backup: good,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "cache.json")
+			if err := os.WriteFile(path, []byte(tc.cache), 0o600); err != nil {
+				t.Fatalf("write cache: %v", err)
+			}
+			if tc.backup != "" {
+				if err := os.WriteFile(path+backupSuffix, []byte(tc.backup), 0o600); err != nil {
+					t.Fatalf("write backup: %v", err)
+				}
+			}
+
+			cache, err := loadCommitCache(path)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected load error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("load cache: %v", err)
+			}
+			if (cache.recovered != nil) != tc.recovered {
+				t.Fatalf("expected recovered=%t, got %v", tc.recovered, cache.recovered)
+			}
+			want := "def456"
+			if tc.recovered {
+				want = "abc123"
+			}
+			if got, _ := cache.LastCommit("repo", "main"); got != want {
+				t.Fatalf("expected commit %s, got %q", want, got)
+			}
+
+			var out bytes.Buffer
+			cache.warnRecovered(&out)
+			if tc.recovered != strings.Contains(out.String(), "restored") {
+				t.Fatalf("unexpected recovery warning %q", out.String())
+			}
+		})
+	}
+}
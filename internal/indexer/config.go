@@ -0,0 +1,440 @@
+package indexer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// repoEnvFileName is an optional dotenv-style file in a repository root whose
+// variables are injected into the Codex process for that repository.
+const repoEnvFileName = ".ai-indexer.env"
+
+// defaultRemote is fetched from when no remote preference is configured.
+const defaultRemote = "origin"
+
+// Config holds optional settings loaded from the --config file.
+type Config struct {
+	// Chroma locates the collection store; flags override it.
+	Chroma *ChromaConfig `json:"chroma,omitempty"`
+	// Root is the directory indexed when no root argument is given.
+	Root string `json:"root,omitempty"`
+	// CodexPath is the Codex executable used as the runner; --codex-path
+	// overrides it.
+	CodexPath string `json:"codex_path,omitempty"`
+	// SkipRepos lists repos to skip in addition to --skip-repo values.
+	SkipRepos []string `json:"skip_repos,omitempty"`
+	// Repos maps a repo slug, basename, or path to its settings. Every
+	// matching entry applies, in sorted key order.
+	Repos map[string]RepoConfig `json:"repos,omitempty"`
+	// Passes is the default multi-pass pipeline: each pass is its own Codex
+	// run. Empty runs Codex once with the standard prompt.
+	Passes []PassConfig `json:"passes,omitempty"`
+	// Redact lists files Codex must never read or index in any repo; repo
+	// entries add their own.
+	Redact []RedactRule `json:"redact,omitempty"`
+	// Credentials maps a remote host (e.g. "github.com") to the credentials
+	// used for git network operations against it.
+	Credentials map[string]CredentialConfig `json:"credentials,omitempty"`
+	// Replicas are additional stores each indexed collection is copied to.
+	Replicas []ReplicaConfig `json:"replicas,omitempty"`
+	// Parallel is the default for --parallel.
+	Parallel int `json:"parallel,omitempty"`
+	// TagSchedules maps a repo tag to the cron expression of its own
+	// --daemon sweeps; --tag-schedule values for the same tag win.
+	TagSchedules map[string]string `json:"tag_schedules,omitempty"`
+}
+
+// ChromaConfig is the config file form of the Chroma connection flags. The
+// token itself is never stored; TokenEnv names the variable holding it.
+type ChromaConfig struct {
+	URL      string `json:"url,omitempty"`
+	Tenant   string `json:"tenant,omitempty"`
+	Database string `json:"database,omitempty"`
+	TokenEnv string `json:"token_env,omitempty"`
+}
+
+// RepoConfig customizes indexing for a single repository.
+type RepoConfig struct {
+	// Env is injected into the Codex process environment.
+	Env map[string]string `json:"env,omitempty"`
+	// Proxy overrides the global proxy settings for git network operations.
+	Proxy *ProxyConfig `json:"proxy,omitempty"`
+	// Remotes overrides the --remote preference order for this repo.
+	Remotes []string `json:"remotes,omitempty"`
+	// Exclude lists paths Codex should ignore in addition to the default
+	// noisy directories; entries from every matching config are combined.
+	Exclude []string `json:"exclude,omitempty"`
+	// Redact lists files Codex must never read or index, in addition to the
+	// global rules; entries from every matching config are combined.
+	Redact []RedactRule `json:"redact,omitempty"`
+	// Codegen is a shell command (e.g. "make generate") run in the index
+	// worktree before Codex starts.
+	Codegen string `json:"codegen,omitempty"`
+	// Passes replaces the default pipeline for this repo; the last matching
+	// entry that sets it wins.
+	Passes []PassConfig `json:"passes,omitempty"`
+	// Tags label the repo for --tag selection and are added to the "tags"
+	// metadata of its documents; entries from every matching config are
+	// combined.
+	Tags []string `json:"tags,omitempty"`
+	// Collection pins the repo's collection name, replacing the slug
+	// derived from its path and any name recorded in the slug map; the
+	// last matching entry that sets it wins.
+	Collection string `json:"collection,omitempty"`
+}
+
+// ProxyConfig holds proxy settings applied to git fetch subprocesses. Empty
+// fields leave the inherited environment untouched.
+type ProxyConfig struct {
+	HTTPProxy  string `json:"http_proxy,omitempty"`
+	HTTPSProxy string `json:"https_proxy,omitempty"`
+	NoProxy    string `json:"no_proxy,omitempty"`
+}
+
+// merge returns p with non-empty fields from override applied.
+func (p ProxyConfig) merge(override *ProxyConfig) ProxyConfig {
+	if override == nil {
+		return p
+	}
+	if override.HTTPProxy != "" {
+		p.HTTPProxy = override.HTTPProxy
+	}
+	if override.HTTPSProxy != "" {
+		p.HTTPSProxy = override.HTTPSProxy
+	}
+	if override.NoProxy != "" {
+		p.NoProxy = override.NoProxy
+	}
+	return p
+}
+
+// env renders the proxy settings in both the upper and lower case forms
+// honored by git and libcurl.
+func (p ProxyConfig) env() []string {
+	var out []string
+	add := func(name, value string) {
+		if value == "" {
+			return
+		}
+		out = append(out, strings.ToUpper(name)+"="+value, name+"="+value)
+	}
+	add("http_proxy", p.HTTPProxy)
+	add("https_proxy", p.HTTPSProxy)
+	add("no_proxy", p.NoProxy)
+	return out
+}
+
+// repoSettings is the effective configuration for one repository after
+// merging global options, config entries, and repo-local files.
+type repoSettings struct {
+	env        map[string]string
+	credential *resolvedCredential
+	// exclude is passed to Codex in the manifest's exclusions.
+	exclude []string
+	// redact is the repo's compiled redaction rules.
+	redact redaction
+	// passes is the repo's multi-pass pipeline; empty runs Codex once.
+	passes []PassConfig
+	// tags are the repo's config tags; see Config.repoTags.
+	tags []string
+	// remoteName is the remote fetched from and used to resolve the default
+	// branch.
+	remoteName string
+	// remote is the selected remote's URL with any credentials removed.
+	remote string
+	// remoteRaw is the selected remote's URL as configured in the repo.
+	remoteRaw string
+	codegen   string
+	proxy     ProxyConfig
+}
+
+// gitEnv returns the environment for git network subprocesses, or nil to
+// inherit the current process environment.
+func (rs repoSettings) gitEnv() []string {
+	extra := slices.Concat(rs.proxy.env(), rs.credential.env())
+	if len(extra) == 0 {
+		return nil
+	}
+	return append(os.Environ(), extra...)
+}
+
+// LoadConfig reads a JSON config file. An empty path yields an empty config.
+func LoadConfig(path string) (*Config, error) {
+	cfg := &Config{}
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("decode config %s: %w", path, err)
+	}
+
+	if cfg.Parallel < 0 {
+		return nil, fmt.Errorf("config %s: parallel must be positive", path)
+	}
+	if err := validatePasses(cfg.Passes); err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+	if _, err := compileRedaction(cfg.Redact); err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+	if err := validateReplicas(cfg.Replicas); err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+	for key, repo := range cfg.Repos {
+		for name := range repo.Env {
+			if err := validateEnvName(name); err != nil {
+				return nil, fmt.Errorf("config repo %q: %w", key, err)
+			}
+		}
+		if err := validatePasses(repo.Passes); err != nil {
+			return nil, fmt.Errorf("config repo %q: %w", key, err)
+		}
+		if _, err := compileRedaction(repo.Redact); err != nil {
+			return nil, fmt.Errorf("config repo %q: %w", key, err)
+		}
+		for _, tag := range repo.Tags {
+			if err := validateTag(tag); err != nil {
+				return nil, fmt.Errorf("config repo %q: %w", key, err)
+			}
+		}
+		if repo.Collection != "" {
+			if err := validateCollectionName(repo.Collection); err != nil {
+				return nil, fmt.Errorf("config repo %q: collection: %w", key, err)
+			}
+		}
+	}
+
+	return cfg, nil
+}
+
+// repoConfigs returns every config entry matching the repo, in sorted key
+// order so later keys win when merged.
+func (c *Config) repoConfigs(id repoIdentity) []RepoConfig {
+	if c == nil || len(c.Repos) == 0 {
+		return nil
+	}
+
+	var matched []RepoConfig
+	for _, key := range slices.Sorted(maps.Keys(c.Repos)) {
+		if id.matches(key) {
+			matched = append(matched, c.Repos[key])
+		}
+	}
+	return matched
+}
+
+// validateTag rejects tags that cannot be listed in comma-separated
+// metadata.
+func validateTag(tag string) error {
+	if strings.TrimSpace(tag) == "" || strings.ContainsAny(tag, ", \t\n") {
+		return fmt.Errorf("invalid tag %q: tags must be non-empty without commas or spaces", tag)
+	}
+	return nil
+}
+
+// repoTags returns the tags of every config entry matching the repo, in
+// order and without duplicates.
+func (c *Config) repoTags(id repoIdentity) []string {
+	var tags []string
+	for _, rc := range c.repoConfigs(id) {
+		for _, tag := range rc.Tags {
+			if !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// repoCollection returns the collection name pinned for the repo, or ""
+// when no matching entry pins one.
+func (c *Config) repoCollection(id repoIdentity) string {
+	var name string
+	for _, rc := range c.repoConfigs(id) {
+		if rc.Collection != "" {
+			name = rc.Collection
+		}
+	}
+	return name
+}
+
+// resolveRepoSettings merges global options with matching config entries.
+// Extra environment comes from the repo's own .ai-indexer.env first, then
+// config entries, which take precedence. Credentials are selected by the
+// preferred remote's host.
+func (ix *indexer) resolveRepoSettings(ctx context.Context, id repoIdentity, repoDir string) (repoSettings, error) {
+	env, err := loadEnvFile(filepath.Join(repoDir, repoEnvFileName))
+	if err != nil {
+		return repoSettings{}, err
+	}
+
+	settings := repoSettings{
+		env:   env,
+		proxy: ix.opts.Proxy,
+		tags:  ix.config.repoTags(id),
+	}
+	var rules []RedactRule
+	if ix.config != nil {
+		settings.passes = ix.config.Passes
+		rules = ix.config.Redact
+	}
+	for _, rc := range ix.config.repoConfigs(id) {
+		rules = slices.Concat(rules, rc.Redact)
+		settings.proxy = settings.proxy.merge(rc.Proxy)
+		if rc.Codegen != "" {
+			settings.codegen = rc.Codegen
+		}
+		if len(rc.Passes) > 0 {
+			settings.passes = rc.Passes
+		}
+		settings.exclude = append(settings.exclude, rc.Exclude...)
+		if len(rc.Env) == 0 {
+			continue
+		}
+		if settings.env == nil {
+			settings.env = make(map[string]string, len(rc.Env))
+		}
+		maps.Copy(settings.env, rc.Env)
+	}
+	if settings.redact, err = compileRedaction(rules); err != nil {
+		return repoSettings{}, err
+	}
+
+	settings.remoteName = ix.selectRemote(ctx, id, repoDir)
+	rawURL, err := remoteURL(ctx, repoDir, settings.remoteName)
+	if err != nil {
+		return settings, nil
+	}
+	settings.remote = stripURLCredentials(rawURL)
+	settings.remoteRaw = rawURL
+
+	host := remoteHost(rawURL)
+	if cfg, ok := ix.config.credentialFor(host); ok {
+		cred, err := resolveCredential(host, cfg)
+		if err != nil {
+			return repoSettings{}, err
+		}
+		ix.masker.add(cred.secrets()...)
+		settings.credential = cred
+	}
+	return settings, nil
+}
+
+// selectRemote returns the first remote from the repo's config entry or
+// --remote preference list that exists in the repo, falling back to the
+// first preference when none do.
+func (ix *indexer) selectRemote(ctx context.Context, id repoIdentity, repoDir string) string {
+	prefs := ix.opts.Remotes
+	for _, rc := range ix.config.repoConfigs(id) {
+		if len(rc.Remotes) > 0 {
+			prefs = rc.Remotes
+		}
+	}
+	if len(prefs) == 0 {
+		prefs = []string{defaultRemote}
+	}
+	if len(prefs) == 1 {
+		return prefs[0]
+	}
+
+	existing, err := listRemotes(ctx, repoDir)
+	if err != nil {
+		return prefs[0]
+	}
+	for _, name := range prefs {
+		if slices.Contains(existing, name) {
+			return name
+		}
+	}
+	return prefs[0]
+}
+
+// loadEnvFile parses KEY=VALUE lines, ignoring blanks and # comments. A
+// leading "export " and surrounding quotes are accepted. A missing file
+// yields nil.
+func loadEnvFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+
+	env := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, lineNo)
+		}
+		name = strings.TrimSpace(name)
+		if err := validateEnvName(name); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			if value[0] == '"' {
+				unquoted, err := strconv.Unquote(value)
+				if err != nil {
+					return nil, fmt.Errorf("%s:%d: invalid quoted value: %w", path, lineNo, err)
+				}
+				value = unquoted
+			} else {
+				value = value[1 : len(value)-1]
+			}
+		}
+		env[name] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scan %s: %w", path, err)
+	}
+
+	return env, nil
+}
+
+func validateEnvName(name string) error {
+	if name == "" {
+		return errors.New("empty environment variable name")
+	}
+	if strings.ContainsAny(name, "= \t\x00") {
+		return fmt.Errorf("invalid environment variable name %q", name)
+	}
+	return nil
+}
+
+// envList renders extra env vars as sorted KEY=VALUE entries.
+func envList(env map[string]string) []string {
+	out := make([]string, 0, len(env))
+	for _, name := range slices.Sorted(maps.Keys(env)) {
+		out = append(out, name+"="+env[name])
+	}
+	return out
+}
@@ -1,6 +1,8 @@
 package indexer
 
-const codexPrompt = `You are Codex running in automation mode (codex exec) on a Git repository.
+// codexPromptTemplate is the standard prompt; codexPrompt renders the
+// metadata schema into it.
+const codexPromptTemplate = `You are Codex running in automation mode (codex exec) on a Git repository.
 This run's purpose is to deeply understand the codebase and persist durable,
 query-friendly summaries into our long term memory database using the Chroma
 MCP server.
@@ -20,13 +22,102 @@ Assumptions and environment:
   and upsert documents.
 - You may run read-only shell commands like "ls", "find", or "git" as needed
   to explore the repo.
-- The environment variable COLLECTION_SLUG is set and must be used as the
-  Chroma collection name for this repository.
-- If the environment variable INDEX_BASE_COMMIT is set, only re-index the
-  files that changed between that commit and HEAD. A newline-delimited list
-  of impacted files may also be provided via INDEX_DIFF_FILES for convenience.
-  Focus your exploration on those files/directories and update only the
-  affected module summaries in Chroma.
+- The environment variable INDEX_MANIFEST_PATH points to a JSON manifest
+  describing this run. Read it first. Its fields are:
+  - "collection": the Chroma collection name for this repository.
+  - "repo": "name", "path", "branch", and "remote_url" (the canonical remote,
+    for example "https://github.com/org/repo.git"; absent when the repo has
+    no remote).
+  - "commit": the commit being indexed ("sha", "author", "date", "subject").
+  - "mode": "full" or "incremental".
+  - "base": for incremental runs, the previously indexed commit.
+  - "diff": for incremental runs, the files changed since "base", each with
+    "path", "status" (git name-status: A added, M modified, D deleted,
+    R renamed, C copied, T type changed), and "old_path" for renames and
+    copies.
+  - "diff_truncated": present when "diff" was too large for this prompt and
+    lists only its first "listed" of "total" files. "directories" counts the
+    changed files per top-level directory, and "file" is a JSON file with the
+    complete list; read it in pages (for example with "jq") rather than all
+    at once.
+  - "languages": the most common languages by tracked file count.
+  - "exclusions": paths to ignore or downweight.
+  - "forbidden": when set, redacted content: "paths" are path and glob rules
+    (a rule without a slash matches that name at any depth, and a matching
+    directory covers everything under it) and "files" lists the matching
+    tracked files ("total" counts them all when the list is cut short).
+  - "version": the release tag being indexed, when set.
+  - "onboarding": when set, "path" of a Markdown onboarding document to write
+    and "only", which is true when this run must not write to Chroma.
+  - "infra": when set, the repo's infrastructure as code: "terraform",
+    "helm", and "kustomize" list module, chart, and overlay directories;
+    "kubernetes" lists manifest files outside Helm charts.
+  - "expertise": when set, recent git history per top-level directory:
+    "since" (the window) and "directories", each with "dir", "commits", and
+    its top "contributors" ("name", "commits", "last_commit").
+  - "changelog": when set, recent history since "since": "commits" (merge
+    commits, newest first, or first-parent commits when "merges" is false
+    because the repo squash-merges) and release "tags" ("name", "date",
+    "commit").
+  - "issues": when set, the GitHub "repo" ("owner/name") and "file", a JSON
+    file with its open "issues" and recently merged "pulls" (counted by
+    "issues" and "pulls" here). Each has "number", "title", "url", "date",
+    "labels", "body" ("complete" is false when it was truncated), and, for
+    pull requests, the changed "paths".
+  - "ci": when set, the repo's CI configuration files, each with "system"
+    ("github_actions", "gitlab_ci", or "jenkins") and "path".
+  - "schema": when set, the repo's database schema sources: "migrations"
+    and "ent" list SQL migration and ent/schema directories; "sql",
+    "prisma", and "sqlc" list schema files and sqlc configs.
+  - "dependencies": when set, "file" is a JSON file with a generated
+    dependency inventory ("id", "document", and "metadata") covering
+    "count" direct dependencies.
+  - "limits": when set, hard store limits: "max_doc_chars" (characters per
+    document) and "docs_per_module" (documents per module path).
+  - "indexer_version": the ai-indexer build that started this run.
+  - "run_id": identifies this indexer run.
+  - "tags": when set, the repo's tags from the indexer config (for example
+    "critical"); include them in every document's "tags" metadata.
+  - "scratch": when set, the repo is mounted read-only and any file you
+    need to write (notes, intermediate output) must go under this directory,
+    which is also TMPDIR. It is deleted when the run ends.
+- If "limits" is set, obey it exactly; it reflects what the store accepts
+  and is not a suggestion. Split any document longer than
+  "limits.max_doc_chars" characters into consecutive chunks of at most that
+  size, breaking between sections or paragraphs, with ids suffixed "-1",
+  "-2", and so on and metadata "chunk" (1-based) and "chunks" (the total).
+  Never write more than "limits.docs_per_module" documents, counting each
+  chunk, for one "path"; condense rather than exceed it. When rewriting a
+  document with fewer chunks than before, delete the leftover chunks.
+- If "forbidden" is set, never open, read, search, quote, summarize, or
+  index the files it lists or the paths its rules match, and do not mention
+  their contents in any document. Redacted files are left out of "diff";
+  treat them as if they did not exist beyond noting, at most, that a
+  directory is redacted.
+- In incremental mode, only re-index the files listed in "diff" (or in
+  "diff_truncated.file" when it is set). Focus your exploration on those
+  files/directories and update only the affected module summaries in Chroma.
+  Remove or rewrite summaries for deleted files, and move summaries of
+  renamed files to their new path.
+- If "version" is set, this run indexes that release tag. Stamp every
+  document you write with it (see "version" below) and also write one
+  "release_snapshot" document whose id includes the version, describing what
+  the release contains and what changed since the previous release. Never
+  overwrite snapshots of other versions.
+- If "dependencies" is set, upsert the inventory in "dependencies.file"
+  into the collection exactly as given: its "id", its "document" text, and
+  its "metadata", which already carries the usual repo, collection, commit,
+  and run_id values. Do not rewrite or summarize it, and do not write
+  another dependencies document. Upserting it again in a later pass is
+  harmless.
+- If "onboarding" is set, also write a human-readable onboarding guide for
+  engineers new to this repo to "onboarding.path" (update it if it already
+  exists; in incremental mode revise only the affected sections). Cover what
+  the repo is for, how to build, test, and run it, the layout and main
+  components, key workflows and data flows, configuration, and gotchas. It
+  is generated: start it with a note saying so, and keep it accurate rather
+  than long. If "onboarding.only" is true, do not create, modify, or upsert
+  anything in Chroma; the onboarding document is this run's only output.
 
 Repository understanding:
 1) Identify the repo name, primary languages, and any obvious framework or
@@ -36,21 +127,18 @@ Repository understanding:
    - Top level directories and what they represent.
    - Key services, packages, or modules.
    - Important binaries, libraries, or CLIs.
-4) Ignore or downweight obviously noisy directories like:
-   - .git, .github, .idea, .vscode
-   - node_modules, target, dist, build, out
-   - vendor, .venv, .tox, coverage or test output
-   - large generated artifacts or lockfiles, unless they help understand
-     the domain.
+4) Ignore or downweight the manifest's "exclusions", test output, and
+   large generated artifacts or lockfiles, unless they help understand the
+   domain.
 
 Chroma / memory requirements:
 Your job is to persist useful long term knowledge about this repo into Chroma.
 
 1) Collection naming and usage
    - Use exactly one Chroma collection per repo for this run.
-   - The collection name MUST be the value of the environment variable
-     COLLECTION_SLUG. Do not change, re-slug, or derive a different name.
-   - Assume COLLECTION_SLUG is a slugified version of the repository path
+   - The collection name MUST be the manifest's "collection" value. Do not
+     change, re-slug, or derive a different name.
+   - Assume the collection name is a slugified version of the repository path
      relative to the root directory where the indexing script was invoked,
      with path separators replaced by underscores (for example, "./foo/bar-baz"
      -> "foo_bar-baz").
@@ -95,13 +183,7 @@ Your job is to persist useful long term knowledge about this repo into Chroma.
    - All metadata values MUST be scalars (string/int/float/bool/none). Do not
      use arrays or objects. If you need a list, encode it as a comma-separated
      string.
-   - repo: the repo name (for example: "messagelog", "alloy-compiler").
-   - path: a logical path for the summary (for example: "ROOT" for the
-     repo overview, or "cmd/server", "internal/foo").
-   - kind: one of "repo_overview", "module_summary", "concept".
-   - language: primary language for that module if applicable.
-   - collection: the exact COLLECTION_SLUG used.
-   - tags: optional comma-separated string such as "microservice,cli,database,kafka".
+{{metadata}}
 
    Use whatever fields are supported by the Chroma MCP tools, but preserve
    this intent as closely as possible.
@@ -116,7 +198,8 @@ Your job is to persist useful long term knowledge about this repo into Chroma.
    - Prefer upserts so that re-running this indexing on the same repo will
      refresh the existing knowledge instead of duplicating it.
    - Chunk long summaries into reasonably sized documents if there are tool
-     limits; keep chunks coherent by topic or module.
+     limits (or the manifest's "limits" require it); keep chunks coherent by
+     topic or module.
 
 5) Limits and prioritization
    - Prioritize source code and design documentation over tests and generated
@@ -132,9 +215,134 @@ At the end of this run, output a concise human-readable summary (in the
 terminal) with:
 
 - The repo name you inferred.
-- The Chroma collection name you used (from COLLECTION_SLUG).
+- The Chroma collection name you used (from the manifest).
 - Rough counts of documents written per kind
-  (repo_overview, module_summary, concept).
+  (repo_overview, module_summary, concept, release_snapshot).
 - Any important notes or limitations (for example, directories you skipped
   or areas that need a follow-up indexing pass).
 `
+
+const securityPassPrompt = `Security review. Study how this repo handles:
+- Authentication and authorization: login and token flows, session handling,
+  permission checks, and where they are enforced or skipped.
+- Secrets: how credentials, keys, and tokens are loaded, stored, logged, and
+  passed to other services; note anything hard-coded or committed.
+- Input validation: where untrusted input (HTTP requests, CLI arguments,
+  files, messages, environment) enters and how it is parsed and checked.
+- Dangerous sinks: SQL and shell execution, template rendering,
+  deserialization, file paths, redirects, outbound requests, and crypto.
+
+For each notable area write one "security_concept" document (kind
+"security_concept") describing the mechanism, the code paths involved (file
+and function names), the trust boundaries, and any weaknesses or missing
+checks you observed, stating how confident you are. Do not include secret
+values, and do not try to exploit anything. Also write one
+"security_concept" document with path "ROOT" summarizing the repo's overall
+security posture. Use the usual metadata plus comma-separated "tags" that
+start with "security" and name the areas, for example
+"security,auth,session" or "security,sink,sql".`
+
+// infraPassPrompt is the focus of the --profile infra pass.
+const infraPassPrompt = `Infrastructure summary. Using the manifest's "infra" field, study the
+repo's Terraform modules, Helm charts, Kustomize overlays, and Kubernetes
+manifests. Write one "infra_summary" document (kind "infra_summary") per
+Terraform module, Helm chart, Kustomize base or overlay, and group of
+related Kubernetes manifests, with the directory or file as its path. Cover
+the resources it manages (type and purpose, not every attribute), its
+inputs, outputs, and values, the environments it targets (for example
+workspaces, tfvars files, values-<env>.yaml, or overlays), and how it
+relates to the others: module sources and calls, chart dependencies,
+Kustomize bases, and resources that reference each other. Never record
+secret values. Also write one "infra_summary" document with path "ROOT"
+mapping the environments and how the pieces fit together. Besides the
+usual metadata, set comma-separated "providers" (for example "aws,google"
+or "kubernetes"), "clusters" (cluster or context names, when stated), and
+"environments" (for example "staging,prod") metadata values, and "tags"
+that start with "infra" and name the tool, for example "infra,terraform"
+or "infra,helm".`
+
+// expertisePassPrompt is the focus of the --expertise pass.
+const expertisePassPrompt = `Expertise map. Using the manifest's "expertise" field, write one
+"concept" document per listed directory (path: the directory, or "ROOT" for
+".") describing who has touched what: the directory's purpose in a sentence,
+its contributors in order with their commit counts and last commit dates,
+and the "since" window the counts cover. Record only what the manifest
+lists; do not run git blame or log to find more people, and never record
+email addresses. Replace the previous expertise documents for this repo
+rather than adding to them. Use the usual metadata plus comma-separated
+"tags" that start with "expertise" and name the directory, for example
+"expertise,internal" or "expertise,ROOT". If "expertise" is absent, the
+window had no commits: write nothing.`
+
+// changelogPassPrompt is the focus of the --changelog pass.
+const changelogPassPrompt = `Changelog summary. Using the manifest's "changelog" field, summarize how
+this repo has evolved since "since" so agents have temporal context. Group
+the commits by release tag (commits after the newest tag form an
+"unreleased" group) and, within each group, by theme: features, fixes,
+refactors, dependency and infrastructure changes. Read a commit with git
+show only when its subject is too vague to classify. Write one
+"changelog_summary" document (kind "changelog_summary") per group, with path
+"CHANGELOG/<tag>" or "CHANGELOG/unreleased", naming the period it covers and
+the areas of the code that changed; and one with path "CHANGELOG" giving the
+overall direction of recent work. Replace the previous changelog_summary
+documents for this repo rather than adding to them. Use the usual metadata
+plus comma-separated "tags" that start with "changelog", for example
+"changelog,v1.4.0". If "changelog" is absent, the window had no history:
+write nothing.`
+
+// issuesPassPrompt is the focus of the --github-issues pass.
+const issuesPassPrompt = `Issue context. Read the JSON file named by the manifest's "issues.file"
+and write one "issue_context" document (kind "issue_context") per open issue
+and per merged pull request, with path "ISSUE/<number>" or "PULL/<number>".
+Summarize the problem or change in a few sentences, link it with its "url",
+and name the modules it concerns: for pull requests use their "paths"; for
+issues infer them from the title, body, and labels, and say when you could
+not. Do not copy descriptions verbatim, and leave out anything that looks
+like a secret or personal data. Replace the previous issue_context
+documents for this repo rather than adding to them, so closed issues drop
+out. Use the usual metadata plus comma-separated "tags" that start with
+"issue" or "pull" and list the labels, and a "paths" metadata value listing
+the related directories comma-separated. If "issues" is absent, nothing was
+fetched: write nothing.`
+
+// ciPassPrompt is the focus of the --ci-pipelines pass.
+const ciPassPrompt = `CI/CD pipelines. Read the CI configuration files listed in the manifest's
+"ci" field, following the scripts, Makefile targets, reusable workflows, and
+includes they call, and summarize how this repo is built, tested, and
+deployed. Write one "ci_pipeline" document (kind "ci_pipeline") per
+pipeline or workflow, with path "CI/<file path>", covering its triggers
+(branches, tags, schedules, manual runs), jobs and stages in order, the
+build and test commands, artifacts and images produced, deploy targets and
+environments, required secrets and variables by name only (never values),
+and approval gates. Also write one "ci_pipeline" document with path "CI"
+explaining end to end how a change reaches production. Use the usual
+metadata plus comma-separated "tags" that start with "ci" and name the
+system and stages, for example "ci,github_actions,test,deploy".`
+
+// dataModelPassPrompt is the focus of the --data-model pass.
+const dataModelPassPrompt = `Data model. Using the manifest's "schema" field, work out the repo's
+current database schema: replay the migrations in order (the latest
+migration wins), and read the SQL schema files, Prisma schemas, Ent schemas,
+and the schema files sqlc configs point at. Do not connect to any database.
+Write one "data_model" document (kind "data_model") per table or entity,
+with path "DATA/<table>", listing its columns or fields with types,
+nullability, and defaults, its keys, indexes, and constraints, its
+relationships (foreign keys and edges, with cardinality), and the code that
+reads or writes it. Also write one "data_model" document with path "DATA"
+giving an overview: the databases and schemas involved, the main entities
+and how they relate, and the migration tool and how migrations are run. Use
+the usual metadata plus comma-separated "tables" listing the table names
+the document covers and "tags" that start with "data_model" and name the
+source, for example "data_model,migrations" or "data_model,prisma".`
+
+const evalGradePrompt = `You are grading a code knowledge base. Below are a question about a
+repository, possibly a reference answer, and the documents retrieved from
+the knowledge base for the question. Do not run commands or read files: use
+only the retrieved documents.
+
+First answer the question from the documents alone. Then score from 0 to 1
+how well the documents support a complete and correct answer: 1 when they
+fully answer it (agreeing with the reference answer, when given), 0 when they
+are irrelevant or contradict it. End your reply with a final line of the form
+"SCORE: <number>", for example "SCORE: 0.7".
+`
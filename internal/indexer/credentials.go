@@ -0,0 +1,230 @@
+package indexer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const defaultTokenUsername = "x-access-token"
+
+// CredentialConfig describes how to authenticate git network operations
+// against one host. Exactly one mechanism is normally set.
+type CredentialConfig struct {
+	// TokenEnv names an environment variable holding an HTTPS access token.
+	TokenEnv string `json:"token_env,omitempty"`
+	// Username accompanies the token; defaults to "x-access-token".
+	Username string `json:"username,omitempty"`
+	// SSHKey is a private key path used via GIT_SSH_COMMAND.
+	SSHKey string `json:"ssh_key,omitempty"`
+	// Helper is a git credential helper scoped to the host.
+	Helper string `json:"helper,omitempty"`
+}
+
+// resolvedCredential is a CredentialConfig bound to a host with its secret
+// looked up.
+type resolvedCredential struct {
+	host   string
+	user   string
+	token  string
+	sshKey string
+	helper string
+}
+
+func (c *Config) credentialFor(host string) (*CredentialConfig, bool) {
+	if c == nil || host == "" {
+		return nil, false
+	}
+	for key, cred := range c.Credentials {
+		if strings.EqualFold(key, host) {
+			return &cred, true
+		}
+	}
+	return nil, false
+}
+
+func resolveCredential(host string, cfg *CredentialConfig) (*resolvedCredential, error) {
+	sshKey, err := expandHome(cfg.SSHKey)
+	if err != nil {
+		return nil, fmt.Errorf("credential for %s: %w", host, err)
+	}
+
+	rc := &resolvedCredential{
+		host:   host,
+		user:   cfg.Username,
+		sshKey: sshKey,
+		helper: cfg.Helper,
+	}
+	if cfg.TokenEnv != "" {
+		rc.token = os.Getenv(cfg.TokenEnv)
+		if rc.token == "" {
+			return nil, fmt.Errorf("credential for %s: environment variable %s is empty", host, cfg.TokenEnv)
+		}
+		if rc.user == "" {
+			rc.user = defaultTokenUsername
+		}
+	}
+	return rc, nil
+}
+
+// env renders the credential as GIT_CONFIG_* and GIT_SSH_COMMAND entries so
+// secrets never appear on a command line. Its GIT_CONFIG entries are numbered
+// after any the environment already sets, which git keeps applying.
+func (rc *resolvedCredential) env() []string {
+	if rc == nil {
+		return nil
+	}
+
+	var (
+		keys   []string
+		values []string
+	)
+	if rc.token != "" {
+		basic := base64.StdEncoding.EncodeToString([]byte(rc.user + ":" + rc.token))
+		keys = append(keys, "http.https://"+rc.host+"/.extraHeader")
+		values = append(values, "Authorization: Basic "+basic)
+	}
+	if rc.helper != "" {
+		keys = append(keys, "credential.https://"+rc.host+".helper")
+		values = append(values, rc.helper)
+	}
+
+	var out []string
+	if len(keys) > 0 {
+		base, err := strconv.Atoi(os.Getenv("GIT_CONFIG_COUNT"))
+		if err != nil || base < 0 {
+			base = 0
+		}
+		out = append(out, "GIT_CONFIG_COUNT="+strconv.Itoa(base+len(keys)))
+		for i := range keys {
+			out = append(out,
+				fmt.Sprintf("GIT_CONFIG_KEY_%d=%s", base+i, keys[i]),
+				fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", base+i, values[i]),
+			)
+		}
+	}
+	if rc.sshKey != "" {
+		out = append(out, "GIT_SSH_COMMAND=ssh -i "+shellQuote(rc.sshKey)+" -o IdentitiesOnly=yes")
+	}
+	return out
+}
+
+// secrets returns the values that must never be printed.
+func (rc *resolvedCredential) secrets() []string {
+	if rc == nil || rc.token == "" {
+		return nil
+	}
+	basic := base64.StdEncoding.EncodeToString([]byte(rc.user + ":" + rc.token))
+	return []string{rc.token, basic}
+}
+
+// describe summarizes the credential without revealing secrets.
+func (rc *resolvedCredential) describe() string {
+	var parts []string
+	if rc.token != "" {
+		parts = append(parts, "token")
+	}
+	if rc.sshKey != "" {
+		parts = append(parts, "ssh key "+rc.sshKey)
+	}
+	if rc.helper != "" {
+		parts = append(parts, "helper "+rc.helper)
+	}
+	return rc.host + " (" + strings.Join(parts, ", ") + ")"
+}
+
+// expandHome replaces a leading "~/" with the user's home directory.
+func expandHome(path string) (string, error) {
+	rest, ok := strings.CutPrefix(path, "~/")
+	if !ok {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("expand %s: %w", path, err)
+	}
+	return filepath.Join(home, rest), nil
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// remoteHost extracts the host from https://, ssh://, and scp-style
+// (git@host:path) remote URLs.
+func remoteHost(remote string) string {
+	remote = strings.TrimSpace(remote)
+	if remote == "" {
+		return ""
+	}
+	if strings.Contains(remote, "://") {
+		u, err := url.Parse(remote)
+		if err != nil {
+			return ""
+		}
+		return u.Hostname()
+	}
+	hostPart, _, ok := strings.Cut(remote, ":")
+	if !ok || strings.Contains(hostPart, "/") {
+		return ""
+	}
+	if _, host, found := strings.Cut(hostPart, "@"); found {
+		return host
+	}
+	return hostPart
+}
+
+// redactURL strips any password from URL userinfo.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	if _, hasPassword := u.User.Password(); !hasPassword {
+		return raw
+	}
+	u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	return u.String()
+}
+
+// stripURLCredentials removes userinfo from http(s) URLs so remotes can be
+// stored and shared. Other URL forms are returned unchanged.
+func stripURLCredentials(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return raw
+	}
+	u.User = nil
+	return u.String()
+}
+
+// secretMasker replaces registered secret values in log and result text.
+type secretMasker struct {
+	secrets []string
+	mu      sync.RWMutex
+}
+
+func (m *secretMasker) add(values ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, v := range values {
+		if v != "" && !slices.Contains(m.secrets, v) {
+			m.secrets = append(m.secrets, v)
+		}
+	}
+}
+
+func (m *secretMasker) mask(s string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, secret := range m.secrets {
+		s = strings.ReplaceAll(s, secret, "*****")
+	}
+	return s
+}
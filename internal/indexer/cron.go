@@ -0,0 +1,145 @@
+package indexer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronFields names the fields of a cron expression and their ranges. Day of
+// week 7 is Sunday, like 0.
+var cronFields = [5]struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// cronMacros are the shorthand schedules crontab(5) accepts.
+var cronMacros = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+}
+
+// cronSchedule is a parsed five-field cron expression: minute, hour, day
+// of month, month, and day of week, each a bit set of matching values.
+type cronSchedule struct {
+	fields [5]uint64
+	// anyDOM and anyDOW are set when a day field starts with "*". When
+	// both are restricted, a day matching either runs, as in cron.
+	anyDOM, anyDOW bool
+}
+
+// parseCron parses a crontab(5) expression: five fields of numbers, "*",
+// lists, ranges, and steps, or a macro such as @daily. Month and weekday
+// names are not supported.
+func parseCron(expr string) (*cronSchedule, error) {
+	spec := strings.TrimSpace(expr)
+	if macro, ok := cronMacros[spec]; ok {
+		spec = macro
+	}
+	parts := strings.Fields(spec)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("cron expression %q: want 5 fields (minute hour day-of-month month day-of-week), got %d",
+			expr, len(parts))
+	}
+
+	var s cronSchedule
+	for i, part := range parts {
+		bits, err := parseCronField(part, cronFields[i].min, cronFields[i].max)
+		if err != nil {
+			return nil, fmt.Errorf("cron expression %q: %s: %w", expr, cronFields[i].name, err)
+		}
+		s.fields[i] = bits
+	}
+	if s.fields[4]&(1<<7) != 0 {
+		s.fields[4] |= 1
+	}
+	s.anyDOM = strings.HasPrefix(parts[2], "*")
+	s.anyDOW = strings.HasPrefix(parts[4], "*")
+	return &s, nil
+}
+
+// parseCronField returns the values field matches between lo and hi as a
+// bit set.
+func parseCronField(field string, lo, hi int) (uint64, error) {
+	var bits uint64
+	for item := range strings.SplitSeq(field, ",") {
+		span, stepText, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepText)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step %q", stepText)
+			}
+			step = n
+		}
+
+		start, end := lo, hi
+		if span != "*" {
+			first, last, isRange := strings.Cut(span, "-")
+			var err error
+			if start, err = strconv.Atoi(first); err != nil {
+				return 0, fmt.Errorf("invalid value %q", first)
+			}
+			switch {
+			case isRange:
+				if end, err = strconv.Atoi(last); err != nil {
+					return 0, fmt.Errorf("invalid value %q", last)
+				}
+			case !hasStep:
+				// "5/15" runs from 5 to the end of the range.
+				end = start
+			}
+		}
+		if start < lo || end > hi || start > end {
+			return 0, fmt.Errorf("%q is outside %d-%d", item, lo, hi)
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// next returns the first minute after t the schedule matches, in t's
+// location, or the zero time when none comes within five years, as for
+// "0 0 30 2 *".
+func (s *cronSchedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.fields[3]&(1<<int(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.fields[1]&(1<<t.Hour()) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case s.fields[0]&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.fields[2]&(1<<t.Day()) != 0
+	dow := s.fields[4]&(1<<int(t.Weekday())) != 0
+	if s.anyDOM || s.anyDOW {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,66 @@
+package indexer
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := map[string]struct {
+		expr    string
+		wantErr string
+	}{
+		"daily":           {expr: "0 3 * * *"},
+		"macro":           {expr: "@weekly"},
+		"lists and steps": {expr: "*/15 9-17 1,15 */2 1-5"},
+		"sunday as 7":     {expr: "0 0 * * 7"},
+		"too few fields":  {expr: "0 3 * *", wantErr: "want 5 fields"},
+		"out of range":    {expr: "60 * * * *", wantErr: "minute"},
+		"bad step":        {expr: "*/0 * * * *", wantErr: "invalid step"},
+		"reversed range":  {expr: "0 5-2 * * *", wantErr: "hour"},
+		"names":           {expr: "0 0 * JAN *", wantErr: "month"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseCron(tc.expr)
+			if tc.wantErr == "" && err != nil || tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+				t.Fatalf("expected error %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// Friday, 2026-01-02 10:30:45 UTC.
+	from := time.Date(2026, 1, 2, 10, 30, 45, 0, time.UTC)
+	tests := map[string]struct {
+		expr string
+		want time.Time
+	}{
+		"later today":       {expr: "45 10 * * *", want: time.Date(2026, 1, 2, 10, 45, 0, 0, time.UTC)},
+		"tomorrow":          {expr: "0 3 * * *", want: time.Date(2026, 1, 3, 3, 0, 0, 0, time.UTC)},
+		"next minute":       {expr: "* * * * *", want: time.Date(2026, 1, 2, 10, 31, 0, 0, time.UTC)},
+		"step":              {expr: "*/20 * * * *", want: time.Date(2026, 1, 2, 10, 40, 0, 0, time.UTC)},
+		"weekday":           {expr: "0 9 * * 1", want: time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)},
+		"sunday as 7":       {expr: "0 9 * * 7", want: time.Date(2026, 1, 4, 9, 0, 0, 0, time.UTC)},
+		"day or weekday":    {expr: "0 0 10 * 6", want: time.Date(2026, 1, 3, 0, 0, 0, 0, time.UTC)},
+		"next month":        {expr: "0 0 1 * *", want: time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)},
+		"leap day":          {expr: "0 0 29 2 *", want: time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		"never":             {expr: "0 0 30 2 *"},
+		"step from a start": {expr: "5/30 * * * *", want: time.Date(2026, 1, 2, 10, 35, 0, 0, time.UTC)},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			s, err := parseCron(tc.expr)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if got := s.next(from); !got.Equal(tc.want) {
+				t.Fatalf("expected %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,387 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DaemonOptions configures RunDaemon.
+type DaemonOptions struct {
+	// Schedule is the cron expression, in local time, of when sweeps of the
+	// repos selected by the run's options start; empty runs only
+	// TagSchedules.
+	Schedule string
+	// TagSchedules maps a config tag to the cron expression of sweeps of
+	// only the repos with that tag, so tiers of repos can be indexed at
+	// different rates.
+	TagSchedules map[string]string
+	// StatePath is the JSON file the daemon's state is kept in across
+	// restarts; empty keeps it in memory.
+	StatePath string
+	// Addr, when set, serves the state at GET /status, a liveness check at
+	// GET /healthz, and POST /pause and /resume, which hold back and let go
+	// the repos of sweeps as SIGUSR1 and SIGUSR2 do.
+	Addr string
+}
+
+// daemonStatus is what the daemon persists to DaemonOptions.StatePath and
+// serves at /status.
+type daemonStatus struct {
+	StartedAt time.Time `json:"started_at"`
+	// Paused is set while new repos are held back, by POST /pause or by
+	// SIGUSR1 to a sweep. A restarted daemon starts resumed.
+	Paused bool `json:"paused"`
+	// Schedules are the states of Schedule, when set, and then of each tag
+	// schedule in tag order.
+	Schedules []*daemonState `json:"schedules"`
+}
+
+// daemonState is the state of one schedule.
+type daemonState struct {
+	// Tag is the tag the schedule sweeps; empty sweeps the repos the run's
+	// options select.
+	Tag string `json:"tag,omitempty"`
+	// NextRun is when the next sweep starts. A daemon restarted once it has
+	// passed sweeps at once, so downtime does not skip a sweep.
+	NextRun *time.Time `json:"next_run,omitempty"`
+	// RunningSince is set while a sweep runs.
+	RunningSince *time.Time `json:"running_since,omitempty"`
+	LastRun      *daemonRun `json:"last_run,omitempty"`
+	LastSuccess  *time.Time `json:"last_success,omitempty"`
+	Schedule     string     `json:"schedule"`
+	// Runs counts sweeps since the state file was created.
+	Runs                int `json:"runs"`
+	ConsecutiveFailures int `json:"consecutive_failures"`
+}
+
+// name describes the schedule's sweeps in logs.
+func (s *daemonState) name() string {
+	if s.Tag == "" {
+		return "sweep"
+	}
+	return "sweep of tag " + s.Tag
+}
+
+// daemonRun summarizes one sweep.
+type daemonRun struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Error      string    `json:"error,omitempty"`
+	Repos      int       `json:"repos"`
+	Indexed    int       `json:"indexed"`
+	Skipped    int       `json:"skipped"`
+	Failed     int       `json:"failed"`
+}
+
+// daemon re-runs sweeps on one or more schedules.
+type daemon struct {
+	w io.Writer
+	// sweep runs one indexing sweep, of the repos with tag when it is set;
+	// RunDaemon uses RunResults.
+	sweep func(tag string) ([]RepoResult, error)
+	now   func() time.Time
+	path  string
+	// pause is shared by every sweep, so a pause outlasts the sweep it was
+	// requested in.
+	pause *pauseGate
+	// scheds are the parsed schedules of status.Schedules, by index.
+	scheds []*cronSchedule
+	status daemonStatus
+	mu     sync.Mutex
+}
+
+// RunDaemon runs an indexing sweep with opts every time one of dopts'
+// schedules fires until ctx is done, persisting its state between sweeps
+// and restarts. A sweep in progress when ctx is done runs to completion. A
+// failed sweep is logged and recorded; the daemon keeps going.
+func RunDaemon(ctx context.Context, w io.Writer, opts Options, dopts DaemonOptions) error {
+	var d *daemon
+	sweep := func(tag string) ([]RepoResult, error) {
+		sweepOpts := opts
+		sweepOpts.pause = d.pause
+		if tag != "" {
+			sweepOpts.Tags = []string{tag}
+		}
+		return RunResults(sweepOpts)
+	}
+	d, err := newDaemon(w, dopts, sweep)
+	if err != nil {
+		return err
+	}
+	if dopts.StatePath != "" {
+		key, err := filepath.Abs(dopts.StatePath)
+		if err != nil {
+			return fmt.Errorf("resolve daemon state path: %w", err)
+		}
+		lock, err := acquireRunLock("daemon state", key)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = lock.Release() }()
+		if err := d.load(); err != nil {
+			return err
+		}
+	}
+
+	if dopts.Addr != "" {
+		ln, err := net.Listen("tcp", dopts.Addr)
+		if err != nil {
+			return fmt.Errorf("listen for daemon status: %w", err)
+		}
+		srv := &http.Server{Handler: d.handler(), ReadHeaderTimeout: 10 * time.Second}
+		go func() { _ = srv.Serve(ln) }()
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_ = srv.Shutdown(shutdownCtx)
+		}()
+		logf(w, "Daemon status at http://%s/status\n", ln.Addr())
+	}
+	return d.loop(ctx)
+}
+
+// newDaemon parses dopts' schedules. Its state starts empty; load restores
+// the state persisted at dopts.StatePath.
+func newDaemon(w io.Writer, dopts DaemonOptions, sweep func(tag string) ([]RepoResult, error)) (*daemon, error) {
+	d := &daemon{w: w, sweep: sweep, now: time.Now, path: dopts.StatePath, pause: &pauseGate{}}
+	add := func(tag, expr string) error {
+		sched, err := parseCron(expr)
+		if err != nil {
+			return err
+		}
+		d.scheds = append(d.scheds, sched)
+		d.status.Schedules = append(d.status.Schedules, &daemonState{Tag: tag, Schedule: expr})
+		return nil
+	}
+	if dopts.Schedule != "" {
+		if err := add("", dopts.Schedule); err != nil {
+			return nil, err
+		}
+	}
+	for _, tag := range slices.Sorted(maps.Keys(dopts.TagSchedules)) {
+		if err := validateTag(tag); err != nil {
+			return nil, fmt.Errorf("tag schedule: %w", err)
+		}
+		if err := add(tag, dopts.TagSchedules[tag]); err != nil {
+			return nil, fmt.Errorf("schedule of tag %s: %w", tag, err)
+		}
+	}
+	if len(d.scheds) == 0 {
+		return nil, errors.New("daemon needs a schedule or a tag schedule")
+	}
+	d.status.StartedAt = d.now().UTC()
+	return d, nil
+}
+
+// load restores each schedule's state from the state file, if any. A sweep
+// that was running when the last daemon stopped is reported and its next
+// run kept, so it runs again at once. A schedule whose expression changed
+// starts over.
+func (d *daemon) load() error {
+	data, err := os.ReadFile(d.path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return nil
+	case err != nil:
+		return fmt.Errorf("read daemon state: %w", err)
+	}
+	var saved daemonStatus
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("parse daemon state %s: %w", d.path, err)
+	}
+
+	for i, st := range d.status.Schedules {
+		j := slices.IndexFunc(saved.Schedules, func(s *daemonState) bool { return s != nil && s.Tag == st.Tag })
+		if j < 0 {
+			continue
+		}
+		prev := saved.Schedules[j]
+		if prev.RunningSince != nil {
+			logf(d.w, "The %s started at %s did not finish; sweeping again\n",
+				prev.name(), prev.RunningSince.Format(time.RFC3339))
+			prev.NextRun = prev.RunningSince
+			prev.RunningSince = nil
+		}
+		if prev.Schedule != st.Schedule {
+			// A new schedule replaces the old one's next run.
+			prev.NextRun = nil
+			prev.Schedule = st.Schedule
+		}
+		d.status.Schedules[i] = prev
+	}
+	return nil
+}
+
+// loop runs whichever schedule is due next until ctx is done. Sweeps never
+// overlap: one that overruns another schedule's time delays that sweep
+// until it finishes, and a schedule's missed times are skipped.
+func (d *daemon) loop(ctx context.Context) error {
+	for {
+		d.mu.Lock()
+		due := -1
+		for i, st := range d.status.Schedules {
+			if st.NextRun == nil {
+				at := d.scheds[i].next(d.now())
+				if at.IsZero() {
+					d.mu.Unlock()
+					return fmt.Errorf("schedule %q never fires", st.Schedule)
+				}
+				at = at.UTC()
+				st.NextRun = &at
+			}
+			if due < 0 || st.NextRun.Before(*d.status.Schedules[due].NextRun) {
+				due = i
+			}
+		}
+		st := d.status.Schedules[due]
+		next, name := *st.NextRun, st.name()
+		err := d.save()
+		d.mu.Unlock()
+		if err != nil {
+			return err
+		}
+
+		if wait := next.Sub(d.now()); wait > 0 {
+			logf(d.w, "Next %s at %s\n", name, next.Local().Format(time.RFC3339))
+			if err := sleepCtx(ctx, wait); err != nil {
+				return nil
+			}
+		} else {
+			logf(d.w, "The %s scheduled for %s was missed; sweeping now\n", name, next.Local().Format(time.RFC3339))
+		}
+		if err := d.runSweep(due); err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// runSweep runs one sweep of schedule i and records its outcome.
+func (d *daemon) runSweep(i int) error {
+	started := d.now().UTC()
+	d.mu.Lock()
+	st := d.status.Schedules[i]
+	st.RunningSince = &started
+	st.NextRun = nil
+	tag, name := st.Tag, st.name()
+	err := d.save()
+	d.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	results, sweepErr := d.sweep(tag)
+	run := &daemonRun{StartedAt: started, FinishedAt: d.now().UTC(), Repos: len(results)}
+	for _, r := range results {
+		var skipped *Skipped
+		switch {
+		case r.Err == nil:
+			run.Indexed++
+		case errors.As(r.Err, &skipped):
+			run.Skipped++
+		default:
+			run.Failed++
+		}
+	}
+	if sweepErr != nil {
+		run.Error = sweepErr.Error()
+		logf(d.w, "The %s failed: %v\n", name, sweepErr)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	st.RunningSince = nil
+	st.LastRun = run
+	st.Runs++
+	if at := d.scheds[i].next(d.now()); !at.IsZero() {
+		at = at.UTC()
+		st.NextRun = &at
+	}
+	if sweepErr == nil {
+		st.LastSuccess = &run.FinishedAt
+		st.ConsecutiveFailures = 0
+	} else {
+		st.ConsecutiveFailures++
+	}
+	return d.save()
+}
+
+// save writes the state file; the caller holds d.mu.
+func (d *daemon) save() error {
+	if d.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(d.status, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode daemon state: %w", err)
+	}
+	if err := writeFileSynced(d.path, data, 0o600); err != nil {
+		return fmt.Errorf("write daemon state: %w", err)
+	}
+	return nil
+}
+
+// setPaused pauses or resumes the repos of sweeps, logging and saving a
+// change.
+func (d *daemon) setPaused(paused bool) error {
+	switch {
+	case paused && d.pause.pause():
+		logf(d.w, "Paused: repos in progress will finish, no new repos will start\n")
+	case !paused && d.pause.resume():
+		logf(d.w, "Resumed\n")
+	default:
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.status.Paused = paused
+	return d.save()
+}
+
+// handler serves the daemon's state and pause controls. /pause and
+// /resume answer with the state, like /status.
+func (d *daemon) handler() http.Handler {
+	mux := http.NewServeMux()
+	status := func(w http.ResponseWriter) {
+		d.mu.Lock()
+		// SIGUSR1 and SIGUSR2 to a sweep drive the same gate.
+		d.status.Paused = d.pause.paused()
+		data, err := json.MarshalIndent(d.status, "", "  ")
+		d.mu.Unlock()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(append(data, '\n'))
+	}
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, _ *http.Request) {
+		status(w)
+	})
+	for path, paused := range map[string]bool{"POST /pause": true, "POST /resume": false} {
+		mux.HandleFunc(path, func(w http.ResponseWriter, _ *http.Request) {
+			if err := d.setPaused(paused); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			status(w)
+		})
+	}
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "ok\n")
+	})
+	return mux
+}
@@ -0,0 +1,239 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDaemonSweepsMissedRun(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "daemon.json")
+	past := time.Now().Add(-time.Hour).UTC()
+	tests := map[string]struct {
+		state        daemonState
+		sweepErr     error
+		wantFailures int
+	}{
+		"next run passed": {state: daemonState{Schedule: "@daily", NextRun: &past, Runs: 4}},
+		"interrupted":     {state: daemonState{Schedule: "@daily", RunningSince: &past, Runs: 4}},
+		"failed sweep": {
+			state:        daemonState{Schedule: "@daily", NextRun: &past, Runs: 4, ConsecutiveFailures: 1},
+			sweepErr:     errors.New("run lock held"),
+			wantFailures: 2,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			data, _ := json.Marshal(daemonStatus{Schedules: []*daemonState{&tc.state}})
+			if err := os.WriteFile(statePath, data, 0o600); err != nil {
+				t.Fatalf("write state: %v", err)
+			}
+			ctx, cancel := context.WithCancel(t.Context())
+			defer cancel()
+			sweeps := 0
+			d, err := newDaemon(io.Discard, DaemonOptions{Schedule: "@daily", StatePath: statePath},
+				func(string) ([]RepoResult, error) {
+					sweeps++
+					cancel()
+					return []RepoResult{
+						{},
+						{Err: &Skipped{Reason: SkipReasonCacheHit}},
+						{Err: errors.New("codex failed")},
+					}, tc.sweepErr
+				})
+			if err != nil {
+				t.Fatalf("new daemon: %v", err)
+			}
+			if err := d.load(); err != nil {
+				t.Fatalf("load state: %v", err)
+			}
+			if err := d.loop(ctx); err != nil {
+				t.Fatalf("loop: %v", err)
+			}
+			if sweeps != 1 {
+				t.Fatalf("expected the missed sweep to run at once, got %d sweeps", sweeps)
+			}
+
+			got := readDaemonStatus(t, statePath)
+			if len(got.Schedules) != 1 {
+				t.Fatalf("expected one schedule, got %+v", got)
+			}
+			st := got.Schedules[0]
+			run := st.LastRun
+			if st.Runs != 5 || run == nil || run.Repos != 3 || run.Indexed != 1 || run.Skipped != 1 || run.Failed != 1 {
+				t.Fatalf("unexpected state %+v", st)
+			}
+			if st.RunningSince != nil || st.NextRun == nil || !st.NextRun.After(time.Now()) {
+				t.Fatalf("expected the next run scheduled, got %+v", st)
+			}
+			if st.ConsecutiveFailures != tc.wantFailures || (tc.sweepErr == nil) != (st.LastSuccess != nil) {
+				t.Fatalf("unexpected failure tracking %+v", st)
+			}
+		})
+	}
+}
+
+func TestDaemonTagSchedules(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "daemon.json")
+	past := time.Now().Add(-time.Hour).UTC()
+	saved := daemonStatus{Schedules: []*daemonState{
+		{Schedule: "@weekly", NextRun: &past, Runs: 2},
+		{Tag: "critical", Schedule: "0 6 * * *", NextRun: &past, Runs: 9},
+		{Tag: "legacy", Schedule: "@monthly", Runs: 1},
+	}}
+	data, _ := json.Marshal(saved)
+	if err := os.WriteFile(statePath, data, 0o600); err != nil {
+		t.Fatalf("write state: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	var swept []string
+	dopts := DaemonOptions{
+		Schedule:     "@weekly",
+		TagSchedules: map[string]string{"critical": "0 6 * * *", "docs": "@daily"},
+		StatePath:    statePath,
+	}
+	d, err := newDaemon(io.Discard, dopts, func(tag string) ([]RepoResult, error) {
+		swept = append(swept, tag)
+		if len(swept) == 2 {
+			cancel()
+		}
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatalf("new daemon: %v", err)
+	}
+	if err := d.load(); err != nil {
+		t.Fatalf("load state: %v", err)
+	}
+	if err := d.loop(ctx); err != nil {
+		t.Fatalf("loop: %v", err)
+	}
+	if !slices.Equal(swept, []string{"", "critical"}) {
+		t.Fatalf("expected both missed sweeps to run in turn, got %q", swept)
+	}
+
+	got := readDaemonStatus(t, statePath)
+	var tags []string
+	for _, st := range got.Schedules {
+		tags = append(tags, st.Tag)
+	}
+	if !slices.Equal(tags, []string{"", "critical", "docs"}) {
+		t.Fatalf("expected the configured schedules only, got %q", tags)
+	}
+	if got.Schedules[1].Runs != 10 || got.Schedules[2].Runs != 0 || got.Schedules[2].NextRun == nil {
+		t.Fatalf("unexpected tag schedule states %+v %+v", got.Schedules[1], got.Schedules[2])
+	}
+}
+
+func TestNewDaemonRejects(t *testing.T) {
+	tests := map[string]struct {
+		dopts   DaemonOptions
+		wantErr string
+	}{
+		"no schedule":  {wantErr: "needs a schedule"},
+		"bad tag cron": {dopts: DaemonOptions{TagSchedules: map[string]string{"critical": "6 * *"}}, wantErr: "critical"},
+		"bad tag":      {dopts: DaemonOptions{TagSchedules: map[string]string{"a,b": "@daily"}}, wantErr: "invalid tag"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := newDaemon(io.Discard, tc.dopts, nil); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func readDaemonStatus(t *testing.T, path string) daemonStatus {
+	t.Helper()
+	var got daemonStatus
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read state: %v", err)
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("decode state: %v", err)
+	}
+	return got
+}
+
+func TestDaemonStatus(t *testing.T) {
+	d, err := newDaemon(io.Discard, DaemonOptions{Schedule: "0 3 * * *"}, nil)
+	if err != nil {
+		t.Fatalf("new daemon: %v", err)
+	}
+	d.status.Schedules[0].Runs = 7
+	srv := httptest.NewServer(d.handler())
+	t.Cleanup(srv.Close)
+
+	resp, err := http.Get(srv.URL + "/status")
+	if err != nil {
+		t.Fatalf("get status: %v", err)
+	}
+	defer resp.Body.Close()
+	var got daemonStatus
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decode status: %v", err)
+	}
+	if len(got.Schedules) != 1 || got.Schedules[0].Schedule != "0 3 * * *" || got.Schedules[0].Runs != 7 ||
+		got.StartedAt.IsZero() {
+		t.Fatalf("unexpected status %+v", got)
+	}
+
+	for _, step := range []struct {
+		path   string
+		paused bool
+	}{{"/pause", true}, {"/pause", true}, {"/resume", false}} {
+		resp, err := http.Post(srv.URL+step.path, "", nil)
+		if err != nil {
+			t.Fatalf("post %s: %v", step.path, err)
+		}
+		var got daemonStatus
+		err = json.NewDecoder(resp.Body).Decode(&got)
+		_ = resp.Body.Close()
+		if err != nil || got.Paused != step.paused || d.pause.paused() != step.paused {
+			t.Fatalf("expected paused=%t after %s, got %+v (%v)", step.paused, step.path, got, err)
+		}
+	}
+	// A sweep paused by SIGUSR1 shares the gate.
+	d.pause.pause()
+	resp, err = http.Get(srv.URL + "/status")
+	if err != nil {
+		t.Fatalf("get status: %v", err)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&got)
+	_ = resp.Body.Close()
+	if err != nil || !got.Paused {
+		t.Fatalf("expected the pause reported, got %+v (%v)", got, err)
+	}
+	resp, err = http.Get(srv.URL + "/pause")
+	if err != nil {
+		t.Fatalf("get pause: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("expected GET /pause rejected, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(srv.URL + "/healthz")
+	if err != nil {
+		t.Fatalf("get healthz: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || strings.TrimSpace(string(body)) != "ok" {
+		t.Fatalf("unexpected healthz %d %q", resp.StatusCode, body)
+	}
+}
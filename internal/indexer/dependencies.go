@@ -0,0 +1,499 @@
+package indexer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Dependency ecosystems reported by --dependencies.
+const (
+	ecosystemGo   = "go"
+	ecosystemNPM  = "npm"
+	ecosystemPyPI = "pypi"
+)
+
+const (
+	// dependenciesDocumentID is the id Codex upserts the inventory under.
+	dependenciesDocumentID = "dependencies"
+	// dependenciesMax caps the dependencies listed in the inventory.
+	dependenciesMax = 500
+	// licenseUnknown marks a dependency whose license was not found locally.
+	licenseUnknown = "unknown"
+	// licenseScanBytes is how much of a license file is classified.
+	licenseScanBytes = 8192
+)
+
+// dependency is one direct dependency declared by a manifest file.
+type dependency struct {
+	Name      string
+	Version   string
+	License   string
+	Ecosystem string
+	// Manifest is the repo-relative file that declares it.
+	Manifest string
+	// Dev marks npm devDependencies.
+	Dev bool
+}
+
+// dependencyDocument is the generated inventory Codex upserts verbatim.
+type dependencyDocument struct {
+	Metadata map[string]any `json:"metadata"`
+	ID       string         `json:"id"`
+	Document string         `json:"document"`
+}
+
+// manifestDependencies points Codex at the generated inventory.
+type manifestDependencies struct {
+	// File is a JSON file with "id", "document", and "metadata"; manifest.write
+	// fills it in.
+	File  string `json:"file"`
+	Count int    `json:"count"`
+}
+
+// collectDependencies reads the direct dependencies declared by the repo's
+// tracked go.mod, package.json, and requirements*.txt files, with licenses
+// found in the local module cache or node_modules. It returns nil when there
+// are none or git fails.
+func collectDependencies(ctx context.Context, repoDir string) []dependency {
+	names, err := trackedFiles(ctx, repoDir)
+	if err != nil {
+		return nil
+	}
+
+	var deps []dependency
+	for _, name := range names {
+		if strings.HasPrefix(name, "vendor/") || strings.Contains(name, "/vendor/") ||
+			strings.Contains(name, "testdata/") || strings.Contains(name, "node_modules/") {
+			continue
+		}
+		base := path.Base(name)
+		var parse func([]byte) []dependency
+		switch {
+		case base == "go.mod":
+			parse = parseGoMod
+		case base == "package.json":
+			parse = parsePackageJSON
+		case strings.HasPrefix(base, "requirements") && path.Ext(base) == ".txt":
+			parse = parseRequirements
+		default:
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(repoDir, filepath.FromSlash(name)))
+		if err != nil {
+			continue
+		}
+		for _, dep := range parse(data) {
+			dep.Manifest = name
+			dep.License = findLicense(repoDir, path.Dir(name), dep)
+			deps = append(deps, dep)
+		}
+	}
+	if len(deps) > dependenciesMax {
+		deps = deps[:dependenciesMax]
+	}
+	return deps
+}
+
+// parseGoMod returns the requirements of a go.mod that are not marked
+// "// indirect".
+func parseGoMod(data []byte) []dependency {
+	var deps []dependency
+	inBlock := false
+	for line := range strings.Lines(string(data)) {
+		line = strings.TrimSpace(line)
+		if strings.Contains(line, "// indirect") {
+			continue
+		}
+		line, _, _ = strings.Cut(line, "//")
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+			continue
+		case inBlock && fields[0] == ")":
+			inBlock = false
+			continue
+		case fields[0] == "require" && len(fields) == 2 && fields[1] == "(":
+			inBlock = true
+			continue
+		case fields[0] == "require":
+			fields = fields[1:]
+		case !inBlock:
+			continue
+		}
+		if len(fields) >= 2 {
+			deps = append(deps, dependency{Name: unquote(fields[0]), Version: fields[1], Ecosystem: ecosystemGo})
+		}
+	}
+	return deps
+}
+
+// parsePackageJSON returns a package.json's dependencies and
+// devDependencies, each sorted by name.
+func parsePackageJSON(data []byte) []dependency {
+	var pkg struct {
+		Dependencies    map[string]string `json:"dependencies"`
+		DevDependencies map[string]string `json:"devDependencies"`
+	}
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return nil
+	}
+	var deps []dependency
+	for _, set := range []struct {
+		versions map[string]string
+		dev      bool
+	}{{pkg.Dependencies, false}, {pkg.DevDependencies, true}} {
+		for _, name := range slices.Sorted(maps.Keys(set.versions)) {
+			deps = append(deps, dependency{
+				Name:      name,
+				Version:   set.versions[name],
+				Ecosystem: ecosystemNPM,
+				Dev:       set.dev,
+			})
+		}
+	}
+	return deps
+}
+
+// parseRequirements returns the packages of a pip requirements file,
+// skipping comments, options such as -r, and URLs.
+func parseRequirements(data []byte) []dependency {
+	var deps []dependency
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		line, _, _ = strings.Cut(line, ";")
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "-") || strings.Contains(line, "://") {
+			continue
+		}
+		i := strings.IndexFunc(line, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("-_.[]", r)
+		})
+		name, version := line, ""
+		if i >= 0 {
+			name, version = line[:i], strings.TrimSpace(line[i:])
+		}
+		name, _, _ = strings.Cut(name, "[")
+		deps = append(deps, dependency{Name: name, Version: version, Ecosystem: ecosystemPyPI})
+	}
+	return deps
+}
+
+func unquote(s string) string {
+	if u, err := strconv.Unquote(s); err == nil {
+		return u
+	}
+	return s
+}
+
+// findLicense classifies dep's license file from the Go module cache or
+// the node_modules next to its package.json. PyPI licenses are not
+// available locally and are reported as unknown.
+func findLicense(repoDir, manifestDir string, dep dependency) string {
+	var dir string
+	switch dep.Ecosystem {
+	case ecosystemGo:
+		cache := goModCache()
+		if cache == "" {
+			return licenseUnknown
+		}
+		dir = filepath.Join(cache, escapeModulePath(dep.Name)+"@"+escapeModulePath(dep.Version))
+	case ecosystemNPM:
+		dir = filepath.Join(repoDir, filepath.FromSlash(manifestDir), "node_modules", filepath.FromSlash(dep.Name))
+		if license := npmLicense(filepath.Join(dir, "package.json")); license != "" {
+			return license
+		}
+	default:
+		return licenseUnknown
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return licenseUnknown
+	}
+	for _, e := range entries {
+		upper := strings.ToUpper(e.Name())
+		if e.IsDir() || !(strings.HasPrefix(upper, "LICENSE") || strings.HasPrefix(upper, "LICENCE") ||
+			strings.HasPrefix(upper, "COPYING")) {
+			continue
+		}
+		if license := classifyLicense(filepath.Join(dir, e.Name())); license != "" {
+			return license
+		}
+	}
+	return licenseUnknown
+}
+
+// npmLicense returns the "license" field of an installed package.json.
+func npmLicense(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	var pkg struct {
+		License json.RawMessage `json:"license"`
+	}
+	if json.Unmarshal(data, &pkg) != nil || len(pkg.License) == 0 {
+		return ""
+	}
+	var license string
+	if json.Unmarshal(pkg.License, &license) == nil {
+		return license
+	}
+	var typed struct {
+		Type string `json:"type"`
+	}
+	_ = json.Unmarshal(pkg.License, &typed)
+	return typed.Type
+}
+
+// licenseMarkers maps distinctive license text to SPDX identifiers, most
+// specific first.
+var licenseMarkers = []struct {
+	spdx    string
+	markers []string
+}{
+	{"Apache-2.0", []string{"apache license", "version 2.0"}},
+	{"MPL-2.0", []string{"mozilla public license", "2.0"}},
+	{"LGPL-3.0", []string{"gnu lesser general public license", "version 3"}},
+	{"LGPL-2.1", []string{"gnu lesser general public license", "version 2.1"}},
+	{"AGPL-3.0", []string{"gnu affero general public license"}},
+	{"GPL-3.0", []string{"gnu general public license", "version 3"}},
+	{"GPL-2.0", []string{"gnu general public license", "version 2"}},
+	{"BSD-3-Clause", []string{"redistribution and use in source and binary forms", "neither the name"}},
+	{"BSD-2-Clause", []string{"redistribution and use in source and binary forms"}},
+	{"MIT", []string{"permission is hereby granted, free of charge"}},
+	{"ISC", []string{"permission to use, copy, modify, and/or distribute"}},
+	{"Unlicense", []string{"this is free and unencumbered software"}},
+}
+
+// classifyLicense returns the SPDX identifier of the license text at path,
+// or "" when it is not recognized.
+func classifyLicense(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	buf := make([]byte, licenseScanBytes)
+	n, _ := f.Read(buf)
+	text := strings.ToLower(strings.Join(strings.Fields(string(buf[:n])), " "))
+	for _, l := range licenseMarkers {
+		if !slices.ContainsFunc(l.markers, func(m string) bool { return !strings.Contains(text, m) }) {
+			return l.spdx
+		}
+	}
+	return ""
+}
+
+// goModCache returns the Go module cache directory, or "" when it cannot
+// be located.
+func goModCache() string {
+	if dir := os.Getenv("GOMODCACHE"); dir != "" {
+		return dir
+	}
+	if gopath := os.Getenv("GOPATH"); gopath != "" {
+		return filepath.Join(filepath.SplitList(gopath)[0], "pkg", "mod")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, "go", "pkg", "mod")
+}
+
+// escapeModulePath applies the module cache's case encoding: each upper
+// case letter becomes "!" and its lower case form.
+func escapeModulePath(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if unicode.IsUpper(r) {
+			b.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// dependencyInventory renders deps as the document Codex upserts, with
+// metadata that answers compliance and upgrade questions by filter. When
+// maxChars is positive, trailing table rows are dropped so the document
+// fits; the metadata still covers every dependency.
+func dependencyInventory(repo string, deps []dependency, maxChars int) dependencyDocument {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Dependencies of %s\n\n", repo)
+	b.WriteString("Direct dependencies declared by the repo's manifest files, generated by ai-indexer.\n\n")
+	b.WriteString("| Ecosystem | Package | Version | License | Declared in |\n")
+	b.WriteString("| --- | --- | --- | --- | --- |\n")
+	header := b.String()
+	rows := make([]string, 0, len(deps))
+
+	ecosystems := make(map[string]bool)
+	licenses := make(map[string]bool)
+	var packages []string
+	unknown := 0
+	for _, d := range deps {
+		name := d.Name
+		if d.Dev {
+			name += " (dev)"
+		}
+		rows = append(rows, fmt.Sprintf("| %s | %s | %s | %s | %s |\n", d.Ecosystem, name, d.Version, d.License,
+			d.Manifest))
+		ecosystems[d.Ecosystem] = true
+		packages = append(packages, d.Name)
+		if d.License == licenseUnknown {
+			unknown++
+		} else {
+			licenses[d.License] = true
+		}
+	}
+
+	document := fitInventory(header, rows, maxChars)
+	return dependencyDocument{
+		ID:       dependenciesDocumentID,
+		Document: document,
+		Metadata: map[string]any{
+			contentHashKey:          contentHash(document),
+			"kind":                  "dependencies",
+			"path":                  "DEPENDENCIES",
+			"dependency_count":      len(deps),
+			"unknown_license_count": unknown,
+			"ecosystems":            strings.Join(slices.Sorted(maps.Keys(ecosystems)), ","),
+			"licenses":              strings.Join(slices.Sorted(maps.Keys(licenses)), ","),
+			"packages":              strings.Join(slices.Compact(slices.Sorted(slices.Values(packages))), ","),
+		},
+	}
+}
+
+// stamp adds the schema metadata the indexer knows for m's run, so Codex
+// can upsert the inventory exactly as generated.
+func (d *dependencyDocument) stamp(m *indexManifest) {
+	stampMetadata(d.Metadata, m)
+}
+
+// stampMetadata sets the schema metadata the indexer knows for m's run on
+// a document it generated: repo, collection, commit, run_id, and the
+// optional remote, version, and tags.
+func stampMetadata(md map[string]any, m *indexManifest) {
+	md["repo"] = m.Repo.Name
+	md["collection"] = m.Collection
+	md["run_id"] = m.RunID
+	md["indexer_version"] = m.IndexerVersion
+	if m.Commit != nil {
+		md["commit"] = m.Commit.SHA
+	}
+	if m.Repo.RemoteURL != "" {
+		md["remote"] = m.Repo.RemoteURL
+	}
+	if m.Version != "" {
+		md["version"] = m.Version
+	}
+	if len(m.Tags) > 0 {
+		md["tags"] = strings.Join(m.Tags, ",")
+	}
+}
+
+// fitInventory joins header and rows, keeping only as many rows as fit in
+// maxChars characters together with a note counting the rest. A
+// non-positive maxChars keeps every row; the header is never cut.
+func fitInventory(header string, rows []string, maxChars int) string {
+	doc := header + strings.Join(rows, "")
+	if maxChars <= 0 || utf8.RuneCountInString(doc) <= maxChars {
+		return doc
+	}
+	size := utf8.RuneCountInString(header)
+	kept := 0
+	for _, row := range rows {
+		note := omittedNote(len(rows) - kept - 1)
+		if size+utf8.RuneCountInString(row)+utf8.RuneCountInString(note) > maxChars {
+			break
+		}
+		size += utf8.RuneCountInString(row)
+		kept++
+	}
+	return header + strings.Join(rows[:kept], "") + omittedNote(len(rows)-kept)
+}
+
+// omittedNote explains the rows fitInventory dropped.
+func omittedNote(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\n%d more dependencies omitted to fit the document size limit; see the metadata.\n", n)
+}
+
+// contentHash returns the hex SHA-256 of a document's text.
+func contentHash(document string) string {
+	sum := sha256.Sum256([]byte(document))
+	return hex.EncodeToString(sum[:])
+}
+
+// storedInventoryCurrent reports whether the collection already holds doc
+// with the same content hash, in which case upserting it again would only
+// re-embed identical text.
+func (ix *indexer) storedInventoryCurrent(
+	ctx context.Context, collection string, doc dependencyDocument,
+) (bool, error) {
+	client := newChromaClient(ix.opts.Chroma)
+	col, ok, err := client.getCollection(ctx, collection)
+	if err != nil || !ok {
+		return false, err
+	}
+	recs, err := client.getMetadatas(ctx, col.ID, []string{doc.ID})
+	if err != nil {
+		return false, err
+	}
+	for i, id := range recs.IDs {
+		if id == doc.ID && i < len(recs.Metadatas) {
+			return recs.Metadatas[i][contentHashKey] == doc.Metadata[contentHashKey], nil
+		}
+	}
+	return false, nil
+}
+
+// prepareDependencies attaches the repo's dependency inventory to the
+// manifest when --dependencies is set, unless the collection already holds
+// an identical one. A failed store lookup is logged and the inventory is
+// attached anyway.
+func (ix *indexer) prepareDependencies(ctx context.Context, m *indexManifest, indexDir string) {
+	if !ix.opts.Dependencies {
+		return
+	}
+	deps := collectDependencies(ctx, indexDir)
+	if len(deps) == 0 {
+		ix.log(ctx).infof("no dependency manifests found")
+		return
+	}
+	ix.log(ctx).infof("dependency inventory: %d direct dependencies", len(deps))
+	doc := dependencyInventory(m.Repo.Name, deps, ix.opts.MaxDocChars)
+	doc.stamp(m)
+	if err := documentSchema.validate(doc.Metadata); err != nil {
+		ix.log(ctx).warnf("dependency inventory not attached: invalid metadata: %s", metadataProblems(err))
+		return
+	}
+	current, err := ix.storedInventoryCurrent(ctx, m.Collection, doc)
+	if err != nil {
+		ix.log(ctx).infof("could not check the stored dependency inventory: %v", err)
+	}
+	if current {
+		ix.log(ctx).infof("dependency inventory unchanged; skipping its upsert")
+		return
+	}
+	m.Dependencies = &manifestDependencies{Count: len(deps)}
+	m.dependencyDocument = &doc
+}
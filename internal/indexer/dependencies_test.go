@@ -0,0 +1,236 @@
+package indexer
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseDependencyManifests(t *testing.T) {
+	tests := map[string]struct {
+		parse func([]byte) []dependency
+		data  string
+		want  []dependency
+	}{
+		"go.mod": {
+			parse: parseGoMod,
+			data: "module example.com/api\n\ngo 1.25\n\nrequire github.com/Foo/bar v1.2.3\n\n" +
+				"require (\n\tgolang.org/x/text v0.40.0 // comment\n\tgithub.com/x/y v0.1.0 // indirect\n)\n",
+			want: []dependency{
+				{Name: "github.com/Foo/bar", Version: "v1.2.3", Ecosystem: ecosystemGo},
+				{Name: "golang.org/x/text", Version: "v0.40.0", Ecosystem: ecosystemGo},
+			},
+		},
+		"package.json": {
+			parse: parsePackageJSON,
+			data:  `{"dependencies": {"react": "^18.2.0", "axios": "1.6.0"}, "devDependencies": {"jest": "^29"}}`,
+			want: []dependency{
+				{Name: "axios", Version: "1.6.0", Ecosystem: ecosystemNPM},
+				{Name: "react", Version: "^18.2.0", Ecosystem: ecosystemNPM},
+				{Name: "jest", Version: "^29", Ecosystem: ecosystemNPM, Dev: true},
+			},
+		},
+		"requirements.txt": {
+			parse: parseRequirements,
+			data: "# pinned\nrequests==2.31.0\nuvicorn[standard]>=0.23 ; python_version > '3.8'\n" +
+				"-r base.txt\nnumpy\ngit+https://github.com/org/lib.git\n",
+			want: []dependency{
+				{Name: "requests", Version: "==2.31.0", Ecosystem: ecosystemPyPI},
+				{Name: "uvicorn", Version: ">=0.23", Ecosystem: ecosystemPyPI},
+				{Name: "numpy", Ecosystem: ecosystemPyPI},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tc.parse([]byte(tc.data)); !slices.Equal(got, tc.want) {
+				t.Fatalf("expected %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestClassifyLicense(t *testing.T) {
+	tests := map[string]string{
+		"MIT License\n\nPermission is hereby granted, free of charge, to any person": "MIT",
+		"Apache License\n                           Version 2.0, January 2004":       "Apache-2.0",
+		"Redistribution and use in source and binary forms, with or without\n" +
+			"modification... Neither the name of Google Inc.": "BSD-3-Clause",
+		"All rights reserved. Proprietary.": "",
+	}
+	for text, want := range tests {
+		path := filepath.Join(t.TempDir(), "LICENSE")
+		if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+			t.Fatalf("write license: %v", err)
+		}
+		if got := classifyLicense(path); got != want {
+			t.Fatalf("expected %q for %q, got %q", want, text, got)
+		}
+	}
+}
+
+func TestCollectDependencies(t *testing.T) {
+	modCache := t.TempDir()
+	t.Setenv("GOMODCACHE", modCache)
+	modDir := filepath.Join(modCache, "github.com", "!foo", "bar@v1.2.3")
+	if err := os.MkdirAll(modDir, 0o755); err != nil {
+		t.Fatalf("create module dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(modDir, "LICENSE"),
+		[]byte("Permission is hereby granted, free of charge"), 0o644); err != nil {
+		t.Fatalf("write license: %v", err)
+	}
+
+	repoDir := t.TempDir()
+	initGitRepo(t, repoDir)
+	files := map[string]string{
+		"go.mod":                                 "module example.com/api\n\nrequire github.com/Foo/bar v1.2.3\n",
+		"web/package.json":                       `{"dependencies": {"left-pad": "1.3.0"}}`,
+		"web/node_modules/left-pad/package.json": `{"license": "WTFPL"}`,
+		"vendor/example.com/x/go.mod":            "module example.com/x\n\nrequire example.com/y v1.0.0\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(repoDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	if err := runGit(repoDir, "add", "go.mod", "web/package.json", "vendor"); err != nil {
+		t.Fatalf("git add: %v", err)
+	}
+
+	deps := collectDependencies(t.Context(), repoDir)
+	want := []dependency{
+		{Name: "github.com/Foo/bar", Version: "v1.2.3", License: "MIT", Ecosystem: ecosystemGo, Manifest: "go.mod"},
+		{Name: "left-pad", Version: "1.3.0", License: "WTFPL", Ecosystem: ecosystemNPM, Manifest: "web/package.json"},
+	}
+	if !slices.Equal(deps, want) {
+		t.Fatalf("expected %+v, got %+v", want, deps)
+	}
+
+	doc := dependencyInventory("api", append(deps, dependency{
+		Name: "numpy", License: licenseUnknown, Ecosystem: ecosystemPyPI, Manifest: "requirements.txt",
+	}), 0)
+	row := "| go | github.com/Foo/bar | v1.2.3 | MIT | go.mod |"
+	if doc.ID != dependenciesDocumentID || !strings.Contains(doc.Document, row) {
+		t.Fatalf("unexpected document %q", doc.Document)
+	}
+	wantMeta := map[string]any{
+		"kind":                  "dependencies",
+		"path":                  "DEPENDENCIES",
+		"dependency_count":      3,
+		"unknown_license_count": 1,
+		"ecosystems":            "go,npm,pypi",
+		"licenses":              "MIT,WTFPL",
+		"packages":              "github.com/Foo/bar,left-pad,numpy",
+	}
+	for k, v := range wantMeta {
+		if doc.Metadata[k] != v {
+			t.Fatalf("expected metadata %s=%v, got %v", k, v, doc.Metadata[k])
+		}
+	}
+}
+
+func TestFitInventory(t *testing.T) {
+	header := "# Dependencies\n"
+	row := "| " + strings.Repeat("x", 100) + " |\n"
+	rows := []string{row, row, row}
+	full := header + strings.Join(rows, "")
+
+	tests := map[string]struct {
+		maxChars int
+		want     string
+	}{
+		"unlimited": {want: full},
+		"fits":      {maxChars: len(full), want: full},
+		"one row":   {maxChars: len(header) + len(rows[0]) + len(omittedNote(2)), want: header + rows[0] + omittedNote(2)},
+		"no rows":   {maxChars: 1, want: header + omittedNote(3)},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := fitInventory(header, rows, tc.maxChars); got != tc.want {
+				t.Fatalf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestPrepareDependenciesUnchanged(t *testing.T) {
+	t.Setenv("GOMODCACHE", t.TempDir())
+	repoDir := t.TempDir()
+	initGitRepo(t, repoDir)
+	gomod := "module example.com/api\n\nrequire github.com/Foo/bar v1.2.3\n"
+	if err := os.WriteFile(filepath.Join(repoDir, "go.mod"), []byte(gomod), 0o644); err != nil {
+		t.Fatalf("write go.mod: %v", err)
+	}
+	if err := runGit(repoDir, "add", "go.mod"); err != nil {
+		t.Fatalf("git add: %v", err)
+	}
+	doc := dependencyInventory("api", collectDependencies(t.Context(), repoDir), 0)
+
+	tests := map[string]struct {
+		stored     string
+		status     int
+		want       bool
+		log        string
+		collection bool
+	}{
+		"unchanged":          {collection: true, stored: contentHash(doc.Document), log: "unchanged"},
+		"changed":            {collection: true, stored: "stale", want: true},
+		"never stored":       {collection: true, want: true},
+		"missing collection": {want: true},
+		"store error":        {status: http.StatusInternalServerError, want: true, log: "could not check"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case tc.status != 0:
+					w.WriteHeader(tc.status)
+				case r.Method == http.MethodGet && tc.collection:
+					_ = json.NewEncoder(w).Encode(chromaCollection{ID: "col-1", Name: "api"})
+				case r.Method == http.MethodGet:
+					http.NotFound(w, r)
+				case strings.HasSuffix(r.URL.Path, "/col-1/get"):
+					recs := chromaRecords{IDs: []string{}}
+					if tc.stored != "" {
+						recs.IDs = []string{dependenciesDocumentID}
+						recs.Metadatas = []map[string]any{{contentHashKey: tc.stored}}
+					}
+					_ = json.NewEncoder(w).Encode(recs)
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			t.Cleanup(srv.Close)
+
+			var out bytes.Buffer
+			ix := newIndexer(&out, &out, nil, nil, Options{Dependencies: true, Chroma: ChromaOptions{URL: srv.URL}})
+			m := &indexManifest{
+				Collection: "api",
+				RunID:      "run-1",
+				Repo:       manifestRepo{Name: "api"},
+				Commit:     &manifestCommit{SHA: "abc123"},
+			}
+			ix.prepareDependencies(t.Context(), m, repoDir)
+			if (m.Dependencies != nil) != tc.want {
+				t.Fatalf("expected dependencies=%t, got %+v", tc.want, m.Dependencies)
+			}
+			if !strings.Contains(out.String(), tc.log) {
+				t.Fatalf("expected log %q, got %q", tc.log, out.String())
+			}
+		})
+	}
+}
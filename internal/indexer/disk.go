@@ -0,0 +1,183 @@
+package indexer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// errFreeSpaceUnsupported is returned by freeSpace on platforms without a
+// statfs equivalent; the free space preflight is skipped there.
+var errFreeSpaceUnsupported = errors.New("free space check not supported on this platform")
+
+// byteSizeUnits maps size suffixes to multipliers for ParseByteSize.
+var byteSizeUnits = map[string]int64{
+	"":  1,
+	"B": 1,
+	"K": 1 << 10,
+	"M": 1 << 20,
+	"G": 1 << 30,
+	"T": 1 << 40,
+}
+
+// ParseByteSize parses sizes such as "512M", "20G", or "1073741824". Suffixes
+// are binary (K = 1024) and an optional trailing "B" or "iB" is accepted.
+func ParseByteSize(value string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "IB"), "B")
+	if s == "" {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+
+	unit := ""
+	if last := s[len(s)-1:]; last < "0" || last > "9" {
+		unit = last
+		s = s[:len(s)-1]
+	}
+	mult, ok := byteSizeUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q: unknown unit %q", value, unit)
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return n * mult, nil
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGT"[exp])
+}
+
+// estimateWorktreeSize sums the blob sizes of ref's tree, which is what a
+// worktree checkout of ref writes to disk (excluding filesystem overhead).
+func estimateWorktreeSize(ctx context.Context, repoDir, ref string) (int64, error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", repoDir, "ls-tree", "-r", "-l", "--full-tree", ref)
+	out, err := procOutput(ctx, cmd)
+	if err != nil {
+		return 0, fmt.Errorf("git ls-tree %s: %w", ref, err)
+	}
+
+	var total int64
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		// <mode> SP <type> SP <object> SP+ <size> TAB <path>
+		meta, _, ok := strings.Cut(scanner.Text(), "\t")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(meta)
+		if len(fields) != 4 || fields[3] == "-" {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("parse ls-tree size %q: %w", fields[3], err)
+		}
+		total += size
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("scan ls-tree: %w", err)
+	}
+	return total, nil
+}
+
+// diskBudget caps the combined estimated size of live worktrees. Reservations
+// that would exceed the cap wait for earlier worktrees to be removed, so big
+// repos are serialized instead of filling the disk. A nil budget is
+// unlimited.
+type diskBudget struct {
+	cond  *sync.Cond
+	limit int64
+	used  int64
+	mu    sync.Mutex
+}
+
+func newDiskBudget(limit int64) *diskBudget {
+	if limit <= 0 {
+		return nil
+	}
+	b := &diskBudget{limit: limit}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// reserve blocks until size fits under the cap and returns the func that
+// gives it back. Sizes larger than the whole cap fail immediately.
+func (b *diskBudget) reserve(size int64) (func(), error) {
+	if b == nil {
+		return func() {}, nil
+	}
+	if size > b.limit {
+		return nil, fmt.Errorf("estimated worktree size %s exceeds --max-worktree-disk %s",
+			formatBytes(size), formatBytes(b.limit))
+	}
+
+	b.mu.Lock()
+	for b.used+size > b.limit {
+		b.cond.Wait()
+	}
+	b.used += size
+	b.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			b.used -= size
+			b.mu.Unlock()
+			b.cond.Broadcast()
+		})
+	}, nil
+}
+
+// wouldWait reports whether reserving size would currently block.
+func (b *diskBudget) wouldWait(size int64) bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used+size > b.limit && size <= b.limit
+}
+
+// checkWorktreeDisk estimates the worktree for ref, verifies the worktree
+// base has room for it, and reserves it against --max-worktree-disk. The
+// returned func releases the reservation once the worktree is removed.
+func (ix *indexer) checkWorktreeDisk(ctx context.Context, ownerDir, ref, worktreeBase string) (func(), error) {
+	size, err := estimateWorktreeSize(ctx, ownerDir, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	free, err := freeSpace(worktreeBase)
+	switch {
+	case errors.Is(err, errFreeSpaceUnsupported):
+	case err != nil:
+		return nil, err
+	case size > free:
+		return nil, fmt.Errorf("estimated worktree size %s exceeds free space %s in %s",
+			formatBytes(size), formatBytes(free), worktreeBase)
+	}
+
+	if ix.diskBudget.wouldWait(size) {
+		ix.log(ctx).infof("waiting for worktree disk budget (%s needed)", formatBytes(size))
+	}
+	return ix.diskBudget.reserve(size)
+}
@@ -0,0 +1,7 @@
+//go:build !unix
+
+package indexer
+
+func freeSpace(string) (int64, error) {
+	return 0, errFreeSpaceUnsupported
+}
@@ -0,0 +1,111 @@
+package indexer
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := map[string]struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		"plain bytes": {
+			value: "1024",
+			want:  1024,
+		},
+		"gigabytes": {
+			value: "20G",
+			want:  20 << 30,
+		},
+		"lowercase with suffix": {
+			value: "512mib",
+			want:  512 << 20,
+		},
+		"unknown unit": {
+			value:   "5X",
+			wantErr: true,
+		},
+		"empty": {
+			value:   "",
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseByteSize(tc.value)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %d", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse size: %v", err)
+			}
+			if got != tc.want {
+				t.Fatalf("expected %d, got %d", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestEstimateWorktreeSize(t *testing.T) {
+	repoDir := filepath.Join(t.TempDir(), "repo")
+	initGitRepo(t, repoDir)
+
+	size, err := estimateWorktreeSize(t.Context(), repoDir, "HEAD")
+	if err != nil {
+		t.Fatalf("estimate worktree size: %v", err)
+	}
+	if size != int64(len("test\n")) {
+		t.Fatalf("expected size of README, got %d", size)
+	}
+}
+
+func TestDiskBudget(t *testing.T) {
+	b := newDiskBudget(100)
+
+	if _, err := b.reserve(101); err == nil {
+		t.Fatalf("expected oversized reservation to fail")
+	}
+
+	releaseFirst, err := b.reserve(60)
+	if err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+	if !b.wouldWait(50) {
+		t.Fatalf("expected second reservation to wait")
+	}
+
+	reserved := make(chan struct{})
+	go func() {
+		release, err := b.reserve(50)
+		if err != nil {
+			t.Errorf("reserve: %v", err)
+		} else {
+			release()
+		}
+		close(reserved)
+	}()
+
+	select {
+	case <-reserved:
+		t.Fatalf("expected reservation to block while over budget")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	releaseFirst()
+	releaseFirst()
+	select {
+	case <-reserved:
+	case <-time.After(time.Second):
+		t.Fatalf("expected reservation to proceed after release")
+	}
+	if b.used != 0 {
+		t.Fatalf("expected budget to be fully released, got %d", b.used)
+	}
+}
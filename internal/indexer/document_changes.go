@@ -0,0 +1,116 @@
+package indexer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// DocumentChanges counts how a run changed a repo's collection. Codex
+// writes through its own store connection, so the changes are found by
+// comparing the collection before and after it ran.
+type DocumentChanges struct {
+	Added     int `json:"added"`
+	Updated   int `json:"updated"`
+	Deleted   int `json:"deleted"`
+	Unchanged int `json:"unchanged"`
+}
+
+// String formats the changes for the summary table, e.g. "+3 ~2 -1".
+func (c *DocumentChanges) String() string {
+	if c == nil {
+		return "-"
+	}
+	return fmt.Sprintf("+%d ~%d -%d", c.Added, c.Updated, c.Deleted)
+}
+
+// documentSnapshot maps each record ID of a collection to a fingerprint of
+// its document and metadata.
+type documentSnapshot map[string]string
+
+// snapshotDocuments fingerprints every record of the collection; a missing
+// collection has none.
+func (ix *indexer) snapshotDocuments(ctx context.Context, collection string) (documentSnapshot, error) {
+	client := newChromaClient(ix.opts.Chroma)
+	col, ok, err := client.getCollection(ctx, collection)
+	if err != nil {
+		return nil, fmt.Errorf("get collection %s: %w", collection, err)
+	}
+	snap := documentSnapshot{}
+	if !ok {
+		return snap, nil
+	}
+	for offset := 0; ; offset += chromaPageSize {
+		page, err := client.getDocuments(ctx, col.ID, offset, chromaPageSize)
+		if err != nil {
+			return nil, fmt.Errorf("read collection %s: %w", collection, err)
+		}
+		for i, id := range page.IDs {
+			var (
+				doc *string
+				md  map[string]any
+			)
+			if i < len(page.Documents) {
+				doc = page.Documents[i]
+			}
+			if i < len(page.Metadatas) {
+				md = page.Metadatas[i]
+			}
+			snap[id] = documentFingerprint(doc, md)
+		}
+		if len(page.IDs) < chromaPageSize {
+			return snap, nil
+		}
+	}
+}
+
+// documentFingerprint hashes a record's document and metadata; metadata
+// keys marshal in sorted order, so equal records hash alike.
+func documentFingerprint(doc *string, md map[string]any) string {
+	data, _ := json.Marshal(struct {
+		Document *string        `json:"document"`
+		Metadata map[string]any `json:"metadata"`
+	}{doc, md})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// changes compares the snapshot taken before a run with the one after it.
+func (before documentSnapshot) changes(after documentSnapshot) DocumentChanges {
+	var c DocumentChanges
+	for id, fp := range after {
+		switch old, ok := before[id]; {
+		case !ok:
+			c.Added++
+		case old != fp:
+			c.Updated++
+		default:
+			c.Unchanged++
+		}
+	}
+	for id := range before {
+		if _, ok := after[id]; !ok {
+			c.Deleted++
+		}
+	}
+	return c
+}
+
+// recordDocumentChanges implements Options.DocumentChanges once Codex has
+// run: it snapshots the collection again and records what changed since
+// before. Store errors are logged rather than failing the repo.
+func (ix *indexer) recordDocumentChanges(
+	ctx context.Context, result *RepoResult, collection string, before documentSnapshot,
+) {
+	after, err := ix.snapshotDocuments(ctx, collection)
+	if err != nil {
+		ix.log(ctx).warnf("could not count document changes: %v", err)
+		return
+	}
+	changes := before.changes(after)
+	result.DocumentChanges = &changes
+	ix.log(ctx).infof("documents: %d added, %d updated, %d deleted, %d unchanged",
+		changes.Added, changes.Updated, changes.Deleted, changes.Unchanged)
+}
@@ -0,0 +1,79 @@
+package indexer
+
+import (
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+func TestDocumentSnapshotChanges(t *testing.T) {
+	tests := map[string]struct {
+		before, after documentSnapshot
+		want          DocumentChanges
+	}{
+		"new collection": {
+			before: documentSnapshot{},
+			after:  documentSnapshot{"a": "1", "b": "2"},
+			want:   DocumentChanges{Added: 2},
+		},
+		"incremental": {
+			before: documentSnapshot{"a": "1", "b": "2", "c": "3"},
+			after:  documentSnapshot{"a": "1", "b": "changed", "d": "4"},
+			want:   DocumentChanges{Added: 1, Updated: 1, Deleted: 1, Unchanged: 1},
+		},
+		"untouched": {
+			before: documentSnapshot{"a": "1"},
+			after:  documentSnapshot{"a": "1"},
+			want:   DocumentChanges{Unchanged: 1},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tc.before.changes(tc.after); got != tc.want {
+				t.Fatalf("expected %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRecordDocumentChanges(t *testing.T) {
+	chroma := ChromaOptions{URL: mockStoreURL, mock: newMockStore(filepath.Join(t.TempDir(), "mock.json"))}
+	client := newChromaClient(chroma)
+	col, err := client.createCollection(t.Context(), "api", nil)
+	if err != nil {
+		t.Fatalf("create collection: %v", err)
+	}
+	upsert := func(id, doc string) {
+		t.Helper()
+		recs := chromaRecords{IDs: []string{id}, Documents: []*string{&doc}, Metadatas: []map[string]any{{"path": id}}}
+		if err := client.upsertRecords(t.Context(), col.ID, recs); err != nil {
+			t.Fatalf("upsert: %v", err)
+		}
+	}
+	upsert("overview", "v1")
+	upsert("auth", "v1")
+
+	ix := newIndexer(io.Discard, io.Discard, nil, nil, Options{DocumentChanges: true, Chroma: chroma})
+	before, err := ix.snapshotDocuments(t.Context(), "api")
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	upsert("auth", "v2")
+	upsert("billing", "v1")
+
+	result := &RepoResult{}
+	ix.recordDocumentChanges(t.Context(), result, "api", before)
+	want := DocumentChanges{Added: 1, Updated: 1, Unchanged: 1}
+	if result.DocumentChanges == nil || *result.DocumentChanges != want {
+		t.Fatalf("expected %+v, got %+v", want, result.DocumentChanges)
+	}
+	if got := result.DocumentChanges.String(); got != "+1 ~1 -0" {
+		t.Fatalf("expected +1 ~1 -0, got %q", got)
+	}
+
+	missing, err := ix.snapshotDocuments(t.Context(), "web")
+	if err != nil || len(missing) != 0 {
+		t.Fatalf("expected an empty snapshot of a missing collection, got %v (%v)", missing, err)
+	}
+}
@@ -0,0 +1,213 @@
+package indexer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// collectionDumpFormat versions the first line of a collection dump.
+const collectionDumpFormat = "ai-indexer-collection/v1"
+
+// ExportOptions configures ExportCollection.
+type ExportOptions struct {
+	// Chroma locates the collection store.
+	Chroma ChromaOptions
+	// Slug is the collection to export.
+	Slug string
+	// Out is the JSONL file written; "-" writes to stdout.
+	Out string
+}
+
+// ImportOptions configures ImportCollection.
+type ImportOptions struct {
+	// Chroma locates the collection store.
+	Chroma ChromaOptions
+	// Slug is the collection to create; it must not exist yet.
+	Slug string
+	// In is the JSONL file read; "-" reads stdin.
+	In string
+}
+
+// collectionDumpHeader is the first line of a dump.
+type collectionDumpHeader struct {
+	Metadata   map[string]any `json:"metadata,omitempty"`
+	Format     string         `json:"format"`
+	Collection string         `json:"collection"`
+}
+
+// collectionDumpRecord is one record line of a dump.
+type collectionDumpRecord struct {
+	Metadata  map[string]any `json:"metadata,omitempty"`
+	Document  *string        `json:"document,omitempty"`
+	ID        string         `json:"id"`
+	Embedding []float64      `json:"embedding,omitempty"`
+}
+
+// ExportCollection writes a collection's metadata and every record, with
+// its document, metadata, and embedding, to opts.Out as JSON lines: a
+// header line, then one line per record. Progress goes to w.
+func ExportCollection(ctx context.Context, w io.Writer, opts ExportOptions) (err error) {
+	client := newChromaClient(opts.Chroma)
+	col, ok, err := client.getCollection(ctx, opts.Slug)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("collection %q does not exist", opts.Slug)
+	}
+
+	out := io.Writer(os.Stdout)
+	if opts.Out != "-" {
+		f, err := os.Create(opts.Out)
+		if err != nil {
+			return fmt.Errorf("create export: %w", err)
+		}
+		defer func() {
+			if cerr := f.Close(); cerr != nil && err == nil {
+				err = fmt.Errorf("close export: %w", cerr)
+			}
+		}()
+		out = f
+	}
+	buf := bufio.NewWriter(out)
+	enc := json.NewEncoder(buf)
+	if err := enc.Encode(collectionDumpHeader{
+		Format:     collectionDumpFormat,
+		Collection: col.Name,
+		Metadata:   col.Metadata,
+	}); err != nil {
+		return fmt.Errorf("write export: %w", err)
+	}
+
+	exported := 0
+	for {
+		page, err := client.getRecords(ctx, col.ID, exported, chromaPageSize)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", col.Name, err)
+		}
+		for i, id := range page.IDs {
+			rec := collectionDumpRecord{ID: id}
+			if i < len(page.Documents) {
+				rec.Document = page.Documents[i]
+			}
+			if i < len(page.Metadatas) {
+				rec.Metadata = page.Metadatas[i]
+			}
+			if i < len(page.Embeddings) {
+				rec.Embedding = page.Embeddings[i]
+			}
+			if err := enc.Encode(rec); err != nil {
+				return fmt.Errorf("write export: %w", err)
+			}
+		}
+		exported += len(page.IDs)
+		if len(page.IDs) < chromaPageSize {
+			break
+		}
+	}
+	if err := buf.Flush(); err != nil {
+		return fmt.Errorf("write export: %w", err)
+	}
+	if opts.Out != "-" {
+		logf(w, "Exported %d records from %s to %s\n", exported, col.Name, opts.Out)
+	}
+	return nil
+}
+
+// ImportCollection creates opts.Slug from a dump written by
+// ExportCollection, with the dumped collection metadata and records. A
+// failed import deletes the partly filled collection. Progress goes to w.
+func ImportCollection(ctx context.Context, w io.Writer, opts ImportOptions) error {
+	if err := validateCollectionName(opts.Slug); err != nil {
+		return err
+	}
+
+	in := io.Reader(os.Stdin)
+	if opts.In != "-" {
+		f, err := os.Open(opts.In)
+		if err != nil {
+			return fmt.Errorf("open import: %w", err)
+		}
+		defer f.Close()
+		in = f
+	}
+	dec := json.NewDecoder(bufio.NewReader(in))
+	var header collectionDumpHeader
+	if err := dec.Decode(&header); err != nil {
+		return fmt.Errorf("read dump header: %w", err)
+	}
+	if header.Format != collectionDumpFormat {
+		return fmt.Errorf("unsupported dump format %q (want %s)", header.Format, collectionDumpFormat)
+	}
+
+	client := newChromaClient(opts.Chroma)
+	if _, exists, err := client.getCollection(ctx, opts.Slug); err != nil {
+		return err
+	} else if exists {
+		return fmt.Errorf("collection %q already exists", opts.Slug)
+	}
+	created, err := client.createCollection(ctx, opts.Slug, header.Metadata)
+	if err != nil {
+		return err
+	}
+
+	imported, err := importRecords(ctx, client, created.ID, dec)
+	if err != nil {
+		if derr := client.deleteCollection(ctx, opts.Slug); derr != nil {
+			err = errors.Join(err, fmt.Errorf("delete partial collection %s: %w", opts.Slug, derr))
+		}
+		return fmt.Errorf("import into %s: %w", opts.Slug, err)
+	}
+	logf(w, "Imported %d records from %s into %s\n", imported, header.Collection, opts.Slug)
+	return nil
+}
+
+// importRecords adds the dump's records to the collection with the given
+// id in pages, returning the number added.
+func importRecords(ctx context.Context, client *chromaClient, id string, dec *json.Decoder) (int, error) {
+	imported := 0
+	var page chromaRecords
+	flush := func() error {
+		if len(page.IDs) == 0 {
+			return nil
+		}
+		if err := client.addRecords(ctx, id, page); err != nil {
+			return err
+		}
+		imported += len(page.IDs)
+		page = chromaRecords{}
+		return nil
+	}
+
+	for line := 2; ; line++ {
+		var rec collectionDumpRecord
+		err := dec.Decode(&rec)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return imported, fmt.Errorf("record %d: %w", line, err)
+		}
+		if rec.ID == "" {
+			return imported, fmt.Errorf("record %d: id is required", line)
+		}
+		if len(rec.Embedding) == 0 {
+			return imported, fmt.Errorf("record %d (%s): embedding is required", line, rec.ID)
+		}
+		page.IDs = append(page.IDs, rec.ID)
+		page.Documents = append(page.Documents, rec.Document)
+		page.Metadatas = append(page.Metadatas, rec.Metadata)
+		page.Embeddings = append(page.Embeddings, rec.Embedding)
+		if len(page.IDs) == chromaPageSize {
+			if err := flush(); err != nil {
+				return imported, err
+			}
+		}
+	}
+	return imported, flush()
+}
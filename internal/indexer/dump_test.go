@@ -0,0 +1,88 @@
+package indexer
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExportImportCollection(t *testing.T) {
+	fake, srv := newFakeChroma(t, chromaPageSize+3)
+	src := fake.collections["old_api"]
+	src.metadata = map[string]any{"hnsw:space": "cosine"}
+	for i := range src.records.IDs {
+		src.records.Metadatas = append(src.records.Metadatas, map[string]any{"path": "internal/auth", "chunk": 1.0})
+		src.records.Embeddings = append(src.records.Embeddings, []float64{float64(i), 0.25, -1})
+	}
+	chroma := ChromaOptions{URL: srv.URL}
+	dump := filepath.Join(t.TempDir(), "dump.jsonl")
+
+	var out bytes.Buffer
+	if err := ExportCollection(t.Context(), &out, ExportOptions{Chroma: chroma, Slug: "old_api", Out: dump}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if !strings.Contains(out.String(), "Exported 503 records") {
+		t.Fatalf("unexpected export output %q", out.String())
+	}
+	if err := ImportCollection(t.Context(), &out, ImportOptions{Chroma: chroma, Slug: "new_api", In: dump}); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+
+	dst := fake.collections["new_api"]
+	if dst == nil {
+		t.Fatal("expected new_api to be created")
+	}
+	if !reflect.DeepEqual(dst.metadata, src.metadata) {
+		t.Fatalf("expected collection metadata %v, got %v", src.metadata, dst.metadata)
+	}
+	if !reflect.DeepEqual(dst.records, src.records) {
+		t.Fatalf("records did not round-trip: got %d ids", len(dst.records.IDs))
+	}
+
+	err := ImportCollection(t.Context(), &out, ImportOptions{Chroma: chroma, Slug: "new_api", In: dump})
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("expected an existing collection to be refused, got %v", err)
+	}
+}
+
+func TestImportCollectionErrors(t *testing.T) {
+	header := `{"format":"` + collectionDumpFormat + `","collection":"old_api"}` + "\n"
+	tests := map[string]struct {
+		dump    string
+		wantErr string
+	}{
+		"unknown format":    {dump: `{"format":"other/v9"}` + "\n", wantErr: "unsupported dump format"},
+		"not json":          {dump: "nope\n", wantErr: "read dump header"},
+		"missing id":        {dump: header + `{"embedding":[1]}` + "\n", wantErr: "record 2: id is required"},
+		"missing embedding": {dump: header + `{"id":"a"}` + "\n", wantErr: "embedding is required"},
+		"bad record": {
+			dump:    header + `{"id":"a","embedding":[1]}` + "\n" + `{"id":` + "\n",
+			wantErr: "record 3",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			fake, srv := newFakeChroma(t, 0)
+			dump := filepath.Join(t.TempDir(), "dump.jsonl")
+			if err := os.WriteFile(dump, []byte(tc.dump), 0o644); err != nil {
+				t.Fatalf("write dump: %v", err)
+			}
+			var out bytes.Buffer
+			err := ImportCollection(t.Context(), &out, ImportOptions{
+				Chroma: ChromaOptions{URL: srv.URL},
+				Slug:   "new_api",
+				In:     dump,
+			})
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error %q, got %v", tc.wantErr, err)
+			}
+			if _, ok := fake.collections["new_api"]; ok {
+				t.Fatal("expected a failed import to leave no collection behind")
+			}
+		})
+	}
+}
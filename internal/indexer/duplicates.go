@@ -0,0 +1,124 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Duplicate checkout policies for repos sharing a remote.
+const (
+	DuplicatePolicyNewest = "newest"
+	DuplicatePolicyFirst  = "first"
+	DuplicatePolicyOff    = "off"
+)
+
+// remoteInfo is the preferred remote and HEAD time of one discovered repo.
+type remoteInfo struct {
+	headTime time.Time
+	remote   string
+}
+
+// markDuplicates flags checkouts whose preferred remote shares a normalized
+// URL with another discovered repo, keeping one per remote according to
+// policy. Checkouts this run skips anyway (--skip-repo, an opt-out marker,
+// or --tag) are left out, so the one kept is always indexed.
+func (ix *indexer) markDuplicates(ctx context.Context, rootDir string, repos []discoveredRepo) {
+	if ix.opts.DuplicatePolicy == DuplicatePolicyOff || len(repos) < 2 {
+		return
+	}
+
+	infos := make([]remoteInfo, len(repos))
+	for i, repo := range repos {
+		if repo.worktreeOf != "" {
+			continue
+		}
+		slug := computeCollectionSlug(rootDir, repo.path)
+		id := newRepoIdentity(rootDir, repo.path, slug)
+		if skip, _ := ix.shouldSkipRepo(rootDir, repo.path, slug); skip {
+			continue
+		}
+		if optOutMarker(repo.path) != "" || !ix.taggedForRun(ix.config.repoTags(id)) {
+			continue
+		}
+		name := ix.selectRemote(ctx, id, repo.path)
+		rawURL, err := remoteURL(ctx, repo.path, name)
+		if err != nil {
+			continue
+		}
+		infos[i].remote = normalizeRemoteURL(rawURL)
+		if ix.opts.DuplicatePolicy == DuplicatePolicyNewest {
+			if ts, err := headCommitTime(ctx, repo.path); err == nil {
+				infos[i].headTime = ts
+			}
+		}
+	}
+
+	assignDuplicates(repos, infos, ix.opts.DuplicatePolicy)
+}
+
+// assignDuplicates sets duplicateOf on every repo except the preferred one in
+// each group sharing a remote. Repos without a remote are left alone.
+func assignDuplicates(repos []discoveredRepo, infos []remoteInfo, policy string) {
+	preferred := make(map[string]int)
+	for i, info := range infos {
+		if info.remote == "" {
+			continue
+		}
+		best, seen := preferred[info.remote]
+		if !seen {
+			preferred[info.remote] = i
+			continue
+		}
+		if policy == DuplicatePolicyNewest && info.headTime.After(infos[best].headTime) {
+			preferred[info.remote] = i
+		}
+	}
+
+	for i, info := range infos {
+		if info.remote == "" {
+			continue
+		}
+		if best := preferred[info.remote]; best != i {
+			repos[i].duplicateOf = repos[best].path
+			repos[i].remote = info.remote
+		}
+	}
+}
+
+// normalizeRemoteURL reduces the common spellings of a remote (https, ssh,
+// scp-style, with or without credentials and a .git suffix) to host/path.
+func normalizeRemoteURL(remote string) string {
+	remote = strings.TrimSpace(remote)
+	if remote == "" {
+		return ""
+	}
+
+	var host, path string
+	if strings.Contains(remote, "://") {
+		u, err := url.Parse(remote)
+		if err != nil {
+			return remote
+		}
+		if u.Scheme == "file" {
+			return strings.TrimSuffix(u.Path, "/")
+		}
+		host = u.Hostname()
+		path = u.Path
+	} else if h := remoteHost(remote); h != "" {
+		host = h
+		_, path, _ = strings.Cut(remote, ":")
+	} else {
+		return strings.TrimSuffix(strings.TrimSuffix(remote, "/"), ".git")
+	}
+
+	path = strings.Trim(path, "/")
+	path = strings.TrimSuffix(path, ".git")
+	return strings.ToLower(host) + "/" + path
+}
+
+func (r discoveredRepo) describeDuplicate() string {
+	return fmt.Sprintf("duplicate of %s (same remote %s)", r.duplicateOf, r.remote)
+}
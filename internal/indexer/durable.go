@@ -0,0 +1,68 @@
+package indexer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// backupSuffix names the copy of a state file kept from its previous save.
+const backupSuffix = ".bak"
+
+// writeFileSynced atomically replaces path with data. The temp file is
+// synced before the rename and the directory after it, so a crash leaves
+// either the complete old file or the complete new one.
+func writeFileSynced(path string, data []byte, perm os.FileMode) error {
+	tmpPath := path + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		return errors.Join(err, f.Close(), os.Remove(tmpPath))
+	}
+	if err := f.Sync(); err != nil {
+		return errors.Join(err, f.Close(), os.Remove(tmpPath))
+	}
+	if err := f.Close(); err != nil {
+		return errors.Join(err, os.Remove(tmpPath))
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return errors.Join(err, os.Remove(tmpPath))
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// syncDir flushes directory entries such as a rename. Windows cannot sync
+// directories, and NTFS journals renames itself.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	return errors.Join(d.Sync(), d.Close())
+}
+
+// rotateBackup copies the current file at path to its backup when valid
+// reports it intact, so a damaged file never replaces a good backup.
+func rotateBackup(path string, valid func([]byte) bool) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read %s for backup: %w", path, err)
+	}
+	if !valid(data) {
+		return nil
+	}
+	if err := writeFileSynced(path+backupSuffix, data, 0o600); err != nil {
+		return fmt.Errorf("write backup: %w", err)
+	}
+	return nil
+}
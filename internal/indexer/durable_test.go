@@ -0,0 +1,22 @@
+package indexer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileSyncedRenameFailure(t *testing.T) {
+	// A non-empty directory cannot be replaced by a rename.
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.MkdirAll(filepath.Join(path, "child"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+
+	if err := writeFileSynced(path, []byte("{}"), 0o600); err == nil {
+		t.Fatal("expected the rename to fail")
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("expected the temp file removed, got %v", err)
+	}
+}
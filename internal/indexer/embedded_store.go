@@ -0,0 +1,1106 @@
+package indexer
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultEmbeddedStorePath is the directory --store embedded keeps its
+// database in.
+const DefaultEmbeddedStorePath = "~/.ai-indexer/db"
+
+// embeddedStoreFile is the SQLite database inside the store directory.
+const embeddedStoreFile = "store.sqlite"
+
+const embeddedSchema = `
+CREATE TABLE IF NOT EXISTS collections (
+	id       TEXT NOT NULL PRIMARY KEY,
+	tenant   TEXT NOT NULL,
+	database TEXT NOT NULL,
+	name     TEXT NOT NULL,
+	metadata TEXT NOT NULL,
+	UNIQUE (tenant, database, name)
+);
+CREATE TABLE IF NOT EXISTS records (
+	collection_id TEXT NOT NULL,
+	id            TEXT NOT NULL,
+	document      TEXT,
+	metadata      TEXT NOT NULL,
+	embedding     TEXT NOT NULL,
+	PRIMARY KEY (collection_id, id)
+);
+`
+
+// embeddedStore is the collection store behind --store embedded: a SQLite
+// database serving the subset of the Chroma v2 API that the indexer and the
+// Chroma MCP server use, so memory can be built and queried without a
+// server. Records keep the embeddings their writer computed; queries rank
+// by the distance in the collection's "hnsw:space" (l2 by default).
+// --store pgvector serves the same API from Postgres.
+type embeddedStore struct {
+	db      *sql.DB
+	mux     *http.ServeMux
+	path    string
+	dialect storeDialect
+}
+
+// storeDialect adapts the store's SQL to the database behind it.
+type storeDialect struct {
+	// name is the store GET /api/v2/version reports.
+	name string
+	// seq is the column ordering collections and records by insertion.
+	seq string
+	// numbered rewrites ? placeholders as $1, $2, and so on.
+	numbered bool
+	// vector keeps embeddings in a pgvector column, NULL when a record has
+	// none, and ranks unfiltered queries in the database.
+	vector bool
+}
+
+var sqliteDialect = storeDialect{name: StoreEmbedded, seq: "rowid"}
+
+// openEmbeddedStore opens the store in dir, creating it when missing. An
+// empty dir uses DefaultEmbeddedStorePath.
+func openEmbeddedStore(ctx context.Context, dir string) (*embeddedStore, error) {
+	dir, err := expandHome(cmp.Or(dir, DefaultEmbeddedStorePath))
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("create embedded store: %w", err)
+	}
+	path := filepath.Join(dir, embeddedStoreFile)
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("open embedded store %s: %w", path, err)
+	}
+	// One connection serializes the writes of the indexer and Codex.
+	db.SetMaxOpenConns(1)
+	if _, err := db.ExecContext(ctx, embeddedSchema); err != nil {
+		return nil, errors.Join(fmt.Errorf("migrate embedded store %s: %w", path, err), db.Close())
+	}
+	return newSQLStore(db, sqliteDialect, path), nil
+}
+
+// newSQLStore serves the Chroma API from db, whose schema is migrated.
+func newSQLStore(db *sql.DB, dialect storeDialect, path string) *embeddedStore {
+	s := &embeddedStore{db: db, mux: http.NewServeMux(), path: path, dialect: dialect}
+	const (
+		tenants = "/api/v2/tenants"
+		dbs     = tenants + "/{tenant}/databases"
+		cols    = dbs + "/{database}/collections"
+	)
+	s.mux.HandleFunc("GET /api/v2/heartbeat", func(w http.ResponseWriter, _ *http.Request) {
+		writeMockJSON(w, map[string]any{"nanosecond heartbeat": time.Now().UnixNano()})
+	})
+	s.mux.HandleFunc("GET /api/v2/version", func(w http.ResponseWriter, _ *http.Request) {
+		writeMockJSON(w, dialect.name)
+	})
+	s.mux.HandleFunc("GET /api/v2/pre-flight-checks", func(w http.ResponseWriter, _ *http.Request) {
+		writeMockJSON(w, map[string]any{"max_batch_size": chromaPageSize})
+	})
+	s.mux.HandleFunc("GET /api/v2/auth/identity", func(w http.ResponseWriter, _ *http.Request) {
+		writeMockJSON(w, map[string]any{"user_id": "", "tenant": DefaultChromaTenant, "databases": []string{"*"}})
+	})
+	// Tenants and databases exist as soon as they are named.
+	s.mux.HandleFunc("POST "+tenants, acceptEmbedded)
+	s.mux.HandleFunc("GET "+tenants+"/{tenant}", func(w http.ResponseWriter, r *http.Request) {
+		writeMockJSON(w, map[string]any{"name": r.PathValue("tenant")})
+	})
+	s.mux.HandleFunc("POST "+dbs, acceptEmbedded)
+	s.mux.HandleFunc("GET "+dbs+"/{database}", func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("database")
+		writeMockJSON(w, map[string]any{"id": name, "name": name, "tenant": r.PathValue("tenant")})
+	})
+	s.mux.HandleFunc("GET "+cols+"_count", s.countCollections)
+	s.mux.HandleFunc("GET "+cols, s.listCollections)
+	s.mux.HandleFunc("POST "+cols, s.createCollection)
+	s.mux.HandleFunc("GET "+cols+"/{name}", s.getCollection)
+	s.mux.HandleFunc("PUT "+cols+"/{name}", s.updateCollection)
+	s.mux.HandleFunc("DELETE "+cols+"/{name}", s.deleteCollection)
+	s.mux.HandleFunc("GET "+cols+"/{name}/count", s.count)
+	s.mux.HandleFunc("POST "+cols+"/{name}/add", s.write(embeddedAdd))
+	s.mux.HandleFunc("POST "+cols+"/{name}/upsert", s.write(embeddedUpsert))
+	s.mux.HandleFunc("POST "+cols+"/{name}/update", s.write(embeddedUpdate))
+	s.mux.HandleFunc("POST "+cols+"/{name}/get", s.get)
+	s.mux.HandleFunc("POST "+cols+"/{name}/delete", s.delete)
+	s.mux.HandleFunc("POST "+cols+"/{name}/query", s.query)
+	return s
+}
+
+// OpenEmbeddedStore opens the embedded store in dir (empty uses
+// DefaultEmbeddedStorePath) and points opts at it, so every request is
+// served in process. The returned func closes the store.
+func OpenEmbeddedStore(dir string, opts *ChromaOptions) (func() error, error) {
+	s, err := openEmbeddedStore(context.Background(), dir)
+	if err != nil {
+		return nil, err
+	}
+	opts.transport = handlerTransport{s.mux}
+	return s.Close, nil
+}
+
+// Close closes the database.
+func (s *embeddedStore) Close() error {
+	return s.db.Close()
+}
+
+// bind rewrites the placeholders of query for the store's database.
+func (s *embeddedStore) bind(query string) string {
+	if !s.dialect.numbered {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r != '?' {
+			b.WriteRune(r)
+			continue
+		}
+		n++
+		fmt.Fprintf(&b, "$%d", n)
+	}
+	return b.String()
+}
+
+// serve listens on the host and port of baseURL, the address Codex's Chroma
+// MCP server is configured with, and serves the store there until the
+// returned func is called. It returns the URL actually listened on, which
+// differs from baseURL only when baseURL asks for port 0.
+func (s *embeddedStore) serve(baseURL string) (string, func() error, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Scheme != "http" || u.Port() == "" {
+		return "", nil, fmt.Errorf("%s store: --chroma-url %q must be http://host:port", s.dialect.name, baseURL)
+	}
+	ln, err := net.Listen("tcp", u.Host)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s store: listen on %s (is a Chroma server already running there?): %w",
+			s.dialect.name, u.Host, err)
+	}
+	srv := &http.Server{Handler: s.mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() { _ = srv.Serve(ln) }()
+	u.Host = ln.Addr().String()
+	return u.String(), func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return srv.Shutdown(ctx)
+	}, nil
+}
+
+// serveEmbeddedStore opens the store opts.Store selects, under
+// opts.StorePath or at opts.StoreDSN, and serves it at opts.Chroma.URL for
+// the run; the indexer's own requests stay in process. The returned func
+// stops serving and closes the store.
+func serveEmbeddedStore(opts *Options) (func() error, error) {
+	var (
+		s   *embeddedStore
+		err error
+	)
+	if opts.Store == StorePgvector {
+		s, err = openPgvectorStore(context.Background(), opts.StoreDSN)
+	} else {
+		s, err = openEmbeddedStore(context.Background(), opts.StorePath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	served, stop, err := s.serve(cmp.Or(opts.Chroma.URL, DefaultChromaURL))
+	if err != nil {
+		return nil, errors.Join(err, s.Close())
+	}
+	opts.Chroma.URL = served
+	opts.Chroma.transport = handlerTransport{s.mux}
+	return func() error { return errors.Join(stop(), s.Close()) }, nil
+}
+
+// acceptEmbedded answers requests that need no work.
+func acceptEmbedded(w http.ResponseWriter, _ *http.Request) {
+	writeMockJSON(w, map[string]any{})
+}
+
+// embeddedError writes a Chroma-style error.
+func embeddedError(w http.ResponseWriter, status int, kind, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": kind, "message": message})
+}
+
+func embeddedInternal(w http.ResponseWriter, err error) {
+	embeddedError(w, http.StatusInternalServerError, "InternalError", err.Error())
+}
+
+func embeddedInvalid(w http.ResponseWriter, format string, args ...any) {
+	embeddedError(w, http.StatusBadRequest, "InvalidArgumentError", fmt.Sprintf(format, args...))
+}
+
+// embeddedCollection is a stored collection, written in the shape the
+// Chroma clients parse.
+type embeddedCollection struct {
+	Metadata      map[string]any `json:"metadata"`
+	Configuration map[string]any `json:"configuration_json"`
+	Dimension     *int           `json:"dimension"`
+	ID            string         `json:"id"`
+	Name          string         `json:"name"`
+	Tenant        string         `json:"tenant"`
+	Database      string         `json:"database"`
+	LogPosition   int            `json:"log_position"`
+	Version       int            `json:"version"`
+}
+
+const collectionColumns = "id, name, tenant, database, metadata"
+
+func scanCollection(row interface{ Scan(...any) error }) (embeddedCollection, error) {
+	c := embeddedCollection{Configuration: map[string]any{}}
+	var metadata string
+	if err := row.Scan(&c.ID, &c.Name, &c.Tenant, &c.Database, &metadata); err != nil {
+		return c, err
+	}
+	return c, json.Unmarshal([]byte(metadata), &c.Metadata)
+}
+
+// collection looks up the request's collection by name or ID, writing a
+// not-found error when it does not exist.
+func (s *embeddedStore) collection(w http.ResponseWriter, r *http.Request) (embeddedCollection, bool) {
+	key := r.PathValue("name")
+	c, err := scanCollection(s.db.QueryRowContext(r.Context(),
+		s.bind(`SELECT `+collectionColumns+` FROM collections
+		 WHERE tenant = ? AND database = ? AND (name = ? OR id = ?)`),
+		r.PathValue("tenant"), r.PathValue("database"), key, key))
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		embeddedError(w, http.StatusNotFound, "NotFoundError", fmt.Sprintf("Collection [%s] does not exist", key))
+		return c, false
+	case err != nil:
+		embeddedInternal(w, err)
+		return c, false
+	}
+	return c, true
+}
+
+func (s *embeddedStore) countCollections(w http.ResponseWriter, r *http.Request) {
+	var n int
+	err := s.db.QueryRowContext(r.Context(), s.bind(`SELECT COUNT(*) FROM collections WHERE tenant = ? AND database = ?`),
+		r.PathValue("tenant"), r.PathValue("database")).Scan(&n)
+	if err != nil {
+		embeddedInternal(w, err)
+		return
+	}
+	writeMockJSON(w, n)
+}
+
+func (s *embeddedStore) listCollections(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	if limit <= 0 {
+		limit = math.MaxInt32
+	}
+	rows, err := s.db.QueryContext(r.Context(),
+		s.bind(`SELECT `+collectionColumns+` FROM collections WHERE tenant = ? AND database = ?
+		 ORDER BY `+s.dialect.seq+` LIMIT ? OFFSET ?`),
+		r.PathValue("tenant"), r.PathValue("database"), limit, max(offset, 0))
+	if err != nil {
+		embeddedInternal(w, err)
+		return
+	}
+	defer rows.Close()
+	out := []embeddedCollection{}
+	for rows.Next() {
+		c, err := scanCollection(rows)
+		if err != nil {
+			embeddedInternal(w, err)
+			return
+		}
+		out = append(out, c)
+	}
+	if err := rows.Err(); err != nil {
+		embeddedInternal(w, err)
+		return
+	}
+	writeMockJSON(w, out)
+}
+
+func (s *embeddedStore) createCollection(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Metadata    map[string]any `json:"metadata"`
+		Name        string         `json:"name"`
+		GetOrCreate bool           `json:"get_or_create"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		embeddedInvalid(w, "invalid create collection request")
+		return
+	}
+	c := embeddedCollection{
+		Metadata:      req.Metadata,
+		Configuration: map[string]any{},
+		ID:            newEmbeddedID(),
+		Name:          req.Name,
+		Tenant:        r.PathValue("tenant"),
+		Database:      r.PathValue("database"),
+	}
+	metadata, _ := json.Marshal(req.Metadata)
+	res, err := s.db.ExecContext(r.Context(),
+		s.bind(`INSERT INTO collections (id, name, tenant, database, metadata) VALUES (?, ?, ?, ?, ?)
+		 ON CONFLICT (tenant, database, name) DO NOTHING`),
+		c.ID, c.Name, c.Tenant, c.Database, string(metadata))
+	if err != nil {
+		embeddedInternal(w, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		if !req.GetOrCreate {
+			embeddedError(w, http.StatusConflict, "UniqueConstraintError",
+				fmt.Sprintf("Collection %s already exists", req.Name))
+			return
+		}
+		r.SetPathValue("name", req.Name)
+		s.getCollection(w, r)
+		return
+	}
+	writeMockJSON(w, c)
+}
+
+func (s *embeddedStore) getCollection(w http.ResponseWriter, r *http.Request) {
+	if c, ok := s.collection(w, r); ok {
+		writeMockJSON(w, c)
+	}
+}
+
+func (s *embeddedStore) updateCollection(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		NewMetadata map[string]any `json:"new_metadata"`
+		NewName     string         `json:"new_name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		embeddedInvalid(w, "invalid update collection request")
+		return
+	}
+	c, ok := s.collection(w, r)
+	if !ok {
+		return
+	}
+	if req.NewName != "" {
+		c.Name = req.NewName
+	}
+	if req.NewMetadata != nil {
+		c.Metadata = req.NewMetadata
+	}
+	metadata, _ := json.Marshal(c.Metadata)
+	_, err := s.db.ExecContext(r.Context(), s.bind(`UPDATE collections SET name = ?, metadata = ? WHERE id = ?`),
+		c.Name, string(metadata), c.ID)
+	switch {
+	case err != nil && strings.Contains(strings.ToLower(err.Error()), "unique"):
+		embeddedError(w, http.StatusConflict, "UniqueConstraintError",
+			fmt.Sprintf("Collection %s already exists", c.Name))
+	case err != nil:
+		embeddedInternal(w, err)
+	default:
+		writeMockJSON(w, map[string]any{})
+	}
+}
+
+func (s *embeddedStore) deleteCollection(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.collection(w, r)
+	if !ok {
+		return
+	}
+	err := s.inTx(r.Context(), func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(r.Context(), s.bind(`DELETE FROM records WHERE collection_id = ?`), c.ID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(r.Context(), s.bind(`DELETE FROM collections WHERE id = ?`), c.ID)
+		return err
+	})
+	if err != nil {
+		embeddedInternal(w, err)
+		return
+	}
+	writeMockJSON(w, map[string]any{})
+}
+
+func (s *embeddedStore) count(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.collection(w, r)
+	if !ok {
+		return
+	}
+	var n int
+	if err := s.db.QueryRowContext(r.Context(), s.bind(`SELECT COUNT(*) FROM records WHERE collection_id = ?`),
+		c.ID).Scan(&n); err != nil {
+		embeddedInternal(w, err)
+		return
+	}
+	writeMockJSON(w, n)
+}
+
+// inTx runs fn in a transaction, committing when it succeeds.
+func (s *embeddedStore) inTx(ctx context.Context, fn func(*sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	return tx.Commit()
+}
+
+// embeddedRecord is one stored record.
+type embeddedRecord struct {
+	metadata  map[string]any
+	document  *string
+	id        string
+	embedding []float64
+}
+
+// records loads the collection's records in insertion order.
+func (s *embeddedStore) records(ctx context.Context, collectionID string) ([]embeddedRecord, error) {
+	return s.scanRecords(ctx,
+		`SELECT id, document, metadata, embedding FROM records WHERE collection_id = ? ORDER BY `+s.dialect.seq,
+		collectionID)
+}
+
+// nearest loads the n records of the collection closest to query in
+// space, ranked by pgvector. Records with embeddings of another size are
+// left out.
+func (s *embeddedStore) nearest(
+	ctx context.Context, collectionID, space string, query []float64, n int,
+) ([]embeddedRecord, error) {
+	if len(query) == 0 {
+		return nil, nil
+	}
+	op := "<->"
+	switch space {
+	case "cosine":
+		op = "<=>"
+	case "ip":
+		op = "<#>"
+	}
+	vector, err := json.Marshal(query)
+	if err != nil {
+		return nil, err
+	}
+	return s.scanRecords(ctx,
+		`SELECT id, document, metadata, embedding FROM records
+		 WHERE collection_id = ? AND vector_dims(embedding) = ?
+		 ORDER BY embedding `+op+` ?::vector, `+s.dialect.seq+` LIMIT ?`,
+		collectionID, len(query), string(vector), n)
+}
+
+// scanRecords loads the records query selects.
+func (s *embeddedStore) scanRecords(ctx context.Context, query string, args ...any) ([]embeddedRecord, error) {
+	rows, err := s.db.QueryContext(ctx, s.bind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var recs []embeddedRecord
+	for rows.Next() {
+		var (
+			rec       embeddedRecord
+			metadata  string
+			embedding sql.NullString
+		)
+		if err := rows.Scan(&rec.id, &rec.document, &metadata, &embedding); err != nil {
+			return nil, err
+		}
+		if err := rec.decode(metadata, embedding); err != nil {
+			return nil, err
+		}
+		recs = append(recs, rec)
+	}
+	return recs, rows.Err()
+}
+
+// decode parses a record's stored metadata and embedding. pgvector writes
+// vectors as JSON arrays, and a NULL embedding is none.
+func (rec *embeddedRecord) decode(metadata string, embedding sql.NullString) error {
+	if err := json.Unmarshal([]byte(metadata), &rec.metadata); err != nil {
+		return fmt.Errorf("record %s metadata: %w", rec.id, err)
+	}
+	if !embedding.Valid {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(embedding.String), &rec.embedding); err != nil {
+		return fmt.Errorf("record %s embedding: %w", rec.id, err)
+	}
+	return nil
+}
+
+// Record writes: add keeps existing records, update changes only existing
+// ones, and upsert does both.
+const (
+	embeddedAdd = iota
+	embeddedUpdate
+	embeddedUpsert
+)
+
+// write serves add, update, and upsert. Fields a request omits keep their
+// stored values, and metadata is merged key by key, a null value removing
+// the key, as Chroma does.
+func (s *embeddedStore) write(mode int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Embeddings json.RawMessage  `json:"embeddings"`
+			Documents  []*string        `json:"documents"`
+			Metadatas  []map[string]any `json:"metadatas"`
+			IDs        []string         `json:"ids"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			embeddedInvalid(w, "invalid write request: %v", err)
+			return
+		}
+		embeddings, err := decodeEmbeddings(req.Embeddings)
+		if err != nil {
+			embeddedInvalid(w, "%v", err)
+			return
+		}
+		for name, n := range map[string]int{
+			"embeddings": len(embeddings),
+			"documents":  len(req.Documents),
+			"metadatas":  len(req.Metadatas),
+		} {
+			if n > 0 && n != len(req.IDs) {
+				embeddedInvalid(w, "%d ids but %d %s", len(req.IDs), n, name)
+				return
+			}
+		}
+		c, ok := s.collection(w, r)
+		if !ok {
+			return
+		}
+		err = s.inTx(r.Context(), func(tx *sql.Tx) error {
+			for i, id := range req.IDs {
+				rec, exists, err := s.storedRecord(r.Context(), tx, c.ID, id)
+				if err != nil {
+					return err
+				}
+				if (exists && mode == embeddedAdd) || (!exists && mode == embeddedUpdate) {
+					continue
+				}
+				if i < len(embeddings) {
+					rec.embedding = embeddings[i]
+				}
+				if i < len(req.Documents) {
+					rec.document = req.Documents[i]
+				}
+				if i < len(req.Metadatas) {
+					rec.metadata = mergeMetadata(rec.metadata, req.Metadatas[i])
+				}
+				if err := s.putRecord(r.Context(), tx, c.ID, id, rec); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			embeddedInternal(w, err)
+			return
+		}
+		writeMockJSON(w, map[string]any{})
+	}
+}
+
+// storedRecord reads one record inside tx.
+func (s *embeddedStore) storedRecord(
+	ctx context.Context, tx *sql.Tx, collectionID, id string,
+) (embeddedRecord, bool, error) {
+	rec := embeddedRecord{id: id}
+	var (
+		metadata  string
+		embedding sql.NullString
+	)
+	err := tx.QueryRowContext(ctx,
+		s.bind(`SELECT document, metadata, embedding FROM records WHERE collection_id = ? AND id = ?`),
+		collectionID, id).Scan(&rec.document, &metadata, &embedding)
+	if errors.Is(err, sql.ErrNoRows) {
+		return rec, false, nil
+	}
+	if err != nil {
+		return rec, false, err
+	}
+	return rec, true, rec.decode(metadata, embedding)
+}
+
+// putRecord inserts or replaces one record inside tx, keeping its position.
+func (s *embeddedStore) putRecord(
+	ctx context.Context, tx *sql.Tx, collectionID, id string, rec embeddedRecord,
+) error {
+	metadata, err := json.Marshal(rec.metadata)
+	if err != nil {
+		return fmt.Errorf("record %s metadata: %w", id, err)
+	}
+	var embedding any
+	if len(rec.embedding) > 0 || !s.dialect.vector {
+		b, err := json.Marshal(rec.embedding)
+		if err != nil {
+			return fmt.Errorf("record %s embedding: %w", id, err)
+		}
+		embedding = string(b)
+	}
+	_, err = tx.ExecContext(ctx,
+		s.bind(`INSERT INTO records (collection_id, id, document, metadata, embedding) VALUES (?, ?, ?, ?, ?)
+		 ON CONFLICT (collection_id, id) DO UPDATE
+		 SET document = excluded.document, metadata = excluded.metadata, embedding = excluded.embedding`),
+		collectionID, id, rec.document, string(metadata), embedding)
+	return err
+}
+
+// mergeMetadata applies update to stored; null values remove keys.
+func mergeMetadata(stored, update map[string]any) map[string]any {
+	if update == nil {
+		return stored
+	}
+	merged := make(map[string]any, len(stored)+len(update))
+	for k, v := range stored {
+		merged[k] = v
+	}
+	for k, v := range update {
+		if v == nil {
+			delete(merged, k)
+		} else {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+// decodeEmbeddings accepts embeddings as arrays of numbers or, as newer
+// Chroma clients send them, as base64-encoded little-endian float32s.
+func decodeEmbeddings(raw json.RawMessage) ([][]float64, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var floats [][]float64
+	if err := json.Unmarshal(raw, &floats); err == nil {
+		return floats, nil
+	}
+	var encoded []string
+	if err := json.Unmarshal(raw, &encoded); err != nil {
+		return nil, errors.New("embeddings must be arrays of numbers or base64 strings")
+	}
+	floats = make([][]float64, len(encoded))
+	for i, e := range encoded {
+		b, err := base64.StdEncoding.DecodeString(e)
+		if err != nil || len(b)%4 != 0 {
+			return nil, fmt.Errorf("embedding %d is not base64-encoded float32s", i)
+		}
+		floats[i] = make([]float64, len(b)/4)
+		for j := range floats[i] {
+			floats[i][j] = float64(math.Float32frombits(binary.LittleEndian.Uint32(b[j*4:])))
+		}
+	}
+	return floats, nil
+}
+
+// embeddedFilter is the record selection shared by get, delete, and query.
+type embeddedFilter struct {
+	Where         map[string]any `json:"where"`
+	WhereDocument map[string]any `json:"where_document"`
+	IDs           []string       `json:"ids"`
+}
+
+// matching returns the collection's records that pass f.
+func (s *embeddedStore) matching(ctx context.Context, collectionID string, f embeddedFilter) ([]embeddedRecord, error) {
+	recs, err := s.records(ctx, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	var out []embeddedRecord
+	for _, rec := range recs {
+		if f.IDs != nil && !slices.Contains(f.IDs, rec.id) {
+			continue
+		}
+		ok, err := matchWhere(rec.metadata, f.Where)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if ok, err = matchWhereDocument(rec.document, f.WhereDocument); err != nil {
+			return nil, err
+		} else if ok {
+			out = append(out, rec)
+		}
+	}
+	return out, nil
+}
+
+// includes reports whether a get or query request asked for field, using
+// Chroma's defaults when it named none.
+func includes(include []string, field string, defaults ...string) bool {
+	if include == nil {
+		include = defaults
+	}
+	return slices.Contains(include, field)
+}
+
+func (s *embeddedStore) get(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		embeddedFilter
+		Include []string `json:"include"`
+		Limit   int      `json:"limit"`
+		Offset  int      `json:"offset"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		embeddedInvalid(w, "invalid get request: %v", err)
+		return
+	}
+	c, ok := s.collection(w, r)
+	if !ok {
+		return
+	}
+	recs, err := s.matching(r.Context(), c.ID, req.embeddedFilter)
+	if err != nil {
+		embeddedInvalid(w, "%v", err)
+		return
+	}
+	recs = recs[min(max(req.Offset, 0), len(recs)):]
+	if req.Limit > 0 && len(recs) > req.Limit {
+		recs = recs[:req.Limit]
+	}
+
+	out := map[string]any{"include": req.Include}
+	ids := make([]string, len(recs))
+	var (
+		documents  []*string
+		metadatas  []map[string]any
+		embeddings [][]float64
+	)
+	for i, rec := range recs {
+		ids[i] = rec.id
+		documents = append(documents, rec.document)
+		metadatas = append(metadatas, rec.metadata)
+		embeddings = append(embeddings, rec.embedding)
+	}
+	out["ids"] = ids
+	if includes(req.Include, "documents", "documents", "metadatas") {
+		out["documents"] = documents
+	}
+	if includes(req.Include, "metadatas", "documents", "metadatas") {
+		out["metadatas"] = metadatas
+	}
+	if includes(req.Include, "embeddings") {
+		out["embeddings"] = embeddings
+	}
+	writeMockJSON(w, out)
+}
+
+func (s *embeddedStore) delete(w http.ResponseWriter, r *http.Request) {
+	var req embeddedFilter
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		embeddedInvalid(w, "invalid delete request: %v", err)
+		return
+	}
+	c, ok := s.collection(w, r)
+	if !ok {
+		return
+	}
+	recs, err := s.matching(r.Context(), c.ID, req)
+	if err != nil {
+		embeddedInvalid(w, "%v", err)
+		return
+	}
+	err = s.inTx(r.Context(), func(tx *sql.Tx) error {
+		for _, rec := range recs {
+			if _, err := tx.ExecContext(r.Context(), s.bind(`DELETE FROM records WHERE collection_id = ? AND id = ?`),
+				c.ID, rec.id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		embeddedInternal(w, err)
+		return
+	}
+	writeMockJSON(w, map[string]any{"deleted": len(recs)})
+}
+
+func (s *embeddedStore) query(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		embeddedFilter
+		QueryEmbeddings json.RawMessage `json:"query_embeddings"`
+		Include         []string        `json:"include"`
+		NResults        int             `json:"n_results"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		embeddedInvalid(w, "invalid query request: %v", err)
+		return
+	}
+	queries, err := decodeEmbeddings(req.QueryEmbeddings)
+	if err != nil {
+		embeddedInvalid(w, "%v", err)
+		return
+	}
+	if req.NResults <= 0 {
+		req.NResults = 10
+	}
+	c, ok := s.collection(w, r)
+	if !ok {
+		return
+	}
+	space, _ := c.Metadata["hnsw:space"].(string)
+	// pgvector ranks unfiltered queries; filters are evaluated here.
+	ranked := s.dialect.vector && req.IDs == nil && len(req.Where) == 0 && len(req.WhereDocument) == 0
+	var recs []embeddedRecord
+	if !ranked {
+		if recs, err = s.matching(r.Context(), c.ID, req.embeddedFilter); err != nil {
+			embeddedInvalid(w, "%v", err)
+			return
+		}
+	}
+
+	var (
+		ids        = make([][]string, len(queries))
+		distances  = make([][]float64, len(queries))
+		documents  = make([][]*string, len(queries))
+		metadatas  = make([][]map[string]any, len(queries))
+		embeddings = make([][][]float64, len(queries))
+	)
+	for q, query := range queries {
+		type hit struct {
+			rec      embeddedRecord
+			distance float64
+		}
+		candidates := recs
+		if ranked {
+			if candidates, err = s.nearest(r.Context(), c.ID, space, query, req.NResults); err != nil {
+				embeddedInternal(w, err)
+				return
+			}
+		}
+		var hits []hit
+		for _, rec := range candidates {
+			if len(rec.embedding) != len(query) {
+				continue
+			}
+			hits = append(hits, hit{rec: rec, distance: embeddingDistance(space, query, rec.embedding)})
+		}
+		slices.SortStableFunc(hits, func(a, b hit) int {
+			return compareFloat(a.distance, b.distance)
+		})
+		hits = hits[:min(req.NResults, len(hits))]
+		ids[q], distances[q] = []string{}, []float64{}
+		for _, h := range hits {
+			ids[q] = append(ids[q], h.rec.id)
+			distances[q] = append(distances[q], h.distance)
+			documents[q] = append(documents[q], h.rec.document)
+			metadatas[q] = append(metadatas[q], h.rec.metadata)
+			embeddings[q] = append(embeddings[q], h.rec.embedding)
+		}
+	}
+
+	out := map[string]any{"ids": ids, "include": req.Include}
+	defaults := []string{"documents", "metadatas", "distances"}
+	if includes(req.Include, "distances", defaults...) {
+		out["distances"] = distances
+	}
+	if includes(req.Include, "documents", defaults...) {
+		out["documents"] = documents
+	}
+	if includes(req.Include, "metadatas", defaults...) {
+		out["metadatas"] = metadatas
+	}
+	if includes(req.Include, "embeddings", defaults...) {
+		out["embeddings"] = embeddings
+	}
+	writeMockJSON(w, out)
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// embeddingDistance is Chroma's distance between two embeddings in space:
+// "cosine", "ip" (inner product), or squared euclidean for anything else.
+func embeddingDistance(space string, a, b []float64) float64 {
+	var dot, normA, normB, l2 float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+		l2 += (a[i] - b[i]) * (a[i] - b[i])
+	}
+	switch space {
+	case "cosine":
+		if normA == 0 || normB == 0 {
+			return 1
+		}
+		return 1 - dot/math.Sqrt(normA*normB)
+	case "ip":
+		return 1 - dot
+	default:
+		return l2
+	}
+}
+
+// matchWhere evaluates a Chroma metadata filter: field equality, the
+// comparison operators $eq, $ne, $gt, $gte, $lt, $lte, $in, and $nin, and
+// $and/$or over nested filters. An empty filter matches everything.
+func matchWhere(md, where map[string]any) (bool, error) {
+	for key, cond := range where {
+		var (
+			ok  bool
+			err error
+		)
+		switch key {
+		case "$and", "$or":
+			ok, err = matchClauses(key, cond, func(clause map[string]any) (bool, error) {
+				return matchWhere(md, clause)
+			})
+		default:
+			ok, err = matchField(md[key], cond)
+		}
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// matchClauses evaluates the clauses of $and or $or with match.
+func matchClauses(op string, clauses any, match func(map[string]any) (bool, error)) (bool, error) {
+	list, ok := clauses.([]any)
+	if !ok {
+		return false, fmt.Errorf("%s expects a list of filters", op)
+	}
+	for _, c := range list {
+		clause, ok := c.(map[string]any)
+		if !ok {
+			return false, fmt.Errorf("%s expects a list of filters", op)
+		}
+		matched, err := match(clause)
+		if err != nil {
+			return false, err
+		}
+		if matched == (op == "$or") {
+			return matched, nil
+		}
+	}
+	return op == "$and", nil
+}
+
+// matchField evaluates one field's condition against its value, which is
+// nil when the record lacks the field.
+func matchField(value, cond any) (bool, error) {
+	ops, ok := cond.(map[string]any)
+	if !ok {
+		return value != nil && metadataEqual(value, cond), nil
+	}
+	for op, operand := range ops {
+		var matched bool
+		switch op {
+		case "$eq":
+			matched = value != nil && metadataEqual(value, operand)
+		case "$ne":
+			matched = value == nil || !metadataEqual(value, operand)
+		case "$gt", "$gte", "$lt", "$lte":
+			a, aok := value.(float64)
+			b, bok := operand.(float64)
+			if !bok {
+				return false, fmt.Errorf("%s expects a number", op)
+			}
+			matched = aok && (op == "$gt" && a > b || op == "$gte" && a >= b ||
+				op == "$lt" && a < b || op == "$lte" && a <= b)
+		case "$in", "$nin":
+			list, ok := operand.([]any)
+			if !ok {
+				return false, fmt.Errorf("%s expects a list", op)
+			}
+			in := value != nil && slices.ContainsFunc(list, func(v any) bool { return metadataEqual(value, v) })
+			matched = in == (op == "$in")
+		default:
+			return false, fmt.Errorf("unsupported where operator %s", op)
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// metadataEqual compares decoded JSON scalars; lists and objects never
+// match.
+func metadataEqual(a, b any) bool {
+	switch a.(type) {
+	case string, float64, bool:
+		return a == b
+	}
+	return false
+}
+
+// matchWhereDocument evaluates a Chroma document filter: $contains,
+// $not_contains, $regex, and $not_regex, combined with $and/$or.
+func matchWhereDocument(document *string, where map[string]any) (bool, error) {
+	var doc string
+	if document != nil {
+		doc = *document
+	}
+	for op, operand := range where {
+		var (
+			ok  bool
+			err error
+		)
+		switch op {
+		case "$and", "$or":
+			ok, err = matchClauses(op, operand, func(clause map[string]any) (bool, error) {
+				return matchWhereDocument(document, clause)
+			})
+		case "$contains", "$not_contains":
+			text, isText := operand.(string)
+			if !isText {
+				return false, fmt.Errorf("%s expects a string", op)
+			}
+			ok = strings.Contains(doc, text) == (op == "$contains")
+		case "$regex", "$not_regex":
+			pattern, isText := operand.(string)
+			if !isText {
+				return false, fmt.Errorf("%s expects a string", op)
+			}
+			re, compileErr := regexp.Compile(pattern)
+			if compileErr != nil {
+				return false, fmt.Errorf("%s: %w", op, compileErr)
+			}
+			ok = re.MatchString(doc) == (op == "$regex")
+		default:
+			return false, fmt.Errorf("unsupported where_document operator %s", op)
+		}
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// newEmbeddedID returns a random UUID for a new collection.
+func newEmbeddedID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,151 @@
+package indexer
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEmbeddedStorePersists(t *testing.T) {
+	dir := t.TempDir()
+	var opts ChromaOptions
+	closeStore, err := OpenEmbeddedStore(dir, &opts)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	client := newChromaClient(opts)
+	col, err := client.createCollection(t.Context(), "api", map[string]any{"repo": "api"})
+	if err != nil {
+		t.Fatalf("create collection: %v", err)
+	}
+	overview, auth := "Service overview", "Token validation for the auth module"
+	err = client.upsertRecords(t.Context(), col.ID, chromaRecords{
+		IDs:       []string{"overview", "auth"},
+		Documents: []*string{&overview, &auth},
+		Metadatas: []map[string]any{
+			{"kind": "repo_overview", "path": "ROOT"},
+			{"kind": "module_summary", "path": "internal/auth"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	if err := closeStore(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	opts = ChromaOptions{}
+	closeStore, err = OpenEmbeddedStore(dir, &opts)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	t.Cleanup(func() { _ = closeStore() })
+
+	var out bytes.Buffer
+	err = Query(t.Context(), &out, QueryOptions{
+		Chroma: opts, Collection: "api", Kind: "module_summary", Text: "token", Format: QueryFormatPaths,
+	})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if got := strings.TrimSpace(out.String()); got != "internal/auth" {
+		t.Fatalf("expected internal/auth, got %q", got)
+	}
+
+	client = newChromaClient(opts)
+	if _, err := client.createCollection(t.Context(), "api", nil); err == nil {
+		t.Fatal("expected creating an existing collection to fail")
+	}
+	n, err := client.countRecords(t.Context(), col.ID)
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 records after reopening, got %d (%v)", n, err)
+	}
+}
+
+func TestMatchWhere(t *testing.T) {
+	md := map[string]any{"kind": "module_summary", "chunk": float64(2), "path": "internal/auth"}
+	tests := map[string]struct {
+		where map[string]any
+		want  bool
+	}{
+		"empty":        {where: nil, want: true},
+		"equal":        {where: map[string]any{"kind": "module_summary"}, want: true},
+		"not equal":    {where: map[string]any{"kind": "concept"}},
+		"missing":      {where: map[string]any{"language": "go"}},
+		"$ne missing":  {where: map[string]any{"language": map[string]any{"$ne": "go"}}, want: true},
+		"$gte":         {where: map[string]any{"chunk": map[string]any{"$gte": float64(2)}}, want: true},
+		"$lt":          {where: map[string]any{"chunk": map[string]any{"$lt": float64(2)}}},
+		"$in":          {where: map[string]any{"kind": map[string]any{"$in": []any{"concept", "module_summary"}}}, want: true},
+		"$nin":         {where: map[string]any{"kind": map[string]any{"$nin": []any{"module_summary"}}}},
+		"$and":         {where: map[string]any{"$and": []any{map[string]any{"kind": "module_summary"}, map[string]any{"path": "ROOT"}}}},
+		"$or":          {where: map[string]any{"$or": []any{map[string]any{"kind": "concept"}, map[string]any{"path": "internal/auth"}}}, want: true},
+		"list operand": {where: map[string]any{"kind": []any{"module_summary"}}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := matchWhere(md, tc.where)
+			if err != nil {
+				t.Fatalf("match: %v", err)
+			}
+			if got != tc.want {
+				t.Fatalf("expected %t, got %t", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestServeEmbeddedStoreQuery(t *testing.T) {
+	opts := Options{StorePath: t.TempDir(), Chroma: ChromaOptions{URL: "http://127.0.0.1:0"}}
+	stop, err := serveEmbeddedStore(&opts)
+	if err != nil {
+		t.Fatalf("serve: %v", err)
+	}
+	t.Cleanup(func() { _ = stop() })
+
+	// Codex's MCP server reaches the store over the network, not through
+	// the in-process transport.
+	client := newChromaClient(ChromaOptions{URL: opts.Chroma.URL})
+	col, err := client.createCollection(t.Context(), "api", map[string]any{"hnsw:space": "cosine"})
+	if err != nil {
+		t.Fatalf("create collection: %v", err)
+	}
+	err = client.addRecords(t.Context(), col.ID, chromaRecords{
+		IDs:        []string{"north", "east", "northeast"},
+		Embeddings: [][]float64{{0, 1}, {1, 0}, {1, 1}},
+	})
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+
+	var got struct {
+		IDs       [][]string  `json:"ids"`
+		Distances [][]float64 `json:"distances"`
+	}
+	req := map[string]any{"query_embeddings": [][]float64{{0.1, 1}}, "n_results": 2}
+	err = client.do(t.Context(), http.MethodPost, client.collectionsPath()+"/"+col.ID+"/query", req, &got)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if want := [][]string{{"north", "northeast"}}; !reflect.DeepEqual(got.IDs, want) {
+		t.Fatalf("expected %v, got %v", want, got.IDs)
+	}
+	if d := got.Distances[0]; len(d) != 2 || d[0] >= d[1] {
+		t.Fatalf("expected ascending distances, got %v", d)
+	}
+}
+
+func TestDecodeEmbeddings(t *testing.T) {
+	// 1.0 and -2.0 as little-endian float32s.
+	raw, _ := json.Marshal([]string{"AACAPwAAAMA="})
+	got, err := decodeEmbeddings(raw)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if want := [][]float64{{1, -2}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
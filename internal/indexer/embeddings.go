@@ -0,0 +1,313 @@
+package indexer
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Embedders selectable with EmbeddingOptions.Provider.
+const (
+	// EmbedderHash embeds documents by feature hashing their words; it
+	// needs no model or network.
+	EmbedderHash = "hash"
+	// EmbedderOpenAI embeds documents with the OpenAI embeddings API or a
+	// compatible server.
+	EmbedderOpenAI = "openai"
+	// EmbedderOllama embeds documents with a local Ollama daemon, so
+	// nothing leaves the machine.
+	EmbedderOllama = "ollama"
+)
+
+// DefaultOpenAIURL is the OpenAI API base URL.
+const DefaultOpenAIURL = "https://api.openai.com/v1"
+
+// DefaultOpenAIEmbedModel is the model EmbedderOpenAI uses by default.
+const DefaultOpenAIEmbedModel = "text-embedding-3-small"
+
+// DefaultOllamaURL is the address a local Ollama daemon listens on.
+const DefaultOllamaURL = "http://localhost:11434"
+
+// DefaultOllamaEmbedModel is the model EmbedderOllama uses by default.
+const DefaultOllamaEmbedModel = "nomic-embed-text"
+
+// DefaultEmbedChunkChars is the size, in characters, above which documents
+// the indexer stores are split into chunks before they are embedded. It
+// stays well under the input limit of common embedding models.
+const DefaultEmbedChunkChars = 6000
+
+// openAIEmbedBatch caps the texts sent in one embeddings request, keeping
+// requests under the API's per-request token limit.
+const openAIEmbedBatch = 64
+
+// ollamaEmbedBatch caps the texts sent in one Ollama request, so a slow
+// CPU-only daemon answers each well within the client timeout.
+const ollamaEmbedBatch = 16
+
+// Metadata keys the embedding pipeline adds to the documents it stores.
+const (
+	// embeddingModelKey names the embedder and model that computed a
+	// record's embedding, so mixed models in a collection can be found.
+	embeddingModelKey = "embedding_model"
+	// chunkOfKey is the id of the document a chunk was split from.
+	chunkOfKey = "chunk_of"
+	// contentHashKey holds the SHA-256 of a record's document text, so an
+	// unchanged document is not embedded and upserted again.
+	contentHashKey = "content_hash"
+)
+
+// EmbeddingOptions selects how the indexer embeds the documents it stores
+// itself under IngestDirect and IngestLocal.
+type EmbeddingOptions struct {
+	// Provider is EmbedderHash (the default), EmbedderOpenAI, or
+	// EmbedderOllama.
+	Provider string
+	// Model is the embedding model; empty uses DefaultOpenAIEmbedModel or
+	// DefaultOllamaEmbedModel.
+	Model string
+	// URL is the base URL of the OpenAI API, a compatible server, or the
+	// Ollama daemon; empty uses DefaultOpenAIURL or DefaultOllamaURL.
+	URL string
+	// APIKey is sent as a bearer token. The OpenAI API requires one.
+	APIKey string
+	// ChunkChars splits longer documents into chunks that are embedded and
+	// stored separately; zero uses DefaultEmbedChunkChars.
+	ChunkChars int
+}
+
+// validate checks the options against the ingestion mode.
+func (o EmbeddingOptions) validate(ingest string) error {
+	switch o.Provider {
+	case "", EmbedderHash:
+	case EmbedderOpenAI, EmbedderOllama:
+		if ingest != IngestDirect && ingest != IngestLocal {
+			return fmt.Errorf("the %s embedder needs ingestion mode direct or local", o.Provider)
+		}
+		if o.Provider == EmbedderOpenAI && o.APIKey == "" && cmp.Or(o.URL, DefaultOpenAIURL) == DefaultOpenAIURL {
+			return fmt.Errorf("the %s embedder needs an API key", o.Provider)
+		}
+	default:
+		return fmt.Errorf("unknown embedder %q (want hash, openai, or ollama)", o.Provider)
+	}
+	if o.ChunkChars < 0 {
+		return fmt.Errorf("embedding chunk size must not be negative, got %d", o.ChunkChars)
+	}
+	return nil
+}
+
+// openAIEmbedder embeds texts with the OpenAI embeddings API.
+type openAIEmbedder struct {
+	http *http.Client
+	opts EmbeddingOptions
+}
+
+func newOpenAIEmbedder(opts EmbeddingOptions) *openAIEmbedder {
+	opts.URL = strings.TrimRight(cmp.Or(opts.URL, DefaultOpenAIURL), "/")
+	opts.Model = cmp.Or(opts.Model, DefaultOpenAIEmbedModel)
+	return &openAIEmbedder{http: &http.Client{Timeout: 2 * time.Minute}, opts: opts}
+}
+
+func (e *openAIEmbedder) name() string {
+	return EmbedderOpenAI + "/" + e.opts.Model
+}
+
+func (e *openAIEmbedder) embed(ctx context.Context, texts []string) ([][]float64, error) {
+	out := make([][]float64, 0, len(texts))
+	for start := 0; start < len(texts); start += openAIEmbedBatch {
+		batch, err := e.embedBatch(ctx, texts[start:min(start+openAIEmbedBatch, len(texts))])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, batch...)
+	}
+	return out, nil
+}
+
+func (e *openAIEmbedder) embedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	body, err := json.Marshal(map[string]any{"model": e.opts.Model, "input": texts})
+	if err != nil {
+		return nil, fmt.Errorf("encode embeddings request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.opts.URL+"/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("build embeddings request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.opts.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.opts.APIKey)
+	}
+
+	resp, err := e.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("embeddings: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read embeddings response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("embeddings: %d %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	var parsed struct {
+		Data []struct {
+			Embedding []float64 `json:"embedding"`
+			Index     int       `json:"index"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("decode embeddings response: %w", err)
+	}
+	out := make([][]float64, len(texts))
+	for _, d := range parsed.Data {
+		if d.Index < 0 || d.Index >= len(texts) {
+			return nil, fmt.Errorf("embeddings: index %d out of range", d.Index)
+		}
+		out[d.Index] = d.Embedding
+	}
+	for i, v := range out {
+		if len(v) == 0 {
+			return nil, fmt.Errorf("embeddings: no embedding for input %d", i)
+		}
+	}
+	return out, nil
+}
+
+// ollamaEmbedder embeds texts with the embed API of an Ollama daemon.
+type ollamaEmbedder struct {
+	http *http.Client
+	opts EmbeddingOptions
+}
+
+func newOllamaEmbedder(opts EmbeddingOptions) *ollamaEmbedder {
+	opts.URL = strings.TrimRight(cmp.Or(opts.URL, DefaultOllamaURL), "/")
+	opts.Model = cmp.Or(opts.Model, DefaultOllamaEmbedModel)
+	return &ollamaEmbedder{http: &http.Client{Timeout: 5 * time.Minute}, opts: opts}
+}
+
+func (e *ollamaEmbedder) name() string {
+	return EmbedderOllama + "/" + e.opts.Model
+}
+
+func (e *ollamaEmbedder) embed(ctx context.Context, texts []string) ([][]float64, error) {
+	out := make([][]float64, 0, len(texts))
+	for start := 0; start < len(texts); start += ollamaEmbedBatch {
+		batch, err := e.embedBatch(ctx, texts[start:min(start+ollamaEmbedBatch, len(texts))])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, batch...)
+	}
+	return out, nil
+}
+
+func (e *ollamaEmbedder) embedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	body, err := json.Marshal(map[string]any{"model": e.opts.Model, "input": texts})
+	if err != nil {
+		return nil, fmt.Errorf("encode ollama request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.opts.URL+"/api/embed", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("build ollama request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ollama embed (is the daemon running at %s?): %w", e.opts.URL, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read ollama response: %w", err)
+	}
+	var parsed struct {
+		Error      string      `json:"error"`
+		Embeddings [][]float64 `json:"embeddings"`
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		if json.Unmarshal(data, &parsed) == nil && parsed.Error != "" {
+			return nil, fmt.Errorf("ollama embed: %d %s", resp.StatusCode, parsed.Error)
+		}
+		return nil, fmt.Errorf("ollama embed: %d %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("decode ollama response: %w", err)
+	}
+	if len(parsed.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("ollama embed: got %d embeddings for %d inputs", len(parsed.Embeddings), len(texts))
+	}
+	return parsed.Embeddings, nil
+}
+
+// embedChunkChars is the size documents are chunked at before they are
+// embedded, never above Options.MaxDocChars.
+func (ix *indexer) embedChunkChars() int {
+	size := cmp.Or(ix.opts.Embeddings.ChunkChars, DefaultEmbedChunkChars)
+	if ix.opts.MaxDocChars > 0 {
+		size = min(size, ix.opts.MaxDocChars)
+	}
+	return size
+}
+
+// chunkRecords splits documents longer than size characters into chunks
+// with ids suffixed "-1", "-2", and so on, as the prompt has Codex do. Each
+// chunk carries "chunk", "chunks", and the id of its document in
+// "chunk_of". Shorter documents are returned as they are.
+func chunkRecords(recs []ingestRecord, size int) []ingestRecord {
+	out := make([]ingestRecord, 0, len(recs))
+	for _, rec := range recs {
+		parts := splitChunks(rec.Document, size)
+		if len(parts) < 2 {
+			out = append(out, rec)
+			continue
+		}
+		for i, part := range parts {
+			md := maps.Clone(rec.Metadata)
+			if md == nil {
+				md = make(map[string]any)
+			}
+			md["chunk"] = i + 1
+			md["chunks"] = len(parts)
+			md[chunkOfKey] = rec.ID
+			out = append(out, ingestRecord{ID: fmt.Sprintf("%s-%d", rec.ID, i+1), Document: part, Metadata: md})
+		}
+	}
+	return out
+}
+
+// splitChunks cuts text into pieces of at most size characters, breaking
+// after the last paragraph, line, or space in the second half of each
+// piece when there is one.
+func splitChunks(text string, size int) []string {
+	if size <= 0 {
+		return []string{text}
+	}
+	var parts []string
+	for utf8.RuneCountInString(text) > size {
+		window := truncateRunes(text, size)
+		cut := len(window)
+		for _, sep := range []string{"\n\n", "\n", " "} {
+			if i := strings.LastIndex(window, sep); i >= len(window)/2 {
+				cut = i + len(sep)
+				break
+			}
+		}
+		if part := strings.TrimSpace(text[:cut]); part != "" {
+			parts = append(parts, part)
+		}
+		text = text[cut:]
+	}
+	if rest := strings.TrimSpace(text); rest != "" || len(parts) == 0 {
+		parts = append(parts, rest)
+	}
+	return parts
+}
@@ -0,0 +1,267 @@
+package indexer
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSplitChunks(t *testing.T) {
+	tests := map[string]struct {
+		text string
+		size int
+		want []string
+	}{
+		"short":      {text: "one paragraph", size: 20, want: []string{"one paragraph"}},
+		"paragraphs": {text: "first part\n\nsecond part", size: 15, want: []string{"first part", "second part"}},
+		"lines":      {text: "alpha beta\ngamma delta", size: 14, want: []string{"alpha beta", "gamma delta"}},
+		"hard cut":   {text: "abcdefghij", size: 4, want: []string{"abcd", "efgh", "ij"}},
+		"runes":      {text: "ééééé", size: 2, want: []string{"éé", "éé", "é"}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := splitChunks(tc.text, tc.size); !slices.Equal(got, tc.want) {
+				t.Fatalf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestEmbeddingOptionsValidate(t *testing.T) {
+	tests := map[string]struct {
+		opts    EmbeddingOptions
+		ingest  string
+		wantErr string
+	}{
+		"default":            {ingest: IngestMCP},
+		"openai":             {opts: EmbeddingOptions{Provider: EmbedderOpenAI, APIKey: "sk"}, ingest: IngestLocal},
+		"compatible server":  {opts: EmbeddingOptions{Provider: EmbedderOpenAI, URL: "http://tei:8080/v1"}, ingest: IngestDirect},
+		"openai without key": {opts: EmbeddingOptions{Provider: EmbedderOpenAI}, ingest: IngestLocal, wantErr: "API key"},
+		"openai with mcp": {
+			opts: EmbeddingOptions{Provider: EmbedderOpenAI, APIKey: "sk"}, ingest: IngestMCP, wantErr: "direct or local",
+		},
+		"ollama":          {opts: EmbeddingOptions{Provider: EmbedderOllama}, ingest: IngestLocal},
+		"ollama with mcp": {opts: EmbeddingOptions{Provider: EmbedderOllama}, ingest: IngestMCP, wantErr: "direct or local"},
+		"unknown":         {opts: EmbeddingOptions{Provider: "bert"}, wantErr: "unknown embedder"},
+		"negative chunk":  {opts: EmbeddingOptions{ChunkChars: -1}, wantErr: "negative"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := tc.opts.validate(tc.ingest)
+			if tc.wantErr == "" && err != nil || tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+				t.Fatalf("expected error %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+// fakeEmbeddings serves the OpenAI embeddings API, embedding each input as
+// its length, and counts the inputs it was sent.
+func fakeEmbeddings(t *testing.T, inputs *int) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/embeddings" || r.Header.Get("Authorization") != "Bearer sk-test" {
+			http.Error(w, "unexpected request", http.StatusUnauthorized)
+			return
+		}
+		var req struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Model != "text-embedding-3-large" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		*inputs += len(req.Input)
+		type datum struct {
+			Embedding []float64 `json:"embedding"`
+			Index     int       `json:"index"`
+		}
+		var data []datum
+		// Answer out of order; the index places each embedding.
+		for i := len(req.Input) - 1; i >= 0; i-- {
+			data = append(data, datum{Embedding: []float64{float64(len(req.Input[i])), 1}, Index: i})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": data})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestOpenAIEmbedder(t *testing.T) {
+	var inputs int
+	srv := fakeEmbeddings(t, &inputs)
+	e := newOpenAIEmbedder(EmbeddingOptions{
+		Provider: EmbedderOpenAI, Model: "text-embedding-3-large", URL: srv.URL + "/v1/", APIKey: "sk-test",
+	})
+	texts := make([]string, openAIEmbedBatch+2)
+	for i := range texts {
+		texts[i] = strings.Repeat("x", i)
+	}
+	got, err := e.embed(t.Context(), texts)
+	if err != nil {
+		t.Fatalf("embed: %v", err)
+	}
+	if len(got) != len(texts) || got[3][0] != 3 || got[openAIEmbedBatch+1][0] != openAIEmbedBatch+1 {
+		t.Fatalf("expected embeddings in input order, got %v", got)
+	}
+	if e.name() != "openai/text-embedding-3-large" {
+		t.Fatalf("unexpected name %q", e.name())
+	}
+
+	e.opts.APIKey = "wrong"
+	if _, err := e.embed(t.Context(), texts[:1]); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("expected the API's error, got %v", err)
+	}
+}
+
+func TestOllamaEmbedder(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || r.URL.Path != "/api/embed" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if req.Model != DefaultOllamaEmbedModel {
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]any{"error": fmt.Sprintf("model %q not found", req.Model)})
+			return
+		}
+		embeddings := make([][]float64, len(req.Input))
+		for i, text := range req.Input {
+			embeddings[i] = []float64{float64(len(text)), 1}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"model": req.Model, "embeddings": embeddings})
+	}))
+	t.Cleanup(srv.Close)
+
+	e := newOllamaEmbedder(EmbeddingOptions{Provider: EmbedderOllama, URL: srv.URL + "/"})
+	texts := make([]string, ollamaEmbedBatch+3)
+	for i := range texts {
+		texts[i] = strings.Repeat("x", i)
+	}
+	got, err := e.embed(t.Context(), texts)
+	if err != nil {
+		t.Fatalf("embed: %v", err)
+	}
+	if len(got) != len(texts) || got[ollamaEmbedBatch+2][0] != ollamaEmbedBatch+2 {
+		t.Fatalf("expected embeddings in input order, got %v", got)
+	}
+	if e.name() != "ollama/nomic-embed-text" {
+		t.Fatalf("unexpected name %q", e.name())
+	}
+
+	e.opts.Model = "missing"
+	if _, err := e.embed(t.Context(), texts[:1]); err == nil || !strings.Contains(err.Error(), `model "missing" not found`) {
+		t.Fatalf("expected Ollama's error, got %v", err)
+	}
+}
+
+func TestRunResultsIngestLocalFiles(t *testing.T) {
+	rootDir := t.TempDir()
+	repoDir := filepath.Join(rootDir, "api")
+	initGitRepo(t, repoDir)
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(repoDir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		if err := runGit(repoDir, "add", "-A"); err != nil {
+			t.Fatalf("git add: %v", err)
+		}
+		if err := runGit(repoDir, "commit", "-m", "update "+name); err != nil {
+			t.Fatalf("git commit: %v", err)
+		}
+	}
+	write("main.go", strings.Repeat("// handler line\n", 30))
+	write("logo.bin", "\x00\x01\x02")
+
+	var inputs int
+	srv := fakeEmbeddings(t, &inputs)
+	chroma := ChromaOptions{URL: "http://chroma.invalid"}
+	closeStore, err := OpenEmbeddedStore(t.TempDir(), &chroma)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = closeStore() })
+	cachePath := filepath.Join(t.TempDir(), "cache.json")
+	run := func() {
+		t.Helper()
+		results, err := RunResults(Options{
+			RootDir:     rootDir,
+			SummaryJSON: filepath.Join(t.TempDir(), "summary.json"),
+			CachePath:   cachePath,
+			Ingest:      IngestLocal,
+			LocalFiles:  true,
+			Embeddings: EmbeddingOptions{
+				Provider:   EmbedderOpenAI,
+				Model:      "text-embedding-3-large",
+				URL:        srv.URL + "/v1",
+				APIKey:     "sk-test",
+				ChunkChars: 200,
+			},
+			Chroma: chroma,
+		})
+		if err != nil || len(results) != 1 || results[0].Err != nil {
+			t.Fatalf("run indexer: %v %+v", err, results)
+		}
+	}
+	stored := func() map[string]map[string]any {
+		t.Helper()
+		client := newChromaClient(chroma)
+		col, _, err := client.getCollection(t.Context(), "api")
+		if err != nil {
+			t.Fatalf("get collection: %v", err)
+		}
+		recs, err := client.getRecords(t.Context(), col.ID, 0, chromaPageSize)
+		if err != nil {
+			t.Fatalf("get records: %v", err)
+		}
+		out := make(map[string]map[string]any)
+		for i, id := range recs.IDs {
+			if strings.HasPrefix(id, "local:file:") {
+				out[id] = recs.Metadatas[i]
+			}
+		}
+		return out
+	}
+
+	run()
+	files := stored()
+	want := []string{"local:file:README.md", "local:file:main.go-1", "local:file:main.go-2", "local:file:main.go-3"}
+	if got := slices.Sorted(maps.Keys(files)); !slices.Equal(got, want) {
+		t.Fatalf("expected files %q, got %q", want, got)
+	}
+	chunk := files["local:file:main.go-2"]
+	if chunk["chunk"] != float64(2) || chunk["chunks"] != float64(3) || chunk[chunkOfKey] != "local:file:main.go" ||
+		chunk[embeddingModelKey] != "openai/text-embedding-3-large" || chunk["kind"] != "source_file" {
+		t.Fatalf("unexpected chunk metadata %v", chunk)
+	}
+	if inputs == 0 {
+		t.Fatal("expected the embeddings API to be called")
+	}
+	col, _, err := newChromaClient(chroma).getCollection(t.Context(), "api")
+	if err != nil || col.Metadata[embeddingModelKey] != "openai/text-embedding-3-large" ||
+		col.Metadata[collectionRootKey] != repoDir || col.Metadata[collectionRepoKey] != "api" {
+		t.Fatalf("unexpected collection metadata %v (%v)", col.Metadata, err)
+	}
+
+	write("main.go", "package main\n")
+	run()
+	files = stored()
+	if _, ok := files["local:file:main.go"]; !ok || len(files) != 2 {
+		t.Fatalf("expected the chunks replaced by the whole file, got %v", files)
+	}
+}
@@ -0,0 +1,193 @@
+package indexer
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Failure classes recorded in RepoResult.ErrorKind.
+const (
+	ErrorKindGitFetch         = "git_fetch"
+	ErrorKindAgentTimeout     = "agent_timeout"
+	ErrorKindAgentExit        = "agent_exit"
+	ErrorKindAgentOutput      = "agent_output"
+	ErrorKindStoreUnavailable = "store_unavailable"
+	ErrorKindTooManyOpenFiles = "too_many_open_files"
+	ErrorKindOther            = "other"
+)
+
+// Skip reasons recorded in RepoResult.SkipReason; SkipDetail carries the
+// specifics.
+const (
+	// SkipReasonCacheHit: the commit or release was already indexed, or
+	// nothing changed in the --since window.
+	SkipReasonCacheHit = "cache_hit"
+	// SkipReasonExcludedByFlag: a flag or policy excluded the repo, e.g.
+	// --skip-repo, --duplicate-policy, or --detached-head skip.
+	SkipReasonExcludedByFlag = "excluded_by_flag"
+	// SkipReasonExcludedByMarker: the repo carries an opt-out marker.
+	SkipReasonExcludedByMarker = "excluded_by_marker"
+	// SkipReasonQuarantined: the repo failed its health check.
+	SkipReasonQuarantined = "quarantined"
+	// SkipReasonDeferred: --max-repos left the stale repo for a later run.
+	SkipReasonDeferred = "deferred"
+)
+
+// GitFetchError reports a failed fetch or worktree checkout of a repo's
+// index branch. The repo is then indexed from its current working tree, so
+// this is recorded in RepoResult.GitErr rather than failing the repo.
+type GitFetchError struct {
+	Err error
+	// Op is the git step that failed, e.g. "fetch" or "worktree add".
+	Op     string
+	Remote string
+	Branch string
+	// Transient is set for network or lock contention failures that may
+	// succeed on a later run.
+	Transient bool
+}
+
+func (e *GitFetchError) Error() string {
+	return fmt.Sprintf("git %s %s %s: %v", e.Op, e.Remote, e.Branch, e.Err)
+}
+
+func (e *GitFetchError) Unwrap() error {
+	return e.Err
+}
+
+// AgentTimeout reports Codex running past --codex-timeout.
+type AgentTimeout struct {
+	Err     error
+	Timeout time.Duration
+}
+
+func (e *AgentTimeout) Error() string {
+	if e.Timeout <= 0 {
+		return fmt.Sprintf("codex exec deadline exceeded: %v", e.Err)
+	}
+	return fmt.Sprintf("codex exec deadline exceeded after %s: %v", e.Timeout, e.Err)
+}
+
+func (e *AgentTimeout) Unwrap() error {
+	return e.Err
+}
+
+// AgentExitError reports Codex failing to start or exiting non-zero.
+type AgentExitError struct {
+	Err      error
+	ExitCode int
+}
+
+func (e *AgentExitError) Error() string {
+	return fmt.Sprintf("codex exec: %v", e.Err)
+}
+
+func (e *AgentExitError) Unwrap() error {
+	return e.Err
+}
+
+// AgentOutputError reports agent output showing that indexing failed
+// although the agent exited 0, e.g. because its Chroma MCP tools were
+// missing.
+type AgentOutputError struct {
+	// Kind is the OutputWarning kind found.
+	Kind string
+	// Line is the first matching line.
+	Line string
+}
+
+func (e *AgentOutputError) Error() string {
+	return fmt.Sprintf("agent output shows %s: %s", e.Kind, e.Line)
+}
+
+// StoreUnavailable reports that the collection store could not be reached
+// or answered with a server error.
+type StoreUnavailable struct {
+	Err error
+	URL string
+}
+
+func (e *StoreUnavailable) Error() string {
+	return fmt.Sprintf("store %s unavailable: %v", e.URL, e.Err)
+}
+
+func (e *StoreUnavailable) Unwrap() error {
+	return e.Err
+}
+
+// TooManyOpenFiles reports that a child process, or the indexer starting
+// it, ran out of file descriptors.
+type TooManyOpenFiles struct {
+	Err error
+	// Limit is the soft open file limit, or 0 when unknown.
+	Limit uint64
+}
+
+func (e *TooManyOpenFiles) Error() string {
+	limit := ""
+	if e.Limit > 0 {
+		limit = fmt.Sprintf(" (limit %d)", e.Limit)
+	}
+	return fmt.Sprintf("too many open files%s; lower --parallel or set --max-procs, or raise the limit "+
+		"with ulimit -n: %v", limit, e.Err)
+}
+
+func (e *TooManyOpenFiles) Unwrap() error {
+	return e.Err
+}
+
+// Skipped is the status of a repo that was deliberately not indexed. It is
+// recorded in RepoResult.Err so callers can tell skips from failures with
+// errors.As.
+type Skipped struct {
+	// Reason is one of the SkipReason constants.
+	Reason string
+	Detail string
+}
+
+func (s *Skipped) Error() string {
+	return "skipped: " + s.Detail
+}
+
+// errorKind classifies err for RepoResult.ErrorKind.
+func errorKind(err error) string {
+	var (
+		fetchErr *GitFetchError
+		timeout  *AgentTimeout
+		exitErr  *AgentExitError
+		outErr   *AgentOutputError
+		storeErr *StoreUnavailable
+		fdErr    *TooManyOpenFiles
+	)
+	switch {
+	case errors.As(err, &fdErr):
+		return ErrorKindTooManyOpenFiles
+	case errors.As(err, &timeout):
+		return ErrorKindAgentTimeout
+	case errors.As(err, &exitErr):
+		return ErrorKindAgentExit
+	case errors.As(err, &outErr):
+		return ErrorKindAgentOutput
+	case errors.As(err, &storeErr):
+		return ErrorKindStoreUnavailable
+	case errors.As(err, &fetchErr):
+		return ErrorKindGitFetch
+	default:
+		return ErrorKindOther
+	}
+}
+
+// fail records err as the reason the repo failed.
+func (r *RepoResult) fail(err error) {
+	r.Err = err
+	r.Error = err.Error()
+	r.ErrorKind = errorKind(err)
+}
+
+// skip records why the repo was not indexed.
+func (r *RepoResult) skip(reason, detail string) {
+	r.Err = &Skipped{Reason: reason, Detail: detail}
+	r.SkipReason = reason
+	r.SkipDetail = detail
+}
@@ -0,0 +1,119 @@
+package indexer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestErrorKind(t *testing.T) {
+	tests := map[string]struct {
+		err  error
+		want string
+	}{
+		"git fetch": {
+			err:  &GitFetchError{Op: "fetch", Err: errors.New("boom")},
+			want: ErrorKindGitFetch,
+		},
+		"agent timeout": {
+			err:  &AgentTimeout{Err: errors.New("killed"), Timeout: time.Minute},
+			want: ErrorKindAgentTimeout,
+		},
+		"agent exit": {
+			err:  &AgentExitError{Err: errors.New("exit status 3"), ExitCode: 3},
+			want: ErrorKindAgentExit,
+		},
+		"wrapped store": {
+			err:  fmt.Errorf("list collections: %w", &StoreUnavailable{URL: "http://chroma", Err: errors.New("refused")}),
+			want: ErrorKindStoreUnavailable,
+		},
+		"codex out of descriptors": {
+			err:  &AgentExitError{Err: &TooManyOpenFiles{Err: errors.New("exit status 1")}, ExitCode: 1},
+			want: ErrorKindTooManyOpenFiles,
+		},
+		"other": {
+			err:  errors.New("invalid collection name"),
+			want: ErrorKindOther,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := errorKind(tc.err); got != tc.want {
+				t.Fatalf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRunResultsTypedErrors(t *testing.T) {
+	tests := map[string]struct {
+		codex    string
+		timeout  time.Duration
+		wantKind string
+	}{
+		"agent exit": {
+			codex:    "#!/bin/sh\necho 'fatal: quota exceeded' >&2\nexit 3\n",
+			wantKind: ErrorKindAgentExit,
+		},
+		"agent timeout": {
+			codex:    "#!/bin/sh\nexec sleep 5\n",
+			timeout:  100 * time.Millisecond,
+			wantKind: ErrorKindAgentTimeout,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			rootDir := t.TempDir()
+			initGitRepo(t, filepath.Join(rootDir, "api"))
+			initGitRepo(t, filepath.Join(rootDir, "legacy"))
+
+			codexPath := filepath.Join(t.TempDir(), "codex")
+			if err := os.WriteFile(codexPath, []byte(tc.codex), 0o755); err != nil {
+				t.Fatalf("write codex stub: %v", err)
+			}
+
+			outDir := t.TempDir()
+			results, err := RunResults(Options{
+				RootDir:      rootDir,
+				SummaryJSON:  filepath.Join(outDir, "summary.json"),
+				CodexPath:    codexPath,
+				SkipRepos:    []string{"legacy"},
+				CodexTimeout: tc.timeout,
+			})
+			if err != nil {
+				t.Fatalf("run indexer: %v", err)
+			}
+			if len(results) != 2 {
+				t.Fatalf("expected 2 results, got %d", len(results))
+			}
+
+			api, legacy := results[0], results[1]
+			if api.ErrorKind != tc.wantKind || errorKind(api.Err) != tc.wantKind {
+				t.Fatalf("expected %s, got kind %q err %v", tc.wantKind, api.ErrorKind, api.Err)
+			}
+			var exitErr *AgentExitError
+			if tc.wantKind == ErrorKindAgentExit && (!errors.As(api.Err, &exitErr) || exitErr.ExitCode != 3) {
+				t.Fatalf("expected exit code 3, got %v", api.Err)
+			}
+			if tc.wantKind == ErrorKindAgentExit && !strings.Contains(api.OutputTail, "fatal: quota exceeded") {
+				t.Fatalf("expected the output tail to carry Codex's error, got %q", api.OutputTail)
+			}
+
+			var skipped *Skipped
+			if !errors.As(legacy.Err, &skipped) || skipped.Reason != legacy.SkipReason ||
+				legacy.SkipReason != SkipReasonExcludedByFlag {
+				t.Fatalf("expected skipped status, got %v", legacy.Err)
+			}
+			if legacy.ErrorKind != "" {
+				t.Fatalf("expected no error kind for a skip, got %q", legacy.ErrorKind)
+			}
+		})
+	}
+}
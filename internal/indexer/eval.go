@@ -0,0 +1,311 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// DefaultEvalK is how many retrieved documents each question is scored on.
+const DefaultEvalK = 5
+
+const (
+	// evalScorePrefix starts the grader's final line, e.g. "SCORE: 0.8".
+	evalScorePrefix = "SCORE:"
+	// evalQuestionWidth caps the question column of the report table.
+	evalQuestionWidth = 60
+)
+
+// EvalOptions configures Evaluate.
+type EvalOptions struct {
+	// Chroma locates the collection store.
+	Chroma ChromaOptions
+	// Collection is the collection slug to evaluate.
+	Collection string
+	// QuestionsPath is a YAML or JSON file of questions; see
+	// parseEvalQuestions.
+	QuestionsPath string
+	// RerankURL, when set, reranks retrieval as in QueryOptions.
+	RerankURL string
+	// CodexPath is the Codex executable used by Grade; empty runs "codex"
+	// from PATH.
+	CodexPath string
+	// JSONPath, when set, also writes the report there as JSON so runs can
+	// be compared.
+	JSONPath string
+	// K is how many documents are retrieved per question; zero uses
+	// DefaultEvalK.
+	K int
+	// Grade has Codex answer each question from the retrieved documents
+	// and score the answer from 0 to 1.
+	Grade bool
+}
+
+// evalQuestion is one entry of the questions file.
+type evalQuestion struct {
+	Question string `json:"question"`
+	// Answer is a reference answer the grader compares against.
+	Answer string `json:"answer,omitempty"`
+	// Kind limits retrieval to documents of this kind.
+	Kind string `json:"kind,omitempty"`
+	// Paths are document paths a good retrieval returns; a result matches
+	// a path or anything under it.
+	Paths []string `json:"paths,omitempty"`
+	// Terms are words the retrieved documents should mention.
+	Terms []string `json:"terms,omitempty"`
+}
+
+// EvalQuestionResult scores one question.
+type EvalQuestionResult struct {
+	// Coverage is the fraction of the question's terms found in the
+	// retrieved documents; nil without terms.
+	Coverage *float64 `json:"coverage,omitempty"`
+	// Grade is Codex's 0-1 score; nil unless grading.
+	Grade *float64 `json:"grade,omitempty"`
+	// Rank is the 1-based position of the first retrieved document
+	// matching an expected path, or 0 when none does; nil without paths.
+	Rank      *int     `json:"rank,omitempty"`
+	Question  string   `json:"question"`
+	Retrieved []string `json:"retrieved"`
+}
+
+// EvalReport summarizes an evaluation run. Averages only cover questions
+// that set what they measure, and are nil when none do.
+type EvalReport struct {
+	// HitRate is the fraction of questions with paths whose expected path
+	// was retrieved in the top K.
+	HitRate *float64 `json:"hit_rate,omitempty"`
+	// MRR is the mean reciprocal rank over questions with paths.
+	MRR      *float64 `json:"mrr,omitempty"`
+	Coverage *float64 `json:"coverage,omitempty"`
+	Grade    *float64 `json:"grade,omitempty"`
+	// Collection is the evaluated collection.
+	Collection string               `json:"collection"`
+	Questions  []EvalQuestionResult `json:"questions"`
+	K          int                  `json:"k"`
+}
+
+// Evaluate runs every question in opts.QuestionsPath against a collection,
+// prints a per-question table and the aggregate scores to w, and returns
+// the report.
+func Evaluate(ctx context.Context, w io.Writer, opts EvalOptions) (*EvalReport, error) {
+	if opts.K < 0 {
+		return nil, fmt.Errorf("eval k must not be negative, got %d", opts.K)
+	}
+	if opts.K == 0 {
+		opts.K = DefaultEvalK
+	}
+	data, err := os.ReadFile(opts.QuestionsPath)
+	if err != nil {
+		return nil, fmt.Errorf("read questions: %w", err)
+	}
+	questions, err := parseEvalQuestions(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", opts.QuestionsPath, err)
+	}
+	if len(questions) == 0 {
+		return nil, fmt.Errorf("%s has no questions", opts.QuestionsPath)
+	}
+
+	client := newChromaClient(opts.Chroma)
+	col, ok, err := client.getCollection(ctx, opts.Collection)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("collection %q does not exist", opts.Collection)
+	}
+
+	report := &EvalReport{Collection: opts.Collection, K: opts.K}
+	for _, q := range questions {
+		results, err := queryCollection(ctx, client, col.ID, QueryOptions{
+			Text:      q.Question,
+			Kind:      q.Kind,
+			RerankURL: opts.RerankURL,
+			Limit:     opts.K,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("question %q: %w", q.Question, err)
+		}
+		qr := scoreQuestion(q, results)
+		if opts.Grade {
+			grade, err := gradeAnswer(ctx, opts.CodexPath, q, results)
+			if err != nil {
+				return nil, fmt.Errorf("grade %q: %w", q.Question, err)
+			}
+			qr.Grade = &grade
+		}
+		report.Questions = append(report.Questions, qr)
+	}
+	report.aggregate()
+
+	writeEvalReport(w, report)
+	if opts.JSONPath != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("encode report: %w", err)
+		}
+		if err := os.WriteFile(opts.JSONPath, append(data, '\n'), 0o644); err != nil {
+			return nil, fmt.Errorf("write report: %w", err)
+		}
+	}
+	return report, nil
+}
+
+// scoreQuestion measures how well results answer q.
+func scoreQuestion(q evalQuestion, results []QueryResult) EvalQuestionResult {
+	qr := EvalQuestionResult{Question: q.Question, Retrieved: make([]string, 0, len(results))}
+	var text strings.Builder
+	if len(q.Paths) > 0 {
+		qr.Rank = new(int)
+	}
+	for i, r := range results {
+		path := r.path()
+		qr.Retrieved = append(qr.Retrieved, path)
+		if qr.Rank != nil && *qr.Rank == 0 && slices.ContainsFunc(q.Paths, func(p string) bool {
+			p = strings.Trim(p, "/")
+			return path == p || strings.HasPrefix(path, p+"/")
+		}) {
+			*qr.Rank = i + 1
+		}
+		text.WriteString(r.Document)
+		text.WriteByte('\n')
+	}
+	if len(q.Terms) > 0 {
+		terms := queryTerms(strings.Join(q.Terms, " "))
+		coverage := float64(countTerms(text.String(), terms)) / float64(len(terms))
+		qr.Coverage = &coverage
+	}
+	return qr
+}
+
+// aggregate fills in the report's averages from its questions.
+func (r *EvalReport) aggregate() {
+	var hits, reciprocal, coverage, grade float64
+	var withPaths, withTerms, graded int
+	for _, q := range r.Questions {
+		if q.Coverage != nil {
+			withTerms++
+			coverage += *q.Coverage
+		}
+		if q.Grade != nil {
+			graded++
+			grade += *q.Grade
+		}
+		if q.Rank == nil {
+			continue
+		}
+		withPaths++
+		if *q.Rank > 0 {
+			hits++
+			reciprocal += 1 / float64(*q.Rank)
+		}
+	}
+	r.HitRate = ratio(hits, withPaths)
+	r.MRR = ratio(reciprocal, withPaths)
+	r.Coverage = ratio(coverage, withTerms)
+	r.Grade = ratio(grade, graded)
+}
+
+// ratio returns sum/n, or nil when n is zero.
+func ratio(sum float64, n int) *float64 {
+	if n == 0 {
+		return nil
+	}
+	v := sum / float64(n)
+	return &v
+}
+
+// gradeAnswer has Codex answer q from the retrieved documents alone and
+// returns its 0-1 score from the final "SCORE:" line of its output.
+func gradeAnswer(ctx context.Context, codexPath string, q evalQuestion, results []QueryResult) (float64, error) {
+	if codexPath == "" {
+		codexPath = defaultCodexPath
+	}
+	var prompt strings.Builder
+	prompt.WriteString(evalGradePrompt)
+	fmt.Fprintf(&prompt, "\nQuestion: %s\n", q.Question)
+	if q.Answer != "" {
+		fmt.Fprintf(&prompt, "\nReference answer: %s\n", q.Answer)
+	}
+	for i, r := range results {
+		fmt.Fprintf(&prompt, "\n--- Document %d (%s) ---\n%s\n", i+1, r.path(), r.Document)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, codexPath, "exec", "--sandbox", "read-only", "--skip-git-repo-check",
+		prompt.String())
+	cmd.Dir = os.TempDir()
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return 0, fmt.Errorf("codex: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return parseGrade(stdout.String())
+}
+
+// parseGrade returns the score on output's last "SCORE:" line, which must be
+// between 0 and 1.
+func parseGrade(output string) (float64, error) {
+	lines := strings.Split(output, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		rest, ok := strings.CutPrefix(strings.TrimSpace(lines[i]), evalScorePrefix)
+		if !ok {
+			continue
+		}
+		score, err := strconv.ParseFloat(strings.TrimSpace(rest), 64)
+		if err != nil || score < 0 || score > 1 {
+			return 0, fmt.Errorf("invalid grade %q (want 0 to 1)", strings.TrimSpace(rest))
+		}
+		return score, nil
+	}
+	return 0, errors.New("no " + evalScorePrefix + " line in grader output")
+}
+
+// writeEvalReport prints one row per question and the averages.
+func writeEvalReport(w io.Writer, r *EvalReport) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "QUESTION\tRANK\tCOVERAGE\tGRADE")
+	for _, q := range r.Questions {
+		rank := "-"
+		switch {
+		case q.Rank == nil:
+		case *q.Rank == 0:
+			rank = "miss"
+		default:
+			rank = strconv.Itoa(*q.Rank)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", shortQuestion(q.Question), rank, formatScore(q.Coverage),
+			formatScore(q.Grade))
+	}
+	_ = tw.Flush()
+	logf(w, "\n%s: %d questions, top %d. Hit rate %s, MRR %s, coverage %s, grade %s.\n",
+		r.Collection, len(r.Questions), r.K, formatScore(r.HitRate), formatScore(r.MRR), formatScore(r.Coverage),
+		formatScore(r.Grade))
+}
+
+// shortQuestion cuts a question to evalQuestionWidth runes for the table.
+func shortQuestion(q string) string {
+	runes := []rune(q)
+	if len(runes) <= evalQuestionWidth {
+		return q
+	}
+	return string(runes[:evalQuestionWidth-3]) + "..."
+}
+
+// formatScore renders a score with two decimals, or "-" when unset.
+func formatScore(v *float64) string {
+	if v == nil {
+		return "-"
+	}
+	return strconv.FormatFloat(*v, 'f', 2, 64)
+}
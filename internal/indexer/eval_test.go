@@ -0,0 +1,110 @@
+package indexer
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	docs := map[string]string{
+		"overview": "Repo overview: an API with auth and billing.",
+		"auth":     "Auth issues JWT session tokens.",
+		"billing":  "Billing charges cards nightly.",
+	}
+	var requests []map[string]any
+	srv := newQueryChroma(t, docs, &requests)
+
+	dir := t.TempDir()
+	questions := filepath.Join(dir, "questions.yaml")
+	data := `- question: Where are session tokens issued?
+  paths: [internal/auth]
+  terms: [JWT, refresh]
+- question: How are cards charged?
+  paths: [internal/payments]
+- question: What does the repo do?
+`
+	if err := os.WriteFile(questions, []byte(data), 0o644); err != nil {
+		t.Fatalf("write questions: %v", err)
+	}
+	codexPath := filepath.Join(dir, "codex")
+	if err := os.WriteFile(codexPath, []byte("#!/bin/sh\necho 'The documents answer it.'\necho 'SCORE: 0.5'\n"),
+		0o755); err != nil {
+		t.Fatalf("write codex: %v", err)
+	}
+	jsonPath := filepath.Join(dir, "report.json")
+
+	var out bytes.Buffer
+	report, err := Evaluate(t.Context(), &out, EvalOptions{
+		Chroma:        ChromaOptions{URL: srv.URL},
+		Collection:    "api",
+		QuestionsPath: questions,
+		CodexPath:     codexPath,
+		JSONPath:      jsonPath,
+		K:             2,
+		Grade:         true,
+	})
+	if err != nil {
+		t.Fatalf("evaluate: %v", err)
+	}
+
+	if len(report.Questions) != 3 {
+		t.Fatalf("expected 3 results, got %+v", report.Questions)
+	}
+	first, second, third := report.Questions[0], report.Questions[1], report.Questions[2]
+	if first.Rank == nil || *first.Rank != 1 || first.Coverage == nil || *first.Coverage != 0.5 {
+		t.Fatalf("expected auth ranked first with half the terms, got %+v", first)
+	}
+	if second.Rank == nil || *second.Rank != 0 || third.Rank != nil || third.Coverage != nil {
+		t.Fatalf("expected a miss and an unscored question, got %+v and %+v", second, third)
+	}
+	if *report.HitRate != 0.5 || *report.MRR != 0.5 || *report.Coverage != 0.5 || *report.Grade != 0.5 {
+		t.Fatalf("unexpected aggregates: hit %v mrr %v coverage %v grade %v",
+			*report.HitRate, *report.MRR, *report.Coverage, *report.Grade)
+	}
+	if !strings.Contains(out.String(), "miss") || !strings.Contains(out.String(), "Hit rate 0.50") {
+		t.Fatalf("unexpected report output %q", out.String())
+	}
+
+	saved, err := os.ReadFile(jsonPath)
+	if err != nil {
+		t.Fatalf("read report: %v", err)
+	}
+	var decoded EvalReport
+	if err := json.Unmarshal(saved, &decoded); err != nil || len(decoded.Questions) != 3 || decoded.K != 2 {
+		t.Fatalf("expected the report saved as JSON, got %s (%v)", saved, err)
+	}
+}
+
+func TestParseGrade(t *testing.T) {
+	tests := map[string]struct {
+		output  string
+		want    float64
+		wantErr bool
+	}{
+		"last line":     {output: "Answer.\nSCORE: 0.25\n", want: 0.25},
+		"last of many":  {output: "SCORE: 0.1\nrevised\n  SCORE: 1\n", want: 1},
+		"missing":       {output: "no score", wantErr: true},
+		"out of range":  {output: "SCORE: 7", wantErr: true},
+		"not a number":  {output: "SCORE: high", wantErr: true},
+		"trailing text": {output: "SCORE: 0.9\nDone.\n", want: 0.9},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseGrade(tc.output)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %v", got)
+				}
+				return
+			}
+			if err != nil || got != tc.want {
+				t.Fatalf("expected %v, got %v (%v)", tc.want, got, err)
+			}
+		})
+	}
+}
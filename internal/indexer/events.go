@@ -0,0 +1,130 @@
+package indexer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// eventsStdout is the --events value that streams events to stdout.
+const eventsStdout = "-"
+
+// Event types emitted to the --events stream, in the order a repo moves
+// through them. Skipped repos go straight from repo_started to
+// repo_finished. run_paused and run_resumed may occur at any point.
+const (
+	EventRunStarted    = "run_started"
+	EventRepoStarted   = "repo_started"
+	EventFetchDone     = "fetch_done"
+	EventCodexStarted  = "codex_started"
+	EventCodexFinished = "codex_finished"
+	EventRepoFinished  = "repo_finished"
+	EventRunFinished   = "run_finished"
+	EventRunPaused     = "run_paused"
+	EventRunResumed    = "run_resumed"
+)
+
+// Event is one line of the NDJSON event stream.
+type Event struct {
+	Time       time.Time `json:"time"`
+	CheckoutOK *bool     `json:"checkout_ok,omitempty"`
+	PullOK     *bool     `json:"pull_ok,omitempty"`
+	Git        *GitPrep  `json:"git,omitempty"`
+	ExitCode   *int      `json:"exit_code,omitempty"`
+	Type       string    `json:"type"`
+	Repo       string    `json:"repo,omitempty"`
+	Path       string    `json:"path,omitempty"`
+	Branch     string    `json:"branch,omitempty"`
+	Commit     string    `json:"commit,omitempty"`
+	Pass       string    `json:"pass,omitempty"`
+	Status     string    `json:"status,omitempty"`
+	SkipReason string    `json:"skip_reason,omitempty"`
+	SkipDetail string    `json:"skip_detail,omitempty"`
+	GitFailure string    `json:"git_failure,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	RepoCount  int       `json:"repo_count,omitempty"`
+	DurationMS int64     `json:"duration_ms,omitempty"`
+}
+
+// eventSink writes events as they happen. A nil sink discards events.
+type eventSink struct {
+	enc    *json.Encoder
+	closer io.Closer
+	mu     sync.Mutex
+}
+
+// openEventSink opens path for the event stream; "-" selects stdout and an
+// empty path disables events.
+func openEventSink(path string) (*eventSink, error) {
+	switch path {
+	case "":
+		return nil, nil
+	case eventsStdout:
+		return &eventSink{enc: json.NewEncoder(os.Stdout)}, nil
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("open events %s: %w", path, err)
+	}
+	return &eventSink{enc: json.NewEncoder(f), closer: f}, nil
+}
+
+func (s *eventSink) write(ev Event) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.enc.Encode(ev); err != nil {
+		return fmt.Errorf("write event: %w", err)
+	}
+	return nil
+}
+
+func (s *eventSink) Close() error {
+	if s == nil || s.closer == nil {
+		return nil
+	}
+	if err := s.closer.Close(); err != nil {
+		return fmt.Errorf("close events: %w", err)
+	}
+	return nil
+}
+
+// emit timestamps ev, masks secrets in its error, and hands it to the live
+// status file and event stream. Write failures are logged but never abort
+// indexing.
+func (ix *indexer) emit(ev Event) {
+	if ix.events == nil && ix.status == nil {
+		return
+	}
+	ev.Time = time.Now().UTC()
+	ev.Error = ix.masker.mask(ev.Error)
+	if err := ix.status.observe(ev); err != nil {
+		ix.errln("Error writing status file:", err)
+	}
+	if err := ix.events.write(ev); err != nil {
+		ix.errln("Error writing event:", err)
+	}
+}
+
+// repoFinishedEvent summarizes a completed repo for the event stream.
+func repoFinishedEvent(r *RepoResult) Event {
+	return Event{
+		Type:       EventRepoFinished,
+		Repo:       r.CollectionSlug,
+		Path:       r.Path,
+		Branch:     r.DefaultBranch,
+		Commit:     r.IndexedCommit,
+		Status:     repoStatus(r),
+		SkipReason: r.SkipReason,
+		SkipDetail: r.SkipDetail,
+		Error:      r.Error,
+		ExitCode:   r.CodexExitCode,
+		DurationMS: r.DurationMS,
+	}
+}
@@ -0,0 +1,76 @@
+package indexer
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestRunEmitsEvents(t *testing.T) {
+	rootDir := t.TempDir()
+	initGitRepo(t, filepath.Join(rootDir, "api"))
+
+	binDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(binDir, "codex"), []byte("#!/bin/sh\nexit 3\n"), 0o755); err != nil {
+		t.Fatalf("write codex stub: %v", err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	outDir := t.TempDir()
+	eventsPath := filepath.Join(outDir, "events.ndjson")
+	opts := Options{
+		RootDir:     rootDir,
+		SummaryJSON: filepath.Join(outDir, "summary.json"),
+		EventsPath:  eventsPath,
+	}
+	if err := Run(opts); err != nil {
+		t.Fatalf("run indexer: %v", err)
+	}
+
+	f, err := os.Open(eventsPath)
+	if err != nil {
+		t.Fatalf("open events: %v", err)
+	}
+	defer f.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var ev Event
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			t.Fatalf("decode event %q: %v", scanner.Text(), err)
+		}
+		events = append(events, ev)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("scan events: %v", err)
+	}
+
+	types := make([]string, len(events))
+	for i, ev := range events {
+		types[i] = ev.Type
+	}
+	want := []string{
+		EventRunStarted,
+		EventRepoStarted,
+		EventFetchDone,
+		EventCodexStarted,
+		EventCodexFinished,
+		EventRepoFinished,
+		EventRunFinished,
+	}
+	if !slices.Equal(types, want) {
+		t.Fatalf("expected events %v, got %v", want, types)
+	}
+
+	finished := events[4]
+	if finished.Repo != "api" || finished.ExitCode == nil || *finished.ExitCode != 3 {
+		t.Fatalf("unexpected codex_finished event: %+v", finished)
+	}
+	if events[5].Status != statusError {
+		t.Fatalf("expected repo_finished status error, got %q", events[5].Status)
+	}
+}
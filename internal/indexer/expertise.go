@@ -0,0 +1,138 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"path"
+	"slices"
+	"strings"
+)
+
+// DefaultExpertiseSince is how far back --expertise reads history; any git
+// --since value works.
+const DefaultExpertiseSince = "12 months ago"
+
+const (
+	// expertiseMaxDirs caps the directories listed in the manifest.
+	expertiseMaxDirs = 50
+	// expertiseMaxContributors caps the contributors listed per directory.
+	expertiseMaxContributors = 5
+)
+
+// manifestExpertise summarizes who has recently changed each top-level
+// directory, for the expertise pass.
+type manifestExpertise struct {
+	// Since is the history window, as passed to git log --since.
+	Since       string           `json:"since"`
+	Directories []expertiseEntry `json:"directories"`
+}
+
+type expertiseEntry struct {
+	Dir          string            `json:"dir"`
+	Contributors []expertiseAuthor `json:"contributors"`
+	// Commits counts the window's commits touching Dir.
+	Commits int `json:"commits"`
+}
+
+type expertiseAuthor struct {
+	Name string `json:"name"`
+	// LastCommit is the author date of their newest commit touching the
+	// directory.
+	LastCommit string `json:"last_commit"`
+	Commits    int    `json:"commits"`
+}
+
+// collectExpertise aggregates non-merge commits since the window by author
+// per top-level directory; files at the root count as ".". Only author
+// names are recorded, never emails. It returns nil when git fails or the
+// window has no commits.
+func collectExpertise(ctx context.Context, repoDir, since string) *manifestExpertise {
+	cmd := exec.CommandContext(ctx, "git", "-C", repoDir, "log", "--since="+since, "--no-merges",
+		"--format=%x00%aN%x00%aI", "--name-only", "-z")
+	out, err := procOutput(ctx, cmd)
+	if err != nil {
+		return nil
+	}
+
+	type tally struct {
+		authors map[string]*expertiseAuthor
+		commits int
+	}
+	dirs := make(map[string]*tally)
+	var author, date string
+	touched := make(map[string]bool)
+	flush := func() {
+		for dir := range touched {
+			t := dirs[dir]
+			if t == nil {
+				t = &tally{authors: make(map[string]*expertiseAuthor)}
+				dirs[dir] = t
+			}
+			t.commits++
+			a := t.authors[author]
+			if a == nil {
+				// git log lists newest first, so the first date seen is the latest.
+				a = &expertiseAuthor{Name: author, LastCommit: date}
+				t.authors[author] = a
+			}
+			a.Commits++
+		}
+		clear(touched)
+	}
+
+	// With -z each commit is "\0<name>\0<date>\0" followed by its
+	// newline-prefixed, NUL-terminated file names, so an empty field starts
+	// the next commit.
+	fields := bytes.Split(out, []byte{0})
+	for i := 0; i < len(fields); i++ {
+		field := strings.TrimSpace(string(fields[i]))
+		if field == "" && i+2 < len(fields) {
+			flush()
+			author = string(fields[i+1])
+			date = strings.TrimSpace(string(fields[i+2]))
+			i += 2
+			continue
+		}
+		if field == "" {
+			continue
+		}
+		dir, _, ok := strings.Cut(path.Clean(field), "/")
+		if !ok {
+			dir = "."
+		}
+		touched[dir] = true
+	}
+	flush()
+	if len(dirs) == 0 {
+		return nil
+	}
+
+	entries := make([]expertiseEntry, 0, len(dirs))
+	for dir, t := range dirs {
+		authors := make([]expertiseAuthor, 0, len(t.authors))
+		for _, a := range t.authors {
+			authors = append(authors, *a)
+		}
+		slices.SortFunc(authors, func(a, b expertiseAuthor) int {
+			if a.Commits != b.Commits {
+				return b.Commits - a.Commits
+			}
+			return strings.Compare(a.Name, b.Name)
+		})
+		if len(authors) > expertiseMaxContributors {
+			authors = authors[:expertiseMaxContributors]
+		}
+		entries = append(entries, expertiseEntry{Dir: dir, Contributors: authors, Commits: t.commits})
+	}
+	slices.SortFunc(entries, func(a, b expertiseEntry) int {
+		if a.Commits != b.Commits {
+			return b.Commits - a.Commits
+		}
+		return strings.Compare(a.Dir, b.Dir)
+	})
+	if len(entries) > expertiseMaxDirs {
+		entries = entries[:expertiseMaxDirs]
+	}
+	return &manifestExpertise{Since: since, Directories: entries}
+}
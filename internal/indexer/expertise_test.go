@@ -0,0 +1,82 @@
+package indexer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCollectExpertise(t *testing.T) {
+	repoDir := t.TempDir()
+	initGitRepo(t, repoDir)
+
+	commits := []struct {
+		author string
+		files  []string
+	}{
+		{author: "Ada", files: []string{"api/handler.go", "api/routes.go"}},
+		{author: "Ada", files: []string{"api/handler.go", "docs/guide.md"}},
+		{author: "Grace", files: []string{"api/auth.go"}},
+		{author: "Grace", files: []string{"docs/guide.md", "Makefile"}},
+	}
+	for i, c := range commits {
+		for _, f := range c.files {
+			path := filepath.Join(repoDir, f)
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				t.Fatalf("create dir: %v", err)
+			}
+			if err := os.WriteFile(path, []byte(strings.Repeat("x", i+1)), 0o644); err != nil {
+				t.Fatalf("write %s: %v", f, err)
+			}
+		}
+		if err := runGit(repoDir, "add", "-A"); err != nil {
+			t.Fatalf("git add: %v", err)
+		}
+		author := c.author + " <" + strings.ToLower(c.author) + "@example.com>"
+		if err := runGit(repoDir, "commit", "-m", "change", "--author", author); err != nil {
+			t.Fatalf("git commit: %v", err)
+		}
+	}
+
+	got := collectExpertise(t.Context(), repoDir, DefaultExpertiseSince)
+	if got == nil {
+		t.Fatalf("expected expertise")
+	}
+	if got.Since != DefaultExpertiseSince {
+		t.Fatalf("expected since %q, got %q", DefaultExpertiseSince, got.Since)
+	}
+
+	want := []struct {
+		dir     string
+		commits int
+		authors []string
+		counts  []int
+	}{
+		{dir: "api", commits: 3, authors: []string{"Ada", "Grace"}, counts: []int{2, 1}},
+		{dir: ".", commits: 2, authors: []string{"Grace", "Test User"}, counts: []int{1, 1}},
+		{dir: "docs", commits: 2, authors: []string{"Ada", "Grace"}, counts: []int{1, 1}},
+	}
+	if len(got.Directories) != len(want) {
+		t.Fatalf("expected %d directories, got %+v", len(want), got.Directories)
+	}
+	for i, w := range want {
+		entry := got.Directories[i]
+		if entry.Dir != w.dir || entry.Commits != w.commits || len(entry.Contributors) != len(w.authors) {
+			t.Fatalf("directory %d: expected %s with %d commits, got %+v", i, w.dir, w.commits, entry)
+		}
+		for j, a := range entry.Contributors {
+			if a.Name != w.authors[j] || a.Commits != w.counts[j] || a.LastCommit == "" {
+				t.Fatalf("%s contributor %d: expected %s with %d commits, got %+v",
+					w.dir, j, w.authors[j], w.counts[j], a)
+			}
+			if strings.Contains(a.Name, "@") {
+				t.Fatalf("expected no email in %q", a.Name)
+			}
+		}
+	}
+
+	if got := collectExpertise(t.Context(), repoDir, "2099-01-01"); got != nil {
+		t.Fatalf("expected no expertise for an empty window, got %+v", got)
+	}
+}
@@ -0,0 +1,158 @@
+package indexer
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"os/exec"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// dryRunStatsTop caps the file types and directories a dry run lists per
+// repo.
+const dryRunStatsTop = 10
+
+// fileStatsDirDepth is how deep directories are broken down: "web" and
+// "web/assets" are both ranked, "web/assets/img" counts toward them.
+const fileStatsDirDepth = 2
+
+// noExtension labels files without an extension in FileStats.Types.
+const noExtension = "(none)"
+
+// FileStats summarizes a repo's tracked files at the commit a dry run
+// previews, for crafting skip rules and exclusions before an agent runs.
+type FileStats struct {
+	// Types are the largest file extensions by total size.
+	Types []FileTypeStat `json:"types"`
+	// Directories are the largest directories, up to two levels deep, by
+	// total size; a directory's size includes its subdirectories.
+	Directories []DirStat `json:"directories"`
+	Files       int       `json:"files"`
+	Bytes       int64     `json:"bytes"`
+}
+
+// FileTypeStat counts the tracked files with one extension.
+type FileTypeStat struct {
+	Ext   string `json:"ext"`
+	Files int    `json:"files"`
+	Bytes int64  `json:"bytes"`
+}
+
+// DirStat counts the tracked files under one directory.
+type DirStat struct {
+	Path  string `json:"path"`
+	Files int    `json:"files"`
+	Bytes int64  `json:"bytes"`
+	// Excluded is set when the manifest's exclusions already cover it.
+	Excluded bool `json:"excluded,omitempty"`
+}
+
+// collectFileStats sums the blobs of rev's tree by extension and by
+// directory. Directories under exclusions are flagged.
+func collectFileStats(ctx context.Context, repoDir, rev string, exclusions []string) (*FileStats, error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", repoDir, "ls-tree", "-r", "-l", "-z", "--full-tree", rev)
+	out, err := procOutput(ctx, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("git ls-tree %s: %w", rev, err)
+	}
+
+	stats := &FileStats{}
+	types := make(map[string]*FileTypeStat)
+	dirs := make(map[string]*DirStat)
+	for entry := range bytes.SplitSeq(out, []byte{0}) {
+		// <mode> SP <type> SP <object> SP+ <size> TAB <path>
+		meta, name, ok := strings.Cut(string(entry), "\t")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(meta)
+		if len(fields) != 4 || fields[1] != "blob" {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse ls-tree size %q: %w", fields[3], err)
+		}
+		stats.Files++
+		stats.Bytes += size
+
+		ext := strings.ToLower(path.Ext(name))
+		if ext == "" {
+			ext = noExtension
+		}
+		t, ok := types[ext]
+		if !ok {
+			t = &FileTypeStat{Ext: ext}
+			types[ext] = t
+		}
+		t.Files++
+		t.Bytes += size
+
+		parts := strings.Split(path.Dir(name), "/")
+		if parts[0] == "." {
+			continue
+		}
+		for depth := 1; depth <= min(len(parts), fileStatsDirDepth); depth++ {
+			dir := strings.Join(parts[:depth], "/")
+			d, ok := dirs[dir]
+			if !ok {
+				d = &DirStat{Path: dir, Excluded: excludedPath(dir, exclusions)}
+				dirs[dir] = d
+			}
+			d.Files++
+			d.Bytes += size
+		}
+	}
+
+	for _, t := range types {
+		stats.Types = append(stats.Types, *t)
+	}
+	slices.SortFunc(stats.Types, func(a, b FileTypeStat) int {
+		return cmp.Or(cmp.Compare(b.Bytes, a.Bytes), cmp.Compare(b.Files, a.Files), cmp.Compare(a.Ext, b.Ext))
+	})
+	stats.Types = stats.Types[:min(len(stats.Types), dryRunStatsTop)]
+	for _, d := range dirs {
+		stats.Directories = append(stats.Directories, *d)
+	}
+	slices.SortFunc(stats.Directories, func(a, b DirStat) int {
+		return cmp.Or(cmp.Compare(b.Bytes, a.Bytes), cmp.Compare(b.Files, a.Files), cmp.Compare(a.Path, b.Path))
+	})
+	stats.Directories = stats.Directories[:min(len(stats.Directories), dryRunStatsTop)]
+	return stats, nil
+}
+
+// previewFileStats records and prints the file-type histogram and the
+// largest directories of rev in a dry run.
+func (ix *indexer) previewFileStats(
+	ctx context.Context, result *RepoResult, repoDir, rev string, settings repoSettings,
+) {
+	exclusions := slices.Concat(defaultExclusions, settings.exclude)
+	stats, err := collectFileStats(ctx, repoDir, rev, exclusions)
+	if err != nil {
+		ix.log(ctx).warnf("could not collect file statistics: %v", err)
+		return
+	}
+	result.FileStats = stats
+	log := ix.log(ctx)
+	log.infof("[dry-run] tracked files: %d (%s)", stats.Files, formatBytes(stats.Bytes))
+	if len(stats.Types) > 0 {
+		log.infof("[dry-run] largest file types:")
+	}
+	for _, t := range stats.Types {
+		log.infof("[dry-run]   %-10s %6d files %10s", t.Ext, t.Files, formatBytes(t.Bytes))
+	}
+	if len(stats.Directories) > 0 {
+		log.infof("[dry-run] largest directories:")
+	}
+	for _, d := range stats.Directories {
+		note := ""
+		if d.Excluded {
+			note = " (excluded)"
+		}
+		log.infof("[dry-run]   %-30s %6d files %10s%s", d.Path+"/", d.Files, formatBytes(d.Bytes), note)
+	}
+}
@@ -0,0 +1,84 @@
+package indexer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCollectFileStats(t *testing.T) {
+	repoDir := t.TempDir()
+	initGitRepo(t, repoDir)
+	files := map[string]int{
+		"web/assets/img/logo.png": 4000,
+		"web/assets/app.js":       300,
+		"web/index.html":          100,
+		"vendor/lib/lib.go":       1000,
+		"main.go":                 200,
+		"Makefile":                50,
+	}
+	for name, size := range files {
+		path := filepath.Join(repoDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(strings.Repeat("x", size)), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	if err := runGit(repoDir, "add", "-A"); err != nil {
+		t.Fatalf("git add: %v", err)
+	}
+	if err := runGit(repoDir, "commit", "-m", "add files"); err != nil {
+		t.Fatalf("git commit: %v", err)
+	}
+
+	stats, err := collectFileStats(t.Context(), repoDir, "HEAD", defaultExclusions)
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	// initGitRepo commits a 5-byte README.md.
+	if stats.Files != 7 || stats.Bytes != 5655 {
+		t.Fatalf("expected 7 files of 5655 bytes, got %d of %d", stats.Files, stats.Bytes)
+	}
+	wantTypes := []FileTypeStat{
+		{Ext: ".png", Files: 1, Bytes: 4000},
+		{Ext: ".go", Files: 2, Bytes: 1200},
+		{Ext: ".js", Files: 1, Bytes: 300},
+		{Ext: ".html", Files: 1, Bytes: 100},
+		{Ext: noExtension, Files: 1, Bytes: 50},
+		{Ext: ".md", Files: 1, Bytes: 5},
+	}
+	if !reflect.DeepEqual(stats.Types, wantTypes) {
+		t.Fatalf("expected types %+v, got %+v", wantTypes, stats.Types)
+	}
+	wantDirs := []DirStat{
+		{Path: "web", Files: 3, Bytes: 4400},
+		{Path: "web/assets", Files: 2, Bytes: 4300},
+		{Path: "vendor", Files: 1, Bytes: 1000, Excluded: true},
+		{Path: "vendor/lib", Files: 1, Bytes: 1000, Excluded: true},
+	}
+	if !reflect.DeepEqual(stats.Directories, wantDirs) {
+		t.Fatalf("expected directories %+v, got %+v", wantDirs, stats.Directories)
+	}
+}
+
+func TestRunResultsDryRunFileStats(t *testing.T) {
+	rootDir := t.TempDir()
+	initGitRepo(t, filepath.Join(rootDir, "api"))
+
+	results, err := RunResults(Options{
+		RootDir:     rootDir,
+		SummaryJSON: filepath.Join(t.TempDir(), "summary.json"),
+		DryRun:      true,
+	})
+	if err != nil || len(results) != 1 {
+		t.Fatalf("run indexer: %v %+v", err, results)
+	}
+	stats := results[0].FileStats
+	if stats == nil || stats.Files != 1 || len(stats.Types) != 1 || stats.Types[0].Ext != ".md" {
+		t.Fatalf("expected the README in the file stats, got %+v", stats)
+	}
+}
@@ -2,14 +2,17 @@ package indexer
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os/exec"
+	"strconv"
 	"strings"
+	"time"
 )
 
 func headCommit(ctx context.Context, repoDir string) (string, error) {
 	cmd := exec.CommandContext(ctx, "git", "-C", repoDir, "rev-parse", "HEAD")
-	out, err := cmd.Output()
+	out, err := procOutput(ctx, cmd)
 	if err != nil {
 		return "", fmt.Errorf("git rev-parse HEAD: %w", err)
 	}
@@ -18,9 +21,224 @@ func headCommit(ctx context.Context, repoDir string) (string, error) {
 
 func currentBranch(ctx context.Context, repoDir string) (string, error) {
 	cmd := exec.CommandContext(ctx, "git", "-C", repoDir, "rev-parse", "--abbrev-ref", "HEAD")
-	out, err := cmd.Output()
+	out, err := procOutput(ctx, cmd)
 	if err != nil {
 		return "", fmt.Errorf("git rev-parse --abbrev-ref HEAD: %w", err)
 	}
 	return strings.TrimSpace(string(out)), nil
 }
+
+func remoteURL(ctx context.Context, repoDir, remote string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", repoDir, "remote", "get-url", remote)
+	out, err := procOutput(ctx, cmd)
+	if err != nil {
+		return "", fmt.Errorf("git remote get-url %s: %w", remote, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func headCommitTime(ctx context.Context, repoDir string) (time.Time, error) {
+	return commitTime(ctx, repoDir, "HEAD")
+}
+
+// commitTime returns the committer time of rev.
+func commitTime(ctx context.Context, repoDir, rev string) (time.Time, error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", repoDir, "log", "-1", "--format=%ct", rev)
+	out, err := procOutput(ctx, cmd)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("git log -1 --format=%%ct %s: %w", rev, err)
+	}
+	secs, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parse commit time: %w", err)
+	}
+	return time.Unix(secs, 0), nil
+}
+
+// trackedFiles lists the files git tracks in repoDir, in git's path order.
+func trackedFiles(ctx context.Context, repoDir string) ([]string, error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", repoDir, "ls-files", "-z")
+	out, err := procOutput(ctx, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("git ls-files: %w", err)
+	}
+	var names []string
+	for name := range strings.SplitSeq(string(out), "\x00") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// headState classifies what HEAD points at in a checkout.
+type headState int
+
+const (
+	headOnBranch headState = iota
+	headDetached
+	headUnborn
+)
+
+func (hs headState) String() string {
+	switch hs {
+	case headDetached:
+		return "detached"
+	case headUnborn:
+		return "unborn"
+	default:
+		return "branch"
+	}
+}
+
+// inspectHead reports whether HEAD is on a branch, detached, or unborn (a
+// branch with no commits, as in a freshly initialized repository).
+func inspectHead(ctx context.Context, repoDir string) (headState, error) {
+	verify := exec.CommandContext(ctx, "git", "-C", repoDir, "rev-parse", "--quiet", "--verify", "HEAD")
+	if err := procRun(ctx, verify); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return headOnBranch, fmt.Errorf("git rev-parse --verify HEAD: %w", err)
+		}
+		return headUnborn, nil
+	}
+
+	symbolic := exec.CommandContext(ctx, "git", "-C", repoDir, "symbolic-ref", "--quiet", "HEAD")
+	if err := procRun(ctx, symbolic); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return headOnBranch, fmt.Errorf("git symbolic-ref HEAD: %w", err)
+		}
+		return headDetached, nil
+	}
+	return headOnBranch, nil
+}
+
+func listRemotes(ctx context.Context, repoDir string) ([]string, error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", repoDir, "remote")
+	out, err := procOutput(ctx, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("git remote: %w", err)
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// Git failure classes recorded in RepoResult.GitFailure.
+const (
+	gitFailureTransient = "transient"
+	gitFailurePermanent = "permanent"
+)
+
+// transientGitPatterns are lowercase fragments of git/libcurl/ssh output
+// that indicate a network or locking problem worth retrying.
+var transientGitPatterns = []string{
+	"could not resolve host",
+	"temporary failure in name resolution",
+	"connection timed out",
+	"operation timed out",
+	"connection reset",
+	"connection refused",
+	"the remote end hung up unexpectedly",
+	"early eof",
+	"rpc failed",
+	"tls connection was non-properly terminated",
+	"gnutls_handshake() failed",
+	"ssl_error_syscall",
+	"returned error: 429",
+	"returned error: 500",
+	"returned error: 502",
+	"returned error: 503",
+	"returned error: 504",
+	"unable to create '", // stale or contended .lock file
+	"another git process seems to be running",
+}
+
+// gitCommandError carries the combined output of a failed git command so
+// failures can be classified and reported.
+type gitCommandError struct {
+	err    error
+	output string
+	args   []string
+}
+
+func (e *gitCommandError) Error() string {
+	msg := fmt.Sprintf("git %s: %v", strings.Join(e.args, " "), e.err)
+	if line := lastLine(e.output); line != "" {
+		msg += ": " + line
+	}
+	return msg
+}
+
+func (e *gitCommandError) Unwrap() error {
+	return e.err
+}
+
+// transient reports whether the failure looks like a network or lock
+// contention problem rather than a missing ref or auth failure.
+func (e *gitCommandError) transient() bool {
+	var fdErr *TooManyOpenFiles
+	if errors.As(e.err, &fdErr) {
+		return true
+	}
+	out := strings.ToLower(e.output)
+	for _, pattern := range transientGitPatterns {
+		if strings.Contains(out, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// runGitCommand runs git in repoDir with the given environment (nil
+// inherits), returning a *gitCommandError on failure.
+func runGitCommand(ctx context.Context, repoDir string, env []string, args ...string) error {
+	argv := append([]string{"-C", repoDir}, args...)
+	cmd := exec.CommandContext(ctx, "git", argv...)
+	cmd.Env = env
+	out, err := procCombinedOutput(ctx, cmd)
+	if err != nil {
+		return &gitCommandError{
+			args:   args,
+			output: string(out),
+			err:    err,
+		}
+	}
+	return nil
+}
+
+// classifyGitFailure returns gitFailureTransient or gitFailurePermanent.
+func classifyGitFailure(err error) string {
+	var gitErr *gitCommandError
+	if errors.As(err, &gitErr) && gitErr.transient() {
+		return gitFailureTransient
+	}
+	return gitFailurePermanent
+}
+
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// Repository health check levels for --health-check.
+const (
+	HealthCheckOff   = "off"
+	HealthCheckQuick = "quick"
+	HealthCheckFull  = "full"
+)
+
+// checkRepoHealth runs git fsck at the requested level. Quick checks only
+// object connectivity; full checks also verify object contents.
+func checkRepoHealth(ctx context.Context, repoDir, level string) error {
+	args := []string{"fsck", "--no-dangling", "--no-progress"}
+	switch level {
+	case HealthCheckOff, "":
+		return nil
+	case HealthCheckQuick:
+		args = append(args, "--connectivity-only")
+	case HealthCheckFull:
+	default:
+		return fmt.Errorf("unknown health check level %q", level)
+	}
+	return runGitCommand(ctx, repoDir, nil, args...)
+}
@@ -0,0 +1,180 @@
+package indexer
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInspectHead(t *testing.T) {
+	tests := map[string]struct {
+		setup func(t *testing.T, repoDir string)
+		want  headState
+	}{
+		"on branch": {
+			setup: func(t *testing.T, repoDir string) {
+				t.Helper()
+				initGitRepo(t, repoDir)
+			},
+			want: headOnBranch,
+		},
+		"detached": {
+			setup: func(t *testing.T, repoDir string) {
+				t.Helper()
+				initGitRepo(t, repoDir)
+				if err := runGit(repoDir, "checkout", "--detach"); err != nil {
+					t.Fatalf("git checkout --detach: %v", err)
+				}
+			},
+			want: headDetached,
+		},
+		"empty repo": {
+			setup: func(t *testing.T, repoDir string) {
+				t.Helper()
+				if err := os.MkdirAll(repoDir, 0o755); err != nil {
+					t.Fatalf("create repo dir: %v", err)
+				}
+				if err := runGit(repoDir, "init"); err != nil {
+					t.Fatalf("git init: %v", err)
+				}
+			},
+			want: headUnborn,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			repoDir := filepath.Join(t.TempDir(), "repo")
+			tc.setup(t, repoDir)
+
+			got, err := inspectHead(t.Context(), repoDir)
+			if err != nil {
+				t.Fatalf("inspect head: %v", err)
+			}
+			if got != tc.want {
+				t.Fatalf("expected %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestClassifyGitFailure(t *testing.T) {
+	tests := map[string]struct {
+		err  error
+		want string
+	}{
+		"dns failure": {
+			err: &gitCommandError{
+				err:    errors.New("exit status 128"),
+				output: "fatal: unable to access 'https://github.com/org/repo/': Could not resolve host: github.com\n",
+			},
+			want: gitFailureTransient,
+		},
+		"hung up": {
+			err: &gitCommandError{
+				err:    errors.New("exit status 128"),
+				output: "fatal: the remote end hung up unexpectedly\n",
+			},
+			want: gitFailureTransient,
+		},
+		"missing ref": {
+			err: &gitCommandError{
+				err:    errors.New("exit status 128"),
+				output: "fatal: couldn't find remote ref nope\n",
+			},
+			want: gitFailurePermanent,
+		},
+		"plain error": {
+			err:  errors.New("boom"),
+			want: gitFailurePermanent,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := classifyGitFailure(tc.err); got != tc.want {
+				t.Fatalf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRetryGit(t *testing.T) {
+	transient := &gitCommandError{
+		err:    errors.New("exit status 128"),
+		output: "fatal: early EOF",
+	}
+	permanent := &gitCommandError{
+		err:    errors.New("exit status 128"),
+		output: "fatal: couldn't find remote ref nope",
+	}
+
+	tests := map[string]struct {
+		errs         []error
+		wantAttempts int
+		wantErr      bool
+	}{
+		"transient then success": {
+			errs:         []error{transient, nil},
+			wantAttempts: 2,
+		},
+		"transient exhausts retries": {
+			errs:         []error{transient, transient, transient, transient},
+			wantAttempts: 3,
+			wantErr:      true,
+		},
+		"permanent not retried": {
+			errs:         []error{permanent, nil},
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ix := newIndexer(io.Discard, io.Discard, nil, nil, Options{GitRetries: 2})
+			attempts := 0
+			err := ix.retryGit(t.Context(), "git fetch", func() error {
+				err := tc.errs[attempts]
+				attempts++
+				return err
+			})
+			if attempts != tc.wantAttempts {
+				t.Fatalf("expected %d attempts, got %d", tc.wantAttempts, attempts)
+			}
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error=%t, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCheckRepoHealth(t *testing.T) {
+	repoDir := t.TempDir()
+	initGitRepo(t, repoDir)
+
+	for _, level := range []string{HealthCheckOff, HealthCheckQuick, HealthCheckFull} {
+		if err := checkRepoHealth(t.Context(), repoDir, level); err != nil {
+			t.Fatalf("healthy repo failed %s check: %v", level, err)
+		}
+	}
+
+	objects := filepath.Join(repoDir, ".git", "objects")
+	entries, err := os.ReadDir(objects)
+	if err != nil {
+		t.Fatalf("read objects dir: %v", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && len(entry.Name()) == 2 {
+			if err := os.RemoveAll(filepath.Join(objects, entry.Name())); err != nil {
+				t.Fatalf("remove objects: %v", err)
+			}
+		}
+	}
+
+	if err := checkRepoHealth(t.Context(), repoDir, HealthCheckQuick); err == nil {
+		t.Fatalf("expected corrupt repo to fail quick check")
+	}
+}
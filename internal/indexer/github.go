@@ -0,0 +1,276 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultGitHubURL is the public GitHub REST API.
+const DefaultGitHubURL = "https://api.github.com"
+
+const (
+	// githubMaxIssues caps the open issues fetched per repo.
+	githubMaxIssues = 50
+	// githubMaxPulls caps the recently merged pull requests fetched per repo.
+	githubMaxPulls = 30
+	// githubMaxPullFiles caps the changed paths recorded per pull request.
+	githubMaxPullFiles = 30
+	// githubMaxBody truncates issue and pull request descriptions, in bytes.
+	githubMaxBody = 2000
+)
+
+// GitHubOptions locates the GitHub API used by --github-issues.
+type GitHubOptions struct {
+	// URL is the REST API base URL; GitHub Enterprise uses
+	// https://<host>/api/v3.
+	URL string
+	// Token, when set, is sent as a bearer token. Public repos work
+	// without one at a lower rate limit.
+	Token string
+}
+
+// githubClient talks to the GitHub REST API.
+type githubClient struct {
+	http *http.Client
+	opts GitHubOptions
+}
+
+// githubError is a non-2xx response from the API.
+type githubError struct {
+	Path   string
+	Body   string
+	Status int
+}
+
+func (e *githubError) Error() string {
+	return fmt.Sprintf("github GET %s: %d %s", e.Path, e.Status, e.Body)
+}
+
+// githubItem is an issue or pull request as written to the issues file.
+type githubItem struct {
+	Title    string   `json:"title"`
+	URL      string   `json:"url"`
+	Body     string   `json:"body,omitempty"`
+	Date     string   `json:"date"`
+	Labels   []string `json:"labels,omitempty"`
+	Paths    []string `json:"paths,omitempty"`
+	Number   int      `json:"number"`
+	Pull     bool     `json:"pull"`
+	Complete bool     `json:"complete"`
+}
+
+// githubContext is the issues file: the repo's open issues and recently
+// merged pull requests.
+type githubContext struct {
+	Repo   string       `json:"repo"`
+	Issues []githubItem `json:"issues"`
+	Pulls  []githubItem `json:"pulls"`
+}
+
+// manifestIssues points Codex at the fetched issues and pull requests.
+type manifestIssues struct {
+	// File is a JSON file with the issues and pull requests; manifest.write
+	// fills it in.
+	File string `json:"file"`
+	// Repo is the GitHub "owner/name".
+	Repo   string `json:"repo"`
+	Issues int    `json:"issues"`
+	Pulls  int    `json:"pulls"`
+}
+
+func newGitHubClient(opts GitHubOptions) *githubClient {
+	if opts.URL == "" {
+		opts.URL = DefaultGitHubURL
+	}
+	return &githubClient{
+		http: &http.Client{Timeout: time.Minute},
+		opts: opts,
+	}
+}
+
+// webHost is the host repos served by the API are cloned from: github.com
+// for the public API, the API's own host for GitHub Enterprise.
+func (c *githubClient) webHost() string {
+	u, err := url.Parse(c.opts.URL)
+	if err != nil {
+		return ""
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "api.github.com" {
+		return "github.com"
+	}
+	return host
+}
+
+// repoFor returns the "owner/name" of remote when it is hosted on the
+// API's host.
+func (c *githubClient) repoFor(remote string) (string, bool) {
+	host, path, ok := strings.Cut(normalizeRemoteURL(remote), "/")
+	if !ok || host != c.webHost() {
+		return "", false
+	}
+	owner, name, ok := strings.Cut(path, "/")
+	if !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+		return "", false
+	}
+	return path, true
+}
+
+func (c *githubClient) get(ctx context.Context, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(c.opts.URL, "/")+path, nil)
+	if err != nil {
+		return fmt.Errorf("build github request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if c.opts.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.opts.Token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("github request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read github response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &githubError{Path: path, Body: strings.TrimSpace(string(data)), Status: resp.StatusCode}
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("decode github response: %w", err)
+	}
+	return nil
+}
+
+// githubAPIItem is the subset of issue and pull request fields used.
+type githubAPIItem struct {
+	PullRequest *struct{} `json:"pull_request"`
+	MergedAt    *string   `json:"merged_at"`
+	Title       string    `json:"title"`
+	HTMLURL     string    `json:"html_url"`
+	Body        string    `json:"body"`
+	CreatedAt   string    `json:"created_at"`
+	Labels      []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	Number int `json:"number"`
+}
+
+func (it githubAPIItem) item(pull bool, date string) githubItem {
+	body, complete := truncateBody(it.Body)
+	item := githubItem{
+		Title:    it.Title,
+		URL:      it.HTMLURL,
+		Body:     body,
+		Date:     date,
+		Number:   it.Number,
+		Pull:     pull,
+		Complete: complete,
+	}
+	for _, l := range it.Labels {
+		item.Labels = append(item.Labels, l.Name)
+	}
+	return item
+}
+
+// truncateBody cuts s to githubMaxBody bytes on a rune boundary and
+// reports whether it was kept whole.
+func truncateBody(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	if len(s) <= githubMaxBody {
+		return s, true
+	}
+	cut := githubMaxBody
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut], false
+}
+
+// fetchContext returns repo's open issues and its most recently merged pull
+// requests with the paths they changed. A failed file listing leaves that
+// pull request's paths empty.
+func (c *githubClient) fetchContext(ctx context.Context, repo string) (*githubContext, error) {
+	gc := &githubContext{Repo: repo}
+
+	var issues []githubAPIItem
+	path := "/repos/" + repo + "/issues?state=open&sort=updated&per_page=" + strconv.Itoa(githubMaxIssues)
+	if err := c.get(ctx, path, &issues); err != nil {
+		return nil, err
+	}
+	for _, it := range issues {
+		// The issues endpoint also lists pull requests.
+		if it.PullRequest == nil {
+			gc.Issues = append(gc.Issues, it.item(false, it.CreatedAt))
+		}
+	}
+
+	// Closed pull requests include unmerged ones, so over-fetch and filter.
+	var pulls []githubAPIItem
+	path = "/repos/" + repo + "/pulls?state=closed&sort=updated&direction=desc&per_page=" +
+		strconv.Itoa(2*githubMaxPulls)
+	if err := c.get(ctx, path, &pulls); err != nil {
+		return nil, err
+	}
+	for _, it := range pulls {
+		if it.MergedAt == nil {
+			continue
+		}
+		item := it.item(true, *it.MergedAt)
+		var files []struct {
+			Filename string `json:"filename"`
+		}
+		path := "/repos/" + repo + "/pulls/" + strconv.Itoa(it.Number) + "/files?per_page=" +
+			strconv.Itoa(githubMaxPullFiles)
+		if err := c.get(ctx, path, &files); err != nil && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		for _, f := range files {
+			item.Paths = append(item.Paths, f.Filename)
+		}
+		gc.Pulls = append(gc.Pulls, item)
+		if len(gc.Pulls) == githubMaxPulls {
+			break
+		}
+	}
+	return gc, nil
+}
+
+// prepareIssues fetches the repo's GitHub issues and pull requests for the
+// issues pass when --github-issues is set. Repos not hosted on the API's
+// host, and fetch failures, are logged and indexed without them.
+func (ix *indexer) prepareIssues(ctx context.Context, m *indexManifest, remote string, dryRun bool) {
+	if !ix.opts.GitHubIssues {
+		return
+	}
+	log := ix.log(ctx)
+	client := newGitHubClient(ix.opts.GitHub)
+	repo, ok := client.repoFor(remote)
+	if !ok {
+		log.infof("no GitHub remote on %s; skipping issues", client.webHost())
+		return
+	}
+	if dryRun {
+		log.infof("[dry-run] would fetch GitHub issues for %s", repo)
+		return
+	}
+	gc, err := client.fetchContext(ctx, repo)
+	if err != nil {
+		log.warnf("could not fetch GitHub issues for %s: %v", repo, err)
+		return
+	}
+	log.infof("GitHub %s: %d open issues, %d merged pull requests", repo, len(gc.Issues), len(gc.Pulls))
+	m.Issues = &manifestIssues{Repo: repo, Issues: len(gc.Issues), Pulls: len(gc.Pulls)}
+	m.issueContext = gc
+}
@@ -0,0 +1,159 @@
+package indexer
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestGitHubRepoFor(t *testing.T) {
+	tests := map[string]struct {
+		url    string
+		remote string
+		want   string
+	}{
+		"https":             {remote: "https://github.com/Org/api.git", want: "Org/api"},
+		"scp":               {remote: "git@github.com:org/api.git", want: "org/api"},
+		"other host":        {remote: "https://gitlab.com/org/api.git"},
+		"no remote":         {},
+		"nested path":       {remote: "https://github.com/org/group/api.git"},
+		"enterprise":        {url: "https://git.corp/api/v3", remote: "git@git.corp:org/api.git", want: "org/api"},
+		"enterprise public": {url: "https://git.corp/api/v3", remote: "https://github.com/org/api.git"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, ok := newGitHubClient(GitHubOptions{URL: tc.url}).repoFor(tc.remote)
+			if got != tc.want || ok != (tc.want != "") {
+				t.Fatalf("expected %q, got %q (ok=%t)", tc.want, got, ok)
+			}
+		})
+	}
+}
+
+func TestGitHubFetchContext(t *testing.T) {
+	merged := "2026-01-02T03:04:05Z"
+	responses := map[string]any{
+		"/repos/org/api/issues": []map[string]any{
+			{"number": 1, "title": "Login fails", "html_url": "https://github.com/org/api/issues/1",
+				"body": strings.Repeat("é", githubMaxBody), "created_at": "2026-01-01T00:00:00Z",
+				"labels": []map[string]any{{"name": "bug"}, {"name": "auth"}}},
+			{"number": 2, "title": "A pull request", "pull_request": map[string]any{}},
+		},
+		"/repos/org/api/pulls": []map[string]any{
+			{"number": 3, "title": "Fix login", "merged_at": merged, "body": "Fixes #1"},
+			{"number": 4, "title": "Abandoned", "merged_at": nil},
+		},
+		"/repos/org/api/pulls/3/files": []map[string]any{{"filename": "internal/auth/login.go"}},
+	}
+	var gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		resp, ok := responses[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+
+	client := newGitHubClient(GitHubOptions{URL: srv.URL, Token: "secret"})
+	gc, err := client.fetchContext(t.Context(), "org/api")
+	if err != nil {
+		t.Fatalf("fetch context: %v", err)
+	}
+	if gotAuth != "Bearer secret" {
+		t.Fatalf("expected the token as a bearer token, got %q", gotAuth)
+	}
+
+	if len(gc.Issues) != 1 {
+		t.Fatalf("expected pull requests filtered from issues, got %+v", gc.Issues)
+	}
+	issue := gc.Issues[0]
+	if issue.Number != 1 || issue.Pull || issue.Complete || len(issue.Body) > githubMaxBody ||
+		!strings.HasSuffix(issue.Body, "é") || strings.Join(issue.Labels, ",") != "bug,auth" {
+		t.Fatalf("unexpected issue: %+v", issue)
+	}
+
+	if len(gc.Pulls) != 1 {
+		t.Fatalf("expected only merged pull requests, got %+v", gc.Pulls)
+	}
+	pull := gc.Pulls[0]
+	if pull.Number != 3 || !pull.Pull || !pull.Complete || pull.Date != merged ||
+		len(pull.Paths) != 1 || pull.Paths[0] != "internal/auth/login.go" {
+		t.Fatalf("unexpected pull request: %+v", pull)
+	}
+
+	if _, err := client.fetchContext(t.Context(), "org/missing"); err == nil {
+		t.Fatalf("expected an error for a missing repo")
+	}
+}
+
+func TestPrepareIssues(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("[]"))
+	}))
+	t.Cleanup(srv.Close)
+
+	tests := map[string]struct {
+		remote   string
+		dryRun   bool
+		disabled bool
+		want     bool
+		log      string
+	}{
+		"fetched":   {remote: "https://github.com/org/api.git", want: true, log: "0 open issues"},
+		"dry run":   {remote: "https://github.com/org/api.git", dryRun: true, log: "[dry-run]"},
+		"no remote": {remote: "https://gitlab.com/org/api.git", log: "skipping issues"},
+		"disabled":  {remote: "https://github.com/org/api.git", disabled: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			ix := newIndexer(&out, &out, nil, nil, Options{
+				GitHubIssues: !tc.disabled,
+				GitHub:       GitHubOptions{URL: srv.URL},
+			})
+			// The test server is not github.com, so point repoFor at it.
+			if strings.HasPrefix(tc.remote, "https://github.com/") {
+				tc.remote = strings.Replace(tc.remote, "github.com", "127.0.0.1", 1)
+			}
+			m := &indexManifest{}
+			ix.prepareIssues(t.Context(), m, tc.remote, tc.dryRun)
+			if (m.Issues != nil) != tc.want {
+				t.Fatalf("expected issues=%t, got %+v", tc.want, m.Issues)
+			}
+			if !strings.Contains(out.String(), tc.log) || (tc.log == "" && out.Len() > 0) {
+				t.Fatalf("expected log %q, got %q", tc.log, out.String())
+			}
+			if !tc.want {
+				return
+			}
+
+			path, err := m.write(t.TempDir())
+			if err != nil {
+				t.Fatalf("write manifest: %v", err)
+			}
+			data, err := os.ReadFile(m.Issues.File)
+			if err != nil {
+				t.Fatalf("read issues file: %v", err)
+			}
+			var gc githubContext
+			if err := json.Unmarshal(data, &gc); err != nil || gc.Repo != "org/api" {
+				t.Fatalf("expected the issues file for org/api, got %+v (%v)", gc, err)
+			}
+			if err := m.remove(path); err != nil {
+				t.Fatalf("remove manifest: %v", err)
+			}
+			if _, err := os.Stat(m.Issues.File); !os.IsNotExist(err) {
+				t.Fatalf("expected the issues file removed, got %v", err)
+			}
+		})
+	}
+}
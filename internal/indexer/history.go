@@ -0,0 +1,466 @@
+package indexer
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	// Registers the pure-Go "sqlite" database/sql driver.
+	_ "modernc.org/sqlite"
+)
+
+const historySchema = `
+CREATE TABLE IF NOT EXISTS runs (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	started_at  TEXT    NOT NULL,
+	finished_at TEXT    NOT NULL,
+	root_dir    TEXT    NOT NULL,
+	dry_run     INTEGER NOT NULL,
+	repo_count  INTEGER NOT NULL,
+	ok_count    INTEGER NOT NULL,
+	warn_count  INTEGER NOT NULL,
+	error_count INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS repo_runs (
+	run_id          INTEGER NOT NULL REFERENCES runs(id),
+	slug            TEXT    NOT NULL,
+	path            TEXT    NOT NULL,
+	status          TEXT    NOT NULL,
+	duration_ms     INTEGER NOT NULL,
+	codex_ran       INTEGER NOT NULL,
+	codex_exit_code INTEGER,
+	error           TEXT    NOT NULL,
+	skip_reason     TEXT    NOT NULL,
+	indexed_commit  TEXT    NOT NULL,
+	diff_file_count INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS repo_runs_slug ON repo_runs(slug, run_id);
+`
+
+// historyColumns are repo_runs columns added after the table was first
+// released; openHistory adds the ones an older database lacks.
+var historyColumns = []struct{ name, def string }{
+	{"agent_duration_ms", "INTEGER NOT NULL DEFAULT 0"},
+	{"prompt_tokens", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+// DefaultTrendWindow is the number of recent indexing runs per repo that
+// trends are computed over.
+const DefaultTrendWindow = 10
+
+func openHistory(ctx context.Context, path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("open history %s: %w", path, err)
+	}
+	if _, err := db.ExecContext(ctx, historySchema); err != nil {
+		return nil, errors.Join(fmt.Errorf("migrate history %s: %w", path, err), db.Close())
+	}
+	if err := addHistoryColumns(ctx, db); err != nil {
+		return nil, errors.Join(fmt.Errorf("migrate history %s: %w", path, err), db.Close())
+	}
+	return db, nil
+}
+
+// addHistoryColumns adds the historyColumns missing from repo_runs.
+func addHistoryColumns(ctx context.Context, db *sql.DB) error {
+	rows, err := db.QueryContext(ctx, `SELECT name FROM pragma_table_info('repo_runs')`)
+	if err != nil {
+		return err
+	}
+	have := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return errors.Join(err, rows.Close())
+		}
+		have[name] = true
+	}
+	if err := errors.Join(rows.Err(), rows.Close()); err != nil {
+		return err
+	}
+
+	for _, col := range historyColumns {
+		if have[col.name] {
+			continue
+		}
+		if _, err := db.ExecContext(ctx, "ALTER TABLE repo_runs ADD COLUMN "+col.name+" "+col.def); err != nil {
+			return fmt.Errorf("add column %s: %w", col.name, err)
+		}
+	}
+	return nil
+}
+
+// recordHistory appends one run and its per-repo results to the history
+// database.
+func recordHistory(
+	ctx context.Context,
+	path string,
+	started time.Time,
+	rootDir string,
+	dryRun bool,
+	results []RepoResult,
+) (err error) {
+	db, err := openHistory(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("close history: %w", closeErr)
+		}
+	}()
+
+	counts := make(map[string]int)
+	for i := range results {
+		counts[repoStatus(&results[i])]++
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin history transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, tx.Rollback())
+		}
+	}()
+
+	res, err := tx.ExecContext(ctx,
+		`INSERT INTO runs (started_at, finished_at, root_dir, dry_run, repo_count, ok_count, warn_count, error_count)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		started.UTC().Format(time.RFC3339),
+		time.Now().UTC().Format(time.RFC3339),
+		rootDir,
+		dryRun,
+		len(results),
+		counts[statusOK],
+		counts[statusWarn],
+		counts[statusError],
+	)
+	if err != nil {
+		return fmt.Errorf("insert run: %w", err)
+	}
+	runID, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("run id: %w", err)
+	}
+
+	for i := range results {
+		r := &results[i]
+		var exitCode sql.NullInt64
+		if r.CodexExitCode != nil {
+			exitCode = sql.NullInt64{Int64: int64(*r.CodexExitCode), Valid: true}
+		}
+		if _, err = tx.ExecContext(ctx,
+			`INSERT INTO repo_runs (run_id, slug, path, status, duration_ms, codex_ran, codex_exit_code,
+			                        error, skip_reason, indexed_commit, diff_file_count,
+			                        agent_duration_ms, prompt_tokens)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			runID,
+			r.CollectionSlug,
+			r.Path,
+			repoStatus(r),
+			r.DurationMS,
+			r.CodexRan,
+			exitCode,
+			r.Error,
+			r.SkipReason,
+			r.IndexedCommit,
+			r.DiffFileCount,
+			r.AgentDurationMS,
+			r.PromptTokens,
+		); err != nil {
+			return fmt.Errorf("insert repo run %s: %w", r.CollectionSlug, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("commit history: %w", err)
+	}
+	return nil
+}
+
+// TrendOptions filters the trends report.
+type TrendOptions struct {
+	// Repo limits the report to one collection slug.
+	Repo string
+	// Window is the number of recent Codex runs per repo to aggregate; the
+	// window before it is used for the duration delta.
+	Window int
+}
+
+// repoTrend aggregates the recent Codex runs of one repo.
+type repoTrend struct {
+	lastRun     time.Time
+	slug        string
+	lastStatus  string
+	runs        int
+	failures    int
+	avgDuration time.Duration
+	// prevAvg is the average duration over the preceding window, or zero
+	// when there is not enough history.
+	prevAvg time.Duration
+	// avgAgent and avgTokens are the window's average agent time and
+	// prompt tokens, the cost of indexing the repo; runs recorded before
+	// they were kept are left out.
+	avgAgent  time.Duration
+	avgTokens int
+	// prevAgent is the average agent time over the preceding window.
+	prevAgent time.Duration
+}
+
+type historyRow struct {
+	startedAt time.Time
+	slug      string
+	status    string
+	duration  time.Duration
+	agent     time.Duration
+	tokens    int
+}
+
+// ReportTrends prints per-repo duration, cost, and failure trends from the
+// history database. Cost is the agent time and estimated prompt tokens; the
+// agents do not report what a run was billed. Dry runs and runs where Codex
+// did not execute are ignored.
+func ReportTrends(ctx context.Context, w io.Writer, path string, opts TrendOptions) (err error) {
+	if _, statErr := os.Stat(path); statErr != nil {
+		return fmt.Errorf("history %s: %w", path, statErr)
+	}
+	if opts.Window <= 0 {
+		opts.Window = DefaultTrendWindow
+	}
+
+	db, err := openHistory(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("close history: %w", closeErr)
+		}
+	}()
+
+	rows, err := loadHistoryRows(ctx, db, opts.Repo)
+	if err != nil {
+		return err
+	}
+	trends := computeTrends(rows, opts.Window)
+	if len(trends) == 0 {
+		_, err := fmt.Fprintln(w, "No indexing history recorded yet.")
+		if err != nil {
+			return fmt.Errorf("write trends: %w", err)
+		}
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, summaryTabPadding, ' ', 0)
+	header := "Repo\tRuns\tFailures\tAvg Duration\tChange\tAvg Agent Time\tChange\tAvg Prompt Tokens\t" +
+		"Last Status\tLast Run"
+	if _, err := fmt.Fprintln(tw, header); err != nil {
+		return fmt.Errorf("write trends: %w", err)
+	}
+	for _, t := range trends {
+		if _, err := fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			t.slug,
+			t.runs,
+			t.failures,
+			t.avgDuration.Round(time.Second),
+			formatDurationChange(t.avgDuration, t.prevAvg),
+			orDash(formatAgentTime(t.avgAgent)),
+			formatDurationChange(t.avgAgent, t.prevAgent),
+			orDash(formatTokens(t.avgTokens)),
+			colorStatus(t.lastStatus),
+			t.lastRun.Local().Format(time.DateTime),
+		); err != nil {
+			return fmt.Errorf("write trends: %w", err)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("flush trends: %w", err)
+	}
+	return nil
+}
+
+// loadExpectedDurations returns each repo's average duration over its
+// recent indexing runs in the history database at path, for estimating
+// when a run will finish. A missing database yields no estimates.
+func loadExpectedDurations(ctx context.Context, path string) (_ map[string]time.Duration, err error) {
+	if path == "" {
+		return nil, nil
+	}
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	db, err := openHistory(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("close history: %w", closeErr)
+		}
+	}()
+
+	rows, err := loadHistoryRows(ctx, db, "")
+	if err != nil {
+		return nil, err
+	}
+	expected := make(map[string]time.Duration)
+	for _, trend := range computeTrends(rows, DefaultTrendWindow) {
+		expected[trend.slug] = trend.avgDuration
+	}
+	return expected, nil
+}
+
+func loadHistoryRows(ctx context.Context, db *sql.DB, repo string) ([]historyRow, error) {
+	query := `SELECT r.started_at, rr.slug, rr.status, rr.duration_ms, rr.agent_duration_ms, rr.prompt_tokens
+	          FROM repo_runs rr JOIN runs r ON r.id = rr.run_id
+	          WHERE r.dry_run = 0 AND rr.codex_ran = 1`
+	var args []any
+	if repo != "" {
+		query += " AND rr.slug = ?"
+		args = append(args, repo)
+	}
+	query += " ORDER BY r.id DESC"
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query history: %w", err)
+	}
+	defer rows.Close()
+
+	var out []historyRow
+	for rows.Next() {
+		var (
+			startedAt  string
+			row        historyRow
+			durationMS int64
+			agentMS    int64
+		)
+		if err := rows.Scan(&startedAt, &row.slug, &row.status, &durationMS, &agentMS, &row.tokens); err != nil {
+			return nil, fmt.Errorf("scan history: %w", err)
+		}
+		row.startedAt, err = time.Parse(time.RFC3339, startedAt)
+		if err != nil {
+			return nil, fmt.Errorf("parse history time %q: %w", startedAt, err)
+		}
+		row.duration = time.Duration(durationMS) * time.Millisecond
+		row.agent = time.Duration(agentMS) * time.Millisecond
+		out = append(out, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read history: %w", err)
+	}
+	return out, nil
+}
+
+// computeTrends groups newest-first rows by repo and aggregates the most
+// recent window, comparing its average duration and agent time to the window
+// before it.
+func computeTrends(rows []historyRow, window int) []repoTrend {
+	bySlug := make(map[string][]historyRow)
+	for _, row := range rows {
+		bySlug[row.slug] = append(bySlug[row.slug], row)
+	}
+
+	trends := make([]repoTrend, 0, len(bySlug))
+	for slug, repoRows := range bySlug {
+		recent := repoRows[:min(window, len(repoRows))]
+		trend := repoTrend{
+			slug:        slug,
+			runs:        len(recent),
+			lastRun:     recent[0].startedAt,
+			lastStatus:  recent[0].status,
+			avgDuration: averageDuration(recent),
+		}
+		trend.avgAgent, trend.avgTokens = averageCost(recent)
+		for _, row := range recent {
+			if row.status == statusError {
+				trend.failures++
+			}
+		}
+		if len(repoRows) > window {
+			prev := repoRows[window:min(2*window, len(repoRows))]
+			trend.prevAvg = averageDuration(prev)
+			trend.prevAgent, _ = averageCost(prev)
+		}
+		trends = append(trends, trend)
+	}
+
+	slices.SortFunc(trends, func(a, b repoTrend) int {
+		if a.failures != b.failures {
+			return b.failures - a.failures
+		}
+		if a.slug < b.slug {
+			return -1
+		}
+		if a.slug > b.slug {
+			return 1
+		}
+		return 0
+	})
+	return trends
+}
+
+func averageDuration(rows []historyRow) time.Duration {
+	if len(rows) == 0 {
+		return 0
+	}
+	var total time.Duration
+	for _, row := range rows {
+		total += row.duration
+	}
+	return total / time.Duration(len(rows))
+}
+
+// averageCost averages agent time and prompt tokens over the rows that
+// recorded them.
+func averageCost(rows []historyRow) (time.Duration, int) {
+	var (
+		agent  time.Duration
+		tokens int
+		n      int
+	)
+	for _, row := range rows {
+		if row.agent <= 0 && row.tokens <= 0 {
+			continue
+		}
+		agent += row.agent
+		tokens += row.tokens
+		n++
+	}
+	if n == 0 {
+		return 0, 0
+	}
+	return agent / time.Duration(n), tokens / n
+}
+
+func formatAgentTime(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	return d.Round(time.Second).String()
+}
+
+func formatTokens(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+func formatDurationChange(current, previous time.Duration) string {
+	if previous <= 0 {
+		return "-"
+	}
+	pct := (float64(current) - float64(previous)) / float64(previous) * 100
+	return fmt.Sprintf("%+.0f%%", pct)
+}
@@ -0,0 +1,130 @@
+package indexer
+
+import (
+	"bytes"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordHistoryAndReportTrends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	exitCode := 1
+
+	runs := [][]RepoResult{
+		{
+			{CollectionSlug: "api", Path: "/root/api", CodexRan: true, DurationMS: 60_000, PromptTokens: 1000},
+			{CollectionSlug: "web", Path: "/root/web", CodexRan: true, DurationMS: 30_000},
+		},
+		{
+			{
+				CollectionSlug: "api", Path: "/root/api", CodexRan: true, DurationMS: 90_000,
+				AgentDurationMS: 80_000, PromptTokens: 3000,
+			},
+			{CollectionSlug: "web", Path: "/root/web", CodexRan: true, CodexExitCode: &exitCode, Error: "boom"},
+		},
+	}
+	for _, results := range runs {
+		if err := recordHistory(t.Context(), path, time.Now(), "/root", false, results); err != nil {
+			t.Fatalf("record history: %v", err)
+		}
+	}
+	dryRun := []RepoResult{{CollectionSlug: "dry", Path: "/root/dry", CodexRan: true}}
+	if err := recordHistory(t.Context(), path, time.Now(), "/root", true, dryRun); err != nil {
+		t.Fatalf("record dry-run history: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := ReportTrends(t.Context(), &buf, path, TrendOptions{}); err != nil {
+		t.Fatalf("report trends: %v", err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{"api", "web", "1m15s", "40s", "2000"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected report to contain %q, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "dry") {
+		t.Fatalf("expected dry runs to be excluded, got:\n%s", out)
+	}
+}
+
+func TestOpenHistoryAddsColumns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	// repo_runs as first released, without the cost columns.
+	if _, err := db.ExecContext(t.Context(), `CREATE TABLE repo_runs (
+		run_id INTEGER NOT NULL, slug TEXT NOT NULL, path TEXT NOT NULL, status TEXT NOT NULL,
+		duration_ms INTEGER NOT NULL, codex_ran INTEGER NOT NULL, codex_exit_code INTEGER,
+		error TEXT NOT NULL, skip_reason TEXT NOT NULL, indexed_commit TEXT NOT NULL,
+		diff_file_count INTEGER NOT NULL)`); err != nil {
+		t.Fatalf("create old table: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("close database: %v", err)
+	}
+
+	results := []RepoResult{{CollectionSlug: "api", Path: "/root/api", CodexRan: true, AgentDurationMS: 5000}}
+	if err := recordHistory(t.Context(), path, time.Now(), "/root", false, results); err != nil {
+		t.Fatalf("record history in an old database: %v", err)
+	}
+}
+
+func TestLoadExpectedDurations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	if expected, err := loadExpectedDurations(t.Context(), path); err != nil || expected != nil {
+		t.Fatalf("expected no estimates without a database, got %v, %v", expected, err)
+	}
+
+	for _, ms := range []int64{60_000, 120_000} {
+		results := []RepoResult{{CollectionSlug: "api", Path: "/root/api", CodexRan: true, DurationMS: ms}}
+		if err := recordHistory(t.Context(), path, time.Now(), "/root", false, results); err != nil {
+			t.Fatalf("record history: %v", err)
+		}
+	}
+	expected, err := loadExpectedDurations(t.Context(), path)
+	if err != nil {
+		t.Fatalf("load expected durations: %v", err)
+	}
+	if expected["api"] != 90*time.Second {
+		t.Fatalf("expected api to average 1m30s, got %v", expected)
+	}
+}
+
+func TestComputeTrends(t *testing.T) {
+	now := time.Now()
+	rows := []historyRow{
+		{slug: "api", status: statusError, duration: 4 * time.Minute, startedAt: now},
+		{slug: "api", status: statusOK, duration: 2 * time.Minute, startedAt: now.Add(-time.Hour)},
+		{slug: "api", status: statusOK, duration: 1 * time.Minute, startedAt: now.Add(-2 * time.Hour)},
+		{slug: "web", status: statusOK, duration: time.Minute, startedAt: now},
+	}
+
+	trends := computeTrends(rows, 2)
+	if len(trends) != 2 {
+		t.Fatalf("expected 2 trends, got %d", len(trends))
+	}
+
+	api := trends[0]
+	if api.slug != "api" {
+		t.Fatalf("expected failing repo first, got %q", api.slug)
+	}
+	if api.runs != 2 || api.failures != 1 {
+		t.Fatalf("expected 2 runs and 1 failure, got %d runs and %d failures", api.runs, api.failures)
+	}
+	if api.avgDuration != 3*time.Minute {
+		t.Fatalf("expected avg 3m, got %s", api.avgDuration)
+	}
+	if api.prevAvg != time.Minute {
+		t.Fatalf("expected previous avg 1m, got %s", api.prevAvg)
+	}
+	if got := formatDurationChange(api.avgDuration, api.prevAvg); got != "+200%" {
+		t.Fatalf("expected +200%%, got %q", got)
+	}
+}
@@ -2,48 +2,437 @@ package indexer
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strconv"
 	"sync"
 	"time"
 )
 
+// Options configures a single indexing run.
+type Options struct {
+	// RootDir is scanned for git repositories.
+	RootDir string
+	// SummaryJSON is the JSON summary output path; empty writes no summary
+	// unless ArtifactsDir is set.
+	SummaryJSON string
+	// SummaryAppend, when set, also appends each run's summary as one line
+	// to this NDJSON file.
+	SummaryAppend string
+	// CachePath is the commit cache file; empty disables the cache.
+	CachePath string
+	// SlugMapPath persists remote URL -> slug so moved checkouts keep their
+	// collection; empty disables move detection.
+	SlugMapPath string
+	// ConfigPath is an optional JSON config file with per-repo settings.
+	ConfigPath string
+	// HistoryPath is the SQLite run history database; empty disables it.
+	HistoryPath string
+	// EventsPath receives an NDJSON event per repo state transition; "-"
+	// streams to stdout (console logs then go to stderr) and empty disables
+	// events.
+	EventsPath string
+	// StatusPath is rewritten atomically on every repo state transition with
+	// per-repo states, queue depth, and an ETA; empty disables it.
+	StatusPath string
+	// DetachedHeadPolicy is "index" or "skip" for checkouts with a detached
+	// HEAD.
+	DetachedHeadPolicy string
+	// EmptyRepoPolicy is "skip" or "index" for checkouts whose HEAD has no
+	// commits; "index" runs Codex on the working tree as-is.
+	EmptyRepoPolicy string
+	// PrepFailurePolicy is "fallback", "skip", or "fail" for repos whose
+	// index worktree could not be prepared; "fallback" indexes the
+	// checkout's current working tree.
+	PrepFailurePolicy string
+	// Agent selects the built-in agent backend: AgentCodex (the default),
+	// AgentClaude, or AgentGemini.
+	Agent string
+	// AgentBackend, when set, is used instead of the Agent backend.
+	AgentBackend AgentBackend
+	// Ingest is how documents reach the store: IngestMCP (the default) has
+	// the agent write them through its Chroma MCP server, IngestDirect has
+	// it write them to a file the indexer upserts over the Chroma HTTP API,
+	// and IngestLocal runs no agent and upserts summaries the indexer
+	// generates from the repo's files.
+	Ingest string
+	// Embeddings selects how documents stored under IngestDirect and
+	// IngestLocal are chunked and embedded.
+	Embeddings EmbeddingOptions
+	// LocalFiles adds, under IngestLocal, a source_file document for every
+	// tracked text file, chunked by the embedding pipeline.
+	LocalFiles bool
+	// IngestBatchSize is how many documents go in one upsert or delete
+	// request under IngestDirect and IngestLocal; zero uses
+	// DefaultIngestBatchSize.
+	IngestBatchSize int
+	// IngestParallel caps the batches being embedded and written at once,
+	// across all repos; zero means no cap.
+	IngestParallel int
+	// IngestRetries is how many times a store write that fails with a 5xx
+	// or 429 response is retried.
+	IngestRetries int
+	// IngestRetryDelay bounds the random wait before the first store write
+	// retry; the bound doubles each attempt.
+	IngestRetryDelay time.Duration
+	// CodexPath is the agent executable; empty runs the backend's
+	// Executable from PATH.
+	CodexPath string
+	// TempDir holds index worktrees and is exported as TMPDIR to codegen and
+	// Codex; empty uses os.TempDir().
+	TempDir string
+	// MirrorDir, when set, holds bare --mirror clones keyed by remote URL;
+	// worktrees are created from them instead of fetching into checkouts.
+	MirrorDir string
+	// Profile adds a built-in pass to every repo's pipeline: "security"
+	// reviews auth, secrets, input validation, and dangerous sinks; "infra"
+	// summarizes Terraform, Kubernetes, and Helm in repos that have them.
+	// Empty adds none.
+	Profile string
+	// ExpertiseSince is the history window for Expertise, as a git --since
+	// value; empty uses DefaultExpertiseSince.
+	ExpertiseSince string
+	// OnboardingDir, when set, has Codex also write a human-readable
+	// ONBOARDING.generated.md per repo under <dir>/<slug>/.
+	OnboardingDir string
+	// HealthCheck runs git fsck before indexing: "off", "quick"
+	// (connectivity only), or "full".
+	HealthCheck string
+	// DuplicatePolicy picks which checkout to index when several share an
+	// remote: "newest" (latest HEAD commit), "first", or "off".
+	DuplicatePolicy string
+	// SlugPolicy handles slugs that are not valid Chroma collection names:
+	// "fix" (rewrite them) or "fail" (skip the repo with an error).
+	SlugPolicy string
+	// SinceCommit, when set, replaces the cached diff base with this commit,
+	// reindexing everything changed since it. Repos that do not contain it
+	// are skipped.
+	SinceCommit string
+	// SummaryOnly limits summary table rows to "errors" or "warnings"
+	// (warn and error); empty shows every repo.
+	SummaryOnly string
+	// SummarySort orders summary table rows by "duration" (slowest first),
+	// "status" (errors first), or "name"; empty keeps discovery order.
+	SummarySort string
+	// SkipRepos lists repo slugs, basenames, or paths to skip.
+	SkipRepos []string
+	// Tags, when set, limits the run to repos with at least one of these
+	// config tags; the rest are skipped.
+	Tags []string
+	// MaxRepos, when positive, indexes at most that many stale repos per
+	// run, most stale first by the ranking of ReportStaleness; the other
+	// stale repos are skipped as deferred. Repos already at their tip do
+	// not count against it.
+	MaxRepos int
+	// SummaryColumns selects and orders the console summary table columns;
+	// empty uses the default layout.
+	SummaryColumns []string
+	// BranchFallbacks are local branch names tried in order when
+	// <remote>/HEAD is unset. Defaults to main, master.
+	BranchFallbacks []string
+	// Remotes is the remote preference order; the first one present in a
+	// repo is fetched from. Defaults to origin.
+	Remotes []string
+	// Proxy overrides proxy settings for git fetches.
+	Proxy ProxyConfig
+	// Chroma locates the collection store consulted by Sync, StoreCheck,
+	// and the Dependencies change check.
+	Chroma ChromaOptions
+	// GitHub locates the API queried by GitHubIssues.
+	GitHub GitHubOptions
+	// Since, when set, replaces the cached diff base with the last commit
+	// before this time, reindexing everything changed since then.
+	Since time.Time
+	// CodexLimits constrains memory and CPU/IO priority of each Codex
+	// process.
+	CodexLimits ResourceLimits
+	// CodexStdin is how Codex's stdin is fed: StdinKeepAlive, StdinNone, or
+	// StdinClosed; empty uses StdinKeepAlive.
+	CodexStdin string
+	// CodexTimeout bounds each Codex run; zero disables the timeout.
+	CodexTimeout time.Duration
+	// CodexKeepAlive is the newline interval of StdinKeepAlive; zero uses
+	// 30s.
+	CodexKeepAlive time.Duration
+	// CodegenTimeout bounds each repo's codegen hook; zero uses 10m.
+	CodegenTimeout time.Duration
+	// GitRetryDelay is the initial backoff between git retries.
+	GitRetryDelay time.Duration
+	// PromptTokenBudget caps the estimated tokens of the prompt plus
+	// manifest; larger diffs are truncated in the manifest. Zero disables
+	// the budget.
+	PromptTokenBudget int
+	// SummaryKeep is how many previous JSON summaries are kept, renamed
+	// with their write time, when a run replaces the summary; zero keeps none.
+	SummaryKeep int
+	// ArtifactsDir, when set, gets a directory per run holding the plan,
+	// per-repo logs, Codex's final reports, the summary, and the status
+	// file. An empty SummaryJSON or StatusPath is written there.
+	ArtifactsDir string
+	// ArtifactsKeep is how many run directories under ArtifactsDir are kept,
+	// counting this run's; zero keeps all.
+	ArtifactsKeep int
+	// ChangelogMonths is the history window for Changelog in months; zero
+	// uses DefaultChangelogMonths.
+	ChangelogMonths int
+	// MaxDocChars caps the characters of each document written to Chroma;
+	// longer content is split into chunks. Zero leaves it to Codex.
+	MaxDocChars int
+	// DocsPerModule caps the documents written per module path; zero
+	// leaves it to Codex.
+	DocsPerModule int
+	// OutputTail is how many trailing bytes of Codex stdout and stderr are
+	// kept per repo and reported as RepoResult.OutputTail when indexing
+	// fails; zero uses DefaultOutputTail and a negative value disables it.
+	OutputTail int
+	// GitRetries is how many times transient fetch/worktree failures are
+	// retried before falling back to the current working tree.
+	GitRetries int
+	// MaxWorktreeDisk caps the combined estimated size in bytes of live
+	// index worktrees; repos that would exceed it wait for others to finish.
+	// Zero disables the cap.
+	MaxWorktreeDisk int64
+	// Parallel is the number of repositories processed concurrently. It is
+	// raised to GitParallel or CodexParallel when either is larger.
+	Parallel int
+	// GitParallel caps how many repos run the git phase (fetch and worktree
+	// setup) at once; zero means no cap beyond Parallel.
+	GitParallel int
+	// CodexParallel caps how many Codex processes run at once; zero means no
+	// cap beyond Parallel.
+	CodexParallel int
+	// Stagger is the minimum gap between Codex launches across workers;
+	// zero launches them as soon as a worker is ready.
+	Stagger time.Duration
+	// StartupJitter delays each worker's first repo by a random duration
+	// below it; zero disables the jitter.
+	StartupJitter time.Duration
+	// MaxProcs caps how many git, codegen, and Codex child processes run at
+	// once across all workers; zero means no cap. Whatever the cap, new
+	// processes pause with a growing backoff after one runs out of file
+	// descriptors.
+	MaxProcs int
+	// DryRun prints actions without running git network operations or Codex.
+	DryRun bool
+	// Store selects the collection store: StoreChroma (the default),
+	// StoreMock, StoreEmbedded, or StorePgvector. The mock implies DryRun;
+	// every store request is served by an empty in-memory store, and the
+	// writes the run would make are recorded to MockStorePath. The embedded
+	// store keeps collections in a SQLite database under StorePath and
+	// serves it at Chroma.URL for the run, where Codex's Chroma MCP server
+	// reaches it. The pgvector store does the same from the Postgres
+	// database at StoreDSN.
+	Store string
+	// MockStorePath is the JSON file --store mock writes; empty uses
+	// DefaultMockStoreFile.
+	MockStorePath string
+	// StorePath is the directory of the embedded store; empty uses
+	// DefaultEmbeddedStorePath.
+	StorePath string
+	// StoreDSN is the connection string of the pgvector store, as a URL
+	// or key=value pairs; empty uses the PG* environment variables.
+	StoreDSN string
+	// FetchAll fetches every remote instead of only the index branch.
+	FetchAll bool
+	// IndexLinkedWorktrees indexes linked worktrees even when their primary
+	// checkout is also under the root.
+	IndexLinkedWorktrees bool
+	// SkipRepoCaseSensitive matches SkipRepos without case folding.
+	SkipRepoCaseSensitive bool
+	// VerifyOnly resolves each repo's branch tip without fetching and
+	// reports which repos are stale against the commit cache; nothing is
+	// indexed or written besides the summary, and Run returns ErrStaleRepos
+	// when any repo is stale.
+	VerifyOnly bool
+	// OnNewTag only indexes repos whose index branch has a tag newer than
+	// the one last indexed, checking out the tag and stamping documents with
+	// it as the version.
+	OnNewTag bool
+	// OnboardingOnly has Codex write only the onboarding documents, not
+	// the collection store; the commit cache is left unchanged. It requires
+	// OnboardingDir.
+	OnboardingOnly bool
+	// Expertise adds a pass that writes "who has touched what" documents
+	// from each repo's git history per top-level directory. It is off by
+	// default because it stores contributor names.
+	Expertise bool
+	// GitHubIssues adds a pass that stores open issues and recently merged
+	// pull requests from the GitHub API as issue_context documents. Repos
+	// without a remote on the API's host are indexed without them.
+	GitHubIssues bool
+	// CIPipelines adds a pass, to repos with GitHub Actions, GitLab CI, or
+	// Jenkins configuration, that summarizes their build, test, and deploy
+	// pipelines into ci_pipeline documents.
+	CIPipelines bool
+	// DataModel adds a pass, to repos with SQL migrations or schemas,
+	// Prisma, Ent, or sqlc, that describes their tables and relationships
+	// in data_model documents.
+	DataModel bool
+	// Dependencies generates a per-repo inventory of direct dependencies,
+	// versions, and licenses from go.mod, package.json, and requirements
+	// files, which Codex upserts as a "dependencies" document.
+	Dependencies bool
+	// ValidateMetadata checks, after each successful run, the metadata of
+	// the documents it wrote against the document schema and reports the
+	// invalid ones.
+	ValidateMetadata bool
+	// DocumentChanges snapshots each repo's collection before and after
+	// Codex runs and reports how many documents were added, updated, and
+	// deleted.
+	DocumentChanges bool
+	// Changelog adds a pass that summarizes recent merge commits and
+	// release tags into changelog_summary documents.
+	Changelog bool
+	// Sync reconciles discovered repos, cache entries, and store
+	// collections: repos whose collection is missing are reindexed from
+	// scratch and entries for repos no longer under the root are pruned.
+	Sync bool
+	// Backfill counts the documents in each cached repo's collection and
+	// reindexes, from scratch, repos whose collection is empty or missing,
+	// even when the commit cache says they are current.
+	Backfill bool
+	// ReadOnlyWorktree runs Codex through bubblewrap with the checkout and
+	// index worktree mounted read-only and a private writable scratch
+	// directory, so indexing cannot modify source checkouts. It needs bwrap.
+	ReadOnlyWorktree bool
+	// StoreCheck probes the Chroma store before any repo is indexed and
+	// stops the run with a diagnosis when it is down, rejects the token, or
+	// lacks the tenant or database.
+	StoreCheck bool
+	// MCPCheck asks the agent, before any repo is indexed, whether it has a
+	// Chroma MCP server, and stops the run with a diagnosis when it does
+	// not. It applies to IngestMCP only and is skipped in dry runs.
+	MCPCheck bool
+	// pause, when set, is the gate repos wait at instead of one of the
+	// run's own, so RunDaemon can pause its sweeps.
+	pause *pauseGate
+}
+
 type indexer struct {
-	stdout       io.Writer
-	stderr       io.Writer
-	cache        *commitCache
-	skip         []string
-	codexTimeout time.Duration
-	workerCount  int
+	stdout  io.Writer
+	stderr  io.Writer
+	cache   *commitCache
+	config  *Config
+	masker  *secretMasker
+	mirrors *mirrorLocks
+	// repoLocks keeps two indexes of one collection from overlapping.
+	repoLocks *repoLocks
+	events    *eventSink
+	status    *statusTracker
+	slugs     *slugMap
+	sync      *syncState
+	backfill  *backfillState
+	artifacts *runArtifacts
+	pause     *pauseGate
+	// gitSlots and codexSlots bound the git and Codex phases separately
+	// from the worker pool; ingestSlots bounds batches written to the store.
+	gitSlots    slots
+	codexSlots  slots
+	ingestSlots slots
+	stagger     *launchStagger
+	procs       *procGuard
+	diskBudget  *diskBudget
+	// runID namespaces this run's worktrees; see newRunID.
+	runID string
+	opts  Options
 }
 
 func newIndexer(
 	stdout io.Writer,
 	stderr io.Writer,
 	cache *commitCache,
-	skip []string,
-	codexTimeout time.Duration,
-	workerCount int,
+	config *Config,
+	opts Options,
 ) *indexer {
-	return &indexer{
-		stdout:       stdout,
-		stderr:       stderr,
-		cache:        cache,
-		skip:         skip,
-		codexTimeout: codexTimeout,
-		workerCount:  workerCount,
+	if opts.DuplicatePolicy == "" {
+		opts.DuplicatePolicy = DuplicatePolicyNewest
+	}
+	if len(opts.BranchFallbacks) == 0 {
+		opts.BranchFallbacks = defaultBranchFallbacks
+	}
+	if opts.DetachedHeadPolicy == "" {
+		opts.DetachedHeadPolicy = HeadPolicyIndex
+	}
+	if opts.EmptyRepoPolicy == "" {
+		opts.EmptyRepoPolicy = HeadPolicySkip
+	}
+	if opts.PrepFailurePolicy == "" {
+		opts.PrepFailurePolicy = PrepFailureFallback
+	}
+	if opts.SlugPolicy == "" {
+		opts.SlugPolicy = SlugPolicyFix
+	}
+	if opts.ExpertiseSince == "" {
+		opts.ExpertiseSince = DefaultExpertiseSince
+	}
+	if opts.ChangelogMonths == 0 {
+		opts.ChangelogMonths = DefaultChangelogMonths
+	}
+	if opts.OutputTail == 0 {
+		opts.OutputTail = DefaultOutputTail
+	}
+	if opts.AgentBackend == nil {
+		// RunResults has rejected unknown agents.
+		backend, err := agentBackend(opts.Agent)
+		if err != nil {
+			backend = codexBackend{}
+		}
+		opts.AgentBackend = backend
+	}
+	pause := opts.pause
+	if pause == nil {
+		pause = &pauseGate{}
+	}
+	ix := &indexer{
+		stdout:      stdout,
+		stderr:      stderr,
+		cache:       cache,
+		config:      config,
+		masker:      &secretMasker{},
+		mirrors:     &mirrorLocks{},
+		repoLocks:   &repoLocks{},
+		pause:       pause,
+		gitSlots:    newSlots(opts.GitParallel),
+		codexSlots:  newSlots(opts.CodexParallel),
+		ingestSlots: newSlots(opts.IngestParallel),
+		stagger:     newLaunchStagger(opts.Stagger),
+		diskBudget:  newDiskBudget(opts.MaxWorktreeDisk),
+		runID:       newRunID(),
+		opts:        opts,
+	}
+	ix.procs = newProcGuard(opts.MaxProcs, func(delay time.Duration) {
+		ix.errln(colorize(colorYellow, "too many open files; pausing new git/codex processes for %s", delay))
+	})
+	return ix
+}
+
+// tempDir returns the scratch directory for worktrees and subprocesses.
+func (ix *indexer) tempDir() string {
+	if ix.opts.TempDir != "" {
+		return ix.opts.TempDir
+	}
+	return os.TempDir()
+}
+
+// scratchEnv returns TMPDIR for subprocesses when --tmp-dir is set.
+func (ix *indexer) scratchEnv() []string {
+	if ix.opts.TempDir == "" {
+		return nil
 	}
+	return []string{"TMPDIR=" + ix.opts.TempDir}
 }
 
 func (ix *indexer) outln(args ...any) {
-	if _, err := fmt.Fprintln(ix.stdout, args...); err != nil {
+	if _, err := fmt.Fprint(ix.stdout, ix.masker.mask(fmt.Sprintln(args...))); err != nil {
 		fmt.Fprintf(os.Stderr, "stdout write error: %v\n", err)
 	}
 }
 
 func (ix *indexer) errln(args ...any) {
-	if _, err := fmt.Fprintln(ix.stderr, args...); err != nil {
+	if _, err := fmt.Fprint(ix.stderr, ix.masker.mask(fmt.Sprintln(args...))); err != nil {
 		fmt.Fprintf(os.Stderr, "stderr write error: %v\n", err)
 	}
 }
@@ -52,70 +441,387 @@ func (ix *indexer) persistCache() error {
 	if ix.cache == nil {
 		return nil
 	}
-	return ix.cache.Save()
+	return ix.cache.requestSave()
 }
 
 // RepoResult captures per-repo outcome for JSON summary.
 type RepoResult struct {
+	// Err is why the repo failed (*AgentTimeout, *AgentExitError,
+	// *StoreUnavailable, or another error) or was not indexed (*Skipped);
+	// nil when it was indexed. Error and SkipDetail carry its text for the
+	// JSON summary.
+	Err error `json:"-"`
+	// GitErr is the *GitFetchError from preparing the index worktree; the
+	// repo was then indexed from its current working tree.
+	GitErr         error  `json:"-"`
 	CheckoutOK     *bool  `json:"checkout_ok,omitempty"`
 	PullOK         *bool  `json:"pull_ok,omitempty"`
+	CodegenOK      *bool  `json:"codegen_ok,omitempty"`
 	CodexExitCode  *int   `json:"codex_exit_code,omitempty"`
+	Stale          *bool  `json:"stale,omitempty"`
 	Path           string `json:"path"`
 	CollectionSlug string `json:"collection_slug"`
+	RemoteName     string `json:"remote_name,omitempty"`
+	RemoteURL      string `json:"remote_url,omitempty"`
 	DefaultBranch  string `json:"default_branch,omitempty"`
+	GitFailure     string `json:"git_failure,omitempty"`
+	HealthError    string `json:"health_error,omitempty"`
+	HeadState      string `json:"head_state,omitempty"`
 	Error          string `json:"error,omitempty"`
+	ErrorKind      string `json:"error_kind,omitempty"`
+	// SkipReason classifies a skip as one of the SkipReason constants so
+	// skips can be aggregated; SkipDetail describes it.
 	SkipReason     string `json:"skip_reason,omitempty"`
+	SkipDetail     string `json:"skip_detail,omitempty"`
 	IndexedCommit  string `json:"indexed_commit,omitempty"`
 	CachedCommit   string `json:"cached_commit,omitempty"`
 	DiffBaseCommit string `json:"diff_base_commit,omitempty"`
-	DiffFileCount  int    `json:"diff_file_count,omitempty"`
-	CodexRan       bool   `json:"codex_ran"`
-	DryRun         bool   `json:"dry_run"`
-}
-
-// Run executes the indexing workflow for the provided directory.
-func Run(
-	rootDir string,
-	dryRun bool,
-	summaryJSON, cachePath string,
-	skipRepos []string,
-	codexTimeout time.Duration,
-	workerCount int,
-) error {
-	cache, err := loadCommitCache(cachePath)
+	MovedFrom      string `json:"moved_from,omitempty"`
+	OnboardingPath string `json:"onboarding_path,omitempty"`
+	Version        string `json:"version,omitempty"`
+	PromptHash     string `json:"prompt_hash,omitempty"`
+	// Backfilled is set when the repo was reindexed because its collection
+	// had no documents, under Options.Backfill.
+	Backfilled bool `json:"backfilled,omitempty"`
+	// Tags are the repo's config tags.
+	Tags []string `json:"tags,omitempty"`
+	// OutputTail is the end of Codex's stdout and stderr when it failed,
+	// bounded by Options.OutputTail.
+	OutputTail    string `json:"output_tail,omitempty"`
+	DiffFileCount int    `json:"diff_file_count,omitempty"`
+	// InvalidDocs counts documents whose metadata failed validation, under
+	// Options.ValidateMetadata.
+	InvalidDocs int `json:"invalid_documents,omitempty"`
+	// IngestedDocs counts the documents the indexer stored itself, under
+	// IngestDirect and IngestLocal.
+	IngestedDocs int `json:"ingested_documents,omitempty"`
+	// OutputWarnings are problems found in the agent's output although it
+	// exited 0; an error among them fails the repo.
+	OutputWarnings []OutputWarning `json:"output_warnings,omitempty"`
+	// Replicas are the outcomes of copying the collection to each replica
+	// store in the config file.
+	Replicas []ReplicaResult `json:"replicas,omitempty"`
+	// DocumentChanges counts the documents the run added, updated, and
+	// deleted, under Options.DocumentChanges.
+	DocumentChanges *DocumentChanges `json:"document_changes,omitempty"`
+	// FileStats summarizes the tracked files by type and directory in dry
+	// runs.
+	FileStats *FileStats `json:"file_stats,omitempty"`
+	// LogPath is the repo's log under Options.ArtifactsDir.
+	LogPath string `json:"log_path,omitempty"`
+	// Git details how the index worktree was prepared, or why the repo
+	// fell back to its current working tree.
+	Git *GitPrep `json:"git,omitempty"`
+	// Passes are the outcomes of a multi-pass pipeline's passes, in order;
+	// passes after a failed one are not run.
+	Passes []PassResult `json:"passes,omitempty"`
+	// AgentDurationMS is the time spent running the agent, over every pass;
+	// with PromptTokens it is the cost of indexing the repo.
+	AgentDurationMS int64 `json:"agent_duration_ms,omitempty"`
+	// PromptTokens estimates the prompt plus manifest Codex was given.
+	PromptTokens int   `json:"prompt_tokens,omitempty"`
+	DurationMS   int64 `json:"duration_ms"`
+	CodexRan     bool  `json:"codex_ran"`
+	DryRun       bool  `json:"dry_run"`
+	// DiffTruncated reports that the manifest lists only part of the diff
+	// to stay within the prompt budget.
+	DiffTruncated bool `json:"diff_truncated,omitempty"`
+	// OptedOut reports that the repo carries a .noindex or .ai-indexer
+	// opt-out marker; SkipDetail names it.
+	OptedOut bool `json:"opted_out,omitempty"`
+}
+
+// Run executes the indexing workflow for opts.RootDir.
+func Run(opts Options) error {
+	_, err := RunResults(opts)
+	return err
+}
+
+// RunResults is Run, also returning each repo's result in discovery order.
+// Results are nil when the run fails before any repo is processed.
+func RunResults(opts Options) ([]RepoResult, error) {
+	config, err := LoadConfig(opts.ConfigPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if workerCount <= 0 {
-		workerCount = 1
+	cache, err := loadCommitCache(opts.CachePath)
+	if err != nil {
+		return nil, err
+	}
+	cache.warnRecovered(os.Stderr)
+
+	slugs, err := loadSlugMap(opts.SlugMapPath)
+	if err != nil {
+		return nil, err
+	}
+	slugs.warnRecovered(os.Stderr)
+
+	opts.Parallel = max(opts.Parallel, opts.GitParallel, opts.CodexParallel, 1)
+	switch opts.DuplicatePolicy {
+	case "", DuplicatePolicyNewest, DuplicatePolicyFirst, DuplicatePolicyOff:
+	default:
+		return nil, fmt.Errorf("unknown duplicate policy %q (want newest, first, or off)", opts.DuplicatePolicy)
+	}
+	if opts.OnboardingOnly && opts.OnboardingDir == "" {
+		return nil, errors.New("onboarding-only requires an onboarding dir")
+	}
+	if opts.OnboardingDir != "" {
+		// Codex runs in each repo, so a relative path would land there.
+		if opts.OnboardingDir, err = filepath.Abs(opts.OnboardingDir); err != nil {
+			return nil, fmt.Errorf("resolve onboarding dir: %w", err)
+		}
+	}
+	if opts.ChangelogMonths < 0 {
+		return nil, fmt.Errorf("changelog months must not be negative, got %d", opts.ChangelogMonths)
+	}
+	if opts.MaxDocChars < 0 {
+		return nil, fmt.Errorf("max doc chars must not be negative, got %d", opts.MaxDocChars)
+	}
+	switch opts.CodexStdin {
+	case "", StdinKeepAlive, StdinNone, StdinClosed:
+	default:
+		return nil, fmt.Errorf("unknown stdin mode %q (want none, keepalive, or closed)", opts.CodexStdin)
+	}
+	if opts.CodexKeepAlive < 0 {
+		return nil, fmt.Errorf("stdin keep-alive interval must not be negative, got %s", opts.CodexKeepAlive)
+	}
+	for _, tag := range opts.Tags {
+		if err := validateTag(tag); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Stagger < 0 || opts.StartupJitter < 0 {
+		return nil, errors.New("stagger and startup jitter must not be negative")
+	}
+	if opts.ArtifactsKeep < 0 {
+		return nil, errors.New("artifacts keep must not be negative")
+	}
+	if opts.MaxProcs < 0 {
+		return nil, fmt.Errorf("max procs must not be negative, got %d", opts.MaxProcs)
+	}
+	if opts.DocsPerModule < 0 {
+		return nil, fmt.Errorf("docs per module must not be negative, got %d", opts.DocsPerModule)
+	}
+	switch opts.Profile {
+	case ProfileDefault, ProfileSecurity, ProfileInfra:
+	default:
+		return nil, fmt.Errorf("unknown profile %q (want security or infra)", opts.Profile)
+	}
+	switch opts.HealthCheck {
+	case "", HealthCheckOff, HealthCheckQuick, HealthCheckFull:
+	default:
+		return nil, fmt.Errorf("unknown health check level %q (want off, quick, or full)", opts.HealthCheck)
+	}
+	if opts.TempDir != "" {
+		if err := os.MkdirAll(opts.TempDir, 0o750); err != nil {
+			return nil, fmt.Errorf("create temp dir: %w", err)
+		}
+	}
+	if err := opts.CodexLimits.validate(); err != nil {
+		return nil, err
+	}
+	if opts.ReadOnlyWorktree {
+		if err := checkSandbox(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := resolveSummaryColumns(opts.SummaryColumns); err != nil {
+		return nil, err
+	}
+	switch opts.SlugPolicy {
+	case "", SlugPolicyFix, SlugPolicyFail:
+	default:
+		return nil, fmt.Errorf("unknown slug policy %q (want fix or fail)", opts.SlugPolicy)
+	}
+	switch opts.SummaryOnly {
+	case "", SummaryOnlyErrors, SummaryOnlyWarnings:
+	default:
+		return nil, fmt.Errorf("unknown summary filter %q (want errors or warnings)", opts.SummaryOnly)
+	}
+	switch opts.SummarySort {
+	case "", SummarySortDuration, SummarySortStatus, SummarySortName:
+	default:
+		return nil, fmt.Errorf("unknown summary sort %q (want duration, status, or name)", opts.SummarySort)
+	}
+	if opts.SinceCommit != "" && !opts.Since.IsZero() {
+		return nil, errors.New("since and since-commit are mutually exclusive")
+	}
+	for name, policy := range map[string]string{
+		"detached head": opts.DetachedHeadPolicy,
+		"empty repo":    opts.EmptyRepoPolicy,
+	} {
+		switch policy {
+		case "", HeadPolicyIndex, HeadPolicySkip:
+		default:
+			return nil, fmt.Errorf("unknown %s policy %q (want index or skip)", name, policy)
+		}
+	}
+	if opts.AgentBackend == nil {
+		if _, err := agentBackend(opts.Agent); err != nil {
+			return nil, err
+		}
+	}
+	switch opts.Ingest {
+	case "", IngestMCP, IngestDirect:
+	case IngestLocal:
+		if opts.OnboardingOnly || opts.OnboardingDir != "" {
+			return nil, errors.New("local ingestion runs no agent, so it cannot write onboarding documents")
+		}
+	default:
+		return nil, fmt.Errorf("unknown ingestion mode %q (want mcp, direct, or local)", opts.Ingest)
+	}
+	if err := opts.Embeddings.validate(opts.Ingest); err != nil {
+		return nil, err
+	}
+	if opts.LocalFiles && opts.Ingest != IngestLocal {
+		return nil, errors.New("local files need ingestion mode local")
+	}
+	if opts.IngestBatchSize < 0 || opts.IngestParallel < 0 || opts.IngestRetries < 0 || opts.IngestRetryDelay < 0 {
+		return nil, errors.New("ingest batch size, parallelism, retries, and retry delay must not be negative")
+	}
+	switch opts.PrepFailurePolicy {
+	case "", PrepFailureFallback, PrepFailureSkip, PrepFailureFail:
+	default:
+		return nil, fmt.Errorf("unknown prep failure policy %q (want fallback, skip, or fail)", opts.PrepFailurePolicy)
+	}
+
+	var mock *mockStore
+	switch opts.Store {
+	case "", StoreChroma:
+	case StoreMock:
+		mock = newMockStore(opts.MockStorePath)
+		opts.Chroma.URL = mockStoreURL
+		opts.Chroma.mock = mock
+		opts.DryRun = true
+	case StoreEmbedded, StorePgvector:
+		stop, err := serveEmbeddedStore(&opts)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if err := stop(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error closing %s store: %v\n", opts.Store, err)
+			}
+		}()
+	default:
+		return nil, fmt.Errorf("unknown store %q (want chroma, mock, embedded, or pgvector)", opts.Store)
+	}
+
+	if err := checkReplicas(opts.Chroma, config.replicaTargets()); err != nil {
+		return nil, err
+	}
+
+	if opts.MaxRepos < 0 {
+		return nil, fmt.Errorf("max repos must not be negative, got %d", opts.MaxRepos)
+	}
+	if opts.VerifyOnly && (opts.Sync || opts.OnNewTag || opts.Backfill) {
+		return nil, errors.New("verify-only cannot be combined with sync, on-new-tag, or backfill")
+	}
+
+	// Verify-only runs write nothing shared, so they can audit while a real
+	// run holds the locks.
+	if !opts.VerifyOnly {
+		releaseLocks, err := acquireRunLocks(opts.RootDir, opts.CachePath)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if err := releaseLocks(); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}()
+	}
+
+	events, err := openEventSink(opts.EventsPath)
+	if err != nil {
+		return nil, err
 	}
 
 	outputMu := &sync.Mutex{}
 	stdout := io.Writer(os.Stdout)
 	stderr := io.Writer(os.Stderr)
-	if workerCount > 1 {
-		stdout = &lockedWriter{mu: outputMu, w: os.Stdout}
+	if opts.EventsPath == eventsStdout {
+		stdout = os.Stderr
+	}
+	if opts.Parallel > 1 {
+		stdout = &lockedWriter{mu: outputMu, w: stdout}
 		stderr = &lockedWriter{mu: outputMu, w: os.Stderr}
 	}
 
-	ix := newIndexer(stdout, stderr, cache, skipRepos, codexTimeout, workerCount)
-	err = ix.run(rootDir, dryRun, summaryJSON)
-	saveErr := cache.Save()
+	ix := newIndexer(stdout, stderr, cache, config, opts)
+	ix.events = events
+	ix.slugs = slugs
+	if opts.ArtifactsDir != "" {
+		ix.artifacts, err = newRunArtifacts(opts.ArtifactsDir, ix.runID, opts.ArtifactsKeep)
+		if err != nil {
+			return nil, errors.Join(err, events.Close())
+		}
+		if opts.SummaryJSON == "" {
+			opts.SummaryJSON = ix.artifacts.path(artifactSummary)
+		}
+		if ix.opts.StatusPath == "" {
+			ix.opts.StatusPath = ix.artifacts.path(artifactStatus)
+		}
+	}
+	if opts.StoreCheck {
+		client := newChromaClient(opts.Chroma)
+		health, err := checkStore(context.Background(), client)
+		if err != nil {
+			return nil, errors.Join(err, events.Close())
+		}
+		ix.outln(colorize(colorMuted, "%s", health.storeSummary(client.opts.URL)))
+	}
+	if opts.MCPCheck && (opts.Ingest == "" || opts.Ingest == IngestMCP) && !opts.DryRun {
+		summary, err := ix.checkAgentMCP(context.Background(), opts.RootDir)
+		if err != nil {
+			return nil, errors.Join(err, events.Close())
+		}
+		ix.outln(colorize(colorMuted, "%s", summary))
+	}
+	if opts.Sync {
+		ix.sync, err = newSyncState(context.Background(), opts.Chroma)
+		if err != nil {
+			return nil, errors.Join(err, events.Close())
+		}
+	}
+	if opts.Backfill {
+		ix.backfill = newBackfillState(opts.Chroma)
+	}
+	stopFlusher := cache.startFlusher(func(err error) {
+		ix.errln("Error saving commit cache:", err)
+	})
+	results, err := ix.run(opts.RootDir, opts.DryRun, opts.SummaryJSON)
+	stopFlusher()
+	if closeErr := events.Close(); closeErr != nil {
+		ix.errln("Error closing events:", closeErr)
+	}
+	var saveErr error
+	if !opts.VerifyOnly {
+		saveErr = errors.Join(cache.Save(), slugs.Save())
+	}
+	if mock != nil {
+		if err := mock.save(); err != nil {
+			saveErr = errors.Join(saveErr, err)
+		} else {
+			ix.outln("Mock store operations written to " + mock.path)
+		}
+	}
 	if err != nil {
 		if saveErr != nil {
-			return fmt.Errorf("%w (cache save failed: %w)", err, saveErr)
+			return results, fmt.Errorf("%w (cache save failed: %w)", err, saveErr)
 		}
-		return err
+		return results, err
 	}
 	if saveErr != nil {
-		return saveErr
+		return results, saveErr
 	}
-	return nil
+	return results, nil
 }
 
-func (ix *indexer) run(rootDir string, dryRun bool, summaryJSON string) error {
-	ctx := context.Background()
+func (ix *indexer) run(rootDir string, dryRun bool, summaryJSON string) ([]RepoResult, error) {
+	ctx := withProcGuard(context.Background(), ix.procs)
+	runStarted := time.Now()
 
 	ix.outln(colorize(colorCyan, "Codex Repo Indexer"))
 	ix.outln(colorize(colorMuted, "Root Directory: %s", rootDir))
@@ -125,14 +831,9 @@ func (ix *indexer) run(rootDir string, dryRun bool, summaryJSON string) error {
 	repos, err := findGitRepos(rootDir)
 	if err != nil {
 		ix.errln("Error scanning for git repos:", err)
-		return fmt.Errorf("scan git repos: %w", err)
-	}
-	if len(repos) == 0 {
-		ix.outln("No git repositories found.")
-		return nil
+		return nil, fmt.Errorf("scan git repos: %w", err)
 	}
-
-	workerCount := ix.workerCount
+	workerCount := ix.opts.Parallel
 	if workerCount <= 0 {
 		workerCount = 1
 	}
@@ -140,29 +841,89 @@ func (ix *indexer) run(rootDir string, dryRun bool, summaryJSON string) error {
 		workerCount = len(repos)
 	}
 
+	expected, err := loadExpectedDurations(ctx, ix.opts.HistoryPath)
+	if err != nil {
+		ix.errln("Error reading run history for ETAs:", err)
+	}
+	ix.status = newStatusTracker(ix.opts.StatusPath, rootDir, repos, workerCount, expected)
+	ix.emit(Event{
+		Type:      EventRunStarted,
+		Path:      rootDir,
+		RepoCount: len(repos),
+	})
+	if len(repos) == 0 {
+		ix.outln("No git repositories found.")
+		ix.emit(Event{
+			Type: EventRunFinished,
+			Path: rootDir,
+		})
+		return nil, nil
+	}
+	ix.markDuplicates(ctx, rootDir, repos)
+
 	ix.outln(fmt.Sprintf("Found %d git repos under %s", len(repos), rootDir))
 	ix.outln(colorize(colorMuted, "Parallel Workers: %d", workerCount))
+	if ix.opts.GitParallel > 0 || ix.opts.CodexParallel > 0 {
+		ix.outln(colorize(colorMuted, "Phase Limits: git %s, codex %s",
+			formatSlotLimit(ix.opts.GitParallel), formatSlotLimit(ix.opts.CodexParallel)))
+	}
+	if ix.opts.MaxProcs > 0 {
+		ix.outln(colorize(colorMuted, "Child Process Limit: %d", ix.opts.MaxProcs))
+	}
+	if ix.opts.Stagger > 0 || ix.opts.StartupJitter > 0 {
+		ix.outln(colorize(colorMuted, "Codex Launch Stagger: %s, startup jitter up to %s",
+			ix.opts.Stagger, ix.opts.StartupJitter))
+	}
+	repos = ix.limitRepos(ctx, rootDir, repos)
+	if ix.artifacts != nil {
+		ix.outln(colorize(colorMuted, "Run Artifacts: %s", ix.artifacts.dir))
+		if err := ix.writePlan(rootDir, dryRun, repos, workerCount); err != nil {
+			ix.errln("Error writing run plan:", err)
+		}
+	}
 	ix.outln()
 
+	stopSignals := ix.watchPauseSignals()
+	defer stopSignals()
+	// Worktrees are removed as each repo finishes; drop the run's now-empty
+	// namespace directory, leaving it if something is still inside.
+	defer func() { _ = os.Remove(ix.worktreeRunDir()) }()
+
 	results := make([]RepoResult, len(repos))
+	indexRepo := func(worker int, repo discoveredRepo) RepoResult {
+		ix.pause.wait()
+		started := time.Now()
+		log := &repoLogger{ix: ix, worker: worker}
+		logPath, closeLog := ix.openRepoLog(log, rootDir, repo.path)
+		repoCtx := withRepoLogger(ctx, log)
+		result := ix.processRepo(repoCtx, repo, rootDir, dryRun)
+		closeLog()
+		result.LogPath = logPath
+		result.DurationMS = time.Since(started).Milliseconds()
+		ix.emit(repoFinishedEvent(&result))
+		ix.reportProgress()
+		return result
+	}
 
 	if workerCount == 1 {
+		startupJitter(ctx, ix.opts.StartupJitter)
 		for idx, repo := range repos {
-			results[idx] = ix.processRepo(ctx, repo, rootDir, dryRun)
+			results[idx] = indexRepo(0, repo)
 		}
 	} else {
 		type repoJob struct {
-			path  string
+			repo  discoveredRepo
 			index int
 		}
 
 		jobs := make(chan repoJob)
 		var wg sync.WaitGroup
 
-		for range workerCount {
+		for worker := range workerCount {
 			wg.Go(func() {
+				startupJitter(ctx, ix.opts.StartupJitter)
 				for job := range jobs {
-					results[job.index] = ix.processRepo(ctx, job.path, rootDir, dryRun)
+					results[job.index] = indexRepo(worker+1, job.repo)
 				}
 			})
 		}
@@ -170,41 +931,103 @@ func (ix *indexer) run(rootDir string, dryRun bool, summaryJSON string) error {
 		for idx, repo := range repos {
 			jobs <- repoJob{
 				index: idx,
-				path:  repo,
+				repo:  repo,
 			}
 		}
 		close(jobs)
 		wg.Wait()
 	}
 
+	for i := range results {
+		results[i].Error = ix.masker.mask(results[i].Error)
+		results[i].OutputTail = ix.masker.mask(results[i].OutputTail)
+	}
+
 	ix.outln(colorize(colorCyan, "==> Summary"))
 	ix.outln("")
 
 	ix.printSummaryTable(results)
 
-	if err := writeSummaryJSON(summaryJSON, rootDir, dryRun, results); err != nil {
-		ix.errln("Error writing JSON summary:", err)
-		return fmt.Errorf("write summary json: %w", err)
+	var syncReport *SyncReport
+	if ix.sync != nil {
+		syncReport = ix.reconcile(ctx, results, dryRun)
+		ix.printSyncReport(syncReport)
 	}
 
-	ix.outln("JSON summary written to " + summaryJSON)
-	return nil
+	summary := summaryPayload(rootDir, dryRun, results, syncReport)
+	if summaryJSON != "" {
+		if err := writeSummaryJSON(summaryJSON, ix.opts.SummaryKeep, summary); err != nil {
+			ix.errln("Error writing JSON summary:", err)
+			return results, fmt.Errorf("write summary json: %w", err)
+		}
+		ix.outln("JSON summary written to " + summaryJSON)
+	}
+	if ix.artifacts != nil && summaryJSON != ix.artifacts.path(artifactSummary) {
+		if err := writeSummaryJSON(ix.artifacts.path(artifactSummary), 0, summary); err != nil {
+			ix.errln("Error writing JSON summary to the run artifacts:", err)
+		}
+	}
+	if ix.opts.SummaryAppend != "" {
+		if err := appendSummaryNDJSON(ix.opts.SummaryAppend, summary); err != nil {
+			ix.errln("Error appending JSON summary:", err)
+			return results, fmt.Errorf("append summary json: %w", err)
+		}
+		ix.outln("JSON summary appended to " + ix.opts.SummaryAppend)
+	}
+
+	if ix.opts.HistoryPath != "" && !ix.opts.VerifyOnly {
+		if err := recordHistory(ctx, ix.opts.HistoryPath, runStarted, rootDir, dryRun, results); err != nil {
+			ix.errln("Error recording run history:", err)
+		}
+	}
+
+	ix.emit(Event{
+		Type:       EventRunFinished,
+		Path:       rootDir,
+		RepoCount:  len(results),
+		DurationMS: time.Since(runStarted).Milliseconds(),
+	})
+
+	if ix.opts.VerifyOnly {
+		stale := 0
+		for i := range results {
+			if results[i].Stale != nil && *results[i].Stale {
+				stale++
+			}
+		}
+		ix.outln(fmt.Sprintf("%d of %d repos are stale", stale, len(results)))
+		if stale > 0 {
+			return results, fmt.Errorf("%w: %d of %d", ErrStaleRepos, stale, len(results))
+		}
+	}
+	return results, nil
 }
 
-func (ix *indexer) repoHeader(repoDir, slug string) {
-	ix.outln("")
-	ix.outln(colorize(colorMagenta, "==> %s", repoDir))
-	ix.outln(colorize(colorMuted, "    collection: %s", slug))
+// slots is a counting semaphore bounding one phase of repo processing. A
+// nil slots never blocks.
+type slots chan struct{}
+
+func newSlots(n int) slots {
+	if n <= 0 {
+		return nil
+	}
+	return make(slots, n)
 }
 
-func (ix *indexer) repoInfof(format string, args ...any) {
-	msg := fmt.Sprintf(format, args...)
-	ix.outln(colorize(colorBlue, "    - %s", msg))
+// acquire blocks until a slot is free and returns its release func.
+func (s slots) acquire() func() {
+	if s == nil {
+		return func() {}
+	}
+	s <- struct{}{}
+	return func() { <-s }
 }
 
-func (ix *indexer) repoWarnf(format string, args ...any) {
-	msg := fmt.Sprintf(format, args...)
-	ix.outln(colorize(colorYellow, "    ! %s", msg))
+func formatSlotLimit(n int) string {
+	if n <= 0 {
+		return "unlimited"
+	}
+	return strconv.Itoa(n)
 }
 
 type lockedWriter struct {
@@ -8,8 +8,10 @@ import (
 	"path/filepath"
 	"slices"
 	"strings"
+	"sync"
 	"testing"
 	"testing/quick"
+	"time"
 	"unicode"
 )
 
@@ -39,7 +41,13 @@ func TestRunParallelIndexing(t *testing.T) {
 		cachePath   = filepath.Join(rootDir, "cache.json")
 	)
 
-	if err := Run(rootDir, false, summaryPath, cachePath, nil, 0, 2); err != nil {
+	opts := Options{
+		RootDir:     rootDir,
+		SummaryJSON: summaryPath,
+		CachePath:   cachePath,
+		Parallel:    2,
+	}
+	if err := Run(opts); err != nil {
 		t.Fatalf("run indexer: %v", err)
 	}
 
@@ -141,3 +149,40 @@ func runGit(repoDir string, args ...string) error {
 
 	return fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
 }
+
+func TestSlotsBoundConcurrency(t *testing.T) {
+	const limit = 2
+	s := newSlots(limit)
+
+	var (
+		mu      sync.Mutex
+		active  int
+		maxSeen int
+		wg      sync.WaitGroup
+	)
+	for range 8 {
+		wg.Go(func() {
+			release := s.acquire()
+			defer release()
+
+			mu.Lock()
+			active++
+			maxSeen = max(maxSeen, active)
+			mu.Unlock()
+
+			time.Sleep(5 * time.Millisecond)
+
+			mu.Lock()
+			active--
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+
+	if maxSeen > limit {
+		t.Fatalf("expected at most %d concurrent holders, saw %d", limit, maxSeen)
+	}
+	if release := newSlots(0).acquire(); release == nil {
+		t.Fatalf("expected unlimited slots to return a release func")
+	}
+}
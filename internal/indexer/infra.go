@@ -0,0 +1,118 @@
+package indexer
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	// manifestMaxEntries caps each list in the manifest's "infra" and
+	// "schema" fields.
+	manifestMaxEntries = 50
+	// infraMaxYAMLScans caps the YAML files read to find Kubernetes
+	// manifests.
+	infraMaxYAMLScans = 2000
+	// infraYAMLScanBytes is how much of each YAML file is read.
+	infraYAMLScanBytes = 4096
+)
+
+// manifestInfra lists the infrastructure-as-code the infra profile
+// summarizes. Terraform, Helm, and Kustomize entries are directories;
+// Kubernetes entries are manifest files outside Helm charts.
+type manifestInfra struct {
+	Terraform  []string `json:"terraform,omitempty"`
+	Helm       []string `json:"helm,omitempty"`
+	Kustomize  []string `json:"kustomize,omitempty"`
+	Kubernetes []string `json:"kubernetes,omitempty"`
+}
+
+func (mi *manifestInfra) empty() bool {
+	return len(mi.Terraform) == 0 && len(mi.Helm) == 0 && len(mi.Kustomize) == 0 && len(mi.Kubernetes) == 0
+}
+
+// detectInfra finds the repo's tracked Terraform modules, Helm charts,
+// Kustomize overlays, and Kubernetes manifests. It returns nil when there
+// are none or git fails.
+func detectInfra(ctx context.Context, repoDir string) *manifestInfra {
+	names, err := trackedFiles(ctx, repoDir)
+	if err != nil {
+		return nil
+	}
+
+	mi := &manifestInfra{}
+	var charts []string
+	for _, name := range names {
+		dir, base := path.Dir(name), path.Base(name)
+		switch {
+		case strings.HasSuffix(base, ".tf") || strings.HasSuffix(base, ".tf.json"):
+			mi.Terraform = appendEntry(mi.Terraform, dir)
+		case base == "Chart.yaml":
+			mi.Helm = appendEntry(mi.Helm, dir)
+			charts = append(charts, dir+"/")
+		case base == "kustomization.yaml" || base == "kustomization.yml" || base == "Kustomization":
+			mi.Kustomize = appendEntry(mi.Kustomize, dir)
+		}
+	}
+
+	scanned := 0
+	for _, name := range names {
+		if ext := path.Ext(name); ext != ".yaml" && ext != ".yml" {
+			continue
+		}
+		if ciSystem(name) != "" || slices.ContainsFunc(charts, func(c string) bool {
+			return c == "./" || strings.HasPrefix(name, c)
+		}) {
+			continue
+		}
+		if scanned == infraMaxYAMLScans || len(mi.Kubernetes) == manifestMaxEntries {
+			break
+		}
+		scanned++
+		if isKubernetesManifest(filepath.Join(repoDir, filepath.FromSlash(name))) {
+			mi.Kubernetes = append(mi.Kubernetes, name)
+		}
+	}
+
+	if mi.empty() {
+		return nil
+	}
+	return mi
+}
+
+// appendEntry adds entry to entries unless it is already listed or the
+// list is full.
+func appendEntry(entries []string, entry string) []string {
+	if len(entries) == manifestMaxEntries || slices.Contains(entries, entry) {
+		return entries
+	}
+	return append(entries, entry)
+}
+
+// isKubernetesManifest reports whether the start of the YAML file at path
+// declares both a top-level apiVersion and kind.
+func isKubernetesManifest(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	var apiVersion, kind bool
+	scanner := bufio.NewScanner(bufio.NewReaderSize(f, infraYAMLScanBytes))
+	read := 0
+	for scanner.Scan() && read < infraYAMLScanBytes {
+		line := scanner.Text()
+		read += len(line) + 1
+		apiVersion = apiVersion || strings.HasPrefix(line, "apiVersion:")
+		kind = kind || strings.HasPrefix(line, "kind:")
+		if apiVersion && kind {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package indexer
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestDetectInfra(t *testing.T) {
+	repoDir := t.TempDir()
+	initGitRepo(t, repoDir)
+	if got := detectInfra(t.Context(), repoDir); got != nil {
+		t.Fatalf("expected no infrastructure, got %+v", got)
+	}
+
+	const deployment = "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: api\n"
+	files := map[string]string{
+		"terraform/main.tf":                       "resource \"aws_s3_bucket\" \"b\" {}\n",
+		"terraform/variables.tf":                  "variable \"env\" {}\n",
+		"terraform/modules/vpc/main.tf.json":      "{}\n",
+		"charts/api/Chart.yaml":                   "apiVersion: v2\nkind: ignored\nname: api\n",
+		"charts/api/templates/deploy.yaml":        deployment,
+		"deploy/overlays/prod/kustomization.yaml": "resources:\n  - ../../base\n",
+		"deploy/base/deployment.yaml":             deployment,
+		".github/workflows/ci.yml":                "on: push\n",
+		"config/settings.yaml":                    "kind: settings\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(repoDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	if err := runGit(repoDir, "add", "-A"); err != nil {
+		t.Fatalf("git add: %v", err)
+	}
+
+	got := detectInfra(t.Context(), repoDir)
+	if got == nil {
+		t.Fatalf("expected infrastructure")
+	}
+	want := manifestInfra{
+		Terraform:  []string{"terraform", "terraform/modules/vpc"},
+		Helm:       []string{"charts/api"},
+		Kustomize:  []string{"deploy/overlays/prod"},
+		Kubernetes: []string{"deploy/base/deployment.yaml"},
+	}
+	if !slices.Equal(got.Terraform, want.Terraform) || !slices.Equal(got.Helm, want.Helm) ||
+		!slices.Equal(got.Kustomize, want.Kustomize) || !slices.Equal(got.Kubernetes, want.Kubernetes) {
+		t.Fatalf("expected %+v, got %+v", want, *got)
+	}
+}
@@ -0,0 +1,414 @@
+package indexer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Ingestion modes selectable with Options.Ingest.
+const (
+	// IngestMCP has the agent write documents through its Chroma MCP
+	// server.
+	IngestMCP = "mcp"
+	// IngestDirect has the agent write documents to a file that the indexer
+	// upserts over the Chroma HTTP API.
+	IngestDirect = "direct"
+	// IngestLocal runs no agent; the indexer generates summaries from the
+	// repo's files and upserts them itself.
+	IngestLocal = "local"
+)
+
+// directOutputPrompt is appended to every pass prompt under IngestDirect.
+const directOutputPrompt = `
+Direct ingestion:
+This run does not write to Chroma, and the "output" manifest field is set.
+Ignore the instructions above about calling Chroma MCP tools and do not call
+any, even when they are available. Instead, append every document you would
+upsert to the JSON Lines file at "output.path": one JSON object per line
+with "id", "document", and "metadata", following all of the collection,
+metadata, and limits rules above. The indexer validates the file and
+upserts it into the collection once you finish. To revise a document
+written earlier in this run, append it again with the same id; the last
+line wins. To remove a stored document (for example the summary of a
+deleted file), append {"id": "<id>", "delete": true}. When "dependencies"
+is set, the indexer stores the inventory itself; do not copy it.
+`
+
+// ingestMaxLine bounds one line of the agent's output file.
+const ingestMaxLine = 16 << 20
+
+// manifestOutput points the agent at the file it writes documents to under
+// IngestDirect.
+type manifestOutput struct {
+	Path string `json:"path"`
+}
+
+// ingestRecord is one line of the agent's output file, or a document the
+// indexer generated: a document to upsert or, with Delete, an id to remove.
+type ingestRecord struct {
+	Metadata map[string]any `json:"metadata,omitempty"`
+	ID       string         `json:"id"`
+	Document string         `json:"document,omitempty"`
+	Delete   bool           `json:"delete,omitempty"`
+}
+
+// embedder computes the embeddings the indexer sends with the documents it
+// upserts itself; Chroma's HTTP API takes them from the client.
+type embedder interface {
+	embed(ctx context.Context, texts []string) ([][]float64, error)
+	// name identifies the embedder and its model in document metadata.
+	name() string
+}
+
+// hashEmbeddingDims is the size of hashEmbedder vectors.
+const hashEmbeddingDims = 384
+
+// hashEmbedder embeds text by feature hashing its lowercased words into a
+// fixed-size, L2-normalized vector. It needs no model, so documents
+// written directly can be compared lexically; it does not capture meaning
+// the way the embedding function of Chroma's MCP server does.
+type hashEmbedder struct{}
+
+func (hashEmbedder) name() string {
+	return EmbedderHash
+}
+
+func (hashEmbedder) embed(_ context.Context, texts []string) ([][]float64, error) {
+	out := make([][]float64, len(texts))
+	for i, text := range texts {
+		out[i] = hashEmbedding(text)
+	}
+	return out, nil
+}
+
+func hashEmbedding(text string) []float64 {
+	v := make([]float64, hashEmbeddingDims)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(word))
+		sum := h.Sum64()
+		sign := 1.0
+		if sum>>63 == 1 {
+			sign = -1
+		}
+		v[sum%hashEmbeddingDims] += sign
+	}
+	var norm float64
+	for _, x := range v {
+		norm += x * x
+	}
+	if norm > 0 {
+		norm = math.Sqrt(norm)
+		for i := range v {
+			v[i] /= norm
+		}
+	}
+	return v
+}
+
+// embedder returns the embedder for documents the indexer upserts. Dry
+// runs never call an embeddings API.
+func (ix *indexer) embedder() embedder {
+	if ix.opts.DryRun {
+		return hashEmbedder{}
+	}
+	switch ix.opts.Embeddings.Provider {
+	case EmbedderOpenAI:
+		return newOpenAIEmbedder(ix.opts.Embeddings)
+	case EmbedderOllama:
+		return newOllamaEmbedder(ix.opts.Embeddings)
+	default:
+		return hashEmbedder{}
+	}
+}
+
+// createOutputFile creates the file the agent writes documents to under
+// IngestDirect and points the manifest at it. The inventory the indexer
+// stores itself is taken out of the manifest. The returned func removes
+// the file.
+func (ix *indexer) createOutputFile(m *indexManifest) (func() error, error) {
+	f, err := os.CreateTemp(ix.tempDir(), "ai-indexer-output-*.jsonl")
+	if err != nil {
+		return nil, fmt.Errorf("create agent output: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, errors.Join(fmt.Errorf("create agent output: %w", err), os.Remove(f.Name()))
+	}
+	m.Output = &manifestOutput{Path: f.Name()}
+	m.Dependencies = nil
+	return func() error { return os.Remove(f.Name()) }, nil
+}
+
+// readIngestRecords reads the agent's output file. Lines that are not a
+// JSON object with an id are counted as malformed and skipped.
+func readIngestRecords(path string) ([]ingestRecord, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("open agent output: %w", err)
+	}
+	defer f.Close()
+
+	var (
+		recs      []ingestRecord
+		malformed int
+	)
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, ingestMaxLine)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		var rec ingestRecord
+		if err := json.Unmarshal([]byte(line), &rec); err != nil || rec.ID == "" {
+			malformed++
+			continue
+		}
+		recs = append(recs, rec)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, malformed, fmt.Errorf("read agent output: %w", err)
+	}
+	return recs, malformed, nil
+}
+
+// mergeIngestRecords applies recs in order, so the last line for an id
+// wins, and returns the documents to upsert in the order their ids first
+// appeared and the ids to delete.
+func mergeIngestRecords(recs []ingestRecord) ([]ingestRecord, []string) {
+	last := make(map[string]ingestRecord, len(recs))
+	var order []string
+	for _, rec := range recs {
+		if _, ok := last[rec.ID]; !ok {
+			order = append(order, rec.ID)
+		}
+		last[rec.ID] = rec
+	}
+	var (
+		upserts []ingestRecord
+		deletes []string
+	)
+	for _, id := range order {
+		if rec := last[id]; rec.Delete {
+			deletes = append(deletes, id)
+		} else {
+			upserts = append(upserts, rec)
+		}
+	}
+	return upserts, deletes
+}
+
+// ingestOutput stores the documents the agent wrote to the manifest's
+// output file, along with the generated dependency inventory.
+func (ix *indexer) ingestOutput(ctx context.Context, result *RepoResult, m *indexManifest) error {
+	recs, malformed, err := readIngestRecords(m.Output.Path)
+	if err != nil {
+		return err
+	}
+	if malformed > 0 {
+		ix.log(ctx).warnf("skipped %d malformed lines of the agent's output", malformed)
+	}
+	if doc := m.dependencyDocument; doc != nil {
+		recs = append(recs, ingestRecord{ID: doc.ID, Document: doc.Document, Metadata: doc.Metadata})
+	}
+	upserts, deletes := mergeIngestRecords(recs)
+	return ix.ingestRecords(ctx, result, m, upserts, deletes)
+}
+
+// ingestRecords upserts documents into m's collection, creating it with
+// the run's collection metadata when it does not exist and updating that
+// metadata when it does, and deletes the records listed in deletes.
+// Documents whose metadata fails the document schema are counted in
+// result.InvalidDocs and left out; long ones are chunked before they are
+// embedded, and chunks left over from an earlier, longer version are
+// deleted. Documents stored unchanged by an earlier run are not upserted
+// again.
+func (ix *indexer) ingestRecords(
+	ctx context.Context, result *RepoResult, m *indexManifest, upserts []ingestRecord, deletes []string,
+) error {
+	collection := m.Collection
+	valid := make([]ingestRecord, 0, len(upserts))
+	for _, rec := range upserts {
+		if err := documentSchema.validate(rec.Metadata); err != nil {
+			if result.InvalidDocs < invalidDocumentsShown {
+				ix.log(ctx).warnf("document %s not stored: %s", rec.ID, metadataProblems(err))
+			}
+			result.InvalidDocs++
+			continue
+		}
+		valid = append(valid, rec)
+	}
+
+	client := newChromaClient(ix.opts.Chroma)
+	colMeta := ix.collectionMetadata(m)
+	col, ok, err := client.getCollection(ctx, collection)
+	switch {
+	case err == nil && !ok:
+		col, err = client.createCollection(ctx, collection, colMeta)
+	case err == nil:
+		err = stampCollection(ctx, client, col, colMeta)
+	}
+	if err != nil {
+		return fmt.Errorf("ingest %s: %w", collection, err)
+	}
+
+	chunks := chunkRecords(valid, ix.embedChunkChars())
+	written := make(map[string]bool, len(chunks))
+	for _, rec := range chunks {
+		written[rec.ID] = true
+	}
+	if ok {
+		stale, err := staleChunks(ctx, client, col.ID, valid, written)
+		if err != nil {
+			return fmt.Errorf("ingest %s: %w", collection, err)
+		}
+		deletes = append(deletes, stale...)
+	}
+	for _, rec := range valid {
+		// A document stored whole before is replaced by its chunks.
+		if !written[rec.ID] {
+			deletes = append(deletes, rec.ID)
+		}
+	}
+	deletes = slices.DeleteFunc(slices.Compact(slices.Sorted(slices.Values(deletes))), func(id string) bool {
+		return written[id]
+	})
+	model := ix.embedder().name()
+	for _, rec := range chunks {
+		rec.Metadata[contentHashKey] = contentHash(rec.Document)
+		rec.Metadata[embeddingModelKey] = model
+	}
+	stored := len(chunks)
+	if ok {
+		if chunks, err = changedRecords(ctx, client, col.ID, chunks); err != nil {
+			return fmt.Errorf("ingest %s: %w", collection, err)
+		}
+	}
+
+	if err := ix.upsertBatches(ctx, client, col, chunks); err != nil {
+		return fmt.Errorf("ingest %s: %w", collection, err)
+	}
+	if err := ix.deleteBatches(ctx, client, col, deletes); err != nil {
+		return fmt.Errorf("ingest %s: %w", collection, err)
+	}
+	result.IngestedDocs = stored
+	ix.log(ctx).infof("stored %d documents in %s (%d unchanged, %d deleted)",
+		stored, collection, stored-len(chunks), len(deletes))
+	return nil
+}
+
+// provenanceKeys are the metadata keys every run stamps anew. A document
+// that differs from the stored one only in these is left as stored.
+var provenanceKeys = []string{"run_id", "commit", "indexer_version"}
+
+// changedRecords drops the records the collection already stores with the
+// same content hash and metadata, apart from provenanceKeys.
+func changedRecords(
+	ctx context.Context, client *chromaClient, collectionID string, recs []ingestRecord,
+) ([]ingestRecord, error) {
+	stored := make(map[string]string, len(recs))
+	for start := 0; start < len(recs); start += chromaPageSize {
+		var ids []string
+		for _, rec := range recs[start:min(start+chromaPageSize, len(recs))] {
+			ids = append(ids, rec.ID)
+		}
+		page, err := client.getMetadatas(ctx, collectionID, ids)
+		if err != nil {
+			return nil, err
+		}
+		for i, id := range page.IDs {
+			if i < len(page.Metadatas) {
+				stored[id] = metadataFingerprint(page.Metadatas[i])
+			}
+		}
+	}
+	return slices.DeleteFunc(recs, func(rec ingestRecord) bool {
+		fp, ok := stored[rec.ID]
+		return ok && fp == metadataFingerprint(rec.Metadata)
+	}), nil
+}
+
+// metadataFingerprint hashes md without provenanceKeys.
+func metadataFingerprint(md map[string]any) string {
+	md = maps.Clone(md)
+	for _, key := range provenanceKeys {
+		delete(md, key)
+	}
+	return documentFingerprint(nil, md)
+}
+
+// ingestLocal implements IngestLocal: it stores the summaries
+// localDocuments generates and the dependency inventory, and deletes the
+// local summaries of modules that no longer exist. Dry runs only write to
+// the mock store.
+func (ix *indexer) ingestLocal(
+	ctx context.Context, result *RepoResult, m *indexManifest, repoDir string, redact redaction, dryRun bool,
+) error {
+	recs, err := ix.localDocuments(ctx, m, repoDir, redact)
+	if err != nil {
+		return fmt.Errorf("generate summaries: %w", err)
+	}
+	if doc := m.dependencyDocument; doc != nil {
+		recs = append(recs, ingestRecord{ID: doc.ID, Document: doc.Document, Metadata: doc.Metadata})
+	}
+	if dryRun && ix.opts.Chroma.mock == nil {
+		ix.log(ctx).infof("[dry-run] would store %d generated documents in %s", len(recs), m.Collection)
+		return nil
+	}
+	ix.log(ctx).infof("generated %d summaries without an agent", len(recs))
+	stored, err := ix.snapshotDocuments(ctx, m.Collection)
+	if err != nil {
+		return err
+	}
+	return ix.ingestRecords(ctx, result, m, recs, localPrunes(stored, recs))
+}
+
+// staleChunks returns the ids of stored chunks of the documents in recs
+// that are not written again.
+func staleChunks(
+	ctx context.Context, client *chromaClient, collectionID string, recs []ingestRecord, written map[string]bool,
+) ([]string, error) {
+	var stale []string
+	for start := 0; start < len(recs); start += chromaPageSize {
+		parents := make(map[string]bool)
+		var ids []any
+		for _, rec := range recs[start:min(start+chromaPageSize, len(recs))] {
+			parents[rec.ID] = true
+			ids = append(ids, rec.ID)
+		}
+		where := map[string]any{chunkOfKey: map[string]any{"$in": ids}}
+		for offset := 0; ; offset += chromaPageSize {
+			page, err := client.getWhereMetadatas(ctx, collectionID, where, offset, chromaPageSize)
+			if err != nil {
+				return nil, err
+			}
+			for i, id := range page.IDs {
+				var parent string
+				if i < len(page.Metadatas) {
+					parent, _ = page.Metadatas[i][chunkOfKey].(string)
+				}
+				// Stores that ignore the filter return every record.
+				if parents[parent] && !written[id] {
+					stale = append(stale, id)
+				}
+			}
+			if len(page.IDs) < chromaPageSize {
+				break
+			}
+		}
+	}
+	return stale, nil
+}
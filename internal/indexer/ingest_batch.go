@@ -0,0 +1,131 @@
+package indexer
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultIngestBatchSize is how many documents the indexer writes to the
+// store in one request by default.
+const DefaultIngestBatchSize = 100
+
+// upsertBatches embeds and upserts recs into the collection in batches of
+// --ingest-batch-size, running batches concurrently within the run-wide
+// --ingest-parallel cap. The first failure stops batches not yet started
+// and is returned.
+func (ix *indexer) upsertBatches(
+	ctx context.Context, client *chromaClient, col chromaCollection, recs []ingestRecord,
+) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	emb := ix.embedder()
+	size := ix.ingestBatchSize()
+	for start := 0; start < len(recs) && ctx.Err() == nil; start += size {
+		batch := recs[start:min(start+size, len(recs))]
+		release := ix.ingestSlots.acquire()
+		wg.Go(func() {
+			defer release()
+			if err := ix.upsertBatch(ctx, client, col, emb, batch); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+				cancel()
+			}
+		})
+	}
+	wg.Wait()
+	return firstErr
+}
+
+func (ix *indexer) upsertBatch(
+	ctx context.Context, client *chromaClient, col chromaCollection, emb embedder, batch []ingestRecord,
+) error {
+	texts := make([]string, len(batch))
+	recs := chromaRecords{
+		IDs:       make([]string, len(batch)),
+		Documents: make([]*string, len(batch)),
+		Metadatas: make([]map[string]any, len(batch)),
+	}
+	for i, rec := range batch {
+		texts[i] = rec.Document
+		recs.IDs[i] = rec.ID
+		recs.Documents[i] = &texts[i]
+		recs.Metadatas[i] = rec.Metadata
+		recs.Metadatas[i][embeddingModelKey] = emb.name()
+	}
+	var err error
+	if recs.Embeddings, err = emb.embed(ctx, texts); err != nil {
+		return fmt.Errorf("embed documents: %w", err)
+	}
+	return ix.retryStore(ctx, "upsert into "+col.Name, func() error {
+		return client.upsertRecords(ctx, col.ID, recs)
+	})
+}
+
+// deleteBatches deletes ids from the collection in batches of
+// --ingest-batch-size, one at a time.
+func (ix *indexer) deleteBatches(ctx context.Context, client *chromaClient, col chromaCollection, ids []string) error {
+	size := ix.ingestBatchSize()
+	for start := 0; start < len(ids); start += size {
+		batch := ids[start:min(start+size, len(ids))]
+		release := ix.ingestSlots.acquire()
+		err := ix.retryStore(ctx, "delete from "+col.Name, func() error {
+			return client.deleteRecords(ctx, col.ID, batch)
+		})
+		release()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ix *indexer) ingestBatchSize() int {
+	return cmp.Or(ix.opts.IngestBatchSize, DefaultIngestBatchSize)
+}
+
+// retryStore runs op, retrying store writes that fail with a 5xx or 429
+// response up to --ingest-retries times. Each retry waits a random delay
+// below --ingest-retry-delay, doubled each attempt, so repos retrying
+// against an overloaded store at once spread out.
+func (ix *indexer) retryStore(ctx context.Context, desc string, op func() error) error {
+	bound := ix.opts.IngestRetryDelay
+	for attempt := 0; ; attempt++ {
+		err := op()
+		if err == nil || attempt >= ix.opts.IngestRetries || !retryableStoreError(err) {
+			return err
+		}
+
+		var wait time.Duration
+		if bound > 0 {
+			wait = rand.N(bound)
+		}
+		ix.log(ctx).warnf("%s failed (attempt %d/%d), retrying in %s: %v",
+			desc, attempt+1, ix.opts.IngestRetries+1, wait.Round(time.Millisecond), err)
+		if err := sleepCtx(ctx, wait); err != nil {
+			return fmt.Errorf("%s retry: %w", desc, err)
+		}
+		bound *= 2
+	}
+}
+
+// retryableStoreError reports whether err is a store response worth
+// retrying: a server error, or a 429 asking the client to slow down.
+func retryableStoreError(err error) bool {
+	var apiErr *chromaError
+	return errors.As(err, &apiErr) &&
+		(apiErr.Status >= http.StatusInternalServerError || apiErr.Status == http.StatusTooManyRequests)
+}
@@ -0,0 +1,93 @@
+package indexer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestUpsertBatches(t *testing.T) {
+	tests := map[string]struct {
+		// fail answers the upsert requests with these statuses, in order,
+		// before succeeding.
+		fail      []int
+		retries   int
+		wantCalls int
+		wantIDs   int
+		wantErr   string
+	}{
+		"batched":         {wantCalls: 3, wantIDs: 5},
+		"retried 5xx":     {fail: []int{http.StatusServiceUnavailable}, retries: 2, wantCalls: 4, wantIDs: 5},
+		"retried 429":     {fail: []int{http.StatusTooManyRequests}, retries: 1, wantCalls: 4, wantIDs: 5},
+		"retries run out": {fail: []int{500, 502, 503}, retries: 2, wantCalls: 3, wantErr: "503"},
+		"client error":    {fail: []int{http.StatusBadRequest}, retries: 2, wantCalls: 1, wantErr: "400"},
+		"no retries":      {fail: []int{http.StatusBadGateway}, wantCalls: 1, wantErr: "502"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var (
+				mu               sync.Mutex
+				calls, inFlight  int
+				maxInFlight, ids int
+			)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				calls++
+				inFlight++
+				maxInFlight = max(maxInFlight, inFlight)
+				status := http.StatusOK
+				if calls <= len(tc.fail) {
+					status = tc.fail[calls-1]
+				}
+				mu.Unlock()
+				defer func() {
+					mu.Lock()
+					inFlight--
+					mu.Unlock()
+				}()
+
+				if status != http.StatusOK {
+					http.Error(w, fmt.Sprintf("status %d", status), status)
+					return
+				}
+				var req struct {
+					IDs []string `json:"ids"`
+				}
+				_ = json.NewDecoder(r.Body).Decode(&req)
+				mu.Lock()
+				ids += len(req.IDs)
+				mu.Unlock()
+				_ = json.NewEncoder(w).Encode(map[string]any{})
+			}))
+			t.Cleanup(srv.Close)
+
+			ix := newIndexer(io.Discard, io.Discard, nil, nil, Options{
+				Chroma:          ChromaOptions{URL: srv.URL},
+				IngestBatchSize: 2,
+				IngestParallel:  1,
+				IngestRetries:   tc.retries,
+			})
+			recs := make([]ingestRecord, 5)
+			for i := range recs {
+				recs[i] = ingestRecord{ID: fmt.Sprint("doc-", i), Document: "text", Metadata: map[string]any{}}
+			}
+			col := chromaCollection{ID: "col-1", Name: "api"}
+			err := ix.upsertBatches(t.Context(), newChromaClient(ix.opts.Chroma), col, recs)
+			if tc.wantErr == "" && err != nil || tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+				t.Fatalf("expected error %q, got %v", tc.wantErr, err)
+			}
+			if calls != tc.wantCalls || tc.wantErr == "" && ids != tc.wantIDs {
+				t.Fatalf("expected %d requests writing %d ids, got %d writing %d", tc.wantCalls, tc.wantIDs, calls, ids)
+			}
+			if maxInFlight > 1 {
+				t.Fatalf("expected at most 1 request in flight, got %d", maxInFlight)
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package indexer
+
+import (
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMergeIngestRecords(t *testing.T) {
+	tests := map[string]struct {
+		recs        []ingestRecord
+		wantUpserts []string
+		wantDocs    []string
+		wantDeletes []string
+	}{
+		"last line wins": {
+			recs:        []ingestRecord{{ID: "a", Document: "v1"}, {ID: "b", Document: "v1"}, {ID: "a", Document: "v2"}},
+			wantUpserts: []string{"a", "b"},
+			wantDocs:    []string{"v2", "v1"},
+		},
+		"delete after upsert": {
+			recs:        []ingestRecord{{ID: "a", Document: "v1"}, {ID: "a", Delete: true}, {ID: "c", Delete: true}},
+			wantDeletes: []string{"a", "c"},
+		},
+		"upsert after delete": {
+			recs:        []ingestRecord{{ID: "a", Delete: true}, {ID: "a", Document: "v2"}},
+			wantUpserts: []string{"a"},
+			wantDocs:    []string{"v2"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			upserts, deletes := mergeIngestRecords(tc.recs)
+			var ids, docs []string
+			for _, rec := range upserts {
+				ids = append(ids, rec.ID)
+				docs = append(docs, rec.Document)
+			}
+			if !slices.Equal(ids, tc.wantUpserts) || !slices.Equal(docs, tc.wantDocs) ||
+				!slices.Equal(deletes, tc.wantDeletes) {
+				t.Fatalf("expected upserts %q %q and deletes %q, got %q %q and %q",
+					tc.wantUpserts, tc.wantDocs, tc.wantDeletes, ids, docs, deletes)
+			}
+		})
+	}
+}
+
+func TestHashEmbedding(t *testing.T) {
+	dot := func(a, b []float64) float64 {
+		var sum float64
+		for i := range a {
+			sum += a[i] * b[i]
+		}
+		return sum
+	}
+	auth := hashEmbedding("Auth service issues JWT tokens")
+	if len(auth) != hashEmbeddingDims || dot(auth, auth) < 0.999 || dot(auth, auth) > 1.001 {
+		t.Fatalf("expected a unit vector of %d dims, got %d dims with norm² %f", hashEmbeddingDims, len(auth),
+			dot(auth, auth))
+	}
+	if !reflect.DeepEqual(auth, hashEmbedding("auth service issues jwt tokens!")) {
+		t.Fatal("expected case and punctuation to be ignored")
+	}
+	if similar, other := dot(auth, hashEmbedding("JWT tokens for auth")), dot(auth, hashEmbedding("billing invoices")); similar <= other {
+		t.Fatalf("expected shared words to score higher: %f <= %f", similar, other)
+	}
+	if empty := hashEmbedding(""); slices.ContainsFunc(empty, func(x float64) bool { return x != 0 }) {
+		t.Fatal("expected a zero vector for empty text")
+	}
+}
+
+func TestIngestRecordsSkipsUnchanged(t *testing.T) {
+	chroma := ChromaOptions{URL: "http://chroma.invalid"}
+	closeStore, err := OpenEmbeddedStore(t.TempDir(), &chroma)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = closeStore() })
+	store := chroma.transport.(handlerTransport)
+	var upserts int
+	chroma.transport = handlerTransport{http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/upsert") {
+			upserts++
+		}
+		store.ServeHTTP(w, r)
+	})}
+
+	ingest := func(runID, overview string) int {
+		t.Helper()
+		upserts = 0
+		ix := newIndexer(io.Discard, io.Discard, nil, nil, Options{Chroma: chroma, Ingest: IngestDirect})
+		m := &indexManifest{Collection: "api", RunID: runID, Repo: manifestRepo{Name: "api", Path: "/src/api"}}
+		var recs []ingestRecord
+		for id, doc := range map[string]string{"overview": overview, "module:store": "Stores sessions."} {
+			md := validMetadata()
+			md["run_id"] = runID
+			recs = append(recs, ingestRecord{ID: id, Document: doc, Metadata: md})
+		}
+		var result RepoResult
+		if err := ix.ingestRecords(t.Context(), &result, m, recs, nil); err != nil {
+			t.Fatalf("ingest: %v", err)
+		}
+		if result.IngestedDocs != 2 {
+			t.Fatalf("expected 2 documents stored, got %d", result.IngestedDocs)
+		}
+		return upserts
+	}
+
+	if n := ingest("run-1", "An API."); n == 0 {
+		t.Fatal("expected the first ingest to upsert")
+	}
+	if n := ingest("run-2", "An API."); n != 0 {
+		t.Fatalf("expected an identical ingest to make no upsert calls, got %d", n)
+	}
+	if n := ingest("run-3", "An HTTP API."); n == 0 {
+		t.Fatal("expected a changed document to be upserted")
+	}
+}
+
+func TestRunResultsIngestLocal(t *testing.T) {
+	rootDir := t.TempDir()
+	repoDir := filepath.Join(rootDir, "api")
+	initGitRepo(t, repoDir)
+	files := map[string]string{
+		"internal/auth/doc.go":      "// Package auth issues and checks\n// session tokens.\npackage auth\n",
+		"internal/auth/jwt/sign.go": "package jwt\n",
+		"cmd/api/main.go":           "package main\n",
+		"node_modules/left/pad.js":  "module.exports = 1\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(repoDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	if err := runGit(repoDir, "add", "-A"); err != nil {
+		t.Fatalf("git add: %v", err)
+	}
+	if err := runGit(repoDir, "commit", "-m", "add code"); err != nil {
+		t.Fatalf("git commit: %v", err)
+	}
+
+	chroma := ChromaOptions{URL: "http://chroma.invalid"}
+	closeStore, err := OpenEmbeddedStore(t.TempDir(), &chroma)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = closeStore() })
+	cachePath := filepath.Join(t.TempDir(), "cache.json")
+	run := func() RepoResult {
+		t.Helper()
+		results, err := RunResults(Options{
+			RootDir:     rootDir,
+			SummaryJSON: filepath.Join(t.TempDir(), "summary.json"),
+			CachePath:   cachePath,
+			Ingest:      IngestLocal,
+			CodexPath:   "/nonexistent/codex",
+			Chroma:      chroma,
+		})
+		if err != nil || len(results) != 1 || results[0].Err != nil {
+			t.Fatalf("run indexer: %v %+v", err, results)
+		}
+		return results[0]
+	}
+	stored := func() map[string]string {
+		t.Helper()
+		client := newChromaClient(chroma)
+		col, ok, err := client.getCollection(t.Context(), "api")
+		if err != nil || !ok {
+			t.Fatalf("get collection: %v (exists %t)", err, ok)
+		}
+		recs, err := client.getDocuments(t.Context(), col.ID, 0, chromaPageSize)
+		if err != nil {
+			t.Fatalf("get documents: %v", err)
+		}
+		docs := make(map[string]string)
+		for i, id := range recs.IDs {
+			docs[id] = *recs.Documents[i]
+		}
+		return docs
+	}
+
+	result := run()
+	if result.CodexRan || result.IngestedDocs != 3 {
+		t.Fatalf("expected 3 documents stored without the agent, got %+v", result)
+	}
+	docs := stored()
+	want := []string{"local:module:cmd/api", "local:module:internal/auth", "local:overview"}
+	if got := slices.Sorted(maps.Keys(docs)); !slices.Equal(got, want) {
+		t.Fatalf("expected documents %q, got %q", want, got)
+	}
+	auth := docs["local:module:internal/auth"]
+	if !strings.Contains(auth, "Package auth issues and checks session tokens.") ||
+		!strings.Contains(auth, "Subdirectories: jwt.") {
+		t.Fatalf("unexpected module summary:\n%s", auth)
+	}
+	if strings.Contains(docs["local:overview"], "node_modules") {
+		t.Fatalf("expected exclusions left out of the overview:\n%s", docs["local:overview"])
+	}
+
+	if err := runGit(repoDir, "rm", "-r", "-q", "cmd"); err != nil {
+		t.Fatalf("git rm: %v", err)
+	}
+	if err := runGit(repoDir, "commit", "-m", "drop cmd"); err != nil {
+		t.Fatalf("git commit: %v", err)
+	}
+	run()
+	if _, ok := stored()["local:module:cmd/api"]; ok {
+		t.Fatal("expected the summary of a removed module to be deleted")
+	}
+}
+
+func TestRunResultsIngestDirect(t *testing.T) {
+	rootDir := t.TempDir()
+	initGitRepo(t, filepath.Join(rootDir, "api"))
+	codexPath := filepath.Join(t.TempDir(), "codex")
+	codex := `#!/bin/sh
+m="$INDEX_MANIFEST_PATH"
+out=$(grep -o '[^"]*ai-indexer-output-[^"]*' "$m")
+sha=$(sed -n 's/.*"sha": *"\([0-9a-f]*\)".*/\1/p' "$m" | head -n 1)
+run=$(sed -n 's/.*"run_id": *"\([^"]*\)".*/\1/p' "$m" | head -n 1)
+md="\"repo\":\"api\",\"collection\":\"api\",\"commit\":\"$sha\",\"run_id\":\"$run\",\"kind\":\"repo_overview\",\"path\":\"ROOT\""
+echo "{\"id\":\"overview\",\"document\":\"draft\",\"metadata\":{$md}}" >> "$out"
+echo "not json" >> "$out"
+echo "{\"id\":\"overview\",\"document\":\"Billing API\",\"metadata\":{$md}}" >> "$out"
+echo "{\"id\":\"unlabelled\",\"document\":\"x\",\"metadata\":{\"kind\":\"module_summary\"}}" >> "$out"
+`
+	if err := os.WriteFile(codexPath, []byte(codex), 0o755); err != nil {
+		t.Fatalf("write codex stub: %v", err)
+	}
+	chroma := ChromaOptions{URL: "http://chroma.invalid"}
+	closeStore, err := OpenEmbeddedStore(t.TempDir(), &chroma)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = closeStore() })
+
+	results, err := RunResults(Options{
+		RootDir:     rootDir,
+		SummaryJSON: filepath.Join(t.TempDir(), "summary.json"),
+		Ingest:      IngestDirect,
+		CodexPath:   codexPath,
+		CodexStdin:  StdinClosed,
+		Chroma:      chroma,
+	})
+	if err != nil || len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("run indexer: %v %+v", err, results)
+	}
+	if r := results[0]; r.IngestedDocs != 1 || r.InvalidDocs != 1 {
+		t.Fatalf("expected 1 stored and 1 invalid document, got %d and %d", r.IngestedDocs, r.InvalidDocs)
+	}
+
+	client := newChromaClient(chroma)
+	col, ok, err := client.getCollection(t.Context(), "api")
+	if err != nil || !ok {
+		t.Fatalf("get collection: %v (exists %t)", err, ok)
+	}
+	recs, err := client.getRecords(t.Context(), col.ID, 0, chromaPageSize)
+	if err != nil || len(recs.IDs) != 1 || *recs.Documents[0] != "Billing API" ||
+		len(recs.Embeddings) != 1 || len(recs.Embeddings[0]) != hashEmbeddingDims {
+		t.Fatalf("expected the last overview with its embedding, got %+v (%v)", recs, err)
+	}
+
+	if _, err := RunResults(Options{RootDir: rootDir, Ingest: "ftp", DryRun: true}); err == nil ||
+		!strings.Contains(err.Error(), "unknown ingestion mode") {
+		t.Fatalf("expected an unknown ingestion mode error, got %v", err)
+	}
+}
@@ -0,0 +1,286 @@
+package indexer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// initClearAnswer clears a list prompt that has a default.
+const initClearAnswer = "none"
+
+// InitOptions configures InitConfig.
+type InitOptions struct {
+	// Path is the config file written. An existing file supplies the
+	// defaults and keeps its per-repo and credential sections.
+	Path string
+	// SkipChecks skips pinging Chroma and looking up the Codex executable.
+	SkipChecks bool
+}
+
+// InitConfig interactively asks for the root directory, Chroma connection,
+// Codex runner, parallelism, and skip rules, validates the answers, and
+// writes them to opts.Path.
+func InitConfig(ctx context.Context, in io.Reader, out io.Writer, opts InitOptions) error {
+	if opts.Path == "" {
+		return errors.New("config path is required")
+	}
+
+	cfg := &Config{}
+	if _, err := os.Stat(opts.Path); err == nil {
+		if cfg, err = LoadConfig(opts.Path); err != nil {
+			return err
+		}
+		logf(out, "Updating %s; press enter to keep the current value.\n", opts.Path)
+	}
+
+	p := &prompter{in: bufio.NewReader(in), out: out}
+	if err := p.askRoot(cfg); err != nil {
+		return err
+	}
+	if err := p.askChroma(ctx, cfg, opts.SkipChecks); err != nil {
+		return err
+	}
+	if err := p.askRunner(cfg, opts.SkipChecks); err != nil {
+		return err
+	}
+	if err := p.askParallel(cfg); err != nil {
+		return err
+	}
+	if err := p.askSkipRepos(cfg); err != nil {
+		return err
+	}
+
+	if err := writeConfig(opts.Path, cfg); err != nil {
+		return err
+	}
+	logf(out, "Wrote %s; pass --config %s to use it.\n", opts.Path, opts.Path)
+	return nil
+}
+
+// prompter reads one answer per line.
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// ask prints question with its default and returns the trimmed answer, or
+// def when the answer is empty.
+func (p *prompter) ask(question, def string) (string, error) {
+	if def != "" {
+		logf(p.out, "%s [%s]: ", question, def)
+	} else {
+		logf(p.out, "%s: ", question)
+	}
+
+	line, err := p.in.ReadString('\n')
+	if err != nil && (!errors.Is(err, io.EOF) || line == "") {
+		if errors.Is(err, io.EOF) {
+			return "", errors.New("init aborted: unexpected end of input")
+		}
+		return "", fmt.Errorf("read answer: %w", err)
+	}
+	if answer := strings.TrimSpace(line); answer != "" {
+		return answer, nil
+	}
+	return def, nil
+}
+
+// confirm asks a yes/no question.
+func (p *prompter) confirm(question string, def bool) (bool, error) {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	for {
+		answer, err := p.ask(question+" ("+hint+")", "")
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(answer) {
+		case "":
+			return def, nil
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+		logf(p.out, "Please answer y or n.\n")
+	}
+}
+
+func (p *prompter) askRoot(cfg *Config) error {
+	def := cfg.Root
+	if def == "" {
+		def, _ = os.Getwd()
+	}
+	for {
+		answer, err := p.ask("Root directory to scan for repositories", def)
+		if err != nil {
+			return err
+		}
+		root, err := expandHome(answer)
+		if err == nil {
+			root, err = filepath.Abs(root)
+		}
+		if err == nil {
+			var info os.FileInfo
+			if info, err = os.Stat(root); err == nil && !info.IsDir() {
+				err = fmt.Errorf("%s is not a directory", root)
+			}
+		}
+		if err != nil {
+			logf(p.out, "Invalid root directory: %v\n", err)
+			continue
+		}
+		cfg.Root = root
+		return nil
+	}
+}
+
+func (p *prompter) askChroma(ctx context.Context, cfg *Config, skipCheck bool) error {
+	cc := ChromaConfig{
+		URL:      DefaultChromaURL,
+		Tenant:   DefaultChromaTenant,
+		Database: DefaultChromaDatabase,
+		TokenEnv: "CHROMA_TOKEN",
+	}
+	if cfg.Chroma != nil {
+		cc = *cfg.Chroma
+	}
+
+	for {
+		var err error
+		if cc.URL, err = p.ask("Chroma URL", cc.URL); err != nil {
+			return err
+		}
+		if cc.Tenant, err = p.ask("Chroma tenant", cc.Tenant); err != nil {
+			return err
+		}
+		if cc.Database, err = p.ask("Chroma database", cc.Database); err != nil {
+			return err
+		}
+		if cc.TokenEnv, err = p.ask("Environment variable holding the Chroma token", cc.TokenEnv); err != nil {
+			return err
+		}
+		if skipCheck {
+			break
+		}
+
+		client := newChromaClient(ChromaOptions{
+			URL:      cc.URL,
+			Tenant:   cc.Tenant,
+			Database: cc.Database,
+			Token:    os.Getenv(cc.TokenEnv),
+		})
+		pingErr := client.ping(ctx)
+		if pingErr == nil {
+			logf(p.out, "Connected to Chroma at %s.\n", cc.URL)
+			break
+		}
+		logf(p.out, "Could not reach Chroma: %v\n", pingErr)
+		retry, err := p.confirm("Re-enter the Chroma settings?", true)
+		if err != nil {
+			return err
+		}
+		if !retry {
+			break
+		}
+	}
+	cfg.Chroma = &cc
+	return nil
+}
+
+func (p *prompter) askRunner(cfg *Config, skipCheck bool) error {
+	def := cfg.CodexPath
+	if def == "" {
+		def = defaultCodexPath
+	}
+	for {
+		answer, err := p.ask("Codex executable (runner)", def)
+		if err != nil {
+			return err
+		}
+		if !skipCheck {
+			if _, lookErr := exec.LookPath(answer); lookErr != nil {
+				logf(p.out, "Codex not found: %v\n", lookErr)
+				keep, err := p.confirm("Use it anyway?", false)
+				if err != nil {
+					return err
+				}
+				if !keep {
+					continue
+				}
+			}
+		}
+		cfg.CodexPath = answer
+		if answer == defaultCodexPath {
+			cfg.CodexPath = ""
+		}
+		return nil
+	}
+}
+
+func (p *prompter) askParallel(cfg *Config) error {
+	def := cfg.Parallel
+	if def == 0 {
+		def = 1
+	}
+	for {
+		answer, err := p.ask("Repositories to index in parallel", strconv.Itoa(def))
+		if err != nil {
+			return err
+		}
+		n, err := strconv.Atoi(answer)
+		if err != nil || n < 1 {
+			logf(p.out, "Please enter a positive whole number.\n")
+			continue
+		}
+		cfg.Parallel = n
+		return nil
+	}
+}
+
+func (p *prompter) askSkipRepos(cfg *Config) error {
+	question := "Repos to skip by slug, name, or path (comma-separated)"
+	if len(cfg.SkipRepos) > 0 {
+		question += ", or " + initClearAnswer + " to clear"
+	}
+	answer, err := p.ask(question, strings.Join(cfg.SkipRepos, ","))
+	if err != nil {
+		return err
+	}
+
+	cfg.SkipRepos = nil
+	if answer == initClearAnswer {
+		return nil
+	}
+	for item := range strings.SplitSeq(answer, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			cfg.SkipRepos = append(cfg.SkipRepos, item)
+		}
+	}
+	return nil
+}
+
+// writeConfig atomically replaces the config file at path.
+func writeConfig(path string, cfg *Config) error {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode config: %w", err)
+	}
+	data = append(data, '\n')
+
+	if err := writeFileSynced(path, data, 0o600); err != nil {
+		return fmt.Errorf("persist config: %w", err)
+	}
+	return nil
+}
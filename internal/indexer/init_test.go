@@ -0,0 +1,119 @@
+package indexer
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestInitConfig(t *testing.T) {
+	_, srv := newFakeChroma(t, 0)
+	// Keep a real codex off PATH so the default runner is never found.
+	t.Setenv("PATH", t.TempDir())
+	rootDir := t.TempDir()
+	codexPath := filepath.Join(t.TempDir(), "codex")
+	if err := os.WriteFile(codexPath, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatalf("write codex: %v", err)
+	}
+
+	tests := map[string]struct {
+		existing string
+		answers  []string
+		want     Config
+		wantRepo bool
+	}{
+		"fresh": {
+			answers: []string{
+				rootDir,
+				srv.URL, "", "", "",
+				codexPath,
+				"zero", "0", "4",
+				"legacy, tools/old",
+			},
+			want: Config{
+				Root: rootDir,
+				Chroma: &ChromaConfig{
+					URL:      srv.URL,
+					Tenant:   DefaultChromaTenant,
+					Database: DefaultChromaDatabase,
+					TokenEnv: "CHROMA_TOKEN",
+				},
+				CodexPath: codexPath,
+				SkipRepos: []string{"legacy", "tools/old"},
+				Parallel:  4,
+			},
+		},
+		"retry unreachable store and keep existing sections": {
+			existing: `{"root": "` + rootDir + `", "parallel": 2, "skip_repos": ["legacy"],
+				"repos": {"api": {"codegen": "make generate"}}}`,
+			answers: []string{
+				"",
+				srv.URL, "other_tenant", "", "",
+				"",
+				srv.URL, DefaultChromaTenant, "", "",
+				"/does/not/exist/codex", "n", "", "y",
+				"",
+				"none",
+			},
+			want: Config{
+				Root: rootDir,
+				Chroma: &ChromaConfig{
+					URL:      srv.URL,
+					Tenant:   DefaultChromaTenant,
+					Database: DefaultChromaDatabase,
+					TokenEnv: "CHROMA_TOKEN",
+				},
+				Parallel: 2,
+			},
+			wantRepo: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "ai-indexer.json")
+			if tc.existing != "" {
+				if err := os.WriteFile(path, []byte(tc.existing), 0o600); err != nil {
+					t.Fatalf("write config: %v", err)
+				}
+			}
+
+			in := strings.NewReader(strings.Join(tc.answers, "\n") + "\n")
+			if err := InitConfig(t.Context(), in, io.Discard, InitOptions{Path: path}); err != nil {
+				t.Fatalf("init: %v", err)
+			}
+
+			got, err := LoadConfig(path)
+			if err != nil {
+				t.Fatalf("load config: %v", err)
+			}
+			if got.Root != tc.want.Root || got.CodexPath != tc.want.CodexPath || got.Parallel != tc.want.Parallel {
+				t.Fatalf("expected %+v, got %+v", tc.want, got)
+			}
+			if got.Chroma == nil || *got.Chroma != *tc.want.Chroma {
+				t.Fatalf("expected chroma %+v, got %+v", tc.want.Chroma, got.Chroma)
+			}
+			if !slices.Equal(got.SkipRepos, tc.want.SkipRepos) {
+				t.Fatalf("expected skip repos %v, got %v", tc.want.SkipRepos, got.SkipRepos)
+			}
+			if _, ok := got.Repos["api"]; ok != tc.wantRepo {
+				t.Fatalf("expected repos section kept=%t, got %v", tc.wantRepo, got.Repos)
+			}
+		})
+	}
+}
+
+func TestInitConfigEndOfInput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ai-indexer.json")
+	err := InitConfig(t.Context(), strings.NewReader(t.TempDir()+"\n"), io.Discard,
+		InitOptions{Path: path, SkipChecks: true})
+	if err == nil || !strings.Contains(err.Error(), "end of input") {
+		t.Fatalf("expected end of input error, got %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected no config written, got %v", err)
+	}
+}
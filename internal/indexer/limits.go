@@ -0,0 +1,89 @@
+package indexer
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+)
+
+// IONiceIdle schedules Codex disk I/O only when the disk is otherwise idle.
+const IONiceIdle = "idle"
+
+// memoryMaxPattern matches systemd MemoryMax= values such as 512M, 4G, or
+// 75%.
+var memoryMaxPattern = regexp.MustCompile(`^(\d+[KMGT]?|\d{1,3}%)$`)
+
+// ResourceLimits constrains each spawned Codex process. Limits are applied
+// by launching Codex through systemd-run, nice, and ionice, so each set
+// field requires the matching tool on PATH.
+type ResourceLimits struct {
+	// MemoryMax caps the memory of the Codex process tree in a transient
+	// cgroup scope (systemd MemoryMax=, e.g. "4G"); the kernel OOM-kills
+	// the scope rather than the host.
+	MemoryMax string
+	// IONice is "idle" or a best-effort priority level from 0 (highest) to 7.
+	IONice string
+	// Nice is the CPU niceness added to Codex, from -20 to 19; zero leaves
+	// the scheduling priority unchanged.
+	Nice int
+}
+
+func (l ResourceLimits) validate() error {
+	if l.MemoryMax != "" && !memoryMaxPattern.MatchString(l.MemoryMax) {
+		return fmt.Errorf("invalid codex memory limit %q (want bytes with optional K/M/G/T suffix, or a percentage)",
+			l.MemoryMax)
+	}
+	if l.Nice < -20 || l.Nice > 19 {
+		return fmt.Errorf("invalid codex nice value %d (want -20 to 19)", l.Nice)
+	}
+	if l.IONice != "" && l.IONice != IONiceIdle {
+		level, err := strconv.Atoi(l.IONice)
+		if err != nil || level < 0 || level > 7 {
+			return fmt.Errorf("invalid codex ionice value %q (want idle or 0-7)", l.IONice)
+		}
+	}
+
+	for _, tool := range l.tools() {
+		if _, err := exec.LookPath(tool); err != nil {
+			return fmt.Errorf("codex resource limits need %s: %w", tool, err)
+		}
+	}
+	return nil
+}
+
+func (l ResourceLimits) tools() []string {
+	var tools []string
+	if l.MemoryMax != "" {
+		tools = append(tools, "systemd-run")
+	}
+	if l.Nice != 0 {
+		tools = append(tools, "nice")
+	}
+	if l.IONice != "" {
+		tools = append(tools, "ionice")
+	}
+	return tools
+}
+
+// wrap prefixes argv with the launchers that apply the limits. Each launcher
+// execs the next, so the Codex process keeps the PID that the indexer waits
+// on and cancels.
+func (l ResourceLimits) wrap(argv []string) []string {
+	var prefix []string
+	if l.MemoryMax != "" {
+		prefix = append(prefix, "systemd-run", "--user", "--scope", "--quiet", "--collect",
+			"-p", "MemoryMax="+l.MemoryMax, "-p", "MemorySwapMax=0")
+	}
+	if l.Nice != 0 {
+		prefix = append(prefix, "nice", "-n", strconv.Itoa(l.Nice))
+	}
+	switch l.IONice {
+	case "":
+	case IONiceIdle:
+		prefix = append(prefix, "ionice", "-c", "3")
+	default:
+		prefix = append(prefix, "ionice", "-c", "2", "-n", l.IONice)
+	}
+	return append(prefix, argv...)
+}
@@ -0,0 +1,77 @@
+package indexer
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestResourceLimitsWrap(t *testing.T) {
+	argv := []string{"codex", "exec"}
+
+	tests := map[string]struct {
+		limits ResourceLimits
+		want   []string
+	}{
+		"no limits": {
+			want: argv,
+		},
+		"nice and idle io": {
+			limits: ResourceLimits{Nice: 10, IONice: IONiceIdle},
+			want:   []string{"nice", "-n", "10", "ionice", "-c", "3", "codex", "exec"},
+		},
+		"best-effort io level": {
+			limits: ResourceLimits{IONice: "7"},
+			want:   []string{"ionice", "-c", "2", "-n", "7", "codex", "exec"},
+		},
+		"memory scope first": {
+			limits: ResourceLimits{MemoryMax: "4G", Nice: 5},
+			want: []string{
+				"systemd-run", "--user", "--scope", "--quiet", "--collect",
+				"-p", "MemoryMax=4G", "-p", "MemorySwapMax=0",
+				"nice", "-n", "5", "codex", "exec",
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := tc.limits.wrap(slices.Clone(argv))
+			if !slices.Equal(got, tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestResourceLimitsValidate(t *testing.T) {
+	tests := map[string]struct {
+		limits  ResourceLimits
+		wantErr bool
+	}{
+		"empty": {},
+		"bad memory": {
+			limits:  ResourceLimits{MemoryMax: "lots"},
+			wantErr: true,
+		},
+		"nice out of range": {
+			limits:  ResourceLimits{Nice: 25},
+			wantErr: true,
+		},
+		"bad ionice": {
+			limits:  ResourceLimits{IONice: "9"},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := tc.limits.validate()
+			if tc.wantErr && err == nil {
+				t.Fatalf("expected error")
+			}
+			if !tc.wantErr && err != nil {
+				t.Fatalf("validate: %v", err)
+			}
+		})
+	}
+}
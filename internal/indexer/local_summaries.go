@@ -0,0 +1,354 @@
+package indexer
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// localIDPrefix starts the ids of documents generated under IngestLocal,
+// so a later local run can delete the summaries of modules that are gone
+// without touching documents an agent wrote.
+const localIDPrefix = "local:"
+
+// localModuleDepth is how many directory levels name a module in local
+// summaries: "internal/auth/jwt/token.go" belongs to "internal/auth".
+const localModuleDepth = 2
+
+// localMaxFiles caps the files listed in a local module summary.
+const localMaxFiles = 40
+
+// localDescriptionChars caps the README or package doc excerpt quoted in a
+// local summary.
+const localDescriptionChars = 1500
+
+// localMaxFileBytes caps the files stored under Options.LocalFiles; larger
+// ones are mostly generated code or data.
+const localMaxFileBytes = 256 << 10
+
+// readmeNames are the files a local summary quotes its description from,
+// in order of preference.
+var readmeNames = []string{"README.md", "README", "README.rst", "README.txt", "readme.md"}
+
+// localModule is a directory summarized under IngestLocal.
+type localModule struct {
+	dir     string
+	files   []string
+	subdirs map[string]bool
+}
+
+// localDocuments generates, without an agent, a repo_overview document and
+// one module_summary per directory up to localModuleDepth from the repo's
+// tracked files, leaving out exclusions and redacted files. Descriptions
+// are quoted from READMEs and Go package comments. With Options.LocalFiles
+// every text file is added whole as a source_file document.
+func (ix *indexer) localDocuments(
+	ctx context.Context, m *indexManifest, repoDir string, redact redaction,
+) ([]ingestRecord, error) {
+	names, err := trackedFiles(ctx, repoDir)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		files   []string
+		modules = make(map[string]*localModule)
+	)
+	for _, name := range names {
+		if excludedPath(name, m.Exclusions) || redact.matchesPath(name) ||
+			redact.matchesContent(filepath.Join(repoDir, filepath.FromSlash(name))) {
+			continue
+		}
+		files = append(files, name)
+		dir := path.Dir(name)
+		if dir == "." {
+			continue
+		}
+		parts := strings.Split(dir, "/")
+		module := strings.Join(parts[:min(len(parts), localModuleDepth)], "/")
+		mod, ok := modules[module]
+		if !ok {
+			mod = &localModule{dir: module, subdirs: make(map[string]bool)}
+			modules[module] = mod
+		}
+		mod.files = append(mod.files, name)
+		if len(parts) > localModuleDepth {
+			mod.subdirs[parts[localModuleDepth]] = true
+		}
+	}
+
+	recs := []ingestRecord{ix.localOverview(m, repoDir, files)}
+	for _, dir := range slices.Sorted(maps.Keys(modules)) {
+		recs = append(recs, ix.localModuleSummary(m, repoDir, modules[dir]))
+	}
+	if ix.opts.LocalFiles {
+		for _, name := range files {
+			if rec, ok := ix.localFile(m, repoDir, name); ok {
+				recs = append(recs, rec)
+			}
+		}
+	}
+	return recs, nil
+}
+
+// localFile returns the source_file document of a tracked file, unless it
+// is binary or larger than localMaxFileBytes.
+func (ix *indexer) localFile(m *indexManifest, repoDir, name string) (ingestRecord, bool) {
+	path := filepath.Join(repoDir, filepath.FromSlash(name))
+	if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() || info.Size() > localMaxFileBytes {
+		return ingestRecord{}, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || len(bytes.TrimSpace(data)) == 0 || bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data) {
+		return ingestRecord{}, false
+	}
+	md := map[string]any{"kind": "source_file", "path": name}
+	if lang := dominantLanguage([]string{name}); lang != "" {
+		md["language"] = lang
+	}
+	return ix.localRecord(m, localIDPrefix+"file:"+name, fmt.Sprintf("# %s\n\n%s", name, data), md), true
+}
+
+func (ix *indexer) localOverview(m *indexManifest, repoDir string, files []string) ingestRecord {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", m.Repo.Name)
+	fmt.Fprintf(&b, "Repository %s", m.Repo.Name)
+	if m.Repo.RemoteURL != "" {
+		fmt.Fprintf(&b, " (%s)", m.Repo.RemoteURL)
+	}
+	if m.Commit != nil {
+		fmt.Fprintf(&b, " at commit %s", shortCommit(m.Commit.SHA))
+		if m.Commit.Subject != "" {
+			fmt.Fprintf(&b, " (%q)", m.Commit.Subject)
+		}
+	}
+	fmt.Fprintf(&b, ": %d tracked files. Summarized by ai-indexer from the repo's files, without an agent.\n", len(files))
+	if len(m.Languages) > 0 {
+		langs := make([]string, len(m.Languages))
+		for i, l := range m.Languages {
+			langs[i] = fmt.Sprintf("%s (%d files)", l.Name, l.Files)
+		}
+		fmt.Fprintf(&b, "\nLanguages: %s.\n", strings.Join(langs, ", "))
+	}
+	if desc := readmeExcerpt(repoDir, "", files); desc != "" {
+		fmt.Fprintf(&b, "\n%s\n", desc)
+	}
+
+	top := make(map[string]int)
+	for _, name := range files {
+		first, _, nested := strings.Cut(name, "/")
+		if nested {
+			top[first+"/"]++
+		} else {
+			top[first] = 0
+		}
+	}
+	b.WriteString("\nLayout:\n")
+	for _, name := range slices.Sorted(maps.Keys(top)) {
+		if n := top[name]; n > 0 {
+			fmt.Fprintf(&b, "- %s (%d files)\n", name, n)
+		} else {
+			fmt.Fprintf(&b, "- %s\n", name)
+		}
+	}
+
+	md := map[string]any{"kind": "repo_overview", "path": "ROOT"}
+	if len(m.Languages) > 0 {
+		md["language"] = m.Languages[0].Name
+	}
+	return ix.localRecord(m, localIDPrefix+"overview", b.String(), md)
+}
+
+func (ix *indexer) localModuleSummary(m *indexManifest, repoDir string, mod *localModule) ingestRecord {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", mod.dir)
+	fmt.Fprintf(&b, "Module %s of %s, summarized by ai-indexer from its files, without an agent.\n", mod.dir, m.Repo.Name)
+	desc := readmeExcerpt(repoDir, mod.dir, mod.files)
+	if desc == "" {
+		desc = goPackageDoc(repoDir, mod.dir, mod.files)
+	}
+	if desc != "" {
+		fmt.Fprintf(&b, "\n%s\n", desc)
+	}
+
+	lang := dominantLanguage(mod.files)
+	b.WriteString("\n")
+	if lang != "" {
+		fmt.Fprintf(&b, "Language: %s. ", lang)
+	}
+	listed := mod.files[:min(len(mod.files), localMaxFiles)]
+	rel := make([]string, len(listed))
+	for i, name := range listed {
+		rel[i] = strings.TrimPrefix(name, mod.dir+"/")
+	}
+	fmt.Fprintf(&b, "%d files: %s", len(mod.files), strings.Join(rel, ", "))
+	if more := len(mod.files) - len(listed); more > 0 {
+		fmt.Fprintf(&b, ", and %d more", more)
+	}
+	b.WriteString(".\n")
+	if len(mod.subdirs) > 0 {
+		fmt.Fprintf(&b, "Subdirectories: %s.\n", strings.Join(slices.Sorted(maps.Keys(mod.subdirs)), ", "))
+	}
+
+	md := map[string]any{"kind": "module_summary", "path": mod.dir}
+	if lang != "" {
+		md["language"] = lang
+	}
+	return ix.localRecord(m, localIDPrefix+"module:"+mod.dir, b.String(), md)
+}
+
+// localRecord stamps md. Documents over Options.MaxDocChars are chunked
+// when they are stored.
+func (ix *indexer) localRecord(m *indexManifest, id, document string, md map[string]any) ingestRecord {
+	stampMetadata(md, m)
+	return ingestRecord{ID: id, Document: document, Metadata: md}
+}
+
+// localPrunes returns the ids of locally generated documents in stored
+// that this run did not generate again.
+func localPrunes(stored documentSnapshot, generated []ingestRecord) []string {
+	keep := make(map[string]bool, len(generated))
+	for _, rec := range generated {
+		keep[rec.ID] = true
+	}
+	var prunes []string
+	for id := range stored {
+		if strings.HasPrefix(id, localIDPrefix) && !keep[id] {
+			prunes = append(prunes, id)
+		}
+	}
+	slices.Sort(prunes)
+	return prunes
+}
+
+// excludedPath reports whether name is under one of the manifest's
+// exclusions: a name without a slash matches that directory at any depth,
+// and a path matches itself and everything under it.
+func excludedPath(name string, exclusions []string) bool {
+	for _, e := range exclusions {
+		e = strings.Trim(e, "/")
+		if e == "" {
+			continue
+		}
+		if name == e || strings.HasPrefix(name, e+"/") {
+			return true
+		}
+		if !strings.Contains(e, "/") && slices.Contains(strings.Split(path.Dir(name), "/"), e) {
+			return true
+		}
+	}
+	return false
+}
+
+// dominantLanguage is the most common language among files.
+func dominantLanguage(files []string) string {
+	counts := make(map[string]int)
+	for _, name := range files {
+		if lang, ok := languageByExt[strings.ToLower(path.Ext(name))]; ok {
+			counts[lang]++
+		}
+	}
+	var best string
+	for lang, n := range counts {
+		if best == "" || cmp.Or(counts[best]-n, strings.Compare(lang, best)) < 0 {
+			best = lang
+		}
+	}
+	return best
+}
+
+// readmeExcerpt returns the opening paragraphs of the README directly in
+// dir, one of files, without headings, images, or HTML, up to
+// localDescriptionChars.
+func readmeExcerpt(repoDir, dir string, files []string) string {
+	for _, name := range readmeNames {
+		rel := path.Join(dir, name)
+		if !slices.Contains(files, rel) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(repoDir, filepath.FromSlash(rel)))
+		if err != nil {
+			continue
+		}
+		var paras []string
+		size := 0
+		for para := range strings.SplitSeq(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n\n") {
+			para = strings.TrimSpace(para)
+			if para == "" || strings.HasPrefix(para, "#") || strings.HasPrefix(para, "<") ||
+				strings.HasPrefix(para, "![") || strings.HasPrefix(para, "[![") || strings.HasPrefix(para, "```") {
+				continue
+			}
+			if size+len(para) > localDescriptionChars {
+				if len(paras) == 0 {
+					paras = append(paras, truncateRunes(para, localDescriptionChars))
+				}
+				break
+			}
+			paras = append(paras, para)
+			size += len(para)
+		}
+		return strings.Join(paras, "\n\n")
+	}
+	return ""
+}
+
+// goPackageDoc returns the "// Package" comment of the first Go file
+// directly in dir that has one, preferring doc.go.
+func goPackageDoc(repoDir, dir string, files []string) string {
+	var candidates []string
+	for _, name := range files {
+		if path.Dir(name) == dir && strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go") {
+			candidates = append(candidates, name)
+		}
+	}
+	if i := slices.IndexFunc(candidates, func(name string) bool { return path.Base(name) == "doc.go" }); i > 0 {
+		candidates[0], candidates[i] = candidates[i], candidates[0]
+	}
+	for _, name := range candidates {
+		if doc := packageComment(filepath.Join(repoDir, filepath.FromSlash(name))); doc != "" {
+			return truncateRunes(doc, localDescriptionChars)
+		}
+	}
+	return ""
+}
+
+// packageComment reads the line comment starting "// Package" in file.
+func packageComment(file string) string {
+	f, err := os.Open(file)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	var lines []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case strings.HasPrefix(line, "// Package "):
+			lines = []string{strings.TrimPrefix(line, "// ")}
+		case len(lines) > 0 && strings.HasPrefix(line, "//"):
+			lines = append(lines, strings.TrimSpace(strings.TrimPrefix(line, "//")))
+		case len(lines) > 0:
+			return strings.Join(lines, " ")
+		case strings.HasPrefix(line, "package "):
+			return ""
+		}
+	}
+	return strings.Join(lines, " ")
+}
+
+// truncateRunes cuts s to at most n runes.
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
@@ -0,0 +1,153 @@
+package indexer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// runLockInfo is written into a lock file so a blocked run can say who
+// holds it.
+type runLockInfo struct {
+	StartedAt time.Time `json:"started_at"`
+	Key       string    `json:"key"`
+	PID       int       `json:"pid"`
+}
+
+// runLock is an exclusive lock on a lock file, held for the duration of a
+// run. The lock belongs to the open file, so the system releases it when
+// the holder exits; the file itself is never removed, which would let a
+// run lock a file another run has already replaced.
+type runLock struct {
+	f *os.File
+}
+
+// errLockHeld is returned by lockFile when another open file holds the
+// lock.
+var errLockHeld = errors.New("lock held")
+
+// runLockPath returns the lock file guarding key (a root directory or cache
+// path) of the given kind in the system temp directory.
+func runLockPath(kind, key string) string {
+	sum := sha256.Sum256([]byte(kind + "\x00" + key))
+	return filepath.Join(os.TempDir(), "ai-indexer-"+hex.EncodeToString(sum[:8])+".lock")
+}
+
+// acquireRunLock takes the lock for key, failing fast when another run
+// holds it, and records this process in the lock file.
+func acquireRunLock(kind, key string) (*runLock, error) {
+	path := runLockPath(kind, key)
+	info := runLockInfo{
+		StartedAt: time.Now().UTC(),
+		Key:       key,
+		PID:       os.Getpid(),
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return nil, fmt.Errorf("encode run lock: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open run lock %s: %w", path, err)
+	}
+	if err := lockFile(f); err != nil {
+		closeErr := f.Close()
+		if !errors.Is(err, errLockHeld) {
+			return nil, errors.Join(fmt.Errorf("take run lock %s: %w", path, err), closeErr)
+		}
+		held := &runLockHeld{kind: kind, key: key, path: path}
+		if holder, err := readRunLock(path); err == nil {
+			held.holder = &holder
+		}
+		return nil, held
+	}
+	if err := f.Truncate(0); err != nil {
+		return nil, errors.Join(fmt.Errorf("write run lock %s: %w", path, err), f.Close())
+	}
+	if _, err := f.WriteAt(data, 0); err != nil {
+		return nil, errors.Join(fmt.Errorf("write run lock %s: %w", path, err), f.Close())
+	}
+	return &runLock{f: f}, nil
+}
+
+// runLockHeld reports that another live process holds a run lock.
+type runLockHeld struct {
+	// holder is nil when the lock file could not be read.
+	holder *runLockInfo
+	kind   string
+	key    string
+	path   string
+}
+
+func (e *runLockHeld) Error() string {
+	if e.holder == nil {
+		return fmt.Sprintf("%s %s is locked by another run (lock file %s)", e.kind, e.key, e.path)
+	}
+	return fmt.Sprintf("%s %s is locked by another run (pid %d, started %s)",
+		e.kind, e.key, e.holder.PID, e.holder.StartedAt.Local().Format(time.DateTime))
+}
+
+func readRunLock(path string) (runLockInfo, error) {
+	var info runLockInfo
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return info, fmt.Errorf("read run lock: %w", err)
+	}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return info, fmt.Errorf("decode run lock: %w", err)
+	}
+	return info, nil
+}
+
+// Release unlocks the lock file, leaving it in place. A nil lock is a
+// no-op.
+func (l *runLock) Release() error {
+	if l == nil {
+		return nil
+	}
+	if err := l.f.Close(); err != nil {
+		return fmt.Errorf("release run lock: %w", err)
+	}
+	return nil
+}
+
+// acquireRunLocks locks the root directory and the commit cache, each when
+// set, so concurrent runs sharing either fail fast. The returned func
+// releases every lock taken.
+func acquireRunLocks(rootDir, cachePath string) (func() error, error) {
+	type lockKey struct{ kind, key string }
+	var keys []lockKey
+	if rootDir != "" {
+		keys = append(keys, lockKey{kind: "root directory", key: rootDir})
+	}
+	if cachePath != "" {
+		absCache, err := filepath.Abs(cachePath)
+		if err != nil {
+			return nil, fmt.Errorf("resolve cache path: %w", err)
+		}
+		keys = append(keys, lockKey{kind: "commit cache", key: absCache})
+	}
+
+	var locks []*runLock
+	release := func() error {
+		var errs []error
+		for _, l := range locks {
+			errs = append(errs, l.Release())
+		}
+		return errors.Join(errs...)
+	}
+	for _, k := range keys {
+		l, err := acquireRunLock(k.kind, k.key)
+		if err != nil {
+			return nil, errors.Join(err, release())
+		}
+		locks = append(locks, l)
+	}
+	return release, nil
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package indexer
+
+import "os"
+
+// lockFile is a no-op where flock does not exist; runs there are not
+// locked against each other.
+func lockFile(*os.File) error {
+	return nil
+}
@@ -0,0 +1,66 @@
+package indexer
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcquireRunLocks(t *testing.T) {
+	rootDir := t.TempDir()
+	cachePath := filepath.Join(rootDir, "cache.json")
+
+	release, err := acquireRunLocks(rootDir, cachePath)
+	if err != nil {
+		t.Fatalf("acquire locks: %v", err)
+	}
+
+	if _, err := acquireRunLocks(rootDir, ""); err == nil || !strings.Contains(err.Error(), "root directory") {
+		t.Fatalf("expected root directory lock conflict, got %v", err)
+	}
+	if _, err := acquireRunLocks(t.TempDir(), cachePath); err == nil || !strings.Contains(err.Error(), "commit cache") {
+		t.Fatalf("expected commit cache lock conflict, got %v", err)
+	}
+
+	if err := release(); err != nil {
+		t.Fatalf("release locks: %v", err)
+	}
+	release, err = acquireRunLocks(rootDir, cachePath)
+	if err != nil {
+		t.Fatalf("reacquire locks: %v", err)
+	}
+	if err := release(); err != nil {
+		t.Fatalf("release locks: %v", err)
+	}
+}
+
+func TestAcquireRunLockStale(t *testing.T) {
+	key := t.TempDir()
+	path := runLockPath("root directory", key)
+	t.Cleanup(func() { os.Remove(path) })
+
+	data, err := json.Marshal(runLockInfo{StartedAt: time.Now(), Key: key, PID: 0})
+	if err != nil {
+		t.Fatalf("encode lock: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("write stale lock: %v", err)
+	}
+
+	lock, err := acquireRunLock("root directory", key)
+	if err != nil {
+		t.Fatalf("expected stale lock to be replaced: %v", err)
+	}
+	if holder, err := readRunLock(path); err != nil || holder.PID != os.Getpid() {
+		t.Fatalf("expected the lock file to name this process, got %+v (%v)", holder, err)
+	}
+	if err := lock.Release(); err != nil {
+		t.Fatalf("release lock: %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("expected the lock file kept after release: %v", err)
+	}
+}
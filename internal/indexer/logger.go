@@ -0,0 +1,91 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// repoLogger writes one repo's progress lines. It is carried through
+// processRepo in the context so every step logs with the same fields, and
+// it is the single place repo output passes through.
+type repoLogger struct {
+	ix *indexer
+	// path is the checkout being processed; slug is its collection and can
+	// change once the slug map is consulted.
+	path string
+	slug string
+	mu   sync.Mutex
+	// worker is the 1-based worker running the repo; 0 outside a pool.
+	worker int
+	// artifact names the repo's log and reports under --artifacts-dir, and
+	// file is that log; both are empty without one.
+	artifact string
+	file     io.Writer
+}
+
+type repoLoggerKey struct{}
+
+// withRepoLogger returns ctx carrying log.
+func withRepoLogger(ctx context.Context, log *repoLogger) context.Context {
+	return context.WithValue(ctx, repoLoggerKey{}, log)
+}
+
+// log returns the repo logger carried by ctx, or one without repo fields.
+func (ix *indexer) log(ctx context.Context) *repoLogger {
+	if log, ok := ctx.Value(repoLoggerKey{}).(*repoLogger); ok {
+		return log
+	}
+	return &repoLogger{ix: ix}
+}
+
+// setSlug records the collection the repo resolved to.
+func (l *repoLogger) setSlug(slug string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.slug = slug
+}
+
+// prefix tags lines with the slug and worker when several repos can log at
+// once, so interleaved output stays attributable.
+func (l *repoLogger) prefix() string {
+	if l.worker == 0 || l.ix.opts.Parallel <= 1 {
+		return ""
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return fmt.Sprintf("[%s w%d] ", l.slug, l.worker)
+}
+
+// header prints the banner that starts the repo's output.
+func (l *repoLogger) header() {
+	l.ix.outln("")
+	l.ix.outln(l.prefix() + colorize(colorMagenta, "==> %s", l.path))
+	l.ix.outln(l.prefix() + colorize(colorMuted, "    collection: %s", l.slug))
+	l.record("==> " + l.path)
+	l.record("    collection: " + l.slug)
+}
+
+func (l *repoLogger) infof(format string, args ...any) {
+	l.ix.outln(l.prefix() + colorize(colorBlue, "    - %s", fmt.Sprintf(format, args...)))
+	l.record("    - " + fmt.Sprintf(format, args...))
+}
+
+func (l *repoLogger) warnf(format string, args ...any) {
+	l.ix.outln(l.prefix() + colorize(colorYellow, "    ! %s", fmt.Sprintf(format, args...)))
+	l.record("    ! " + fmt.Sprintf(format, args...))
+}
+
+// record appends an uncolored line to the repo's log, when it has one.
+func (l *repoLogger) record(line string) {
+	if l.file != nil {
+		fmt.Fprintln(l.file, time.Now().UTC().Format(time.RFC3339)+" "+line)
+	}
+}
+
+// done ends the repo's output with a blank line.
+func (l *repoLogger) done() {
+	l.ix.outln("")
+}
@@ -0,0 +1,58 @@
+package indexer
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRepoLogger(t *testing.T) {
+	lines := colorize(colorBlue, "    - fetching") + "\n" + colorize(colorYellow, "    ! slow") + "\n"
+	tests := map[string]struct {
+		parallel int
+		worker   int
+		want     string
+	}{
+		"sequential": {
+			parallel: 1,
+			want:     lines,
+		},
+		"pool of one": {
+			parallel: 1,
+			worker:   1,
+			want:     lines,
+		},
+		"parallel worker": {
+			parallel: 4,
+			worker:   2,
+			want: "[platform_api w2] " + colorize(colorBlue, "    - fetching") + "\n" +
+				"[platform_api w2] " + colorize(colorYellow, "    ! slow") + "\n",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			ix := newIndexer(&out, &out, nil, nil, Options{Parallel: tc.parallel})
+			ctx := withRepoLogger(t.Context(), &repoLogger{ix: ix, worker: tc.worker})
+
+			log := ix.log(ctx)
+			log.setSlug("services_api")
+			log.setSlug("platform_api")
+			ix.log(ctx).infof("fetching")
+			ix.log(ctx).warnf("slow")
+
+			if got := out.String(); got != tc.want {
+				t.Fatalf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRepoLoggerWithoutContext(t *testing.T) {
+	var out bytes.Buffer
+	ix := newIndexer(&out, &out, nil, nil, Options{Parallel: 4})
+	ix.log(t.Context()).infof("hello")
+	if got := out.String(); got != colorize(colorBlue, "    - hello")+"\n" {
+		t.Fatalf("expected an unprefixed line, got %q", got)
+	}
+}
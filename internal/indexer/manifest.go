@@ -0,0 +1,403 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// manifestEnvVar points Codex at the run's input manifest.
+const manifestEnvVar = "INDEX_MANIFEST_PATH"
+
+// Manifest indexing modes.
+const (
+	manifestModeFull        = "full"
+	manifestModeIncremental = "incremental"
+)
+
+// manifestMaxLanguages caps the languages listed in a manifest.
+const manifestMaxLanguages = 10
+
+// defaultExclusions are paths Codex should ignore or downweight in every
+// repo; RepoConfig.Exclude adds to them.
+var defaultExclusions = []string{
+	".git", ".github", ".idea", ".vscode",
+	"node_modules", "target", "dist", "build", "out",
+	"vendor", ".venv", ".tox", "coverage",
+}
+
+// languageByExt maps file extensions to the language reported in manifests.
+var languageByExt = map[string]string{
+	".go":    "Go",
+	".py":    "Python",
+	".js":    "JavaScript",
+	".jsx":   "JavaScript",
+	".mjs":   "JavaScript",
+	".ts":    "TypeScript",
+	".tsx":   "TypeScript",
+	".rs":    "Rust",
+	".java":  "Java",
+	".kt":    "Kotlin",
+	".scala": "Scala",
+	".rb":    "Ruby",
+	".php":   "PHP",
+	".cs":    "C#",
+	".c":     "C",
+	".h":     "C",
+	".cc":    "C++",
+	".cpp":   "C++",
+	".hpp":   "C++",
+	".swift": "Swift",
+	".m":     "Objective-C",
+	".sh":    "Shell",
+	".sql":   "SQL",
+	".proto": "Protocol Buffers",
+	".tf":    "HCL",
+	".lua":   "Lua",
+	".ex":    "Elixir",
+	".exs":   "Elixir",
+	".erl":   "Erlang",
+	".hs":    "Haskell",
+	".clj":   "Clojure",
+	".dart":  "Dart",
+	".vue":   "Vue",
+	".zig":   "Zig",
+}
+
+// indexManifest is the JSON document handed to Codex via
+// INDEX_MANIFEST_PATH describing what to index.
+type indexManifest struct {
+	// Commit is the commit being indexed; Base is the previously indexed
+	// commit for incremental runs.
+	Commit *manifestCommit `json:"commit,omitempty"`
+	Base   *manifestCommit `json:"base,omitempty"`
+	// DiffTruncated is set when Diff was cut to fit the prompt budget; see
+	// truncateDiff.
+	DiffTruncated *diffTruncation `json:"diff_truncated,omitempty"`
+	// Pass is the pipeline pass being run, when passes are configured.
+	Pass *manifestPass `json:"pass,omitempty"`
+	// Onboarding requests a human-readable onboarding document.
+	Onboarding *manifestOnboarding `json:"onboarding,omitempty"`
+	// Expertise summarizes recent contributors per directory, under
+	// --expertise.
+	Expertise *manifestExpertise `json:"expertise,omitempty"`
+	// Infra lists infrastructure as code, under --profile infra.
+	Infra *manifestInfra `json:"infra,omitempty"`
+	// Changelog lists recent merges and release tags, under --changelog.
+	Changelog *manifestChangelog `json:"changelog,omitempty"`
+	// Issues points at GitHub issues and pull requests, under
+	// --github-issues.
+	Issues *manifestIssues `json:"issues,omitempty"`
+	// CI lists CI configuration files, under --ci-pipelines.
+	CI []ciConfig `json:"ci,omitempty"`
+	// Schema lists database schema sources, under --data-model.
+	Schema *manifestSchema `json:"schema,omitempty"`
+	// Dependencies points at the generated dependency inventory, under
+	// --dependencies.
+	Dependencies *manifestDependencies `json:"dependencies,omitempty"`
+	// Limits caps document size and count, under --max-doc-chars and
+	// --docs-per-module.
+	Limits *manifestLimits `json:"limits,omitempty"`
+	// Output is the file the agent writes documents to instead of the
+	// store, under --ingest direct.
+	Output *manifestOutput `json:"output,omitempty"`
+	// Forbidden lists files matching the config's redact rules, which are
+	// also left out of Diff.
+	Forbidden *manifestForbidden `json:"forbidden,omitempty"`
+	// issueContext is written to Issues.File.
+	issueContext *githubContext
+	// dependencyDocument is written to Dependencies.File.
+	dependencyDocument *dependencyDocument
+	// Collection is the exact Chroma collection name to write to.
+	Collection string `json:"collection"`
+	// Mode is "full" or "incremental".
+	Mode string `json:"mode"`
+	// Version is the release tag under --on-new-tag.
+	Version string `json:"version,omitempty"`
+	// IndexerVersion identifies the ai-indexer build, for provenance.
+	IndexerVersion string `json:"indexer_version"`
+	// RunID identifies the indexer run; Codex stamps it on every document.
+	RunID string `json:"run_id"`
+	// Scratch is Codex's writable directory when the repo is mounted
+	// read-only, under --read-only-worktree.
+	Scratch string `json:"scratch,omitempty"`
+	// Diff lists files changed since Base, for incremental runs.
+	Diff []diffEntry `json:"diff,omitempty"`
+	// fullDiff is the untruncated Diff, written to DiffTruncated.File.
+	fullDiff []diffEntry
+	// Languages are the repo's most common languages by file count.
+	Languages []languageStat `json:"languages,omitempty"`
+	// Tags are the repo's config tags, added to every document's tags.
+	Tags []string `json:"tags,omitempty"`
+	// Exclusions are paths to ignore or downweight.
+	Exclusions []string     `json:"exclusions"`
+	Repo       manifestRepo `json:"repo"`
+}
+
+// manifestLimits are store limits Codex must respect; zero fields are
+// unset.
+type manifestLimits struct {
+	MaxDocChars   int `json:"max_doc_chars,omitempty"`
+	DocsPerModule int `json:"docs_per_module,omitempty"`
+}
+
+type manifestRepo struct {
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	RemoteURL string `json:"remote_url,omitempty"`
+	Branch    string `json:"branch,omitempty"`
+}
+
+type manifestCommit struct {
+	SHA     string `json:"sha"`
+	Author  string `json:"author,omitempty"`
+	Date    string `json:"date,omitempty"`
+	Subject string `json:"subject,omitempty"`
+}
+
+// diffEntry is one changed file. Status is git's name-status letter (A, M,
+// D, R, C, or T); OldPath is set for renames and copies.
+type diffEntry struct {
+	Path    string `json:"path"`
+	OldPath string `json:"old_path,omitempty"`
+	Status  string `json:"status"`
+}
+
+type languageStat struct {
+	Name  string `json:"name"`
+	Files int    `json:"files"`
+}
+
+// buildManifest assembles the manifest for indexing indexDir into slug.
+// Commit details and languages are best effort; lookups that fail are left
+// out rather than failing the repo.
+func (ix *indexer) buildManifest(
+	ctx context.Context,
+	result *RepoResult,
+	indexDir, slug, baseCommit, branch string,
+	diff []diffEntry,
+	settings repoSettings,
+) *indexManifest {
+	m := &indexManifest{
+		Collection:     slug,
+		Mode:           manifestModeFull,
+		Version:        result.Version,
+		Diff:           diff,
+		IndexerVersion: ReadBuildInfo().String(),
+		RunID:          ix.runID,
+		Exclusions:     slices.Concat(defaultExclusions, settings.exclude),
+		Tags:           settings.tags,
+		Repo: manifestRepo{
+			Name:      filepath.Base(result.Path),
+			Path:      result.Path,
+			RemoteURL: settings.remote,
+			Branch:    branch,
+		},
+	}
+	if baseCommit != "" {
+		m.Mode = manifestModeIncremental
+		m.Base = describeCommit(ctx, indexDir, baseCommit)
+	}
+	if result.IndexedCommit != "" {
+		m.Commit = describeCommit(ctx, indexDir, result.IndexedCommit)
+	}
+	m.Languages = detectLanguages(ctx, indexDir)
+	if ix.opts.MaxDocChars > 0 || ix.opts.DocsPerModule > 0 {
+		m.Limits = &manifestLimits{MaxDocChars: ix.opts.MaxDocChars, DocsPerModule: ix.opts.DocsPerModule}
+	}
+	if ix.opts.Profile == ProfileInfra {
+		m.Infra = detectInfra(ctx, indexDir)
+	}
+	if ix.opts.Expertise {
+		m.Expertise = collectExpertise(ctx, indexDir, ix.opts.ExpertiseSince)
+	}
+	if ix.opts.Changelog {
+		m.Changelog = collectChangelog(ctx, indexDir, ix.opts.ChangelogMonths)
+	}
+	if ix.opts.CIPipelines {
+		m.CI = detectCI(ctx, indexDir)
+	}
+	if ix.opts.DataModel {
+		m.Schema = detectSchema(ctx, indexDir)
+	}
+	return m
+}
+
+// write stores the manifest as a temp file under dir and returns its path.
+// A truncated diff's complete list, fetched GitHub issues, and the
+// dependency inventory are written first to their own temp files, named by
+// DiffTruncated.File, Issues.File, and Dependencies.File; remove deletes
+// them all.
+func (m *indexManifest) write(dir string) (string, error) {
+	if m.DiffTruncated != nil {
+		diffPath, err := writeTempJSON(dir, "ai-indexer-diff-*.json", m.fullDiff)
+		if err != nil {
+			return "", fmt.Errorf("write full diff: %w", err)
+		}
+		m.DiffTruncated.File = diffPath
+	}
+	if m.Issues != nil {
+		issuesPath, err := writeTempJSON(dir, "ai-indexer-issues-*.json", m.issueContext)
+		if err != nil {
+			return "", fmt.Errorf("write issues: %w", err)
+		}
+		m.Issues.File = issuesPath
+	}
+	if m.Dependencies != nil {
+		depsPath, err := writeTempJSON(dir, "ai-indexer-dependencies-*.json", m.dependencyDocument)
+		if err != nil {
+			return "", fmt.Errorf("write dependencies: %w", err)
+		}
+		m.Dependencies.File = depsPath
+	}
+	path, err := writeTempJSON(dir, "ai-indexer-manifest-*.json", m)
+	if err != nil {
+		return "", fmt.Errorf("write manifest: %w", err)
+	}
+	return path, nil
+}
+
+// remove deletes the manifest at path and its full diff, issues, and
+// dependencies files, if any.
+func (m *indexManifest) remove(path string) error {
+	err := os.Remove(path)
+	if m.DiffTruncated != nil && m.DiffTruncated.File != "" {
+		err = errors.Join(err, os.Remove(m.DiffTruncated.File))
+	}
+	if m.Issues != nil && m.Issues.File != "" {
+		err = errors.Join(err, os.Remove(m.Issues.File))
+	}
+	if m.Dependencies != nil && m.Dependencies.File != "" {
+		err = errors.Join(err, os.Remove(m.Dependencies.File))
+	}
+	return err
+}
+
+// writeTempJSON encodes v into a new temp file under dir named by pattern.
+func writeTempJSON(dir, pattern string, v any) (string, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("encode: %w", err)
+	}
+	f, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return "", fmt.Errorf("create: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return "", fmt.Errorf("write: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("close: %w", err)
+	}
+	return f.Name(), nil
+}
+
+// describeCommit returns sha's author, date, and subject, or just the sha
+// when git cannot describe it.
+func describeCommit(ctx context.Context, repoDir, sha string) *manifestCommit {
+	c := &manifestCommit{SHA: sha}
+	cmd := exec.CommandContext(ctx, "git", "-C", repoDir, "log", "-1", "--format=%an%x00%aI%x00%s", sha)
+	out, err := procOutput(ctx, cmd)
+	if err != nil {
+		return c
+	}
+	if parts := strings.SplitN(strings.TrimSpace(string(out)), "\x00", 3); len(parts) == 3 {
+		c.Author, c.Date, c.Subject = parts[0], parts[1], parts[2]
+	}
+	return c
+}
+
+// diffEntriesBetween lists files changed between baseCommit and target with
+// their name-status, following renames.
+func diffEntriesBetween(ctx context.Context, repoDir, baseCommit, target string) ([]diffEntry, error) {
+	if baseCommit == "" {
+		return nil, errors.New("base commit is required to compute a diff")
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "-C", repoDir, "diff", "--name-status", "-M", "-z", baseCommit, target)
+	out, err := procOutput(ctx, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("git diff --name-status %s %s: %w", baseCommit, target, err)
+	}
+
+	fields := bytes.Split(bytes.TrimSuffix(out, []byte{0}), []byte{0})
+	var entries []diffEntry
+	for i := 0; i < len(fields) && len(fields[i]) > 0; {
+		status := string(fields[i][:1])
+		switch status {
+		case "R", "C":
+			if i+2 >= len(fields) {
+				return entries, fmt.Errorf("truncated git diff output for %s", status)
+			}
+			entries = append(entries, diffEntry{
+				Path:    string(fields[i+2]),
+				OldPath: string(fields[i+1]),
+				Status:  status,
+			})
+			i += 3
+		default:
+			if i+1 >= len(fields) {
+				return entries, fmt.Errorf("truncated git diff output for %s", status)
+			}
+			entries = append(entries, diffEntry{Path: string(fields[i+1]), Status: status})
+			i += 2
+		}
+	}
+	return entries, nil
+}
+
+// diffPaths returns the current path of each entry.
+func diffPaths(entries []diffEntry) []string {
+	paths := make([]string, 0, len(entries))
+	for _, e := range entries {
+		paths = append(paths, e.Path)
+	}
+	return paths
+}
+
+// detectLanguages counts tracked files per language, most common first.
+func detectLanguages(ctx context.Context, repoDir string) []languageStat {
+	cmd := exec.CommandContext(ctx, "git", "-C", repoDir, "ls-files", "-z")
+	out, err := procOutput(ctx, cmd)
+	if err != nil {
+		return nil
+	}
+
+	counts := make(map[string]int)
+	for name := range bytes.SplitSeq(out, []byte{0}) {
+		if lang, ok := languageByExt[strings.ToLower(filepath.Ext(string(name)))]; ok {
+			counts[lang]++
+		}
+	}
+	stats := make([]languageStat, 0, len(counts))
+	for name, files := range counts {
+		stats = append(stats, languageStat{Name: name, Files: files})
+	}
+	slices.SortFunc(stats, func(a, b languageStat) int {
+		if a.Files != b.Files {
+			return b.Files - a.Files
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	if len(stats) > manifestMaxLanguages {
+		stats = stats[:manifestMaxLanguages]
+	}
+	return stats
+}
+
+// languageNames joins the manifest's language names for display.
+func (m *indexManifest) languageNames() string {
+	names := make([]string, 0, len(m.Languages))
+	for _, l := range m.Languages {
+		names = append(names, l.Name)
+	}
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,139 @@
+package indexer
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestBuildManifest(t *testing.T) {
+	repoDir := filepath.Join(t.TempDir(), "api")
+	initGitRepo(t, repoDir)
+	base, err := headCommit(t.Context(), repoDir)
+	if err != nil {
+		t.Fatalf("head commit: %v", err)
+	}
+	for _, name := range []string{"main.go", "util.go", "script.py"} {
+		if err := os.WriteFile(filepath.Join(repoDir, name), []byte("x\n"), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	if err := runGit(repoDir, "add", "."); err != nil {
+		t.Fatalf("git add: %v", err)
+	}
+	if err := runGit(repoDir, "commit", "-m", "add sources"); err != nil {
+		t.Fatalf("git commit: %v", err)
+	}
+	head, err := headCommit(t.Context(), repoDir)
+	if err != nil {
+		t.Fatalf("head commit: %v", err)
+	}
+	diff, err := diffEntriesBetween(t.Context(), repoDir, base, "HEAD")
+	if err != nil {
+		t.Fatalf("diff: %v", err)
+	}
+
+	ix := newIndexer(io.Discard, io.Discard, nil, nil, Options{TempDir: t.TempDir()})
+	result := &RepoResult{Path: repoDir, IndexedCommit: head, Version: "v1.2.0"}
+	settings := repoSettings{remote: "https://github.com/org/api.git", exclude: []string{"testdata"}}
+	m := ix.buildManifest(t.Context(), result, repoDir, "api", base, "trunk", diff, settings)
+
+	path, err := m.write(ix.tempDir())
+	if err != nil {
+		t.Fatalf("write manifest: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read manifest: %v", err)
+	}
+	var got indexManifest
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("decode manifest: %v", err)
+	}
+
+	if got.IndexerVersion != ReadBuildInfo().String() {
+		t.Fatalf("expected indexer version %q, got %q", ReadBuildInfo().String(), got.IndexerVersion)
+	}
+	if got.Collection != "api" || got.Mode != manifestModeIncremental || got.Version != "v1.2.0" {
+		t.Fatalf("unexpected header: %+v", got)
+	}
+	if got.Repo.Name != "api" || got.Repo.Branch != "trunk" || got.Repo.RemoteURL != settings.remote {
+		t.Fatalf("unexpected repo: %+v", got.Repo)
+	}
+	if got.Commit == nil || got.Commit.SHA != head || got.Commit.Subject != "add sources" {
+		t.Fatalf("unexpected commit: %+v", got.Commit)
+	}
+	if got.Base == nil || got.Base.SHA != base {
+		t.Fatalf("unexpected base: %+v", got.Base)
+	}
+	if len(got.Diff) != 3 || got.Diff[0].Status != "A" {
+		t.Fatalf("unexpected diff: %+v", got.Diff)
+	}
+	wantLangs := []languageStat{{Name: "Go", Files: 2}, {Name: "Python", Files: 1}}
+	if !slices.Equal(got.Languages, wantLangs) {
+		t.Fatalf("expected languages %v, got %v", wantLangs, got.Languages)
+	}
+	if !slices.Contains(got.Exclusions, "node_modules") || !slices.Contains(got.Exclusions, "testdata") {
+		t.Fatalf("expected default and configured exclusions, got %v", got.Exclusions)
+	}
+}
+
+func TestBuildManifestFullMode(t *testing.T) {
+	repoDir := filepath.Join(t.TempDir(), "repo")
+	initGitRepo(t, repoDir)
+
+	ix := newIndexer(io.Discard, io.Discard, nil, nil, Options{})
+	m := ix.buildManifest(t.Context(), &RepoResult{Path: repoDir}, repoDir, "repo", "", "", nil, repoSettings{})
+	if m.Mode != manifestModeFull || m.Base != nil || m.Commit != nil || len(m.Diff) != 0 {
+		t.Fatalf("expected full-mode manifest without commits, got %+v", m)
+	}
+}
+
+func TestBuildManifestLimits(t *testing.T) {
+	tests := map[string]struct {
+		opts Options
+		want *manifestLimits
+	}{
+		"unset":     {},
+		"doc chars": {opts: Options{MaxDocChars: 8000}, want: &manifestLimits{MaxDocChars: 8000}},
+		"both": {
+			opts: Options{MaxDocChars: 8000, DocsPerModule: 3},
+			want: &manifestLimits{MaxDocChars: 8000, DocsPerModule: 3},
+		},
+	}
+
+	repoDir := t.TempDir()
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ix := newIndexer(io.Discard, io.Discard, nil, nil, tc.opts)
+			m := ix.buildManifest(t.Context(), &RepoResult{Path: repoDir}, repoDir, "repo", "", "", nil, repoSettings{})
+			if (m.Limits == nil) != (tc.want == nil) || (m.Limits != nil && *m.Limits != *tc.want) {
+				t.Fatalf("expected limits %+v, got %+v", tc.want, m.Limits)
+			}
+		})
+	}
+}
+
+func TestRunResultsDocumentLimitsNegative(t *testing.T) {
+	tests := map[string]struct {
+		opts Options
+		want string
+	}{
+		"max doc chars":   {opts: Options{MaxDocChars: -1}, want: "max doc chars"},
+		"docs per module": {opts: Options{DocsPerModule: -1}, want: "docs per module"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			tc.opts.RootDir = t.TempDir()
+			_, err := RunResults(tc.opts)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("expected %s error, got %v", tc.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// MCPLister is implemented by agent backends whose CLI lists the MCP
+// servers configured for it. The MCP check uses it instead of asking the
+// agent a probe prompt.
+type MCPLister interface {
+	// MCPListArgs returns the arguments that print the configured MCP
+	// servers, one per line.
+	MCPListArgs() []string
+}
+
+func (codexBackend) MCPListArgs() []string  { return []string{"mcp", "list"} }
+func (claudeBackend) MCPListArgs() []string { return []string{"mcp", "list"} }
+func (geminiBackend) MCPListArgs() []string { return []string{"mcp", "list"} }
+
+// mcpCheckTimeout bounds the MCP check's agent command.
+const mcpCheckTimeout = 2 * time.Minute
+
+// Replies the MCP probe prompt asks for.
+const (
+	mcpProbeOK      = "CHROMA_MCP_OK"
+	mcpProbeMissing = "CHROMA_MCP_MISSING"
+)
+
+// mcpProbePrompt asks an agent without an MCPLister whether it has Chroma
+// tools, without letting it use them.
+const mcpProbePrompt = `Preflight check before indexing. Do not read or modify any files and do
+not call any tools. If you have a tool from a Chroma MCP server (a tool whose
+name contains "chroma"), reply with exactly ` + mcpProbeOK + `. Otherwise reply
+with exactly ` + mcpProbeMissing + `.`
+
+// checkAgentMCP confirms that the agent has a Chroma MCP server before any
+// repo is handed to it, so a missing server fails the run once instead of
+// failing every repo the same way. It returns a line describing the
+// server found.
+func (ix *indexer) checkAgentMCP(ctx context.Context, rootDir string) (string, error) {
+	agent := ix.opts.AgentBackend.Name()
+	lister, ok := ix.opts.AgentBackend.(MCPLister)
+	var args []string
+	step := "probe prompt"
+	if ok {
+		args = lister.MCPListArgs()
+		step = strings.Join(args, " ")
+	} else {
+		args, _ = ix.opts.AgentBackend.Args(rootDir, mcpProbePrompt, "")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, mcpCheckTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, ix.codexPath(), args...)
+	cmd.Dir = rootDir
+	cmd.Env = append(os.Environ(), ix.scratchEnv()...)
+	var out bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &out
+	runErr := procRun(ctx, cmd)
+	output := strings.TrimSpace(ix.masker.mask(out.String()))
+	if runErr != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return "", fmt.Errorf("mcp check: %s did not answer within %s", agent, mcpCheckTimeout)
+		}
+		return "", fmt.Errorf("mcp check: %s %s failed: %w: %s", agent, step, runErr,
+			truncateRunes(output, outputLineMax))
+	}
+
+	if !ok {
+		// The reply is the last line that is exactly one of the answers;
+		// agents that echo the prompt print both.
+		hasTools := false
+		for line := range strings.Lines(output) {
+			switch strings.Trim(strings.TrimSpace(line), "`*.") {
+			case mcpProbeOK:
+				hasTools = true
+			case mcpProbeMissing:
+				hasTools = false
+			}
+		}
+		if hasTools {
+			return fmt.Sprintf("MCP check: %s reports Chroma MCP tools", agent), nil
+		}
+		return "", fmt.Errorf("mcp check: %s reports no Chroma MCP tools; add a Chroma MCP server to its "+
+			"configuration or use --ingest direct or local", agent)
+	}
+	server, err := chromaMCPServer(output)
+	if err != nil {
+		return "", fmt.Errorf("mcp check: %s: %w; add a Chroma MCP server to its configuration or use "+
+			"--ingest direct or local", agent, err)
+	}
+	return fmt.Sprintf("MCP check: %s has Chroma MCP server %s", agent, server), nil
+}
+
+// chromaMCPServer finds the Chroma server in an agent's MCP server list,
+// matching "chroma" in its name or command. A server the agent reports it
+// could not connect to does not count.
+func chromaMCPServer(list string) (string, error) {
+	var failed string
+	for line := range strings.Lines(list) {
+		line = strings.TrimSpace(line)
+		lower := strings.ToLower(line)
+		if !strings.Contains(lower, "chroma") {
+			continue
+		}
+		if strings.Contains(lower, "failed") || strings.Contains(lower, "✗") || strings.Contains(lower, "disconnected") {
+			failed = line
+			continue
+		}
+		// Claude Code lists servers as "name: command - status".
+		return strings.TrimSuffix(strings.Fields(line)[0], ":"), nil
+	}
+	if failed != "" {
+		return "", fmt.Errorf("its Chroma MCP server is not connected: %s", truncateRunes(failed, outputLineMax))
+	}
+	return "", errors.New("no Chroma MCP server is configured")
+}
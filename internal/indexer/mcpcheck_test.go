@@ -0,0 +1,108 @@
+package indexer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// promptBackend is an agent without an MCP listing command, running its
+// executable with the prompt as the only argument.
+type promptBackend struct{}
+
+func (promptBackend) Name() string       { return "prompt-agent" }
+func (promptBackend) Executable() string { return "prompt-agent" }
+func (promptBackend) Args(_, prompt, _ string) ([]string, bool) {
+	return []string{prompt}, false
+}
+
+func TestCheckAgentMCP(t *testing.T) {
+	tests := map[string]struct {
+		backend AgentBackend
+		// script is the agent stub's body.
+		script  string
+		want    string
+		wantErr string
+	}{
+		"listed": {
+			script: `[ "$*" = "mcp list" ] || exit 9
+echo 'github  npx -y @modelcontextprotocol/server-github'
+echo 'chroma  uvx chroma-mcp --client-type http'`,
+			want: "Chroma MCP server chroma",
+		},
+		"listed by command": {
+			script: `echo 'vectors: uvx chroma-mcp - ✓ Connected'`,
+			want:   "Chroma MCP server vectors",
+		},
+		"not configured": {
+			script:  `echo 'github  npx -y @modelcontextprotocol/server-github'`,
+			wantErr: "no Chroma MCP server is configured",
+		},
+		"not connected": {
+			script:  `echo 'chroma: uvx chroma-mcp - ✗ Failed to connect'`,
+			wantErr: "not connected",
+		},
+		"listing fails": {
+			script:  `echo 'unknown command mcp' >&2; exit 2`,
+			wantErr: "Codex mcp list failed",
+		},
+		"probe ok": {
+			backend: promptBackend{},
+			script:  `case "$1" in *CHROMA_MCP_OK*) echo CHROMA_MCP_OK ;; *) exit 9 ;; esac`,
+			want:    "prompt-agent reports Chroma MCP tools",
+		},
+		"probe missing": {
+			backend: promptBackend{},
+			script:  `echo "$1"; echo CHROMA_MCP_MISSING`,
+			wantErr: "reports no Chroma MCP tools",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			codexPath := filepath.Join(t.TempDir(), "agent")
+			if err := os.WriteFile(codexPath, []byte("#!/bin/sh\n"+tc.script+"\n"), 0o755); err != nil {
+				t.Fatalf("write agent stub: %v", err)
+			}
+			ix := newIndexer(io.Discard, io.Discard, nil, nil, Options{CodexPath: codexPath, AgentBackend: tc.backend})
+
+			got, err := ix.checkAgentMCP(t.Context(), t.TempDir())
+			if tc.wantErr == "" && err != nil || tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+				t.Fatalf("expected error %q, got %v", tc.wantErr, err)
+			}
+			if !strings.Contains(got, tc.want) {
+				t.Fatalf("expected summary containing %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRunResultsMCPCheck(t *testing.T) {
+	rootDir := t.TempDir()
+	initGitRepo(t, filepath.Join(rootDir, "api"))
+	marker := filepath.Join(t.TempDir(), "indexed")
+	codexPath := filepath.Join(t.TempDir(), "codex")
+	codex := fmt.Sprintf("#!/bin/sh\n[ \"$1\" = mcp ] && { echo 'github  npx server-github'; exit 0; }\ntouch %s\n",
+		marker)
+	if err := os.WriteFile(codexPath, []byte(codex), 0o755); err != nil {
+		t.Fatalf("write codex stub: %v", err)
+	}
+
+	results, err := RunResults(Options{
+		RootDir:     rootDir,
+		CodexPath:   codexPath,
+		CodexStdin:  StdinClosed,
+		CachePath:   filepath.Join(t.TempDir(), "cache.json"),
+		SummaryJSON: filepath.Join(t.TempDir(), "summary.json"),
+		MCPCheck:    true,
+	})
+	if err == nil || !strings.Contains(err.Error(), "no Chroma MCP server") {
+		t.Fatalf("expected the MCP check to stop the run, got %v (%d results)", err, len(results))
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Fatal("expected no repo to be indexed")
+	}
+}
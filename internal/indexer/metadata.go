@@ -0,0 +1,364 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+)
+
+// metadataPlaceholder marks where codexPromptTemplate lists the metadata
+// fields of documentSchema.
+const metadataPlaceholder = "{{metadata}}"
+
+// codexPrompt is the standard prompt with the metadata schema rendered in,
+// so the instructions and the validation never disagree.
+var codexPrompt = strings.Replace(codexPromptTemplate, metadataPlaceholder, documentSchema.instructions(), 1)
+
+// metadataType is the scalar type of a metadata value.
+type metadataType string
+
+const (
+	metadataString metadataType = "string"
+	metadataInt    metadataType = "int"
+)
+
+// documentKind is a value of the "kind" metadata field. Kinds with an
+// owner are reserved for the pass or generated document it names.
+type documentKind struct {
+	Name  string
+	Owner string
+}
+
+// documentKinds lists every kind a document may have.
+var documentKinds = []documentKind{
+	{Name: "repo_overview"},
+	{Name: "module_summary"},
+	{Name: "concept"},
+	{Name: "release_snapshot"},
+	{Name: "security_concept", Owner: "security review pass"},
+	{Name: "infra_summary", Owner: "infra pass"},
+	{Name: "changelog_summary", Owner: "changelog pass"},
+	{Name: "issue_context", Owner: "issues pass"},
+	{Name: "ci_pipeline", Owner: "CI pass"},
+	{Name: "data_model", Owner: "data model pass"},
+	{Name: "dependencies", Owner: "generated inventory"},
+	{Name: "source_file", Owner: "local file ingestion"},
+}
+
+// metadataField is one key of the document metadata schema.
+type metadataField struct {
+	Name string
+	Type metadataType
+	// Doc is the prompt's instruction for the field.
+	Doc string
+	// Values, when set, are the only values a string field may take.
+	Values []string
+	// Min is the smallest value of an int field.
+	Min      int
+	Required bool
+}
+
+// metadataSchema is the metadata every indexed document carries,
+// independent of the store it is written to. Passes may add keys of their
+// own; the schema only constrains the keys it lists.
+type metadataSchema []metadataField
+
+// documentSchema is the metadata schema of indexed documents.
+var documentSchema = metadataSchema{
+	{
+		Name:     "repo",
+		Type:     metadataString,
+		Required: true,
+		Doc:      `the repo name (for example: "messagelog", "alloy-compiler").`,
+	},
+	{
+		Name:     "path",
+		Type:     metadataString,
+		Required: true,
+		Doc: `a logical path for the summary (for example: "ROOT" for the repo overview, ` +
+			`or "cmd/server", "internal/foo").`,
+	},
+	{
+		Name:     "kind",
+		Type:     metadataString,
+		Required: true,
+		Values:   kindNames(),
+		Doc:      kindDoc(),
+	},
+	{
+		Name: "language",
+		Type: metadataString,
+		Doc:  "primary language for that module if applicable.",
+	},
+	{
+		Name:     "collection",
+		Type:     metadataString,
+		Required: true,
+		Doc:      `the exact manifest "collection" value used.`,
+	},
+	{
+		Name: "remote",
+		Type: metadataString,
+		Doc: `the exact manifest "repo.remote_url" value, when it is set, so documents can be ` +
+			`linked back to the hosting provider.`,
+	},
+	{
+		Name: "tags",
+		Type: metadataString,
+		Doc: `optional comma-separated string such as "microservice,cli,database,kafka"; it must ` +
+			`include every manifest "tags" value, when set.`,
+	},
+	{
+		Name: "version",
+		Type: metadataString,
+		Doc:  `the exact manifest "version" value, when it is set.`,
+	},
+	{
+		Name:     "commit",
+		Type:     metadataString,
+		Required: true,
+		Doc:      `the manifest "commit.sha" the document was written from.`,
+	},
+	{
+		Name:     "run_id",
+		Type:     metadataString,
+		Required: true,
+		Doc:      `the exact manifest "run_id" value, identifying the indexer run that wrote the document.`,
+	},
+	{
+		Name: "indexer_version",
+		Type: metadataString,
+		Doc: `the exact manifest "indexer_version" value, recording which indexer build produced ` +
+			`the document.`,
+	},
+	{
+		Name: "chunk",
+		Type: metadataInt,
+		Min:  1,
+		Doc:  `the 1-based chunk number of a document split to fit "limits".`,
+	},
+	{
+		Name: "chunks",
+		Type: metadataInt,
+		Min:  1,
+		Doc:  "the number of chunks the document was split into.",
+	},
+}
+
+func kindNames() []string {
+	names := make([]string, len(documentKinds))
+	for i, k := range documentKinds {
+		names[i] = k.Name
+	}
+	return names
+}
+
+// kindDoc describes the kinds open to every pass and the reserved ones.
+func kindDoc() string {
+	var open, reserved []string
+	for _, k := range documentKinds {
+		if k.Owner == "" {
+			open = append(open, fmt.Sprintf("%q", k.Name))
+		} else {
+			reserved = append(reserved, fmt.Sprintf("%q (%s)", k.Name, k.Owner))
+		}
+	}
+	return fmt.Sprintf("one of %s. Reserved for the pass or document that owns them: %s.",
+		joinList(open, "or"), joinList(reserved, "and"))
+}
+
+// joinList joins items as an English list with conj before the last.
+func joinList(items []string, conj string) string {
+	if len(items) < 3 {
+		return strings.Join(items, " "+conj+" ")
+	}
+	return strings.Join(items[:len(items)-1], ", ") + ", " + conj + " " + items[len(items)-1]
+}
+
+// instructions renders the schema as the prompt's metadata bullets.
+func (s metadataSchema) instructions() string {
+	var b strings.Builder
+	for i, f := range s {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		name := f.Name
+		if f.Required {
+			name += " (required)"
+		}
+		b.WriteString(wrapIndented(name+": "+f.Doc, "   - ", "     ", 78))
+	}
+	return b.String()
+}
+
+// wrapIndented wraps text at width columns, starting the first line with
+// first and the rest with rest.
+func wrapIndented(text, first, rest string, width int) string {
+	var b strings.Builder
+	line := first
+	fresh := true
+	for word := range strings.FieldsSeq(text) {
+		if !fresh && len(line)+1+len(word) > width {
+			b.WriteString(line + "\n")
+			line, fresh = rest, true
+		}
+		if !fresh {
+			line += " "
+		}
+		line += word
+		fresh = false
+	}
+	b.WriteString(line)
+	return b.String()
+}
+
+// validate checks a document's metadata against the schema: every value
+// must be a scalar, required fields must be set, and known fields must
+// have their type and allowed values. It reports every problem found.
+func (s metadataSchema) validate(md map[string]any) error {
+	var errs []error
+	for _, key := range slices.Sorted(maps.Keys(md)) {
+		switch md[key].(type) {
+		case nil, string, bool, int, int64, float64:
+		default:
+			errs = append(errs, fmt.Errorf("%s: %T is not a scalar", key, md[key]))
+		}
+	}
+	for _, f := range s {
+		v, ok := md[f.Name]
+		if !ok || v == nil || v == "" {
+			if f.Required {
+				errs = append(errs, fmt.Errorf("%s: required", f.Name))
+			}
+			continue
+		}
+		if err := f.check(v); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", f.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// check validates a set value of the field.
+func (f metadataField) check(v any) error {
+	switch f.Type {
+	case metadataString:
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("expected a string, got %T", v)
+		}
+		if len(f.Values) > 0 && !slices.Contains(f.Values, s) {
+			return fmt.Errorf("unknown value %q", s)
+		}
+	case metadataInt:
+		n, ok := metadataInteger(v)
+		if !ok {
+			return fmt.Errorf("expected an integer, got %v", v)
+		}
+		if n < f.Min {
+			return fmt.Errorf("%d is less than %d", n, f.Min)
+		}
+	}
+	return nil
+}
+
+// metadataInteger returns v as an int; JSON decodes numbers as float64.
+func metadataInteger(v any) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case int64:
+		return int(n), true
+	case float64:
+		if n == math.Trunc(n) {
+			return int(n), true
+		}
+	}
+	return 0, false
+}
+
+// metadataProblems flattens a validate error onto one line.
+func metadataProblems(err error) string {
+	return strings.ReplaceAll(err.Error(), "\n", "; ")
+}
+
+// invalidDocumentsShown caps the invalid documents logged per repo.
+const invalidDocumentsShown = 5
+
+// validateStored implements --validate-metadata: it checks the metadata of
+// the documents this run wrote to m's collection, found by their run_id or
+// commit, records how many are invalid, and sets the run's collection
+// metadata, which Codex does not. Store errors are logged rather than
+// failing the repo.
+func (ix *indexer) validateStored(ctx context.Context, result *RepoResult, m *indexManifest) {
+	if err := ix.stampStored(ctx, m); err != nil {
+		ix.log(ctx).warnf("could not set collection metadata: %v", err)
+	}
+	invalid, checked, err := ix.countInvalidDocuments(ctx, m.Collection, result.IndexedCommit)
+	if err != nil {
+		ix.log(ctx).warnf("could not validate document metadata: %v", err)
+		return
+	}
+	result.InvalidDocs = invalid
+	switch {
+	case checked == 0:
+		ix.log(ctx).warnf("no documents carry this run's run_id or commit; metadata not validated")
+	case invalid > 0:
+		ix.log(ctx).warnf("%d of %d documents have invalid metadata", invalid, checked)
+	default:
+		ix.log(ctx).infof("metadata of %d documents is valid", checked)
+	}
+}
+
+// stampStored sets the run's collection metadata on m's collection, when
+// it exists.
+func (ix *indexer) stampStored(ctx context.Context, m *indexManifest) error {
+	client := newChromaClient(ix.opts.Chroma)
+	col, ok, err := client.getCollection(ctx, m.Collection)
+	if err != nil || !ok {
+		return err
+	}
+	return stampCollection(ctx, client, col, ix.collectionMetadata(m))
+}
+
+// countInvalidDocuments pages through the collection's documents stamped
+// with this run's run_id or with commit, logging the first few invalid ones.
+func (ix *indexer) countInvalidDocuments(ctx context.Context, collection, commit string) (int, int, error) {
+	client := newChromaClient(ix.opts.Chroma)
+	col, ok, err := client.getCollection(ctx, collection)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !ok {
+		return 0, 0, fmt.Errorf("collection %s does not exist", collection)
+	}
+
+	where := map[string]any{"$or": []map[string]any{{"run_id": ix.runID}, {"commit": commit}}}
+	invalid, checked := 0, 0
+	for offset := 0; ; offset += chromaPageSize {
+		page, err := client.getWhereMetadatas(ctx, col.ID, where, offset, chromaPageSize)
+		if err != nil {
+			return invalid, checked, err
+		}
+		for i, id := range page.IDs {
+			checked++
+			var md map[string]any
+			if i < len(page.Metadatas) {
+				md = page.Metadatas[i]
+			}
+			if err := documentSchema.validate(md); err != nil {
+				if invalid < invalidDocumentsShown {
+					ix.log(ctx).warnf("document %s: %s", id, metadataProblems(err))
+				}
+				invalid++
+			}
+		}
+		if len(page.IDs) < chromaPageSize {
+			return invalid, checked, nil
+		}
+	}
+}
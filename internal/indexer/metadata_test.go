@@ -0,0 +1,156 @@
+package indexer
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func validMetadata() map[string]any {
+	return map[string]any{
+		"repo":       "api",
+		"path":       "internal/store",
+		"kind":       "module_summary",
+		"collection": "api",
+		"commit":     "abc123",
+		"run_id":     "run-1",
+	}
+}
+
+func TestMetadataSchemaValidate(t *testing.T) {
+	tests := map[string]struct {
+		set     map[string]any
+		unset   []string
+		wantErr []string
+	}{
+		"valid":              {},
+		"extra pass keys":    {set: map[string]any{"tables": "users,orders", "dependency_count": 3.0}},
+		"chunk from json":    {set: map[string]any{"chunk": 2.0, "chunks": 3.0}},
+		"reserved kind":      {set: map[string]any{"kind": "dependencies"}},
+		"missing required":   {unset: []string{"commit", "run_id"}, wantErr: []string{"commit: required", "run_id: required"}},
+		"empty required":     {set: map[string]any{"repo": ""}, wantErr: []string{"repo: required"}},
+		"unknown kind":       {set: map[string]any{"kind": "summary"}, wantErr: []string{`kind: unknown value "summary"`}},
+		"wrong type":         {set: map[string]any{"path": 3.0}, wantErr: []string{"path: expected a string"}},
+		"fractional chunk":   {set: map[string]any{"chunk": 1.5}, wantErr: []string{"chunk: expected an integer"}},
+		"chunk below one":    {set: map[string]any{"chunks": 0.0}, wantErr: []string{"chunks: 0 is less than 1"}},
+		"list value":         {set: map[string]any{"tags": []any{"a", "b"}}, wantErr: []string{"tags: []interface {} is not a scalar"}},
+		"nested other field": {set: map[string]any{"extra": map[string]any{}}, wantErr: []string{"extra: map"}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			md := validMetadata()
+			for k, v := range tc.set {
+				md[k] = v
+			}
+			for _, k := range tc.unset {
+				delete(md, k)
+			}
+			err := documentSchema.validate(md)
+			if len(tc.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("expected valid metadata, got %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected errors %q, got none", tc.wantErr)
+			}
+			for _, want := range tc.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Fatalf("expected error containing %q, got %v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestCodexPromptRendersSchema(t *testing.T) {
+	if strings.Contains(codexPrompt, metadataPlaceholder) {
+		t.Fatal("expected the metadata placeholder to be replaced")
+	}
+	for _, f := range documentSchema {
+		if !strings.Contains(codexPrompt, "   - "+f.Name) {
+			t.Fatalf("expected the prompt to describe %q", f.Name)
+		}
+	}
+	for _, k := range documentKinds {
+		if !strings.Contains(codexPrompt, `"`+k.Name+`"`) {
+			t.Fatalf("expected the prompt to list kind %q", k.Name)
+		}
+	}
+	for line := range strings.Lines(documentSchema.instructions()) {
+		if len(strings.TrimSuffix(line, "\n")) > 78 {
+			t.Fatalf("expected lines of at most 78 columns, got %q", line)
+		}
+	}
+}
+
+func TestValidateStored(t *testing.T) {
+	bad := validMetadata()
+	delete(bad, "run_id")
+	var where, stamped map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet:
+			_ = json.NewEncoder(w).Encode(chromaCollection{
+				ID: "col-1", Name: "api", Metadata: map[string]any{"hnsw:space": "cosine"},
+			})
+		case r.Method == http.MethodPut:
+			var req struct {
+				NewMetadata map[string]any `json:"new_metadata"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			stamped = req.NewMetadata
+			_ = json.NewEncoder(w).Encode(map[string]any{})
+		case strings.HasSuffix(r.URL.Path, "/col-1/get"):
+			var req struct {
+				Where map[string]any `json:"where"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			where = req.Where
+			_ = json.NewEncoder(w).Encode(chromaRecords{
+				IDs:       []string{"overview", "store"},
+				Metadatas: []map[string]any{validMetadata(), bad},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	var out bytes.Buffer
+	ix := newIndexer(&out, &out, nil, nil, Options{Chroma: ChromaOptions{URL: srv.URL}})
+	result := &RepoResult{IndexedCommit: "abc123"}
+	ix.validateStored(t.Context(), result, &indexManifest{
+		Collection:     "api",
+		IndexerVersion: "v1.2.3",
+		Repo:           manifestRepo{Name: "api", Path: "/src/api", RemoteURL: "git@example.com:org/api.git"},
+	})
+
+	if result.InvalidDocs != 1 {
+		t.Fatalf("expected 1 invalid document, got %d\n%s", result.InvalidDocs, out.String())
+	}
+	if !strings.Contains(out.String(), "document store: run_id: required") ||
+		!strings.Contains(out.String(), "1 of 2 documents") {
+		t.Fatalf("expected the invalid document logged, got %q", out.String())
+	}
+	clauses, _ := where["$or"].([]any)
+	if len(clauses) != 2 {
+		t.Fatalf("expected a run_id or commit filter, got %v", where)
+	}
+	want := map[string]any{
+		"hnsw:space":         "cosine",
+		collectionRepoKey:    "api",
+		collectionRemoteKey:  "git@example.com:org/api.git",
+		collectionRootKey:    "/src/api",
+		collectionIndexerKey: "v1.2.3",
+	}
+	if !reflect.DeepEqual(stamped, want) {
+		t.Fatalf("expected collection metadata %v, got %v", want, stamped)
+	}
+}
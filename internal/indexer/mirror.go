@@ -0,0 +1,75 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// mirrorLocks serializes clone/fetch of a single mirror when several repos
+// (or branches) share a remote.
+type mirrorLocks struct {
+	locks map[string]*sync.Mutex
+	mu    sync.Mutex
+}
+
+func (ml *mirrorLocks) lock(path string) func() {
+	ml.mu.Lock()
+	if ml.locks == nil {
+		ml.locks = make(map[string]*sync.Mutex)
+	}
+	lock, ok := ml.locks[path]
+	if !ok {
+		lock = &sync.Mutex{}
+		ml.locks[path] = lock
+	}
+	ml.mu.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
+
+// mirrorPath returns the bare mirror location for a remote under dir.
+func mirrorPath(dir, remote string) string {
+	return filepath.Join(dir, sanitizePathComponent(normalizeRemoteURL(remote))+".git")
+}
+
+// syncMirror clones remote as a --mirror under --mirror-dir on first use and
+// fetches deltas on later runs, returning the mirror's path.
+func (ix *indexer) syncMirror(ctx context.Context, remote string, settings repoSettings) (string, error) {
+	path := mirrorPath(ix.opts.MirrorDir, remote)
+	unlock := ix.mirrors.lock(path)
+	defer unlock()
+
+	_, err := os.Stat(path)
+	switch {
+	case err == nil:
+		fetchErr := ix.retryGit(ctx, "git fetch (mirror)", func() error {
+			return runGitCommand(ctx, path, settings.gitEnv(), "fetch", "--prune")
+		})
+		if fetchErr != nil {
+			return "", fmt.Errorf("update mirror %s: %w", path, fetchErr)
+		}
+		return path, nil
+	case errors.Is(err, os.ErrNotExist):
+	default:
+		return "", fmt.Errorf("stat mirror %s: %w", path, err)
+	}
+
+	if err := os.MkdirAll(ix.opts.MirrorDir, 0o750); err != nil {
+		return "", fmt.Errorf("create mirror dir: %w", err)
+	}
+	cloneErr := ix.retryGit(ctx, "git clone --mirror", func() error {
+		if err := os.RemoveAll(path); err != nil {
+			return fmt.Errorf("clean partial mirror: %w", err)
+		}
+		return runGitCommand(ctx, ix.opts.MirrorDir, settings.gitEnv(), "clone", "--mirror", remote, path)
+	})
+	if cloneErr != nil {
+		return "", fmt.Errorf("clone mirror %s: %w", path, cloneErr)
+	}
+	return path, nil
+}
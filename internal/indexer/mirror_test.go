@@ -0,0 +1,41 @@
+package indexer
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPrepareIndexWorkspaceFromMirror(t *testing.T) {
+	upstream := filepath.Join(t.TempDir(), "upstream")
+	initGitRepo(t, upstream)
+
+	rootDir := t.TempDir()
+	repoDir := filepath.Join(rootDir, "clone")
+	if err := runGit(rootDir, "clone", upstream, repoDir); err != nil {
+		t.Fatalf("git clone: %v", err)
+	}
+
+	mirrorDir := filepath.Join(t.TempDir(), "mirrors")
+	ix := newIndexer(io.Discard, io.Discard, nil, nil, Options{MirrorDir: mirrorDir})
+	settings, err := ix.resolveRepoSettings(t.Context(), newRepoIdentity(rootDir, repoDir, "clone"), repoDir)
+	if err != nil {
+		t.Fatalf("resolve repo settings: %v", err)
+	}
+
+	for run := range 2 {
+		ws := ix.prepareIndexWorkspace(t.Context(), repoDir, "clone", "trunk", settings, false)
+		if ws.checkoutOK == nil || !*ws.checkoutOK {
+			t.Fatalf("run %d: expected checkout to succeed", run)
+		}
+		if _, err := os.Stat(filepath.Join(ws.dir, "README.md")); err != nil {
+			t.Fatalf("run %d: expected README in worktree: %v", run, err)
+		}
+		ws.cleanup()
+	}
+
+	if _, err := os.Stat(mirrorPath(mirrorDir, settings.remoteRaw)); err != nil {
+		t.Fatalf("expected mirror to exist: %v", err)
+	}
+}
@@ -0,0 +1,489 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// Collection stores selectable with Options.Store.
+const (
+	StoreChroma   = "chroma"
+	StoreMock     = "mock"
+	StoreEmbedded = "embedded"
+	StorePgvector = "pgvector"
+)
+
+// DefaultMockStoreFile is where --store mock records its operations.
+const DefaultMockStoreFile = "mock-store.json"
+
+// mockStoreURL stands in for the server URL; requests never leave the
+// process.
+const mockStoreURL = "mock://store"
+
+// Operations recorded by the mock store.
+const (
+	mockOpCreate = "create_collection"
+	mockOpRename = "rename_collection"
+	mockOpModify = "modify_collection"
+	mockOpDelete = "delete_collection"
+	mockOpAdd    = "add"
+	mockOpUpsert = "upsert"
+	mockOpRemove = "delete"
+	// mockOpCodex is Codex indexing a collection through its own store
+	// connection, which the mock cannot see; it records Codex's inputs.
+	mockOpCodex = "codex_index"
+)
+
+// mockStoreOp is one operation a run would perform on the store.
+type mockStoreOp struct {
+	Metadata   map[string]any `json:"metadata,omitempty"`
+	Document   *string        `json:"document,omitempty"`
+	Op         string         `json:"op"`
+	Collection string         `json:"collection"`
+	NewName    string         `json:"new_name,omitempty"`
+	ID         string         `json:"id,omitempty"`
+	Repo       string         `json:"repo,omitempty"`
+	Commit     string         `json:"commit,omitempty"`
+	Mode       string         `json:"mode,omitempty"`
+	Passes     []string       `json:"passes,omitempty"`
+	DiffFiles  int            `json:"diff_files,omitempty"`
+}
+
+// mockCollection is a collection held by the mock store.
+type mockCollection struct {
+	records  map[string]mockRecord
+	metadata map[string]any
+	id       string
+	name     string
+	ids      []string
+}
+
+type mockRecord struct {
+	metadata map[string]any
+	document *string
+}
+
+// mockStore is an in-memory stand-in for the Chroma server behind
+// --store mock. It starts empty, like a fresh production store, serves the
+// subset of the v2 API the indexer uses as an http.RoundTripper, and
+// records every write in order so a run can be inspected before it touches
+// a real store.
+type mockStore struct {
+	collections map[string]*mockCollection
+	mux         *http.ServeMux
+	path        string
+	ops         []mockStoreOp
+	nextID      int
+	mu          sync.Mutex
+}
+
+func newMockStore(path string) *mockStore {
+	if path == "" {
+		path = DefaultMockStoreFile
+	}
+	s := &mockStore{
+		collections: make(map[string]*mockCollection),
+		mux:         http.NewServeMux(),
+		path:        path,
+	}
+	const cols = "/api/v2/tenants/{tenant}/databases/{database}/collections"
+	s.mux.HandleFunc("GET /api/v2/heartbeat", func(w http.ResponseWriter, _ *http.Request) {
+		writeMockJSON(w, map[string]any{"nanosecond heartbeat": 0})
+	})
+	s.mux.HandleFunc("GET /api/v2/version", func(w http.ResponseWriter, _ *http.Request) {
+		writeMockJSON(w, StoreMock)
+	})
+	s.mux.HandleFunc("GET "+cols+"_count", s.count)
+	s.mux.HandleFunc("GET "+cols, s.list)
+	s.mux.HandleFunc("POST "+cols, s.create)
+	s.mux.HandleFunc("GET "+cols+"/{name}", s.get)
+	s.mux.HandleFunc("PUT "+cols+"/{id}", s.update)
+	s.mux.HandleFunc("DELETE "+cols+"/{name}", s.delete)
+	s.mux.HandleFunc("GET "+cols+"/{id}/count", s.countRecords)
+	s.mux.HandleFunc("POST "+cols+"/{id}/get", s.records)
+	s.mux.HandleFunc("POST "+cols+"/{id}/add", s.write(mockOpAdd))
+	s.mux.HandleFunc("POST "+cols+"/{id}/upsert", s.write(mockOpUpsert))
+	s.mux.HandleFunc("POST "+cols+"/{id}/delete", s.remove)
+	return s
+}
+
+// RoundTrip serves req from the in-memory store.
+func (s *mockStore) RoundTrip(req *http.Request) (*http.Response, error) {
+	return handlerTransport{s.mux}.RoundTrip(req)
+}
+
+// handlerTransport is an http.RoundTripper serving every request from a
+// handler in process.
+type handlerTransport struct {
+	http.Handler
+}
+
+func (t handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rec := &mockResponse{header: make(http.Header)}
+	t.ServeHTTP(rec, req)
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return &http.Response{
+		Status:     strconv.Itoa(rec.status) + " " + http.StatusText(rec.status),
+		StatusCode: rec.status,
+		Header:     rec.header,
+		Body:       io.NopCloser(&rec.body),
+		Request:    req,
+	}, nil
+}
+
+// mockResponse buffers a handler's response for RoundTrip.
+type mockResponse struct {
+	header http.Header
+	body   bytes.Buffer
+	status int
+}
+
+func (r *mockResponse) Header() http.Header { return r.header }
+
+func (r *mockResponse) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.body.Write(b)
+}
+
+func (r *mockResponse) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func writeMockJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func mockNotFound(w http.ResponseWriter, what string) {
+	http.Error(w, fmt.Sprintf(`{"error":"NotFoundError","message":"%s does not exist"}`, what), http.StatusNotFound)
+}
+
+// record appends op to the log; callers hold mu.
+func (s *mockStore) record(op mockStoreOp) {
+	s.ops = append(s.ops, op)
+}
+
+func (c *mockCollection) view() chromaCollection {
+	return chromaCollection{ID: c.id, Name: c.name, Metadata: c.metadata}
+}
+
+// byID returns the collection with id; callers hold mu.
+func (s *mockStore) byID(id string) *mockCollection {
+	for _, c := range s.collections {
+		if c.id == id {
+			return c
+		}
+	}
+	return nil
+}
+
+func (s *mockStore) count(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeMockJSON(w, len(s.collections))
+}
+
+func (s *mockStore) list(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := slices.Sorted(maps.Keys(s.collections))
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = len(names)
+	}
+	page := []chromaCollection{}
+	for _, name := range names[min(offset, len(names)):min(offset+limit, len(names))] {
+		page = append(page, s.collections[name].view())
+	}
+	writeMockJSON(w, page)
+}
+
+func (s *mockStore) create(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Metadata map[string]any `json:"metadata"`
+		Name     string         `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		http.Error(w, "invalid collection", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.collections[req.Name]; ok {
+		http.Error(w, fmt.Sprintf("collection %s already exists", req.Name), http.StatusConflict)
+		return
+	}
+	s.nextID++
+	c := &mockCollection{
+		id:       "mock-" + strconv.Itoa(s.nextID),
+		name:     req.Name,
+		metadata: req.Metadata,
+		records:  make(map[string]mockRecord),
+	}
+	s.collections[req.Name] = c
+	s.record(mockStoreOp{Op: mockOpCreate, Collection: req.Name, Metadata: req.Metadata})
+	writeMockJSON(w, c.view())
+}
+
+func (s *mockStore) get(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.collections[r.PathValue("name")]
+	if !ok {
+		mockNotFound(w, "collection "+r.PathValue("name"))
+		return
+	}
+	writeMockJSON(w, c.view())
+}
+
+// update renames a collection or replaces its metadata.
+func (s *mockStore) update(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		NewMetadata map[string]any `json:"new_metadata"`
+		NewName     string         `json:"new_name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.NewName == "" && req.NewMetadata == nil {
+		http.Error(w, "invalid collection update", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.byID(r.PathValue("id"))
+	if c == nil {
+		mockNotFound(w, "collection "+r.PathValue("id"))
+		return
+	}
+	if req.NewMetadata != nil {
+		s.record(mockStoreOp{Op: mockOpModify, Collection: c.name, Metadata: req.NewMetadata})
+		c.metadata = req.NewMetadata
+	}
+	if req.NewName != "" {
+		delete(s.collections, c.name)
+		s.record(mockStoreOp{Op: mockOpRename, Collection: c.name, NewName: req.NewName})
+		c.name = req.NewName
+		s.collections[c.name] = c
+	}
+	writeMockJSON(w, map[string]any{})
+}
+
+func (s *mockStore) delete(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name := r.PathValue("name")
+	if _, ok := s.collections[name]; !ok {
+		mockNotFound(w, "collection "+name)
+		return
+	}
+	delete(s.collections, name)
+	s.record(mockStoreOp{Op: mockOpDelete, Collection: name})
+	writeMockJSON(w, map[string]any{})
+}
+
+// records serves get: the listed ids, or a page of every record. Where
+// filters are not evaluated.
+func (s *mockStore) countRecords(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.byID(r.PathValue("id"))
+	if c == nil {
+		mockNotFound(w, "collection "+r.PathValue("id"))
+		return
+	}
+	writeMockJSON(w, len(c.records))
+}
+
+func (s *mockStore) records(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		IDs    []string `json:"ids"`
+		Offset int      `json:"offset"`
+		Limit  int      `json:"limit"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid get", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.byID(r.PathValue("id"))
+	if c == nil {
+		mockNotFound(w, "collection "+r.PathValue("id"))
+		return
+	}
+	ids := req.IDs
+	if ids == nil {
+		limit := req.Limit
+		if limit <= 0 {
+			limit = len(c.ids)
+		}
+		ids = c.ids[min(req.Offset, len(c.ids)):min(req.Offset+limit, len(c.ids))]
+	}
+	out := chromaRecords{IDs: []string{}}
+	for _, id := range ids {
+		rec, ok := c.records[id]
+		if !ok {
+			continue
+		}
+		out.IDs = append(out.IDs, id)
+		out.Documents = append(out.Documents, rec.document)
+		out.Metadatas = append(out.Metadatas, rec.metadata)
+	}
+	writeMockJSON(w, out)
+}
+
+// write serves add and upsert, recording one operation per record.
+func (s *mockStore) write(op string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var recs chromaRecords
+		if err := json.NewDecoder(r.Body).Decode(&recs); err != nil {
+			http.Error(w, "invalid records", http.StatusBadRequest)
+			return
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		c := s.byID(r.PathValue("id"))
+		if c == nil {
+			mockNotFound(w, "collection "+r.PathValue("id"))
+			return
+		}
+		for i, id := range recs.IDs {
+			var rec mockRecord
+			if i < len(recs.Documents) {
+				rec.document = recs.Documents[i]
+			}
+			if i < len(recs.Metadatas) {
+				rec.metadata = recs.Metadatas[i]
+			}
+			if _, ok := c.records[id]; !ok {
+				c.ids = append(c.ids, id)
+			}
+			c.records[id] = rec
+			s.record(mockStoreOp{Op: op, Collection: c.name, ID: id, Document: rec.document, Metadata: rec.metadata})
+		}
+		writeMockJSON(w, map[string]any{})
+	}
+}
+
+// remove serves record deletes, recording one operation per deleted
+// record.
+func (s *mockStore) remove(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		IDs []string `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid delete", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.byID(r.PathValue("id"))
+	if c == nil {
+		mockNotFound(w, "collection "+r.PathValue("id"))
+		return
+	}
+	for _, id := range req.IDs {
+		if _, ok := c.records[id]; !ok {
+			continue
+		}
+		delete(c.records, id)
+		c.ids = slices.DeleteFunc(c.ids, func(other string) bool { return other == id })
+		s.record(mockStoreOp{Op: mockOpRemove, Collection: c.name, ID: id})
+	}
+	writeMockJSON(w, map[string]any{})
+}
+
+// recordCodex notes that Codex would index a collection with these inputs.
+func (s *mockStore) recordCodex(op mockStoreOp) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	op.Op = mockOpCodex
+	s.record(op)
+}
+
+// mockStoreFile is the JSON document --store mock writes.
+type mockStoreFile struct {
+	Operations []mockStoreOp `json:"operations"`
+	// Collections are the collections the store would hold afterwards,
+	// with their record counts.
+	Collections map[string]int `json:"collections"`
+}
+
+// save writes the recorded operations to the mock store file.
+func (s *mockStore) save() error {
+	s.mu.Lock()
+	file := mockStoreFile{Operations: s.ops, Collections: make(map[string]int, len(s.collections))}
+	if file.Operations == nil {
+		file.Operations = []mockStoreOp{}
+	}
+	for name, c := range s.collections {
+		file.Collections[name] = len(c.records)
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	s.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("encode mock store: %w", err)
+	}
+	if err := writeFileSynced(s.path, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("write mock store: %w", err)
+	}
+	return nil
+}
+
+// recordMockRun plays a dry-run repo against the mock store: the
+// collection Codex would create, the documents the indexer generates for
+// it, and Codex's inputs.
+func (ix *indexer) recordMockRun(ctx context.Context, result *RepoResult, m *indexManifest, passes []indexPass) {
+	mock := ix.opts.Chroma.mock
+	if mock == nil {
+		return
+	}
+	client := newChromaClient(ix.opts.Chroma)
+	col, ok, err := client.getCollection(ctx, m.Collection)
+	if err == nil && !ok {
+		col, err = client.createCollection(ctx, m.Collection, nil)
+	}
+	if err == nil && m.dependencyDocument != nil {
+		doc := m.dependencyDocument
+		err = client.upsertRecords(ctx, col.ID, chromaRecords{
+			IDs:       []string{doc.ID},
+			Documents: []*string{&doc.Document},
+			Metadatas: []map[string]any{doc.Metadata},
+		})
+	}
+	if err != nil {
+		ix.log(ctx).warnf("mock store: %v", err)
+	}
+
+	op := mockStoreOp{
+		Collection: m.Collection,
+		Repo:       m.Repo.Name,
+		Commit:     result.IndexedCommit,
+		Mode:       m.Mode,
+		DiffFiles:  result.DiffFileCount,
+	}
+	for _, pass := range passes {
+		if pass.name != "" {
+			op.Passes = append(op.Passes, pass.name)
+		}
+	}
+	mock.recordCodex(op)
+}
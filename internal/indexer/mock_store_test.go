@@ -0,0 +1,112 @@
+package indexer
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestMockStoreClient(t *testing.T) {
+	mock := newMockStore(filepath.Join(t.TempDir(), "mock.json"))
+	client := newChromaClient(ChromaOptions{URL: mockStoreURL, mock: mock})
+	ctx := t.Context()
+
+	if _, ok, err := client.getCollection(ctx, "api"); err != nil || ok {
+		t.Fatalf("expected an empty store, got ok=%t err=%v", ok, err)
+	}
+	col, err := client.createCollection(ctx, "api", map[string]any{"repo": "api"})
+	if err != nil {
+		t.Fatalf("create collection: %v", err)
+	}
+	doc := "overview"
+	recs := chromaRecords{IDs: []string{"a"}, Documents: []*string{&doc}, Metadatas: []map[string]any{{"kind": "concept"}}}
+	if err := client.upsertRecords(ctx, col.ID, recs); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	got, err := client.getMetadatas(ctx, col.ID, []string{"a", "missing"})
+	if err != nil || !slices.Equal(got.IDs, []string{"a"}) || got.Metadatas[0]["kind"] != "concept" {
+		t.Fatalf("expected the upserted record, got %+v (%v)", got, err)
+	}
+	if err := client.renameCollection(ctx, col.ID, "api-v2"); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	if err := client.deleteCollection(ctx, "api"); !notFound(err) {
+		t.Fatalf("expected the old name to be gone, got %v", err)
+	}
+	names, err := client.listCollections(ctx)
+	if err != nil || !slices.Equal(names, []string{"api-v2"}) {
+		t.Fatalf("expected [api-v2], got %v (%v)", names, err)
+	}
+	if err := client.deleteCollection(ctx, "api-v2"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	if err := mock.save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	file := readMockStoreFile(t, mock.path)
+	var ops []string
+	for _, op := range file.Operations {
+		ops = append(ops, op.Op+" "+op.Collection)
+	}
+	want := []string{"create_collection api", "upsert api", "rename_collection api", "delete_collection api-v2"}
+	if !slices.Equal(ops, want) {
+		t.Fatalf("expected operations %v, got %v", want, ops)
+	}
+	if len(file.Collections) != 0 {
+		t.Fatalf("expected no collections left, got %v", file.Collections)
+	}
+}
+
+func TestRunResultsMockStore(t *testing.T) {
+	rootDir := t.TempDir()
+	initGitRepo(t, filepath.Join(rootDir, "api"))
+	mockPath := filepath.Join(t.TempDir(), "mock.json")
+
+	results, err := RunResults(Options{
+		RootDir:       rootDir,
+		SummaryJSON:   filepath.Join(t.TempDir(), "summary.json"),
+		ConfigPath:    writePassesConfig(t, []PassConfig{{Name: "architecture", Prompt: "x"}}),
+		Store:         StoreMock,
+		MockStorePath: mockPath,
+		StoreCheck:    true,
+		Sync:          true,
+	})
+	if err != nil {
+		t.Fatalf("run indexer: %v", err)
+	}
+	if !results[0].DryRun || results[0].CodexRan {
+		t.Fatalf("expected the mock store to imply a dry run, got %+v", results[0])
+	}
+
+	file := readMockStoreFile(t, mockPath)
+	if len(file.Operations) != 2 {
+		t.Fatalf("expected two operations, got %+v", file.Operations)
+	}
+	create, codex := file.Operations[0], file.Operations[1]
+	if create.Op != mockOpCreate || create.Collection != "api" {
+		t.Fatalf("expected the collection to be created, got %+v", create)
+	}
+	if codex.Op != mockOpCodex || codex.Repo != "api" || codex.Mode != manifestModeFull ||
+		!slices.Equal(codex.Passes, []string{"architecture"}) || codex.Commit != results[0].IndexedCommit {
+		t.Fatalf("expected Codex's inputs recorded, got %+v", codex)
+	}
+	if file.Collections["api"] != 0 {
+		t.Fatalf("expected an empty api collection, got %v", file.Collections)
+	}
+}
+
+func readMockStoreFile(t *testing.T, path string) mockStoreFile {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read mock store file: %v", err)
+	}
+	var file mockStoreFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatalf("decode mock store file: %v", err)
+	}
+	return file
+}
@@ -0,0 +1,68 @@
+package indexer
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// transliterations maps lowercase letters that do not decompose into ASCII
+// base letters plus combining marks. Uppercase letters are looked up by
+// their lowercase form and capitalized.
+var transliterations = map[rune]string{
+	// Latin
+	'ß': "ss", 'æ': "ae", 'œ': "oe", 'ø': "o", 'đ': "d", 'ð': "d", 'þ': "th",
+	'ł': "l", 'ı': "i", 'ŋ': "ng", 'ħ': "h",
+	// Cyrillic
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e",
+	'ж': "zh", 'з': "z", 'и': "i", 'й': "i", 'к': "k", 'л': "l", 'м': "m",
+	'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+	'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch",
+	'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "iu", 'я': "ia",
+	'є': "ie", 'і': "i", 'ї': "i", 'ґ': "g",
+	// Greek
+	'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i",
+	'θ': "th", 'ι': "i", 'κ': "k", 'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x",
+	'ο': "o", 'π': "p", 'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t", 'υ': "y",
+	'φ': "f", 'χ': "ch", 'ψ': "ps", 'ω': "o",
+}
+
+// normalizeName returns s in NFKC form, so names that differ only in how
+// their characters are composed compare equal. macOS stores file names
+// decomposed while Linux keeps whatever bytes were written.
+func normalizeName(s string) string {
+	return norm.NFKC.String(s)
+}
+
+// transliterate rewrites s into ASCII for use in slugs: accents are
+// stripped, Latin ligatures and Cyrillic and Greek letters are romanized,
+// and any other non-ASCII letter or digit becomes "u" plus its hex code
+// point so distinct names stay distinct. Other characters pass through for
+// the collection name rules to handle.
+func transliterate(s string) string {
+	var b strings.Builder
+	for _, r := range norm.NFKD.String(s) {
+		switch {
+		case r < utf8.RuneSelf:
+			b.WriteRune(r)
+		case unicode.Is(unicode.Mn, r):
+			// Combining marks left over from decomposing accented letters.
+		default:
+			lower := unicode.ToLower(r)
+			if repl, ok := transliterations[lower]; ok {
+				if lower != r && repl != "" {
+					repl = strings.ToUpper(repl[:1]) + repl[1:]
+				}
+				b.WriteString(repl)
+			} else if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				fmt.Fprintf(&b, "u%04x", r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	return b.String()
+}
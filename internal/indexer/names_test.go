@@ -0,0 +1,28 @@
+package indexer
+
+import "testing"
+
+func TestTransliterate(t *testing.T) {
+	tests := map[string]struct {
+		input string
+		want  string
+	}{
+		"ascii":        {input: "services_api-v2", want: "services_api-v2"},
+		"accents":      {input: "Crème_brûlée", want: "Creme_brulee"},
+		"decomposed":   {input: "café", want: "cafe"},
+		"ligatures":    {input: "Straße_æon", want: "Strasse_aeon"},
+		"cyrillic":     {input: "Привет", want: "Privet"},
+		"greek":        {input: "λόγος", want: "logos"},
+		"cjk":          {input: "日本", want: "u65e5u672c"},
+		"compat forms": {input: "ｆｕｌｌ", want: "full"},
+		"symbols kept": {input: "a b", want: "a b"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := transliterate(normalizeName(tc.input)); got != tc.want {
+				t.Fatalf("transliterate(%q) = %q, want %q", tc.input, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// onboardingFileName is the document Codex writes per repo under
+// --onboarding-dir.
+const onboardingFileName = "ONBOARDING.generated.md"
+
+// manifestOnboarding asks Codex for a human-readable onboarding document.
+type manifestOnboarding struct {
+	// Path is where the document is written; an existing one is updated.
+	Path string `json:"path"`
+	// Only skips writing to the collection store.
+	Only bool `json:"only"`
+}
+
+// onboardingPath returns the repo's onboarding document path, or "" when
+// --onboarding-dir is unset.
+func (ix *indexer) onboardingPath(slug string) string {
+	if ix.opts.OnboardingDir == "" {
+		return ""
+	}
+	return filepath.Join(ix.opts.OnboardingDir, sanitizePathComponent(slug), onboardingFileName)
+}
+
+// prepareOnboarding points the manifest at the repo's onboarding document
+// and creates its directory so Codex only has to write the file.
+func (ix *indexer) prepareOnboarding(ctx context.Context, m *indexManifest, slug string, dryRun bool) {
+	path := ix.onboardingPath(slug)
+	if path == "" {
+		return
+	}
+	m.Onboarding = &manifestOnboarding{Path: path, Only: ix.opts.OnboardingOnly}
+	if dryRun {
+		ix.log(ctx).infof("[dry-run] onboarding document: %s", path)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		ix.log(ctx).warnf("could not create onboarding dir %q: %v", filepath.Dir(path), err)
+	}
+}
+
+// recordOnboarding notes the onboarding document on result once Codex has
+// finished, warning when Codex did not write it.
+func (ix *indexer) recordOnboarding(ctx context.Context, result *RepoResult, m *indexManifest) {
+	if m.Onboarding == nil {
+		return
+	}
+	_, err := os.Stat(m.Onboarding.Path)
+	switch {
+	case err == nil:
+		result.OnboardingPath = m.Onboarding.Path
+		ix.log(ctx).infof("onboarding document: %s", m.Onboarding.Path)
+	case errors.Is(err, os.ErrNotExist):
+		ix.log(ctx).warnf("Codex did not write the onboarding document %s", m.Onboarding.Path)
+	default:
+		ix.log(ctx).warnf("could not check onboarding document: %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package indexer
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunResultsOnboarding(t *testing.T) {
+	tests := map[string]struct {
+		only      bool
+		write     bool
+		wantCache bool
+	}{
+		"alongside the store": {write: true, wantCache: true},
+		"onboarding only":     {only: true, write: true},
+		"not written":         {wantCache: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			rootDir := t.TempDir()
+			initGitRepo(t, filepath.Join(rootDir, "api"))
+			outDir := t.TempDir()
+			onboardingDir := filepath.Join(outDir, "onboarding")
+			docPath := filepath.Join(onboardingDir, "api", onboardingFileName)
+
+			stub := "#!/bin/sh\ncp \"$INDEX_MANIFEST_PATH\" " + filepath.Join(outDir, "manifest.json") + "\n"
+			if tc.write {
+				stub += "echo '# api' > " + docPath + "\n"
+			}
+			codexPath := filepath.Join(t.TempDir(), "codex")
+			if err := os.WriteFile(codexPath, []byte(stub), 0o755); err != nil {
+				t.Fatalf("write codex stub: %v", err)
+			}
+
+			cachePath := filepath.Join(outDir, "cache.json")
+			results, err := RunResults(Options{
+				RootDir:        rootDir,
+				SummaryJSON:    filepath.Join(outDir, "summary.json"),
+				CachePath:      cachePath,
+				CodexPath:      codexPath,
+				OnboardingDir:  onboardingDir,
+				OnboardingOnly: tc.only,
+			})
+			if err != nil {
+				t.Fatalf("run indexer: %v", err)
+			}
+			api := results[0]
+			if api.Error != "" {
+				t.Fatalf("unexpected error: %s", api.Error)
+			}
+			if wantPath := map[bool]string{true: docPath}[tc.write]; api.OnboardingPath != wantPath {
+				t.Fatalf("expected onboarding path %q, got %q", wantPath, api.OnboardingPath)
+			}
+
+			data, err := os.ReadFile(filepath.Join(outDir, "manifest.json"))
+			if err != nil {
+				t.Fatalf("read manifest copy: %v", err)
+			}
+			var m indexManifest
+			if err := json.Unmarshal(data, &m); err != nil {
+				t.Fatalf("decode manifest: %v", err)
+			}
+			if m.Onboarding == nil || *m.Onboarding != (manifestOnboarding{Path: docPath, Only: tc.only}) {
+				t.Fatalf("unexpected manifest onboarding: %+v", m.Onboarding)
+			}
+
+			cache, err := loadCommitCache(cachePath)
+			if err != nil {
+				t.Fatalf("load cache: %v", err)
+			}
+			if _, ok := cache.LastCommit("api", api.DefaultBranch); ok != tc.wantCache {
+				t.Fatalf("expected cached=%t for %s", tc.wantCache, api.DefaultBranch)
+			}
+		})
+	}
+}
+
+func TestRunResultsOnboardingOnlyRequiresDir(t *testing.T) {
+	_, err := RunResults(Options{RootDir: t.TempDir(), OnboardingOnly: true})
+	if err == nil || !strings.Contains(err.Error(), "onboarding dir") {
+		t.Fatalf("expected onboarding dir error, got %v", err)
+	}
+}
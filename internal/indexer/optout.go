@@ -0,0 +1,58 @@
+package indexer
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Repo owners opt a repo out of indexing by committing or creating either
+// marker at its root: an empty .noindex file, or a .ai-indexer file with an
+// "ai-indexer: disabled" line.
+const (
+	noIndexMarker   = ".noindex"
+	aiIndexerMarker = ".ai-indexer"
+	// optOutMaxLine bounds the lines read from .ai-indexer.
+	optOutMaxLine = 4096
+)
+
+// optOutMarker returns the marker file that opts repoDir out of indexing,
+// or "" when there is none.
+func optOutMarker(repoDir string) string {
+	if info, err := os.Stat(filepath.Join(repoDir, noIndexMarker)); err == nil && !info.IsDir() {
+		return noIndexMarker
+	}
+	disabled, err := hasOptOutDirective(filepath.Join(repoDir, aiIndexerMarker))
+	if err == nil && disabled {
+		return aiIndexerMarker
+	}
+	return ""
+}
+
+// hasOptOutDirective reports whether the file at path has a line reading
+// "ai-indexer: disabled", ignoring case, surrounding space, and "#"
+// comments.
+func hasOptOutDirective(path string) (bool, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, optOutMaxLine), optOutMaxLine)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(key), "ai-indexer") &&
+			strings.EqualFold(strings.TrimSpace(value), "disabled") {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
@@ -0,0 +1,89 @@
+package indexer
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOptOutMarker(t *testing.T) {
+	tests := map[string]struct {
+		files map[string]string
+		want  string
+	}{
+		"none":    {},
+		"noindex": {files: map[string]string{".noindex": ""}, want: noIndexMarker},
+		"directive": {
+			files: map[string]string{".ai-indexer": "# owners: data team\nai-indexer: disabled\n"},
+			want:  aiIndexerMarker,
+		},
+		"spacing": {
+			files: map[string]string{".ai-indexer": "  AI-Indexer :  Disabled  # sensitive\n"},
+			want:  aiIndexerMarker,
+		},
+		"enabled":   {files: map[string]string{".ai-indexer": "ai-indexer: enabled\n"}},
+		"commented": {files: map[string]string{".ai-indexer": "# ai-indexer: disabled\n"}},
+		"both": {
+			files: map[string]string{".noindex": "", ".ai-indexer": "ai-indexer: disabled\n"},
+			want:  noIndexMarker,
+		},
+		"other file": {files: map[string]string{"README.md": "ai-indexer: disabled\n"}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			repoDir := t.TempDir()
+			for file, content := range tc.files {
+				if err := os.WriteFile(filepath.Join(repoDir, file), []byte(content), 0o644); err != nil {
+					t.Fatalf("write %s: %v", file, err)
+				}
+			}
+			if got := optOutMarker(repoDir); got != tc.want {
+				t.Fatalf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRunResultsOptOut(t *testing.T) {
+	rootDir := t.TempDir()
+	initGitRepo(t, filepath.Join(rootDir, "api"))
+	initGitRepo(t, filepath.Join(rootDir, "payroll"))
+	if err := os.WriteFile(filepath.Join(rootDir, "payroll", ".noindex"), nil, 0o644); err != nil {
+		t.Fatalf("write marker: %v", err)
+	}
+
+	summaryPath := filepath.Join(t.TempDir(), "summary.json")
+	results, err := RunResults(Options{RootDir: rootDir, SummaryJSON: summaryPath, DryRun: true})
+	if err != nil {
+		t.Fatalf("run indexer: %v", err)
+	}
+	api, payroll := results[0], results[1]
+	if api.OptedOut || api.SkipReason != "" {
+		t.Fatalf("expected api to be indexed, got %+v", api)
+	}
+	var skipped *Skipped
+	if !payroll.OptedOut || !errors.As(payroll.Err, &skipped) || payroll.SkipReason != SkipReasonExcludedByMarker ||
+		payroll.SkipDetail != "repo opted out via .noindex" {
+		t.Fatalf("expected payroll to be opted out, got %+v", payroll)
+	}
+	if got := formatCodexStatus(&payroll); got != "opted out" {
+		t.Fatalf("expected the summary to show the opt-out, got %q", got)
+	}
+
+	data, err := os.ReadFile(summaryPath)
+	if err != nil {
+		t.Fatalf("read summary: %v", err)
+	}
+	var summary struct {
+		Repos []RepoResult `json:"repos"`
+	}
+	if err := json.Unmarshal(data, &summary); err != nil {
+		t.Fatalf("decode summary: %v", err)
+	}
+	if len(summary.Repos) != 2 || !summary.Repos[1].OptedOut {
+		t.Fatalf("expected the JSON summary to record the opt-out, got %+v", summary.Repos)
+	}
+}
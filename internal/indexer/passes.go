@@ -0,0 +1,268 @@
+package indexer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Indexing profiles add built-in passes to every repo's pipeline.
+const (
+	ProfileDefault  = ""
+	ProfileSecurity = "security"
+	ProfileInfra    = "infra"
+)
+
+// defaultPass is the standard indexing pass, named when a built-in pass
+// turns a single run into a pipeline.
+var defaultPass = PassConfig{
+	Name:   "index",
+	Prompt: "Index the repository as described above.",
+}
+
+// securityPass is added by --profile security.
+var securityPass = PassConfig{
+	Name:   "security",
+	Prompt: securityPassPrompt,
+}
+
+// infraPass is added by --profile infra to repos with infrastructure as
+// code.
+var infraPass = PassConfig{
+	Name:   "infra",
+	Prompt: infraPassPrompt,
+}
+
+// expertisePass is added by --expertise.
+var expertisePass = PassConfig{
+	Name:   "expertise",
+	Prompt: expertisePassPrompt,
+}
+
+// changelogPass is added by --changelog.
+var changelogPass = PassConfig{
+	Name:   "changelog",
+	Prompt: changelogPassPrompt,
+}
+
+// issuesPass is added by --github-issues.
+var issuesPass = PassConfig{
+	Name:   "issues",
+	Prompt: issuesPassPrompt,
+}
+
+// ciPass is added by --ci-pipelines to repos with CI configuration.
+var ciPass = PassConfig{
+	Name:   "ci",
+	Prompt: ciPassPrompt,
+}
+
+// dataModelPass is added by --data-model to repos with database schemas.
+var dataModelPass = PassConfig{
+	Name:   "data_model",
+	Prompt: dataModelPassPrompt,
+}
+
+// PassConfig is one Codex invocation of a multi-pass indexing pipeline,
+// e.g. an architecture pass followed by an API pass.
+type PassConfig struct {
+	// Name identifies the pass in logs, the manifest, and results.
+	Name string `json:"name"`
+	// Prompt is the pass's focus, appended to the standard prompt.
+	Prompt string `json:"prompt"`
+	// Timeout bounds this pass, e.g. "20m"; empty uses --codex-timeout.
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// PassResult is the outcome of one pipeline pass.
+type PassResult struct {
+	// Err is why the pass failed: *AgentTimeout, *AgentExitError, or
+	// another error.
+	Err           error  `json:"-"`
+	CodexExitCode *int   `json:"codex_exit_code,omitempty"`
+	Name          string `json:"name"`
+	Error         string `json:"error,omitempty"`
+	ErrorKind     string `json:"error_kind,omitempty"`
+	DurationMS    int64  `json:"duration_ms"`
+	CodexRan      bool   `json:"codex_ran"`
+}
+
+// indexPass is a resolved Codex invocation: the whole prompt and timeout.
+type indexPass struct {
+	name    string
+	prompt  string
+	timeout time.Duration
+}
+
+// manifestPass tells Codex which pipeline pass it is running.
+type manifestPass struct {
+	Name   string `json:"name"`
+	Number int    `json:"number"`
+	Count  int    `json:"count"`
+}
+
+// validatePasses checks a configured pipeline: every pass needs a unique
+// name and a prompt, and timeouts must parse as positive durations.
+func validatePasses(passes []PassConfig) error {
+	seen := make(map[string]bool, len(passes))
+	for i, pc := range passes {
+		switch {
+		case pc.Name == "":
+			return fmt.Errorf("pass %d: name is required", i+1)
+		case seen[pc.Name]:
+			return fmt.Errorf("pass %q: duplicate name", pc.Name)
+		case pc.Prompt == "":
+			return fmt.Errorf("pass %q: prompt is required", pc.Name)
+		}
+		seen[pc.Name] = true
+		if pc.Timeout == "" {
+			continue
+		}
+		d, err := time.ParseDuration(pc.Timeout)
+		if err != nil {
+			return fmt.Errorf("pass %q: timeout: %w", pc.Name, err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("pass %q: timeout must be positive", pc.Name)
+		}
+	}
+	return nil
+}
+
+// indexPasses returns the Codex invocations for a repo: its configured
+// pipeline, or a single pass with the standard prompt.
+func (ix *indexer) indexPasses(settings repoSettings, m *indexManifest) []indexPass {
+	configs := ix.builtinPasses(settings.passes, m)
+	if len(configs) == 0 {
+		return []indexPass{{prompt: ix.ingestPrompt(codexPrompt), timeout: ix.opts.CodexTimeout}}
+	}
+
+	passes := make([]indexPass, 0, len(configs))
+	for i, pc := range configs {
+		timeout := ix.opts.CodexTimeout
+		if pc.Timeout != "" {
+			// Validated by LoadConfig.
+			timeout, _ = time.ParseDuration(pc.Timeout)
+		}
+		passes = append(passes, indexPass{
+			name:    pc.Name,
+			prompt:  ix.ingestPrompt(passPrompt(pc, i+1, len(configs))),
+			timeout: timeout,
+		})
+	}
+	return passes
+}
+
+// ingestPrompt appends the direct ingestion instructions to prompt under
+// --ingest direct.
+func (ix *indexer) ingestPrompt(prompt string) string {
+	if ix.opts.Ingest == IngestDirect {
+		return prompt + directOutputPrompt
+	}
+	return prompt
+}
+
+// builtinPasses appends the passes enabled by options (--profile,
+// --expertise, --changelog, --github-issues, --ci-pipelines, --data-model)
+// to configured, running the standard pass first when no pipeline is
+// configured. The infra, CI, and data model passes only run when m lists
+// what they summarize. A configured pass of the same name is kept instead
+// of the built-in one.
+func (ix *indexer) builtinPasses(configured []PassConfig, m *indexManifest) []PassConfig {
+	var extra []PassConfig
+	switch {
+	case ix.opts.Profile == ProfileSecurity:
+		extra = append(extra, securityPass)
+	case ix.opts.Profile == ProfileInfra && m != nil && m.Infra != nil:
+		extra = append(extra, infraPass)
+	}
+	if ix.opts.Expertise {
+		extra = append(extra, expertisePass)
+	}
+	if ix.opts.Changelog {
+		extra = append(extra, changelogPass)
+	}
+	if ix.opts.GitHubIssues {
+		extra = append(extra, issuesPass)
+	}
+	if ix.opts.CIPipelines && m != nil && len(m.CI) > 0 {
+		extra = append(extra, ciPass)
+	}
+	if ix.opts.DataModel && m != nil && m.Schema != nil {
+		extra = append(extra, dataModelPass)
+	}
+	if len(extra) == 0 {
+		return configured
+	}
+
+	if len(configured) == 0 {
+		configured = []PassConfig{defaultPass}
+	}
+	passes := slices.Clip(configured)
+	for _, pass := range extra {
+		if !slices.ContainsFunc(configured, func(pc PassConfig) bool { return pc.Name == pass.Name }) {
+			passes = append(passes, pass)
+		}
+	}
+	return passes
+}
+
+// promptCacheKey is the commit cache branch key under which the hash of
+// the prompts a repo was indexed with is recorded. Branch names cannot
+// contain ':', so it never collides with a branch.
+const promptCacheKey = "prompt:sha256"
+
+// promptHashLen is the number of hex digits kept of a prompt hash.
+const promptHashLen = 16
+
+// promptHash fingerprints the prompts Codex is given for a repo with
+// settings: the standard prompt, the configured pipeline, and the passes
+// enabled by options. Passes that only run when a repo has infrastructure,
+// CI, or schemas count as present, so the hash does not change with the
+// repo's contents.
+func (ix *indexer) promptHash(settings repoSettings) string {
+	all := &indexManifest{Infra: &manifestInfra{}, CI: []ciConfig{{}}, Schema: &manifestSchema{}}
+	h := sha256.New()
+	if ix.opts.Ingest == IngestLocal {
+		// No agent runs, so the generated summaries stand in for the prompts.
+		fmt.Fprintf(h, "%s\x00", IngestLocal)
+	}
+	for _, pass := range ix.indexPasses(settings, all) {
+		fmt.Fprintf(h, "%s\x00%s\x00", pass.name, pass.prompt)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:promptHashLen]
+}
+
+// passPrompt appends a pass's focus to the standard prompt.
+func passPrompt(pc PassConfig, number, count int) string {
+	return codexPrompt + fmt.Sprintf(`
+Multi-pass pipeline:
+This run is pass %d of %d (%q) of a pipeline that indexes this repo in
+several focused passes; the manifest's "pass" field says the same. Earlier
+passes may already have written documents to the collection: extend and
+refine them rather than duplicating them, and limit this pass to its focus:
+
+%s
+`, number, count, pc.Name, pc.Prompt)
+}
+
+// longestPrompt returns the largest prompt among passes, for budgeting.
+func longestPrompt(passes []indexPass) string {
+	var longest string
+	for _, p := range passes {
+		if len(p.prompt) > len(longest) {
+			longest = p.prompt
+		}
+	}
+	return longest
+}
+
+// passError names the failed pass while keeping err's type for errors.As.
+func passError(name string, err error) error {
+	if name == "" {
+		return err
+	}
+	return fmt.Errorf("pass %s: %w", name, err)
+}
@@ -0,0 +1,351 @@
+package indexer
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidatePasses(t *testing.T) {
+	tests := map[string]struct {
+		passes  []PassConfig
+		wantErr string
+	}{
+		"none": {},
+		"valid": {
+			passes: []PassConfig{
+				{Name: "architecture", Prompt: "Map the components.", Timeout: "20m"},
+				{Name: "api", Prompt: "Document the public API."},
+			},
+		},
+		"missing name": {
+			passes:  []PassConfig{{Prompt: "x"}},
+			wantErr: "pass 1: name is required",
+		},
+		"duplicate name": {
+			passes:  []PassConfig{{Name: "api", Prompt: "x"}, {Name: "api", Prompt: "y"}},
+			wantErr: "duplicate name",
+		},
+		"missing prompt": {
+			passes:  []PassConfig{{Name: "api"}},
+			wantErr: "prompt is required",
+		},
+		"bad timeout": {
+			passes:  []PassConfig{{Name: "api", Prompt: "x", Timeout: "soon"}},
+			wantErr: "timeout",
+		},
+		"negative timeout": {
+			passes:  []PassConfig{{Name: "api", Prompt: "x", Timeout: "-1m"}},
+			wantErr: "must be positive",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := validatePasses(tc.passes)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestIndexPasses(t *testing.T) {
+	ix := newIndexer(nil, nil, nil, nil, Options{CodexTimeout: time.Hour})
+
+	single := ix.indexPasses(repoSettings{}, nil)
+	if len(single) != 1 || single[0].name != "" || single[0].prompt != codexPrompt || single[0].timeout != time.Hour {
+		t.Fatalf("expected one standard pass, got %+v", single)
+	}
+
+	passes := ix.indexPasses(repoSettings{passes: []PassConfig{
+		{Name: "architecture", Prompt: "Map the components.", Timeout: "20m"},
+		{Name: "api", Prompt: "Document the public API."},
+	}}, nil)
+	if len(passes) != 2 {
+		t.Fatalf("expected 2 passes, got %d", len(passes))
+	}
+	if passes[0].timeout != 20*time.Minute || passes[1].timeout != time.Hour {
+		t.Fatalf("expected pass timeout then the default, got %s and %s", passes[0].timeout, passes[1].timeout)
+	}
+	if !strings.HasPrefix(passes[1].prompt, codexPrompt) ||
+		!strings.Contains(passes[1].prompt, `pass 2 of 2 ("api")`) ||
+		!strings.Contains(passes[1].prompt, "Document the public API.") {
+		t.Fatalf("expected the standard prompt plus the pass focus, got %q", passes[1].prompt[len(codexPrompt):])
+	}
+}
+
+func TestResolveRepoSettingsPasses(t *testing.T) {
+	global := []PassConfig{{Name: "overview", Prompt: "x"}}
+	api := []PassConfig{{Name: "architecture", Prompt: "y"}, {Name: "api", Prompt: "z"}}
+	cfg := &Config{
+		Passes: global,
+		Repos: map[string]RepoConfig{
+			"api": {Passes: api},
+			"web": {Codegen: "make generate"},
+		},
+	}
+	ix := newIndexer(nil, nil, nil, cfg, Options{})
+
+	tests := map[string][]PassConfig{
+		"api": api,
+		"web": global,
+	}
+	for name, want := range tests {
+		t.Run(name, func(t *testing.T) {
+			rootDir := t.TempDir()
+			repoDir := filepath.Join(rootDir, name)
+			initGitRepo(t, repoDir)
+			settings, err := ix.resolveRepoSettings(t.Context(), newRepoIdentity(rootDir, repoDir, name), repoDir)
+			if err != nil {
+				t.Fatalf("resolve settings: %v", err)
+			}
+			if len(settings.passes) != len(want) || settings.passes[0].Name != want[0].Name {
+				t.Fatalf("expected passes %+v, got %+v", want, settings.passes)
+			}
+		})
+	}
+}
+
+func TestRunResultsPasses(t *testing.T) {
+	passes := []PassConfig{
+		{Name: "architecture", Prompt: "Map the components."},
+		{Name: "api", Prompt: "Document the public API."},
+	}
+
+	t.Run("dry run", func(t *testing.T) {
+		t.Parallel()
+		rootDir := t.TempDir()
+		initGitRepo(t, filepath.Join(rootDir, "api"))
+		configPath := writePassesConfig(t, passes)
+
+		results, err := RunResults(Options{
+			RootDir:     rootDir,
+			SummaryJSON: filepath.Join(t.TempDir(), "summary.json"),
+			ConfigPath:  configPath,
+			DryRun:      true,
+		})
+		if err != nil {
+			t.Fatalf("run indexer: %v", err)
+		}
+		got := results[0].Passes
+		if len(got) != 2 || got[0].Name != "architecture" || got[1].Name != "api" {
+			t.Fatalf("expected both passes recorded in order, got %+v", got)
+		}
+		if got[0].CodexRan || got[0].Error != "" {
+			t.Fatalf("expected dry-run passes not to run Codex, got %+v", got[0])
+		}
+	})
+
+	t.Run("failed pass stops the pipeline", func(t *testing.T) {
+		t.Parallel()
+		rootDir := t.TempDir()
+		initGitRepo(t, filepath.Join(rootDir, "api"))
+		configPath := writePassesConfig(t, passes)
+
+		outDir := t.TempDir()
+		codexPath := filepath.Join(t.TempDir(), "codex")
+		stub := "#!/bin/sh\ncp \"$INDEX_MANIFEST_PATH\" " + filepath.Join(outDir, "manifest.json") + "\nexit 3\n"
+		if err := os.WriteFile(codexPath, []byte(stub), 0o755); err != nil {
+			t.Fatalf("write codex stub: %v", err)
+		}
+
+		results, err := RunResults(Options{
+			RootDir:     rootDir,
+			SummaryJSON: filepath.Join(outDir, "summary.json"),
+			ConfigPath:  configPath,
+			CodexPath:   codexPath,
+		})
+		if err != nil {
+			t.Fatalf("run indexer: %v", err)
+		}
+		api := results[0]
+		if len(api.Passes) != 1 || api.Passes[0].Name != "architecture" {
+			t.Fatalf("expected only the first pass to run, got %+v", api.Passes)
+		}
+		pass := api.Passes[0]
+		if !pass.CodexRan || pass.ErrorKind != ErrorKindAgentExit || pass.CodexExitCode == nil || *pass.CodexExitCode != 3 {
+			t.Fatalf("expected the first pass to fail with exit 3, got %+v", pass)
+		}
+		var exitErr *AgentExitError
+		if !errors.As(api.Err, &exitErr) || !strings.Contains(api.Error, "pass architecture") {
+			t.Fatalf("expected the repo to fail with the pass error, got %v", api.Err)
+		}
+
+		data, err := os.ReadFile(filepath.Join(outDir, "manifest.json"))
+		if err != nil {
+			t.Fatalf("read manifest copy: %v", err)
+		}
+		var m indexManifest
+		if err := json.Unmarshal(data, &m); err != nil {
+			t.Fatalf("decode manifest: %v", err)
+		}
+		if m.Pass == nil || *m.Pass != (manifestPass{Name: "architecture", Number: 1, Count: 2}) {
+			t.Fatalf("expected the manifest to name the pass, got %+v", m.Pass)
+		}
+	})
+}
+
+func writePassesConfig(t *testing.T, passes []PassConfig) string {
+	t.Helper()
+	data, err := json.Marshal(Config{Passes: passes})
+	if err != nil {
+		t.Fatalf("encode config: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return path
+}
+
+func TestBuiltinPasses(t *testing.T) {
+	configured := []PassConfig{{Name: "architecture", Prompt: "x"}, {Name: "api", Prompt: "y"}}
+	tests := map[string]struct {
+		profile    string
+		configured []PassConfig
+		want       []string
+		expertise  bool
+		changelog  bool
+		issues     bool
+	}{
+		"default profile":             {configured: configured, want: []string{"architecture", "api"}},
+		"default profile no pipeline": {},
+		"security":                    {profile: ProfileSecurity, want: []string{"index", "security"}},
+		"security after pipeline": {
+			profile:    ProfileSecurity,
+			configured: configured,
+			want:       []string{"architecture", "api", "security"},
+		},
+		"security already configured": {
+			profile:    ProfileSecurity,
+			configured: []PassConfig{{Name: "security", Prompt: "custom"}},
+			want:       []string{"security"},
+		},
+		"expertise": {expertise: true, want: []string{"index", "expertise"}},
+		"all built-in passes": {
+			profile:    ProfileSecurity,
+			configured: configured,
+			expertise:  true,
+			changelog:  true,
+			issues:     true,
+			want:       []string{"architecture", "api", "security", "expertise", "changelog", "issues"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ix := newIndexer(nil, nil, nil, nil, Options{
+				Profile:      tc.profile,
+				Expertise:    tc.expertise,
+				Changelog:    tc.changelog,
+				GitHubIssues: tc.issues,
+			})
+			passes := ix.indexPasses(repoSettings{passes: tc.configured}, nil)
+			var got []string
+			for _, p := range passes {
+				if p.name != "" {
+					got = append(got, p.name)
+				}
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Fatalf("expected passes %v, got %v", tc.want, got)
+			}
+		})
+	}
+
+	ix := newIndexer(nil, nil, nil, nil, Options{Profile: ProfileSecurity})
+	passes := ix.indexPasses(repoSettings{}, nil)
+	if !strings.Contains(passes[1].prompt, "security_concept") {
+		t.Fatalf("expected the security pass prompt, got %q", passes[1].prompt[len(codexPrompt):])
+	}
+	ix = newIndexer(nil, nil, nil, nil, Options{Expertise: true})
+	passes = ix.indexPasses(repoSettings{}, nil)
+	if !strings.Contains(passes[1].prompt, "Expertise map") {
+		t.Fatalf("expected the expertise pass prompt, got %q", passes[1].prompt[len(codexPrompt):])
+	}
+	ix = newIndexer(nil, nil, nil, nil, Options{Profile: ProfileInfra})
+	if passes := ix.indexPasses(repoSettings{}, &indexManifest{}); len(passes) != 1 || passes[0].name != "" {
+		t.Fatalf("expected no infra pass without infrastructure, got %+v", passes)
+	}
+	passes = ix.indexPasses(repoSettings{}, &indexManifest{Infra: &manifestInfra{Helm: []string{"charts/api"}}})
+	if len(passes) != 2 || passes[1].name != "infra" || !strings.Contains(passes[1].prompt, "infra_summary") {
+		t.Fatalf("expected the infra pass, got %+v", passes)
+	}
+
+	ix = newIndexer(nil, nil, nil, nil, Options{DataModel: true})
+	if passes := ix.indexPasses(repoSettings{}, &indexManifest{}); len(passes) != 1 || passes[0].name != "" {
+		t.Fatalf("expected no data model pass without a schema, got %+v", passes)
+	}
+	passes = ix.indexPasses(repoSettings{}, &indexManifest{Schema: &manifestSchema{Sqlc: []string{"sqlc.yaml"}}})
+	if len(passes) != 2 || passes[1].name != "data_model" || !strings.Contains(passes[1].prompt, "DATA/<table>") {
+		t.Fatalf("expected the data model pass, got %+v", passes)
+	}
+
+	ix = newIndexer(nil, nil, nil, nil, Options{CIPipelines: true})
+	if passes := ix.indexPasses(repoSettings{}, &indexManifest{}); len(passes) != 1 || passes[0].name != "" {
+		t.Fatalf("expected no CI pass without CI configuration, got %+v", passes)
+	}
+	m := &indexManifest{CI: []ciConfig{{System: ciJenkins, Path: "Jenkinsfile"}}}
+	passes = ix.indexPasses(repoSettings{}, m)
+	if len(passes) != 2 || passes[1].name != "ci" || !strings.Contains(passes[1].prompt, "ci_pipeline") {
+		t.Fatalf("expected the CI pass, got %+v", passes)
+	}
+	if len(configured) != 2 {
+		t.Fatalf("expected the configured pipeline not to be modified, got %+v", configured)
+	}
+}
+
+func TestPromptHashForcesReindex(t *testing.T) {
+	plain := newIndexer(io.Discard, io.Discard, nil, nil, Options{})
+	base := plain.promptHash(repoSettings{})
+	if len(base) != promptHashLen || base != plain.promptHash(repoSettings{}) {
+		t.Fatalf("expected a stable %d-digit hash, got %q", promptHashLen, base)
+	}
+	pipeline := plain.promptHash(repoSettings{passes: []PassConfig{{Name: "api", Prompt: "x"}}})
+	infra := newIndexer(io.Discard, io.Discard, nil, nil, Options{Profile: ProfileInfra}).promptHash(repoSettings{})
+	if pipeline == base || infra == base || infra == pipeline {
+		t.Fatalf("expected distinct hashes, got %s, %s, %s", base, pipeline, infra)
+	}
+
+	tests := map[string]struct {
+		recorded string
+		wantSkip bool
+	}{
+		"same prompt":        {recorded: base, wantSkip: true},
+		"no recorded prompt": {wantSkip: true},
+		"changed prompt":     {recorded: pipeline},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			cache, err := loadCommitCache("")
+			if err != nil {
+				t.Fatalf("load cache: %v", err)
+			}
+			cache.Update("api", "main", "aaa")
+			cache.Update("api", promptCacheKey, tc.recorded)
+
+			ix := newIndexer(io.Discard, io.Discard, cache, nil, Options{})
+			skip, cached := ix.evaluateSkip(t.Context(), "api", "main", "aaa", base)
+			if (skip != nil) != tc.wantSkip {
+				t.Fatalf("expected skip=%v, got %+v", tc.wantSkip, skip)
+			}
+			if !tc.wantSkip && cached != "" {
+				t.Fatalf("expected a full reindex, got diff base %q", cached)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package indexer
+
+import (
+	"sync"
+)
+
+// pauseGate holds back new repos while paused; repos already running are
+// not interrupted.
+type pauseGate struct {
+	// resumed is closed on resume; nil while running.
+	resumed chan struct{}
+	mu      sync.Mutex
+}
+
+// pause stops new repos from starting and reports whether the gate was
+// running.
+func (g *pauseGate) pause() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.resumed != nil {
+		return false
+	}
+	g.resumed = make(chan struct{})
+	return true
+}
+
+// resume lets waiting repos start and reports whether the gate was paused.
+func (g *pauseGate) resume() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.resumed == nil {
+		return false
+	}
+	close(g.resumed)
+	g.resumed = nil
+	return true
+}
+
+// paused reports whether new repos are held back.
+func (g *pauseGate) paused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.resumed != nil
+}
+
+// wait blocks while the gate is paused.
+func (g *pauseGate) wait() {
+	for {
+		g.mu.Lock()
+		resumed := g.resumed
+		g.mu.Unlock()
+		if resumed == nil {
+			return
+		}
+		<-resumed
+	}
+}
+
+// setPaused pauses or resumes dispatching and reports the change on the
+// console and in the event stream.
+func (ix *indexer) setPaused(paused bool) {
+	if paused {
+		if !ix.pause.pause() {
+			return
+		}
+		ix.outln(colorize(colorYellow, "Paused: repos in progress will finish, no new repos will start."))
+		ix.emit(Event{Type: EventRunPaused})
+		return
+	}
+	if !ix.pause.resume() {
+		return
+	}
+	ix.outln(colorize(colorYellow, "Resumed."))
+	ix.emit(Event{Type: EventRunResumed})
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package indexer
+
+// watchPauseSignals is a no-op where SIGUSR1 and SIGUSR2 do not exist.
+func (ix *indexer) watchPauseSignals() func() {
+	return func() {}
+}
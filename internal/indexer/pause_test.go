@@ -0,0 +1,78 @@
+package indexer
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPauseGate(t *testing.T) {
+	gate := &pauseGate{}
+	gate.wait()
+
+	if !gate.pause() {
+		t.Fatalf("expected first pause to take effect")
+	}
+	if gate.pause() {
+		t.Fatalf("expected second pause to be a no-op")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		gate.wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatalf("expected wait to block while paused")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	if !gate.resume() {
+		t.Fatalf("expected resume to take effect")
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("expected wait to return after resume")
+	}
+	if gate.resume() {
+		t.Fatalf("expected second resume to be a no-op")
+	}
+}
+
+func TestSetPausedReportsTransitions(t *testing.T) {
+	statusPath := filepath.Join(t.TempDir(), "status.json")
+	var out bytes.Buffer
+	ix := newIndexer(&out, &out, nil, nil, Options{})
+	ix.status = newStatusTracker(statusPath, t.TempDir(), nil, 1, nil)
+
+	readPaused := func() bool {
+		t.Helper()
+		data, err := os.ReadFile(statusPath)
+		if err != nil {
+			t.Fatalf("read status: %v", err)
+		}
+		var doc statusFile
+		if err := json.Unmarshal(data, &doc); err != nil {
+			t.Fatalf("decode status: %v", err)
+		}
+		return doc.Paused
+	}
+
+	ix.setPaused(true)
+	ix.setPaused(true)
+	if !readPaused() {
+		t.Fatalf("expected status file to show paused")
+	}
+	ix.setPaused(false)
+	if readPaused() {
+		t.Fatalf("expected status file to show running")
+	}
+	if got := bytes.Count(out.Bytes(), []byte("Paused:")); got != 1 {
+		t.Fatalf("expected one pause message, got %d in %q", got, out.String())
+	}
+}
@@ -0,0 +1,31 @@
+//go:build unix
+
+package indexer
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchPauseSignals pauses dispatching on SIGUSR1 and resumes it on SIGUSR2
+// until the returned stop function is called.
+func (ix *indexer) watchPauseSignals() func() {
+	sigs := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sigs, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for {
+			select {
+			case sig := <-sigs:
+				ix.setPaused(sig == syscall.SIGUSR1)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
@@ -0,0 +1,33 @@
+//go:build unix
+
+package indexer
+
+import (
+	"io"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWatchPauseSignals(t *testing.T) {
+	ix := newIndexer(io.Discard, io.Discard, nil, nil, Options{})
+	stop := ix.watchPauseSignals()
+	defer stop()
+
+	signalAndWait := func(sig syscall.Signal, wantPaused bool) {
+		t.Helper()
+		if err := syscall.Kill(syscall.Getpid(), sig); err != nil {
+			t.Fatalf("send %v: %v", sig, err)
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for ix.pause.paused() != wantPaused {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected paused=%t after %v", wantPaused, sig)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	signalAndWait(syscall.SIGUSR1, true)
+	signalAndWait(syscall.SIGUSR2, false)
+}
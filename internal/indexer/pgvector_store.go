@@ -0,0 +1,101 @@
+package indexer
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// StoreDSNEnv is the environment variable the CLI reads the pgvector
+// store's connection string from when --store-dsn is not set.
+const StoreDSNEnv = "AI_INDEXER_STORE_DSN"
+
+// pgvectorSchemaName is the Postgres schema holding the store's tables,
+// so they do not collide with the database's own.
+const pgvectorSchemaName = "ai_indexer"
+
+// pgvectorMigrationLock is the advisory lock key that serializes schema
+// migrations of runs starting at the same time.
+const pgvectorMigrationLock = 0x61692d696e6478
+
+// pgvectorSchema migrates the store on first use. It runs as one implicit
+// transaction, so a failed migration leaves nothing behind. Metadata is
+// kept as jsonb so it can be queried with SQL; embeddings have no fixed
+// size, since collections may use different models.
+var pgvectorSchema = fmt.Sprintf(`
+SELECT pg_advisory_xact_lock(%d);
+CREATE EXTENSION IF NOT EXISTS vector;
+CREATE SCHEMA IF NOT EXISTS %s;
+CREATE TABLE IF NOT EXISTS collections (
+	seq      BIGSERIAL NOT NULL,
+	id       TEXT NOT NULL PRIMARY KEY,
+	tenant   TEXT NOT NULL,
+	database TEXT NOT NULL,
+	name     TEXT NOT NULL,
+	metadata JSONB NOT NULL,
+	UNIQUE (tenant, database, name)
+);
+CREATE TABLE IF NOT EXISTS records (
+	seq           BIGSERIAL NOT NULL,
+	collection_id TEXT NOT NULL,
+	id            TEXT NOT NULL,
+	document      TEXT,
+	metadata      JSONB NOT NULL,
+	embedding     vector,
+	PRIMARY KEY (collection_id, id)
+);
+CREATE INDEX IF NOT EXISTS records_collection_seq ON records (collection_id, seq);
+`, pgvectorMigrationLock, pgvectorSchemaName)
+
+var pgvectorDialect = storeDialect{
+	name:     StorePgvector,
+	seq:      "seq",
+	numbered: true,
+	vector:   true,
+}
+
+// pgvectorDSN puts the store's schema first on the search path of dsn,
+// ahead of public, where the vector extension usually lives. A search_path
+// set in dsn wins.
+func pgvectorDSN(dsn string) (string, error) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		var err error
+		if dsn, err = pq.ParseURL(dsn); err != nil {
+			return "", fmt.Errorf("parse pgvector store DSN: %w", err)
+		}
+	}
+	return strings.TrimSpace(fmt.Sprintf("search_path='%s, public' %s", pgvectorSchemaName, dsn)), nil
+}
+
+// openPgvectorStore connects to the Postgres database at dsn and migrates
+// the store's schema, creating the vector extension when it is missing.
+func openPgvectorStore(ctx context.Context, dsn string) (*embeddedStore, error) {
+	dsn, err := pgvectorDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open pgvector store: %w", err)
+	}
+	if _, err := db.ExecContext(ctx, pgvectorSchema); err != nil {
+		return nil, errors.Join(fmt.Errorf("migrate pgvector store: %w", err), db.Close())
+	}
+	return newSQLStore(db, pgvectorDialect, ""), nil
+}
+
+// OpenPgvectorStore connects to the pgvector store at dsn and points opts
+// at it, so every request is served in process. The returned func closes
+// the connection.
+func OpenPgvectorStore(dsn string, opts *ChromaOptions) (func() error, error) {
+	s, err := openPgvectorStore(context.Background(), dsn)
+	if err != nil {
+		return nil, err
+	}
+	opts.transport = handlerTransport{s.mux}
+	return s.Close, nil
+}
@@ -0,0 +1,107 @@
+package indexer
+
+import (
+	"net/http"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestPgvectorDSN(t *testing.T) {
+	tests := map[string]struct {
+		dsn  string
+		want string
+	}{
+		"url": {
+			dsn: "postgres://indexer:secret@db:5432/kb?sslmode=disable",
+			want: "search_path='ai_indexer, public' dbname='kb' host='db' password='secret' port='5432' sslmode='disable' " +
+				"user='indexer'",
+		},
+		"key value": {
+			dsn:  "host=db dbname=kb search_path=knowledge",
+			want: "search_path='ai_indexer, public' host=db dbname=kb search_path=knowledge",
+		},
+		"environment": {
+			want: "search_path='ai_indexer, public'",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := pgvectorDSN(tc.dsn)
+			if err != nil {
+				t.Fatalf("dsn: %v", err)
+			}
+			if got != tc.want {
+				t.Fatalf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestStoreBind(t *testing.T) {
+	query := `SELECT id FROM records WHERE collection_id = ? AND id = ?`
+	if got := (&embeddedStore{dialect: sqliteDialect}).bind(query); got != query {
+		t.Fatalf("expected the SQLite query unchanged, got %q", got)
+	}
+	want := `SELECT id FROM records WHERE collection_id = $1 AND id = $2`
+	if got := (&embeddedStore{dialect: pgvectorDialect}).bind(query); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+// TestPgvectorStore runs against the Postgres database in
+// AI_INDEXER_TEST_PG_DSN, which needs the vector extension available.
+func TestPgvectorStore(t *testing.T) {
+	dsn := os.Getenv("AI_INDEXER_TEST_PG_DSN")
+	if dsn == "" {
+		t.Skip("AI_INDEXER_TEST_PG_DSN is not set")
+	}
+	var opts ChromaOptions
+	closeStore, err := OpenPgvectorStore(dsn, &opts)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { _ = closeStore() })
+
+	client := newChromaClient(opts)
+	name := "pgvector_test_" + newEmbeddedID()[:8]
+	col, err := client.createCollection(t.Context(), name, map[string]any{"hnsw:space": "cosine"})
+	if err != nil {
+		t.Fatalf("create collection: %v", err)
+	}
+	t.Cleanup(func() { _ = client.deleteCollection(t.Context(), name) })
+	north := "north"
+	err = client.upsertRecords(t.Context(), col.ID, chromaRecords{
+		IDs:        []string{"north", "east", "northeast", "bare"},
+		Documents:  []*string{&north, nil, nil, nil},
+		Metadatas:  []map[string]any{{"kind": "concept"}, {}, {}, {}},
+		Embeddings: [][]float64{{0, 1}, {1, 0}, {1, 1}, nil},
+	})
+	if err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	if n, err := client.countRecords(t.Context(), col.ID); err != nil || n != 4 {
+		t.Fatalf("expected 4 records, got %d (%v)", n, err)
+	}
+
+	query := func(req map[string]any) [][]string {
+		t.Helper()
+		var got struct {
+			IDs [][]string `json:"ids"`
+		}
+		req["query_embeddings"] = [][]float64{{0.1, 1}}
+		err := client.do(t.Context(), http.MethodPost, client.collectionsPath()+"/"+col.ID+"/query", req, &got)
+		if err != nil {
+			t.Fatalf("query: %v", err)
+		}
+		return got.IDs
+	}
+	if got, want := query(map[string]any{"n_results": 2}), [][]string{{"north", "northeast"}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	filtered := query(map[string]any{"n_results": 2, "where": map[string]any{"kind": map[string]any{"$ne": "concept"}}})
+	if want := [][]string{{"northeast", "east"}}; !reflect.DeepEqual(filtered, want) {
+		t.Fatalf("expected %v, got %v", want, filtered)
+	}
+}
@@ -0,0 +1,49 @@
+package indexer
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+)
+
+// dryRunDiffPreviewFiles caps how many changed files a dry run lists per repo.
+const dryRunDiffPreviewFiles = 20
+
+// previewTip returns the remote-tracking tip of branch as of the last fetch,
+// which is what a real run would index, or "" when it cannot be resolved and
+// the checkout's HEAD should be previewed instead.
+func (ix *indexer) previewTip(ctx context.Context, repoDir, branch string, settings repoSettings) string {
+	if branch == "" || settings.remote == "" {
+		return ""
+	}
+	ref := settings.remoteName + "/" + branch
+	cmd := exec.CommandContext(ctx, "git", "-C", repoDir, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	out, err := procOutput(ctx, cmd)
+	if err != nil {
+		return ""
+	}
+	tip := strings.TrimSpace(string(out))
+	ix.log(ctx).infof("[dry-run] previewing %s at %s (as of the last fetch)", ref, shortCommit(tip))
+	return tip
+}
+
+// previewDiff prints the diff base and a truncated list of changed files so
+// a dry run shows whether the incremental path would trigger.
+func (ix *indexer) previewDiff(ctx context.Context, baseCommit string, diff []diffEntry) {
+	if baseCommit == "" {
+		ix.log(ctx).infof("[dry-run] no diff base — would index the full repository")
+		return
+	}
+	ix.log(ctx).infof("[dry-run] diff base: %s", shortCommit(baseCommit))
+	for i, entry := range diff {
+		if i == dryRunDiffPreviewFiles {
+			ix.log(ctx).infof("[dry-run]   ... and %d more", len(diff)-i)
+			break
+		}
+		if entry.OldPath != "" {
+			ix.log(ctx).infof("[dry-run]   %s %s -> %s", entry.Status, entry.OldPath, entry.Path)
+		} else {
+			ix.log(ctx).infof("[dry-run]   %s %s", entry.Status, entry.Path)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package indexer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPreviewDiff(t *testing.T) {
+	tests := map[string]struct {
+		base      string
+		files     int
+		want      []string
+		notWanted []string
+	}{
+		"full index": {
+			want: []string{"would index the full repository"},
+		},
+		"short list": {
+			base:  "0123456789abcdef",
+			files: 2,
+			want:  []string{"diff base: 0123456", "M file-0.go", "M file-1.go"},
+		},
+		"truncated": {
+			base:      "0123456789abcdef",
+			files:     dryRunDiffPreviewFiles + 5,
+			want:      []string{"file-19.go", "... and 5 more"},
+			notWanted: []string{"file-20.go"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			ix := newIndexer(&out, io.Discard, nil, nil, Options{})
+			var diff []diffEntry
+			for i := range tc.files {
+				diff = append(diff, diffEntry{Path: fmt.Sprintf("file-%d.go", i), Status: "M"})
+			}
+
+			ix.previewDiff(t.Context(), tc.base, diff)
+
+			for _, want := range tc.want {
+				if !strings.Contains(out.String(), want) {
+					t.Fatalf("expected %q in output:\n%s", want, out.String())
+				}
+			}
+			for _, notWanted := range tc.notWanted {
+				if strings.Contains(out.String(), notWanted) {
+					t.Fatalf("did not expect %q in output:\n%s", notWanted, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestPreviewTipUsesRemoteTrackingRef(t *testing.T) {
+	root := t.TempDir()
+	upstream := filepath.Join(root, "upstream")
+	initGitRepo(t, upstream)
+	checkout := filepath.Join(root, "checkout")
+	if err := runGit(root, "clone", "--quiet", upstream, checkout); err != nil {
+		t.Fatalf("git clone: %v", err)
+	}
+	base, err := headCommit(t.Context(), checkout)
+	if err != nil {
+		t.Fatalf("head commit: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(upstream, "new.go"), []byte("package x\n"), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if err := runGit(upstream, "add", "."); err != nil {
+		t.Fatalf("git add: %v", err)
+	}
+	if err := runGit(upstream, "commit", "-m", "ahead"); err != nil {
+		t.Fatalf("git commit: %v", err)
+	}
+	if err := runGit(checkout, "fetch", "--quiet", "origin"); err != nil {
+		t.Fatalf("git fetch: %v", err)
+	}
+	want, err := headCommit(t.Context(), upstream)
+	if err != nil {
+		t.Fatalf("head commit: %v", err)
+	}
+
+	ix := newIndexer(io.Discard, io.Discard, nil, nil, Options{DryRun: true})
+	tip := ix.previewTip(t.Context(), checkout, "trunk", repoSettings{remoteName: "origin", remote: upstream})
+	if tip != want {
+		t.Fatalf("expected tip %s, got %s", want, tip)
+	}
+
+	entries, err := diffEntriesBetween(t.Context(), checkout, base, tip)
+	if err != nil {
+		t.Fatalf("diff: %v", err)
+	}
+	if !slices.Equal(diffPaths(entries), []string{"new.go"}) {
+		t.Fatalf("expected [new.go], got %v", entries)
+	}
+}
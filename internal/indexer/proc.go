@@ -0,0 +1,172 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// procStartRetries is how many times a child process that could not
+	// start for lack of file descriptors is started again.
+	procStartRetries = 3
+	// procBackoffMin and procBackoffMax bound the pause before new child
+	// processes start after one ran out of file descriptors. The pause
+	// doubles with each exhaustion and resets after a clean run.
+	procBackoffMin = 500 * time.Millisecond
+	procBackoffMax = 30 * time.Second
+)
+
+// procGuard bounds the child processes running at once across workers and
+// pauses new ones after descriptors run out. A nil procGuard never blocks.
+type procGuard struct {
+	// onBackoff, when set, is told about each pause.
+	onBackoff   func(time.Duration)
+	slots       slots
+	pausedUntil time.Time
+	delay       time.Duration
+	mu          sync.Mutex
+}
+
+type procGuardKey struct{}
+
+func newProcGuard(maxProcs int, onBackoff func(time.Duration)) *procGuard {
+	return &procGuard{
+		onBackoff: onBackoff,
+		slots:     newSlots(maxProcs),
+		delay:     procBackoffMin,
+	}
+}
+
+// withProcGuard returns ctx carrying g.
+func withProcGuard(ctx context.Context, g *procGuard) context.Context {
+	return context.WithValue(ctx, procGuardKey{}, g)
+}
+
+// acquire waits out any pause and for a free slot, returning its release
+// func.
+func (g *procGuard) acquire(ctx context.Context) (func(), error) {
+	if g == nil {
+		return func() {}, nil
+	}
+	g.mu.Lock()
+	wait := time.Until(g.pausedUntil)
+	g.mu.Unlock()
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+	if g.slots == nil {
+		return func() {}, nil
+	}
+	select {
+	case g.slots <- struct{}{}:
+		return func() { <-g.slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// backOff pauses new child processes and doubles the next pause.
+func (g *procGuard) backOff() {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	delay := g.delay
+	g.pausedUntil = time.Now().Add(delay)
+	g.delay = min(g.delay*2, procBackoffMax)
+	g.mu.Unlock()
+	if g.onBackoff != nil {
+		g.onBackoff(delay)
+	}
+}
+
+// recovered resets the pause after a child process ran cleanly.
+func (g *procGuard) recovered() {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	g.delay = procBackoffMin
+	g.mu.Unlock()
+}
+
+// runProc runs cmd through run under the guard carried by ctx, which must
+// be the context cmd was created with. A process that could not start for
+// lack of file descriptors is started again after the guard's pause; any
+// descriptor exhaustion is returned as *TooManyOpenFiles.
+func runProc(ctx context.Context, cmd *exec.Cmd, run func(*exec.Cmd) ([]byte, error)) ([]byte, error) {
+	g, _ := ctx.Value(procGuardKey{}).(*procGuard)
+	stdin, stdout, stderr := cmd.Stdin, cmd.Stdout, cmd.Stderr
+	for attempt := 0; ; attempt++ {
+		release, err := g.acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		out, err := run(cmd)
+		release()
+		if !fdExhausted(err, out) {
+			g.recovered()
+			return out, err
+		}
+		g.backOff()
+		if cmd.Process != nil || attempt >= procStartRetries {
+			return out, &TooManyOpenFiles{Err: err, Limit: openFileLimit()}
+		}
+
+		// The process never started, so it is safe to start again, but an
+		// exec.Cmd cannot be reused.
+		next := exec.CommandContext(ctx, cmd.Path, cmd.Args[1:]...)
+		next.Args, next.Dir, next.Env = cmd.Args, cmd.Dir, cmd.Env
+		next.Stdin, next.Stdout, next.Stderr = stdin, stdout, stderr
+		cmd = next
+	}
+}
+
+// procOutput is cmd.Output under runProc.
+func procOutput(ctx context.Context, cmd *exec.Cmd) ([]byte, error) {
+	return runProc(ctx, cmd, (*exec.Cmd).Output)
+}
+
+// procCombinedOutput is cmd.CombinedOutput under runProc.
+func procCombinedOutput(ctx context.Context, cmd *exec.Cmd) ([]byte, error) {
+	return runProc(ctx, cmd, (*exec.Cmd).CombinedOutput)
+}
+
+// procRun is cmd.Run under runProc.
+func procRun(ctx context.Context, cmd *exec.Cmd) error {
+	_, err := runProc(ctx, cmd, func(c *exec.Cmd) ([]byte, error) {
+		return nil, c.Run()
+	})
+	return err
+}
+
+// fdExhausted reports whether err, or the output or captured stderr of the
+// failed process, shows file descriptors running out.
+func fdExhausted(err error, out []byte) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE) {
+		return true
+	}
+	mentions := func(b []byte) bool {
+		return bytes.Contains(bytes.ToLower(b), []byte("too many open files"))
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && mentions(exitErr.Stderr) {
+		return true
+	}
+	return mentions(out) || strings.Contains(strings.ToLower(err.Error()), "too many open files")
+}
@@ -0,0 +1,7 @@
+//go:build !unix
+
+package indexer
+
+func openFileLimit() uint64 {
+	return 0
+}
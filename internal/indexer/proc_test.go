@@ -0,0 +1,137 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFdExhausted(t *testing.T) {
+	tests := map[string]struct {
+		err  error
+		out  []byte
+		want bool
+	}{
+		"success": {
+			out: []byte("too many open files"),
+		},
+		"emfile": {
+			err:  fmt.Errorf("fork/exec /usr/bin/git: %w", syscall.EMFILE),
+			want: true,
+		},
+		"enfile": {
+			err:  syscall.ENFILE,
+			want: true,
+		},
+		"combined output": {
+			err:  errors.New("exit status 128"),
+			out:  []byte("fatal: Unable to create pipe: Too many open files\n"),
+			want: true,
+		},
+		"exit stderr": {
+			err:  &exec.ExitError{Stderr: []byte("error: Too many open files")},
+			want: true,
+		},
+		"other failure": {
+			err: errors.New("exit status 128"),
+			out: []byte("fatal: repository not found"),
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := fdExhausted(tc.err, tc.out); got != tc.want {
+				t.Fatalf("expected %t, got %t", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestProcGuardBoundsConcurrency(t *testing.T) {
+	const limit = 2
+	g := newProcGuard(limit, nil)
+
+	var (
+		mu      sync.Mutex
+		active  int
+		maxSeen int
+		wg      sync.WaitGroup
+	)
+	for range 8 {
+		wg.Go(func() {
+			release, err := g.acquire(context.Background())
+			if err != nil {
+				t.Errorf("acquire: %v", err)
+				return
+			}
+			defer release()
+
+			mu.Lock()
+			active++
+			maxSeen = max(maxSeen, active)
+			mu.Unlock()
+
+			time.Sleep(5 * time.Millisecond)
+
+			mu.Lock()
+			active--
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+
+	if maxSeen > limit {
+		t.Fatalf("expected at most %d concurrent processes, saw %d", limit, maxSeen)
+	}
+}
+
+func TestProcGuardBackoff(t *testing.T) {
+	var delays []time.Duration
+	g := newProcGuard(0, func(d time.Duration) { delays = append(delays, d) })
+
+	g.backOff()
+	g.backOff()
+	if len(delays) != 2 || delays[0] != procBackoffMin || delays[1] != 2*procBackoffMin {
+		t.Fatalf("expected doubling pauses from %s, got %v", procBackoffMin, delays)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := g.acquire(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a paused acquire to honor cancellation, got %v", err)
+	}
+
+	g.recovered()
+	g.backOff()
+	if last := delays[len(delays)-1]; last != procBackoffMin {
+		t.Fatalf("expected recovery to reset the pause to %s, got %s", procBackoffMin, last)
+	}
+}
+
+func TestRunProcReportsTooManyOpenFiles(t *testing.T) {
+	g := newProcGuard(0, nil)
+	ctx := withProcGuard(context.Background(), g)
+	cmd := exec.CommandContext(ctx, "sh", "-c", "echo 'fatal: Too many open files' >&2; exit 128")
+
+	_, err := procCombinedOutput(ctx, cmd)
+	var fdErr *TooManyOpenFiles
+	if !errors.As(err, &fdErr) {
+		t.Fatalf("expected *TooManyOpenFiles, got %v", err)
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 128 {
+		t.Fatalf("expected the exit error to stay reachable, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "ulimit -n") {
+		t.Fatalf("expected an actionable hint, got %q", err.Error())
+	}
+	if !g.pausedUntil.After(time.Now()) {
+		t.Fatalf("expected new processes to be paused")
+	}
+}
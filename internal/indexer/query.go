@@ -0,0 +1,313 @@
+package indexer
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Query output formats.
+const (
+	QueryFormatJSON     = "json"
+	QueryFormatMarkdown = "markdown"
+	QueryFormatPaths    = "paths"
+)
+
+// DefaultQueryLimit is how many documents Query prints by default.
+const DefaultQueryLimit = 10
+
+// queryCandidates caps the documents fetched from the store for ranking.
+const queryCandidates = 200
+
+// QueryOptions configures Query.
+type QueryOptions struct {
+	// Chroma locates the collection store.
+	Chroma ChromaOptions
+	// Collection is the collection slug to search.
+	Collection string
+	// Text, when set, limits results to documents containing any of its
+	// words and ranks them by how many they contain.
+	Text string
+	// Kind and Path, when set, must equal the documents' kind and path
+	// metadata.
+	Kind string
+	Path string
+	// Format is json, markdown, or paths; empty means json.
+	Format string
+	// RerankURL, when set, is a cross-encoder reranking endpoint that
+	// accepts {"query", "texts"} and returns [{"index", "score"}], as served
+	// by Hugging Face text-embeddings-inference at /rerank. It requires Text.
+	RerankURL string
+	// Limit is the number of documents printed; zero uses DefaultQueryLimit.
+	Limit int
+}
+
+// QueryResult is one document returned by Query.
+type QueryResult struct {
+	Metadata map[string]any `json:"metadata,omitempty"`
+	// Score is the reranker's score, or the number of query words the
+	// document contains; it is omitted without Text.
+	Score    *float64 `json:"score,omitempty"`
+	ID       string   `json:"id"`
+	Document string   `json:"document"`
+}
+
+// Query searches a collection by metadata and text and writes the best
+// matches to w in opts.Format. Chroma's HTTP API cannot embed query text, so
+// matching is lexical; RerankURL adds semantic ordering on top.
+func Query(ctx context.Context, w io.Writer, opts QueryOptions) error {
+	switch opts.Format {
+	case "":
+		opts.Format = QueryFormatJSON
+	case QueryFormatJSON, QueryFormatMarkdown, QueryFormatPaths:
+	default:
+		return fmt.Errorf("unknown query format %q (want json, markdown, or paths)", opts.Format)
+	}
+	client := newChromaClient(opts.Chroma)
+	col, ok, err := client.getCollection(ctx, opts.Collection)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("collection %q does not exist", opts.Collection)
+	}
+	results, err := queryCollection(ctx, client, col.ID, opts)
+	if err != nil {
+		return err
+	}
+	return writeQueryResults(w, opts.Format, results)
+}
+
+// queryCollection returns the best matches for opts in the collection with
+// the given id, best first.
+func queryCollection(ctx context.Context, client *chromaClient, id string, opts QueryOptions) ([]QueryResult, error) {
+	if opts.Limit < 0 {
+		return nil, fmt.Errorf("query limit must not be negative, got %d", opts.Limit)
+	}
+	if opts.Limit == 0 {
+		opts.Limit = DefaultQueryLimit
+	}
+	terms := queryTerms(opts.Text)
+	if opts.RerankURL != "" && len(terms) == 0 {
+		return nil, errors.New("reranking requires query text")
+	}
+
+	fetch := opts.Limit
+	if len(terms) > 0 {
+		fetch = max(fetch, queryCandidates)
+	}
+	recs, err := client.search(ctx, id, queryWhere(opts.Kind, opts.Path), queryWhereDocument(terms), fetch)
+	if err != nil {
+		return nil, err
+	}
+	results := queryResults(recs)
+
+	switch {
+	case opts.RerankURL != "":
+		if err := rerank(ctx, opts.RerankURL, opts.Text, results); err != nil {
+			return nil, err
+		}
+	case len(terms) > 0:
+		for i := range results {
+			score := float64(countTerms(results[i].Document, terms))
+			results[i].Score = &score
+		}
+	}
+	if len(terms) > 0 {
+		slices.SortStableFunc(results, func(a, b QueryResult) int { return cmp.Compare(*b.Score, *a.Score) })
+	}
+	if len(results) > opts.Limit {
+		results = results[:opts.Limit]
+	}
+	return results, nil
+}
+
+// queryTerms splits text into distinct lower case words.
+func queryTerms(text string) []string {
+	var terms []string
+	for _, f := range strings.Fields(strings.ToLower(text)) {
+		if !slices.Contains(terms, f) {
+			terms = append(terms, f)
+		}
+	}
+	return terms
+}
+
+// queryWhere builds the Chroma metadata filter, or nil for none.
+func queryWhere(kind, path string) map[string]any {
+	var clauses []map[string]any
+	if kind != "" {
+		clauses = append(clauses, map[string]any{"kind": kind})
+	}
+	if path != "" {
+		clauses = append(clauses, map[string]any{"path": path})
+	}
+	switch len(clauses) {
+	case 0:
+		return nil
+	case 1:
+		return clauses[0]
+	default:
+		return map[string]any{"$and": clauses}
+	}
+}
+
+// queryWhereDocument builds the Chroma document filter matching any term,
+// or nil for none. $contains is case-sensitive, so each term is also
+// matched capitalized.
+func queryWhereDocument(terms []string) map[string]any {
+	var clauses []map[string]any
+	for _, t := range terms {
+		clauses = append(clauses, map[string]any{"$contains": t})
+		r, size := utf8.DecodeRuneInString(t)
+		if title := string(unicode.ToUpper(r)) + t[size:]; title != t {
+			clauses = append(clauses, map[string]any{"$contains": title})
+		}
+	}
+	switch len(clauses) {
+	case 0:
+		return nil
+	case 1:
+		return clauses[0]
+	default:
+		return map[string]any{"$or": clauses}
+	}
+}
+
+// countTerms returns how many of terms appear in document, ignoring case.
+func countTerms(document string, terms []string) int {
+	lower := strings.ToLower(document)
+	n := 0
+	for _, t := range terms {
+		if strings.Contains(lower, t) {
+			n++
+		}
+	}
+	return n
+}
+
+func queryResults(recs chromaRecords) []QueryResult {
+	results := make([]QueryResult, 0, len(recs.IDs))
+	for i, id := range recs.IDs {
+		r := QueryResult{ID: id}
+		if i < len(recs.Documents) && recs.Documents[i] != nil {
+			r.Document = *recs.Documents[i]
+		}
+		if i < len(recs.Metadatas) {
+			r.Metadata = recs.Metadatas[i]
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// rerankScore is one entry of a reranking response.
+type rerankScore struct {
+	Index int     `json:"index"`
+	Score float64 `json:"score"`
+}
+
+// rerank scores results against query with the cross-encoder at url.
+func rerank(ctx context.Context, url, query string, results []QueryResult) error {
+	if len(results) == 0 {
+		return nil
+	}
+	texts := make([]string, len(results))
+	for i, r := range results {
+		texts[i] = r.Document
+	}
+	body, err := json.Marshal(map[string]any{"query": query, "texts": texts, "truncate": true})
+	if err != nil {
+		return fmt.Errorf("encode rerank request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("build rerank request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := (&http.Client{Timeout: time.Minute}).Do(req)
+	if err != nil {
+		return fmt.Errorf("rerank: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read rerank response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("rerank: %d %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	var scores []rerankScore
+	if err := json.Unmarshal(data, &scores); err != nil {
+		return fmt.Errorf("decode rerank response: %w", err)
+	}
+
+	lowest := 0.0
+	for _, s := range scores {
+		if s.Index < 0 || s.Index >= len(results) {
+			return fmt.Errorf("rerank: index %d out of range", s.Index)
+		}
+		score := s.Score
+		results[s.Index].Score = &score
+		lowest = min(lowest, score)
+	}
+	// Documents the reranker left out sort last.
+	for i := range results {
+		if results[i].Score == nil {
+			score := lowest - 1
+			results[i].Score = &score
+		}
+	}
+	return nil
+}
+
+// path returns the result's path metadata, or its id when it has none.
+func (r QueryResult) path() string {
+	if path, _ := r.Metadata["path"].(string); path != "" {
+		return path
+	}
+	return r.ID
+}
+
+// writeQueryResults prints results in format.
+func writeQueryResults(w io.Writer, format string, results []QueryResult) error {
+	switch format {
+	case QueryFormatPaths:
+		var seen []string
+		for _, r := range results {
+			if path := r.path(); !slices.Contains(seen, path) {
+				seen = append(seen, path)
+				logf(w, "%s\n", path)
+			}
+		}
+	case QueryFormatMarkdown:
+		for i, r := range results {
+			if i > 0 {
+				logf(w, "\n")
+			}
+			title := r.path()
+			if kind, _ := r.Metadata["kind"].(string); kind != "" {
+				title += " (" + kind + ")"
+			}
+			logf(w, "## %s\n\n%s\n", title, strings.TrimSpace(r.Document))
+		}
+	default:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			return fmt.Errorf("encode results: %w", err)
+		}
+	}
+	return nil
+}
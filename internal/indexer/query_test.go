@@ -0,0 +1,167 @@
+package indexer
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestQueryFilters(t *testing.T) {
+	tests := map[string]struct {
+		kind, path string
+		terms      []string
+		where      map[string]any
+		whereDoc   map[string]any
+	}{
+		"none": {},
+		"kind": {kind: "module_summary", where: map[string]any{"kind": "module_summary"}},
+		"kind and path": {
+			kind: "module_summary", path: "internal/auth",
+			where: map[string]any{"$and": []map[string]any{{"kind": "module_summary"}, {"path": "internal/auth"}}},
+		},
+		"one term": {
+			terms:    []string{"token"},
+			whereDoc: map[string]any{"$or": []map[string]any{{"$contains": "token"}, {"$contains": "Token"}}},
+		},
+		"uncased term": {terms: []string{"42"}, whereDoc: map[string]any{"$contains": "42"}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := queryWhere(tc.kind, tc.path); !reflect.DeepEqual(got, tc.where) {
+				t.Fatalf("expected where %v, got %v", tc.where, got)
+			}
+			if got := queryWhereDocument(tc.terms); !reflect.DeepEqual(got, tc.whereDoc) {
+				t.Fatalf("expected where_document %v, got %v", tc.whereDoc, got)
+			}
+		})
+	}
+}
+
+// newQueryChroma serves one collection, "api", whose get returns docs and
+// records each request body.
+func newQueryChroma(t *testing.T, docs map[string]string, requests *[]map[string]any) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/collections/api"):
+			_ = json.NewEncoder(w).Encode(chromaCollection{ID: "col-1", Name: "api"})
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/col-1/get"):
+			var req map[string]any
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			*requests = append(*requests, req)
+			var recs chromaRecords
+			for _, id := range []string{"overview", "auth", "billing"} {
+				doc, ok := docs[id]
+				if !ok {
+					continue
+				}
+				recs.IDs = append(recs.IDs, id)
+				recs.Documents = append(recs.Documents, &doc)
+				recs.Metadatas = append(recs.Metadatas, map[string]any{"path": "internal/" + id, "kind": "module_summary"})
+			}
+			_ = json.NewEncoder(w).Encode(recs)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestQuery(t *testing.T) {
+	docs := map[string]string{
+		"overview": "Repo overview mentioning auth once.",
+		"auth":     "Auth issues session tokens and validates auth headers.",
+		"billing":  "Billing charges cards.",
+	}
+	tests := map[string]struct {
+		opts    QueryOptions
+		want    string
+		wantErr string
+	}{
+		"paths ranked": {
+			opts: QueryOptions{Text: "auth tokens", Format: QueryFormatPaths},
+			want: "internal/auth\ninternal/overview\ninternal/billing\n",
+		},
+		"limit": {
+			opts: QueryOptions{Text: "auth tokens", Format: QueryFormatPaths, Limit: 1},
+			want: "internal/auth\n",
+		},
+		"markdown": {
+			opts: QueryOptions{Kind: "module_summary", Format: QueryFormatMarkdown, Limit: 1},
+			want: "## internal/overview (module_summary)\n\nRepo overview mentioning auth once.\n",
+		},
+		"unknown format":      {opts: QueryOptions{Format: "xml"}, wantErr: "unknown query format"},
+		"rerank without text": {opts: QueryOptions{RerankURL: "http://x"}, wantErr: "requires query text"},
+		"missing collection":  {opts: QueryOptions{Collection: "other"}, wantErr: "does not exist"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var requests []map[string]any
+			srv := newQueryChroma(t, docs, &requests)
+			tc.opts.Chroma = ChromaOptions{URL: srv.URL}
+			if tc.opts.Collection == "" {
+				tc.opts.Collection = "api"
+			}
+
+			var out bytes.Buffer
+			err := Query(t.Context(), &out, tc.opts)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected error %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("query: %v", err)
+			}
+			if out.String() != tc.want {
+				t.Fatalf("expected %q, got %q", tc.want, out.String())
+			}
+			if tc.opts.Kind != "" && !reflect.DeepEqual(requests[0]["where"], map[string]any{"kind": tc.opts.Kind}) {
+				t.Fatalf("expected a kind filter, got %v", requests[0])
+			}
+		})
+	}
+}
+
+func TestQueryRerank(t *testing.T) {
+	var requests []map[string]any
+	chroma := newQueryChroma(t, map[string]string{"auth": "Auth.", "billing": "Billing."}, &requests)
+	var rerankReq struct {
+		Query string   `json:"query"`
+		Texts []string `json:"texts"`
+	}
+	reranker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&rerankReq)
+		_ = json.NewEncoder(w).Encode([]rerankScore{{Index: 1, Score: 0.9}, {Index: 0, Score: 0.1}})
+	}))
+	t.Cleanup(reranker.Close)
+
+	var out bytes.Buffer
+	err := Query(t.Context(), &out, QueryOptions{
+		Chroma:     ChromaOptions{URL: chroma.URL},
+		Collection: "api",
+		Text:       "who charges cards",
+		RerankURL:  reranker.URL,
+	})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if rerankReq.Query != "who charges cards" || len(rerankReq.Texts) != 2 {
+		t.Fatalf("unexpected rerank request %+v", rerankReq)
+	}
+	var results []QueryResult
+	if err := json.Unmarshal(out.Bytes(), &results); err != nil {
+		t.Fatalf("decode results: %v", err)
+	}
+	if len(results) != 2 || results[0].ID != "billing" || *results[0].Score != 0.9 {
+		t.Fatalf("expected billing ranked first, got %+v", results)
+	}
+}
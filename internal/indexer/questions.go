@@ -0,0 +1,254 @@
+package indexer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseEvalQuestions reads an eval questions file. JSON files hold a list
+// of questions or an object with a "questions" list. Anything else is read
+// as the YAML subset below, so no YAML library is needed:
+//
+//	questions:            # optional wrapper
+//	  - question: Where are session tokens issued?
+//	    answer: "internal/auth signs JWTs"
+//	    kind: module_summary
+//	    paths: [internal/auth]
+//	    terms:
+//	      - JWT
+//	      - refresh
+//
+// Values are plain, single-, or double-quoted scalars, or lists in flow
+// ([a, b]) or block form. Block scalars (| and >) and anchors are not
+// supported.
+func parseEvalQuestions(data []byte) ([]evalQuestion, error) {
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("[")) || bytes.HasPrefix(trimmed, []byte("{")) {
+		return parseEvalQuestionsJSON(trimmed)
+	}
+
+	var (
+		questions []evalQuestion
+		current   *evalQuestion
+		listKey   string
+		// itemIndent is the indentation of the "- " starting each
+		// question, set by the first one.
+		itemIndent = -1
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		raw := strings.TrimRight(stripYAMLComment(scanner.Text()), " \t")
+		line := strings.TrimLeft(raw, " ")
+		if line == "" || line == "---" {
+			continue
+		}
+		if strings.HasPrefix(line, "\t") {
+			return nil, fmt.Errorf("line %d: indent with spaces, not tabs", lineNo)
+		}
+		indent := len(raw) - len(line)
+
+		item, isItem := strings.CutPrefix(line, "- ")
+		if line == "-" {
+			item, isItem = "", true
+		}
+		switch {
+		case indent == 0 && line == "questions:":
+			continue
+		case isItem && listKey != "" && indent > itemIndent:
+			value, err := yamlScalar(item)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			current.appendList(listKey, value)
+			continue
+		case isItem && (itemIndent < 0 || indent == itemIndent):
+			itemIndent = indent
+			questions = append(questions, evalQuestion{})
+			current = &questions[len(questions)-1]
+			listKey = ""
+			if item == "" {
+				continue
+			}
+			line = item
+		case current == nil:
+			return nil, fmt.Errorf("line %d: expected a list of questions", lineNo)
+		case indent <= itemIndent:
+			return nil, fmt.Errorf("line %d: unexpected indentation", lineNo)
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key: value", lineNo)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		listKey = ""
+		if err := current.set(key, value); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		if value == "" && (key == "paths" || key == "terms") {
+			listKey = key
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return questions, validateEvalQuestions(questions)
+}
+
+func parseEvalQuestionsJSON(data []byte) ([]evalQuestion, error) {
+	var questions []evalQuestion
+	if data[0] == '{' {
+		var wrapper struct {
+			Questions []evalQuestion `json:"questions"`
+		}
+		if err := json.Unmarshal(data, &wrapper); err != nil {
+			return nil, err
+		}
+		questions = wrapper.Questions
+	} else if err := json.Unmarshal(data, &questions); err != nil {
+		return nil, err
+	}
+	return questions, validateEvalQuestions(questions)
+}
+
+func validateEvalQuestions(questions []evalQuestion) error {
+	for i, q := range questions {
+		if strings.TrimSpace(q.Question) == "" {
+			return fmt.Errorf("question %d: question is required", i+1)
+		}
+	}
+	return nil
+}
+
+// set assigns one key of a question from its YAML value.
+func (q *evalQuestion) set(key, value string) error {
+	switch key {
+	case "question", "answer", "kind":
+		s, err := yamlScalar(value)
+		if err != nil {
+			return err
+		}
+		switch key {
+		case "question":
+			q.Question = s
+		case "answer":
+			q.Answer = s
+		default:
+			q.Kind = s
+		}
+	case "paths", "terms":
+		if value == "" {
+			return nil
+		}
+		items, err := yamlFlowList(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		for _, item := range items {
+			q.appendList(key, item)
+		}
+	default:
+		return fmt.Errorf("unknown key %q (want question, answer, kind, paths, or terms)", key)
+	}
+	return nil
+}
+
+func (q *evalQuestion) appendList(key, value string) {
+	if key == "paths" {
+		q.Paths = append(q.Paths, value)
+	} else {
+		q.Terms = append(q.Terms, value)
+	}
+}
+
+// stripYAMLComment removes a "#" comment that starts the line or follows
+// a space, outside quotes.
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// yamlScalar returns a plain, single-, or double-quoted scalar's value.
+func yamlScalar(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case s == "|" || s == ">" || strings.HasPrefix(s, "|") || strings.HasPrefix(s, ">"):
+		return "", errors.New("block scalars are not supported; use a quoted string")
+	case strings.HasPrefix(s, `"`):
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return "", fmt.Errorf("invalid double-quoted string %s", s)
+		}
+		return v, nil
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return "", fmt.Errorf("invalid single-quoted string %s", s)
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	case strings.HasPrefix(s, "&") || strings.HasPrefix(s, "*"):
+		return "", errors.New("anchors and aliases are not supported")
+	}
+	return s, nil
+}
+
+// yamlFlowList parses "[a, 'b', "c"]". Items may not contain commas unless
+// quoted.
+func yamlFlowList(s string) ([]string, error) {
+	if !strings.HasPrefix(s, "[") || !strings.HasSuffix(s, "]") {
+		return nil, fmt.Errorf("expected a list like [a, b], got %s", s)
+	}
+	inner := s[1 : len(s)-1]
+	var items []string
+	var quote byte
+	start := 0
+	for i := 0; i <= len(inner); i++ {
+		if i < len(inner) {
+			c := inner[i]
+			switch {
+			case quote != 0 && c == quote:
+				quote = 0
+				continue
+			case quote != 0:
+				continue
+			case c == '"' || c == '\'':
+				quote = c
+				continue
+			case c != ',':
+				continue
+			}
+		}
+		item := strings.TrimSpace(inner[start:i])
+		start = i + 1
+		if item == "" {
+			continue
+		}
+		v, err := yamlScalar(item)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+	}
+	return items, nil
+}
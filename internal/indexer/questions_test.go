@@ -0,0 +1,77 @@
+package indexer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseEvalQuestions(t *testing.T) {
+	tests := map[string]struct {
+		data    string
+		want    []evalQuestion
+		wantErr string
+	}{
+		"yaml": {
+			data: `# retrieval checks
+questions:
+  - question: Where are session tokens issued?   # auth
+    answer: "internal/auth signs JWTs"
+    kind: module_summary
+    paths: [internal/auth, 'cmd/api']
+    terms:
+      - JWT
+      - "refresh token"
+  - question: 'What''s the billing flow?'
+`,
+			want: []evalQuestion{
+				{
+					Question: "Where are session tokens issued?",
+					Answer:   "internal/auth signs JWTs",
+					Kind:     "module_summary",
+					Paths:    []string{"internal/auth", "cmd/api"},
+					Terms:    []string{"JWT", "refresh token"},
+				},
+				{Question: "What's the billing flow?"},
+			},
+		},
+		"yaml without wrapper": {
+			data: "- question: a\n  terms: [x]\n- question: b # c\n",
+			want: []evalQuestion{{Question: "a", Terms: []string{"x"}}, {Question: "b"}},
+		},
+		"json list": {
+			data: `[{"question": "a", "paths": ["p"]}]`,
+			want: []evalQuestion{{Question: "a", Paths: []string{"p"}}},
+		},
+		"json object": {
+			data: `{"questions": [{"question": "a"}]}`,
+			want: []evalQuestion{{Question: "a"}},
+		},
+		"unknown key":    {data: "- question: a\n  answr: b\n", wantErr: "unknown key"},
+		"block scalar":   {data: "- question: |\n    a\n", wantErr: "block scalars"},
+		"missing text":   {data: "- kind: concept\n", wantErr: "question is required"},
+		"not a list":     {data: "question: a\n", wantErr: "expected a list"},
+		"bad flow list":  {data: "- question: a\n  paths: internal/auth\n", wantErr: "expected a list like"},
+		"bad indent":     {data: "- question: a\nanswer: b\n", wantErr: "unexpected indentation"},
+		"tab indent":     {data: "- question: a\n\tanswer: b\n", wantErr: "tabs"},
+		"invalid quoted": {data: "- question: \"a\n", wantErr: "invalid double-quoted"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseEvalQuestions([]byte(tc.data))
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected error %q, got %v (%+v)", tc.wantErr, err, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("expected %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const (
+	// redactMaxFiles caps the files listed in the manifest's "forbidden"
+	// field.
+	redactMaxFiles = 200
+	// redactScanBytes is how much of each tracked file content rules are
+	// matched against.
+	redactScanBytes = 1 << 20
+)
+
+// RedactRule marks files Codex must never read or index. Path is a
+// repo-relative file, directory, or glob; a pattern without a slash also
+// matches any file or directory with that name, as in .gitignore. Content
+// is a regular expression matched against tracked files' contents. Each
+// rule sets exactly one of them.
+type RedactRule struct {
+	Path    string `json:"path,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+// redaction is the compiled form of a repo's redact rules.
+type redaction struct {
+	paths   []string
+	content []*regexp.Regexp
+}
+
+// manifestForbidden lists what Codex must not read, quote, or index.
+type manifestForbidden struct {
+	// Paths are the configured path and glob rules.
+	Paths []string `json:"paths,omitempty"`
+	// Files are the tracked files matching any rule, up to redactMaxFiles.
+	Files []string `json:"files,omitempty"`
+	// Total counts every matching file when Files is truncated.
+	Total int `json:"total"`
+}
+
+// compileRedaction validates rules and compiles them.
+func compileRedaction(rules []RedactRule) (redaction, error) {
+	var r redaction
+	for i, rule := range rules {
+		switch {
+		case (rule.Path == "") == (rule.Content == ""):
+			return redaction{}, fmt.Errorf("redact rule %d: set exactly one of path and content", i+1)
+		case rule.Path != "":
+			pattern := strings.Trim(path.Clean(filepath.ToSlash(rule.Path)), "/")
+			if _, err := path.Match(pattern, ""); err != nil || pattern == "." || pattern == "" {
+				return redaction{}, fmt.Errorf("redact rule %d: invalid path %q", i+1, rule.Path)
+			}
+			r.paths = append(r.paths, pattern)
+		default:
+			re, err := regexp.Compile(rule.Content)
+			if err != nil {
+				return redaction{}, fmt.Errorf("redact rule %d: content: %w", i+1, err)
+			}
+			r.content = append(r.content, re)
+		}
+	}
+	return r, nil
+}
+
+func (r redaction) empty() bool {
+	return len(r.paths) == 0 && len(r.content) == 0
+}
+
+// matchesPath reports whether name, or a directory containing it, matches
+// a path rule.
+func (r redaction) matchesPath(name string) bool {
+	for p := name; p != "." && p != "/" && p != ""; p = path.Dir(p) {
+		for _, pattern := range r.paths {
+			if ok, _ := path.Match(pattern, p); ok {
+				return true
+			}
+			if !strings.Contains(pattern, "/") {
+				if ok, _ := path.Match(pattern, path.Base(p)); ok {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// matchesContent reports whether the start of the regular file at file
+// matches a content rule. Unreadable files and symlinks do not match.
+func (r redaction) matchesContent(file string) bool {
+	if len(r.content) == 0 {
+		return false
+	}
+	info, err := os.Lstat(file)
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, redactScanBytes))
+	if err != nil {
+		return false
+	}
+	return slices.ContainsFunc(r.content, func(re *regexp.Regexp) bool { return re.Match(data) })
+}
+
+// forbiddenFiles returns the tracked files in repoDir matching any rule.
+func (r redaction) forbiddenFiles(ctx context.Context, repoDir string) ([]string, error) {
+	names, err := trackedFiles(ctx, repoDir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, name := range names {
+		if r.matchesPath(name) || r.matchesContent(filepath.Join(repoDir, filepath.FromSlash(name))) {
+			files = append(files, name)
+		}
+	}
+	return files, nil
+}
+
+// prepareRedaction lists the repo's forbidden files in the manifest and
+// drops them from its diff. A rename or copy is dropped when either side
+// is forbidden, so the diff never names a redacted file.
+func (ix *indexer) prepareRedaction(ctx context.Context, m *indexManifest, indexDir string, r redaction) {
+	if r.empty() {
+		return
+	}
+	log := ix.log(ctx)
+	files, err := r.forbiddenFiles(ctx, indexDir)
+	if err != nil {
+		log.warnf("could not list files for redaction: %v", err)
+	}
+	forbidden := &manifestForbidden{Paths: r.paths, Files: files, Total: len(files)}
+	if len(files) > redactMaxFiles {
+		forbidden.Files = files[:redactMaxFiles]
+	}
+	m.Forbidden = forbidden
+
+	if len(m.Diff) == 0 {
+		return
+	}
+	matched := make(map[string]bool, len(files))
+	for _, name := range files {
+		matched[name] = true
+	}
+	redacted := func(name string) bool {
+		return name != "" && (matched[name] || r.matchesPath(name))
+	}
+	kept := slices.DeleteFunc(slices.Clone(m.Diff), func(e diffEntry) bool {
+		return redacted(e.Path) || redacted(e.OldPath)
+	})
+	if dropped := len(m.Diff) - len(kept); dropped > 0 {
+		log.infof("redacted %d changed files from the diff", dropped)
+	}
+	m.Diff = kept
+}
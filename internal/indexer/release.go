@@ -0,0 +1,74 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// tagCacheKey is the commit cache branch key under which --on-new-tag
+// records the last indexed release tag.
+const tagCacheKey = "refs/tags"
+
+// latestTag returns the most recent tag reachable from HEAD in repoDir, or
+// "" when there is none.
+func latestTag(ctx context.Context, repoDir string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", repoDir, "describe", "--tags", "--abbrev=0", "HEAD")
+	out, err := procCombinedOutput(ctx, cmd)
+	if err != nil {
+		if strings.Contains(string(out), "No names found") || strings.Contains(string(out), "No tags can describe") {
+			return "", nil
+		}
+		return "", fmt.Errorf("git describe --tags: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// selectRelease implements --on-new-tag: it finds the latest tag on the index
+// branch and skips the repo unless that tag is newer than the one last
+// indexed. When the workspace is a temporary worktree it is moved to the tag
+// so Codex indexes the release snapshot; otherwise HEAD is indexed as-is.
+// It reports whether indexing should continue.
+func (ix *indexer) selectRelease(
+	ctx context.Context,
+	result *RepoResult,
+	ws indexWorkspace,
+	slug string,
+	dryRun bool,
+) bool {
+	tag, err := latestTag(ctx, ws.dir)
+	if err != nil {
+		result.fail(err)
+		ix.log(ctx).warnf("could not find release tag: %v", err)
+		return false
+	}
+	if tag == "" {
+		result.skip(SkipReasonExcludedByFlag, "no release tags")
+		ix.log(ctx).infof("skipping indexing: %s", result.SkipDetail)
+		return false
+	}
+	if last, ok := ix.cache.LastCommit(slug, tagCacheKey); ok && last == tag {
+		result.skip(SkipReasonCacheHit, "no new tag since "+tag)
+		ix.log(ctx).infof("skipping indexing: %s", result.SkipDetail)
+		return false
+	}
+
+	result.Version = tag
+	if dryRun {
+		ix.log(ctx).infof("[dry-run] git checkout --detach %s (new release)", tag)
+		return true
+	}
+	if ws.cleanup == nil {
+		ix.log(ctx).warnf("not in a temporary worktree — indexing HEAD as-is for release %s", tag)
+		return true
+	}
+	if err := runGitCommand(ctx, ws.dir, nil, "checkout", "--quiet", "--detach", tag); err != nil {
+		result.fail(fmt.Errorf("check out release %s: %w", tag, err))
+		ix.log(ctx).warnf("%s", result.Error)
+		return false
+	}
+	result.IndexedCommit = ix.detectIndexedCommit(ctx, ws.dir)
+	ix.log(ctx).infof("indexing release %s (%s)", tag, shortCommit(result.IndexedCommit))
+	return true
+}
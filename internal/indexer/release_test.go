@@ -0,0 +1,106 @@
+package indexer
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSelectRelease(t *testing.T) {
+	tests := map[string]struct {
+		tags       []string
+		cachedTag  string
+		wantSkip   string
+		wantTag    string
+		wantOnHEAD bool
+	}{
+		"no tags": {
+			wantSkip: "no release tags",
+		},
+		"tag already indexed": {
+			tags:      []string{"v1.0.0"},
+			cachedTag: "v1.0.0",
+			wantSkip:  "no new tag since v1.0.0",
+		},
+		"new tag behind head": {
+			tags:      []string{"v1.0.0"},
+			cachedTag: "v0.9.0",
+			wantTag:   "v1.0.0",
+		},
+		"new tag at head": {
+			tags:       []string{"v1.0.0", "v1.1.0"},
+			wantTag:    "v1.1.0",
+			wantOnHEAD: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			repoDir := filepath.Join(t.TempDir(), "repo")
+			initGitRepo(t, repoDir)
+			for i, tag := range tc.tags {
+				if i > 0 {
+					if err := os.WriteFile(filepath.Join(repoDir, tag+".txt"), []byte(tag), 0o644); err != nil {
+						t.Fatalf("write file: %v", err)
+					}
+					if err := runGit(repoDir, "add", "."); err != nil {
+						t.Fatalf("git add: %v", err)
+					}
+					if err := runGit(repoDir, "commit", "-m", tag); err != nil {
+						t.Fatalf("git commit: %v", err)
+					}
+				}
+				if err := runGit(repoDir, "tag", tag); err != nil {
+					t.Fatalf("git tag: %v", err)
+				}
+			}
+			if err := os.WriteFile(filepath.Join(repoDir, "later.txt"), []byte("later"), 0o644); err != nil {
+				t.Fatalf("write file: %v", err)
+			}
+			if !tc.wantOnHEAD {
+				if err := runGit(repoDir, "add", "."); err != nil {
+					t.Fatalf("git add: %v", err)
+				}
+				if err := runGit(repoDir, "commit", "-m", "after release"); err != nil {
+					t.Fatalf("git commit: %v", err)
+				}
+			}
+
+			cache, err := loadCommitCache("")
+			if err != nil {
+				t.Fatalf("load cache: %v", err)
+			}
+			cache.Update("repo", tagCacheKey, tc.cachedTag)
+			ix := newIndexer(io.Discard, io.Discard, cache, nil, Options{OnNewTag: true})
+
+			ws := indexWorkspace{dir: repoDir, cleanup: func() {}}
+			result := RepoResult{IndexedCommit: ix.detectIndexedCommit(t.Context(), repoDir)}
+			headBefore := result.IndexedCommit
+
+			ok := ix.selectRelease(t.Context(), &result, ws, "repo", false)
+			if ok != (tc.wantSkip == "") {
+				t.Fatalf("expected continue=%t, got %t (error %q)", tc.wantSkip == "", ok, result.Error)
+			}
+			if result.SkipDetail != tc.wantSkip {
+				t.Fatalf("expected skip %q, got %q", tc.wantSkip, result.SkipDetail)
+			}
+			if result.Version != tc.wantTag {
+				t.Fatalf("expected version %q, got %q", tc.wantTag, result.Version)
+			}
+			if tc.wantTag == "" {
+				return
+			}
+			tagCommit, err := headCommit(t.Context(), repoDir)
+			if err != nil {
+				t.Fatalf("head commit: %v", err)
+			}
+			if result.IndexedCommit != tagCommit {
+				t.Fatalf("expected indexed commit %s to match checked-out tag %s", result.IndexedCommit, tagCommit)
+			}
+			if (tagCommit == headBefore) != tc.wantOnHEAD {
+				t.Fatalf("expected tag at HEAD=%t", tc.wantOnHEAD)
+			}
+		})
+	}
+}
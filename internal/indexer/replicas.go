@@ -0,0 +1,132 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ReplicaConfig is an additional Chroma store, from the config file's
+// "replicas", that every indexed collection is copied to once Codex has
+// written it to the primary store.
+type ReplicaConfig struct {
+	// Name identifies the store in logs and the JSON summary.
+	Name string `json:"name"`
+	ChromaConfig
+}
+
+// validateReplicas checks that every replica has a unique name and a URL.
+func validateReplicas(replicas []ReplicaConfig) error {
+	seen := make(map[string]bool, len(replicas))
+	for i, r := range replicas {
+		switch {
+		case r.Name == "":
+			return fmt.Errorf("replica %d: name is required", i+1)
+		case seen[r.Name]:
+			return fmt.Errorf("replica %q: duplicate name", r.Name)
+		case r.URL == "":
+			return fmt.Errorf("replica %q: url is required", r.Name)
+		}
+		seen[r.Name] = true
+	}
+	return nil
+}
+
+// replicaTarget is a resolved replica store.
+type replicaTarget struct {
+	name   string
+	chroma ChromaOptions
+}
+
+// replicaTargets resolves the configured replicas, reading each token from
+// its token_env. Tenant and database default like the primary store's.
+func (c *Config) replicaTargets() []replicaTarget {
+	if c == nil {
+		return nil
+	}
+	targets := make([]replicaTarget, 0, len(c.Replicas))
+	for _, r := range c.Replicas {
+		opts := ChromaOptions{
+			URL:      r.URL,
+			Tenant:   r.Tenant,
+			Database: r.Database,
+		}
+		if r.TokenEnv != "" {
+			opts.Token = os.Getenv(r.TokenEnv)
+		}
+		targets = append(targets, replicaTarget{name: r.Name, chroma: opts})
+	}
+	return targets
+}
+
+// checkReplicas refuses replicas that resolve to the primary store, whose
+// collections replicating would delete.
+func checkReplicas(primary ChromaOptions, targets []replicaTarget) error {
+	for _, t := range targets {
+		if newChromaClient(t.chroma).location() == newChromaClient(primary).location() {
+			return fmt.Errorf("replica %q is the primary store", t.name)
+		}
+	}
+	return nil
+}
+
+// location identifies the client's database across URL spellings.
+func (c *chromaClient) location() string {
+	return strings.TrimRight(c.opts.URL, "/") + c.collectionsPath()
+}
+
+// ReplicaResult is the outcome of copying a repo's collection to one
+// replica store.
+type ReplicaResult struct {
+	Store     string `json:"store"`
+	Documents int    `json:"documents"`
+	Error     string `json:"error,omitempty"`
+}
+
+// replicate copies the collection Codex just wrote from the primary store
+// to every replica, replacing the replica's copy so documents removed from
+// the primary disappear there too. Failures are recorded per replica and
+// leave the repo indexed.
+func (ix *indexer) replicate(ctx context.Context, result *RepoResult, collection string, dryRun bool) {
+	targets := ix.config.replicaTargets()
+	if len(targets) == 0 {
+		return
+	}
+	if dryRun {
+		for _, t := range targets {
+			ix.log(ctx).infof("[dry-run] would copy collection %s to replica %s (%s)",
+				collection, t.name, redactURL(t.chroma.URL))
+		}
+		return
+	}
+
+	primary := newChromaClient(ix.opts.Chroma)
+	src, ok, err := primary.getCollection(ctx, collection)
+	if err == nil && !ok {
+		err = fmt.Errorf("collection %s is not in the primary store", collection)
+	}
+	for _, t := range targets {
+		rr := ReplicaResult{Store: t.name}
+		copyErr := err
+		if copyErr == nil {
+			rr.Documents, copyErr = replaceCollection(ctx, primary, src, newChromaClient(t.chroma))
+		}
+		if copyErr != nil {
+			rr.Error = copyErr.Error()
+			ix.log(ctx).warnf("could not copy collection %s to replica %s: %v", collection, t.name, copyErr)
+		} else {
+			ix.log(ctx).infof("copied %d documents to replica %s", rr.Documents, t.name)
+		}
+		result.Replicas = append(result.Replicas, rr)
+	}
+}
+
+// replaceCollection recreates src in the store behind to and copies every
+// record, embeddings included, from the store behind from.
+func replaceCollection(ctx context.Context, from *chromaClient, src chromaCollection, to *chromaClient) (int, error) {
+	if err := to.deleteCollection(ctx, src.Name); err != nil && !notFound(err) {
+		return 0, fmt.Errorf("delete replica collection: %w", err)
+	}
+	return copyCollection(ctx, from, src, to, src.Name)
+}
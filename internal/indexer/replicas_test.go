@@ -0,0 +1,116 @@
+package indexer
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestValidateReplicas(t *testing.T) {
+	tests := map[string]struct {
+		replicas []ReplicaConfig
+		wantErr  string
+	}{
+		"none":           {},
+		"valid":          {replicas: []ReplicaConfig{{Name: "team", ChromaConfig: ChromaConfig{URL: "http://chroma:8000"}}}},
+		"missing name":   {replicas: []ReplicaConfig{{ChromaConfig: ChromaConfig{URL: "http://chroma:8000"}}}, wantErr: "name is required"},
+		"missing url":    {replicas: []ReplicaConfig{{Name: "team"}}, wantErr: "url is required"},
+		"duplicate name": {replicas: []ReplicaConfig{{Name: "a", ChromaConfig: ChromaConfig{URL: "x"}}, {Name: "a", ChromaConfig: ChromaConfig{URL: "y"}}}, wantErr: "duplicate name"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := validateReplicas(tc.replicas)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCheckReplicasRejectsPrimary(t *testing.T) {
+	primary := ChromaOptions{URL: "http://localhost:8000"}
+	targets := []replicaTarget{{name: "local", chroma: ChromaOptions{URL: "http://localhost:8000/", Tenant: DefaultChromaTenant}}}
+	if err := checkReplicas(primary, targets); err == nil {
+		t.Fatal("expected the primary store to be refused as a replica")
+	}
+	targets[0].chroma.Database = "personal"
+	if err := checkReplicas(primary, targets); err != nil {
+		t.Fatalf("expected another database to be accepted, got %v", err)
+	}
+}
+
+func TestReplicate(t *testing.T) {
+	ctx := t.Context()
+	primary := ChromaOptions{URL: mockStoreURL, mock: newMockStore(filepath.Join(t.TempDir(), "primary.json"))}
+	seedCollection(t, newChromaClient(primary), "api", "overview", "store")
+
+	replica := newMockStore(filepath.Join(t.TempDir(), "replica.json"))
+	replicaSrv := httptest.NewServer(replica.mux)
+	t.Cleanup(replicaSrv.Close)
+	seedCollection(t, newChromaClient(ChromaOptions{URL: replicaSrv.URL}), "api", "stale")
+
+	downSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(downSrv.Close)
+
+	config := &Config{Replicas: []ReplicaConfig{
+		{Name: "personal", ChromaConfig: ChromaConfig{URL: replicaSrv.URL}},
+		{Name: "team", ChromaConfig: ChromaConfig{URL: downSrv.URL}},
+	}}
+	ix := newIndexer(io.Discard, io.Discard, nil, config, Options{Chroma: primary})
+	result := &RepoResult{}
+	ix.replicate(ctx, result, "api", false)
+
+	if len(result.Replicas) != 2 {
+		t.Fatalf("expected two replica results, got %+v", result.Replicas)
+	}
+	if got := result.Replicas[0]; got.Store != "personal" || got.Documents != 2 || got.Error != "" {
+		t.Fatalf("expected two documents copied to personal, got %+v", got)
+	}
+	if got := result.Replicas[1]; got.Store != "team" || got.Error == "" {
+		t.Fatalf("expected the team copy to fail, got %+v", got)
+	}
+	if repoStatus(result) != statusWarn {
+		t.Fatalf("expected a failed replica to warn, got %s", repoStatus(result))
+	}
+
+	client := newChromaClient(ChromaOptions{URL: replicaSrv.URL})
+	col, ok, err := client.getCollection(ctx, "api")
+	if err != nil || !ok {
+		t.Fatalf("expected the replica collection, got ok=%t err=%v", ok, err)
+	}
+	recs, err := client.getRecords(ctx, col.ID, 0, chromaPageSize)
+	if err != nil || !slices.Equal(recs.IDs, []string{"overview", "store"}) {
+		t.Fatalf("expected the stale copy replaced, got %v (%v)", recs.IDs, err)
+	}
+}
+
+// seedCollection creates collection with one document per id.
+func seedCollection(t *testing.T, client *chromaClient, collection string, ids ...string) {
+	t.Helper()
+	col, err := client.createCollection(t.Context(), collection, nil)
+	if err != nil {
+		t.Fatalf("create collection: %v", err)
+	}
+	doc := "summary"
+	recs := chromaRecords{IDs: ids}
+	for range ids {
+		recs.Documents = append(recs.Documents, &doc)
+		recs.Metadatas = append(recs.Metadatas, map[string]any{"kind": "concept"})
+	}
+	if err := client.upsertRecords(t.Context(), col.ID, recs); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+}
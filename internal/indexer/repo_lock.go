@@ -0,0 +1,92 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// repoLockPoll is how often a repo waiting for another process's lock on
+// its collection retries.
+const repoLockPoll = 250 * time.Millisecond
+
+// repoLockKind names collection locks in lock files and messages.
+const repoLockKind = "collection"
+
+// repoLocks keeps a collection from being indexed twice at once. Repos of
+// this run queue on an in-process mutex per slug; across processes a lock
+// file per slug is held while the repo is indexed and waited on, rather
+// than failing, when another run holds it. The commit cache is checked
+// only once the lock is held, so a repo queued behind an index of the same
+// commit in this run is coalesced into a cache hit.
+type repoLocks struct {
+	locks map[string]*sync.Mutex
+	// poll overrides repoLockPoll in tests.
+	poll time.Duration
+	mu   sync.Mutex
+}
+
+// lock blocks until slug is free in this process and on disk, calling
+// onWait once with the holder's lock error when it has to wait. The
+// returned func releases both locks.
+func (rl *repoLocks) lock(ctx context.Context, slug string, onWait func(error)) (func() error, error) {
+	rl.mu.Lock()
+	if rl.locks == nil {
+		rl.locks = make(map[string]*sync.Mutex)
+	}
+	local, ok := rl.locks[slug]
+	if !ok {
+		local = &sync.Mutex{}
+		rl.locks[slug] = local
+	}
+	poll := rl.poll
+	rl.mu.Unlock()
+	if poll <= 0 {
+		poll = repoLockPoll
+	}
+
+	waited := false
+	if !local.TryLock() {
+		if onWait != nil {
+			onWait(errors.New("another repo of this run is indexing collection " + slug))
+		}
+		waited = true
+		local.Lock()
+	}
+
+	for {
+		fileLock, err := acquireRunLock(repoLockKind, slug)
+		if err == nil {
+			return func() error {
+				defer local.Unlock()
+				return fileLock.Release()
+			}, nil
+		}
+		var held *runLockHeld
+		if !errors.As(err, &held) {
+			local.Unlock()
+			return nil, err
+		}
+		if !waited && onWait != nil {
+			onWait(err)
+		}
+		waited = true
+		if err := sleepCtx(ctx, poll); err != nil {
+			local.Unlock()
+			return nil, err
+		}
+	}
+}
+
+// sleepCtx waits for d or until ctx is done.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,74 @@
+package indexer
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRepoLocksQueueInProcess(t *testing.T) {
+	slug := filepath.Base(t.TempDir())
+	rl := &repoLocks{poll: 10 * time.Millisecond}
+
+	release, err := rl.lock(t.Context(), slug, nil)
+	if err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+
+	waited := make(chan error, 1)
+	acquired := make(chan func() error, 1)
+	go func() {
+		next, err := rl.lock(t.Context(), slug, func(err error) { waited <- err })
+		if err != nil {
+			t.Errorf("queued lock: %v", err)
+		}
+		acquired <- next
+	}()
+
+	if err := <-waited; err == nil {
+		t.Fatalf("expected the queued repo to be told why it waits")
+	}
+	select {
+	case <-acquired:
+		t.Fatalf("expected the second lock to wait for the first")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if err := release(); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	next := <-acquired
+	if next == nil {
+		t.Fatalf("expected the queued lock to be acquired")
+	}
+	if err := next(); err != nil {
+		t.Fatalf("release queued lock: %v", err)
+	}
+}
+
+func TestRepoLocksWaitForOtherRun(t *testing.T) {
+	slug := filepath.Base(t.TempDir())
+	other, err := acquireRunLock(repoLockKind, slug)
+	if err != nil {
+		t.Fatalf("take other run's lock: %v", err)
+	}
+	time.AfterFunc(50*time.Millisecond, func() {
+		if err := other.Release(); err != nil {
+			t.Errorf("release other run's lock: %v", err)
+		}
+	})
+
+	var waitErr error
+	rl := &repoLocks{poll: 10 * time.Millisecond}
+	release, err := rl.lock(t.Context(), slug, func(err error) { waitErr = err })
+	if err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	var held *runLockHeld
+	if !errors.As(waitErr, &held) || held.holder == nil {
+		t.Fatalf("expected to wait on the other run's lock, got %v", waitErr)
+	}
+	if err := release(); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+}
@@ -6,46 +6,181 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"maps"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"time"
+
+	"golang.org/x/text/cases"
 )
 
 const (
+	defaultCodexPath            = "codex"
 	shortCommitLen              = 7
 	codexInputKeepAliveInterval = 30 * time.Second
 )
 
-func findGitRepos(root string) ([]string, error) {
-	var repos []string
+// Policies for checkouts with a detached or unborn HEAD.
+const (
+	HeadPolicyIndex = "index"
+	HeadPolicySkip  = "skip"
+)
+
+// Codex stdin modes for --stdin.
+const (
+	// StdinKeepAlive writes a newline at once and then every keep-alive
+	// interval, for runners that exit or hang when stdin closes.
+	StdinKeepAlive = "keepalive"
+	// StdinNone leaves stdin open but never writes to it, for runners that
+	// misbehave when fed newlines.
+	StdinNone = "none"
+	// StdinClosed gives Codex an empty stdin that is at end of input.
+	StdinClosed = "closed"
+)
+
+// discoveredRepo is a checkout found while walking the root directory.
+type discoveredRepo struct {
+	path string
+	// worktreeOf is the primary checkout when path is a linked worktree
+	// whose primary was also discovered under the root.
+	worktreeOf string
+	// duplicateOf is the preferred checkout of the same remote.
+	duplicateOf string
+	// remote is the normalized remote URL, when known.
+	remote string
+	// deferred says why --max-repos left the repo for a later run.
+	deferred string
+}
+
+func findGitRepos(root string) ([]discoveredRepo, error) {
+	var (
+		repos  []discoveredRepo
+		linked = make(map[string]string)
+	)
 	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
-		if d.IsDir() && d.Name() == ".git" {
-			repos = append(repos, filepath.Dir(path))
+		if d.Name() != ".git" {
 			return nil
 		}
+		if d.IsDir() {
+			repos = append(repos, discoveredRepo{path: filepath.Dir(path)})
+			return fs.SkipDir
+		}
+		if primary, ok := linkedWorktreePrimary(path); ok {
+			repoDir := filepath.Dir(path)
+			repos = append(repos, discoveredRepo{path: repoDir})
+			linked[repoDir] = primary
+		}
 		return nil
 	})
 	if err != nil {
 		return repos, fmt.Errorf("walk repos in %s: %w", root, err)
 	}
 
+	// Git records gitdir paths with symlinks resolved, so compare canonical
+	// paths (e.g. /var vs /private/var on macOS).
+	discovered := make(map[string]string, len(repos))
+	for _, repo := range repos {
+		discovered[canonicalPath(repo.path)] = repo.path
+	}
+	for i := range repos {
+		primary, ok := linked[repos[i].path]
+		if !ok {
+			continue
+		}
+		if primaryPath, found := discovered[canonicalPath(primary)]; found {
+			repos[i].worktreeOf = primaryPath
+		}
+	}
+
 	return repos, nil
 }
 
+func canonicalPath(path string) string {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	return resolved
+}
+
+// linkedWorktreePrimary inspects a .git file and, when it points at a linked
+// worktree's gitdir (one with a commondir file), returns the primary checkout
+// directory. Submodules and other gitfile layouts report false.
+func linkedWorktreePrimary(gitFile string) (string, bool) {
+	data, err := os.ReadFile(gitFile)
+	if err != nil {
+		return "", false
+	}
+	gitDir, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir:")
+	if !ok {
+		return "", false
+	}
+	gitDir = strings.TrimSpace(gitDir)
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(filepath.Dir(gitFile), gitDir)
+	}
+
+	common, err := os.ReadFile(filepath.Join(gitDir, "commondir"))
+	if err != nil {
+		return "", false
+	}
+	commonDir := strings.TrimSpace(string(common))
+	if !filepath.IsAbs(commonDir) {
+		commonDir = filepath.Join(gitDir, commonDir)
+	}
+	commonDir = filepath.Clean(commonDir)
+	if filepath.Base(commonDir) != ".git" {
+		return "", false
+	}
+	return filepath.Dir(commonDir), true
+}
+
+// taggedForRun reports whether a repo with tags passes Options.Tags.
+func (ix *indexer) taggedForRun(tags []string) bool {
+	return len(ix.opts.Tags) == 0 || slices.ContainsFunc(tags, func(tag string) bool {
+		return slices.Contains(ix.opts.Tags, tag)
+	})
+}
+
 func (ix *indexer) shouldSkipRepo(rootDir, repoDir, slug string) (bool, string) {
-	if len(ix.skip) == 0 {
+	if len(ix.opts.SkipRepos) == 0 {
 		return false, ""
 	}
 
+	id := newRepoIdentity(rootDir, repoDir, slug)
+	if ix.opts.SkipRepoCaseSensitive {
+		id = id.caseSensitive()
+	}
+	for _, raw := range ix.opts.SkipRepos {
+		if id.matches(raw) {
+			return true, fmt.Sprintf("repo excluded via --skip-repo %q", raw)
+		}
+	}
+
+	return false, ""
+}
+
+// repoIdentity holds the names a repository can be referred to by in
+// --skip-repo values and config keys.
+type repoIdentity struct {
+	rootDir string
+	abs     string
+	base    string
+	rel     string
+	slug    string
+	// exactCase compares names without case folding.
+	exactCase bool
+}
+
+func newRepoIdentity(rootDir, repoDir, slug string) repoIdentity {
 	repoAbs := filepath.Clean(repoDir)
-	repoAbsLower := strings.ToLower(repoAbs)
-	repoBaseLower := strings.ToLower(filepath.Base(repoAbs))
 
 	rel, err := filepath.Rel(rootDir, repoAbs)
 	if err != nil {
@@ -53,46 +188,106 @@ func (ix *indexer) shouldSkipRepo(rootDir, repoDir, slug string) (bool, string)
 	}
 	rel = strings.TrimPrefix(rel, "./")
 	rel = filepath.ToSlash(rel)
-	relLower := strings.ToLower(rel)
 
-	slugLower := strings.ToLower(slug)
+	return repoIdentity{
+		rootDir: rootDir,
+		abs:     repoAbs,
+		base:    filepath.Base(repoAbs),
+		rel:     rel,
+		slug:    slug,
+	}
+}
 
-	for _, raw := range ix.skip {
-		pattern := strings.TrimSpace(raw)
-		if pattern == "" {
-			continue
-		}
+// caseSensitive returns the identity compared without case folding; names
+// are still Unicode-normalized.
+func (id repoIdentity) caseSensitive() repoIdentity {
+	id.exactCase = true
+	return id
+}
 
-		rawLower := strings.ToLower(pattern)
-		if rawLower == slugLower || rawLower == repoBaseLower || rawLower == relLower {
-			return true, fmt.Sprintf("repo excluded via --skip-repo %q", raw)
-		}
+// key maps a name or pattern to its comparison form.
+func (id repoIdentity) key(s string) string {
+	if id.exactCase {
+		return normalizeName(s)
+	}
+	return foldName(s)
+}
 
-		cleaned := filepath.Clean(pattern)
-		cleanLower := strings.ToLower(cleaned)
-		if cleanLower == repoAbsLower {
-			return true, fmt.Sprintf("repo excluded via --skip-repo %q", raw)
-		}
+// foldName normalizes a repo name or pattern for case-insensitive
+// comparison. Unicode full case folding is locale-independent, so names
+// compare the same under a Turkish locale and "ß" matches "SS".
+func foldName(s string) string {
+	return cases.Fold().String(normalizeName(s))
+}
 
-		cleanSlashLower := strings.ToLower(filepath.ToSlash(cleaned))
-		if cleanSlashLower == relLower {
-			return true, fmt.Sprintf("repo excluded via --skip-repo %q", raw)
-		}
+// matches reports whether pattern names the repo by slug, basename, relative
+// path, or absolute path.
+func (id repoIdentity) matches(raw string) bool {
+	pattern := strings.TrimSpace(raw)
+	if pattern == "" {
+		return false
+	}
 
-		if !filepath.IsAbs(cleaned) {
-			abs := filepath.Join(rootDir, cleaned)
-			if strings.ToLower(filepath.Clean(abs)) == repoAbsLower {
-				return true, fmt.Sprintf("repo excluded via --skip-repo %q", raw)
-			}
+	slug, base, rel, abs := id.key(id.slug), id.key(id.base), id.key(id.rel), id.key(id.abs)
+
+	key := id.key(pattern)
+	if key == slug || key == base || key == rel {
+		return true
+	}
+	// Slugs are transliterated, so a pattern like "services_café" still
+	// matches the slug "services_cafe".
+	if id.key(transliterate(normalizeName(pattern))) == slug {
+		return true
+	}
+
+	cleaned := filepath.Clean(pattern)
+	if id.key(cleaned) == abs {
+		return true
+	}
+
+	if id.key(filepath.ToSlash(cleaned)) == rel {
+		return true
+	}
+
+	if !filepath.IsAbs(cleaned) {
+		joined := filepath.Join(id.rootDir, cleaned)
+		if id.key(filepath.Clean(joined)) == abs {
+			return true
 		}
 	}
 
-	return false, ""
+	return false
 }
 
-func (ix *indexer) processRepo(ctx context.Context, repoDir, rootDir string, dryRun bool) RepoResult {
-	slug := computeCollectionSlug(rootDir, repoDir)
-	ix.repoHeader(repoDir, slug)
+func (ix *indexer) processRepo(ctx context.Context, repo discoveredRepo, rootDir string, dryRun bool) RepoResult {
+	repoDir := repo.path
+	rawSlug := computeCollectionSlug(rootDir, repoDir)
+	slug, fixed, slugErr := ix.collectionName(rawSlug)
+	if slugErr != nil {
+		slug = rawSlug
+	}
+	// A pinned collection is resolved before any skip so a skipped repo
+	// still reports, and --sync keeps, the collection it owns.
+	id := newRepoIdentity(rootDir, repoDir, rawSlug)
+	pinned := ix.config.repoCollection(id)
+	if pinned != "" {
+		// Validated by LoadConfig.
+		slug, fixed, slugErr = pinned, false, nil
+	}
+	log := ix.log(ctx)
+	log.path = repoDir
+	log.setSlug(slug)
+	ctx = withRepoLogger(ctx, log)
+	log.header()
+	ix.emit(Event{
+		Type: EventRepoStarted,
+		Repo: slug,
+		Path: repoDir,
+	})
+	if expected := ix.status.expectedDuration(slug); expected > 0 {
+		log.infof("expected to take about %s (ETA %s) based on recent runs",
+			expected.Round(time.Second), time.Now().Add(expected).Format(time.TimeOnly))
+	}
 
 	result := RepoResult{
 		Path:           repoDir,
@@ -100,26 +295,193 @@ func (ix *indexer) processRepo(ctx context.Context, repoDir, rootDir string, dry
 		DryRun:         dryRun,
 	}
 
-	if skip, reason := ix.shouldSkipRepo(rootDir, repoDir, slug); skip {
-		result.SkipReason = reason
-		ix.repoInfof("skipping indexing: %s", reason)
-		ix.outln("")
+	if skip, reason := ix.shouldSkipRepo(rootDir, repoDir, rawSlug); skip {
+		result.skip(SkipReasonExcludedByFlag, reason)
+		log.infof("skipping indexing: %s", reason)
+		log.done()
+		return result
+	}
+
+	if marker := optOutMarker(repoDir); marker != "" {
+		result.OptedOut = true
+		result.skip(SkipReasonExcludedByMarker, "repo opted out via "+marker)
+		log.infof("skipping indexing: %s", result.SkipDetail)
+		log.done()
 		return result
 	}
 
-	defaultBranch := ix.reportDefaultBranch(ctx, repoDir)
+	if repo.worktreeOf != "" && !ix.opts.IndexLinkedWorktrees {
+		result.skip(SkipReasonExcludedByFlag, "linked worktree of "+repo.worktreeOf)
+		log.infof("skipping indexing: %s", result.SkipDetail)
+		log.done()
+		return result
+	}
+
+	if repo.duplicateOf != "" {
+		result.skip(SkipReasonExcludedByFlag, repo.describeDuplicate())
+		log.infof("skipping indexing: %s", result.SkipDetail)
+		log.done()
+		return result
+	}
+
+	result.Tags = ix.config.repoTags(id)
+	if !ix.taggedForRun(result.Tags) {
+		result.skip(SkipReasonExcludedByFlag, "not tagged "+strings.Join(ix.opts.Tags, " or "))
+		log.infof("skipping indexing: %s", result.SkipDetail)
+		log.done()
+		return result
+	}
+
+	if repo.deferred != "" {
+		result.skip(SkipReasonDeferred, repo.deferred)
+		log.infof("skipping indexing: %s", result.SkipDetail)
+		log.done()
+		return result
+	}
+
+	if pinned != "" {
+		log.infof("using collection %s pinned in the config", slug)
+	}
+	if slugErr != nil {
+		result.fail(fmt.Errorf("invalid collection name: %w", slugErr))
+		log.warnf("%s", result.Error)
+		log.done()
+		return result
+	}
+	if fixed {
+		log.warnf("slug %q is not a valid collection name — using %q", rawSlug, slug)
+	}
+
+	settings, err := ix.resolveRepoSettings(ctx, id, repoDir)
+	if err != nil {
+		result.fail(err)
+		log.warnf("could not load repo settings: %v", err)
+		log.done()
+		return result
+	}
+	result.RemoteName = settings.remoteName
+	result.RemoteURL = settings.remote
+	mapped, movedFrom := slug, ""
+	if pinned == "" {
+		mapped, movedFrom = ix.slugs.resolve(settings.remote, repoDir, slug, dryRun || ix.opts.VerifyOnly)
+	}
+	if mapped != slug {
+		if movedFrom != "" {
+			log.infof("repo moved from %s — reusing collection %s", movedFrom, mapped)
+		} else {
+			log.infof("using collection %s recorded for this remote", mapped)
+		}
+		slug = mapped
+		result.CollectionSlug = slug
+		log.setSlug(slug)
+		result.MovedFrom = movedFrom
+	}
+	if settings.remote != "" {
+		log.infof("remote: %s (%s)", settings.remoteName, settings.remote)
+	}
+
+	// Verify-only runs write nothing, so they need not wait for a run that
+	// is indexing the same collection.
+	if !ix.opts.VerifyOnly {
+		unlock, err := ix.repoLocks.lock(ctx, slug, func(err error) {
+			log.infof("waiting to index: %v", err)
+		})
+		if err != nil {
+			result.fail(fmt.Errorf("lock collection %s: %w", slug, err))
+			log.warnf("%s", result.Error)
+			log.done()
+			return result
+		}
+		defer func() {
+			if err := unlock(); err != nil {
+				log.warnf("%v", err)
+			}
+		}()
+	}
+
+	if err := checkRepoHealth(ctx, repoDir, ix.opts.HealthCheck); err != nil {
+		result.HealthError = err.Error()
+		result.skip(SkipReasonQuarantined, "repository failed health check")
+		log.warnf("health check failed — quarantining repo: %v", err)
+		log.done()
+		return result
+	}
+
+	head, err := inspectHead(ctx, repoDir)
+	if err != nil {
+		log.warnf("could not inspect HEAD: %v", err)
+	}
+	if head != headOnBranch {
+		result.HeadState = head.String()
+	}
+	switch {
+	case head == headUnborn && ix.opts.EmptyRepoPolicy == HeadPolicySkip:
+		result.skip(SkipReasonExcludedByFlag, "empty repository (HEAD has no commits)")
+		log.infof("skipping indexing: %s", result.SkipDetail)
+		log.done()
+		return result
+	case head == headUnborn:
+		log.infof("HEAD has no commits — indexing working tree as-is")
+		ix.runCodegen(ctx, &result, repoDir, settings, dryRun)
+		ix.runCodexForResult(ctx, &result, repoDir, slug, "", nil, "", settings, dryRun)
+		log.done()
+		return result
+	case head == headDetached && ix.opts.DetachedHeadPolicy == HeadPolicySkip:
+		result.skip(SkipReasonExcludedByFlag, "detached HEAD")
+		log.infof("skipping indexing: %s", result.SkipDetail)
+		log.done()
+		return result
+	case head == headDetached:
+		log.infof("HEAD is detached")
+	}
+
+	defaultBranch := ix.reportDefaultBranch(ctx, repoDir, settings.remoteName)
 	result.DefaultBranch = defaultBranch
 
-	indexDir := repoDir
-	idxDir, checkoutOK, pullOK, cleanup := ix.prepareIndexWorkspace(ctx, repoDir, slug, defaultBranch, dryRun)
-	if cleanup != nil {
-		defer cleanup()
+	if ix.opts.VerifyOnly {
+		ix.verifyRepo(ctx, &result, repoDir, slug, defaultBranch, settings)
+		log.done()
+		return result
+	}
+
+	releaseGit := ix.gitSlots.acquire()
+	ws := ix.prepareIndexWorkspace(ctx, repoDir, slug, defaultBranch, settings, dryRun)
+	releaseGit()
+	if ws.cleanup != nil {
+		defer ws.cleanup()
+	}
+	indexDir := ws.dir
+	result.CheckoutOK = ws.checkoutOK
+	result.PullOK = ws.pullOK
+	result.GitFailure = ws.gitFailure
+	result.Git = &ws.prep
+	if ws.gitErr != nil {
+		result.GitErr = ws.gitErr
 	}
-	if idxDir != "" {
-		indexDir = idxDir
+	ix.emit(Event{
+		Type:       EventFetchDone,
+		Repo:       slug,
+		Path:       repoDir,
+		Branch:     defaultBranch,
+		CheckoutOK: ws.checkoutOK,
+		PullOK:     ws.pullOK,
+		GitFailure: ws.gitFailure,
+		Git:        &ws.prep,
+	})
+	if ws.prep.Fallback != "" {
+		switch ix.opts.PrepFailurePolicy {
+		case PrepFailureSkip:
+			result.skip(SkipReasonExcludedByFlag, ws.prepErr().Error())
+			log.infof("skipping indexing: %s", result.SkipDetail)
+			log.done()
+			return result
+		case PrepFailureFail:
+			result.fail(ws.prepErr())
+			log.warnf("%s", result.Error)
+			log.done()
+			return result
+		}
 	}
-	result.CheckoutOK = checkoutOK
-	result.PullOK = pullOK
 
 	indexBranch := ix.selectIndexBranch(ctx, indexDir, defaultBranch)
 	if indexBranch != "" && result.DefaultBranch == "" {
@@ -127,45 +489,231 @@ func (ix *indexer) processRepo(ctx context.Context, repoDir, rootDir string, dry
 	}
 
 	result.IndexedCommit = ix.detectIndexedCommit(ctx, indexDir)
-	result.SkipReason, result.CachedCommit = ix.evaluateSkip(slug, indexBranch, result.IndexedCommit)
+	diffTarget := "HEAD"
+	if dryRun {
+		if tip := ix.previewTip(ctx, indexDir, indexBranch, settings); tip != "" {
+			result.IndexedCommit = tip
+			diffTarget = tip
+		}
+	}
+	if ix.opts.OnNewTag && !ix.selectRelease(ctx, &result, ws, slug, dryRun) {
+		log.done()
+		return result
+	}
+	result.PromptHash = ix.promptHash(settings)
+	skip, cached := ix.evaluateSkip(ctx, slug, indexBranch, result.IndexedCommit, result.PromptHash)
+	result.CachedCommit = cached
+	result.Backfilled = ix.backfill.has(slug)
+	if result.Version != "" {
+		// The commit is already indexed but the release is new: run anyway
+		// so Codex records the version snapshot.
+		skip = nil
+	}
+
+	baseCommit := result.CachedCommit
+	if ix.opts.SinceCommit != "" || !ix.opts.Since.IsZero() {
+		// --since and --since-commit replace the cache-derived diff base.
+		base, sinceSkip, err := ix.sinceBase(ctx, indexDir, result.IndexedCommit)
+		if err != nil {
+			log.warnf("could not resolve --since base: %v — falling back to full indexing", err)
+		}
+		baseCommit = base
+		skip = sinceSkip
+		if skip == nil && base == "" && err == nil {
+			log.infof("entire history is within the --since window — indexing in full")
+		}
+	}
 
-	if result.SkipReason != "" {
-		ix.repoInfof("skipping indexing: %s", result.SkipReason)
-		ix.outln("")
+	if skip != nil {
+		result.skip(skip.Reason, skip.Detail)
+		log.infof("skipping indexing: %s", skip.Detail)
+		log.done()
 		return result
 	}
 
-	var diffFiles []string
-	if result.CachedCommit != "" {
-		result.DiffBaseCommit = result.CachedCommit
-		files, err := diffFilesSince(ctx, indexDir, result.CachedCommit)
+	var diff []diffEntry
+	if baseCommit != "" {
+		result.DiffBaseCommit = baseCommit
+		entries, err := diffEntriesBetween(ctx, indexDir, baseCommit, diffTarget)
 		if err != nil {
-			ix.repoWarnf("could not compute diff vs %s: %v — falling back to full indexing",
-				shortCommit(result.CachedCommit), err)
+			log.warnf("could not compute diff vs %s: %v — falling back to full indexing",
+				shortCommit(baseCommit), err)
+			baseCommit = ""
 		} else {
-			diffFiles = files
-			result.DiffFileCount = len(files)
-			ix.repoInfof("incremental indexing: %d files changed since %s",
-				len(files), shortCommit(result.CachedCommit))
+			diff = entries
+			result.DiffFileCount = len(entries)
+			log.infof("incremental indexing: %d files changed since %s",
+				len(entries), shortCommit(baseCommit))
 		}
 	}
+	if dryRun {
+		ix.previewDiff(ctx, baseCommit, diff)
+		ix.previewFileStats(ctx, &result, indexDir, diffTarget, settings)
+	}
 
-	ran, exitCode, codexErr := ix.runCodex(ctx, indexDir, slug, result.CachedCommit, diffFiles, dryRun)
-	result.CodexRan = ran
-	if exitCode != nil {
-		result.CodexExitCode = exitCode
+	ix.runCodegen(ctx, &result, indexDir, settings, dryRun)
+	ix.runCodexForResult(ctx, &result, indexDir, slug, baseCommit, diff, indexBranch, settings, dryRun)
+	log.done()
+	return result
+}
+
+// runCodexForResult runs Codex, records the outcome on result, and updates
+// the commit cache on success when a branch and commit are known.
+func (ix *indexer) runCodexForResult(
+	ctx context.Context,
+	result *RepoResult,
+	indexDir, slug, baseCommit string,
+	diff []diffEntry,
+	indexBranch string,
+	settings repoSettings,
+	dryRun bool,
+) {
+	var before documentSnapshot
+	if ix.opts.DocumentChanges && !dryRun && !ix.opts.OnboardingOnly {
+		var err error
+		if before, err = ix.snapshotDocuments(ctx, slug); err != nil {
+			ix.log(ctx).warnf("could not count document changes: %v", err)
+		}
 	}
+
+	releaseCodex := ix.codexSlots.acquire()
+	manifest := ix.buildManifest(ctx, result, indexDir, slug, baseCommit, indexBranch, diff, settings)
+	ix.prepareRedaction(ctx, manifest, indexDir, settings.redact)
+	ix.prepareOnboarding(ctx, manifest, slug, dryRun)
+	ix.prepareIssues(ctx, manifest, settings.remote, dryRun)
+	ix.prepareDependencies(ctx, manifest, indexDir)
+	passes := ix.indexPasses(settings, manifest)
+	ix.applyPromptBudget(ctx, result, manifest, longestPrompt(passes))
+	switch {
+	case ix.opts.Ingest == IngestLocal:
+		// No agent runs; the indexer stores its own summaries below.
+		passes = nil
+		manifest.Dependencies = nil
+	case dryRun:
+		ix.recordMockRun(ctx, result, manifest, passes)
+	case ix.opts.Ingest == IngestDirect:
+		removeOutput, err := ix.createOutputFile(manifest)
+		if err != nil {
+			releaseCodex()
+			result.fail(err)
+			return
+		}
+		defer func() {
+			if err := removeOutput(); err != nil {
+				ix.log(ctx).warnf("could not remove agent output: %v", err)
+			}
+		}()
+	}
+
+	tail := newOutputTail(ix.opts.OutputTail)
+	scan := newOutputScanner(ix.masker.mask)
+	var codexErr error
+	for i, pass := range passes {
+		if pass.name != "" {
+			manifest.Pass = &manifestPass{Name: pass.name, Number: i + 1, Count: len(passes)}
+			ix.log(ctx).infof("pass %d/%d: %s", i+1, len(passes), pass.name)
+		}
+		if !dryRun {
+			ix.staggerCodex(ctx)
+			ix.emit(Event{
+				Type:   EventCodexStarted,
+				Repo:   slug,
+				Path:   result.Path,
+				Branch: indexBranch,
+				Commit: result.IndexedCommit,
+				Pass:   pass.name,
+			})
+		}
+		started := time.Now()
+		ran, exitCode, err := ix.runCodex(ctx, indexDir, manifest, settings, pass, tail, scan, dryRun)
+		if ran {
+			result.AgentDurationMS += time.Since(started).Milliseconds()
+		}
+		if err == nil && ran {
+			// An exit code of 0 does not prove the agent wrote anything.
+			if _, outErr := scan.result(); outErr != nil {
+				err = outErr
+			}
+		}
+		result.CodexRan = result.CodexRan || ran
+		if exitCode != nil {
+			result.CodexExitCode = exitCode
+		}
+		if ran {
+			finished := Event{
+				Type:     EventCodexFinished,
+				Repo:     slug,
+				Path:     result.Path,
+				ExitCode: exitCode,
+				Pass:     pass.name,
+			}
+			if err != nil {
+				finished.Error = err.Error()
+			}
+			ix.emit(finished)
+		}
+		if pass.name != "" {
+			pr := PassResult{
+				Name:          pass.name,
+				CodexExitCode: exitCode,
+				DurationMS:    time.Since(started).Milliseconds(),
+				CodexRan:      ran,
+			}
+			if err != nil {
+				pr.Err = err
+				pr.Error = err.Error()
+				pr.ErrorKind = errorKind(err)
+			}
+			result.Passes = append(result.Passes, pr)
+		}
+		if err != nil {
+			// Later passes build on earlier ones, so stop at the first failure.
+			codexErr = passError(pass.name, err)
+			break
+		}
+	}
+	releaseCodex()
+	result.OutputWarnings, _ = scan.result()
+	for _, w := range result.OutputWarnings {
+		ix.log(ctx).warnf("agent output shows %s (%d lines): %s", w.Kind, w.Count, w.Line)
+	}
+	if codexErr == nil {
+		switch {
+		case ix.opts.Ingest == IngestLocal:
+			codexErr = ix.ingestLocal(ctx, result, manifest, indexDir, settings.redact, dryRun)
+		case ix.opts.Ingest == IngestDirect && !dryRun:
+			codexErr = ix.ingestOutput(ctx, result, manifest)
+		}
+	}
+	if codexErr == nil && !dryRun {
+		ix.recordOnboarding(ctx, result, manifest)
+	}
+	// A failed pass may have written some documents; report them too.
+	if before != nil && (result.CodexRan || ix.opts.Ingest == IngestLocal) {
+		ix.recordDocumentChanges(ctx, result, manifest.Collection, before)
+	}
+
 	if codexErr != nil {
-		result.Error = codexErr.Error()
-	} else if !dryRun && ix.cache != nil && indexBranch != "" && result.IndexedCommit != "" {
+		result.fail(codexErr)
+		result.OutputTail = tail.String()
+		return
+	}
+	if ix.opts.ValidateMetadata && !dryRun && !ix.opts.OnboardingOnly {
+		ix.validateStored(ctx, result, manifest)
+	}
+	if !ix.opts.OnboardingOnly {
+		ix.replicate(ctx, result, manifest.Collection, dryRun)
+	}
+	// Onboarding-only runs leave the store untouched, so the cache must not
+	// claim the commit was indexed.
+	if !dryRun && !ix.opts.OnboardingOnly && ix.cache != nil && indexBranch != "" && result.IndexedCommit != "" {
 		ix.cache.Update(slug, indexBranch, result.IndexedCommit)
+		ix.cache.Update(slug, tagCacheKey, result.Version)
+		ix.cache.Update(slug, promptCacheKey, result.PromptHash)
 		if err := ix.persistCache(); err != nil {
-			ix.repoWarnf("commit cache save failed: %v", err)
+			ix.log(ctx).warnf("commit cache save failed: %v", err)
 		}
 	}
-
-	ix.outln("")
-	return result
 }
 
 func computeCollectionSlug(rootDir, repoDir string) string {
@@ -175,100 +723,180 @@ func computeCollectionSlug(rootDir, repoDir string) string {
 	}
 	rel = strings.TrimPrefix(rel, "./")
 	rel = strings.ReplaceAll(rel, string(filepath.Separator), "_")
-	return rel
+	return transliterate(normalizeName(rel))
 }
 
-func detectDefaultBranch(ctx context.Context, repoDir string) (string, error) {
+// defaultBranchFallbacks are checked in order when <remote>/HEAD is unset.
+var defaultBranchFallbacks = []string{"main", "master"}
+
+func detectDefaultBranch(ctx context.Context, repoDir, remote string, fallbacks []string) (string, error) {
 	cmd := exec.CommandContext(ctx, "git", "-C", repoDir, "symbolic-ref", "--quiet", "--short",
-		"refs/remotes/origin/HEAD")
-	out, err := cmd.Output()
+		"refs/remotes/"+remote+"/HEAD")
+	out, err := procOutput(ctx, cmd)
 	if err == nil {
 		branch := strings.TrimSpace(string(out))
-		branch = strings.TrimPrefix(branch, "origin/")
+		branch = strings.TrimPrefix(branch, remote+"/")
 		return branch, nil
 	}
 	var exitErr *exec.ExitError
 	if !errors.As(err, &exitErr) {
-		return "", fmt.Errorf("detect origin head: %w", err)
+		return "", fmt.Errorf("detect %s head: %w", remote, err)
 	}
 
-	mainErr := exec.CommandContext(ctx, "git", "-C", repoDir, "show-ref", "--verify", "--quiet",
-		"refs/heads/main").Run()
-	if mainErr == nil {
-		return "main", nil
-	}
-	var mainExitErr *exec.ExitError
-	if !errors.As(mainErr, &mainExitErr) {
-		return "", fmt.Errorf("check main branch: %w", mainErr)
+	for _, branch := range fallbacks {
+		checkErr := procRun(ctx, exec.CommandContext(ctx, "git", "-C", repoDir, "show-ref", "--verify", "--quiet",
+			"refs/heads/"+branch))
+		if checkErr == nil {
+			return branch, nil
+		}
+		var checkExitErr *exec.ExitError
+		if !errors.As(checkErr, &checkExitErr) {
+			return "", fmt.Errorf("check %s branch: %w", branch, checkErr)
+		}
 	}
+	return "", nil
+}
 
-	masterErr := exec.CommandContext(ctx, "git", "-C", repoDir, "show-ref", "--verify", "--quiet",
-		"refs/heads/master").Run()
-	if masterErr == nil {
-		return "master", nil
-	}
-	var masterExitErr *exec.ExitError
-	if !errors.As(masterErr, &masterExitErr) {
-		return "", fmt.Errorf("check master branch: %w", masterErr)
+// codexPath returns the agent executable to run.
+func (ix *indexer) codexPath() string {
+	if ix.opts.CodexPath != "" {
+		return ix.opts.CodexPath
 	}
-	return "", nil
+	return ix.opts.AgentBackend.Executable()
 }
 
 func (ix *indexer) runCodex(
 	ctx context.Context,
-	repoDir, slug, baseCommit string,
-	diffFiles []string,
+	repoDir string,
+	manifest *indexManifest,
+	settings repoSettings,
+	pass indexPass,
+	tail *outputTail,
+	scan *outputScanner,
 	dryRun bool,
 ) (bool, *int, error) {
+	agent := ix.opts.AgentBackend.Name()
+	// The checkout and the worktree Codex runs in are both protected.
+	sandbox := readOnlySandbox{readOnly: []string{manifest.Repo.Path, repoDir}}
+
+	if dryRun {
+		argv, _ := ix.agentCommand(repoDir, pass.prompt, "")
+		ix.log(ctx).infof("[dry-run] %s", describeArgv(argv, pass.prompt))
+		ix.log(ctx).infof("[dry-run] %s: collection=%s mode=%s diff=%d languages=%s", manifestEnvVar,
+			manifest.Collection, manifest.Mode, len(manifest.Diff), orDash(manifest.languageNames()))
+		if manifest.Version != "" {
+			ix.log(ctx).infof("[dry-run] release: %s", manifest.Version)
+		}
+		if len(settings.env) > 0 {
+			ix.log(ctx).infof("[dry-run] extra env: %s", strings.Join(slices.Sorted(maps.Keys(settings.env)), ", "))
+		}
+		if launchers := ix.opts.CodexLimits.wrap(nil); len(launchers) > 0 {
+			ix.log(ctx).infof("[dry-run] resource limits: %s", strings.Join(launchers, " "))
+		}
+		if ix.opts.ReadOnlyWorktree {
+			ix.log(ctx).infof("[dry-run] read-only: %s", strings.Join(sandbox.dirs(), ", "))
+		}
+		if ix.opts.Ingest == IngestDirect {
+			ix.log(ctx).infof("[dry-run] direct ingestion: the indexer would store the agent's output in %s",
+				manifest.Collection)
+		}
+		return false, nil, nil
+	}
+
+	log := ix.log(ctx)
+	var report string
+	if ix.artifacts != nil && log.artifact != "" {
+		var err error
+		if report, err = ix.artifacts.reportPath(log.artifact, pass.name); err != nil {
+			return false, nil, err
+		}
+	}
+	codexArgv, writesReport := ix.agentCommand(repoDir, pass.prompt, report)
+	var reportFile *os.File
+	if report != "" && !writesReport {
+		f, err := os.Create(report)
+		if err != nil {
+			return false, nil, fmt.Errorf("create agent report: %w", err)
+		}
+		defer func() {
+			if err := f.Close(); err != nil {
+				ix.log(ctx).warnf("could not close agent report: %v", err)
+			}
+		}()
+		reportFile = f
+	}
+	if ix.opts.ReadOnlyWorktree {
+		scratch, err := os.MkdirTemp(ix.tempDir(), "ai-indexer-scratch-")
+		if err != nil {
+			return false, nil, fmt.Errorf("create codex scratch dir: %w", err)
+		}
+		defer func() {
+			if err := os.RemoveAll(scratch); err != nil {
+				ix.log(ctx).warnf("could not remove scratch dir %q: %v", scratch, err)
+			}
+		}()
+		sandbox.scratch = scratch
+		manifest.Scratch = scratch
+		codexArgv = sandbox.wrap(codexArgv)
+	}
+	argv := ix.opts.CodexLimits.wrap(codexArgv)
+
+	manifestPath, err := manifest.write(ix.tempDir())
+	if err != nil {
+		return false, nil, err
+	}
+	defer func() {
+		if err := manifest.remove(manifestPath); err != nil {
+			ix.log(ctx).warnf("could not remove manifest %q: %v", manifestPath, err)
+		}
+	}()
+
 	cmdCtx := ctx
 	var cancel context.CancelFunc
-	if ix.codexTimeout > 0 {
-		cmdCtx, cancel = context.WithTimeout(ctx, ix.codexTimeout)
+	if pass.timeout > 0 {
+		cmdCtx, cancel = context.WithTimeout(ctx, pass.timeout)
 		defer cancel()
 	}
 
-	cmd := exec.CommandContext(cmdCtx, "codex", "exec",
-		"--cd", repoDir,
-		"--sandbox", "danger-full-access",
-		"--dangerously-bypass-approvals-and-sandbox",
-		codexPrompt)
+	cmd := exec.CommandContext(cmdCtx, argv[0], argv[1:]...)
+	cmd.Dir = repoDir
 	env := os.Environ()
-	env = append(env, "COLLECTION_SLUG="+slug)
-	if baseCommit != "" {
-		env = append(env, "INDEX_BASE_COMMIT="+baseCommit)
-	}
-	if len(diffFiles) > 0 {
-		env = append(env, "INDEX_DIFF_FILES="+strings.Join(diffFiles, "\n"))
+	env = append(env, ix.scratchEnv()...)
+	env = append(env, envList(settings.env)...)
+	env = append(env, manifestEnvVar+"="+manifestPath)
+	if sandbox.scratch != "" {
+		env = append(env, sandbox.env()...)
 	}
 	cmd.Env = env
-	cmd.Stdout = ix.stdout
-	cmd.Stderr = ix.stderr
-
-	if dryRun {
-		desc := fmt.Sprintf(
-			"[dry-run] COLLECTION_SLUG=%q codex exec --cd %q --sandbox danger-full-access --dangerously-bypass-approvals-and-sandbox '<PROMPT>'",
-			slug,
-			repoDir,
-		)
-		if baseCommit != "" {
-			desc += fmt.Sprintf(" (incremental from %s)", shortCommit(baseCommit))
-		}
-		ix.repoInfof("%s", desc)
-		return false, nil, nil
+	scanOut := scan.writer(runnerLines(ix.opts.AgentBackend))
+	scanErr := scan.writer(runnerLines(ix.opts.AgentBackend))
+	defer scanOut.flush()
+	defer scanErr.flush()
+	stdout, stderr := []io.Writer{ix.stdout, tail, scanOut}, []io.Writer{ix.stderr, tail, scanErr}
+	if log.file != nil {
+		stdout, stderr = append(stdout, log.file), append(stderr, log.file)
 	}
+	if reportFile != nil {
+		stdout = append(stdout, reportFile)
+	}
+	cmd.Stdout = io.MultiWriter(stdout...)
+	cmd.Stderr = io.MultiWriter(stderr...)
 
-	feeder := newNewlineFeeder(codexInputKeepAliveInterval)
+	stdin, closeStdin, err := codexInput(ix.opts.CodexStdin, ix.opts.CodexKeepAlive)
+	if err != nil {
+		return false, nil, err
+	}
 	defer func() {
-		if err := feeder.Close(); err != nil {
-			ix.repoWarnf("codex input feeder close failed: %v", err)
+		if err := closeStdin(); err != nil {
+			ix.log(ctx).warnf("codex input close failed: %v", err)
 		}
 	}()
-	cmd.Stdin = feeder
+	cmd.Stdin = stdin
 
-	ix.repoInfof("running Codex indexing")
-	err := cmd.Run()
+	ix.log(ctx).infof("running %s indexing", agent)
+	err = procRun(cmdCtx, cmd)
 	if err == nil {
-		ix.repoInfof("Codex indexing completed")
+		ix.log(ctx).infof("%s indexing completed", agent)
 		return true, nil, nil
 	}
 
@@ -279,30 +907,29 @@ func (ix *indexer) runCodex(
 	}
 
 	if errors.Is(cmdCtx.Err(), context.DeadlineExceeded) {
-		if ix.codexTimeout > 0 {
-			ix.repoWarnf("Codex timed out after %s", ix.codexTimeout)
+		if pass.timeout > 0 {
+			ix.log(ctx).warnf("%s timed out after %s", agent, pass.timeout)
 		} else {
-			ix.repoWarnf("Codex timed out (context deadline exceeded)")
+			ix.log(ctx).warnf("%s timed out (context deadline exceeded)", agent)
 		}
-		timeoutErr := fmt.Errorf("codex exec deadline exceeded: %w", err)
-		return true, &exitCode, timeoutErr
+		return true, &exitCode, &AgentTimeout{Err: err, Timeout: pass.timeout}
 	}
 
-	ix.repoWarnf("Codex exited with code %d", exitCode)
-	return true, &exitCode, fmt.Errorf("codex exec: %w", err)
+	ix.log(ctx).warnf("%s exited with code %d", agent, exitCode)
+	return true, &exitCode, &AgentExitError{Err: err, ExitCode: exitCode}
 }
 
-func (ix *indexer) reportDefaultBranch(ctx context.Context, repoDir string) string {
-	db, err := detectDefaultBranch(ctx, repoDir)
+func (ix *indexer) reportDefaultBranch(ctx context.Context, repoDir, remote string) string {
+	db, err := detectDefaultBranch(ctx, repoDir, remote, ix.opts.BranchFallbacks)
 	if err != nil {
-		ix.repoWarnf("could not detect default branch: %v", err)
+		ix.log(ctx).warnf("could not detect default branch: %v", err)
 		return ""
 	}
 	if db == "" {
-		ix.repoWarnf("could not detect default branch — skipping checkout/pull")
+		ix.log(ctx).warnf("could not detect default branch — skipping checkout/pull")
 		return ""
 	}
-	ix.repoInfof("default branch: %s", db)
+	ix.log(ctx).infof("default branch: %s", db)
 	return db
 }
 
@@ -312,11 +939,15 @@ func (ix *indexer) selectIndexBranch(ctx context.Context, repoDir, defaultBranch
 	}
 	branch, err := currentBranch(ctx, repoDir)
 	if err != nil {
-		ix.repoWarnf("could not determine current branch: %v", err)
+		ix.log(ctx).warnf("could not determine current branch: %v", err)
+		return ""
+	}
+	if branch == "HEAD" {
+		ix.log(ctx).infof("detached HEAD without a default branch — commit cache disabled")
 		return ""
 	}
 	if branch != "" {
-		ix.repoInfof("using current branch: %s", branch)
+		ix.log(ctx).infof("using current branch: %s", branch)
 	}
 	return branch
 }
@@ -324,25 +955,45 @@ func (ix *indexer) selectIndexBranch(ctx context.Context, repoDir, defaultBranch
 func (ix *indexer) detectIndexedCommit(ctx context.Context, repoDir string) string {
 	commit, err := headCommit(ctx, repoDir)
 	if err != nil {
-		ix.repoWarnf("could not determine HEAD commit: %v", err)
+		ix.log(ctx).warnf("could not determine HEAD commit: %v", err)
 		return ""
 	}
 	return commit
 }
 
-func (ix *indexer) evaluateSkip(slug, branch, commit string) (string, string) {
+// evaluateSkip decides whether commit on branch is already indexed, and
+// returns the cached commit to diff against. A collection missing from the
+// store, or a prompt hash that differs from the one recorded with the
+// cache, makes the cached commit stale so the repo is indexed in full.
+func (ix *indexer) evaluateSkip(ctx context.Context, slug, branch, commit, promptHash string) (*Skipped, string) {
 	if ix.cache == nil || branch == "" || commit == "" {
-		return "", ""
+		return nil, ""
 	}
 	last, ok := ix.cache.LastCommit(slug, branch)
 	if !ok {
-		return "", ""
+		return nil, ""
+	}
+	if ix.sync.missing(slug) {
+		ix.log(ctx).infof("collection %s is missing from the store — reindexing from scratch", slug)
+		return nil, ""
+	}
+	if empty, err := ix.backfill.empty(ctx, slug); err != nil {
+		ix.log(ctx).warnf("could not count documents for --backfill: %v — trusting the commit cache", err)
+	} else if empty {
+		ix.log(ctx).infof("collection %s has no documents — backfilling from scratch", slug)
+		return nil, ""
+	}
+	// Caches written before prompts were hashed have no entry; they are
+	// trusted rather than reindexing every repo at once.
+	if prev, ok := ix.cache.LastCommit(slug, promptCacheKey); ok && prev != "" && prev != promptHash {
+		ix.log(ctx).infof("prompt changed since the last index (%s, now %s) — reindexing in full", prev, promptHash)
+		return nil, ""
 	}
 	if last == commit {
-		msg := fmt.Sprintf("commit %s on %s already indexed", shortCommit(commit), branch)
-		return msg, last
+		detail := fmt.Sprintf("commit %s on %s already indexed", shortCommit(commit), branch)
+		return &Skipped{Reason: SkipReasonCacheHit, Detail: detail}, last
 	}
-	return "", last
+	return nil, last
 }
 
 func boolPtr(b bool) *bool {
@@ -356,27 +1007,28 @@ func shortCommit(commit string) string {
 	return commit
 }
 
-func diffFilesSince(ctx context.Context, repoDir, baseCommit string) ([]string, error) {
-	if baseCommit == "" {
-		return nil, errors.New("base commit is required to compute a diff")
-	}
-
-	cmd := exec.CommandContext(ctx, "git", "-C", repoDir, "diff", "--name-only", baseCommit, "HEAD")
-	out, err := cmd.Output()
-	if err != nil {
-		return nil, fmt.Errorf("git diff --name-only %s HEAD: %w", baseCommit, err)
-	}
-
-	lines := strings.Split(strings.ReplaceAll(string(out), "\r\n", "\n"), "\n")
-	files := make([]string, 0, len(lines))
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
+// codexInput returns Codex's stdin for mode and a func releasing it once
+// Codex has exited. A zero interval uses codexInputKeepAliveInterval.
+func codexInput(mode string, interval time.Duration) (io.Reader, func() error, error) {
+	switch mode {
+	case StdinClosed:
+		// A nil Stdin is the null device, which reads as end of input.
+		return nil, func() error { return nil }, nil
+	case StdinNone:
+		// An *os.File is handed to Codex directly, so nothing copies into
+		// the pipe and its write end stays open until Codex exits.
+		r, w, err := os.Pipe()
+		if err != nil {
+			return nil, nil, fmt.Errorf("create codex stdin pipe: %w", err)
+		}
+		return r, func() error { return errors.Join(w.Close(), r.Close()) }, nil
+	default:
+		if interval <= 0 {
+			interval = codexInputKeepAliveInterval
 		}
-		files = append(files, line)
+		feeder := newNewlineFeeder(interval)
+		return feeder, feeder.Close, nil
 	}
-	return files, nil
 }
 
 type newlineFeeder struct {
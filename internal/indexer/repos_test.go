@@ -2,6 +2,7 @@ package indexer
 
 import (
 	"io"
+	"maps"
 	"os"
 	"path/filepath"
 	"slices"
@@ -26,6 +27,18 @@ func TestComputeCollectionSlug(t *testing.T) {
 			repoDir: repoDir,
 			want:    "services_api",
 		},
+		"composed accent": {
+			repoDir: filepath.Join(rootDir, "caf\u00e9"),
+			want:    "cafe",
+		},
+		"decomposed accent": {
+			repoDir: filepath.Join(rootDir, "cafe\u0301"),
+			want:    "cafe",
+		},
+		"cyrillic": {
+			repoDir: filepath.Join(rootDir, "Проект"),
+			want:    "Proekt",
+		},
 	}
 
 	for name, tc := range tests {
@@ -87,7 +100,7 @@ func TestShouldSkipRepo(t *testing.T) {
 
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
-			ix := newIndexer(io.Discard, io.Discard, nil, tc.skip, 0, 1)
+			ix := newIndexer(io.Discard, io.Discard, nil, nil, Options{SkipRepos: tc.skip})
 			skip, reason := ix.shouldSkipRepo(rootDir, repoDir, slug)
 			if skip != tc.wantSkip {
 				t.Fatalf("expected skip=%t, got %t", tc.wantSkip, skip)
@@ -102,7 +115,69 @@ func TestShouldSkipRepo(t *testing.T) {
 	}
 }
 
-func TestDiffFilesSince(t *testing.T) {
+func TestShouldSkipRepoUnicode(t *testing.T) {
+	rootDir := t.TempDir()
+	// A decomposed name, as macOS stores it on disk.
+	repoDir := filepath.Join(rootDir, "services", "cafe\u0301")
+	slug := computeCollectionSlug(rootDir, repoDir)
+
+	tests := map[string]struct {
+		skip     string
+		wantSkip bool
+	}{
+		"composed basename":     {skip: "caf\u00e9", wantSkip: true},
+		"composed relative":     {skip: "services/caf\u00e9", wantSkip: true},
+		"uppercase composed":    {skip: "CAF\u00c9", wantSkip: true},
+		"accented slug pattern": {skip: "services_caf\u00e9", wantSkip: true},
+		"transliterated slug":   {skip: "services_cafe", wantSkip: true},
+		"different name":        {skip: "cafes", wantSkip: false},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ix := newIndexer(io.Discard, io.Discard, nil, nil, Options{SkipRepos: []string{tc.skip}})
+			if skip, _ := ix.shouldSkipRepo(rootDir, repoDir, slug); skip != tc.wantSkip {
+				t.Fatalf("expected skip=%t for %q", tc.wantSkip, tc.skip)
+			}
+		})
+	}
+}
+
+func TestShouldSkipRepoCaseFolding(t *testing.T) {
+	rootDir := t.TempDir()
+
+	tests := map[string]struct {
+		dir           string
+		skip          string
+		caseSensitive bool
+		wantSkip      bool
+	}{
+		"ascii":                    {dir: "api", skip: "API", wantSkip: true},
+		"dotless capital i":        {dir: "istanbul", skip: "ISTANBUL", wantSkip: true},
+		"sharp s":                  {dir: "straße", skip: "STRASSE", wantSkip: true},
+		"greek final sigma":        {dir: "σίσυφος", skip: "ΣΊΣΥΦΟΣ", wantSkip: true},
+		"case sensitive exact":     {dir: "api", skip: "api", caseSensitive: true, wantSkip: true},
+		"case sensitive mismatch":  {dir: "api", skip: "API", caseSensitive: true, wantSkip: false},
+		"case sensitive unicode":   {dir: "cafe\u0301", skip: "caf\u00e9", caseSensitive: true, wantSkip: true},
+		"case sensitive uppercase": {dir: "straße", skip: "STRASSE", caseSensitive: true, wantSkip: false},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			repoDir := filepath.Join(rootDir, tc.dir)
+			ix := newIndexer(io.Discard, io.Discard, nil, nil, Options{
+				SkipRepos:             []string{tc.skip},
+				SkipRepoCaseSensitive: tc.caseSensitive,
+			})
+			skip, _ := ix.shouldSkipRepo(rootDir, repoDir, computeCollectionSlug(rootDir, repoDir))
+			if skip != tc.wantSkip {
+				t.Fatalf("expected skip=%t for %q against %q", tc.wantSkip, tc.skip, tc.dir)
+			}
+		})
+	}
+}
+
+func TestDiffEntriesBetween(t *testing.T) {
 	ctx := t.Context()
 	repoDir := t.TempDir()
 
@@ -117,29 +192,55 @@ func TestDiffFilesSince(t *testing.T) {
 	if err := os.WriteFile(readmePath, []byte("updated\n"), 0o644); err != nil {
 		t.Fatalf("write readme: %v", err)
 	}
-	if err := runGit(repoDir, "add", "README.md"); err != nil {
+	if err := os.WriteFile(filepath.Join(repoDir, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0o644); err != nil {
+		t.Fatalf("write main.go: %v", err)
+	}
+	if err := runGit(repoDir, "add", "."); err != nil {
 		t.Fatalf("git add: %v", err)
 	}
 	if err := runGit(repoDir, "commit", "-m", "update readme"); err != nil {
 		t.Fatalf("git commit: %v", err)
 	}
+	midCommit, err := headCommit(ctx, repoDir)
+	if err != nil {
+		t.Fatalf("head commit: %v", err)
+	}
+	if err := runGit(repoDir, "mv", "main.go", "cmd.go"); err != nil {
+		t.Fatalf("git mv: %v", err)
+	}
+	if err := runGit(repoDir, "commit", "-m", "rename main"); err != nil {
+		t.Fatalf("git commit: %v", err)
+	}
+
+	entries, err := diffEntriesBetween(ctx, repoDir, baseCommit, midCommit)
+	if err != nil {
+		t.Fatalf("diff entries: %v", err)
+	}
+	want := []diffEntry{
+		{Path: "README.md", Status: "M"},
+		{Path: "main.go", Status: "A"},
+	}
+	if !slices.Equal(entries, want) {
+		t.Fatalf("expected %v, got %v", want, entries)
+	}
 
-	files, err := diffFilesSince(ctx, repoDir, baseCommit)
+	entries, err = diffEntriesBetween(ctx, repoDir, midCommit, "HEAD")
 	if err != nil {
-		t.Fatalf("diff files: %v", err)
+		t.Fatalf("diff entries: %v", err)
 	}
-	if !slices.Contains(files, "README.md") {
-		t.Fatalf("expected README.md in diff, got %v", files)
+	if len(entries) != 1 || entries[0].Status != "R" || entries[0].OldPath != "main.go" ||
+		entries[0].Path != "cmd.go" {
+		t.Fatalf("expected rename main.go -> cmd.go, got %v", entries)
 	}
 }
 
-func TestDiffFilesSinceRequiresBaseCommit(t *testing.T) {
+func TestDiffEntriesBetweenRequiresBaseCommit(t *testing.T) {
 	ctx := t.Context()
 	repoDir := t.TempDir()
 
 	initGitRepo(t, repoDir)
 
-	_, err := diffFilesSince(ctx, repoDir, "")
+	_, err := diffEntriesBetween(ctx, repoDir, "", "HEAD")
 	if err == nil {
 		t.Fatalf("expected error for empty base commit")
 	}
@@ -166,3 +267,134 @@ func TestNewlineFeeder(t *testing.T) {
 		t.Fatalf("expected EOF after close")
 	}
 }
+
+func TestFindGitReposLinkedWorktrees(t *testing.T) {
+	rootDir := t.TempDir()
+	primary := filepath.Join(rootDir, "primary")
+	linked := filepath.Join(rootDir, "linked")
+	outside := filepath.Join(t.TempDir(), "outside")
+	orphan := filepath.Join(rootDir, "orphan")
+
+	initGitRepo(t, primary)
+	initGitRepo(t, outside)
+	if err := runGit(primary, "worktree", "add", "--detach", linked); err != nil {
+		t.Fatalf("git worktree add: %v", err)
+	}
+	if err := runGit(outside, "worktree", "add", "--detach", orphan); err != nil {
+		t.Fatalf("git worktree add: %v", err)
+	}
+
+	submodule := filepath.Join(rootDir, "submodule")
+	if err := os.MkdirAll(submodule, 0o755); err != nil {
+		t.Fatalf("create submodule dir: %v", err)
+	}
+	gitFile := filepath.Join(submodule, ".git")
+	if err := os.WriteFile(gitFile, []byte("gitdir: ../primary/.git/modules/sub\n"), 0o644); err != nil {
+		t.Fatalf("write gitfile: %v", err)
+	}
+
+	repos, err := findGitRepos(rootDir)
+	if err != nil {
+		t.Fatalf("find repos: %v", err)
+	}
+
+	got := make(map[string]string, len(repos))
+	for _, repo := range repos {
+		got[repo.path] = repo.worktreeOf
+	}
+
+	want := map[string]string{
+		primary: "",
+		linked:  primary,
+		orphan:  "",
+	}
+	if !maps.Equal(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestDetectDefaultBranchFallbacks(t *testing.T) {
+	repoDir := t.TempDir()
+	initGitRepo(t, repoDir)
+
+	tests := map[string]struct {
+		fallbacks []string
+		want      string
+	}{
+		"defaults miss trunk": {
+			fallbacks: defaultBranchFallbacks,
+			want:      "",
+		},
+		"custom order": {
+			fallbacks: []string{"develop", "trunk", "main"},
+			want:      "trunk",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := detectDefaultBranch(t.Context(), repoDir, defaultRemote, tc.fallbacks)
+			if err != nil {
+				t.Fatalf("detect default branch: %v", err)
+			}
+			if got != tc.want {
+				t.Fatalf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestCodexInput(t *testing.T) {
+	t.Run("keepalive", func(t *testing.T) {
+		stdin, closeStdin, err := codexInput(StdinKeepAlive, 10*time.Millisecond)
+		if err != nil {
+			t.Fatalf("codexInput: %v", err)
+		}
+		buf := make([]byte, 1)
+		if n, err := stdin.Read(buf); err != nil || n != 1 || buf[0] != '\n' {
+			t.Fatalf("expected a newline, got %q, %v", buf[:n], err)
+		}
+		if err := closeStdin(); err != nil {
+			t.Fatalf("close: %v", err)
+		}
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		stdin, closeStdin, err := codexInput(StdinClosed, 0)
+		if err != nil {
+			t.Fatalf("codexInput: %v", err)
+		}
+		if stdin != nil {
+			t.Fatalf("expected the null device, got %T", stdin)
+		}
+		if err := closeStdin(); err != nil {
+			t.Fatalf("close: %v", err)
+		}
+	})
+
+	t.Run("none", func(t *testing.T) {
+		stdin, closeStdin, err := codexInput(StdinNone, 0)
+		if err != nil {
+			t.Fatalf("codexInput: %v", err)
+		}
+		if _, ok := stdin.(*os.File); !ok {
+			t.Fatalf("expected a pipe handed to Codex directly, got %T", stdin)
+		}
+		read := make(chan int, 1)
+		go func() {
+			n, _ := stdin.Read(make([]byte, 1))
+			read <- n
+		}()
+		select {
+		case n := <-read:
+			t.Fatalf("expected stdin to stay open and silent, read returned %d bytes", n)
+		case <-time.After(50 * time.Millisecond):
+		}
+		if err := closeStdin(); err != nil {
+			t.Fatalf("close: %v", err)
+		}
+		if n := <-read; n != 0 {
+			t.Fatalf("expected no input after close, got %d bytes", n)
+		}
+	})
+}
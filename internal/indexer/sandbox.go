@@ -0,0 +1,56 @@
+package indexer
+
+import (
+	"fmt"
+	"os/exec"
+	"slices"
+)
+
+// sandboxTool is the launcher that binds source checkouts read-only.
+const sandboxTool = "bwrap"
+
+// readOnlySandbox launches Codex through bubblewrap with source trees bound
+// read-only over themselves, so even a misbehaving prompt cannot modify a
+// checkout. The rest of the filesystem, the network, and Codex's own state
+// stay as they are; scratch is a private writable directory that is also
+// exported as TMPDIR.
+type readOnlySandbox struct {
+	scratch  string
+	readOnly []string
+}
+
+// checkSandbox reports whether the read-only sandbox can be used.
+func checkSandbox() error {
+	if _, err := exec.LookPath(sandboxTool); err != nil {
+		return fmt.Errorf("read-only worktree needs %s: %w", sandboxTool, err)
+	}
+	return nil
+}
+
+// wrap prefixes argv with bwrap. bwrap execs argv in place, so it keeps
+// the PID the indexer waits on and cancels.
+func (s readOnlySandbox) wrap(argv []string) []string {
+	prefix := []string{sandboxTool, "--dev-bind", "/", "/", "--die-with-parent"}
+	for _, dir := range s.dirs() {
+		prefix = append(prefix, "--ro-bind", dir, dir)
+	}
+	prefix = append(prefix, "--bind", s.scratch, s.scratch, "--")
+	return append(prefix, argv...)
+}
+
+// dirs returns the distinct read-only directories in order.
+func (s readOnlySandbox) dirs() []string {
+	var dirs []string
+	for _, dir := range s.readOnly {
+		if dir != "" && !slices.Contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// env returns the scratch directory as TMPDIR; it must follow any other
+// TMPDIR in the environment so it wins.
+func (s readOnlySandbox) env() []string {
+	return []string{"TMPDIR=" + s.scratch}
+}
@@ -0,0 +1,28 @@
+package indexer
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestReadOnlySandboxWrap(t *testing.T) {
+	sandbox := readOnlySandbox{
+		scratch:  "/tmp/scratch",
+		readOnly: []string{"/src/api", "", "/src/api", "/tmp/wt"},
+	}
+
+	got := sandbox.wrap([]string{"codex", "exec"})
+	want := []string{
+		"bwrap", "--dev-bind", "/", "/", "--die-with-parent",
+		"--ro-bind", "/src/api", "/src/api",
+		"--ro-bind", "/tmp/wt", "/tmp/wt",
+		"--bind", "/tmp/scratch", "/tmp/scratch",
+		"--", "codex", "exec",
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	if env := sandbox.env(); !slices.Equal(env, []string{"TMPDIR=/tmp/scratch"}) {
+		t.Fatalf("expected scratch TMPDIR, got %v", env)
+	}
+}
@@ -0,0 +1,69 @@
+package indexer
+
+import (
+	"context"
+	"path"
+	"strings"
+)
+
+// manifestSchema lists the database schema sources the data model pass
+// reads. Migrations and Ent entries are directories; the rest are files.
+type manifestSchema struct {
+	// Migrations are directories of SQL migrations.
+	Migrations []string `json:"migrations,omitempty"`
+	// SQL are schema files such as schema.sql outside migration directories.
+	SQL    []string `json:"sql,omitempty"`
+	Prisma []string `json:"prisma,omitempty"`
+	// Ent are ent/schema directories.
+	Ent []string `json:"ent,omitempty"`
+	// Sqlc are sqlc configuration files, which name their schema and
+	// queries.
+	Sqlc []string `json:"sqlc,omitempty"`
+}
+
+func (ms *manifestSchema) empty() bool {
+	return len(ms.Migrations) == 0 && len(ms.SQL) == 0 && len(ms.Prisma) == 0 && len(ms.Ent) == 0 &&
+		len(ms.Sqlc) == 0
+}
+
+// isMigrationDir reports whether a directory path names a migrations
+// directory, e.g. "migrations", "db/migrate", or "sql/schema_migrations".
+func isMigrationDir(dir string) bool {
+	for part := range strings.SplitSeq(strings.ToLower(dir), "/") {
+		if part == "migrate" || strings.Contains(part, "migration") {
+			return true
+		}
+	}
+	return false
+}
+
+// detectSchema finds the repo's tracked SQL migrations and schema files,
+// Prisma schemas, Ent schemas, and sqlc configs. It returns nil when there
+// are none or git fails.
+func detectSchema(ctx context.Context, repoDir string) *manifestSchema {
+	names, err := trackedFiles(ctx, repoDir)
+	if err != nil {
+		return nil
+	}
+
+	ms := &manifestSchema{}
+	for _, name := range names {
+		dir, base, ext := path.Dir(name), path.Base(name), path.Ext(name)
+		switch {
+		case ext == ".sql" && isMigrationDir(dir):
+			ms.Migrations = appendEntry(ms.Migrations, dir)
+		case ext == ".sql" && strings.Contains(strings.ToLower(base), "schema"):
+			ms.SQL = appendEntry(ms.SQL, name)
+		case ext == ".prisma":
+			ms.Prisma = appendEntry(ms.Prisma, name)
+		case ext == ".go" && (dir == "ent/schema" || strings.HasSuffix(dir, "/ent/schema")):
+			ms.Ent = appendEntry(ms.Ent, dir)
+		case base == "sqlc.yaml" || base == "sqlc.yml" || base == "sqlc.json":
+			ms.Sqlc = appendEntry(ms.Sqlc, name)
+		}
+	}
+	if ms.empty() {
+		return nil
+	}
+	return ms
+}
@@ -0,0 +1,56 @@
+package indexer
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestDetectSchema(t *testing.T) {
+	repoDir := t.TempDir()
+	initGitRepo(t, repoDir)
+	if got := detectSchema(t.Context(), repoDir); got != nil {
+		t.Fatalf("expected no schema, got %+v", got)
+	}
+
+	for _, name := range []string{
+		"db/migrations/0001_init.up.sql",
+		"db/migrations/0001_init.down.sql",
+		"db/migrate/20240101_users.sql",
+		"db/schema.sql",
+		"db/queries/users.sql",
+		"prisma/schema.prisma",
+		"internal/ent/schema/user.go",
+		"internal/ent/client.go",
+		"sqlc.yaml",
+	} {
+		path := filepath.Join(repoDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("x\n"), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	if err := runGit(repoDir, "add", "-A"); err != nil {
+		t.Fatalf("git add: %v", err)
+	}
+
+	got := detectSchema(t.Context(), repoDir)
+	if got == nil {
+		t.Fatalf("expected a schema")
+	}
+	want := manifestSchema{
+		Migrations: []string{"db/migrate", "db/migrations"},
+		SQL:        []string{"db/schema.sql"},
+		Prisma:     []string{"prisma/schema.prisma"},
+		Ent:        []string{"internal/ent/schema"},
+		Sqlc:       []string{"sqlc.yaml"},
+	}
+	if !slices.Equal(got.Migrations, want.Migrations) || !slices.Equal(got.SQL, want.SQL) ||
+		!slices.Equal(got.Prisma, want.Prisma) || !slices.Equal(got.Ent, want.Ent) ||
+		!slices.Equal(got.Sqlc, want.Sqlc) {
+		t.Fatalf("expected %+v, got %+v", want, *got)
+	}
+}
@@ -0,0 +1,65 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// sinceDateLayout is the plain date form accepted by --since.
+const sinceDateLayout = "2006-01-02"
+
+// ParseSince parses a --since value as a date (2006-01-02, local time) or an
+// RFC 3339 timestamp.
+func ParseSince(value string) (time.Time, error) {
+	if t, err := time.ParseInLocation(sinceDateLayout, value, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid since %q (want YYYY-MM-DD or RFC 3339)", value)
+	}
+	return t, nil
+}
+
+// sinceBase resolves --since or --since-commit to the diff base for the
+// checkout at dir whose HEAD is head. An empty base with a nil skip means
+// all of the repo's history falls in the window, so it is indexed in full; a
+// non-nil skip means nothing changed in the window or the commit is unknown.
+func (ix *indexer) sinceBase(ctx context.Context, dir, head string) (string, *Skipped, error) {
+	var base, label string
+	switch {
+	case ix.opts.SinceCommit != "":
+		label = shortCommit(ix.opts.SinceCommit)
+		cmd := exec.CommandContext(ctx, "git", "-C", dir, "rev-parse", "--verify", "--quiet",
+			ix.opts.SinceCommit+"^{commit}")
+		out, err := procOutput(ctx, cmd)
+		if err != nil {
+			return "", &Skipped{
+				Reason: SkipReasonExcludedByFlag,
+				Detail: "commit " + label + " is not in this repo's history",
+			}, nil
+		}
+		base = strings.TrimSpace(string(out))
+	case !ix.opts.Since.IsZero():
+		label = ix.opts.Since.Format(time.RFC3339)
+		cmd := exec.CommandContext(ctx, "git", "-C", dir, "rev-list", "-1", "--before="+label, "HEAD")
+		out, err := procOutput(ctx, cmd)
+		if err != nil {
+			return "", nil, fmt.Errorf("git rev-list --before=%s: %w", label, err)
+		}
+		base = strings.TrimSpace(string(out))
+		if base == "" {
+			return "", nil, nil
+		}
+	default:
+		return "", nil, nil
+	}
+
+	if base == head {
+		return "", &Skipped{Reason: SkipReasonCacheHit, Detail: "no changes since " + label}, nil
+	}
+	return base, nil, nil
+}
@@ -0,0 +1,117 @@
+package indexer
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseSince(t *testing.T) {
+	tests := map[string]struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		"date": {
+			value: "2024-01-01",
+			want:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local),
+		},
+		"rfc3339": {
+			value: "2024-01-01T12:30:00Z",
+			want:  time.Date(2024, 1, 1, 12, 30, 0, 0, time.UTC),
+		},
+		"invalid": {
+			value:   "last week",
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseSince(tc.value)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error=%t, got %v", tc.wantErr, err)
+			}
+			if !got.Equal(tc.want) {
+				t.Fatalf("expected %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestSinceBase(t *testing.T) {
+	repoDir := filepath.Join(t.TempDir(), "repo")
+	t.Setenv("GIT_COMMITTER_DATE", "2020-01-01T00:00:00Z")
+	initGitRepo(t, repoDir)
+	first, err := headCommit(t.Context(), repoDir)
+	if err != nil {
+		t.Fatalf("head commit: %v", err)
+	}
+
+	t.Setenv("GIT_COMMITTER_DATE", "2024-06-01T00:00:00Z")
+	if err := os.WriteFile(filepath.Join(repoDir, "main.go"), []byte("package main\n"), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if err := runGit(repoDir, "add", "."); err != nil {
+		t.Fatalf("git add: %v", err)
+	}
+	if err := runGit(repoDir, "commit", "-m", "second"); err != nil {
+		t.Fatalf("git commit: %v", err)
+	}
+	head, err := headCommit(t.Context(), repoDir)
+	if err != nil {
+		t.Fatalf("head commit: %v", err)
+	}
+
+	tests := map[string]struct {
+		opts     Options
+		wantBase string
+		wantSkip string
+	}{
+		"since commit": {
+			opts:     Options{SinceCommit: first[:10]},
+			wantBase: first,
+		},
+		"since head commit": {
+			opts:     Options{SinceCommit: head},
+			wantSkip: SkipReasonCacheHit,
+		},
+		"since unknown commit": {
+			opts:     Options{SinceCommit: "0123456789abcdef0123456789abcdef01234567"},
+			wantSkip: SkipReasonExcludedByFlag,
+		},
+		"since date between commits": {
+			opts:     Options{Since: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)},
+			wantBase: first,
+		},
+		"since date before history": {
+			opts: Options{Since: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)},
+		},
+		"since date after head": {
+			opts:     Options{Since: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+			wantSkip: SkipReasonCacheHit,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ix := newIndexer(io.Discard, io.Discard, nil, nil, tc.opts)
+			base, skip, err := ix.sinceBase(t.Context(), repoDir, head)
+			if err != nil {
+				t.Fatalf("since base: %v", err)
+			}
+			if base != tc.wantBase {
+				t.Fatalf("expected base %q, got %q", tc.wantBase, base)
+			}
+			var reason string
+			if skip != nil {
+				reason = skip.Reason
+			}
+			if reason != tc.wantSkip {
+				t.Fatalf("expected skip %q, got %+v", tc.wantSkip, skip)
+			}
+		})
+	}
+}
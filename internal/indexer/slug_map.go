@@ -0,0 +1,220 @@
+package indexer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// slugMapEntry is the collection slug last used for a remote and the
+// checkout it was indexed from.
+type slugMapEntry struct {
+	Slug string `json:"slug"`
+	Path string `json:"path"`
+}
+
+// slugMap persists normalized remote URL -> slug so a checkout that moves
+// under the root keeps indexing into its existing collection.
+type slugMap struct {
+	data map[string]slugMapEntry
+	// recovered is the error reading the map file when its backup was used
+	// instead.
+	recovered error
+	path      string
+	mu        sync.Mutex
+	dirty     bool
+}
+
+func loadSlugMap(path string) (*slugMap, error) {
+	m := &slugMap{
+		path: path,
+		data: make(map[string]slugMapEntry),
+	}
+	if path == "" {
+		return m, nil
+	}
+
+	data, err := readSlugMapFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil || data == nil {
+		backup, backupErr := readSlugMapFile(path + backupSuffix)
+		if backupErr == nil && backup != nil {
+			if err == nil {
+				err = errors.New("slug map is empty")
+			}
+			m.data = backup
+			m.recovered = err
+			return m, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if data != nil {
+		m.data = data
+	}
+	return m, nil
+}
+
+// readSlugMapFile decodes the slug map file at path; an empty file yields
+// a nil map.
+func readSlugMapFile(path string) (map[string]slugMapEntry, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read slug map: %w", err)
+	}
+	if len(bytes) == 0 {
+		return nil, nil
+	}
+
+	var data map[string]slugMapEntry
+	if err := json.Unmarshal(bytes, &data); err != nil {
+		return nil, fmt.Errorf("decode slug map: %w", err)
+	}
+	return data, nil
+}
+
+// warnRecovered reports on w when the map was restored from its backup.
+func (m *slugMap) warnRecovered(w io.Writer) {
+	if m == nil || m.recovered == nil {
+		return
+	}
+	logf(w, "%v; restored %s from %s\n", m.recovered, m.path, m.path+backupSuffix)
+}
+
+// resolve returns the slug to use for the checkout at repoDir with the given
+// remote. A remote already mapped to repoDir keeps its recorded slug. When
+// the remote was last indexed from a different path that no longer holds a
+// git checkout, the repo is treated as moved: the old slug is returned along
+// with the old path, and the entry is repointed unless dryRun. Otherwise
+// slug is recorded and returned unchanged.
+func (m *slugMap) resolve(remote, repoDir, slug string, dryRun bool) (string, string) {
+	key := normalizeRemoteURL(remote)
+	if m == nil || key == "" {
+		return slug, ""
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.data[key]
+	switch {
+	case !ok:
+		if !dryRun {
+			m.data[key] = slugMapEntry{Slug: slug, Path: repoDir}
+			m.dirty = true
+		}
+		return slug, ""
+	case entry.Path == repoDir:
+		return entry.Slug, ""
+	case isGitCheckout(entry.Path):
+		// Another live checkout of the same remote; leave its mapping alone.
+		return slug, ""
+	default:
+		if !dryRun {
+			m.data[key] = slugMapEntry{Slug: entry.Slug, Path: repoDir}
+			m.dirty = true
+		}
+		return entry.Slug, entry.Path
+	}
+}
+
+// renameSlug points every remote mapped to oldSlug at newSlug and returns
+// how many entries changed.
+func (m *slugMap) renameSlug(oldSlug, newSlug string) int {
+	if m == nil {
+		return 0
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	changed := 0
+	for key, entry := range m.data {
+		if entry.Slug == oldSlug {
+			entry.Slug = newSlug
+			m.data[key] = entry
+			changed++
+		}
+	}
+	if changed > 0 {
+		m.dirty = true
+	}
+	return changed
+}
+
+// slugPaths returns each mapped slug with the checkout it was last indexed
+// from.
+func (m *slugMap) slugPaths() map[string]string {
+	out := make(map[string]string)
+	if m == nil {
+		return out
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, entry := range m.data {
+		out[entry.Slug] = entry.Path
+	}
+	return out
+}
+
+// removeSlug drops every remote mapped to slug and returns how many entries
+// were removed.
+func (m *slugMap) removeSlug(slug string) int {
+	if m == nil {
+		return 0
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	removed := 0
+	for key, entry := range m.data {
+		if entry.Slug == slug {
+			delete(m.data, key)
+			removed++
+		}
+	}
+	if removed > 0 {
+		m.dirty = true
+	}
+	return removed
+}
+
+func (m *slugMap) Save() error {
+	if m == nil || m.path == "" {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.dirty {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(m.data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode slug map: %w", err)
+	}
+
+	if err := rotateBackup(m.path, json.Valid); err != nil {
+		return fmt.Errorf("back up slug map: %w", err)
+	}
+	if err := writeFileSynced(m.path, data, 0o600); err != nil {
+		return fmt.Errorf("persist slug map: %w", err)
+	}
+	m.dirty = false
+	return nil
+}
+
+func isGitCheckout(path string) bool {
+	_, err := os.Stat(filepath.Join(path, ".git"))
+	return err == nil
+}
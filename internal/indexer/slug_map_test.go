@@ -0,0 +1,93 @@
+package indexer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSlugMapResolve(t *testing.T) {
+	rootDir := t.TempDir()
+	oldDir := filepath.Join(rootDir, "old-name")
+	newDir := filepath.Join(rootDir, "new-name")
+	otherDir := filepath.Join(rootDir, "other-clone")
+	initGitRepo(t, oldDir)
+	initGitRepo(t, otherDir)
+
+	const remote = "git@github.com:org/api.git"
+	path := filepath.Join(t.TempDir(), "slugs.json")
+	m, err := loadSlugMap(path)
+	if err != nil {
+		t.Fatalf("load slug map: %v", err)
+	}
+
+	if slug, movedFrom := m.resolve(remote, oldDir, "old-name", false); slug != "old-name" || movedFrom != "" {
+		t.Fatalf("expected first sighting to keep slug, got %q moved from %q", slug, movedFrom)
+	}
+
+	if slug, movedFrom := m.resolve("https://github.com/org/api", otherDir, "other-clone", false); slug != "other-clone" ||
+		movedFrom != "" {
+		t.Fatalf("expected live duplicate checkout to keep its slug, got %q moved from %q", slug, movedFrom)
+	}
+
+	if err := m.Save(); err != nil {
+		t.Fatalf("save slug map: %v", err)
+	}
+	if err := os.Rename(oldDir, newDir); err != nil {
+		t.Fatalf("move repo: %v", err)
+	}
+
+	if slug, movedFrom := m.resolve(remote, newDir, "new-name", true); slug != "old-name" || movedFrom != oldDir {
+		t.Fatalf("expected dry-run move detection, got %q moved from %q", slug, movedFrom)
+	}
+	if m.dirty {
+		t.Fatalf("expected dry run to leave the map unchanged")
+	}
+
+	if slug, movedFrom := m.resolve(remote, newDir, "new-name", false); slug != "old-name" || movedFrom != oldDir {
+		t.Fatalf("expected moved repo to reuse old slug, got %q moved from %q", slug, movedFrom)
+	}
+	if err := m.Save(); err != nil {
+		t.Fatalf("save slug map: %v", err)
+	}
+
+	reloaded, err := loadSlugMap(path)
+	if err != nil {
+		t.Fatalf("reload slug map: %v", err)
+	}
+	if slug, movedFrom := reloaded.resolve(remote, newDir, "new-name", false); slug != "old-name" || movedFrom != "" {
+		t.Fatalf("expected repointed entry to keep the old slug, got %q moved from %q", slug, movedFrom)
+	}
+}
+
+func TestSlugMapSaveRecovers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "slugs.json")
+	m, err := loadSlugMap(path)
+	if err != nil {
+		t.Fatalf("load slug map: %v", err)
+	}
+	dir := t.TempDir()
+	m.resolve("git@github.com:org/api.git", dir, "api", false)
+	if err := m.Save(); err != nil {
+		t.Fatalf("first save: %v", err)
+	}
+	m.resolve("git@github.com:org/web.git", dir, "web", false)
+	if err := m.Save(); err != nil {
+		t.Fatalf("second save: %v", err)
+	}
+
+	// A save cut short leaves the map empty; the backup holds the first save.
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatalf("truncate slug map: %v", err)
+	}
+	m, err = loadSlugMap(path)
+	if err != nil {
+		t.Fatalf("load truncated slug map: %v", err)
+	}
+	if m.recovered == nil {
+		t.Fatal("expected the slug map restored from its backup")
+	}
+	if slug, _ := m.resolve("https://github.com/org/api", dir, "other", true); slug != "api" {
+		t.Fatalf("expected the backed-up slug api, got %q", slug)
+	}
+}
@@ -0,0 +1,66 @@
+package indexer
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// launchStagger spaces Codex launches across workers at least interval
+// apart, so the first wave of a parallel run does not start every agent,
+// and hit the MCP server and API gateway, at the same instant.
+type launchStagger struct {
+	next     time.Time
+	interval time.Duration
+	mu       sync.Mutex
+}
+
+// newLaunchStagger returns nil, which never waits, when interval is not
+// positive.
+func newLaunchStagger(interval time.Duration) *launchStagger {
+	if interval <= 0 {
+		return nil
+	}
+	return &launchStagger{interval: interval}
+}
+
+// reserve hands out launch slots in call order, each interval after the
+// previous one, and returns how long the caller must wait for its slot. A
+// launch after a quiet spell longer than interval goes at once.
+func (s *launchStagger) reserve() time.Duration {
+	if s == nil {
+		return 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	at := s.next
+	if at.Before(now) {
+		at = now
+	}
+	s.next = at.Add(s.interval)
+	return at.Sub(now)
+}
+
+// staggerCodex waits for this repo's Codex launch slot under --stagger.
+// A canceled context ends the wait early.
+func (ix *indexer) staggerCodex(ctx context.Context) {
+	delay := ix.stagger.reserve()
+	if delay <= 0 {
+		return
+	}
+	ix.log(ctx).infof("staggering Codex launch by %s", delay.Round(time.Second))
+	_ = sleepCtx(ctx, delay)
+}
+
+// startupJitter sleeps a random duration below limit so parallel workers,
+// or runs started together by cron on several hosts, do not begin in
+// lockstep. A canceled context ends the wait early.
+func startupJitter(ctx context.Context, limit time.Duration) {
+	if limit <= 0 {
+		return
+	}
+	_ = sleepCtx(ctx, rand.N(limit))
+}
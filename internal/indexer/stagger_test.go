@@ -0,0 +1,45 @@
+package indexer
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLaunchStaggerReserve(t *testing.T) {
+	if d := newLaunchStagger(0).reserve(); d != 0 {
+		t.Fatalf("expected no stagger when disabled, got %s", d)
+	}
+
+	const interval = time.Hour
+	s := newLaunchStagger(interval)
+	delays := make(chan time.Duration, 4)
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Go(func() { delays <- s.reserve() })
+	}
+	wg.Wait()
+	close(delays)
+
+	// Concurrent callers get distinct slots: one now and the rest one,
+	// two, and three intervals later.
+	var slots [4]bool
+	for d := range delays {
+		slot := int((d + interval/2) / interval)
+		if slot < 0 || slot > 3 || slots[slot] {
+			t.Fatalf("expected distinct slots 0-3, got delay %s", d)
+		}
+		slots[slot] = true
+	}
+}
+
+func TestLaunchStaggerAfterQuietSpell(t *testing.T) {
+	s := newLaunchStagger(time.Minute)
+	s.next = time.Now().Add(-time.Second)
+	if d := s.reserve(); d != 0 {
+		t.Fatalf("expected a launch after a quiet spell to go at once, got %s", d)
+	}
+	if d := s.reserve(); d < 59*time.Second {
+		t.Fatalf("expected the next launch a minute later, got %s", d)
+	}
+}
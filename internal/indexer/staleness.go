@@ -0,0 +1,293 @@
+package indexer
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// StalenessOptions configures ReportStaleness.
+type StalenessOptions struct {
+	// RootDir is searched for repos like an indexing run.
+	RootDir string
+	// CachePath is the commit cache holding each repo's indexed commit.
+	CachePath string
+	// ConfigPath and SlugMapPath are the config and slug map a run uses,
+	// which pin each repo's remote and collection. Empty skips either.
+	ConfigPath  string
+	SlugMapPath string
+	// Remotes and BranchFallbacks match the run options of the same name;
+	// empty uses origin and main, master.
+	Remotes         []string
+	BranchFallbacks []string
+	// JSON writes the report as a JSON array instead of a table.
+	JSON bool
+}
+
+// RepoStaleness is how far a repo's indexed commit lags the tip of its
+// index branch, as of the repo's last fetch.
+type RepoStaleness struct {
+	Repo          string `json:"repo"`
+	Path          string `json:"path"`
+	Branch        string `json:"branch,omitempty"`
+	Tip           string `json:"tip,omitempty"`
+	Indexed       string `json:"indexed,omitempty"`
+	Error         string `json:"error,omitempty"`
+	CommitsBehind int    `json:"commits_behind"`
+	DaysBehind    int    `json:"days_behind"`
+	NeverIndexed  bool   `json:"never_indexed,omitempty"`
+}
+
+// ReportStaleness lists the repos under opts.RootDir, most stale first, by
+// how many commits and days their indexed commit in the commit cache lags
+// the index branch tip. Nothing is fetched, so the tips are as of each
+// repo's last fetch.
+func ReportStaleness(ctx context.Context, w io.Writer, opts StalenessOptions) error {
+	cache, err := loadCommitCache(opts.CachePath)
+	if err != nil {
+		return err
+	}
+	config, err := LoadConfig(opts.ConfigPath)
+	if err != nil {
+		return err
+	}
+	slugs, err := loadSlugMap(opts.SlugMapPath)
+	if err != nil {
+		return err
+	}
+	repos, err := findGitRepos(opts.RootDir)
+	if err != nil {
+		return err
+	}
+	ix := newIndexer(io.Discard, io.Discard, cache, config, Options{
+		Remotes:         opts.Remotes,
+		BranchFallbacks: opts.BranchFallbacks,
+	})
+	ix.slugs = slugs
+
+	var report []RepoStaleness
+	for _, repo := range repos {
+		if repo.worktreeOf != "" {
+			continue
+		}
+		report = append(report, ix.repoStaleness(ctx, opts.RootDir, repo.path))
+	}
+	sortByStaleness(report)
+
+	if opts.JSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return fmt.Errorf("write staleness: %w", err)
+		}
+		return nil
+	}
+	return writeStalenessTable(w, report)
+}
+
+// repoStaleness compares the repo's cached commit with its index branch
+// tip. The collection, remote, and branch are resolved as processRepo does,
+// without recording anything in the slug map. Problems are recorded in the
+// Error field.
+func (ix *indexer) repoStaleness(ctx context.Context, rootDir, repoDir string) RepoStaleness {
+	rawSlug := computeCollectionSlug(rootDir, repoDir)
+	id := newRepoIdentity(rootDir, repoDir, rawSlug)
+	slug, _, err := ix.collectionName(rawSlug)
+	if err != nil {
+		slug = rawSlug
+	}
+	remote := ix.selectRemote(ctx, id, repoDir)
+	if pinned := ix.config.repoCollection(id); pinned != "" {
+		slug = pinned
+	} else if rawURL, err := remoteURL(ctx, repoDir, remote); err == nil {
+		slug, _ = ix.slugs.resolve(stripURLCredentials(rawURL), repoDir, slug, true)
+	}
+
+	s := RepoStaleness{Repo: slug, Path: repoDir}
+	branch, tip, err := indexBranchTip(ctx, repoDir, remote, ix.opts.BranchFallbacks)
+	if err != nil {
+		s.Error = err.Error()
+		return s
+	}
+	s.Branch, s.Tip = branch, tip
+
+	cached, ok := ix.cache.LastCommit(s.Repo, branch)
+	if !ok {
+		s.NeverIndexed = true
+		return s
+	}
+	s.Indexed = cached
+	if cached == tip {
+		return s
+	}
+
+	out, err := procOutput(ctx, exec.CommandContext(ctx, "git", "-C", repoDir, "rev-list", "--count", cached+".."+tip))
+	if err != nil {
+		s.Error = fmt.Sprintf("indexed commit %s is not in the repo: %v", shortCommit(cached), err)
+		return s
+	}
+	s.CommitsBehind, _ = strconv.Atoi(strings.TrimSpace(string(out)))
+	tipTime, tipErr := commitTime(ctx, repoDir, tip)
+	cachedTime, cachedErr := commitTime(ctx, repoDir, cached)
+	if err := errors.Join(tipErr, cachedErr); err != nil {
+		s.Error = err.Error()
+		return s
+	}
+	s.DaysBehind = max(int(tipTime.Sub(cachedTime)/(24*time.Hour)), 0)
+	return s
+}
+
+// indexBranchTip resolves the branch a run would index, the remote's default
+// branch or else the checked-out one, and its tip: the remote-tracking ref
+// when there is one, otherwise the local branch.
+func indexBranchTip(ctx context.Context, repoDir, remote string, fallbacks []string) (string, string, error) {
+	branch, err := detectDefaultBranch(ctx, repoDir, remote, fallbacks)
+	if err != nil {
+		return "", "", err
+	}
+	if branch == "" {
+		if branch, err = currentBranch(ctx, repoDir); err != nil {
+			return "", "", err
+		}
+		if branch == "HEAD" {
+			return "", "", errors.New("detached HEAD without a default branch")
+		}
+	}
+	for _, ref := range []string{"refs/remotes/" + remote + "/" + branch, "refs/heads/" + branch} {
+		out, err := procOutput(ctx, exec.CommandContext(ctx, "git", "-C", repoDir, "rev-parse", "--verify", "--quiet",
+			ref+"^{commit}"))
+		if err == nil {
+			return branch, strings.TrimSpace(string(out)), nil
+		}
+	}
+	return branch, "", fmt.Errorf("branch %s has no commits", branch)
+}
+
+// sortByStaleness orders repos never indexed first, then by commits and
+// days behind, with repos whose staleness is unknown last.
+func sortByStaleness(report []RepoStaleness) {
+	rank := func(s RepoStaleness) int {
+		switch {
+		case s.Error != "":
+			return 2
+		case s.NeverIndexed:
+			return 0
+		}
+		return 1
+	}
+	slices.SortStableFunc(report, func(a, b RepoStaleness) int {
+		return cmp.Or(
+			cmp.Compare(rank(a), rank(b)),
+			cmp.Compare(b.CommitsBehind, a.CommitsBehind),
+			cmp.Compare(b.DaysBehind, a.DaysBehind),
+			cmp.Compare(a.Repo, b.Repo),
+		)
+	})
+}
+
+// stale reports whether the repo needs indexing: it was never indexed,
+// lags its tip, or its staleness is unknown.
+func (s RepoStaleness) stale() bool {
+	return s.Error != "" || s.NeverIndexed || s.CommitsBehind > 0
+}
+
+// describe summarizes how stale the repo is, for skip details.
+func (s RepoStaleness) describe() string {
+	switch {
+	case s.Error != "":
+		return "staleness unknown"
+	case s.NeverIndexed:
+		return "never indexed"
+	}
+	return fmt.Sprintf("%d commits and %d days behind", s.CommitsBehind, s.DaysBehind)
+}
+
+// limitRepos implements Options.MaxRepos. It ranks the stale repos that
+// would be indexed with sortByStaleness, keeps the first MaxRepos, and
+// marks the rest deferred. The kept repos move to the front, most stale
+// first, so they start before the others.
+func (ix *indexer) limitRepos(ctx context.Context, rootDir string, repos []discoveredRepo) []discoveredRepo {
+	if ix.opts.MaxRepos <= 0 {
+		return repos
+	}
+	var ranked []RepoStaleness
+	byPath := make(map[string]int, len(repos))
+	for i, repo := range repos {
+		byPath[repo.path] = i
+		rawSlug := computeCollectionSlug(rootDir, repo.path)
+		if (repo.worktreeOf != "" && !ix.opts.IndexLinkedWorktrees) || repo.duplicateOf != "" ||
+			optOutMarker(repo.path) != "" {
+			continue
+		}
+		if skip, _ := ix.shouldSkipRepo(rootDir, repo.path, rawSlug); skip {
+			continue
+		}
+		id := newRepoIdentity(rootDir, repo.path, rawSlug)
+		if !ix.taggedForRun(ix.config.repoTags(id)) {
+			continue
+		}
+		if s := ix.repoStaleness(ctx, rootDir, repo.path); s.stale() {
+			ranked = append(ranked, s)
+		}
+	}
+	sortByStaleness(ranked)
+
+	limited := make([]discoveredRepo, 0, len(repos))
+	kept := make(map[string]bool)
+	for i, s := range ranked {
+		repo := &repos[byPath[s.Path]]
+		if i >= ix.opts.MaxRepos {
+			repo.deferred = fmt.Sprintf("deferred by --max-repos %d (%s)", ix.opts.MaxRepos, s.describe())
+			continue
+		}
+		limited = append(limited, *repo)
+		kept[repo.path] = true
+	}
+	for _, repo := range repos {
+		if !kept[repo.path] {
+			limited = append(limited, repo)
+		}
+	}
+	ix.outln(colorize(colorMuted, "Max Repos: %d of %d stale repos", min(ix.opts.MaxRepos, len(ranked)), len(ranked)))
+	return limited
+}
+
+func writeStalenessTable(w io.Writer, report []RepoStaleness) error {
+	if len(report) == 0 {
+		if _, err := fmt.Fprintln(w, "No repositories found."); err != nil {
+			return fmt.Errorf("write staleness: %w", err)
+		}
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, summaryTabPadding, ' ', 0)
+	if _, err := fmt.Fprintln(tw, "Repo\tBranch\tIndexed\tTip\tCommits Behind\tDays Behind"); err != nil {
+		return fmt.Errorf("write staleness: %w", err)
+	}
+	for _, s := range report {
+		behind, days := strconv.Itoa(s.CommitsBehind), strconv.Itoa(s.DaysBehind)
+		indexed := orDash(shortCommit(s.Indexed))
+		switch {
+		case s.Error != "":
+			behind, days = "-", s.Error
+		case s.NeverIndexed:
+			indexed, behind, days = "never", "-", "-"
+		}
+		if _, err := fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			s.Repo, orDash(s.Branch), indexed, orDash(shortCommit(s.Tip)), behind, days); err != nil {
+			return fmt.Errorf("write staleness: %w", err)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("flush staleness: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+package indexer
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReportStaleness(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"api", "web", "docs"} {
+		initGitRepo(t, filepath.Join(root, name))
+	}
+	indexedAt := func(name string) string {
+		t.Helper()
+		commit, err := headCommit(t.Context(), filepath.Join(root, name))
+		if err != nil {
+			t.Fatalf("head commit: %v", err)
+		}
+		return commit
+	}
+
+	cachePath := filepath.Join(t.TempDir(), "cache.json")
+	cache, err := loadCommitCache(cachePath)
+	if err != nil {
+		t.Fatalf("load cache: %v", err)
+	}
+	cache.Update("api", "trunk", indexedAt("api"))
+	cache.Update("docs", "trunk", indexedAt("docs"))
+	if err := cache.Save(); err != nil {
+		t.Fatalf("save cache: %v", err)
+	}
+
+	// api moves two commits, the last five days after it was indexed.
+	for i, days := range []int{1, 5} {
+		t.Setenv("GIT_COMMITTER_DATE", time.Now().AddDate(0, 0, days).Format(time.RFC3339))
+		if err := runGit(filepath.Join(root, "api"), "commit", "--allow-empty", "-m", "change "+string(rune('a'+i))); err != nil {
+			t.Fatalf("commit: %v", err)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := ReportStaleness(t.Context(), &out, StalenessOptions{RootDir: root, CachePath: cachePath, JSON: true}); err != nil {
+		t.Fatalf("report: %v", err)
+	}
+	var report []RepoStaleness
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("decode report: %v\n%s", err, out.String())
+	}
+
+	type row struct {
+		repo          string
+		commits, days int
+		never         bool
+	}
+	var got []row
+	for _, s := range report {
+		if s.Error != "" {
+			t.Fatalf("%s: unexpected error %s", s.Repo, s.Error)
+		}
+		got = append(got, row{s.Repo, s.CommitsBehind, s.DaysBehind, s.NeverIndexed})
+	}
+	want := []row{{"web", 0, 0, true}, {"api", 2, 5, false}, {"docs", 0, 0, false}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+
+	out.Reset()
+	if err := ReportStaleness(t.Context(), &out, StalenessOptions{RootDir: root, CachePath: cachePath}); err != nil {
+		t.Fatalf("report table: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 || !strings.Contains(lines[1], "never") {
+		t.Fatalf("unexpected table:\n%s", out.String())
+	}
+}
+
+func TestReportStalenessResolution(t *testing.T) {
+	const remote = "https://example.com/acme/api.git"
+	type entry struct{ slug, branch string }
+	tests := map[string]struct {
+		opts   StalenessOptions
+		config *Config
+		// mapped is recorded in the slug map for the upstream remote.
+		mapped string
+		cached entry
+		want   RepoStaleness
+	}{
+		"defaults": {
+			cached: entry{"api", "trunk"},
+			want:   RepoStaleness{Repo: "api", Branch: "trunk", CommitsBehind: 1},
+		},
+		"remote": {
+			opts:   StalenessOptions{Remotes: []string{"upstream"}},
+			cached: entry{"api", "release"},
+			want:   RepoStaleness{Repo: "api", Branch: "release", CommitsBehind: 1},
+		},
+		"config remotes": {
+			config: &Config{Repos: map[string]RepoConfig{"api": {Remotes: []string{"upstream"}}}},
+			cached: entry{"api", "release"},
+			want:   RepoStaleness{Repo: "api", Branch: "release", CommitsBehind: 1},
+		},
+		"branch fallbacks": {
+			opts:   StalenessOptions{BranchFallbacks: []string{"stable"}},
+			cached: entry{"api", "stable"},
+			want:   RepoStaleness{Repo: "api", Branch: "stable"},
+		},
+		"pinned collection": {
+			config: &Config{Repos: map[string]RepoConfig{"api": {Collection: "team_api"}}},
+			cached: entry{"team_api", "trunk"},
+			want:   RepoStaleness{Repo: "team_api", Branch: "trunk", CommitsBehind: 1},
+		},
+		"slug map": {
+			opts:   StalenessOptions{Remotes: []string{"upstream"}},
+			mapped: "legacy_api",
+			cached: entry{"legacy_api", "release"},
+			want:   RepoStaleness{Repo: "legacy_api", Branch: "release", CommitsBehind: 1},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			root := t.TempDir()
+			repoDir := filepath.Join(root, "api")
+			initGitRepo(t, repoDir)
+			indexed, err := headCommit(t.Context(), repoDir)
+			if err != nil {
+				t.Fatalf("head commit: %v", err)
+			}
+			// stable stays at the indexed commit; trunk and upstream/release
+			// move one commit past it.
+			for _, args := range [][]string{
+				{"branch", "stable"},
+				{"commit", "--allow-empty", "-m", "change"},
+				{"remote", "add", "upstream", remote},
+				{"update-ref", "refs/remotes/upstream/release", "HEAD"},
+				{"symbolic-ref", "refs/remotes/upstream/HEAD", "refs/remotes/upstream/release"},
+			} {
+				if err := runGit(repoDir, args...); err != nil {
+					t.Fatalf("git %v: %v", args, err)
+				}
+			}
+
+			opts := tc.opts
+			opts.RootDir = root
+			opts.CachePath = filepath.Join(t.TempDir(), "cache.json")
+			cache, err := loadCommitCache(opts.CachePath)
+			if err != nil {
+				t.Fatalf("load cache: %v", err)
+			}
+			cache.Update(tc.cached.slug, tc.cached.branch, indexed)
+			if err := cache.Save(); err != nil {
+				t.Fatalf("save cache: %v", err)
+			}
+			if tc.config != nil {
+				data, err := json.Marshal(tc.config)
+				if err != nil {
+					t.Fatalf("encode config: %v", err)
+				}
+				opts.ConfigPath = filepath.Join(t.TempDir(), "config.json")
+				if err := os.WriteFile(opts.ConfigPath, data, 0o644); err != nil {
+					t.Fatalf("write config: %v", err)
+				}
+			}
+			if tc.mapped != "" {
+				opts.SlugMapPath = filepath.Join(t.TempDir(), "slugs.json")
+				slugs, err := loadSlugMap(opts.SlugMapPath)
+				if err != nil {
+					t.Fatalf("load slug map: %v", err)
+				}
+				slugs.resolve(remote, repoDir, tc.mapped, false)
+				if err := slugs.Save(); err != nil {
+					t.Fatalf("save slug map: %v", err)
+				}
+			}
+
+			var out bytes.Buffer
+			opts.JSON = true
+			if err := ReportStaleness(t.Context(), &out, opts); err != nil {
+				t.Fatalf("report: %v", err)
+			}
+			var report []RepoStaleness
+			if err := json.Unmarshal(out.Bytes(), &report); err != nil || len(report) != 1 {
+				t.Fatalf("decode report: %v\n%s", err, out.String())
+			}
+			got := report[0]
+			got.Path, got.Tip, got.Indexed, got.DaysBehind = "", "", "", 0
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("expected %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRunResultsMaxRepos(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"api", "docs", "web", "www"} {
+		initGitRepo(t, filepath.Join(root, name))
+	}
+	cachePath := filepath.Join(t.TempDir(), "cache.json")
+	cache, err := loadCommitCache(cachePath)
+	if err != nil {
+		t.Fatalf("load cache: %v", err)
+	}
+	for _, name := range []string{"api", "docs"} {
+		commit, err := headCommit(t.Context(), filepath.Join(root, name))
+		if err != nil {
+			t.Fatalf("head commit: %v", err)
+		}
+		cache.Update(name, "trunk", commit)
+	}
+	if err := cache.Save(); err != nil {
+		t.Fatalf("save cache: %v", err)
+	}
+	if err := runGit(filepath.Join(root, "api"), "commit", "--allow-empty", "-m", "change"); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	codexPath := filepath.Join(t.TempDir(), "codex")
+	if err := os.WriteFile(codexPath, []byte("#!/bin/sh\nexit 0\n"), 0o755); err != nil {
+		t.Fatalf("write codex stub: %v", err)
+	}
+
+	// web and www were never indexed, so they outrank api; docs is current.
+	results, err := RunResults(Options{
+		RootDir:     root,
+		CachePath:   cachePath,
+		SummaryJSON: filepath.Join(t.TempDir(), "summary.json"),
+		CodexPath:   codexPath,
+		CodexStdin:  StdinClosed,
+		MaxRepos:    2,
+	})
+	if err != nil {
+		t.Fatalf("run indexer: %v", err)
+	}
+	got := make(map[string]string)
+	for _, r := range results {
+		got[r.CollectionSlug] = r.SkipReason
+		if r.CodexRan {
+			got[r.CollectionSlug] = "indexed"
+		}
+	}
+	want := map[string]string{"web": "indexed", "www": "indexed", "api": SkipReasonDeferred, "docs": SkipReasonCacheHit}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	if _, err := RunResults(Options{RootDir: root, MaxRepos: -1, DryRun: true}); err == nil {
+		t.Fatal("expected a negative max repos to be rejected")
+	}
+}
@@ -0,0 +1,255 @@
+package indexer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Per-repo states shown in the live status file.
+const (
+	repoStateQueued   = "queued"
+	repoStatePrep     = "preparing"
+	repoStateFetched  = "fetched"
+	repoStateIndexing = "indexing"
+	repoStateDone     = "done"
+)
+
+// statusFile is the JSON document written to --status-file.
+type statusFile struct {
+	StartedAt  time.Time       `json:"started_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+	ETA        *time.Time      `json:"eta,omitempty"`
+	RootDir    string          `json:"root_dir"`
+	Repos      []*repoProgress `json:"repos"`
+	Total      int             `json:"total"`
+	Queued     int             `json:"queued"`
+	Running    int             `json:"running"`
+	Completed  int             `json:"completed"`
+	ETASeconds int64           `json:"eta_seconds,omitempty"`
+	Finished   bool            `json:"finished"`
+	// Paused is set while new repos are held back by SIGUSR1.
+	Paused bool `json:"paused"`
+}
+
+// repoProgress is one repo's entry in the live status file.
+type repoProgress struct {
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	// ETA is when a running repo is expected to finish, from ExpectedMS.
+	ETA   *time.Time `json:"eta,omitempty"`
+	Repo  string     `json:"repo"`
+	Path  string     `json:"path"`
+	State string     `json:"state"`
+	// Status is the repo's outcome once it is done.
+	Status     string `json:"status,omitempty"`
+	DurationMS int64  `json:"duration_ms,omitempty"`
+	// ExpectedMS is the repo's average duration in recent runs recorded in
+	// the history database.
+	ExpectedMS int64 `json:"expected_ms,omitempty"`
+}
+
+// statusTracker folds events into a status document and, when path is set,
+// atomically rewrites it on every transition. It also backs the console
+// progress lines. A nil tracker ignores events.
+type statusTracker struct {
+	byPath map[string]*repoProgress
+	// expected holds each slug's average duration from the run history.
+	expected map[string]time.Duration
+	path     string
+	doc      statusFile
+	workers  int
+	mu       sync.Mutex
+}
+
+func newStatusTracker(
+	path, rootDir string,
+	repos []discoveredRepo,
+	workers int,
+	expected map[string]time.Duration,
+) *statusTracker {
+	st := &statusTracker{
+		byPath:   make(map[string]*repoProgress, len(repos)),
+		expected: expected,
+		path:     path,
+		workers:  max(workers, 1),
+		doc: statusFile{
+			StartedAt: time.Now().UTC(),
+			RootDir:   rootDir,
+			Repos:     make([]*repoProgress, 0, len(repos)),
+			Total:     len(repos),
+			Queued:    len(repos),
+		},
+	}
+	for _, repo := range repos {
+		rs := &repoProgress{
+			Repo:  computeCollectionSlug(rootDir, repo.path),
+			Path:  repo.path,
+			State: repoStateQueued,
+		}
+		st.byPath[repo.path] = rs
+		st.doc.Repos = append(st.doc.Repos, rs)
+	}
+	return st
+}
+
+// observe applies ev and rewrites the status file.
+func (st *statusTracker) observe(ev Event) error {
+	if st == nil {
+		return nil
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	rs := st.byPath[ev.Path]
+	switch {
+	case ev.Type == EventRunFinished:
+		st.doc.Finished = true
+	case ev.Type == EventRunPaused:
+		st.doc.Paused = true
+	case ev.Type == EventRunResumed:
+		st.doc.Paused = false
+	case rs == nil:
+	case ev.Type == EventRepoStarted:
+		started := ev.Time
+		rs.StartedAt = &started
+		if ev.Repo != "" {
+			rs.Repo = ev.Repo
+		}
+		if expected := st.expected[rs.Repo]; expected > 0 {
+			rs.ExpectedMS = expected.Milliseconds()
+			eta := started.Add(expected)
+			rs.ETA = &eta
+		}
+		rs.State = repoStatePrep
+		st.doc.Queued--
+		st.doc.Running++
+	case ev.Type == EventFetchDone:
+		rs.State = repoStateFetched
+	case ev.Type == EventCodexStarted:
+		rs.State = repoStateIndexing
+	case ev.Type == EventRepoFinished:
+		rs.State = repoStateDone
+		rs.ETA = nil
+		rs.Status = ev.Status
+		rs.DurationMS = ev.DurationMS
+		st.doc.Running--
+		st.doc.Completed++
+	}
+	st.doc.UpdatedAt = ev.Time
+	st.updateETA()
+	return st.write()
+}
+
+// updateETA projects the remaining time spread across the worker pool. Each
+// unfinished repo is expected to take its average from the run history or,
+// without history, the average of repos finished so far in this run; time
+// a running repo has already spent counts against its expectation.
+func (st *statusTracker) updateETA() {
+	st.doc.ETA = nil
+	st.doc.ETASeconds = 0
+	if st.doc.Finished {
+		return
+	}
+
+	fallback := st.fallbackDuration()
+	var remaining time.Duration
+	for _, rs := range st.doc.Repos {
+		if rs.State == repoStateDone {
+			continue
+		}
+		expected := st.expected[rs.Repo]
+		if expected <= 0 {
+			expected = fallback
+		}
+		if expected <= 0 {
+			return
+		}
+		if rs.StartedAt != nil {
+			expected = max(expected-st.doc.UpdatedAt.Sub(*rs.StartedAt), 0)
+		}
+		remaining += expected
+	}
+	remaining /= time.Duration(st.workers)
+	eta := st.doc.UpdatedAt.Add(remaining)
+	st.doc.ETA = &eta
+	st.doc.ETASeconds = int64(remaining.Seconds())
+}
+
+// fallbackDuration is the expectation for repos without history: the
+// average of repos finished in this run, else of the history averages.
+func (st *statusTracker) fallbackDuration() time.Duration {
+	var total time.Duration
+	if st.doc.Completed > 0 {
+		for _, rs := range st.doc.Repos {
+			if rs.State == repoStateDone {
+				total += time.Duration(rs.DurationMS) * time.Millisecond
+			}
+		}
+		return total / time.Duration(st.doc.Completed)
+	}
+	if len(st.expected) == 0 {
+		return 0
+	}
+	for _, d := range st.expected {
+		total += d
+	}
+	return total / time.Duration(len(st.expected))
+}
+
+// expectedDuration returns slug's average duration from the run history,
+// or 0 when it has none.
+func (st *statusTracker) expectedDuration(slug string) time.Duration {
+	if st == nil {
+		return 0
+	}
+	return st.expected[slug]
+}
+
+// progress returns how many repos are done, the total, and the projected
+// completion time; eta is nil when no estimate is available yet.
+func (st *statusTracker) progress() (done, total int, eta *time.Time) {
+	if st == nil {
+		return 0, 0, nil
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.doc.Completed, st.doc.Total, st.doc.ETA
+}
+
+// reportProgress prints how many repos are done and, once it can be
+// estimated, when the run should finish.
+func (ix *indexer) reportProgress() {
+	done, total, eta := ix.status.progress()
+	if total == 0 {
+		return
+	}
+	line := fmt.Sprintf("Progress: %d/%d repos", done, total)
+	if eta != nil && done < total {
+		left := time.Until(*eta).Round(time.Second)
+		line += fmt.Sprintf(", estimated completion %s (%s left)", eta.Local().Format(time.TimeOnly), max(left, 0))
+	}
+	ix.outln(colorize(colorMuted, "%s", line))
+}
+
+// write replaces the status file through a temporary file. It is rewritten
+// on every transition, so it is not synced to disk.
+func (st *statusTracker) write() error {
+	if st.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(st.doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode status file: %w", err)
+	}
+
+	tmpPath := st.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o600); err != nil {
+		return fmt.Errorf("write status file: %w", err)
+	}
+	if err := os.Rename(tmpPath, st.path); err != nil {
+		return fmt.Errorf("persist status file: %w", err)
+	}
+	return nil
+}
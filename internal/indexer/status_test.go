@@ -0,0 +1,117 @@
+package indexer
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStatusTracker(t *testing.T) {
+	rootDir := "/src"
+	path := filepath.Join(t.TempDir(), "status.json")
+	repos := []discoveredRepo{
+		{path: "/src/api"},
+		{path: "/src/web"},
+		{path: "/src/cli"},
+	}
+	st := newStatusTracker(path, rootDir, repos, 1, nil)
+
+	now := time.Now().UTC()
+	steps := []Event{
+		{Type: EventRunStarted, Path: rootDir, RepoCount: 3},
+		{Type: EventRepoStarted, Path: "/src/api"},
+		{Type: EventFetchDone, Path: "/src/api"},
+		{Type: EventCodexStarted, Path: "/src/api"},
+		{Type: EventRepoFinished, Path: "/src/api", Status: statusOK, DurationMS: 60_000},
+		{Type: EventRepoStarted, Path: "/src/web"},
+	}
+	for _, ev := range steps {
+		ev.Time = now
+		if err := st.observe(ev); err != nil {
+			t.Fatalf("observe %s: %v", ev.Type, err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read status file: %v", err)
+	}
+	var doc statusFile
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("decode status file: %v", err)
+	}
+
+	if doc.Total != 3 || doc.Queued != 1 || doc.Running != 1 || doc.Completed != 1 {
+		t.Fatalf("unexpected counts: total=%d queued=%d running=%d completed=%d",
+			doc.Total, doc.Queued, doc.Running, doc.Completed)
+	}
+	if doc.ETASeconds != 120 {
+		t.Fatalf("expected 120s ETA for two remaining 1m repos, got %d", doc.ETASeconds)
+	}
+
+	states := make(map[string]string, len(doc.Repos))
+	for _, rs := range doc.Repos {
+		states[rs.Repo] = rs.State
+	}
+	want := map[string]string{
+		"api": repoStateDone,
+		"web": repoStatePrep,
+		"cli": repoStateQueued,
+	}
+	for repo, state := range want {
+		if states[repo] != state {
+			t.Fatalf("expected %s to be %q, got %q", repo, state, states[repo])
+		}
+	}
+
+	if err := st.observe(Event{Type: EventRunFinished, Path: rootDir, Time: now}); err != nil {
+		t.Fatalf("observe run_finished: %v", err)
+	}
+	if !st.doc.Finished || st.doc.ETA != nil {
+		t.Fatalf("expected finished status without ETA, got %+v", st.doc)
+	}
+}
+
+func TestStatusTrackerHistoryETA(t *testing.T) {
+	rootDir := "/src"
+	repos := []discoveredRepo{
+		{path: "/src/api"},
+		{path: "/src/web"},
+		{path: "/src/cli"},
+	}
+	expected := map[string]time.Duration{
+		"api": 10 * time.Minute,
+		"web": 2 * time.Minute,
+	}
+	st := newStatusTracker("", rootDir, repos, 2, expected)
+
+	now := time.Now().UTC()
+	steps := []Event{
+		{Type: EventRunStarted, Path: rootDir, RepoCount: 3, Time: now},
+		{Type: EventRepoStarted, Path: "/src/api", Repo: "api", Time: now},
+		{Type: EventRepoStarted, Path: "/src/web", Repo: "web", Time: now.Add(4 * time.Minute)},
+	}
+	for _, ev := range steps {
+		if err := st.observe(ev); err != nil {
+			t.Fatalf("observe %s: %v", ev.Type, err)
+		}
+	}
+
+	// api has 6m left, web 2m, and cli (no history) the 6m history average,
+	// spread over two workers.
+	if st.doc.ETASeconds != 7*60 {
+		t.Fatalf("expected a 7m ETA before any repo finished, got %ds", st.doc.ETASeconds)
+	}
+	api := st.byPath["/src/api"]
+	if api.ExpectedMS != (10*time.Minute).Milliseconds() || api.ETA == nil || !api.ETA.Equal(now.Add(10*time.Minute)) {
+		t.Fatalf("expected api's ETA from its history, got %+v", api)
+	}
+	if cli := st.byPath["/src/cli"]; cli.ETA != nil || cli.ExpectedMS != 0 {
+		t.Fatalf("expected no per-repo ETA for a queued repo without history, got %+v", cli)
+	}
+	if done, total, eta := st.progress(); done != 0 || total != 3 || eta == nil {
+		t.Fatalf("expected progress 0/3 with an ETA, got %d/%d %v", done, total, eta)
+	}
+}
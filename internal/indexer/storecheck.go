@@ -0,0 +1,113 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+)
+
+// storeHealth is what the store check learned about the server.
+type storeHealth struct {
+	// Version is the server version, empty when the server does not say.
+	Version string
+	// Collections is the number of collections in the database.
+	Collections int
+	// MaxBatchSize is the most records one add accepts, or 0 when the
+	// server does not say.
+	MaxBatchSize int
+}
+
+// checkStore probes the store the way a run will use it: the server must
+// answer its heartbeat, accept the token, serve the tenant and database,
+// and count their collections. Each failure names its likely cause.
+// Chroma does not report disk usage, so free space is not checked.
+func checkStore(ctx context.Context, client *chromaClient) (storeHealth, error) {
+	var health storeHealth
+	opts := client.opts
+	if err := client.heartbeat(ctx); err != nil {
+		return health, fmt.Errorf("store check: chroma at %s is down or unreachable: %w", opts.URL, err)
+	}
+
+	var identity struct {
+		Tenant    string   `json:"tenant"`
+		Databases []string `json:"databases"`
+	}
+	err := client.do(ctx, http.MethodGet, "/api/v2/auth/identity", nil, &identity)
+	switch {
+	case rejected(err):
+		return health, fmt.Errorf("store check: chroma at %s rejected the token (see --chroma-token-env): %w",
+			opts.URL, err)
+	case notFound(err):
+		// Servers before the identity endpoint: the count below still
+		// checks the token and the database.
+	case err != nil:
+		return health, fmt.Errorf("store check: identity: %w", err)
+	case identity.Tenant != "" && identity.Tenant != opts.Tenant:
+		return health, fmt.Errorf("store check: the token belongs to tenant %q, not %q (see --chroma-tenant)",
+			identity.Tenant, opts.Tenant)
+	case len(identity.Databases) > 0 && !slices.Contains(identity.Databases, "*") &&
+		!slices.Contains(identity.Databases, opts.Database):
+		return health, fmt.Errorf("store check: the token cannot access database %q (it can access %v)",
+			opts.Database, identity.Databases)
+	}
+
+	countPath := "/api/v2/tenants/" + url.PathEscape(opts.Tenant) + "/databases/" +
+		url.PathEscape(opts.Database) + "/collections_count"
+	err = client.do(ctx, http.MethodGet, countPath, nil, &health.Collections)
+	switch {
+	case rejected(err):
+		return health, fmt.Errorf("store check: chroma at %s rejected the token (see --chroma-token-env): %w",
+			opts.URL, err)
+	case notFound(err):
+		return health, fmt.Errorf("store check: tenant %q or database %q does not exist on %s: %w",
+			opts.Tenant, opts.Database, opts.URL, err)
+	case err != nil:
+		return health, fmt.Errorf("store check: count collections: %w", err)
+	}
+
+	// Version and batch limits are informational; older servers lack the
+	// pre-flight endpoint.
+	_ = client.do(ctx, http.MethodGet, "/api/v2/version", nil, &health.Version)
+	var preflight struct {
+		MaxBatchSize int `json:"max_batch_size"`
+	}
+	if client.do(ctx, http.MethodGet, "/api/v2/pre-flight-checks", nil, &preflight) == nil {
+		health.MaxBatchSize = preflight.MaxBatchSize
+	}
+	return health, nil
+}
+
+// heartbeat checks that the server is up.
+func (c *chromaClient) heartbeat(ctx context.Context) error {
+	return c.do(ctx, http.MethodGet, "/api/v2/heartbeat", nil, nil)
+}
+
+// rejected reports whether err is an authentication or authorization
+// failure.
+func rejected(err error) bool {
+	var apiErr *chromaError
+	return errors.As(err, &apiErr) &&
+		(apiErr.Status == http.StatusUnauthorized || apiErr.Status == http.StatusForbidden)
+}
+
+// notFound reports whether err is a 404 from the server.
+func notFound(err error) bool {
+	var apiErr *chromaError
+	return errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound
+}
+
+// storeSummary describes a healthy store in one line.
+func (h storeHealth) storeSummary(baseURL string) string {
+	s := "Store: chroma"
+	if h.Version != "" {
+		s += " " + h.Version
+	}
+	s += fmt.Sprintf(" at %s, %d collections", baseURL, h.Collections)
+	if h.MaxBatchSize > 0 {
+		s += fmt.Sprintf(", max batch %d records", h.MaxBatchSize)
+	}
+	return s
+}
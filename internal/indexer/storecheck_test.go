@@ -0,0 +1,113 @@
+package indexer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// stubResponse is a canned server reply.
+type stubResponse struct {
+	body   string
+	status int
+}
+
+func TestCheckStore(t *testing.T) {
+	const countPath = "/api/v2/tenants/default_tenant/databases/default_database/collections_count"
+	tests := map[string]struct {
+		// responses maps a path to its status and body; other paths 404.
+		responses map[string]stubResponse
+		down      bool
+		want      string
+		wantErr   string
+	}{
+		"healthy": {
+			responses: map[string]stubResponse{
+				"/api/v2/heartbeat":         {`{"nanosecond heartbeat": 1}`, 200},
+				"/api/v2/auth/identity":     {`{"tenant": "default_tenant", "databases": ["*"]}`, 200},
+				countPath:                   {`12`, 200},
+				"/api/v2/version":           {`"1.0.8"`, 200},
+				"/api/v2/pre-flight-checks": {`{"max_batch_size": 5461}`, 200},
+			},
+			want: "Store: chroma 1.0.8 at URL, 12 collections, max batch 5461 records",
+		},
+		"older server": {
+			responses: map[string]stubResponse{
+				"/api/v2/heartbeat": {`{}`, 200},
+				countPath:           {`3`, 200},
+			},
+			want: "Store: chroma at URL, 3 collections",
+		},
+		"down": {
+			down:    true,
+			wantErr: "down or unreachable",
+		},
+		"server error": {
+			responses: map[string]stubResponse{"/api/v2/heartbeat": {"overloaded", 503}},
+			wantErr:   "down or unreachable",
+		},
+		"bad token": {
+			responses: map[string]stubResponse{
+				"/api/v2/heartbeat":     {`{}`, 200},
+				"/api/v2/auth/identity": {"unauthorized", 401},
+			},
+			wantErr: "rejected the token",
+		},
+		"other tenant": {
+			responses: map[string]stubResponse{
+				"/api/v2/heartbeat":     {`{}`, 200},
+				"/api/v2/auth/identity": {`{"tenant": "team_b", "databases": ["*"]}`, 200},
+			},
+			wantErr: `belongs to tenant "team_b"`,
+		},
+		"other database": {
+			responses: map[string]stubResponse{
+				"/api/v2/heartbeat":     {`{}`, 200},
+				"/api/v2/auth/identity": {`{"tenant": "default_tenant", "databases": ["prod"]}`, 200},
+			},
+			wantErr: `cannot access database "default_database"`,
+		},
+		"missing database": {
+			responses: map[string]stubResponse{
+				"/api/v2/heartbeat":     {`{}`, 200},
+				"/api/v2/auth/identity": {`{"tenant": "default_tenant", "databases": ["*"]}`, 200},
+			},
+			wantErr: `database "default_database" does not exist`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				resp, ok := tc.responses[r.URL.Path]
+				if !ok {
+					http.Error(w, `{"error":"NotFound"}`, http.StatusNotFound)
+					return
+				}
+				w.WriteHeader(resp.status)
+				_, _ = w.Write([]byte(resp.body))
+			}))
+			if tc.down {
+				srv.Close()
+			} else {
+				t.Cleanup(srv.Close)
+			}
+
+			client := newChromaClient(ChromaOptions{URL: srv.URL})
+			health, err := checkStore(t.Context(), client)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected error %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("check: %v", err)
+			}
+			if got := strings.ReplaceAll(health.storeSummary(srv.URL), srv.URL, "URL"); got != tc.want {
+				t.Fatalf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
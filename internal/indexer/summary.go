@@ -1,32 +1,52 @@
 package indexer
 
 import (
+	"cmp"
 	"fmt"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"text/tabwriter"
+	"time"
 )
 
 const summaryTabPadding = 2
 
 func (ix *indexer) printSummaryTable(results []RepoResult) {
+	names := ix.opts.SummaryColumns
+	if len(names) == 0 && ix.opts.DocumentChanges {
+		names = append(slices.Clone(defaultSummaryColumns), "documents")
+	}
+	columns, err := resolveSummaryColumns(names)
+	if err != nil {
+		ix.errln("summary columns:", err)
+		return
+	}
+
+	headers := make([]string, len(columns))
+	for i, col := range columns {
+		headers[i] = col.header
+	}
+
 	counts := summaryCounts{}
+	statuses := make(map[*RepoResult]string, len(results))
+	for i := range results {
+		statuses[&results[i]] = ix.renderStatus(&results[i], &counts)
+	}
+	rows := selectSummaryRows(results, statuses, ix.opts.SummaryOnly, ix.opts.SummarySort)
+
 	tw := tabwriter.NewWriter(ix.stdout, 0, 0, summaryTabPadding, ' ', 0)
-	if _, err := fmt.Fprintln(tw, colorize(colorMuted, "Repo\tCollection\tBranch\tGit\tCodex\tStatus")); err != nil {
+	if _, err := fmt.Fprintln(tw, colorize(colorMuted, "%s", strings.Join(headers, "\t"))); err != nil {
 		ix.errln("summary header write failed:", err)
 		return
 	}
-	for i := range results {
-		r := &results[i]
-		status := ix.renderStatus(r, &counts)
-		if _, err := fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
-			filepath.Base(r.Path),
-			r.CollectionSlug,
-			orDash(r.DefaultBranch),
-			formatGitStatus(r),
-			formatCodexStatus(r),
-			colorStatus(status),
-		); err != nil {
+	cells := make([]string, len(columns))
+	for _, r := range rows {
+		for j, col := range columns {
+			cells[j] = col.value(r, statuses[r])
+		}
+		if _, err := fmt.Fprintln(tw, strings.Join(cells, "\t")); err != nil {
 			ix.errln("summary row write failed:", err)
 			return
 		}
@@ -37,32 +57,237 @@ func (ix *indexer) printSummaryTable(results []RepoResult) {
 	}
 
 	ix.outln("")
+	if len(rows) < len(results) {
+		ix.outln(fmt.Sprintf("Showing %d of %d repos (--summary-only %s)", len(rows), len(results), ix.opts.SummaryOnly))
+	}
 	ix.outln(fmt.Sprintf("OK: %d    Warn: %d    Error: %d", counts.ok, counts.warn, counts.err))
 }
 
+// Row filters for --summary-only.
+const (
+	SummaryOnlyErrors   = "errors"
+	SummaryOnlyWarnings = "warnings"
+)
+
+// Row orders for --summary-sort. The default keeps discovery order.
+const (
+	SummarySortDuration = "duration"
+	SummarySortStatus   = "status"
+	SummarySortName     = "name"
+)
+
+// statusRank orders statuses from most to least severe.
+var statusRank = map[string]int{
+	statusError: 0,
+	statusWarn:  1,
+	statusOK:    2,
+}
+
+// selectSummaryRows filters results by --summary-only and orders them by
+// --summary-sort. "warnings" keeps warn and error rows. Sorting is stable so
+// ties keep discovery order.
+func selectSummaryRows(results []RepoResult, statuses map[*RepoResult]string, only, sortBy string) []*RepoResult {
+	rows := make([]*RepoResult, 0, len(results))
+	for i := range results {
+		r := &results[i]
+		switch only {
+		case SummaryOnlyErrors:
+			if statuses[r] != statusError {
+				continue
+			}
+		case SummaryOnlyWarnings:
+			if statuses[r] == statusOK {
+				continue
+			}
+		}
+		rows = append(rows, r)
+	}
+
+	switch sortBy {
+	case SummarySortDuration:
+		slices.SortStableFunc(rows, func(a, b *RepoResult) int {
+			return cmp.Compare(b.DurationMS, a.DurationMS)
+		})
+	case SummarySortStatus:
+		slices.SortStableFunc(rows, func(a, b *RepoResult) int {
+			return cmp.Compare(statusRank[statuses[a]], statusRank[statuses[b]])
+		})
+	case SummarySortName:
+		slices.SortStableFunc(rows, func(a, b *RepoResult) int {
+			return cmp.Compare(a.CollectionSlug, b.CollectionSlug)
+		})
+	}
+	return rows
+}
+
+// summaryColumn is one selectable column of the console summary table.
+type summaryColumn struct {
+	value  func(r *RepoResult, status string) string
+	name   string
+	header string
+	// aliases are other names accepted for the column.
+	aliases []string
+}
+
+// summaryColumnDefs lists every column accepted by --summary-columns.
+var summaryColumnDefs = []summaryColumn{
+	{
+		name:   "repo",
+		header: "Repo",
+		value:  func(r *RepoResult, _ string) string { return filepath.Base(r.Path) },
+	},
+	{
+		name:   "collection",
+		header: "Collection",
+		value:  func(r *RepoResult, _ string) string { return r.CollectionSlug },
+	},
+	{
+		name:   "branch",
+		header: "Branch",
+		value:  func(r *RepoResult, _ string) string { return orDash(r.DefaultBranch) },
+	},
+	{
+		name:   "git",
+		header: "Git",
+		value:  func(r *RepoResult, _ string) string { return formatGitStatus(r) },
+	},
+	{
+		name:   "codex",
+		header: "Codex",
+		value:  func(r *RepoResult, _ string) string { return formatCodexStatus(r) },
+	},
+	{
+		name:   "status",
+		header: "Status",
+		value:  func(_ *RepoResult, status string) string { return colorStatus(status) },
+	},
+	{
+		name:   "duration",
+		header: "Duration",
+		value:  func(r *RepoResult, _ string) string { return formatDurationMS(r.DurationMS) },
+	},
+	{
+		name:   "diff",
+		header: "Diff Files",
+		value: func(r *RepoResult, _ string) string {
+			if r.DiffBaseCommit == "" {
+				return "-"
+			}
+			return strconv.Itoa(r.DiffFileCount)
+		},
+	},
+	{
+		name:    "documents",
+		aliases: []string{"docs"},
+		header:  "Documents",
+		value: func(r *RepoResult, _ string) string {
+			if r.DocumentChanges == nil && r.IngestedDocs > 0 {
+				return strconv.Itoa(r.IngestedDocs)
+			}
+			return r.DocumentChanges.String()
+		},
+	},
+	{
+		name:   "commit",
+		header: "Commit",
+		value:  func(r *RepoResult, _ string) string { return orDash(shortCommit(r.IndexedCommit)) },
+	},
+	{
+		name:   "remote",
+		header: "Remote",
+		value:  func(r *RepoResult, _ string) string { return orDash(r.RemoteURL) },
+	},
+}
+
+// defaultSummaryColumns is the table layout used when --summary-columns is
+// not set.
+var defaultSummaryColumns = []string{"repo", "collection", "branch", "git", "codex", "status"}
+
+// resolveSummaryColumns maps column names to their definitions, in the order
+// given. An empty list selects the default columns.
+func resolveSummaryColumns(names []string) ([]summaryColumn, error) {
+	if len(names) == 0 {
+		names = defaultSummaryColumns
+	}
+
+	columns := make([]summaryColumn, 0, len(names))
+	for _, name := range names {
+		key := strings.ToLower(strings.TrimSpace(name))
+		idx := slices.IndexFunc(summaryColumnDefs, func(col summaryColumn) bool {
+			return col.name == key || slices.Contains(col.aliases, key)
+		})
+		if idx < 0 {
+			known := make([]string, len(summaryColumnDefs))
+			for i, col := range summaryColumnDefs {
+				known[i] = col.name
+			}
+			return nil, fmt.Errorf("unknown summary column %q (want %s)", name, strings.Join(known, ", "))
+		}
+		columns = append(columns, summaryColumnDefs[idx])
+	}
+	return columns, nil
+}
+
+func formatDurationMS(ms int64) string {
+	return (time.Duration(ms) * time.Millisecond).Round(time.Second).String()
+}
+
 type summaryCounts struct {
 	ok   int
 	warn int
 	err  int
 }
 
+// gitFallbackLabels name the GitFallback reasons in the summary table.
+var gitFallbackLabels = map[string]string{
+	GitFallbackNoBranch:    "no branch",
+	GitFallbackWorktreeDir: "worktree dir failed",
+	GitFallbackFetch:       "fetch failed",
+	GitFallbackDisk:        "disk preflight failed",
+	GitFallbackWorktreeAdd: "worktree add failed",
+}
+
 func formatGitStatus(r *RepoResult) string {
 	if r.DefaultBranch == "" {
+		if r.HeadState != "" {
+			return r.HeadState + " HEAD"
+		}
 		return "unknown"
 	}
 
 	parts := []string{r.DefaultBranch}
+	if r.HeadState != "" {
+		parts = append(parts, r.HeadState+" HEAD")
+	}
+	if r.Git != nil && r.Git.Fallback != "" {
+		parts = append(parts, "working tree ("+gitFallbackLabels[r.Git.Fallback]+")")
+		if r.GitFailure != "" {
+			parts = append(parts, r.GitFailure)
+		}
+		return strings.Join(parts, ", ")
+	}
 	if r.CheckoutOK != nil && !*r.CheckoutOK {
 		parts = append(parts, "checkout failed")
 	}
 	if r.PullOK != nil && !*r.PullOK {
 		parts = append(parts, "pull failed")
 	}
+	if r.GitFailure != "" {
+		parts = append(parts, r.GitFailure)
+	}
 	return strings.Join(parts, ", ")
 }
 
 func formatCodexStatus(r *RepoResult) string {
 	switch {
+	case r.HealthError != "":
+		return "quarantined"
+	case r.Stale != nil && *r.Stale:
+		return "stale"
+	case r.Stale != nil:
+		return "fresh"
+	case r.OptedOut:
+		return "opted out"
 	case r.SkipReason != "":
 		return "skipped"
 	case r.DryRun:
@@ -77,17 +302,42 @@ func formatCodexStatus(r *RepoResult) string {
 }
 
 func (ix *indexer) renderStatus(r *RepoResult, counts *summaryCounts) string {
-	switch {
-	case r.Error != "" || (r.CodexRan && r.CodexExitCode != nil):
+	status := repoStatus(r)
+	switch status {
+	case statusError:
 		counts.err++
-		return "error"
-	case (r.CheckoutOK != nil && !*r.CheckoutOK) || (r.PullOK != nil && !*r.PullOK):
+	case statusWarn:
 		counts.warn++
-		return "warn"
 	default:
 		counts.ok++
-		return "ok"
 	}
+	return status
+}
+
+// Overall repo statuses shown in the summary table and stored in history.
+const (
+	statusOK    = "ok"
+	statusWarn  = "warn"
+	statusError = "error"
+)
+
+// repoStatus classifies a result as ok, warn, or error.
+func repoStatus(r *RepoResult) string {
+	switch {
+	case r.Error != "" || r.HealthError != "" || (r.CodexRan && r.CodexExitCode != nil):
+		return statusError
+	case (r.CheckoutOK != nil && !*r.CheckoutOK) || (r.PullOK != nil && !*r.PullOK) ||
+		(r.CodegenOK != nil && !*r.CodegenOK) || (r.Stale != nil && *r.Stale) || r.replicaFailed() ||
+		len(r.OutputWarnings) > 0:
+		return statusWarn
+	default:
+		return statusOK
+	}
+}
+
+// replicaFailed reports whether copying to any replica store failed.
+func (r *RepoResult) replicaFailed() bool {
+	return slices.ContainsFunc(r.Replicas, func(rr ReplicaResult) bool { return rr.Error != "" })
 }
 
 func orDash(s string) string {
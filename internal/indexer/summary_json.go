@@ -2,27 +2,120 @@ package indexer
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 )
 
-func writeSummaryJSON(path, rootDir string, dryRun bool, results []RepoResult) error {
+// summaryRotateLayout stamps rotated summaries with the previous run's write
+// time; it sorts chronologically and avoids ':' for Windows.
+const summaryRotateLayout = "2006-01-02T15-04-05Z"
+
+func summaryPayload(rootDir string, dryRun bool, results []RepoResult, sync *SyncReport) map[string]any {
 	payload := map[string]any{
 		"generated_at": time.Now().UTC().Format(time.RFC3339),
 		"root_dir":     rootDir,
 		"dry_run":      dryRun,
+		"indexer":      ReadBuildInfo(),
 		"repos":        results,
 	}
+	if sync != nil {
+		payload["sync"] = sync
+	}
+	return payload
+}
 
+// writeSummaryJSON atomically replaces the summary at path. When keep is
+// positive the previous summary is first renamed to
+// "<name>-<time><ext>" and only the keep newest of those are retained.
+func writeSummaryJSON(path string, keep int, payload map[string]any) error {
 	data, err := json.MarshalIndent(payload, "", "  ")
 	if err != nil {
 		return fmt.Errorf("marshal summary json: %w", err)
 	}
 
-	if err := os.WriteFile(path, data, 0o600); err != nil {
+	if keep > 0 {
+		if err := rotateSummary(path, keep); err != nil {
+			return err
+		}
+	}
+	if err := writeFileSynced(path, data, 0o600); err != nil {
 		return fmt.Errorf("write summary json: %w", err)
 	}
+	return nil
+}
+
+// rotateSummary moves the summary at path aside, stamped with its
+// modification time, and deletes rotated summaries beyond the keep newest.
+func rotateSummary(path string, keep int) error {
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("stat summary json: %w", err)
+	}
+
+	ext := filepath.Ext(path)
+	stem := strings.TrimSuffix(path, ext)
+	rotated := stem + "-" + info.ModTime().UTC().Format(summaryRotateLayout) + ext
+	if err := os.Rename(path, rotated); err != nil {
+		return fmt.Errorf("rotate summary json: %w", err)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return fmt.Errorf("list rotated summaries: %w", err)
+	}
+	prefix := filepath.Base(stem) + "-"
+	var stamps []string
+	for _, entry := range entries {
+		rest, ok := strings.CutPrefix(entry.Name(), prefix)
+		if !ok {
+			continue
+		}
+		stamp, ok := strings.CutSuffix(rest, ext)
+		if !ok {
+			continue
+		}
+		if _, err := time.Parse(summaryRotateLayout, stamp); err == nil {
+			stamps = append(stamps, stamp)
+		}
+	}
+	slices.Sort(stamps)
+	for _, stamp := range stamps[:max(len(stamps)-keep, 0)] {
+		if err := os.Remove(stem + "-" + stamp + ext); err != nil {
+			return fmt.Errorf("prune rotated summary: %w", err)
+		}
+	}
+	return nil
+}
+
+// appendSummaryNDJSON appends payload as one line to the NDJSON file at
+// path, accumulating runs for later analysis.
+func appendSummaryNDJSON(path string, payload map[string]any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal summary json: %w", err)
+	}
 
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("open summary log: %w", err)
+	}
+	// One write per run keeps concurrent appenders from interleaving lines.
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return errors.Join(fmt.Errorf("append summary log: %w", err), f.Close())
+	}
+	if err := f.Sync(); err != nil {
+		return errors.Join(fmt.Errorf("sync summary log: %w", err), f.Close())
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close summary log: %w", err)
+	}
 	return nil
 }
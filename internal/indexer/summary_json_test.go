@@ -4,7 +4,10 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestWriteSummaryJSON(t *testing.T) {
@@ -18,7 +21,7 @@ func TestWriteSummaryJSON(t *testing.T) {
 		},
 	}
 
-	if err := writeSummaryJSON(path, "/tmp", true, results); err != nil {
+	if err := writeSummaryJSON(path, 0, summaryPayload("/tmp", true, results, nil)); err != nil {
 		t.Fatalf("write summary: %v", err)
 	}
 
@@ -30,6 +33,7 @@ func TestWriteSummaryJSON(t *testing.T) {
 	var payload struct {
 		GeneratedAt string       `json:"generated_at"`
 		RootDir     string       `json:"root_dir"`
+		Indexer     BuildInfo    `json:"indexer"`
 		DryRun      bool         `json:"dry_run"`
 		Repos       []RepoResult `json:"repos"`
 	}
@@ -43,6 +47,9 @@ func TestWriteSummaryJSON(t *testing.T) {
 	if payload.RootDir != "/tmp" {
 		t.Fatalf("expected root_dir /tmp, got %q", payload.RootDir)
 	}
+	if payload.Indexer.Version == "" || len(payload.Indexer.Runners) == 0 {
+		t.Fatalf("expected indexer build info, got %+v", payload.Indexer)
+	}
 	if !payload.DryRun {
 		t.Fatalf("expected dry_run true, got %t", payload.DryRun)
 	}
@@ -53,3 +60,130 @@ func TestWriteSummaryJSON(t *testing.T) {
 		t.Fatalf("expected repo slug to be repo, got %q", payload.Repos[0].CollectionSlug)
 	}
 }
+
+func TestWriteSummaryJSONRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "summary.json")
+
+	// Earlier rotations, plus files that only look similar.
+	for _, name := range []string{
+		"summary-2024-06-01T10-00-00Z.json",
+		"summary-2024-06-02T10-00-00Z.json",
+		"summary-notes.json",
+		"other-2024-06-01T10-00-00Z.json",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("{}"), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	if err := os.WriteFile(path, []byte(`{"previous": true}`), 0o600); err != nil {
+		t.Fatalf("write previous summary: %v", err)
+	}
+	previousTime := time.Date(2024, 6, 3, 10, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(path, previousTime, previousTime); err != nil {
+		t.Fatalf("set previous summary time: %v", err)
+	}
+
+	if err := writeSummaryJSON(path, 2, summaryPayload("/tmp", false, nil, nil)); err != nil {
+		t.Fatalf("write summary: %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("read dir: %v", err)
+	}
+	var got []string
+	for _, entry := range entries {
+		got = append(got, entry.Name())
+	}
+	want := []string{
+		"other-2024-06-01T10-00-00Z.json",
+		"summary-2024-06-02T10-00-00Z.json",
+		"summary-2024-06-03T10-00-00Z.json",
+		"summary-notes.json",
+		"summary.json",
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("expected files %v, got %v", want, got)
+	}
+
+	rotated, err := os.ReadFile(filepath.Join(dir, "summary-2024-06-03T10-00-00Z.json"))
+	if err != nil {
+		t.Fatalf("read rotated summary: %v", err)
+	}
+	if string(rotated) != `{"previous": true}` {
+		t.Fatalf("expected the previous summary to be rotated, got %s", rotated)
+	}
+}
+
+func TestWriteSummaryJSONNoRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "summary.json")
+	for range 2 {
+		if err := writeSummaryJSON(path, 0, summaryPayload("/tmp", false, nil, nil)); err != nil {
+			t.Fatalf("write summary: %v", err)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("read dir: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "summary.json" {
+		t.Fatalf("expected only summary.json without rotation or temp files, got %v", entries)
+	}
+}
+
+func TestRunResultsWithoutSummaryPath(t *testing.T) {
+	rootDir := t.TempDir()
+	initGitRepo(t, filepath.Join(rootDir, "api"))
+	workDir := t.TempDir()
+	t.Chdir(workDir)
+
+	results, err := RunResults(Options{
+		RootDir:   rootDir,
+		CachePath: filepath.Join(t.TempDir(), "cache.json"),
+		DryRun:    true,
+	})
+	if err != nil || len(results) != 1 {
+		t.Fatalf("expected 1 result without error, got %d (%v)", len(results), err)
+	}
+	entries, err := os.ReadDir(workDir)
+	if err != nil {
+		t.Fatalf("read working dir: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected no summary written to the working dir, got %v", entries)
+	}
+}
+
+func TestAppendSummaryNDJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "runs.ndjson")
+	for _, root := range []string{"/one", "/two"} {
+		payload := summaryPayload(root, false, []RepoResult{{CollectionSlug: "repo"}}, nil)
+		if err := appendSummaryNDJSON(path, payload); err != nil {
+			t.Fatalf("append summary: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read summary log: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d: %q", len(lines), data)
+	}
+	for i, want := range []string{"/one", "/two"} {
+		var run struct {
+			RootDir string       `json:"root_dir"`
+			Repos   []RepoResult `json:"repos"`
+		}
+		if err := json.Unmarshal([]byte(lines[i]), &run); err != nil {
+			t.Fatalf("decode line %d: %v", i, err)
+		}
+		if run.RootDir != want || len(run.Repos) != 1 {
+			t.Fatalf("expected line %d for %s with 1 repo, got %+v", i, want, run)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package indexer
 
 import (
+	"bytes"
 	"io"
+	"slices"
 	"strings"
 	"testing"
 )
@@ -27,6 +29,29 @@ func TestFormatGitStatus(t *testing.T) {
 			result: RepoResult{DefaultBranch: "main", PullOK: boolPtr(false)},
 			want:   "main, pull failed",
 		},
+		"transient fetch failure": {
+			result: RepoResult{DefaultBranch: "main", PullOK: boolPtr(false), GitFailure: gitFailureTransient},
+			want:   "main, pull failed, transient",
+		},
+		"fallback explained": {
+			result: RepoResult{
+				DefaultBranch: "main", CheckoutOK: boolPtr(false), PullOK: boolPtr(false),
+				GitFailure: gitFailurePermanent, Git: &GitPrep{Fallback: GitFallbackFetch},
+			},
+			want: "main, working tree (fetch failed), permanent",
+		},
+		"worktree used": {
+			result: RepoResult{DefaultBranch: "main", CheckoutOK: boolPtr(true), Git: &GitPrep{Worktree: "/tmp/wt"}},
+			want:   "main",
+		},
+		"unborn head": {
+			result: RepoResult{HeadState: "unborn"},
+			want:   "unborn HEAD",
+		},
+		"detached head with branch": {
+			result: RepoResult{DefaultBranch: "main", HeadState: "detached"},
+			want:   "main, detached HEAD",
+		},
 		"both failures": {
 			result: RepoResult{DefaultBranch: "main", CheckoutOK: boolPtr(false), PullOK: boolPtr(false)},
 			want:   "main, checkout failed, pull failed",
@@ -50,8 +75,12 @@ func TestFormatCodexStatus(t *testing.T) {
 		result RepoResult
 		want   string
 	}{
+		"quarantine wins": {
+			result: RepoResult{HealthError: "fsck", SkipReason: SkipReasonQuarantined},
+			want:   "quarantined",
+		},
 		"skip reason wins": {
-			result: RepoResult{SkipReason: "skip"},
+			result: RepoResult{SkipReason: SkipReasonCacheHit},
 			want:   "skipped",
 		},
 		"dry run": {
@@ -83,7 +112,7 @@ func TestFormatCodexStatus(t *testing.T) {
 }
 
 func TestRenderStatus(t *testing.T) {
-	ix := newIndexer(io.Discard, io.Discard, nil, nil, 0, 1)
+	ix := newIndexer(io.Discard, io.Discard, nil, nil, Options{})
 	var exitCode int
 
 	tests := map[string]struct {
@@ -101,11 +130,21 @@ func TestRenderStatus(t *testing.T) {
 			wantStatus: "error",
 			wantCounts: summaryCounts{err: 1},
 		},
+		"error by health check": {
+			result:     RepoResult{HealthError: "fsck failed"},
+			wantStatus: "error",
+			wantCounts: summaryCounts{err: 1},
+		},
 		"warn by checkout": {
 			result:     RepoResult{CheckoutOK: boolPtr(false)},
 			wantStatus: "warn",
 			wantCounts: summaryCounts{warn: 1},
 		},
+		"warn by codegen": {
+			result:     RepoResult{CodegenOK: boolPtr(false)},
+			wantStatus: "warn",
+			wantCounts: summaryCounts{warn: 1},
+		},
 		"ok": {
 			result:     RepoResult{},
 			wantStatus: "ok",
@@ -168,3 +207,123 @@ func TestColorStatus(t *testing.T) {
 		})
 	}
 }
+
+func TestResolveSummaryColumns(t *testing.T) {
+	tests := map[string]struct {
+		names   []string
+		want    []string
+		wantErr bool
+	}{
+		"default": {
+			want: defaultSummaryColumns,
+		},
+		"custom order": {
+			names: []string{"status", "Repo", " duration "},
+			want:  []string{"status", "repo", "duration"},
+		},
+		"alias": {
+			names: []string{"repo", "branch", "duration", "docs", "status"},
+			want:  []string{"repo", "branch", "duration", "documents", "status"},
+		},
+		"unknown column": {
+			names:   []string{"repo", "pages"},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			columns, err := resolveSummaryColumns(tc.names)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolve summary columns: %v", err)
+			}
+			got := make([]string, len(columns))
+			for i, col := range columns {
+				got[i] = col.name
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestPrintSummaryTableColumns(t *testing.T) {
+	var buf bytes.Buffer
+	ix := newIndexer(&buf, io.Discard, nil, nil, Options{SummaryColumns: []string{"repo", "duration", "diff"}})
+	ix.printSummaryTable([]RepoResult{
+		{Path: "/root/api", DurationMS: 75_000, DiffBaseCommit: "abc", DiffFileCount: 3},
+	})
+
+	out := buf.String()
+	for _, want := range []string{"Duration", "Diff Files", "api", "1m15s", "3"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected table to contain %q, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "Collection") {
+		t.Fatalf("expected unselected columns to be omitted, got:\n%s", out)
+	}
+}
+
+func TestSelectSummaryRows(t *testing.T) {
+	exitCode := 1
+	results := []RepoResult{
+		{CollectionSlug: "web", DurationMS: 10},
+		{CollectionSlug: "api", DurationMS: 30, CheckoutOK: boolPtr(false)},
+		{CollectionSlug: "cli", DurationMS: 20, CodexRan: true, CodexExitCode: &exitCode},
+	}
+	statuses := make(map[*RepoResult]string, len(results))
+	for i := range results {
+		statuses[&results[i]] = repoStatus(&results[i])
+	}
+
+	tests := map[string]struct {
+		only   string
+		sortBy string
+		want   []string
+	}{
+		"all in discovery order": {
+			want: []string{"web", "api", "cli"},
+		},
+		"errors only": {
+			only: SummaryOnlyErrors,
+			want: []string{"cli"},
+		},
+		"warnings include errors": {
+			only: SummaryOnlyWarnings,
+			want: []string{"api", "cli"},
+		},
+		"sort by duration": {
+			sortBy: SummarySortDuration,
+			want:   []string{"api", "cli", "web"},
+		},
+		"sort by status": {
+			sortBy: SummarySortStatus,
+			want:   []string{"cli", "api", "web"},
+		},
+		"sort by name": {
+			sortBy: SummarySortName,
+			want:   []string{"api", "cli", "web"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rows := selectSummaryRows(results, statuses, tc.only, tc.sortBy)
+			got := make([]string, len(rows))
+			for i, r := range rows {
+				got[i] = r.CollectionSlug
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
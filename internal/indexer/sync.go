@@ -0,0 +1,193 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// syncState holds the store's collections for a --sync run and remembers
+// repos whose cached commit had no collection behind it.
+type syncState struct {
+	client      *chromaClient
+	collections map[string]bool
+	restored    map[string]bool
+	mu          sync.Mutex
+}
+
+func newSyncState(ctx context.Context, opts ChromaOptions) (*syncState, error) {
+	client := newChromaClient(opts)
+	names, err := client.listCollections(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list collections: %w", err)
+	}
+	state := &syncState{
+		client:      client,
+		collections: make(map[string]bool, len(names)),
+		restored:    make(map[string]bool),
+	}
+	for _, name := range names {
+		state.collections[name] = true
+	}
+	return state, nil
+}
+
+// missing reports whether slug has no collection in the store, recording it
+// so the reconciliation report lists the repo as restored.
+func (s *syncState) missing(slug string) bool {
+	if s == nil {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.collections[slug] {
+		return false
+	}
+	s.restored[slug] = true
+	return true
+}
+
+// SyncReport is the reconciliation outcome of a --sync run. Each list holds
+// collection slugs.
+type SyncReport struct {
+	// Indexed repos had no cache entry and were indexed from scratch.
+	Indexed []string `json:"indexed,omitempty"`
+	// Refreshed repos had a stale cached commit and were reindexed
+	// incrementally.
+	Refreshed []string `json:"refreshed,omitempty"`
+	// Restored repos were cached as current but had no collection in the
+	// store, so they were reindexed from scratch.
+	Restored []string `json:"restored,omitempty"`
+	// Current repos matched their cached commit and collection.
+	Current []string `json:"current,omitempty"`
+	// Failed repos errored during this run.
+	Failed []string `json:"failed,omitempty"`
+	// PrunedCache and PrunedSlugMap are entries for repos no longer under
+	// the root.
+	PrunedCache   []string `json:"pruned_cache,omitempty"`
+	PrunedSlugMap []string `json:"pruned_slug_map,omitempty"`
+	// PrunedCollections are store collections the indexer created for repos
+	// no longer under the root.
+	PrunedCollections []string `json:"pruned_collections,omitempty"`
+	// UntrackedCollections are store collections with no cache or slug map
+	// entry; they are reported but never deleted.
+	UntrackedCollections []string `json:"untracked_collections,omitempty"`
+	// Errors are prune operations that failed.
+	Errors []string `json:"errors,omitempty"`
+	DryRun bool     `json:"dry_run"`
+}
+
+// reconcile classifies this run's results and prunes cache entries, slug map
+// entries, and collections whose repos are no longer under the root. A
+// collection is only deleted when the cache or slug map shows the indexer
+// created it.
+func (ix *indexer) reconcile(ctx context.Context, results []RepoResult, dryRun bool) *SyncReport {
+	report := &SyncReport{DryRun: dryRun}
+	slugPaths := ix.slugs.slugPaths()
+
+	discovered := make(map[string]bool, len(results))
+	paths := make(map[string]bool, len(results))
+	for i := range results {
+		r := &results[i]
+		discovered[r.CollectionSlug] = true
+		paths[r.Path] = true
+
+		switch {
+		case r.Error != "":
+			report.Failed = append(report.Failed, r.CollectionSlug)
+		case r.SkipReason != "":
+			if r.CachedCommit != "" && r.CachedCommit == r.IndexedCommit {
+				report.Current = append(report.Current, r.CollectionSlug)
+			}
+		case ix.sync.restored[r.CollectionSlug]:
+			report.Restored = append(report.Restored, r.CollectionSlug)
+		case r.CachedCommit != "":
+			report.Refreshed = append(report.Refreshed, r.CollectionSlug)
+		default:
+			report.Indexed = append(report.Indexed, r.CollectionSlug)
+		}
+	}
+	// A repo that failed before its slug map lookup reports its path-derived
+	// slug; keep the mapped one too so its collection is not pruned.
+	for slug, path := range slugPaths {
+		if paths[path] {
+			discovered[slug] = true
+		}
+	}
+
+	managed := make(map[string]bool)
+	for _, slug := range ix.cache.Slugs() {
+		managed[slug] = true
+		if discovered[slug] {
+			continue
+		}
+		report.PrunedCache = append(report.PrunedCache, slug)
+		if !dryRun {
+			ix.cache.Delete(slug)
+		}
+	}
+	for _, slug := range slices.Sorted(maps.Keys(slugPaths)) {
+		managed[slug] = true
+		if discovered[slug] {
+			continue
+		}
+		report.PrunedSlugMap = append(report.PrunedSlugMap, slug)
+		if !dryRun {
+			ix.slugs.removeSlug(slug)
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(ix.sync.collections)) {
+		switch {
+		case discovered[name]:
+		case !managed[name]:
+			report.UntrackedCollections = append(report.UntrackedCollections, name)
+		case dryRun:
+			report.PrunedCollections = append(report.PrunedCollections, name)
+		default:
+			if err := ix.sync.client.deleteCollection(ctx, name); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("delete collection %s: %v", name, err))
+				continue
+			}
+			report.PrunedCollections = append(report.PrunedCollections, name)
+		}
+	}
+	return report
+}
+
+func (ix *indexer) printSyncReport(report *SyncReport) {
+	ix.outln(colorize(colorCyan, "==> Reconciliation"))
+	prune := "pruned"
+	if report.DryRun {
+		prune = "would prune"
+	}
+	rows := []struct {
+		label string
+		slugs []string
+	}{
+		{"indexed", report.Indexed},
+		{"refreshed", report.Refreshed},
+		{"restored (collection missing)", report.Restored},
+		{"current", report.Current},
+		{"failed", report.Failed},
+		{prune + " cache entries", report.PrunedCache},
+		{prune + " slug map entries", report.PrunedSlugMap},
+		{prune + " collections", report.PrunedCollections},
+		{"untracked collections (kept)", report.UntrackedCollections},
+	}
+	for _, row := range rows {
+		line := fmt.Sprintf("  %s: %d", row.label, len(row.slugs))
+		if len(row.slugs) > 0 {
+			line += colorize(colorMuted, " (%s)", strings.Join(row.slugs, ", "))
+		}
+		ix.outln(line)
+	}
+	for _, msg := range report.Errors {
+		ix.errln(colorize(colorRed, "  %s", msg))
+	}
+	ix.outln("")
+}
@@ -0,0 +1,135 @@
+package indexer
+
+import (
+	"io"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestReconcile(t *testing.T) {
+	tests := map[string]struct {
+		dryRun bool
+		// pinned adds a repo whose config pins collection team_docs and
+		// that this run skips by tag.
+		pinned          bool
+		wantCollections []string
+		wantCacheSlugs  []string
+	}{
+		"prune": {
+			wantCollections: []string{"api", "manual_notes", "web"},
+			wantCacheSlugs:  []string{"api", "web"},
+		},
+		"dry run": {
+			dryRun:          true,
+			wantCollections: []string{"api", "gone", "manual_notes", "web"},
+			wantCacheSlugs:  []string{"api", "gone", "web"},
+		},
+		"pinned repo skipped by tag": {
+			pinned:          true,
+			wantCollections: []string{"api", "manual_notes", "team_docs", "web"},
+			wantCacheSlugs:  []string{"api", "team_docs", "web"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			fake, srv := newFakeChroma(t, 0)
+			delete(fake.collections, "old_api")
+			for _, n := range []string{"api", "web", "gone", "manual_notes", "team_docs"} {
+				if n == "team_docs" && !tc.pinned {
+					continue
+				}
+				fake.collections[n] = &fakeCollection{id: "id-" + n, name: n}
+			}
+
+			cache, err := loadCommitCache("")
+			if err != nil {
+				t.Fatalf("load cache: %v", err)
+			}
+			cache.Update("api", "main", "aaa")
+			cache.Update("web", "main", "bbb")
+			cache.Update("gone", "main", "ccc")
+			var cfg *Config
+			opts := Options{Sync: true}
+			if tc.pinned {
+				cache.Update("team_docs", "main", "eee")
+				cfg = &Config{Repos: map[string]RepoConfig{"docs": {Collection: "team_docs", Tags: []string{"docs"}}}}
+				opts.Tags = []string{"backend"}
+			}
+			slugs, err := loadSlugMap(filepath.Join(t.TempDir(), "slugs.json"))
+			if err != nil {
+				t.Fatalf("load slug map: %v", err)
+			}
+
+			state, err := newSyncState(t.Context(), ChromaOptions{URL: srv.URL})
+			if err != nil {
+				t.Fatalf("new sync state: %v", err)
+			}
+			ix := newIndexer(io.Discard, io.Discard, cache, cfg, opts)
+			ix.slugs = slugs
+			ix.sync = state
+
+			if ix.sync.missing("web") {
+				t.Fatal("expected web collection to be present")
+			}
+			results := []RepoResult{
+				{CollectionSlug: "api", IndexedCommit: "aaa", CachedCommit: "aaa", SkipReason: SkipReasonCacheHit},
+				{CollectionSlug: "web", IndexedCommit: "bb2", CachedCommit: "bbb"},
+				{CollectionSlug: "new", IndexedCommit: "ddd"},
+			}
+			if tc.pinned {
+				rootDir := t.TempDir()
+				repo := discoveredRepo{path: filepath.Join(rootDir, "docs")}
+				results = append(results, ix.processRepo(t.Context(), repo, rootDir, false))
+			}
+			report := ix.reconcile(t.Context(), results, tc.dryRun)
+
+			if !slices.Equal(report.Current, []string{"api"}) ||
+				!slices.Equal(report.Refreshed, []string{"web"}) ||
+				!slices.Equal(report.Indexed, []string{"new"}) {
+				t.Fatalf("unexpected classification: %+v", report)
+			}
+			if !slices.Equal(report.PrunedCache, []string{"gone"}) ||
+				!slices.Equal(report.PrunedCollections, []string{"gone"}) {
+				t.Fatalf("expected gone to be pruned, got %+v", report)
+			}
+			if !slices.Equal(report.UntrackedCollections, []string{"manual_notes"}) {
+				t.Fatalf("expected manual_notes to be untracked, got %v", report.UntrackedCollections)
+			}
+
+			var names []string
+			for n := range fake.collections {
+				names = append(names, n)
+			}
+			slices.Sort(names)
+			if !slices.Equal(names, tc.wantCollections) {
+				t.Fatalf("expected collections %v, got %v", tc.wantCollections, names)
+			}
+			if got := cache.Slugs(); !slices.Equal(got, tc.wantCacheSlugs) {
+				t.Fatalf("expected cache slugs %v, got %v", tc.wantCacheSlugs, got)
+			}
+		})
+	}
+}
+
+func TestEvaluateSkipReindexesMissingCollection(t *testing.T) {
+	cache, err := loadCommitCache("")
+	if err != nil {
+		t.Fatalf("load cache: %v", err)
+	}
+	cache.Update("api", "main", "aaa")
+
+	ix := newIndexer(io.Discard, io.Discard, cache, nil, Options{})
+	ix.sync = &syncState{collections: map[string]bool{}, restored: map[string]bool{}}
+
+	skip, cached := ix.evaluateSkip(t.Context(), "api", "main", "aaa", "")
+	if skip != nil || cached != "" {
+		t.Fatalf("expected full reindex, got skip=%+v cached=%q", skip, cached)
+	}
+
+	report := ix.reconcile(t.Context(), []RepoResult{{CollectionSlug: "api", IndexedCommit: "aaa"}}, true)
+	if !slices.Equal(report.Restored, []string{"api"}) {
+		t.Fatalf("expected api restored, got %+v", report)
+	}
+}
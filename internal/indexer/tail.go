@@ -0,0 +1,73 @@
+package indexer
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+)
+
+// DefaultOutputTail is how many bytes of Codex output are kept per repo
+// when Options.OutputTail is zero.
+const DefaultOutputTail = 8 << 10
+
+// outputTail keeps the last bytes written to it in a fixed ring, so a
+// failing repo's final output can be reported without holding all of it.
+// Codex's stdout and stderr write to it concurrently. A nil outputTail
+// discards writes.
+type outputTail struct {
+	buf  []byte
+	next int
+	full bool
+	mu   sync.Mutex
+}
+
+func newOutputTail(size int) *outputTail {
+	if size <= 0 {
+		return nil
+	}
+	return &outputTail{buf: make([]byte, size)}
+}
+
+func (t *outputTail) Write(p []byte) (int, error) {
+	if t == nil {
+		return len(p), nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	n := len(p)
+	if len(p) >= len(t.buf) {
+		copy(t.buf, p[len(p)-len(t.buf):])
+		t.next, t.full = 0, true
+		return n, nil
+	}
+	copied := copy(t.buf[t.next:], p)
+	if copied < len(p) {
+		copy(t.buf, p[copied:])
+		t.full = true
+	}
+	t.next = (t.next + len(p)) % len(t.buf)
+	if t.next == 0 {
+		t.full = true
+	}
+	return n, nil
+}
+
+// String returns the kept output. When earlier output was dropped, the
+// partial first line is dropped too.
+func (t *outputTail) String() string {
+	if t == nil {
+		return ""
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.full {
+		return strings.ToValidUTF8(string(t.buf[:t.next]), "")
+	}
+	out := append(bytes.Clone(t.buf[t.next:]), t.buf[:t.next]...)
+	if i := bytes.IndexByte(out, '\n'); i >= 0 && i < len(out)-1 {
+		out = out[i+1:]
+	}
+	return strings.ToValidUTF8(string(out), "")
+}
@@ -0,0 +1,60 @@
+package indexer
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestOutputTail(t *testing.T) {
+	tests := map[string]struct {
+		writes []string
+		size   int
+		want   string
+	}{
+		"fits": {
+			writes: []string{"starting\n", "done\n"},
+			size:   64,
+			want:   "starting\ndone\n",
+		},
+		"wraps to a whole line": {
+			writes: []string{"line one\n", "line two\n", "error: boom\n"},
+			size:   16,
+			want:   "error: boom\n",
+		},
+		"single oversized write": {
+			writes: []string{strings.Repeat("x", 40) + "\nfatal\n"},
+			size:   10,
+			want:   "fatal\n",
+		},
+		"exactly full": {
+			writes: []string{"abcd", "efgh"},
+			size:   8,
+			want:   "abcdefgh",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			tail := newOutputTail(tc.size)
+			for _, w := range tc.writes {
+				if n, err := tail.Write([]byte(w)); err != nil || n != len(w) {
+					t.Fatalf("write %q: n=%d err=%v", w, n, err)
+				}
+			}
+			if got := tail.String(); got != tc.want {
+				t.Fatalf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestOutputTailDisabled(t *testing.T) {
+	tail := newOutputTail(0)
+	if _, err := fmt.Fprint(tail, "ignored"); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if got := tail.String(); got != "" {
+		t.Fatalf("expected a disabled tail to keep nothing, got %q", got)
+	}
+}
@@ -0,0 +1,76 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ErrStaleRepos is returned by Run in --verify-only mode when at least one
+// repo would be indexed.
+var ErrStaleRepos = errors.New("stale repositories found")
+
+// verifyRepo implements --verify-only: it resolves the index branch tip
+// without fetching or creating a worktree and compares it with the commit
+// cache, recording whether the repo would be indexed.
+func (ix *indexer) verifyRepo(
+	ctx context.Context,
+	result *RepoResult,
+	repoDir, slug, branch string,
+	settings repoSettings,
+) {
+	if branch == "" {
+		branch = ix.selectIndexBranch(ctx, repoDir, "")
+	}
+	commit, err := ix.branchTip(ctx, repoDir, branch, settings)
+	if err != nil {
+		result.fail(err)
+		ix.log(ctx).warnf("could not resolve %s: %v", branch, err)
+		return
+	}
+	result.IndexedCommit = commit
+
+	cached, ok := ix.cache.LastCommit(slug, branch)
+	result.CachedCommit = cached
+	stale := !ok || cached != commit
+	result.Stale = &stale
+	switch {
+	case !ok:
+		ix.log(ctx).infof("stale: %s at %s was never indexed", branch, shortCommit(commit))
+	case stale:
+		ix.log(ctx).infof("stale: %s moved from %s to %s", branch, shortCommit(cached), shortCommit(commit))
+	default:
+		ix.log(ctx).infof("up to date: %s at %s", branch, shortCommit(commit))
+	}
+}
+
+// branchTip returns the commit of branch on the repo's remote via
+// git ls-remote, falling back to the local remote-tracking ref (or HEAD when
+// there is no remote) if the remote cannot be reached.
+func (ix *indexer) branchTip(ctx context.Context, repoDir, branch string, settings repoSettings) (string, error) {
+	if settings.remote == "" || branch == "" {
+		return headCommit(ctx, repoDir)
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "-C", repoDir, "ls-remote", settings.remoteName, "refs/heads/"+branch)
+	cmd.Env = settings.gitEnv()
+	out, err := procOutput(ctx, cmd)
+	if err == nil {
+		if fields := strings.Fields(string(out)); len(fields) > 0 {
+			return fields[0], nil
+		}
+		return "", fmt.Errorf("branch %s not found on %s", branch, settings.remoteName)
+	}
+	ix.log(ctx).warnf("git ls-remote %s failed: %v — using local %s/%s", settings.remoteName, err,
+		settings.remoteName, branch)
+
+	ref := settings.remoteName + "/" + branch
+	cmd = exec.CommandContext(ctx, "git", "-C", repoDir, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	out, err = procOutput(ctx, cmd)
+	if err != nil {
+		return "", fmt.Errorf("git rev-parse %s: %w", ref, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
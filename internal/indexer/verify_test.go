@@ -0,0 +1,86 @@
+package indexer
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyRepo(t *testing.T) {
+	tests := map[string]struct {
+		cached    func(remoteHead string) string
+		pushAhead bool
+		wantStale bool
+	}{
+		"never indexed": {
+			cached:    func(string) string { return "" },
+			wantStale: true,
+		},
+		"up to date": {
+			cached: func(head string) string { return head },
+		},
+		"remote moved": {
+			cached:    func(head string) string { return head },
+			pushAhead: true,
+			wantStale: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			root := t.TempDir()
+			upstream := filepath.Join(root, "upstream")
+			initGitRepo(t, upstream)
+			checkout := filepath.Join(root, "checkout")
+			if err := runGit(root, "clone", "--quiet", upstream, checkout); err != nil {
+				t.Fatalf("git clone: %v", err)
+			}
+			head, err := headCommit(t.Context(), upstream)
+			if err != nil {
+				t.Fatalf("head commit: %v", err)
+			}
+
+			cache, err := loadCommitCache("")
+			if err != nil {
+				t.Fatalf("load cache: %v", err)
+			}
+			cache.Update("checkout", "trunk", tc.cached(head))
+
+			if tc.pushAhead {
+				if err := os.WriteFile(filepath.Join(upstream, "new.txt"), []byte("new"), 0o644); err != nil {
+					t.Fatalf("write file: %v", err)
+				}
+				if err := runGit(upstream, "add", "."); err != nil {
+					t.Fatalf("git add: %v", err)
+				}
+				if err := runGit(upstream, "commit", "-m", "ahead"); err != nil {
+					t.Fatalf("git commit: %v", err)
+				}
+			}
+
+			ix := newIndexer(io.Discard, io.Discard, cache, nil, Options{VerifyOnly: true})
+			var result RepoResult
+			settings := repoSettings{remoteName: "origin", remote: upstream}
+			ix.verifyRepo(t.Context(), &result, checkout, "checkout", "trunk", settings)
+
+			if result.Error != "" {
+				t.Fatalf("unexpected error: %s", result.Error)
+			}
+			if result.Stale == nil || *result.Stale != tc.wantStale {
+				t.Fatalf("expected stale=%t, got %v", tc.wantStale, result.Stale)
+			}
+			if got := repoStatus(&result); (got == statusWarn) != tc.wantStale {
+				t.Fatalf("expected warn status for stale repos, got %s", got)
+			}
+			// The checkout itself must not be fetched into.
+			local, err := headCommit(t.Context(), checkout)
+			if err != nil {
+				t.Fatalf("head commit: %v", err)
+			}
+			if local != head {
+				t.Fatalf("expected checkout to stay at %s, got %s", head, local)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package indexer
+
+import (
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+// version, when set at link time, overrides the module version:
+//
+//	go build -ldflags "-X ai-index/internal/indexer.version=v1.2.3" ./cmd/cli
+var version string
+
+// develVersion is reported for builds without a module or linked version.
+const develVersion = "devel"
+
+// Adapters compiled into this binary.
+var (
+	runnerAdapters = []string{"codex"}
+	storeAdapters  = []string{"chroma"}
+)
+
+// BuildInfo describes the running binary.
+type BuildInfo struct {
+	// Version is the linked or module version, or "devel".
+	Version string `json:"version"`
+	// Commit and Date are the VCS revision the binary was built from and
+	// its commit time, when recorded by the Go toolchain.
+	Commit    string `json:"commit,omitempty"`
+	Date      string `json:"date,omitempty"`
+	GoVersion string `json:"go_version"`
+	// Runners and Stores list the compiled-in indexing runners and
+	// collection stores.
+	Runners []string `json:"runners"`
+	Stores  []string `json:"stores"`
+	// Modified reports uncommitted changes in the build's work tree.
+	Modified bool `json:"modified,omitempty"`
+}
+
+// ReadBuildInfo returns the running binary's version and VCS details.
+var ReadBuildInfo = sync.OnceValue(readBuildInfo)
+
+func readBuildInfo() BuildInfo {
+	info := BuildInfo{
+		Version:   version,
+		GoVersion: runtime.Version(),
+		Runners:   runnerAdapters,
+		Stores:    storeAdapters,
+	}
+
+	bi, ok := debug.ReadBuildInfo()
+	if ok {
+		if info.Version == "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				info.Commit = s.Value
+			case "vcs.time":
+				info.Date = s.Value
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+	}
+	if info.Version == "" {
+		info.Version = develVersion
+	}
+	return info
+}
+
+// String renders the version with its short commit, e.g.
+// "v1.2.3 (abc1234)" or "devel (abc1234, modified)".
+func (b BuildInfo) String() string {
+	if b.Commit == "" {
+		return b.Version
+	}
+	details := []string{shortCommit(b.Commit)}
+	if b.Modified {
+		details = append(details, "modified")
+	}
+	return b.Version + " (" + strings.Join(details, ", ") + ")"
+}
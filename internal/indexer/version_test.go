@@ -0,0 +1,40 @@
+package indexer
+
+import "testing"
+
+func TestBuildInfoString(t *testing.T) {
+	const commit = "0123456789abcdef0123456789abcdef01234567"
+
+	tests := map[string]struct {
+		info BuildInfo
+		want string
+	}{
+		"version only": {info: BuildInfo{Version: "v1.2.3"}, want: "v1.2.3"},
+		"with commit":  {info: BuildInfo{Version: "v1.2.3", Commit: commit}, want: "v1.2.3 (0123456)"},
+		"modified tree": {
+			info: BuildInfo{Version: develVersion, Commit: commit, Modified: true},
+			want: "devel (0123456, modified)",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tc.info.String(); got != tc.want {
+				t.Fatalf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestReadBuildInfo(t *testing.T) {
+	info := ReadBuildInfo()
+	if info.Version == "" {
+		t.Fatalf("expected a version, got %+v", info)
+	}
+	if info.GoVersion == "" {
+		t.Fatalf("expected a go version, got %+v", info)
+	}
+	if len(info.Runners) != 1 || info.Runners[0] != "codex" || len(info.Stores) != 1 || info.Stores[0] != "chroma" {
+		t.Fatalf("expected codex runner and chroma store, got %+v", info)
+	}
+}
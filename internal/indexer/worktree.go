@@ -2,15 +2,41 @@ package indexer
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 	"unicode"
+	"unicode/utf8"
 )
 
 const worktreeRootDirName = "codex-indexer-worktrees"
 
+// maxPathComponentLen caps a sanitized path component in bytes, well under
+// the 255-byte file name limit of common filesystems and short enough to keep
+// worktree paths inside Windows' 260-character MAX_PATH.
+const maxPathComponentLen = 100
+
+// windowsReservedNames are device names Windows rejects as file names, with
+// or without an extension.
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// sanitizePathComponent turns value into a single path component that is
+// safe on every supported OS: only letters, digits, '-', '_', and '.', no
+// trailing dots, no "." or "..", no Windows device names, and at most
+// maxPathComponentLen bytes.
 func sanitizePathComponent(value string) string {
 	value = strings.TrimSpace(value)
 	if value == "" {
@@ -24,76 +50,302 @@ func sanitizePathComponent(value string) string {
 		}
 		b.WriteRune('_')
 	}
-	out := b.String()
+	// Windows silently drops trailing dots, so "a." and "a" would collide;
+	// trimming also rules out "." and "..".
+	out := strings.TrimRight(b.String(), ".")
 	if strings.Trim(out, "_") == "" {
 		return "component"
 	}
-	return out
+	stem, ext, _ := strings.Cut(out, ".")
+	if windowsReservedNames[strings.ToUpper(stem)] {
+		out = stem + "_"
+		if ext != "" {
+			out += "." + ext
+		}
+	}
+	return limitPathComponent(out, value)
+}
+
+// limitPathComponent truncates name to maxPathComponentLen bytes, replacing
+// the tail with a hash of key so distinct long inputs stay distinct.
+func limitPathComponent(name, key string) string {
+	if len(name) <= maxPathComponentLen {
+		return name
+	}
+	sum := sha256.Sum256([]byte(key))
+	suffix := "-" + hex.EncodeToString(sum[:4])
+	head := name[:maxPathComponentLen-len(suffix)]
+	for !utf8.ValidString(head) {
+		head = head[:len(head)-1]
+	}
+	return head + suffix
+}
+
+// worktreeDirName is the directory name of the index worktree for slug and
+// branch, kept within maxPathComponentLen as a whole. It ends with a hash of
+// the raw slug and branch, so branches that sanitize alike, such as
+// "feature/x" and "feature_x", never share a checkout.
+func worktreeDirName(slug, branch string) string {
+	key := slug + "\x00" + branch
+	sum := sha256.Sum256([]byte(key))
+	suffix := "-" + hex.EncodeToString(sum[:4])
+	name := sanitizePathComponent(slug) + "-" + sanitizePathComponent(branch)
+	if len(name)+len(suffix) > maxPathComponentLen {
+		// limitPathComponent ends with the same hash.
+		return limitPathComponent(name, key)
+	}
+	return name + suffix
+}
+
+// newRunID identifies one indexer process: its start time and PID.
+func newRunID() string {
+	return time.Now().UTC().Format("20060102T150405") + "-" + strconv.Itoa(os.Getpid())
+}
+
+// worktreeRunDir is the directory holding this run's index worktrees. Each
+// run gets its own so concurrent processes never share worktree paths.
+func (ix *indexer) worktreeRunDir() string {
+	return filepath.Join(ix.tempDir(), worktreeRootDirName, ix.runID)
+}
+
+// Fallback reasons recorded in GitPrep.Fallback when Codex runs in the
+// checkout's current working tree instead of a fresh worktree.
+const (
+	// GitFallbackNoBranch: no index branch was detected.
+	GitFallbackNoBranch = "no_branch"
+	// GitFallbackWorktreeDir: the worktree directory could not be created.
+	GitFallbackWorktreeDir = "worktree_dir"
+	// GitFallbackFetch: fetching the index branch failed.
+	GitFallbackFetch = "fetch_failed"
+	// GitFallbackDisk: the disk preflight failed or found too little space.
+	GitFallbackDisk = "disk_preflight"
+	// GitFallbackWorktreeAdd: git worktree add failed.
+	GitFallbackWorktreeAdd = "worktree_add_failed"
+)
+
+// Policies for repos whose index worktree could not be prepared.
+const (
+	// PrepFailureFallback indexes the checkout's current working tree.
+	PrepFailureFallback = "fallback"
+	// PrepFailureSkip skips the repo.
+	PrepFailureSkip = "skip"
+	// PrepFailureFail fails the repo.
+	PrepFailureFail = "fail"
+)
+
+// GitPrep describes how a repo's index workspace was prepared.
+type GitPrep struct {
+	// Remote and Branch are the remote and index branch fetched; Mirror is
+	// the mirror fetched instead of the checkout, when one was used.
+	Remote string `json:"remote,omitempty"`
+	Branch string `json:"branch,omitempty"`
+	Mirror string `json:"mirror,omitempty"`
+	// Worktree is the temporary worktree Codex ran in; it is empty when
+	// Codex ran in the checkout.
+	Worktree string `json:"worktree,omitempty"`
+	// Fallback classifies, as one of the GitFallback constants, why Codex
+	// ran in the current working tree; FallbackDetail describes it.
+	Fallback       string `json:"fallback,omitempty"`
+	FallbackDetail string `json:"fallback_detail,omitempty"`
+	FetchMS        int64  `json:"fetch_ms,omitempty"`
+}
+
+// indexWorkspace is the directory Codex runs in and how it was prepared.
+type indexWorkspace struct {
+	cleanup    func()
+	checkoutOK *bool
+	pullOK     *bool
+	dir        string
+	// gitErr is the fetch or worktree failure, if any; gitFailure
+	// classifies it as transient or permanent.
+	gitErr     *GitFetchError
+	gitFailure string
+	prep       GitPrep
+}
+
+// setGitErr records a failed git step while preparing the workspace.
+func (ws *indexWorkspace) setGitErr(op, remote, branch string, err error) {
+	ws.gitFailure = classifyGitFailure(err)
+	ws.gitErr = &GitFetchError{
+		Err:       err,
+		Op:        op,
+		Remote:    remote,
+		Branch:    branch,
+		Transient: ws.gitFailure == gitFailureTransient,
+	}
+}
+
+// fallBack records why Codex runs in the current working tree.
+func (ws *indexWorkspace) fallBack(reason string, err error) {
+	ws.prep.Fallback = reason
+	ws.prep.FallbackDetail = err.Error()
+}
+
+// prepErr is why the workspace fell back to the current working tree.
+func (ws *indexWorkspace) prepErr() error {
+	var cause error = errors.New(ws.prep.FallbackDetail)
+	if ws.gitErr != nil {
+		cause = ws.gitErr
+	}
+	return fmt.Errorf("index worktree not prepared (%s): %w", ws.prep.Fallback, cause)
 }
 
 func (ix *indexer) prepareIndexWorkspace(
 	ctx context.Context,
 	repoDir, slug, branch string,
+	settings repoSettings,
 	dryRun bool,
-) (string, *bool, *bool, func()) {
+) indexWorkspace {
+	ws := indexWorkspace{dir: repoDir}
 	if branch == "" {
-		return repoDir, nil, nil, nil
+		ws.fallBack(GitFallbackNoBranch, errors.New("no index branch detected"))
+		return ws
 	}
+	ws.prep.Remote = settings.remoteName
+	ws.prep.Branch = branch
 
-	safeSlug := sanitizePathComponent(slug)
-	safeBranch := sanitizePathComponent(branch)
-	worktreeBase := filepath.Join(os.TempDir(), worktreeRootDirName)
-	worktreePath := filepath.Join(worktreeBase, safeSlug+"-"+safeBranch)
+	worktreeBase := ix.worktreeRunDir()
+	worktreePath := filepath.Join(worktreeBase, worktreeDirName(slug, branch))
 
 	if dryRun {
-		ix.repoInfof("[dry-run] git -C %q fetch --prune origin %s", repoDir, branch)
-		ix.repoInfof("[dry-run] git -C %q worktree add --force --detach %q origin/%s", repoDir, worktreePath, branch)
-		return repoDir, nil, nil, nil
+		if proxy := settings.proxy; proxy != (ProxyConfig{}) {
+			ix.log(ctx).infof("[dry-run] git fetch proxy: http=%s https=%s no_proxy=%s",
+				orDash(redactURL(proxy.HTTPProxy)), orDash(redactURL(proxy.HTTPSProxy)), orDash(proxy.NoProxy))
+		}
+		if settings.credential != nil {
+			ix.log(ctx).infof("[dry-run] git fetch credentials: %s", settings.credential.describe())
+		}
+		if ix.opts.MirrorDir != "" && settings.remoteRaw != "" {
+			mirror := mirrorPath(ix.opts.MirrorDir, settings.remoteRaw)
+			ix.log(ctx).infof("[dry-run] git clone --mirror (or fetch --prune) %s -> %q", settings.remote, mirror)
+			ix.log(ctx).infof("[dry-run] git -C %q worktree add --force --detach %q %s", mirror, worktreePath, branch)
+			return ws
+		}
+		ix.log(ctx).infof("[dry-run] git -C %q %s", repoDir, strings.Join(ix.fetchArgs(settings.remoteName, branch), " "))
+		ix.log(ctx).infof("[dry-run] git -C %q worktree add --force --detach %q %s/%s",
+			repoDir, worktreePath, settings.remoteName, branch)
+		return ws
 	}
 
 	if err := os.RemoveAll(worktreePath); err != nil {
-		ix.repoWarnf("could not clean worktree path %q: %v", worktreePath, err)
+		ix.log(ctx).warnf("could not clean worktree path %q: %v", worktreePath, err)
 	}
 	if err := os.MkdirAll(filepath.Dir(worktreePath), 0o750); err != nil {
-		ix.repoWarnf("could not prepare worktree parent dir %q: %v", filepath.Dir(worktreePath), err)
-		return repoDir, boolPtr(false), boolPtr(false), nil
+		ix.log(ctx).warnf("could not prepare worktree parent dir %q: %v", filepath.Dir(worktreePath), err)
+		ws.fallBack(GitFallbackWorktreeDir, err)
+		ws.checkoutOK = boolPtr(false)
+		ws.pullOK = boolPtr(false)
+		return ws
 	}
 
-	fetch := exec.CommandContext(ctx, "git", "-C", repoDir, "fetch", "--prune", "origin", branch)
-	if err := fetch.Run(); err != nil {
-		ix.repoWarnf("git fetch origin %s failed: %v — using current working tree", branch, err)
-		return repoDir, boolPtr(false), boolPtr(false), nil
+	// Worktrees are registered in (and removed from) the repository that
+	// owns the objects: the mirror when one is used, otherwise the checkout.
+	ownerDir := repoDir
+	ref := settings.remoteName + "/" + branch
+	mirrored := false
+	fetchStarted := time.Now()
+	if ix.opts.MirrorDir != "" && settings.remoteRaw != "" {
+		mirror, err := ix.syncMirror(ctx, settings.remoteRaw, settings)
+		if err != nil {
+			ix.log(ctx).warnf("mirror sync failed: %v — fetching into the checkout instead", err)
+		} else {
+			ix.log(ctx).infof("using mirror %s", mirror)
+			ownerDir = mirror
+			ref = branch
+			mirrored = true
+			ws.prep.Mirror = mirror
+		}
 	}
 
-	add := exec.CommandContext(
-		ctx,
-		"git",
-		"-C",
-		repoDir,
-		"worktree",
-		"add",
-		"--force",
-		"--detach",
-		worktreePath,
-		"origin/"+branch,
-	)
-	if err := add.Run(); err != nil {
-		ix.repoWarnf("git worktree add for %s failed: %v — using current working tree", branch, err)
-		return repoDir, boolPtr(false), boolPtr(true), nil
+	if !mirrored {
+		fetchErr := ix.retryGit(ctx, "git fetch", func() error {
+			return runGitCommand(ctx, repoDir, settings.gitEnv(), ix.fetchArgs(settings.remoteName, branch)...)
+		})
+		ws.prep.FetchMS = time.Since(fetchStarted).Milliseconds()
+		if fetchErr != nil {
+			ws.setGitErr("fetch", settings.remoteName, branch, fetchErr)
+			ws.fallBack(GitFallbackFetch, fetchErr)
+			ix.log(ctx).warnf("git fetch %s %s failed (%s): %v — using current working tree",
+				settings.remoteName, branch, ws.gitFailure, fetchErr)
+			ws.checkoutOK = boolPtr(false)
+			ws.pullOK = boolPtr(false)
+			return ws
+		}
 	}
 
-	ix.repoInfof("using temporary worktree for %s at %s", branch, worktreePath)
+	ws.prep.FetchMS = time.Since(fetchStarted).Milliseconds()
 
-	cleanup := func() {
+	releaseDisk, err := ix.checkWorktreeDisk(ctx, ownerDir, ref, worktreeBase)
+	if err != nil {
+		ix.log(ctx).warnf("disk preflight for %s failed: %v — using current working tree", branch, err)
+		ws.fallBack(GitFallbackDisk, err)
+		ws.checkoutOK = boolPtr(false)
+		ws.pullOK = boolPtr(true)
+		return ws
+	}
+
+	addErr := ix.retryGit(ctx, "git worktree add", func() error {
+		return runGitCommand(ctx, ownerDir, nil, "worktree", "add", "--force", "--detach", worktreePath, ref)
+	})
+	if addErr != nil {
+		ws.setGitErr("worktree add", settings.remoteName, branch, addErr)
+		ws.fallBack(GitFallbackWorktreeAdd, addErr)
+		ix.log(ctx).warnf("git worktree add for %s failed (%s): %v — using current working tree",
+			branch, ws.gitFailure, addErr)
+		releaseDisk()
+		ws.checkoutOK = boolPtr(false)
+		ws.pullOK = boolPtr(true)
+		return ws
+	}
+
+	ix.log(ctx).infof("using temporary worktree for %s at %s", branch, worktreePath)
+
+	ws.cleanup = func() {
 		rmCtx := context.Background()
-		rm := exec.CommandContext(rmCtx, "git", "-C", repoDir, "worktree", "remove", "--force", worktreePath)
-		if err := rm.Run(); err != nil {
-			ix.repoWarnf("failed to remove worktree %q: %v", worktreePath, err)
+		rm := exec.CommandContext(rmCtx, "git", "-C", ownerDir, "worktree", "remove", "--force", worktreePath)
+		if err := procRun(rmCtx, rm); err != nil {
+			ix.log(ctx).warnf("failed to remove worktree %q: %v", worktreePath, err)
 		}
 		if err := os.RemoveAll(worktreePath); err != nil {
-			ix.repoWarnf("failed to delete worktree dir %q: %v", worktreePath, err)
+			ix.log(ctx).warnf("failed to delete worktree dir %q: %v", worktreePath, err)
+		}
+		releaseDisk()
+	}
+	ws.dir = worktreePath
+	ws.prep.Worktree = worktreePath
+	ws.checkoutOK = boolPtr(true)
+	ws.pullOK = boolPtr(true)
+	return ws
+}
+
+// retryGit runs op, retrying transient git failures up to --git-retries
+// times with exponential backoff starting at --git-retry-delay.
+func (ix *indexer) retryGit(ctx context.Context, desc string, op func() error) error {
+	delay := ix.opts.GitRetryDelay
+	for attempt := 0; ; attempt++ {
+		err := op()
+		if err == nil || attempt >= ix.opts.GitRetries || classifyGitFailure(err) != gitFailureTransient {
+			return err
+		}
+
+		ix.log(ctx).warnf("%s failed with a transient error (attempt %d/%d), retrying in %s: %v",
+			desc, attempt+1, ix.opts.GitRetries+1, delay, err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%s retry: %w", desc, ctx.Err())
+		case <-timer.C:
 		}
+		delay *= 2
 	}
+}
 
-	return worktreePath, boolPtr(true), boolPtr(true), cleanup
+// fetchArgs returns the git fetch arguments for the index branch, or for all
+// remotes when --fetch-all is set.
+func (ix *indexer) fetchArgs(remote, branch string) []string {
+	if ix.opts.FetchAll {
+		return []string{"fetch", "--prune", "--all"}
+	}
+	return []string{"fetch", "--prune", remote, branch}
 }
@@ -0,0 +1,262 @@
+package indexer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestPrepareIndexWorkspaceTempDir(t *testing.T) {
+	upstream := filepath.Join(t.TempDir(), "upstream")
+	initGitRepo(t, upstream)
+
+	rootDir := t.TempDir()
+	repoDir := filepath.Join(rootDir, "clone")
+	if err := runGit(rootDir, "clone", upstream, repoDir); err != nil {
+		t.Fatalf("git clone: %v", err)
+	}
+
+	tmpDir := t.TempDir()
+	ix := newIndexer(io.Discard, io.Discard, nil, nil, Options{TempDir: tmpDir})
+	settings, err := ix.resolveRepoSettings(t.Context(), newRepoIdentity(rootDir, repoDir, "clone"), repoDir)
+	if err != nil {
+		t.Fatalf("resolve repo settings: %v", err)
+	}
+
+	ws := ix.prepareIndexWorkspace(t.Context(), repoDir, "clone", "trunk", settings, false)
+	if ws.cleanup != nil {
+		defer ws.cleanup()
+	}
+	if ws.checkoutOK == nil || !*ws.checkoutOK {
+		t.Fatalf("expected checkout to succeed")
+	}
+	if !strings.HasPrefix(ws.dir, filepath.Join(tmpDir, worktreeRootDirName)) {
+		t.Fatalf("expected worktree under %s, got %s", tmpDir, ws.dir)
+	}
+	if ws.prep.Worktree != ws.dir || ws.prep.Remote != "origin" || ws.prep.Branch != "trunk" || ws.prep.Fallback != "" {
+		t.Fatalf("expected the worktree recorded without a fallback, got %+v", ws.prep)
+	}
+	if got := ix.scratchEnv(); len(got) != 1 || got[0] != "TMPDIR="+tmpDir {
+		t.Fatalf("expected TMPDIR scratch env, got %v", got)
+	}
+}
+
+func TestPrepareIndexWorkspaceFallback(t *testing.T) {
+	upstream := filepath.Join(t.TempDir(), "upstream")
+	initGitRepo(t, upstream)
+
+	rootDir := t.TempDir()
+	repoDir := filepath.Join(rootDir, "clone")
+	if err := runGit(rootDir, "clone", upstream, repoDir); err != nil {
+		t.Fatalf("git clone: %v", err)
+	}
+
+	ix := newIndexer(io.Discard, io.Discard, nil, nil, Options{TempDir: t.TempDir()})
+	settings, err := ix.resolveRepoSettings(t.Context(), newRepoIdentity(rootDir, repoDir, "clone"), repoDir)
+	if err != nil {
+		t.Fatalf("resolve repo settings: %v", err)
+	}
+
+	tests := map[string]struct {
+		branch       string
+		wantFallback string
+	}{
+		"no branch":      {wantFallback: GitFallbackNoBranch},
+		"missing branch": {branch: "gone", wantFallback: GitFallbackFetch},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ws := ix.prepareIndexWorkspace(t.Context(), repoDir, "clone", tc.branch, settings, false)
+			if ws.cleanup != nil {
+				t.Fatal("expected no worktree to clean up")
+			}
+			if ws.dir != repoDir || ws.prep.Worktree != "" {
+				t.Fatalf("expected the working tree to be used, got dir=%s prep=%+v", ws.dir, ws.prep)
+			}
+			if ws.prep.Fallback != tc.wantFallback || ws.prep.FallbackDetail == "" {
+				t.Fatalf("expected fallback %q with a detail, got %+v", tc.wantFallback, ws.prep)
+			}
+		})
+	}
+}
+
+func TestPrepareIndexWorkspaceRunNamespace(t *testing.T) {
+	upstream := filepath.Join(t.TempDir(), "upstream")
+	initGitRepo(t, upstream)
+
+	rootDir := t.TempDir()
+	repoDir := filepath.Join(rootDir, "clone")
+	if err := runGit(rootDir, "clone", upstream, repoDir); err != nil {
+		t.Fatalf("git clone: %v", err)
+	}
+
+	tmpDir := t.TempDir()
+	first := newIndexer(io.Discard, io.Discard, nil, nil, Options{TempDir: tmpDir})
+	second := newIndexer(io.Discard, io.Discard, nil, nil, Options{TempDir: tmpDir})
+	second.runID = first.runID + "-other"
+
+	var dirs []string
+	for _, ix := range []*indexer{first, second} {
+		settings, err := ix.resolveRepoSettings(t.Context(), newRepoIdentity(rootDir, repoDir, "clone"), repoDir)
+		if err != nil {
+			t.Fatalf("resolve repo settings: %v", err)
+		}
+		ws := ix.prepareIndexWorkspace(t.Context(), repoDir, "clone", "trunk", settings, false)
+		if ws.cleanup != nil {
+			defer ws.cleanup()
+		}
+		if ws.checkoutOK == nil || !*ws.checkoutOK {
+			t.Fatalf("expected checkout to succeed")
+		}
+		if want := filepath.Join(tmpDir, worktreeRootDirName, ix.runID); filepath.Dir(ws.dir) != want {
+			t.Fatalf("expected worktree in %s, got %s", want, ws.dir)
+		}
+		dirs = append(dirs, ws.dir)
+	}
+	if dirs[0] == dirs[1] {
+		t.Fatalf("expected concurrent runs to use different worktrees, both %s", dirs[0])
+	}
+	if !strings.HasSuffix(first.runID, "-"+strconv.Itoa(os.Getpid())) {
+		t.Fatalf("expected run ID to end with the PID, got %q", first.runID)
+	}
+}
+
+func TestSanitizePathComponent(t *testing.T) {
+	long := strings.Repeat("a", 150)
+	tests := map[string]struct {
+		input string
+		want  string
+	}{
+		"plain":               {input: "services_api", want: "services_api"},
+		"empty":               {input: "  ", want: "default"},
+		"separators":          {input: "feature/x y", want: "feature_x_y"},
+		"reserved name":       {input: "CON", want: "CON_"},
+		"reserved lowercase":  {input: "nul", want: "nul_"},
+		"reserved extension":  {input: "com1.txt", want: "com1_.txt"},
+		"reserved prefix ok":  {input: "CONSOLE", want: "CONSOLE"},
+		"trailing dots":       {input: "release.", want: "release"},
+		"dot dot":             {input: "..", want: "component"},
+		"trailing dot spaces": {input: "v1. ", want: "v1"},
+		"long":                {input: long, want: long[:91] + "-" + shortHash(long)},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := sanitizePathComponent(tc.input); got != tc.want {
+				t.Fatalf("sanitizePathComponent(%q) = %q, want %q", tc.input, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSanitizePathComponentLongUnicode(t *testing.T) {
+	input := strings.Repeat("é", 80)
+	got := sanitizePathComponent(input)
+	if len(got) > maxPathComponentLen {
+		t.Fatalf("expected at most %d bytes, got %d", maxPathComponentLen, len(got))
+	}
+	if !utf8.ValidString(got) {
+		t.Fatalf("expected valid UTF-8, got %q", got)
+	}
+	if other := sanitizePathComponent(input + "x"); other == got {
+		t.Fatalf("expected distinct long inputs to stay distinct, both %q", got)
+	}
+}
+
+func TestWorktreeDirNameLength(t *testing.T) {
+	slug := strings.Repeat("s", maxPathComponentLen)
+	branch := strings.Repeat("b", maxPathComponentLen)
+	got := worktreeDirName(slug, branch)
+	if len(got) > maxPathComponentLen {
+		t.Fatalf("expected at most %d bytes, got %d", maxPathComponentLen, len(got))
+	}
+	if worktreeDirName(slug, branch+"2") == got {
+		t.Fatalf("expected different branches to get different worktree names")
+	}
+	if got, want := worktreeDirName("api", "main"), "api-main-"+shortHash("api\x00main"); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestWorktreeDirNameSanitizedCollision(t *testing.T) {
+	tests := map[string][2]string{
+		"slash and underscore": {"feature/x", "feature_x"},
+		"space and underscore": {"feature x", "feature_x"},
+		"trailing dot":         {"v1.", "v1"},
+	}
+
+	for name, branches := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := worktreeDirName("api", branches[0])
+			b := worktreeDirName("api", branches[1])
+			if a == b {
+				t.Fatalf("expected %q and %q to get different worktree names, both %q", branches[0], branches[1], a)
+			}
+		})
+	}
+	if worktreeDirName("a-b", "c") == worktreeDirName("a", "b-c") {
+		t.Fatalf("expected the slug/branch split to affect the worktree name")
+	}
+}
+
+func shortHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:4])
+}
+
+func TestRunResultsPrepFailurePolicy(t *testing.T) {
+	tests := map[string]struct {
+		policy    string
+		wantRan   bool
+		wantSkip  string
+		wantKind  string
+		wantError bool
+	}{
+		"fallback": {policy: PrepFailureFallback, wantRan: true},
+		"skip":     {policy: PrepFailureSkip, wantSkip: SkipReasonExcludedByFlag},
+		"fail":     {policy: PrepFailureFail, wantKind: ErrorKindGitFetch, wantError: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rootDir := t.TempDir()
+			repoDir := filepath.Join(rootDir, "api")
+			initGitRepo(t, repoDir)
+			if err := runGit(repoDir, "remote", "add", "origin", filepath.Join(rootDir, "gone.git")); err != nil {
+				t.Fatalf("git remote add: %v", err)
+			}
+			codexPath := filepath.Join(t.TempDir(), "codex")
+			if err := os.WriteFile(codexPath, []byte("#!/bin/sh\nexit 0\n"), 0o755); err != nil {
+				t.Fatalf("write codex stub: %v", err)
+			}
+
+			results, err := RunResults(Options{
+				RootDir:           rootDir,
+				SummaryJSON:       filepath.Join(t.TempDir(), "summary.json"),
+				CodexPath:         codexPath,
+				CodexStdin:        StdinClosed,
+				BranchFallbacks:   []string{"trunk"},
+				PrepFailurePolicy: tc.policy,
+			})
+			if err != nil {
+				t.Fatalf("run indexer: %v", err)
+			}
+			api := results[0]
+			if api.Git == nil || api.Git.Fallback != GitFallbackFetch {
+				t.Fatalf("expected a fetch fallback, got %+v", api.Git)
+			}
+			if api.CodexRan != tc.wantRan || api.SkipReason != tc.wantSkip || api.ErrorKind != tc.wantKind {
+				t.Fatalf("expected ran=%t skip=%q kind=%q, got %+v", tc.wantRan, tc.wantSkip, tc.wantKind, api)
+			}
+			if tc.wantError && !strings.Contains(api.Error, "index worktree not prepared (fetch_failed)") {
+				t.Fatalf("expected the fallback reason in the error, got %q", api.Error)
+			}
+		})
+	}
+}